@@ -0,0 +1,283 @@
+// Command lokictl drives OIDC-Loki sessions from shell scripts and CI
+// pipelines: create a mischief session, fetch tokens through it, read its
+// attack report and delete it.
+//
+//	SESSION=$(lokictl session create --mischief alg-none --mischief temporal-tampering)
+//	TOKEN=$(lokictl token get --session "$SESSION")
+//	lokictl report "$SESSION" > report.json
+//	lokictl session delete "$SESSION"
+//
+// Results go to stdout on their own (a session ID, a token, the report as
+// JSON), so they can be captured with $(...); errors go to stderr. The exit
+// status is 0 on success, 1 when Loki answers with an error (an OAuth error
+// from the token endpoint included) or can't be reached, and 2 for usage
+// errors.
+//
+// Every command takes --url (default $LOKI_URL, or http://localhost:3000).
+//
+// Run: go run ./cmd/lokictl session create --mischief alg-none
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"oidc-loki-example/lokiclient"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+const usage = `Usage:
+  lokictl [--url URL] session create [--name NAME] [--mode MODE] [--mischief ID]... [--seed N]
+  lokictl [--url URL] session delete SESSION_ID
+  lokictl [--url URL] token get [--session SESSION_ID] [--client-id ID] [--client-secret SECRET]
+                                [--scope SCOPE] [--refresh-token TOKEN] [--output FIELD]
+  lokictl [--url URL] report SESSION_ID
+`
+
+// usageError is a command line lokictl can't make sense of.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+func usagef(format string, args ...interface{}) error {
+	return usageError(fmt.Sprintf(format, args...))
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes one lokictl command and returns its exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	cmd := &command{stdout: stdout, url: os.Getenv("LOKI_URL"), timeout: 30 * time.Second}
+	if cmd.url == "" {
+		cmd.url = "http://localhost:3000"
+	}
+
+	global := cmd.flagSet("lokictl")
+	err := parse(global, args, -1)
+	if err == nil {
+		err = cmd.dispatch(global.Args())
+	}
+
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "lokictl: %v\n%s", err, usage)
+		return exitUsage
+	default:
+		fmt.Fprintf(stderr, "lokictl: %v\n", err)
+		return exitError
+	}
+}
+
+// command holds the settings shared by every subcommand.
+type command struct {
+	stdout  io.Writer
+	url     string
+	timeout time.Duration
+}
+
+// flagSet returns a flag set with the shared flags, so they can be given
+// before or after the subcommand.
+func (c *command) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&c.url, "url", c.url, "Loki's base URL")
+	fs.DurationVar(&c.timeout, "timeout", c.timeout, "timeout for each request to Loki")
+	return fs
+}
+
+func (c *command) client() *lokiclient.Client {
+	return lokiclient.NewClient(c.url, lokiclient.WithHTTPClient(&http.Client{Timeout: c.timeout}))
+}
+
+func (c *command) dispatch(args []string) error {
+	if len(args) == 0 {
+		return usagef("no command given")
+	}
+	switch name, rest := args[0], args[1:]; name {
+	case "session":
+		if len(rest) == 0 {
+			return usagef("session needs create or delete")
+		}
+		switch rest[0] {
+		case "create":
+			return c.sessionCreate(rest[1:])
+		case "delete":
+			return c.sessionDelete(rest[1:])
+		}
+		return usagef("unknown session command %q", rest[0])
+	case "token":
+		if len(rest) == 0 || rest[0] != "get" {
+			return usagef("token needs get")
+		}
+		return c.tokenGet(rest[1:])
+	case "report":
+		return c.report(rest)
+	}
+	return usagef("unknown command %q", args[0])
+}
+
+// stringList is a flag that can be repeated, collecting each value.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func (c *command) sessionCreate(args []string) error {
+	fs := c.flagSet("session create")
+	var spec lokiclient.SessionSpec
+	var mischief stringList
+	fs.StringVar(&spec.Name, "name", "", "session name")
+	fs.StringVar(&spec.Mode, "mode", "", "explicit, random or probabilistic (default explicit)")
+	fs.Var(&mischief, "mischief", "a plugin to enable (repeatable)")
+	fs.Func("seed", "seed for a probabilistic session", func(value string) error {
+		seed, err := strconv.Atoi(value)
+		spec.Seed = &seed
+		return err
+	})
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	spec.Mischief = mischief
+
+	session, err := c.client().CreateSession(context.Background(), spec)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.stdout, session.ID)
+	return nil
+}
+
+func (c *command) sessionDelete(args []string) error {
+	fs := c.flagSet("session delete")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	return c.client().DeleteSession(context.Background(), fs.Arg(0))
+}
+
+// tokenOutputs are the fields token get can print.
+var tokenOutputs = []string{"access_token", "id_token", "refresh_token", "json"}
+
+func (c *command) tokenGet(args []string) error {
+	fs := c.flagSet("token get")
+	sessionID := fs.String("session", "", "session to request the token through (default: a baseline token)")
+	clientID := fs.String("client-id", "test-client", "client ID")
+	clientSecret := fs.String("client-secret", "test-secret", "client secret; empty for a public client")
+	scope := fs.String("scope", "", "scope to request")
+	refreshToken := fs.String("refresh-token", "", "use the refresh_token grant with this token")
+	output := fs.String("output", "access_token", "what to print: "+strings.Join(tokenOutputs, ", "))
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if !contains(tokenOutputs, *output) {
+		return usagef("--output must be one of %s", strings.Join(tokenOutputs, ", "))
+	}
+
+	grant := lokiclient.ClientCredentials(*clientID, *clientSecret)
+	if *refreshToken != "" {
+		grant = lokiclient.RefreshToken(*clientID, *clientSecret, *refreshToken)
+	}
+	if *scope != "" {
+		if grant.Params == nil {
+			grant.Params = url.Values{}
+		}
+		grant.Params.Set("scope", *scope)
+	}
+
+	tokens, err := c.client().Token(context.Background(), *sessionID, grant)
+	if err != nil {
+		return err
+	}
+	var value string
+	switch *output {
+	case "access_token":
+		value = tokens.AccessToken
+	case "id_token":
+		value = tokens.IDToken
+	case "refresh_token":
+		value = tokens.RefreshToken
+	case "json":
+		return writeJSON(c.stdout, tokens)
+	}
+	if value == "" {
+		return fmt.Errorf("token response has no %s", *output)
+	}
+	fmt.Fprintln(c.stdout, value)
+	return nil
+}
+
+func (c *command) report(args []string) error {
+	fs := c.flagSet("report")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	report, err := c.client().Report(context.Background(), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return writeJSON(c.stdout, report)
+}
+
+// parse parses a command's flags and checks it got want positional
+// arguments (any number when want is negative).
+func parse(fs *flag.FlagSet, args []string, want int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError(err.Error())
+	}
+	switch {
+	case want < 0 || fs.NArg() == want:
+		return nil
+	case want == 0:
+		return usagef("%s takes no arguments", fs.Name())
+	}
+	return usagef("%s needs a session ID", fs.Name())
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeLoki answers like Loki's admin API and token endpoint, recording the
+// last request body it got.
+func fakeLoki(t *testing.T, body *string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent, _ := io.ReadAll(r.Body)
+		*body = string(sent)
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/admin/sessions":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, `{"sessionId":"sess_abc"}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/token":
+			if _, secret, _ := r.BasicAuth(); secret != "test-secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = io.WriteString(w, `{"error":"invalid_client","error_description":"client authentication failed"}`)
+				return
+			}
+			if r.Header.Get("X-Loki-Session") == "sess_err" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = io.WriteString(w, `{"error":"invalid_grant","error_description":"injected"}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{"access_token":"eyJ.a.b","token_type":"Bearer","expires_in":3600,"scope":"read"}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/admin/sessions/sess_abc/report":
+			_, _ = io.WriteString(w, `{"sessionId":"sess_abc","mode":"explicit","mischief":["alg-none"],"issuances":[]}`)
+		case r.Method == http.MethodDelete && r.URL.Path == "/admin/sessions/sess_abc":
+			_, _ = io.WriteString(w, `{"deleted":true}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"error":"Session not found","code":"session_not_found","message":"Session not found"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRun(t *testing.T) {
+	var sent string
+	loki := fakeLoki(t, &sent)
+	t.Setenv("LOKI_URL", loki.URL)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantStatus int
+		wantStdout string
+		wantSent   string
+		wantStderr string
+	}{
+		{
+			name:       "session create with repeated mischief",
+			args:       []string{"session", "create", "--mischief", "alg-none", "--mischief", "kid-injection", "--seed", "7"},
+			wantStdout: "sess_abc\n",
+			wantSent:   `{"mischief":["alg-none","kid-injection"],"seed":7}`,
+		},
+		{
+			name:       "url before the command",
+			args:       []string{"--url", loki.URL, "session", "create", "--name", "ci"},
+			wantStdout: "sess_abc\n",
+			wantSent:   `{"name":"ci"}`,
+		},
+		{
+			name:       "token get through a session",
+			args:       []string{"token", "get", "--session", "sess_abc", "--scope", "read"},
+			wantStdout: "eyJ.a.b\n",
+			wantSent:   "grant_type=client_credentials&scope=read",
+		},
+		{
+			name:       "token get as JSON",
+			args:       []string{"token", "get", "--output", "json"},
+			wantStdout: "{\n  \"access_token\": \"eyJ.a.b\",\n  \"token_type\": \"Bearer\",\n  \"expires_in\": 3600,\n  \"scope\": \"read\"\n}\n",
+		},
+		{
+			name:       "token get without the field asked for",
+			args:       []string{"token", "get", "--output", "id_token"},
+			wantStatus: exitError,
+			wantStderr: "lokictl: token response has no id_token\n",
+		},
+		{
+			name:       "OAuth error",
+			args:       []string{"token", "get", "--session", "sess_err"},
+			wantStatus: exitError,
+			wantStderr: "lokictl: lokiclient: status 400: invalid_grant: injected\n",
+		},
+		{
+			name:       "wrong client secret",
+			args:       []string{"token", "get", "--client-secret", "nope"},
+			wantStatus: exitError,
+			wantStderr: "lokictl: lokiclient: status 401: invalid_client: client authentication failed\n",
+		},
+		{
+			name:       "report",
+			args:       []string{"report", "sess_abc"},
+			wantStdout: "\"sessionId\": \"sess_abc\"",
+		},
+		{
+			name: "session delete",
+			args: []string{"session", "delete", "sess_abc"},
+		},
+		{
+			name:       "session delete for a missing session",
+			args:       []string{"session", "delete", "sess_missing"},
+			wantStatus: exitError,
+			wantStderr: "session_not_found",
+		},
+		{
+			name:       "unknown command",
+			args:       []string{"sessions"},
+			wantStatus: exitUsage,
+			wantStderr: "lokictl: unknown command \"sessions\"\nUsage:",
+		},
+		{
+			name:       "report without a session",
+			args:       []string{"report"},
+			wantStatus: exitUsage,
+			wantStderr: "lokictl: report needs a session ID\n",
+		},
+		{
+			name:       "unknown flag",
+			args:       []string{"token", "get", "--grant", "password"},
+			wantStatus: exitUsage,
+			wantStderr: "flag provided but not defined: -grant",
+		},
+		{
+			name:       "unknown output",
+			args:       []string{"token", "get", "--output", "jwt"},
+			wantStatus: exitUsage,
+			wantStderr: "--output must be one of",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent = ""
+			var stdout, stderr bytes.Buffer
+			status := run(tt.args, &stdout, &stderr)
+
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d (stderr %q)", status, tt.wantStatus, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) || (tt.wantStdout == "" && stdout.Len() > 0) {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) || (tt.wantStderr == "" && stderr.Len() > 0) {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+			if tt.wantSent != "" && normalize(t, sent) != normalize(t, tt.wantSent) {
+				t.Errorf("sent %s, want %s", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+// normalize makes JSON and form bodies comparable regardless of member order.
+func normalize(t *testing.T, body string) string {
+	t.Helper()
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(body), &fields) == nil {
+		encoded, _ := json.Marshal(fields)
+		return string(encoded)
+	}
+	form, err := url.ParseQuery(body)
+	if err != nil {
+		t.Fatalf("parsing body %q: %v", body, err)
+	}
+	return form.Encode()
+}
@@ -0,0 +1,375 @@
+// Package lokiclient is a client for OIDC-Loki's admin API and token
+// endpoint: create a mischief session, request tokens through it and read
+// back the session's attack report, without hand-rolling HTTP.
+//
+//	loki := lokiclient.NewClient("http://localhost:3000")
+//	session, err := loki.CreateSession(ctx, lokiclient.SessionSpec{Mischief: []string{"alg-none"}})
+//	...
+//	tokens, err := loki.Token(ctx, session.ID, lokiclient.ClientCredentials("test-client", "test-secret"))
+//	...
+//	report, err := loki.Report(ctx, session.ID)
+//	...
+//	err = loki.DeleteSession(ctx, session.ID)
+//
+// Errors Loki answers with are *APIError; use errors.Is with
+// ErrSessionNotFound to tell a missing session apart. Requests that never
+// got an answer fail with *TransportError.
+package lokiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrSessionNotFound matches (with errors.Is) the error for a session Loki doesn't have.
+var ErrSessionNotFound = errors.New("lokiclient: session not found")
+
+// APIError is an error response from Loki: an admin API error, or an
+// OAuth error from the token endpoint.
+type APIError struct {
+	// StatusCode is the HTTP status Loki answered with.
+	StatusCode int
+	// Code is Loki's error code, e.g. "session_not_found", or the OAuth
+	// error, e.g. "invalid_client", when Loki sent no code.
+	Code string
+	// Message is the human-readable description, if any.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("lokiclient: status %d: %s", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("lokiclient: status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is reports whether e is the error for a missing session.
+func (e *APIError) Is(target error) bool {
+	return target == ErrSessionNotFound && e.Code == "session_not_found"
+}
+
+// TransportError is a request that got no usable answer from Loki: it
+// couldn't be sent, the context ended, or the response couldn't be read.
+type TransportError struct {
+	Method string
+	URL    string
+	Err    error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("lokiclient: %s %s: %v", e.Method, e.URL, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// Client talks to one Loki instance. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with (default http.DefaultClient).
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient creates a client for the Loki instance at baseURL, e.g. "http://localhost:3000".
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SessionSpec describes a mischief session to create. Zero fields are left
+// to Loki's defaults (mode "explicit", no mischief).
+type SessionSpec struct {
+	Name         string                            `json:"name,omitempty"`
+	Mode         string                            `json:"mode,omitempty"`
+	Mischief     []string                          `json:"mischief,omitempty"`
+	PluginConfig map[string]map[string]interface{} `json:"pluginConfig,omitempty"`
+	// Probabilities and Seed apply to mode "probabilistic".
+	Probabilities map[string]float64 `json:"probabilities,omitempty"`
+	Seed          *int               `json:"seed,omitempty"`
+	// Extra holds spec fields without their own field here, such as
+	// shorthands like "jkuTarget"; they are sent as-is.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON merges Extra into the spec's fields.
+func (s SessionSpec) MarshalJSON() ([]byte, error) {
+	type plain SessionSpec
+	encoded, err := json.Marshal(plain(s))
+	if err != nil || len(s.Extra) == 0 {
+		return encoded, err
+	}
+	fields := map[string]interface{}{}
+	for name, value := range s.Extra {
+		fields[name] = value
+	}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// Session is a created session.
+type Session struct {
+	ID string `json:"sessionId"`
+}
+
+// CreateSession creates a mischief session.
+func (c *Client) CreateSession(ctx context.Context, spec SessionSpec) (*Session, error) {
+	body, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("lokiclient: encoding session spec: %w", err)
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, "/admin/sessions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var session Session
+	if err := c.do(req, http.StatusCreated, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// DeleteSession deletes a session.
+func (c *Client) DeleteSession(ctx context.Context, sessionID string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, "/admin/sessions/"+url.PathEscape(sessionID), nil)
+	if err != nil {
+		return err
+	}
+
+	var deleted struct {
+		Deleted bool `json:"deleted"`
+	}
+	return c.do(req, http.StatusOK, &deleted)
+}
+
+// Grant is a token request: the grant type, its parameters and the client
+// credentials to authenticate with.
+type Grant struct {
+	Type         string
+	ClientID     string
+	ClientSecret string
+	// Params are sent alongside grant_type, e.g. code and redirect_uri.
+	Params url.Values
+}
+
+// ClientCredentials is a client_credentials grant authenticated with HTTP Basic.
+func ClientCredentials(clientID, clientSecret string) Grant {
+	return Grant{Type: "client_credentials", ClientID: clientID, ClientSecret: clientSecret}
+}
+
+// RefreshToken is a refresh_token grant.
+func RefreshToken(clientID, clientSecret, refreshToken string) Grant {
+	return Grant{
+		Type:         "refresh_token",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Params:       url.Values{"refresh_token": {refreshToken}},
+	}
+}
+
+// TokenResponse is a successful token endpoint response.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	IDToken      string `json:"id_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Token requests tokens, through the session when sessionID isn't empty
+// (an empty sessionID gets a baseline token with no mischief). A client
+// with a secret authenticates with HTTP Basic; a public client sends its
+// client_id in the form.
+func (c *Client) Token(ctx context.Context, sessionID string, grant Grant) (*TokenResponse, error) {
+	form := url.Values{}
+	for name, values := range grant.Params {
+		form[name] = values
+	}
+	form.Set("grant_type", grant.Type)
+	if grant.ClientSecret == "" && grant.ClientID != "" {
+		form.Set("client_id", grant.ClientID)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if grant.ClientSecret != "" {
+		req.SetBasicAuth(grant.ClientID, grant.ClientSecret)
+	}
+	if sessionID != "" {
+		req.Header.Set("X-Loki-Session", sessionID)
+	}
+
+	var tokens TokenResponse
+	if err := c.do(req, http.StatusOK, &tokens); err != nil {
+		return nil, err
+	}
+	return &tokens, nil
+}
+
+// Report is a session's attack report: every JWT it issued and what
+// mischief did to it.
+type Report struct {
+	SessionID string `json:"sessionId"`
+	Mode      string `json:"mode"`
+	// Mischief lists every plugin that mutated an issued token, in order of first use.
+	Mischief      []string       `json:"mischief"`
+	Issuances     []Issuance     `json:"issuances"`
+	TransientKeys []TransientKey `json:"transientKeys,omitempty"`
+}
+
+// Issuance is one token a session issued.
+type Issuance struct {
+	TokenType string `json:"tokenType"`
+	// JTI is empty for tokens without one, such as ID tokens.
+	JTI       string     `json:"jti"`
+	IssuedAt  string     `json:"issuedAt"`
+	RequestID string     `json:"requestId,omitempty"`
+	Mischief  []string   `json:"mischief"`
+	Mutations []Mutation `json:"mutations"`
+	Changes   struct {
+		Header []FieldChange `json:"header"`
+		Claims []FieldChange `json:"claims"`
+	} `json:"changes"`
+	Header map[string]interface{} `json:"header"`
+	// SigningKey is nil when none of the keys Loki knows verifies the token.
+	SigningKey *SigningKey `json:"signingKey"`
+	Nonce      *Nonce      `json:"nonce,omitempty"`
+	// Drawn lists the plugins drawn for the token request in a probabilistic session.
+	Drawn []string `json:"drawn,omitempty"`
+}
+
+// Mutation is what one plugin did to a token.
+type Mutation struct {
+	Plugin   string                 `json:"plugin"`
+	Mutation string                 `json:"mutation"`
+	Evidence map[string]interface{} `json:"evidence"`
+}
+
+// FieldChange is a header parameter or claim that differs from the token
+// the provider signed; Before or After is nil when the field was absent.
+type FieldChange struct {
+	Name   string      `json:"name"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// SigningKey identifies the key whose signature a token carries.
+type SigningKey struct {
+	Kid        string `json:"kid"`
+	Thumbprint string `json:"thumbprint"`
+	// Source is "loki", "rogue-jwks", "transient" or "attacker".
+	Source string `json:"source"`
+}
+
+// Nonce is the nonce an ID token should have echoed, and the one it carried.
+type Nonce struct {
+	Expected string  `json:"expected"`
+	Actual   *string `json:"actual"`
+}
+
+// TransientKey is a key published in the session's JWKS for a window.
+type TransientKey struct {
+	Kid       string `json:"kid"`
+	AddedAt   string `json:"addedAt"`
+	RemovedAt string `json:"removedAt"`
+	Fetches   int    `json:"fetches"`
+}
+
+// Report fetches a session's attack report.
+func (c *Client) Report(ctx context.Context, sessionID string) (*Report, error) {
+	path := "/admin/sessions/" + url.PathEscape(sessionID) + "/report"
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var report Report
+	if err := c.do(req, http.StatusOK, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("lokiclient: building request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// do sends req and decodes a response with the wanted status into v;
+// any other status becomes an *APIError.
+func (c *Client) do(req *http.Request, want int, v interface{}) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return &TransportError{Method: req.Method, URL: req.URL.String(), Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &TransportError{Method: req.Method, URL: req.URL.String(), Err: err}
+	}
+	if resp.StatusCode != want {
+		return apiError(resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("lokiclient: decoding %s %s response: %w", req.Method, req.URL, err)
+	}
+	return nil
+}
+
+// apiError reads Loki's error body: {code, message} from the admin API, or
+// {error, error_description} (plus Loki's code) from OIDC endpoints.
+func apiError(status int, body []byte) *APIError {
+	var fields struct {
+		Code             string `json:"code"`
+		Message          string `json:"message"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	e := &APIError{StatusCode: status}
+	if json.Unmarshal(body, &fields) != nil {
+		e.Code = http.StatusText(status)
+		e.Message = strings.TrimSpace(string(body))
+		return e
+	}
+	e.Code = fields.Code
+	if e.Code == "" {
+		e.Code = fields.Error
+	}
+	e.Message = fields.Message
+	if e.Message == "" {
+		e.Message = fields.ErrorDescription
+	}
+	return e
+}
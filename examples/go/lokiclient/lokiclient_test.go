@@ -0,0 +1,361 @@
+package lokiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLoki answers like Loki's admin API and token endpoint, recording the
+// last request it got.
+type fakeLoki struct {
+	server *httptest.Server
+
+	mu   sync.Mutex
+	last *http.Request
+	body string
+}
+
+// lastRequest returns the last request the fake got and its body.
+func (f *fakeLoki) lastRequest() (*http.Request, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.last, f.body
+}
+
+func newFakeLoki(t *testing.T) *fakeLoki {
+	t.Helper()
+	f := &fakeLoki{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		body := string(raw)
+		f.mu.Lock()
+		f.last, f.body = r, body
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/admin/sessions":
+			if strings.Contains(body, `"mode":"chaotic"`) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = io.WriteString(w, `{"error":"bad mode","code":"invalid_session_spec","message":"bad mode"}`)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, `{"sessionId":"sess_abc"}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/token":
+			form, _ := url.ParseQuery(body)
+			if _, secret, _ := r.BasicAuth(); secret != "test-secret" && form.Get("client_id") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = io.WriteString(w, `{"error":"invalid_client","error_description":"client authentication failed"}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{"access_token":"eyJ.a.b","token_type":"Bearer","expires_in":3600}`)
+		case r.URL.Path == "/admin/sessions/sess_abc/report":
+			_, _ = io.WriteString(w, `{"sessionId":"sess_abc","mode":"explicit","mischief":["alg-none"],
+				"issuances":[{"tokenType":"access_token","jti":"j1","issuedAt":"2026-01-01T00:00:00.000Z",
+				"mischief":["alg-none"],"mutations":[{"plugin":"alg-none","mutation":"Set alg to none","evidence":{}}],
+				"changes":{"header":[{"name":"alg","before":"RS256","after":"none"}],"claims":[]},
+				"header":{"alg":"none"},"signingKey":null}]}`)
+		case r.Method == http.MethodDelete && r.URL.Path == "/admin/sessions/sess_abc":
+			_, _ = io.WriteString(w, `{"deleted":true}`)
+		case strings.HasPrefix(r.URL.Path, "/admin/sessions/"):
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"error":"Session not found","code":"session_not_found","message":"Session not found"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func TestCreateSession(t *testing.T) {
+	loki := newFakeLoki(t)
+	client := NewClient(loki.server.URL + "/")
+	seed := 7
+
+	tests := []struct {
+		name     string
+		spec     SessionSpec
+		wantBody map[string]interface{}
+		wantCode string
+	}{
+		{
+			name:     "explicit mischief",
+			spec:     SessionSpec{Name: "go", Mischief: []string{"alg-none"}},
+			wantBody: map[string]interface{}{"name": "go", "mischief": []interface{}{"alg-none"}},
+		},
+		{
+			name: "probabilistic with a shorthand",
+			spec: SessionSpec{
+				Mode:          "probabilistic",
+				Mischief:      []string{"alg-none"},
+				Probabilities: map[string]float64{"alg-none": 0.5},
+				Seed:          &seed,
+				Extra:         map[string]interface{}{"jkuTarget": "http://attacker.test/jwks"},
+			},
+			wantBody: map[string]interface{}{
+				"mode":          "probabilistic",
+				"mischief":      []interface{}{"alg-none"},
+				"probabilities": map[string]interface{}{"alg-none": 0.5},
+				"seed":          float64(7),
+				"jkuTarget":     "http://attacker.test/jwks",
+			},
+		},
+		{
+			name:     "rejected spec",
+			spec:     SessionSpec{Mode: "chaotic"},
+			wantBody: map[string]interface{}{"mode": "chaotic"},
+			wantCode: "invalid_session_spec",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := client.CreateSession(context.Background(), tt.spec)
+
+			_, body := loki.lastRequest()
+			var sent map[string]interface{}
+			if err := json.Unmarshal([]byte(body), &sent); err != nil {
+				t.Fatalf("decoding sent spec: %v", err)
+			}
+			if got, want := mustJSON(t, sent), mustJSON(t, tt.wantBody); got != want {
+				t.Errorf("sent %s, want %s", got, want)
+			}
+
+			if tt.wantCode != "" {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+					t.Fatalf("err = %v, want APIError %s", err, tt.wantCode)
+				}
+				if apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "bad mode" {
+					t.Errorf("APIError = %+v", apiErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if session.ID != "sess_abc" {
+				t.Errorf("ID = %q", session.ID)
+			}
+		})
+	}
+}
+
+func TestToken(t *testing.T) {
+	loki := newFakeLoki(t)
+	client := NewClient(loki.server.URL)
+
+	tests := []struct {
+		name        string
+		sessionID   string
+		grant       Grant
+		wantForm    url.Values
+		wantBasic   bool
+		wantSession string
+		wantCode    string
+	}{
+		{
+			name:        "client credentials through a session",
+			sessionID:   "sess_abc",
+			grant:       ClientCredentials("test-client", "test-secret"),
+			wantForm:    url.Values{"grant_type": {"client_credentials"}},
+			wantBasic:   true,
+			wantSession: "sess_abc",
+		},
+		{
+			name:     "baseline refresh for a public client",
+			grant:    RefreshToken("spa-client", "", "rt-1"),
+			wantForm: url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"rt-1"}, "client_id": {"spa-client"}},
+		},
+		{
+			name:      "wrong secret",
+			grant:     ClientCredentials("test-client", "nope"),
+			wantForm:  url.Values{"grant_type": {"client_credentials"}},
+			wantBasic: true,
+			wantCode:  "invalid_client",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := client.Token(context.Background(), tt.sessionID, tt.grant)
+
+			last, body := loki.lastRequest()
+			form, _ := url.ParseQuery(body)
+			if got, want := mustJSON(t, form), mustJSON(t, tt.wantForm); got != want {
+				t.Errorf("form %s, want %s", got, want)
+			}
+			if _, _, ok := last.BasicAuth(); ok != tt.wantBasic {
+				t.Errorf("basic auth sent = %v, want %v", ok, tt.wantBasic)
+			}
+			if got := last.Header.Get("X-Loki-Session"); got != tt.wantSession {
+				t.Errorf("X-Loki-Session = %q, want %q", got, tt.wantSession)
+			}
+
+			if tt.wantCode != "" {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+					t.Fatalf("err = %v, want APIError %s", err, tt.wantCode)
+				}
+				if apiErr.Message != "client authentication failed" {
+					t.Errorf("Message = %q", apiErr.Message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Token: %v", err)
+			}
+			if tokens.AccessToken != "eyJ.a.b" || tokens.ExpiresIn != 3600 {
+				t.Errorf("tokens = %+v", tokens)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	loki := newFakeLoki(t)
+	client := NewClient(loki.server.URL)
+
+	report, err := client.Report(context.Background(), "sess_abc")
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if len(report.Issuances) != 1 {
+		t.Fatalf("issuances = %+v", report.Issuances)
+	}
+	issuance := report.Issuances[0]
+	if issuance.JTI != "j1" || issuance.SigningKey != nil || issuance.Mutations[0].Plugin != "alg-none" {
+		t.Errorf("issuance = %+v", issuance)
+	}
+	if change := issuance.Changes.Header[0]; change.Name != "alg" || change.After != "none" {
+		t.Errorf("header change = %+v", change)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	loki := newFakeLoki(t)
+	client := NewClient(loki.server.URL)
+
+	if err := client.DeleteSession(context.Background(), "sess_abc"); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if last, _ := loki.lastRequest(); last.Method != http.MethodDelete || last.URL.Path != "/admin/sessions/sess_abc" {
+		t.Errorf("sent %s %s", last.Method, last.URL.Path)
+	}
+	if err := client.DeleteSession(context.Background(), "sess_missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("deleting a missing session: err = %v, want ErrSessionNotFound", err)
+	}
+}
+
+// TestConcurrentUse shares one Client between many goroutines, as a load
+// test does; run it with -race.
+func TestConcurrentUse(t *testing.T) {
+	loki := newFakeLoki(t)
+	client := NewClient(loki.server.URL)
+	grant := ClientCredentials("test-client", "test-secret")
+	grant.Params = url.Values{"scope": {"openid"}}
+
+	const workers, rounds = 16, 25
+	errs := make(chan error, workers*rounds*3)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := context.Background()
+			for j := 0; j < rounds; j++ {
+				session, err := client.CreateSession(ctx, SessionSpec{Mischief: []string{"alg-none"}})
+				if err != nil {
+					errs <- err
+					continue
+				}
+				if _, err := client.Token(ctx, session.ID, grant); err != nil {
+					errs <- err
+				}
+				if _, err := client.Report(ctx, session.ID); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	loki := newFakeLoki(t)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name          string
+		client        *Client
+		ctx           context.Context
+		wantNotFound  bool
+		wantTransport bool
+	}{
+		{name: "unknown session", client: NewClient(loki.server.URL), ctx: context.Background(), wantNotFound: true},
+		{name: "server down", client: NewClient(closed.URL), ctx: context.Background(), wantTransport: true},
+		{name: "context canceled", client: NewClient(loki.server.URL), ctx: canceled, wantTransport: true},
+		{
+			name: "transport failure",
+			client: NewClient(loki.server.URL, WithHTTPClient(&http.Client{
+				Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+					return nil, errors.New("timeout")
+				}),
+				Timeout: time.Second,
+			})),
+			ctx:           context.Background(),
+			wantTransport: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.client.Report(tt.ctx, "sess_missing")
+			if err == nil {
+				t.Fatal("Report succeeded")
+			}
+			if got := errors.Is(err, ErrSessionNotFound); got != tt.wantNotFound {
+				t.Errorf("errors.Is(ErrSessionNotFound) = %v, want %v (%v)", got, tt.wantNotFound, err)
+			}
+			var transport *TransportError
+			if got := errors.As(err, &transport); got != tt.wantTransport {
+				t.Errorf("errors.As(*TransportError) = %v, want %v (%v)", got, tt.wantTransport, err)
+			}
+		})
+	}
+
+	if _, err := NewClient(loki.server.URL).Report(canceled, "sess_abc"); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled request err = %v, want context.Canceled", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("encoding: %v", err)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,248 @@
+// Package lokitest runs an OIDC-Loki server for the length of a Go test,
+// so client tests don't need an instance started beforehand.
+//
+//	srv := lokitest.NewTestServer(t)
+//	session := srv.CreateSession(lokiclient.SessionSpec{Mischief: []string{"alg-none"}})
+//	tokens := srv.Token(session.ID, lokiclient.ClientCredentials("test-client", "test-secret"))
+//
+// Loki is a Node.js server, so NewTestServer starts the standalone server
+// from the Loki checkout as a child process, listening on a free loopback
+// port behind an httptest.Server. The httptest URL is Loki's issuer, so
+// discovery, the JWKS and every other route of the real server are
+// reached through it. t.Cleanup stops both when the test ends.
+//
+// The checkout's dependencies must be installed (npm install); without
+// node_modules the test is skipped rather than failed.
+package lokitest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oidc-loki-example/lokiclient"
+)
+
+// startTimeout bounds how long NewTestServer waits for Loki to answer /health.
+const startTimeout = 30 * time.Second
+
+// stopTimeout bounds how long Loki gets to shut down before it is killed.
+const stopTimeout = 5 * time.Second
+
+// Server is a Loki server started for one test.
+type Server struct {
+	// URL is the server's base URL, e.g. http://127.0.0.1:41234; it is also Loki's issuer.
+	URL string
+	// Client talks to the server's admin API and token endpoint.
+	Client *lokiclient.Client
+
+	t testing.TB
+}
+
+// Option configures NewTestServer.
+type Option func(*config)
+
+type config struct {
+	dir     string
+	command []string
+	env     []string
+}
+
+// WithDir sets the Loki checkout the server runs from (default: the one
+// this package is in).
+func WithDir(dir string) Option {
+	return func(c *config) {
+		c.dir = dir
+	}
+}
+
+// WithCommand sets the command that starts Loki's standalone server, run
+// in the checkout (default: node --import tsx src/server.ts; a built
+// checkout starts faster with node dist/server.js).
+func WithCommand(name string, args ...string) Option {
+	return func(c *config) {
+		c.command = append([]string{name}, args...)
+	}
+}
+
+// WithEnv adds environment variables for the server, e.g.
+// "LOKI_ADMIN_TOKEN=secret" or "LOKI_PROFILE=oauth21".
+func WithEnv(env ...string) Option {
+	return func(c *config) {
+		c.env = append(c.env, env...)
+	}
+}
+
+// NewTestServer starts Loki for the test and returns once it is serving.
+// The server keeps nothing on disk, and is stopped by t.Cleanup.
+func NewTestServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	cfg := &config{
+		dir:     checkoutDir(),
+		command: []string{"node", "--import", "tsx", "src/server.ts"},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.dir, "node_modules")); err != nil {
+		t.Skipf("lokitest: Loki's dependencies aren't installed in %s (run npm install)", cfg.dir)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		t.Fatalf("lokitest: finding a free port: %v", err)
+	}
+	upstream := &url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(port))}
+	front := httptest.NewServer(httputil.NewSingleHostReverseProxy(upstream))
+	t.Cleanup(front.Close)
+
+	cmd := exec.Command(cfg.command[0], cfg.command[1:]...)
+	cmd.Dir = cfg.dir
+	cmd.Env = append(os.Environ(),
+		"LOKI_HOST=127.0.0.1",
+		"LOKI_PORT="+strconv.Itoa(port),
+		"LOKI_ISSUER="+front.URL,
+		"LOKI_STORE=memory",
+		"LOKI_LOG_LEVEL=warn",
+	)
+	cmd.Env = append(cmd.Env, cfg.env...)
+	output := &syncBuffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("lokitest: starting %s: %v", strings.Join(cfg.command, " "), err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		stop(cmd, exited)
+	})
+
+	if err := waitHealthy(upstream.String()+"/health", exited); err != nil {
+		t.Fatalf("lokitest: %v\n%s", err, output.String())
+	}
+	return &Server{URL: front.URL, Client: lokiclient.NewClient(front.URL), t: t}
+}
+
+// CreateSession creates a mischief session, failing the test if Loki refuses it.
+func (s *Server) CreateSession(spec lokiclient.SessionSpec) *lokiclient.Session {
+	s.t.Helper()
+	session, err := s.Client.CreateSession(context.Background(), spec)
+	if err != nil {
+		s.t.Fatalf("lokitest: creating session: %v", err)
+	}
+	return session
+}
+
+// Token requests tokens through a session, failing the test if the token
+// endpoint answers with an error. An empty session ID gets a baseline token.
+func (s *Server) Token(sessionID string, grant lokiclient.Grant) *lokiclient.TokenResponse {
+	s.t.Helper()
+	tokens, err := s.Client.Token(context.Background(), sessionID, grant)
+	if err != nil {
+		s.t.Fatalf("lokitest: requesting token: %v", err)
+	}
+	return tokens
+}
+
+// Report returns a session's attack report, failing the test if there is none.
+func (s *Server) Report(sessionID string) *lokiclient.Report {
+	s.t.Helper()
+	report, err := s.Client.Report(context.Background(), sessionID)
+	if err != nil {
+		s.t.Fatalf("lokitest: fetching report: %v", err)
+	}
+	return report
+}
+
+// checkoutDir is the Loki checkout this package is in: three levels up
+// from this file (examples/go/lokitest).
+func checkoutDir() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return "."
+	}
+	return filepath.Join(filepath.Dir(file), "..", "..", "..")
+}
+
+// freePort returns a loopback port nothing is listening on.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitHealthy polls Loki's health check until it answers 200, the process
+// exits or startTimeout passes.
+func waitHealthy(healthURL string, exited <-chan struct{}) error {
+	client := &http.Client{Timeout: time.Second}
+	deadline := time.Now().Add(startTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-exited:
+			return errors.New("Loki exited before it was serving")
+		default:
+		}
+		resp, err := client.Get(healthURL)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("Loki didn't answer %s within %s", healthURL, startTimeout)
+}
+
+// stop asks Loki to shut down, killing it if it hasn't within stopTimeout.
+func stop(cmd *exec.Cmd, exited <-chan struct{}) {
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		// No interrupts on Windows
+		_ = cmd.Process.Kill()
+	}
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// syncBuffer collects the server's output, to show when it fails to start.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,149 @@
+package lokitest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oidc-loki-example/lokiclient"
+	"oidc-loki-example/middleware"
+)
+
+// fakeLokiEnv makes the test binary serve as a fake Loki instead of running tests.
+const fakeLokiEnv = "LOKITEST_FAKE_LOKI"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeLokiEnv) == "1" {
+		serveFakeLoki()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// serveFakeLoki answers like Loki's standalone server, from the LOKI_*
+// environment it was started with, until it is interrupted.
+func serveFakeLoki() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"status":"ok"}`)
+	})
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   os.Getenv("LOKI_ISSUER"),
+			"jwks_uri": os.Getenv("LOKI_ISSUER") + "/jwks",
+		})
+	})
+	mux.HandleFunc("/admin/sessions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"sessionId":"sess_fake"}`)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+		payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": header + "." + payload + ".",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+	server := &http.Server{Addr: os.Getenv("LOKI_HOST") + ":" + os.Getenv("LOKI_PORT"), Handler: mux}
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		<-interrupted
+		_ = server.Close()
+	}()
+	_ = server.ListenAndServe()
+}
+
+// fakeCheckout is a directory that looks like a Loki checkout with its
+// dependencies installed.
+func fakeCheckout(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "node_modules"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestNewTestServerServesLokiAtItsIssuer(t *testing.T) {
+	var base string
+	t.Run("serving", func(t *testing.T) {
+		srv := NewTestServer(t,
+			WithDir(fakeCheckout(t)),
+			WithCommand(os.Args[0], "-test.run=^$"),
+			WithEnv(fakeLokiEnv+"=1"),
+		)
+		base = srv.URL
+
+		resp, err := http.Get(srv.URL + "/.well-known/openid-configuration")
+		if err != nil {
+			t.Fatalf("discovery: %v", err)
+		}
+		defer resp.Body.Close()
+		var metadata struct {
+			Issuer string `json:"issuer"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+			t.Fatalf("decoding discovery: %v", err)
+		}
+		if metadata.Issuer != srv.URL {
+			t.Errorf("issuer = %q, want the test server's URL %q", metadata.Issuer, srv.URL)
+		}
+
+		session := srv.CreateSession(lokiclient.SessionSpec{Mischief: []string{"alg-none"}})
+		if session.ID != "sess_fake" {
+			t.Errorf("session ID = %q, want sess_fake", session.ID)
+		}
+		tokens := srv.Token(session.ID, lokiclient.ClientCredentials("test-client", "test-secret"))
+		if !strings.HasSuffix(tokens.AccessToken, ".") {
+			t.Errorf("access token = %q, want an unsigned token", tokens.AccessToken)
+		}
+	})
+
+	if resp, err := http.Get(base + "/health"); err == nil {
+		resp.Body.Close()
+		t.Errorf("server still answering after its test ended: %s", resp.Status)
+	}
+}
+
+func TestWaitHealthyStopsWhenLokiExits(t *testing.T) {
+	exited := make(chan struct{})
+	close(exited)
+	if err := waitHealthy("http://127.0.0.1:1/health", exited); err == nil {
+		t.Error("waitHealthy succeeded for a server that exited")
+	}
+}
+
+// TestAlgNoneRejected shows the package in use against the real server:
+// the validator from the middleware package must reject the token an
+// alg-none session issues.
+func TestAlgNoneRejected(t *testing.T) {
+	srv := NewTestServer(t)
+	session := srv.CreateSession(lokiclient.SessionSpec{Mischief: []string{"alg-none"}})
+	tokens := srv.Token(session.ID, lokiclient.ClientCredentials("test-client", "test-secret"))
+
+	v, err := middleware.New(middleware.Config{
+		Issuer:   srv.URL,
+		Audience: "https://loki.test/api",
+		JWKSURL:  srv.URL + "/jwks",
+	})
+	if err != nil {
+		t.Fatalf("middleware.New: %v", err)
+	}
+	if _, err := v.Validate(context.Background(), tokens.AccessToken); err == nil {
+		t.Error("validator accepted the alg-none token")
+	}
+	if report := srv.Report(session.ID); len(report.Mischief) == 0 {
+		t.Error("report lists no mischief applied")
+	}
+}
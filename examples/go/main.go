@@ -9,18 +9,15 @@
 package main
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"oidc-loki-example/lokiclient"
 )
 
 const (
@@ -29,17 +26,7 @@ const (
 	clientSecret = "test-secret"
 )
 
-// LokiSession represents a mischief session
-type LokiSession struct {
-	SessionID string `json:"sessionId"`
-}
-
-// TokenResponse represents the OIDC token response
-type TokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
-}
+var loki = lokiclient.NewClient(lokiURL)
 
 func main() {
 	fmt.Println("=== OIDC-Loki Go Client Security Tests ===\n")
@@ -58,61 +45,23 @@ func main() {
 }
 
 // createSession creates a mischief session with Loki
-func createSession(name string, mischief []string) (*LokiSession, error) {
-	payload := map[string]interface{}{
-		"name":     name,
-		"mode":     "explicit",
-		"mischief": mischief,
-	}
-
-	body, _ := json.Marshal(payload)
-	resp, err := http.Post(lokiURL+"/admin/sessions", "application/json", bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create session: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var session LokiSession
-	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
-		return nil, fmt.Errorf("failed to decode session: %w", err)
-	}
-	return &session, nil
+func createSession(name string, mischief []string) (*lokiclient.Session, error) {
+	return loki.CreateSession(context.Background(), lokiclient.SessionSpec{
+		Name:     name,
+		Mode:     "explicit",
+		Mischief: mischief,
+	})
 }
 
 // getToken requests a token from Loki with an optional session ID
-func getToken(sessionID string) (*TokenResponse, error) {
-	data := url.Values{}
-	data.Set("grant_type", "client_credentials")
-
-	req, _ := http.NewRequest("POST", lokiURL+"/token", strings.NewReader(data.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString(
-		[]byte(clientID+":"+clientSecret)))
-
-	if sessionID != "" {
-		req.Header.Set("X-Loki-Session", sessionID)
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("token request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, body)
-	}
-
-	var tokenResp TokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return nil, fmt.Errorf("failed to decode token response: %w", err)
-	}
-	return &tokenResp, nil
+func getToken(sessionID string) (*lokiclient.TokenResponse, error) {
+	grant := lokiclient.ClientCredentials(clientID, clientSecret)
+	return loki.Token(context.Background(), sessionID, grant)
 }
 
-// validateToken demonstrates secure token validation
-// In production, use a proper OIDC library like coreos/go-oidc
+// validateToken demonstrates the security checks to look for
+// In production, use the middleware package (RequireToken), which verifies
+// signatures against the JWKS, or a proper OIDC library like coreos/go-oidc
 func validateToken(tokenString string) error {
 	// Parse without validation to inspect claims
 	parser := jwt.NewParser()
@@ -160,7 +109,7 @@ func testAlgNone() {
 		return
 	}
 
-	tokenResp, err := getToken(session.SessionID)
+	tokenResp, err := getToken(session.ID)
 	if err != nil {
 		log.Printf("  SKIP: Could not get token: %v\n\n", err)
 		return
@@ -187,7 +136,7 @@ func testKeyConfusion() {
 		return
 	}
 
-	tokenResp, err := getToken(session.SessionID)
+	tokenResp, err := getToken(session.ID)
 	if err != nil {
 		log.Printf("  SKIP: Could not get token: %v\n\n", err)
 		return
@@ -214,7 +163,7 @@ func testTemporalTampering() {
 		return
 	}
 
-	tokenResp, err := getToken(session.SessionID)
+	tokenResp, err := getToken(session.ID)
 	if err != nil {
 		log.Printf("  SKIP: Could not get token: %v\n\n", err)
 		return
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"oidc-loki-example/lokiclient"
+)
+
+// TestMischiefCatalog drives the validator against every token mischief a
+// running OIDC-Loki offers. It needs an instance whose test-client can use
+// client_credentials:
+//
+//	LOKI_URL=http://localhost:3000 go test ./middleware -run TestMischiefCatalog
+//
+// Plugins that don't touch a client_credentials access token (the session
+// report lists no mischief) are skipped.
+func TestMischiefCatalog(t *testing.T) {
+	lokiURL := strings.TrimSuffix(os.Getenv("LOKI_URL"), "/")
+	if lokiURL == "" {
+		t.Skip("LOKI_URL not set")
+	}
+	loki := lokiclient.NewClient(lokiURL)
+	grant := lokiclient.ClientCredentials("test-client", "test-secret")
+	ctx := context.Background()
+
+	v, err := New(Config{
+		Issuer:    lokiURL,
+		Audience:  "https://loki.test/api",
+		JWKSURL:   lokiURL + "/jwks",
+		TokenType: "at+jwt",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	baseline, err := loki.Token(ctx, "", grant)
+	if err != nil {
+		t.Fatalf("baseline token: %v", err)
+	}
+	if _, err := v.Validate(ctx, baseline.AccessToken); err != nil {
+		t.Fatalf("baseline token rejected: %v", err)
+	}
+
+	plugins, err := tokenPlugins(lokiURL)
+	if err != nil {
+		t.Fatalf("listing plugins: %v", err)
+	}
+	for _, plugin := range plugins {
+		t.Run(plugin, func(t *testing.T) {
+			session, err := loki.CreateSession(ctx, lokiclient.SessionSpec{
+				Name:     "middleware-" + plugin,
+				Mode:     "explicit",
+				Mischief: []string{plugin},
+			})
+			if err != nil {
+				t.Fatalf("creating session: %v", err)
+			}
+			tokens, err := loki.Token(ctx, session.ID, grant)
+			if err != nil {
+				t.Skipf("no token issued: %v", err)
+			}
+			if report, err := loki.Report(ctx, session.ID); err != nil {
+				t.Fatalf("reading report: %v", err)
+			} else if len(report.Mischief) == 0 {
+				t.Skip("mischief does not apply to client_credentials access tokens")
+			}
+
+			if _, err := v.Validate(ctx, tokens.AccessToken); err == nil {
+				t.Errorf("token accepted")
+			}
+		})
+	}
+}
+
+// tokenPlugins lists the plugins that forge or tamper with tokens.
+func tokenPlugins(lokiURL string) ([]string, error) {
+	resp, err := http.Get(lokiURL + "/admin/plugins")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET /admin/plugins: status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Plugins []struct {
+			ID    string `json:"id"`
+			Phase string `json:"phase"`
+		} `json:"plugins"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, p := range body.Plugins {
+		if p.Phase == "token-signing" || p.Phase == "token-claims" {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxJWKSBytes bounds the JWKS response so an oversized key set can't exhaust memory.
+const maxJWKSBytes = 1 << 20
+
+// jwk is a single JSON Web Key as published in a JWKS document.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey is a parsed verification key and the metadata used to match it.
+type publicKey struct {
+	kid string
+	alg string // alg pinned by the JWK, if any
+	key crypto.PublicKey
+}
+
+// JWKSCache fetches a JWKS document and caches its keys.
+//
+// Keys are refreshed once the cache is older than the TTL, and on a lookup
+// for an unknown kid. Either way at most one fetch is attempted per
+// MinRefreshInterval, so tokens with random kids or an unreachable issuer
+// can't turn the validator into a JWKS request amplifier. If a refresh
+// fails, the previously fetched keys keep being served.
+type JWKSCache struct {
+	url                string
+	client             *http.Client
+	ttl                time.Duration
+	minRefreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        []publicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewJWKSCache creates a cache for the JWKS at url.
+func NewJWKSCache(url string, client *http.Client, ttl, minRefreshInterval time.Duration) *JWKSCache {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKSCache{url: url, client: client, ttl: ttl, minRefreshInterval: minRefreshInterval}
+}
+
+// Key returns the key that verifies a token with the given kid and alg.
+//
+// A token without a kid only matches when exactly one usable key is published.
+func (c *JWKSCache) Key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.fetchedAt) > c.ttl && time.Since(c.lastAttempt) >= c.minRefreshInterval {
+		if err := c.refresh(ctx); err != nil && len(c.keys) == 0 {
+			return nil, err
+		}
+	}
+
+	key, err := c.match(kid, alg)
+	if err == nil {
+		return key, nil
+	}
+
+	// Unknown kid: the issuer may have rotated keys since the last fetch
+	if time.Since(c.lastAttempt) >= c.minRefreshInterval {
+		if refreshErr := c.refresh(ctx); refreshErr != nil {
+			return nil, errors.Join(err, refreshErr)
+		}
+		return c.match(kid, alg)
+	}
+	return nil, err
+}
+
+func (c *JWKSCache) match(kid, alg string) (crypto.PublicKey, error) {
+	var candidates []publicKey
+	for _, k := range c.keys {
+		if kid != "" && k.kid != kid {
+			continue
+		}
+		if k.alg != "" && k.alg != alg {
+			continue
+		}
+		if !keyFitsAlg(k.key, alg) {
+			continue
+		}
+		candidates = append(candidates, k)
+	}
+
+	switch {
+	case len(candidates) == 1:
+		return candidates[0].key, nil
+	case len(candidates) == 0:
+		return nil, fmt.Errorf("no %s key with kid %q in JWKS", alg, kid)
+	default:
+		return nil, fmt.Errorf("token has no kid and the JWKS has %d %s keys", len(candidates), alg)
+	}
+}
+
+func (c *JWKSCache) refresh(ctx context.Context) error {
+	c.lastAttempt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("building JWKS request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching JWKS: status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(&doc); err != nil {
+		return fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make([]publicKey, 0, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(k)
+		if err != nil {
+			// Skip keys we can't use rather than failing the whole set
+			continue
+		}
+		keys = append(keys, publicKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+// parseJWK converts a public JWK to a Go public key. Private members are never read.
+func parseJWK(k jwk) (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || n.BitLen() < 2048 {
+			return nil, errors.New("RSA key too weak")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// keyFitsAlg reports whether key is the right type (and curve) for alg.
+func keyFitsAlg(key crypto.PublicKey, alg string) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		switch alg {
+		case "ES256":
+			return k.Curve == elliptic.P256()
+		case "ES384":
+			return k.Curve == elliptic.P384()
+		case "ES512":
+			return k.Curve == elliptic.P521()
+		}
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+	return false
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
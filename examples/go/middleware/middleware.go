@@ -0,0 +1,214 @@
+// Package middleware provides RequireToken, an HTTP middleware that
+// validates bearer JWTs the way a resource server should: signature
+// against the issuer's JWKS, algorithm against an allowlist, and the
+// iss/aud/exp/nbf claims.
+//
+// It is the secure counterpart to the ad-hoc validateToken in main.go.
+// Drop it in front of your handlers, then point OIDC-Loki at the resource
+// server to confirm every token mischief is rejected.
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultAlgorithms is the allowlist used when Config.Algorithms is empty:
+// asymmetric algorithms only, so a public key can never be used as an HMAC secret.
+var DefaultAlgorithms = []string{"RS256", "PS256", "ES256"}
+
+// Config configures a Validator.
+type Config struct {
+	// Issuer is the exact expected iss claim (required).
+	Issuer string
+	// Audience must appear in the aud claim (required).
+	Audience string
+	// JWKSURL is where the issuer publishes its signing keys (required).
+	// Pin it in configuration rather than trusting jku/x5u headers or discovery.
+	JWKSURL string
+	// Algorithms is the alg allowlist (default DefaultAlgorithms).
+	Algorithms []string
+	// TokenType, when set, is the required typ header, e.g. "at+jwt" (RFC 9068).
+	TokenType string
+	// Leeway is the clock skew tolerated on exp, nbf and iat (default 0).
+	Leeway time.Duration
+	// JWKSCacheTTL is how long fetched keys are reused (default 10 minutes).
+	JWKSCacheTTL time.Duration
+	// JWKSMinRefreshInterval limits refetches for unknown kids (default 30 seconds).
+	JWKSMinRefreshInterval time.Duration
+	// HTTPClient fetches the JWKS (default: a client with a 10 second timeout).
+	HTTPClient *http.Client
+}
+
+// Validator validates bearer tokens against a Config.
+type Validator struct {
+	config Config
+	parser *jwt.Parser
+	jwks   *JWKSCache
+}
+
+// New creates a Validator, checking the required settings.
+func New(config Config) (*Validator, error) {
+	if config.Issuer == "" || config.Audience == "" || config.JWKSURL == "" {
+		return nil, errors.New("middleware: Issuer, Audience and JWKSURL are required")
+	}
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = DefaultAlgorithms
+	}
+	for _, alg := range config.Algorithms {
+		if alg == "none" || strings.HasPrefix(alg, "HS") {
+			return nil, fmt.Errorf("middleware: algorithm %q is not allowed for JWKS validation", alg)
+		}
+	}
+	if config.JWKSCacheTTL == 0 {
+		config.JWKSCacheTTL = 10 * time.Minute
+	}
+	if config.JWKSMinRefreshInterval == 0 {
+		config.JWKSMinRefreshInterval = 30 * time.Second
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(config.Algorithms),
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithAudience(config.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(config.Leeway),
+	)
+
+	return &Validator{
+		config: config,
+		parser: parser,
+		jwks: NewJWKSCache(
+			config.JWKSURL, config.HTTPClient, config.JWKSCacheTTL, config.JWKSMinRefreshInterval,
+		),
+	}, nil
+}
+
+// Validate verifies a token and returns its claims.
+func (v *Validator) Validate(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	if err := v.checkHeader(tokenString); err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.jwks.Key(ctx, kid, token.Method.Alg())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkHeader rejects headers the JWT library would otherwise accept or
+// silently reinterpret: duplicate members (including ones differing only
+// in case), critical extensions we don't implement, and the wrong typ.
+func (v *Validator) checkHeader(tokenString string) error {
+	encoded, _, ok := strings.Cut(tokenString, ".")
+	if !ok {
+		return errors.New("token is not a JWS compact serialization")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("decoding header: %w", err)
+	}
+
+	header, err := decodeUniqueObject(raw)
+	if err != nil {
+		return fmt.Errorf("invalid header: %w", err)
+	}
+
+	// RFC 7515 Section 4.1.11: unknown critical extensions MUST be rejected
+	if _, ok := header["crit"]; ok {
+		return errors.New("header declares critical extensions this validator does not implement")
+	}
+
+	if v.config.TokenType != "" {
+		typ, _ := header["typ"].(string)
+		if !strings.EqualFold(typ, v.config.TokenType) &&
+			!strings.EqualFold(typ, "application/"+v.config.TokenType) {
+			return fmt.Errorf("token typ %q is not %q", typ, v.config.TokenType)
+		}
+	}
+	return nil
+}
+
+// decodeUniqueObject decodes a JSON object, failing on duplicate member
+// names compared case-insensitively.
+func decodeUniqueObject(raw []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+
+	object := map[string]interface{}{}
+	seen := map[string]string{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name := tok.(string)
+		if first, dup := seen[strings.ToLower(name)]; dup {
+			return nil, fmt.Errorf("duplicate member %q (already have %q)", name, first)
+		}
+		seen[strings.ToLower(name)] = name
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		object[name] = value
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("trailing data after JSON object")
+	}
+	return object, nil
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the claims RequireToken stored for the request.
+func ClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(jwt.MapClaims)
+	return claims, ok
+}
+
+// RequireToken returns middleware that rejects requests without a valid
+// bearer token with 401, and passes the token's claims to next via the
+// request context (see ClaimsFromContext).
+func RequireToken(v *Validator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				http.Error(w, "missing bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := v.Validate(r.Context(), token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://issuer.test"
+	testAudience = "https://api.test"
+)
+
+// testIdP serves a JWKS for a set of RSA keys that can be swapped at runtime.
+type testIdP struct {
+	mu     sync.Mutex
+	keys   map[string]*rsa.PrivateKey
+	server *httptest.Server
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	idp := &testIdP{keys: map[string]*rsa.PrivateKey{"k1": generateKey(t)}}
+	idp.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		keys := []map[string]string{}
+		for kid, key := range idp.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) key(kid string) *rsa.PrivateKey {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	return idp.keys[kid]
+}
+
+func (idp *testIdP) validator(t *testing.T, config Config) *Validator {
+	t.Helper()
+	config.Issuer = testIssuer
+	config.Audience = testAudience
+	config.JWKSURL = idp.server.URL
+	v, err := New(config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return v
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	return key
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": testIssuer,
+		"aud": testAudience,
+		"sub": "alice",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+// signRaw signs the exact header JSON given, so tests can emit headers
+// the JWT library would never produce.
+func signRaw(t *testing.T, key *rsa.PrivateKey, header string, claims jwt.MapClaims) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("encoding claims: %v", err)
+	}
+	input := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("signing: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	return signRaw(t, key, `{"alg":"RS256","typ":"at+jwt","kid":"`+kid+`"}`, claims)
+}
+
+func TestValidateAcceptsValidToken(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, Config{TokenType: "at+jwt"})
+
+	claims, err := v.Validate(context.Background(), sign(t, idp.key("k1"), "k1", validClaims()))
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if claims["sub"] != "alice" {
+		t.Errorf("sub = %v, want alice", claims["sub"])
+	}
+}
+
+func TestValidateRejectsMischief(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, Config{TokenType: "at+jwt"})
+	key := idp.key("k1")
+	attacker := generateKey(t)
+
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+	without := func(name string) jwt.MapClaims {
+		claims := validClaims()
+		delete(claims, name)
+		return claims
+	}
+	encode := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	publicPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: mustMarshalPKIX(t, &key.PublicKey),
+	})
+	keyConfusion, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString(publicPEM)
+	if err != nil {
+		t.Fatalf("signing HS256: %v", err)
+	}
+
+	tampered := sign(t, key, "k1", validClaims())
+	parts := strings.Split(tampered, ".")
+	tampered = parts[0] + "." + encode(with("sub", "admin")) + "." + parts[2]
+
+	tests := map[string]string{
+		"alg none":           encode(map[string]string{"alg": "none", "typ": "at+jwt"}) + "." + encode(validClaims()) + ".",
+		"key confusion":      keyConfusion,
+		"expired":            sign(t, key, "k1", with("exp", time.Now().Add(-time.Minute).Unix())),
+		"missing exp":        sign(t, key, "k1", without("exp")),
+		"not yet valid":      sign(t, key, "k1", with("nbf", time.Now().Add(time.Hour).Unix())),
+		"issued in future":   sign(t, key, "k1", with("iat", time.Now().Add(time.Hour).Unix())),
+		"wrong issuer":       sign(t, key, "k1", with("iss", "https://evil.test")),
+		"wrong audience":     sign(t, key, "k1", with("aud", "https://other-api.test")),
+		"unknown kid":        sign(t, key, "k2", validClaims()),
+		"attacker key":       sign(t, attacker, "k1", validClaims()),
+		"tampered claims":    tampered,
+		"jku injection":      signRaw(t, attacker, `{"alg":"RS256","typ":"at+jwt","kid":"k1","jku":"https://evil.test/jwks"}`, validClaims()),
+		"duplicate alg":      signRaw(t, key, `{"alg":"RS256","typ":"at+jwt","kid":"k1","alg":"none"}`, validClaims()),
+		"case shadowed alg":  signRaw(t, key, `{"alg":"RS256","ALG":"none","typ":"at+jwt","kid":"k1"}`, validClaims()),
+		"uppercase header":   signRaw(t, key, `{"ALG":"RS256","TYP":"at+jwt","KID":"k1"}`, validClaims()),
+		"critical extension": signRaw(t, key, `{"alg":"RS256","typ":"at+jwt","kid":"k1","crit":["exp"],"exp":1}`, validClaims()),
+		"id token as access": signRaw(t, key, `{"alg":"RS256","typ":"JWT","kid":"k1"}`, validClaims()),
+		"not a jwt":          "not-a-jwt",
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := v.Validate(context.Background(), token); err == nil {
+				t.Errorf("token accepted")
+			}
+		})
+	}
+}
+
+func TestValidatePicksUpRotatedKeys(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, Config{JWKSMinRefreshInterval: time.Nanosecond})
+
+	if _, err := v.Validate(context.Background(), sign(t, idp.key("k1"), "k1", validClaims())); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	rotated := generateKey(t)
+	idp.mu.Lock()
+	idp.keys["k2"] = rotated
+	idp.mu.Unlock()
+
+	if _, err := v.Validate(context.Background(), sign(t, rotated, "k2", validClaims())); err != nil {
+		t.Fatalf("token signed with rotated key rejected: %v", err)
+	}
+}
+
+func TestValidateRateLimitsExpiredCacheRefreshes(t *testing.T) {
+	idp := newTestIdP(t)
+	var mu sync.Mutex
+	fetches := 0
+	jwks := idp.server.Config.Handler
+	idp.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		first := fetches == 1
+		mu.Unlock()
+		if !first {
+			// The issuer goes down once the keys have been fetched
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		jwks.ServeHTTP(w, r)
+	})
+	v := idp.validator(t, Config{JWKSCacheTTL: time.Nanosecond, JWKSMinRefreshInterval: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		if _, err := v.Validate(context.Background(), sign(t, idp.key("k1"), "k1", validClaims())); err != nil {
+			t.Fatalf("valid token rejected: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fetches != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", fetches)
+	}
+}
+
+func TestNewRejectsUnsafeConfig(t *testing.T) {
+	for name, config := range map[string]Config{
+		"missing issuer": {Audience: testAudience, JWKSURL: "https://issuer.test/jwks"},
+		"hmac allowed": {
+			Issuer: testIssuer, Audience: testAudience, JWKSURL: "https://issuer.test/jwks",
+			Algorithms: []string{"RS256", "HS256"},
+		},
+		"none allowed": {
+			Issuer: testIssuer, Audience: testAudience, JWKSURL: "https://issuer.test/jwks",
+			Algorithms: []string{"none"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(config); err == nil {
+				t.Errorf("config accepted")
+			}
+		})
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, Config{})
+
+	handler := RequireToken(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		_, _ = w.Write([]byte(claims["sub"].(string)))
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantChallenge string
+	}{
+		{"valid", "Bearer " + sign(t, idp.key("k1"), "k1", validClaims()), http.StatusOK, ""},
+		{"lowercase scheme", "bearer " + sign(t, idp.key("k1"), "k1", validClaims()), http.StatusOK, ""},
+		{"missing", "", http.StatusUnauthorized, `Bearer`},
+		{"basic", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, `Bearer`},
+		{"invalid", "Bearer not-a-jwt", http.StatusUnauthorized, `Bearer error="invalid_token"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/resource", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantChallenge)
+			}
+			if tt.wantStatus == http.StatusOK && rec.Body.String() != "alice" {
+				t.Errorf("body = %q, want claims passed to handler", rec.Body.String())
+			}
+		})
+	}
+}
+
+func mustMarshalPKIX(t *testing.T, key *rsa.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("marshaling public key: %v", err)
+	}
+	return der
+}
@@ -0,0 +1,754 @@
+/**
+ * OpenAPI - a machine-readable contract for the admin API and OIDC endpoints
+ *
+ * Served at /admin/openapi.json as an OpenAPI 3.1 document. The admin
+ * paths come from the routes the admin app actually registers, so a route
+ * can't be served without appearing here: each is looked up in
+ * ADMIN_OPERATIONS for its summary and, for the routes clients script
+ * against most, request and response schemas. The OIDC endpoints Loki
+ * serves in front of the provider (token, introspection, revocation,
+ * userinfo, discovery and JWKS) are described alongside, with the `X-Loki-Session` header that
+ * binds a request to a session.
+ */
+
+import { ERROR_CODES } from "../core/errors.js";
+
+type Schema = Record<string, unknown>;
+
+/** Version of the API contract; bumped when a described shape changes */
+const API_VERSION = "1.0.0";
+
+/** A route registered on the admin app, as Hono lists it */
+export interface AdminRoute {
+	method: string;
+	path: string;
+}
+
+export interface OpenApiOptions {
+	issuer: string;
+	adminRoutes: AdminRoute[];
+}
+
+interface Operation {
+	summary: string;
+	/** JSON request body schema */
+	body?: Schema;
+	/** JSON success response schema, with its status (default 200) */
+	response?: Schema;
+	status?: number;
+	/** Query parameters, by name */
+	query?: Record<string, string>;
+}
+
+const ref = (name: string): Schema => ({ $ref: `#/components/schemas/${name}` });
+
+const stringArray: Schema = { type: "array", items: { type: "string" } };
+
+/**
+ * Admin operations by "METHOD /path" (Hono path syntax, relative to /admin)
+ */
+export const ADMIN_OPERATIONS: Record<string, Operation> = {
+	"GET /health": { summary: "Health check" },
+	"GET /errors": {
+		summary: "Every error code Loki rejects requests with, and what it means",
+		response: {
+			type: "object",
+			properties: { codes: { type: "object", additionalProperties: { type: "string" } } },
+		},
+	},
+	"GET /openapi.json": { summary: "This document" },
+	"GET /sessions": {
+		summary: "List all sessions",
+		response: {
+			type: "object",
+			properties: { sessions: { type: "array", items: ref("SessionSummary") } },
+		},
+	},
+	"POST /sessions": {
+		summary: "Create a new session",
+		body: ref("SessionSpec"),
+		response: ref("SessionCreated"),
+		status: 201,
+	},
+	"POST /sessions/batch": {
+		summary: "Create up to 100 sessions in one request",
+		body: {
+			oneOf: [
+				{ type: "array", items: ref("SessionSpec") },
+				{
+					type: "object",
+					required: ["sessions"],
+					properties: {
+						sessions: { type: "array", items: ref("SessionSpec") },
+						atomic: { type: "boolean", default: true },
+						namePrefix: {
+							type: "string",
+							description: "Prepended to each session's name, or its index if unnamed",
+						},
+					},
+				},
+			],
+		},
+		status: 201,
+	},
+	"POST /fuzz": {
+		summary: "Create sessions with random mischief combinations",
+		body: {
+			type: "object",
+			required: ["count"],
+			properties: {
+				count: { type: "integer", minimum: 1, maximum: 100 },
+				include: { ...stringArray, description: "Plugins to draw from (default: all)" },
+				exclude: { ...stringArray, description: "Plugins never drawn" },
+				maxMischief: { type: "integer", minimum: 1, default: 3 },
+				seed: { type: "integer", minimum: 0, description: "Draws the same combinations again" },
+			},
+		},
+		status: 201,
+	},
+	"POST /sessions/:id/clone": {
+		summary: "Create a session from another's spec, deep-merging an override patch",
+		body: {
+			type: "object",
+			description: "Spec fields overriding the source session's; null removes one",
+		},
+		response: {
+			type: "object",
+			required: ["sessionId", "clonedFrom"],
+			properties: { sessionId: { type: "string" }, clonedFrom: { type: "string" } },
+		},
+		status: 201,
+	},
+	"GET /sessions/:id": { summary: "Get session details", response: ref("SessionDetail") },
+	"DELETE /sessions/:id": { summary: "Delete a session" },
+	"DELETE /sessions": { summary: "Purge all sessions" },
+	"GET /sessions/:id/ledger": { summary: "Get full mischief ledger" },
+	"GET /sessions/:id/events": {
+		summary: "Get the session event timeline, or watch token activity live",
+		query: {
+			format:
+				"`ndjson` streams the events, one per line; `sse` (or Accept: text/event-stream) " +
+				"streams token issuances, introspections and revocations as server-sent events",
+			since: "Only events after this seq",
+		},
+	},
+	"GET /sessions/:id/refresh-ledger": {
+		summary: "Get refresh token rotations and detected reuses",
+	},
+	"GET /sessions/:id/keys": {
+		summary: "Export the private keys signing the session's tokens (test-only)",
+	},
+	"POST /sessions/:id/results": {
+		summary: "Report whether the client accepted a token",
+		body: {
+			type: "object",
+			required: ["jti", "accepted"],
+			properties: { jti: { type: "string" }, accepted: { type: "boolean" } },
+		},
+	},
+	"GET /sessions/:id/results": {
+		summary: "Get per-mischief pass rates and the overall verdict",
+	},
+	"GET /sessions/:id/report": {
+		summary: "Get what mischief did to each token the session issued",
+		response: ref("SessionReport"),
+	},
+	"GET /sessions/:id/stats": {
+		summary: "Get the session's issuance counters and rate limiting",
+		response: ref("SessionStats"),
+	},
+	"GET /sessions/:id/har": {
+		summary: "Export the session's recorded HTTP exchanges as HAR 1.2, credentials redacted",
+	},
+	"GET /sessions/:id/replay": { summary: "Get the session's last token response byte for byte" },
+	"POST /sessions/:id/freeze": { summary: "Freeze the session on its next token response" },
+	"DELETE /sessions/:id/freeze": { summary: "Unfreeze the session" },
+	"GET /plugins": { summary: "List available plugins" },
+	"GET /plugins/:id": { summary: "Get plugin details" },
+	"GET /mischief": {
+		summary: "Catalog the mischief session specs accept, with options and example sessions",
+		response: {
+			type: "object",
+			properties: {
+				mischief: {
+					type: "array",
+					items: {
+						type: "object",
+						properties: {
+							id: { type: "string" },
+							name: { type: "string" },
+							description: { type: "string" },
+							severity: { type: "string", enum: ["critical", "high", "medium", "low"] },
+							phase: { type: "string" },
+							affects: {
+								type: "object",
+								properties: {
+									surface: {
+										type: "string",
+										enum: ["token", "token-response", "endpoint", "discovery"],
+									},
+									segments: { type: "array", items: { type: "string" } },
+									tokens: { type: "array", items: { type: "string" } },
+								},
+							},
+							options: {
+								type: "array",
+								items: {
+									type: "object",
+									properties: {
+										name: { type: "string" },
+										type: {},
+										values: { type: "array" },
+										default: {},
+										description: { type: "string" },
+									},
+								},
+							},
+							reference: {
+								type: "object",
+								properties: {
+									rfc: { type: "string" },
+									oidc: { type: "string" },
+									cwe: { type: "string" },
+									requirement: { type: "string" },
+								},
+							},
+							example: { type: "object" },
+						},
+					},
+				},
+			},
+		},
+	},
+	"GET /plugins/phase/:phase": { summary: "List plugins in a phase" },
+	"GET /plugins/severity/:severity": { summary: "List plugins of a severity" },
+	"POST /jwks/rollover-plan": { summary: "Start a signing algorithm rollover plan" },
+	"GET /jwks/rollover-plan": { summary: "Get rollover status and active-algorithm history" },
+	"DELETE /jwks/rollover-plan": { summary: "Stop the rollover plan" },
+	"POST /jwks/key-set": { summary: "Start a key set of concurrently valid signing keys" },
+	"GET /jwks/key-set": { summary: "Get key set status and which key signed each token" },
+	"DELETE /jwks/key-set/keys/:kid": {
+		summary: "Retire a key from the key set",
+		query: { replace: "`true` rotates a fresh key in" },
+	},
+	"DELETE /jwks/key-set": { summary: "Stop the key set" },
+	"POST /keys": { summary: "Register a signing key" },
+	"GET /keys": { summary: "List registered signing keys" },
+	"GET /keys/:id": { summary: "Get a registered signing key" },
+	"POST /keys/:id/rotate": { summary: "Swap new material and a new kid in under the same id" },
+	"PUT /keys/:id/visibility": { summary: "Publish a registered key to some clients only" },
+	"DELETE /keys/:id": { summary: "Remove a registered signing key" },
+	"GET /clients": { summary: "List configured and registered clients" },
+	"POST /clients": {
+		summary: "Register a client, or a configured client's public keys",
+		status: 201,
+	},
+	"GET /clients/:id": { summary: "Get a client and its registered keys" },
+	"DELETE /clients/:id": { summary: "Delete a registered client" },
+	"DELETE /clients/:id/keys": { summary: "Drop a client's registered keys" },
+	"GET /tenants": { summary: "List tenants and their issuers" },
+	"POST /tenants": { summary: "Register a tenant served under /{id}", status: 201 },
+	"GET /tenants/:id": { summary: "Get a tenant" },
+	"DELETE /tenants/:id": { summary: "Remove a tenant" },
+	"GET /faults": { summary: "Get error-rate faults and injected counts" },
+	"PUT /faults": { summary: "Replace error-rate faults" },
+	"GET /revocations": {
+		summary: "Revoked jtis, split into listed vs omitted",
+		query: { session: "Only this session's revocations" },
+	},
+	"GET /topology": { summary: "Export declared sessions as a topology document" },
+	"POST /plan": { summary: "Dry-run a topology document" },
+	"POST /apply": { summary: "Reconcile declared sessions to a topology document" },
+	"GET /requests/:requestId": { summary: "Everything one request produced, by its X-Request-ID" },
+	"GET /attack-of-the-day": { summary: "The attack the rotating session is running" },
+	"GET /chaos": { summary: "Chaos mode's rate, plugin pool and draws" },
+	"POST /probe/discovery-consistency": {
+		summary: "Audit an issuer's discovery document, JWKS and a sample token",
+	},
+	"GET /rogue-jwks/:sessionId": {
+		summary: "Attacker keys the session's jku-injection tokens point at",
+	},
+	"GET /rogue-x5u/:sessionId": {
+		summary: "PEM certificate chain the session's x5u-injection tokens point at",
+	},
+	"POST /reset": { summary: "Purge all sessions" },
+};
+
+const SCHEMAS: Record<string, Schema> = {
+	Error: {
+		type: "object",
+		required: ["error", "code", "message", "details"],
+		properties: {
+			error: {
+				type: "string",
+				description: "The message, or the OAuth error code at OIDC endpoints",
+			},
+			error_description: { type: "string" },
+			code: { type: "string", enum: Object.keys(ERROR_CODES) },
+			message: { type: "string" },
+			details: { type: "object" },
+		},
+	},
+	SessionSpec: {
+		type: "object",
+		properties: {
+			name: { type: "string" },
+			mode: {
+				type: "string",
+				enum: ["explicit", "random", "shuffled", "probabilistic"],
+				default: "explicit",
+			},
+			mischief: { ...stringArray, description: "Plugin IDs" },
+			probability: { type: "number", minimum: 0, maximum: 1 },
+			probabilities: {
+				type: "object",
+				additionalProperties: { type: "number", minimum: 0, maximum: 1 },
+			},
+			seed: { type: "integer", minimum: 0 },
+			warmupRequests: { type: "integer", minimum: 0 },
+			pluginConfig: { type: "object", additionalProperties: { type: "object" } },
+			targets: {
+				type: "object",
+				additionalProperties: { type: "string", enum: ["access_token", "id_token", "both"] },
+				description: "Token each plugin applies to, by plugin ID (default: both)",
+			},
+			ttl: { type: "string", description: "Go duration after which the session is evicted" },
+			when: {
+				type: "object",
+				properties: { sourceCIDR: { oneOf: [{ type: "string" }, stringArray] } },
+			},
+			keyId: { type: "string", description: "A registered signing key" },
+			webhook: { type: "string", format: "uri", description: "Where issuances are POSTed" },
+			maxTokensPerSecond: {
+				type: "number",
+				exclusiveMinimum: 0,
+				description: "Token requests per second before the rest get 429",
+			},
+			sdJwt: {
+				type: "object",
+				required: ["claims"],
+				properties: {
+					claims: { ...stringArray, description: "Claims sent as SD-JWT disclosures" },
+					tokens: { type: "string", enum: ["access_token", "id_token", "both"] },
+				},
+				description: "Issue the session's tokens as SD-JWTs",
+			},
+			audFormat: {
+				type: "string",
+				enum: ["string", "array"],
+				description: "Serialize a single aud as a string or a one-element array",
+			},
+			tokenLifetime: {
+				type: "string",
+				description: "Go duration access tokens live: their exp and the response's expires_in",
+			},
+			jkuTarget: { type: "string", format: "uri" },
+			audTarget: { type: "string" },
+			issTarget: { type: "string" },
+			embeddedJwkKidCollision: { type: "boolean" },
+			jwksRaceWindow: {
+				type: "object",
+				properties: { fetches: { type: "integer" }, seconds: { type: "number" } },
+			},
+			jwksMaxAge: {
+				type: "integer",
+				minimum: 1,
+				description: "JWKS max-age in seconds, for jwks-cache-poison",
+			},
+			claims: { type: "object", description: "Claims claim-injection merges into tokens" },
+			headers: {
+				type: "object",
+				description: "Header parameters header-injection merges into tokens",
+			},
+			expOffset: { type: "string", description: "Go duration, for temporal-future" },
+			nbfOffset: { type: "string", description: "Go duration, for temporal-future" },
+			tokenPadBytes: {
+				type: "integer",
+				minimum: 1,
+				maximum: 67108864,
+				description: "Padding size, for oversized-token",
+			},
+			tokenDelay: { type: "string", description: "Go duration, for slow-response" },
+			amr: {
+				type: "array",
+				items: { type: "string", minLength: 1 },
+				minItems: 1,
+				description: "Authentication methods claimed, for auth-context-spoof",
+			},
+			acr: {
+				type: "string",
+				minLength: 1,
+				description: "Authentication context class claimed, for auth-context-spoof",
+			},
+		},
+	},
+	SessionCreated: {
+		type: "object",
+		required: ["sessionId"],
+		properties: { sessionId: { type: "string" } },
+	},
+	SessionSummary: {
+		type: "object",
+		properties: {
+			id: { type: "string" },
+			name: { type: "string" },
+			mode: { type: "string" },
+			mischief: stringArray,
+			startedAt: { type: "string", format: "date-time" },
+			endedAt: { type: "string", format: "date-time" },
+		},
+	},
+	SessionDetail: {
+		type: "object",
+		properties: {
+			id: { type: "string" },
+			mode: { type: "string" },
+			isEnded: { type: "boolean" },
+			seed: { type: "integer" },
+			warmupRemaining: { type: "integer" },
+			freezeState: { type: ["string", "null"], enum: ["pending", "frozen", null] },
+			ledger: { type: "object" },
+			summary: { type: "object" },
+		},
+	},
+	SessionStats: {
+		type: "object",
+		required: ["sessionId", "issuances", "clean", "mischief", "firstIssuedAt", "lastIssuedAt"],
+		properties: {
+			sessionId: { type: "string" },
+			issuances: { type: "integer", description: "Tokens issued" },
+			clean: { type: "integer", description: "Tokens issued without mischief" },
+			mischief: {
+				type: "object",
+				additionalProperties: { type: "integer" },
+				description: "Tokens each plugin was applied to",
+			},
+			firstIssuedAt: { type: ["string", "null"], format: "date-time" },
+			lastIssuedAt: { type: ["string", "null"], format: "date-time" },
+			rateLimited: { type: "integer", description: "Token requests turned away with 429" },
+			maxTokensPerSecond: { type: "number" },
+		},
+	},
+	SessionReport: {
+		type: "object",
+		properties: {
+			sessionId: { type: "string" },
+			mode: { type: "string" },
+			mischief: stringArray,
+			issuances: {
+				type: "array",
+				items: {
+					type: "object",
+					properties: {
+						tokenType: { type: "string" },
+						jti: { type: ["string", "null"] },
+						issuedAt: { type: "string", format: "date-time" },
+						requestId: { type: "string" },
+						mischief: stringArray,
+						mutations: { type: "array", items: { type: "object" } },
+						changes: { type: "object" },
+						header: { type: "object" },
+						signingKey: { type: ["object", "null"] },
+						expiry: {
+							type: "object",
+							properties: {
+								expiresIn: { type: "integer" },
+								exp: {},
+								difference: { type: ["integer", "null"] },
+							},
+						},
+					},
+				},
+			},
+			userinfo: {
+				type: "array",
+				items: {
+					type: "object",
+					properties: {
+						servedAt: { type: "string", format: "date-time" },
+						requestId: { type: "string" },
+						tokenSub: { type: "string" },
+						mischief: stringArray,
+						mutations: { type: "array", items: { type: "object" } },
+						changes: { type: "array", items: { type: "object" } },
+					},
+				},
+			},
+			revocations: {
+				type: "array",
+				items: {
+					type: "object",
+					properties: {
+						revokedAt: { type: "string", format: "date-time" },
+						requestId: { type: "string" },
+						jti: { type: "string" },
+						tokenType: { type: ["string", "null"] },
+						clientId: { type: ["string", "null"] },
+						ignored: { type: "boolean" },
+						mischief: stringArray,
+						mutations: { type: "array", items: { type: "object" } },
+					},
+				},
+			},
+		},
+	},
+	TokenResponse: {
+		type: "object",
+		properties: {
+			access_token: { type: "string" },
+			token_type: { type: "string" },
+			expires_in: { type: "integer" },
+			id_token: { type: "string" },
+			refresh_token: { type: "string" },
+			scope: { type: "string" },
+		},
+	},
+	IntrospectionResponse: {
+		type: "object",
+		required: ["active"],
+		properties: {
+			active: { type: "boolean" },
+			scope: { type: "string" },
+			client_id: { type: "string" },
+			sub: { type: "string" },
+			aud: { oneOf: [{ type: "string" }, stringArray] },
+			iss: { type: "string" },
+			exp: { type: "integer" },
+			iat: { type: "integer" },
+			jti: { type: "string" },
+		},
+	},
+	DiscoveryDocument: {
+		type: "object",
+		required: ["issuer", "jwks_uri"],
+		properties: {
+			issuer: { type: "string" },
+			authorization_endpoint: { type: "string" },
+			token_endpoint: { type: "string" },
+			jwks_uri: { type: "string" },
+			userinfo_endpoint: { type: "string" },
+			introspection_endpoint: { type: "string" },
+		},
+		additionalProperties: true,
+	},
+	Jwks: {
+		type: "object",
+		required: ["keys"],
+		properties: { keys: { type: "array", items: { type: "object" } } },
+	},
+};
+
+const SESSION_HEADER: Schema = {
+	name: "X-Loki-Session",
+	in: "header",
+	required: false,
+	description:
+		"Binds the request to a session: its mischief applies and its events are recorded. " +
+		"Without it the response is clean, unless the client has a default mischief session.",
+	schema: { type: "string" },
+};
+
+const SESSION_QUERY: Schema = {
+	name: "loki_session",
+	in: "query",
+	required: false,
+	description:
+		"Names the session for discovery and JWKS fetches that can't send X-Loki-Session; " +
+		"the header wins when both are sent",
+	schema: { type: "string" },
+};
+
+/**
+ * The OpenAPI document for a running Loki
+ */
+export function openApiDocument(options: OpenApiOptions): Schema {
+	return {
+		openapi: "3.1.0",
+		info: {
+			title: "OIDC-Loki",
+			version: API_VERSION,
+			description: "Admin API and the OIDC endpoints Loki serves in front of its provider",
+		},
+		servers: [{ url: options.issuer }],
+		paths: { ...oidcPaths(), ...adminPaths(options.adminRoutes) },
+		components: {
+			schemas: SCHEMAS,
+			parameters: { XLokiSession: SESSION_HEADER, LokiSessionQuery: SESSION_QUERY },
+			securitySchemes: {
+				adminToken: {
+					type: "http",
+					scheme: "bearer",
+					description: "Required on every admin route when Loki has an admin token",
+				},
+				adminBasic: {
+					type: "http",
+					scheme: "basic",
+					description: "The admin token as the password, with any username",
+				},
+				clientSecretBasic: { type: "http", scheme: "basic" },
+				accessToken: { type: "http", scheme: "bearer" },
+			},
+		},
+	};
+}
+
+function adminPaths(routes: AdminRoute[]): Record<string, Record<string, Schema>> {
+	const paths: Record<string, Record<string, Schema>> = {};
+	for (const { method, path } of routes) {
+		const operation = ADMIN_OPERATIONS[`${method} ${path}`];
+		if (!operation) {
+			continue;
+		}
+		const openApiPath = `/admin${path.replace(/:(\w+)/g, "{$1}")}`;
+		const parameters: Schema[] = [...path.matchAll(/:(\w+)/g)].map(([, name]) => ({
+			name,
+			in: "path",
+			required: true,
+			schema: { type: "string" },
+		}));
+		for (const [name, description] of Object.entries(operation.query ?? {})) {
+			parameters.push({ name, in: "query", description, schema: { type: "string" } });
+		}
+
+		const status = String(operation.status ?? 200);
+		const success: Schema = { description: operation.summary };
+		if (operation.response) {
+			success.content = { "application/json": { schema: operation.response } };
+		}
+		const described: Schema = {
+			summary: operation.summary,
+			tags: ["admin"],
+			security: path.startsWith("/rogue-") ? [] : [{ adminToken: [] }, { adminBasic: [] }],
+			responses: {
+				[status]: success,
+				"4XX": errorResponse("Rejected; `code` says why"),
+			},
+		};
+		if (parameters.length > 0) {
+			described.parameters = parameters;
+		}
+		if (operation.body) {
+			described.requestBody = { content: { "application/json": { schema: operation.body } } };
+		}
+		paths[openApiPath] = { ...paths[openApiPath], [method.toLowerCase()]: described };
+	}
+	return paths;
+}
+
+function oidcPaths(): Record<string, Record<string, Schema>> {
+	const session = { $ref: "#/components/parameters/XLokiSession" };
+	const sessionQuery = { $ref: "#/components/parameters/LokiSessionQuery" };
+	const json = (schema: Schema, description: string): Schema => ({
+		description,
+		content: { "application/json": { schema } },
+	});
+	const form = (properties: Record<string, Schema>, required: string[]): Schema => ({
+		content: {
+			"application/x-www-form-urlencoded": {
+				schema: { type: "object", required, properties },
+			},
+		},
+	});
+	const discovery = {
+		get: {
+			summary: "Discovery document",
+			tags: ["oidc"],
+			parameters: [session, sessionQuery],
+			responses: { "200": json(ref("DiscoveryDocument"), "Provider metadata") },
+		},
+	};
+	const jwks = {
+		get: {
+			summary: "Public signing keys",
+			tags: ["oidc"],
+			parameters: [session, sessionQuery],
+			responses: {
+				"200": json(ref("Jwks"), "The JWKS"),
+				"401": errorResponse("Bearer token missing, with `jwksBearerToken` configured"),
+			},
+		},
+	};
+
+	return {
+		"/token": {
+			post: {
+				summary: "Token endpoint; session mischief applies to the tokens issued",
+				tags: ["oidc"],
+				parameters: [session],
+				security: [{ clientSecretBasic: [] }, {}],
+				requestBody: form(
+					{
+						grant_type: { type: "string" },
+						code: { type: "string" },
+						redirect_uri: { type: "string" },
+						code_verifier: { type: "string" },
+						refresh_token: { type: "string" },
+						scope: { type: "string" },
+						resource: stringArray,
+						client_id: { type: "string" },
+						client_secret: { type: "string" },
+						client_assertion_type: { type: "string" },
+						client_assertion: { type: "string" },
+					},
+					["grant_type"],
+				),
+				responses: {
+					"200": json(ref("TokenResponse"), "Tokens"),
+					"400": errorResponse("OAuth error"),
+					"401": errorResponse("Client authentication failed"),
+				},
+			},
+		},
+		"/introspect": {
+			post: {
+				summary: "RFC 7662 introspection, answered from what Loki actually issued",
+				tags: ["oidc"],
+				parameters: [session],
+				security: [{ clientSecretBasic: [] }],
+				requestBody: form({ token: { type: "string" }, token_type_hint: { type: "string" } }, [
+					"token",
+				]),
+				responses: {
+					"200": json(ref("IntrospectionResponse"), "Token state"),
+					"401": errorResponse("Client authentication failed"),
+				},
+			},
+		},
+		"/revoke": {
+			post: {
+				summary: "RFC 7009 revocation; succeeds for any token, known or not",
+				tags: ["oidc"],
+				parameters: [session],
+				security: [{ clientSecretBasic: [] }],
+				requestBody: form({ token: { type: "string" }, token_type_hint: { type: "string" } }, [
+					"token",
+				]),
+				responses: {
+					"200": { description: "Token revoked (or unknown)" },
+					"400": errorResponse("Token missing"),
+					"401": errorResponse("Client authentication failed"),
+				},
+			},
+		},
+		"/userinfo": {
+			get: {
+				summary: "Claims the access token's scopes release; a session's token brings its session",
+				tags: ["oidc"],
+				parameters: [session],
+				security: [{ accessToken: [] }],
+				responses: {
+					"200": json({ type: "object", required: ["sub"] }, "Userinfo claims"),
+					"401": errorResponse("Access token missing, invalid or expired"),
+				},
+			},
+		},
+		"/.well-known/openid-configuration": discovery,
+		"/.well-known/oauth-authorization-server": discovery,
+		"/jwks": jwks,
+		"/.well-known/jwks.json": jwks,
+	};
+}
+
+function errorResponse(description: string): Schema {
+	return { description, content: { "application/json": { schema: ref("Error") } } };
+}
@@ -2,16 +2,108 @@
  * Admin API routes using Hono
  *
  * Provides REST endpoints for:
- * - Session management (CRUD)
- * - Plugin discovery
- * - Ledger retrieval
+ * - Session management (CRUD), and cloning a session with overrides
+ * - Fuzz matrices: sessions with random mischief combinations
+ * - Plugin discovery, and a mischief catalog with options and example sessions
+ * - Ledger, event and refresh-rotation retrieval, and live token activity over SSE
+ * - Request lookup by correlation ID
+ * - Client-reported token verdicts and per-mischief results
+ * - Per-session attack reports: what mischief did to each issued token
+ * - Per-session HTTP exchanges, exported as HAR
+ * - Signing key rollover plans and key sets
+ * - Registered signing keys that sessions sign with by keyId
+ * - Client registration, with default mischief and private_key_jwt keys
+ * - Tenants served under their own issuer paths
+ * - Global error-rate faults
+ * - Revocation list reports
+ * - Declarative topology plan and apply
+ * - Discovery consistency probes
+ * - Rogue JWKS and certificate chains served to clients following jku and x5u headers
+ * - Test-only signing key export
  * - Health monitoring
+ * - The error code list
+ * - An OpenAPI document describing all of the above and the OIDC endpoints
+ *
+ * With an admin token configured, every route requires it as a Bearer token,
+ * except the rogue JWKS and chains: they stand in for an attacker's key
+ * server and only ever hold public keys.
  */
 
-import { Hono } from "hono";
-import type { Session, SessionConfig } from "../core/types.js";
-import type { MischiefLedger } from "../ledger/types.js";
+import { type Context, Hono, type Next } from "hono";
+import { stream, streamSSE } from "hono/streaming";
+import type { AttackRotationStatus } from "../core/attack-rotation.js";
+import type { ChaosStatus } from "../core/chaos-mode.js";
+import {
+	type ClientRegistration,
+	type ClientStatus,
+	parseClientRegistration,
+} from "../core/client-registry.js";
+import {
+	type ConsistencyProbeOptions,
+	probeDiscoveryConsistency,
+} from "../core/discovery-consistency.js";
+import { ERROR_CODES, lokiError } from "../core/errors.js";
+import type { SessionEvent } from "../core/event-log.js";
+import type { FaultStatus } from "../core/fault-injector.js";
+import { fuzzCombinations, parseFuzzRequest, summarizeFuzz } from "../core/fuzz.js";
+import type { Har } from "../core/har-recorder.js";
+import type { SessionReport } from "../core/issuance-log.js";
+import type {
+	ExportedSigningKey,
+	KeyRegistration,
+	KeySetConfig,
+	KeySetStatus,
+	RegisteredKeyStatus,
+	RolloverPlanConfig,
+	RolloverStatus,
+} from "../core/key-manager.js";
+import type { LiveSubscription } from "../core/live-events.js";
+import { mischiefCatalog } from "../core/mischief-catalog.js";
+import type { RefreshLedgerReport } from "../core/refresh-ledger.js";
+import type { RequestTrace } from "../core/request-id.js";
+import type { RevocationReport } from "../core/revocation-list.js";
+import {
+	type SessionSpecResult,
+	isPlainObject,
+	mergeSpecPatch,
+	parseSessionSpec,
+	sessionSpec,
+} from "../core/session-spec.js";
+import type { SessionStats } from "../core/session-stats.js";
+import { presentsToken } from "../core/shared-secret.js";
+import type { TenantStatus } from "../core/tenants.js";
+import type { SessionResults } from "../core/token-results.js";
+import type { TopologyPlanResult } from "../core/topology.js";
+import type {
+	FaultConfig,
+	Session,
+	SessionConfig,
+	SessionFreeze,
+	SessionsConfig,
+	TopologyDocument,
+} from "../core/types.js";
+import type { MischiefLedger, OutcomeReport } from "../ledger/types.js";
 import type { PluginRegistry } from "../plugins/registry.js";
+import { openApiDocument } from "./openapi.js";
+
+/** Upper bound on sessions created by one batch request */
+const MAX_BATCH_SESSIONS = 100;
+
+/** How long a live event stream stays silent before a keep-alive comment */
+const SSE_KEEPALIVE_MS = 15_000;
+
+/**
+ * The parts of a session handle the admin API reads
+ */
+export interface AdminSessionView {
+	id: string;
+	mode: string;
+	isEnded: boolean;
+	seed: number | undefined;
+	warmupRemaining: number;
+	freezeState: "pending" | "frozen" | undefined;
+	getLedger: () => MischiefLedger;
+}
 
 export interface AdminDependencies {
 	getIssuer: () => string;
@@ -19,11 +111,93 @@ export interface AdminDependencies {
 	getPluginRegistry: () => PluginRegistry;
 	listSessions: () => Session[];
 	createSession: (config?: Partial<SessionConfig>) => { id: string; mode: string };
-	getSession: (
-		id: string,
-	) => { id: string; mode: string; isEnded: boolean; getLedger: () => MischiefLedger } | undefined;
+	getSession: (id: string) => AdminSessionView | undefined;
 	deleteSession: (id: string) => boolean;
 	purgeSessions: () => void;
+	getSessionEvents: (id: string, since?: number) => SessionEvent[];
+	watchSessionEvents: (id: string) => LiveSubscription;
+	getRefreshLedger: (id: string) => RefreshLedgerReport;
+	getLastTokenResponse: (id: string) => string | undefined;
+	reportTokenOutcome: (id: string, report: OutcomeReport) => boolean;
+	getSessionResults: (id: string) => SessionResults;
+	freezeSession: (id: string, options: { keepFresh?: boolean }) => SessionFreeze | undefined;
+	unfreezeSession: (id: string) => boolean;
+	startRolloverPlan: (plan: RolloverPlanConfig) => Promise<RolloverStatus>;
+	getRolloverStatus: () => RolloverStatus | undefined;
+	clearRolloverPlan: () => boolean;
+	startKeySet: (config: KeySetConfig) => Promise<KeySetStatus>;
+	getKeySetStatus: () => KeySetStatus | undefined;
+	retireKeySetKey: (kid: string, options: { replace?: boolean }) => Promise<KeySetStatus>;
+	clearKeySet: () => boolean;
+	registerSigningKey: (registration: KeyRegistration) => Promise<RegisteredKeyStatus>;
+	getSigningKeys: () => RegisteredKeyStatus[];
+	getSigningKey: (id: string) => RegisteredKeyStatus | undefined;
+	rotateSigningKey: (
+		id: string,
+		privateJwk?: KeyRegistration["privateJwk"],
+	) => Promise<RegisteredKeyStatus>;
+	removeSigningKey: (id: string) => boolean;
+	setSigningKeyVisibility: (id: string, visibleTo: string[] | undefined) => RegisteredKeyStatus;
+	getClients: () => ClientStatus[];
+	getClient: (id: string) => ClientStatus | undefined;
+	registerClient: (registration: ClientRegistration) => Promise<ClientStatus>;
+	deleteClient: (id: string) => Promise<boolean>;
+	registerClientKeys: (id: string, jwks: unknown) => Promise<ClientStatus>;
+	removeClientKeys: (id: string) => boolean;
+	getTenants: () => TenantStatus[];
+	getTenant: (id: string) => TenantStatus | undefined;
+	/** Register a tenant; returns an error message if it can't be */
+	registerTenant: (id: unknown) => Promise<TenantStatus | string>;
+	removeTenant: (id: string) => boolean;
+	getFaultStatus: () => FaultStatus;
+	configureFaults: (config: FaultConfig) => FaultStatus;
+	getRevocationReport: (sessionId?: string) => RevocationReport;
+	getSessionsConfig: () => Required<SessionsConfig>;
+	planTopology: (document: unknown) => TopologyPlanResult;
+	applyTopology: (document: unknown) => TopologyPlanResult;
+	exportTopology: () => TopologyDocument;
+	getAttackOfTheDay: () => AttackRotationStatus | undefined;
+	getChaos: () => ChaosStatus | undefined;
+	exportSigningKeys: (id: string) => Promise<ExportedSigningKey[] | undefined>;
+	getRequestTrace: (requestId: string) => RequestTrace | undefined;
+	getSessionReport: (id: string) => SessionReport | undefined;
+	getSessionStats: (id: string) => SessionStats | undefined;
+	getSessionHar: (id: string) => Har | undefined;
+	getRogueJwks: (sessionId: string) => { keys: unknown[] } | undefined;
+	getRogueX5u: (sessionId: string) => string | undefined;
+	getAdminToken: () => string | undefined;
+	/** When a session was evicted by its ttl, if it was */
+	getSessionEvictedAt: (id: string) => Date | undefined;
+}
+
+/**
+ * Stream a session's live events as server-sent events until the client
+ * goes away or the session is deleted. An opening comment sends the
+ * headers at once, and another after each quiet spell keeps proxies from
+ * closing an idle stream; a consumer that fell behind gets a `dropped`
+ * event counting the events it lost before the next one.
+ */
+function streamLiveEvents(c: Context, subscription: LiveSubscription): Response {
+	return streamSSE(c, async (out) => {
+		out.onAbort(() => subscription.close());
+		await out.write(": watching\n\n");
+		while (!out.aborted) {
+			const event = await subscription.next(SSE_KEEPALIVE_MS);
+			if (event === undefined) {
+				break;
+			}
+			const dropped = subscription.takeDropped();
+			if (dropped > 0) {
+				await out.writeSSE({ event: "dropped", data: JSON.stringify({ count: dropped }) });
+			}
+			if (event === null) {
+				await out.write(": keep-alive\n\n");
+				continue;
+			}
+			await out.writeSSE({ event: event.type, id: String(event.seq), data: JSON.stringify(event) });
+		}
+		subscription.close();
+	});
 }
 
 /**
@@ -31,6 +205,40 @@ export interface AdminDependencies {
  */
 export function createAdminApi(deps: AdminDependencies): Hono {
 	const app = new Hono();
+	const isSigningKey = (keyId: string) => deps.getSigningKey(keyId) !== undefined;
+
+	// Plugins a spec names that aren't loaded: a typo would otherwise leave
+	// the session serving clean tokens, and a client look like it defended
+	const unknownMischief = (config: Partial<SessionConfig>): string[] => {
+		const registry = deps.getPluginRegistry();
+		const named = [...(config.mischief ?? []), ...Object.keys(config.probabilities ?? {})];
+		return [...new Set(named)].filter((id) => !registry.has(id));
+	};
+
+	app.use("*", async (c, next) => {
+		const token = deps.getAdminToken();
+		const open = c.req.path.startsWith("/rogue-jwks/") || c.req.path.startsWith("/rogue-x5u/");
+		const authorization = c.req.header("Authorization");
+		if (token !== undefined && !open && !presentsToken(authorization, token, { basic: true })) {
+			c.header("WWW-Authenticate", 'Bearer realm="loki-admin", Basic realm="loki-admin"');
+			return c.json(lokiError("admin_token_required", "Admin token required"), 401);
+		}
+		await next();
+	});
+
+	// Sessions evicted by their ttl are gone rather than unknown
+	const evicted = async (c: Context, next: Next) => {
+		const id = c.req.param("id") ?? "";
+		const evictedAt = deps.getSessionEvictedAt(id);
+		if (evictedAt) {
+			const message = "Session outlived its ttl and was evicted";
+			const details = { sessionId: id, evictedAt: evictedAt.toISOString() };
+			return c.json(lokiError("session_expired", message, details), 410);
+		}
+		await next();
+	};
+	app.use("/sessions/:id", evicted);
+	app.use("/sessions/:id/*", evicted);
 
 	// Health check
 	app.get("/health", (c) => {
@@ -41,6 +249,17 @@ export function createAdminApi(deps: AdminDependencies): Hono {
 		});
 	});
 
+	// Every error code the API and OIDC endpoints reject with, and what it means
+	app.get("/errors", (c) => {
+		return c.json({ codes: ERROR_CODES });
+	});
+
+	// OpenAPI document for the admin API and OIDC endpoints, from the routes registered here
+	app.get("/openapi.json", (c) => {
+		const adminRoutes = app.routes.filter((route) => route.method !== "ALL");
+		return c.json(openApiDocument({ issuer: deps.getIssuer(), adminRoutes }));
+	});
+
 	// ===== Sessions API =====
 
 	// List all sessions
@@ -58,35 +277,145 @@ export function createAdminApi(deps: AdminDependencies): Hono {
 
 	// Create a new session
 	app.post("/sessions", async (c) => {
-		const body: Partial<SessionConfig> = await c.req
-			.json<Partial<SessionConfig>>()
-			.catch(() => ({}));
-		const sessionConfig: Partial<SessionConfig> = {
-			mode: body.mode ?? "explicit",
-			mischief: body.mischief ?? [],
-		};
-		if (body.name !== undefined) {
-			sessionConfig.name = body.name;
-		}
-		if (body.probability !== undefined) {
-			sessionConfig.probability = body.probability;
-		}
-		const session = deps.createSession(sessionConfig);
+		const body = await c.req.json<unknown>().catch(() => ({}));
+		const spec = parseSessionSpec(body, deps.getSessionsConfig(), isSigningKey);
+		if (!spec.ok) {
+			return c.json(lokiError("invalid_session_spec", spec.error), 400);
+		}
+		const unknown = unknownMischief(spec.config);
+		if (unknown.length > 0) {
+			const details = { pluginIds: unknown };
+			return c.json(lokiError("unknown_mischief", unknownMischiefMessage(unknown), details), 400);
+		}
+		const session = deps.createSession(spec.config);
 		return c.json({ sessionId: session.id }, 201);
 	});
 
+	// Create several sessions in one request
+	//
+	// Accepts an array of session specs, or {sessions, atomic}. Atomic batches
+	// (the default) create nothing if any spec is invalid; non-atomic batches
+	// create the valid specs and report errors for the rest, in order.
+	app.post("/sessions/batch", async (c) => {
+		const body = await c.req.json<unknown>().catch(() => undefined);
+		const specs = Array.isArray(body) ? body : isPlainObject(body) ? body.sessions : undefined;
+		const atomic = isPlainObject(body) && body.atomic === false ? false : true;
+		const namePrefix = isPlainObject(body) ? body.namePrefix : undefined;
+		if (!Array.isArray(specs)) {
+			const message = "Body must be an array of session specs or {sessions: [...]}";
+			return c.json(lokiError("invalid_batch", message), 400);
+		}
+		if (namePrefix !== undefined && typeof namePrefix !== "string") {
+			const message = "namePrefix must be a string";
+			return c.json(lokiError("invalid_parameter", message, { parameter: "namePrefix" }), 400);
+		}
+		if (specs.length > MAX_BATCH_SESSIONS) {
+			const message = `A batch can create at most ${MAX_BATCH_SESSIONS} sessions`;
+			const details = { limit: MAX_BATCH_SESSIONS, received: specs.length };
+			return c.json(lokiError("oversized_request", message, details), 400);
+		}
+
+		const sessionsConfig = deps.getSessionsConfig();
+		const parsed = specs.map((spec: unknown, index): SessionSpecResult => {
+			const named = namePrefix === undefined ? spec : withNamePrefix(spec, namePrefix, index);
+			const parsed = parseSessionSpec(named, sessionsConfig, isSigningKey);
+			const unknown = parsed.ok ? unknownMischief(parsed.config) : [];
+			return unknown.length > 0 ? { ok: false, error: unknownMischiefMessage(unknown) } : parsed;
+		});
+		const errors = parsed.flatMap((spec, index) => (spec.ok ? [] : [{ index, error: spec.error }]));
+
+		if (atomic) {
+			if (errors.length > 0) {
+				const message = "Invalid session specs; no sessions created";
+				return c.json(lokiError("invalid_session_spec", message, { errors }), 400);
+			}
+			const configs = parsed.flatMap((spec) => (spec.ok ? [spec.config] : []));
+			const sessionIds = configs.map((config) => deps.createSession(config).id);
+			return c.json({ sessionIds }, 201);
+		}
+
+		const results = parsed.map((spec) =>
+			spec.ok ? { sessionId: deps.createSession(spec.config).id } : { error: spec.error },
+		);
+		return c.json({ results, created: parsed.length - errors.length, errors }, 201);
+	});
+
+	// Create sessions with random mischief combinations, for a broad test matrix
+	//
+	// The response reports the seed the combinations were drawn with; sending
+	// it back draws the same combinations again.
+	app.post("/fuzz", async (c) => {
+		const body = await c.req.json<unknown>().catch(() => null);
+		if (!isPlainObject(body)) {
+			return c.json(lokiError("invalid_json", "Invalid JSON body"), 400);
+		}
+		const catalog = deps
+			.getPluginRegistry()
+			.getAll()
+			.map((p) => p.id);
+		const parsed = parseFuzzRequest(body, catalog, MAX_BATCH_SESSIONS);
+		if (!parsed.ok) {
+			const { error, parameter, pluginIds } = parsed;
+			if (pluginIds !== undefined) {
+				return c.json(lokiError("unknown_mischief", error, { parameter, pluginIds }), 400);
+			}
+			return c.json(lokiError("invalid_parameter", error, { parameter }), 400);
+		}
+
+		const combinations = fuzzCombinations(parsed.request);
+		const sessions = combinations.map((mischief) => ({
+			sessionId: deps.createSession({ mode: "explicit", mischief }).id,
+			mischief,
+		}));
+		const { seed } = parsed.request;
+		return c.json({ seed, sessions, summary: summarizeFuzz(combinations) }, 201);
+	});
+
+	// Create a session from another's spec
+	//
+	// The body is an override patch deep-merged into the source session's
+	// spec (null removes a setting). The clone starts afresh: new id, empty
+	// ledger, events and report.
+	app.post("/sessions/:id/clone", async (c) => {
+		const id = c.req.param("id");
+		const source = deps.listSessions().find((session) => session.id === id);
+		if (!source) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		const patch = await c.req.json<unknown>().catch(() => ({}));
+		if (!isPlainObject(patch)) {
+			const message = "override patch must be an object";
+			return c.json(lokiError("invalid_session_spec", message), 400);
+		}
+		const merged = mergeSpecPatch(sessionSpec(source), patch);
+		const spec = parseSessionSpec(merged, deps.getSessionsConfig(), isSigningKey);
+		if (!spec.ok) {
+			return c.json(lokiError("invalid_session_spec", spec.error), 400);
+		}
+		const unknown = unknownMischief(spec.config);
+		if (unknown.length > 0) {
+			const details = { pluginIds: unknown };
+			return c.json(lokiError("unknown_mischief", unknownMischiefMessage(unknown), details), 400);
+		}
+		const session = deps.createSession(spec.config);
+		return c.json({ sessionId: session.id, clonedFrom: id }, 201);
+	});
+
 	// Get session details
 	app.get("/sessions/:id", (c) => {
 		const id = c.req.param("id");
 		const session = deps.getSession(id);
 		if (!session) {
-			return c.json({ error: "Session not found" }, 404);
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
 		}
 		const ledger = session.getLedger();
 		return c.json({
 			id: session.id,
 			mode: session.mode,
 			isEnded: session.isEnded,
+			...(session.seed === undefined ? {} : { seed: session.seed }),
+			warmupRemaining: session.warmupRemaining,
+			freezeState: session.freezeState ?? null,
 			ledger: ledger.meta,
 			summary: ledger.summary,
 		});
@@ -97,17 +426,197 @@ export function createAdminApi(deps: AdminDependencies): Hono {
 		const id = c.req.param("id");
 		const session = deps.getSession(id);
 		if (!session) {
-			return c.json({ error: "Session not found" }, 404);
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
 		}
 		return c.json(session.getLedger());
 	});
 
+	// Get session event timeline, as JSON or streamed as NDJSON (?format=ndjson),
+	// optionally resuming after the event whose seq is ?since=; or watch the
+	// session's token activity live as server-sent events (?format=sse, or
+	// Accept: text/event-stream)
+	app.get("/sessions/:id/events", (c) => {
+		const id = c.req.param("id");
+		const session = deps.getSession(id);
+		if (!session) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		const live = c.req.header("Accept")?.includes("text/event-stream") === true;
+		const format = c.req.query("format") ?? (live ? "sse" : "json");
+		if (format !== "json" && format !== "ndjson" && format !== "sse") {
+			const message = "format must be json, ndjson or sse";
+			return c.json(lokiError("invalid_parameter", message, { parameter: "format" }), 400);
+		}
+		if (format === "sse") {
+			return streamLiveEvents(c, deps.watchSessionEvents(id));
+		}
+		const sinceParam = c.req.query("since");
+		const since = sinceParam === undefined ? undefined : Number(sinceParam);
+		if (since !== undefined && !(Number.isInteger(since) && since >= 0)) {
+			const message = "since must be a non-negative integer";
+			return c.json(lokiError("invalid_parameter", message, { parameter: "since" }), 400);
+		}
+
+		const events = deps.getSessionEvents(id, since);
+		if (format === "json") {
+			return c.json({ events });
+		}
+		// One line per event; each write waits for the client to keep up
+		c.header("Content-Type", "application/x-ndjson");
+		return stream(c, async (out) => {
+			for (const event of events) {
+				if (out.aborted) {
+					break;
+				}
+				await out.write(`${JSON.stringify(event)}\n`);
+			}
+		});
+	});
+
+	// Get session refresh token rotations and detected reuses
+	app.get("/sessions/:id/refresh-ledger", (c) => {
+		const id = c.req.param("id");
+		const session = deps.getSession(id);
+		if (!session) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		return c.json(deps.getRefreshLedger(id));
+	});
+
+	// Replay the session's last token response byte for byte, without running mischief again
+	app.get("/sessions/:id/replay", (c) => {
+		const id = c.req.param("id");
+		if (!deps.getSession(id)) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		const body = deps.getLastTokenResponse(id);
+		if (body === undefined) {
+			const message = "The session hasn't issued a token yet";
+			return c.json(lokiError("no_token_issued", message, { sessionId: id }), 404);
+		}
+		c.header("Content-Type", "application/json");
+		c.header("Cache-Control", "no-store");
+		return c.body(body);
+	});
+
+	// Export the private keys signing the session's tokens (test-only)
+	//
+	// Lets a test reproduce an attack client-side with the exact key bytes,
+	// e.g. HS256-signing with the RSA public key. Refused unless Loki was
+	// started with an admin token, since it hands out private key material.
+	app.get("/sessions/:id/keys", async (c) => {
+		if (deps.getAdminToken() === undefined) {
+			const message = "Signing key export requires an admin token (--admin-token)";
+			return c.json(lokiError("key_export_forbidden", message), 403);
+		}
+		const id = c.req.param("id");
+		const keys = await deps.exportSigningKeys(id);
+		if (!keys) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		return c.json({
+			sessionId: id,
+			warning: "Test-only: these are Loki's private signing keys. Never use them outside tests.",
+			keys,
+		});
+	});
+
+	// Report whether the client under test accepted a token, by jti
+	app.post("/sessions/:id/results", async (c) => {
+		const id = c.req.param("id");
+		if (!deps.getSession(id)) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		const body = await c.req.json<unknown>().catch(() => undefined);
+		const report = parseOutcomeReport(body);
+		if (typeof report === "string") {
+			return c.json(lokiError("invalid_parameter", report), 400);
+		}
+		if (!deps.reportTokenOutcome(id, report)) {
+			const message = `No token with jti '${report.jti}' was issued in this session`;
+			return c.json(lokiError("unknown_token", message, { jti: report.jti }), 404);
+		}
+		return c.json({ recorded: true });
+	});
+
+	// Get per-mischief pass rates and the overall verdict
+	app.get("/sessions/:id/results", (c) => {
+		const id = c.req.param("id");
+		if (!deps.getSession(id)) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		return c.json(deps.getSessionResults(id));
+	});
+
+	// Get what mischief did to each token the session issued: mutations,
+	// header and claim changes, the decoded header and the signing key
+	app.get("/sessions/:id/report", (c) => {
+		const id = c.req.param("id");
+		const report = deps.getSessionReport(id);
+		if (!report) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		return c.json(report);
+	});
+
+	// Get a session's issuance counters: tokens issued, per mischief, first and last
+	app.get("/sessions/:id/stats", (c) => {
+		const id = c.req.param("id");
+		const stats = deps.getSessionStats(id);
+		if (!stats) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		return c.json(stats);
+	});
+
+	// Get a session's recorded HTTP exchanges as a HAR 1.2 file
+	app.get("/sessions/:id/har", (c) => {
+		const id = c.req.param("id");
+		const har = deps.getSessionHar(id);
+		if (!har) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		c.header("Content-Disposition", `attachment; filename="${id}.har"`);
+		c.header("Cache-Control", "no-store");
+		return c.json(har);
+	});
+
+	// Freeze a session on its next token response
+	app.post("/sessions/:id/freeze", async (c) => {
+		const id = c.req.param("id");
+		const body = await c.req.json<unknown>().catch(() => ({}));
+		const keepFresh = isPlainObject(body) ? body.keepFresh : undefined;
+		if (keepFresh !== undefined && typeof keepFresh !== "boolean") {
+			const message = "keepFresh must be a boolean";
+			return c.json(lokiError("invalid_parameter", message, { parameter: "keepFresh" }), 400);
+		}
+		const freeze = deps.freezeSession(id, keepFresh === undefined ? {} : { keepFresh });
+		if (!freeze) {
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
+		}
+		return c.json({
+			state: "pending",
+			keepFresh: freeze.keepFresh,
+			requestedAt: freeze.requestedAt,
+		});
+	});
+
+	// Unfreeze a session
+	app.delete("/sessions/:id/freeze", (c) => {
+		const id = c.req.param("id");
+		if (!deps.unfreezeSession(id)) {
+			const message = "Session not found or not frozen";
+			return c.json(lokiError("session_not_frozen", message, { sessionId: id }), 404);
+		}
+		return c.json({ unfrozen: true });
+	});
+
 	// Delete a session
 	app.delete("/sessions/:id", (c) => {
 		const id = c.req.param("id");
 		const deleted = deps.deleteSession(id);
 		if (!deleted) {
-			return c.json({ error: "Session not found" }, 404);
+			return c.json(lokiError("session_not_found", "Session not found", { sessionId: id }), 404);
 		}
 		return c.json({ deleted: true });
 	});
@@ -135,12 +644,18 @@ export function createAdminApi(deps: AdminDependencies): Hono {
 		return c.json({ plugins });
 	});
 
+	// Catalog the mischief a session spec accepts: what each one affects,
+	// its options and defaults, its spec reference and an example session
+	app.get("/mischief", (c) => {
+		return c.json({ mischief: mischiefCatalog(deps.getPluginRegistry().getAll()) });
+	});
+
 	// Get plugin details
 	app.get("/plugins/:id", (c) => {
 		const id = c.req.param("id");
 		const plugin = deps.getPluginRegistry().get(id);
 		if (!plugin) {
-			return c.json({ error: "Plugin not found" }, 404);
+			return c.json(lokiError("unknown_mischief", "Plugin not found", { pluginId: id }), 404);
 		}
 		return c.json({
 			id: plugin.id,
@@ -182,6 +697,410 @@ export function createAdminApi(deps: AdminDependencies): Hono {
 		return c.json({ plugins });
 	});
 
+	// ===== JWKS API =====
+
+	// Start a signing key rollover plan (replaces any existing plan)
+	app.post("/jwks/rollover-plan", async (c) => {
+		const body = await c.req.json<RolloverPlanConfig>().catch(() => null);
+		if (!body) {
+			return c.json(lokiError("invalid_json", "Invalid JSON body"), 400);
+		}
+		try {
+			const status = await deps.startRolloverPlan(body);
+			return c.json(status, 201);
+		} catch (err) {
+			return c.json(lokiError("invalid_rollover_plan", errorMessage(err)), 400);
+		}
+	});
+
+	// Get rollover plan status, including the active algorithm history
+	app.get("/jwks/rollover-plan", (c) => {
+		const status = deps.getRolloverStatus();
+		if (!status) {
+			return c.json(lokiError("rollover_plan_not_found", "No rollover plan configured"), 404);
+		}
+		return c.json(status);
+	});
+
+	// Stop the rollover plan and revert to the primary key
+	app.delete("/jwks/rollover-plan", (c) => {
+		const cleared = deps.clearRolloverPlan();
+		if (!cleared) {
+			return c.json(lokiError("rollover_plan_not_found", "No rollover plan configured"), 404);
+		}
+		return c.json({ cleared: true });
+	});
+
+	// Start a key set: several concurrently valid keys signing tokens in turn
+	app.post("/jwks/key-set", async (c) => {
+		const body = await c.req.json<KeySetConfig>().catch(() => null);
+		if (!body) {
+			return c.json(lokiError("invalid_json", "Invalid JSON body"), 400);
+		}
+		try {
+			const status = await deps.startKeySet(body);
+			return c.json(status, 201);
+		} catch (err) {
+			return c.json(lokiError("invalid_key_set", errorMessage(err)), 400);
+		}
+	});
+
+	// Get key set status, including which key signed each token
+	app.get("/jwks/key-set", (c) => {
+		const status = deps.getKeySetStatus();
+		if (!status) {
+			return c.json(lokiError("key_set_not_found", "No key set configured"), 404);
+		}
+		return c.json(status);
+	});
+
+	// Retire a key from the set (?replace=true rotates a fresh key in)
+	app.delete("/jwks/key-set/keys/:kid", async (c) => {
+		if (!deps.getKeySetStatus()) {
+			return c.json(lokiError("key_set_not_found", "No key set configured"), 404);
+		}
+		const replace = c.req.query("replace") === "true";
+		try {
+			return c.json(await deps.retireKeySetKey(c.req.param("kid"), { replace }));
+		} catch (err) {
+			return c.json(lokiError("invalid_key_set", errorMessage(err)), 400);
+		}
+	});
+
+	// Stop the key set and revert to the primary key
+	app.delete("/jwks/key-set", (c) => {
+		const cleared = deps.clearKeySet();
+		if (!cleared) {
+			return c.json(lokiError("key_set_not_found", "No key set configured"), 404);
+		}
+		return c.json({ cleared: true });
+	});
+
+	// ===== Signing Keys API =====
+
+	// Register a signing key, generated or imported from a private JWK
+	app.post("/keys", async (c) => {
+		const body = await c.req.json<KeyRegistration>().catch(() => null);
+		if (!body) {
+			return c.json(lokiError("invalid_json", "Invalid JSON body"), 400);
+		}
+		try {
+			return c.json(await deps.registerSigningKey(body), 201);
+		} catch (err) {
+			return c.json(lokiError("invalid_signing_key", errorMessage(err)), 400);
+		}
+	});
+
+	// List registered signing keys
+	app.get("/keys", (c) => {
+		return c.json({ keys: deps.getSigningKeys() });
+	});
+
+	// Get one registered signing key
+	app.get("/keys/:id", (c) => {
+		const key = deps.getSigningKey(c.req.param("id"));
+		if (!key) {
+			return c.json(lokiError("signing_key_not_found", "No signing key has that id"), 404);
+		}
+		return c.json(key);
+	});
+
+	// Rotate a registered key: new material and kid under the same id
+	app.post("/keys/:id/rotate", async (c) => {
+		const id = c.req.param("id");
+		if (!deps.getSigningKey(id)) {
+			return c.json(lokiError("signing_key_not_found", "No signing key has that id"), 404);
+		}
+		const body = await c.req.json<unknown>().catch(() => ({}));
+		const privateJwk = isPlainObject(body) ? body.privateJwk : undefined;
+		if (privateJwk !== undefined && !isPlainObject(privateJwk)) {
+			return c.json(lokiError("invalid_signing_key", "privateJwk must be a JWK object"), 400);
+		}
+		try {
+			return c.json(await deps.rotateSigningKey(id, privateJwk as KeyRegistration["privateJwk"]));
+		} catch (err) {
+			return c.json(lokiError("invalid_signing_key", errorMessage(err)), 400);
+		}
+	});
+
+	// Publish a registered key to some clients' JWKS fetches only (visibleTo
+	// null publishes it to every fetch again)
+	app.put("/keys/:id/visibility", async (c) => {
+		const id = c.req.param("id");
+		if (!deps.getSigningKey(id)) {
+			return c.json(lokiError("signing_key_not_found", "No signing key has that id"), 404);
+		}
+		const body = await c.req.json<unknown>().catch(() => null);
+		if (!isPlainObject(body) || !("visibleTo" in body)) {
+			return c.json(lokiError("invalid_json", "Body must be an object with visibleTo"), 400);
+		}
+		const visibleTo = body.visibleTo === null ? undefined : (body.visibleTo as string[]);
+		try {
+			return c.json(deps.setSigningKeyVisibility(id, visibleTo));
+		} catch (err) {
+			return c.json(lokiError("invalid_signing_key", errorMessage(err)), 400);
+		}
+	});
+
+	// Remove a registered key; sessions naming it fall back to the active key
+	app.delete("/keys/:id", (c) => {
+		if (!deps.removeSigningKey(c.req.param("id"))) {
+			return c.json(lokiError("signing_key_not_found", "No signing key has that id"), 404);
+		}
+		return c.json({ removed: true });
+	});
+
+	// ===== Clients API =====
+
+	// List configured and registered clients, with their private_key_jwt keys
+	app.get("/clients", (c) => {
+		return c.json({ clients: deps.getClients() });
+	});
+
+	// Register a client (or replace one registered earlier). A configured
+	// client can only be given keys: a body of just clientId and jwks.
+	app.post("/clients", async (c) => {
+		const body = await c.req.json<unknown>().catch(() => null);
+		if (!isPlainObject(body)) {
+			return c.json(lokiError("invalid_json", "Invalid JSON body"), 400);
+		}
+		const registration = parseClientRegistration(body);
+		if (typeof registration === "string") {
+			return c.json(lokiError("invalid_client_registration", registration), 400);
+		}
+		const registry = deps.getPluginRegistry();
+		const unknown = (registration.mischief ?? []).filter((id) => !registry.get(id));
+		if (unknown.length > 0) {
+			const details = { pluginIds: unknown };
+			return c.json(lokiError("unknown_mischief", "Unknown mischief plugins", details), 400);
+		}
+
+		const { clientId } = registration;
+		if (deps.getClient(clientId)?.source === "config") {
+			const keysOnly = Object.keys(body).every((key) => key === "clientId" || key === "jwks");
+			if (!keysOnly || body.jwks === undefined) {
+				const message = `Client '${clientId}' is configured; only its jwks can be registered`;
+				return c.json(lokiError("invalid_client_registration", message), 400);
+			}
+			try {
+				return c.json(await deps.registerClientKeys(clientId, body.jwks), 201);
+			} catch (err) {
+				return c.json(lokiError("invalid_client_keys", errorMessage(err)), 400);
+			}
+		}
+		try {
+			return c.json(await deps.registerClient(registration), 201);
+		} catch (err) {
+			return c.json(lokiError("invalid_client_registration", errorMessage(err)), 400);
+		}
+	});
+
+	// Get one client and its registered keys
+	app.get("/clients/:id", (c) => {
+		const client = deps.getClient(c.req.param("id"));
+		if (!client) {
+			return c.json(lokiError("client_not_found", "No client has that client_id"), 404);
+		}
+		return c.json(client);
+	});
+
+	// Delete a registered client and its default mischief session
+	app.delete("/clients/:id", async (c) => {
+		const client = deps.getClient(c.req.param("id"));
+		if (!client) {
+			return c.json(lokiError("client_not_found", "No client has that client_id"), 404);
+		}
+		if (client.source === "config") {
+			const message = "Configured clients can't be deleted";
+			return c.json(lokiError("client_not_deletable", message, { clientId: client.clientId }), 400);
+		}
+		return c.json({ deleted: await deps.deleteClient(client.clientId) });
+	});
+
+	// Drop a client's registered keys; its assertions are refused again
+	app.delete("/clients/:id/keys", (c) => {
+		if (!deps.removeClientKeys(c.req.param("id"))) {
+			return c.json(lokiError("client_not_found", "No keys are registered for that client"), 404);
+		}
+		return c.json({ removed: true });
+	});
+
+	// ===== Tenants API =====
+
+	// List tenants and their issuers
+	app.get("/tenants", (c) => {
+		return c.json({ tenants: deps.getTenants() });
+	});
+
+	// Register a tenant, served under /{id} with its own issuer
+	app.post("/tenants", async (c) => {
+		const body = await c.req.json<unknown>().catch(() => null);
+		if (!isPlainObject(body)) {
+			return c.json(lokiError("invalid_json", "Invalid JSON body"), 400);
+		}
+		const tenant = await deps.registerTenant(body.id);
+		if (typeof tenant === "string") {
+			return c.json(lokiError("invalid_tenant", tenant, { id: body.id ?? null }), 400);
+		}
+		return c.json(tenant, 201);
+	});
+
+	// Get one tenant
+	app.get("/tenants/:id", (c) => {
+		const tenant = deps.getTenant(c.req.param("id"));
+		if (!tenant) {
+			return c.json(lokiError("tenant_not_found", "No tenant has that id"), 404);
+		}
+		return c.json(tenant);
+	});
+
+	// Remove a tenant; its paths 404 again
+	app.delete("/tenants/:id", (c) => {
+		if (!deps.removeTenant(c.req.param("id"))) {
+			return c.json(lokiError("tenant_not_found", "No tenant has that id"), 404);
+		}
+		return c.json({ deleted: true });
+	});
+
+	// ===== Faults API =====
+
+	// Get error-rate fault configuration and injected counts
+	app.get("/faults", (c) => {
+		return c.json(deps.getFaultStatus());
+	});
+
+	// Replace error-rate fault configuration
+	app.put("/faults", async (c) => {
+		const body = await c.req.json<FaultConfig>().catch(() => null);
+		if (!body) {
+			return c.json(lokiError("invalid_json", "Invalid JSON body"), 400);
+		}
+		try {
+			return c.json(deps.configureFaults(body));
+		} catch (err) {
+			return c.json(lokiError("invalid_fault_config", errorMessage(err)), 400);
+		}
+	});
+
+	// ===== Revocations API =====
+
+	// Revoked jtis split into listed vs omitted from the published list
+	app.get("/revocations", (c) => {
+		const sessionId = c.req.query("session");
+		return c.json(deps.getRevocationReport(sessionId));
+	});
+
+	// ===== Topology API =====
+
+	// Declared sessions as a topology document, stamped with plugin config versions
+	app.get("/topology", (c) => {
+		return c.json(deps.exportTopology());
+	});
+
+	// Dry run: what applying a topology document would create, update and delete
+	app.post("/plan", async (c) => {
+		const body = await c.req.json<unknown>().catch(() => undefined);
+		if (body === undefined) {
+			return c.json(lokiError("invalid_json", "Invalid JSON body"), 400);
+		}
+		const result = deps.planTopology(body);
+		if (!result.ok) {
+			const details = { errors: result.errors };
+			return c.json(lokiError("invalid_topology", "Invalid topology", details), 400);
+		}
+		return c.json(result.plan);
+	});
+
+	// Reconcile declared sessions to a topology document (all or nothing)
+	app.post("/apply", async (c) => {
+		const body = await c.req.json<unknown>().catch(() => undefined);
+		if (body === undefined) {
+			return c.json(lokiError("invalid_json", "Invalid JSON body"), 400);
+		}
+		const result = deps.applyTopology(body);
+		if (!result.ok) {
+			const message = "Invalid topology; nothing applied";
+			return c.json(lokiError("invalid_topology", message, { errors: result.errors }), 400);
+		}
+		return c.json(result.plan);
+	});
+
+	// ===== Requests API =====
+
+	// Everything one request produced, by the X-Request-ID Loki echoed
+	app.get("/requests/:requestId", (c) => {
+		const requestId = c.req.param("requestId");
+		const trace = deps.getRequestTrace(requestId);
+		if (!trace) {
+			const message = "No mischief, events or tokens recorded for that request";
+			return c.json(lokiError("request_not_found", message, { requestId }), 404);
+		}
+		return c.json(trace);
+	});
+
+	// ===== Attack of the Day =====
+
+	// The attack currently active in the rotating session, and rotation history
+	app.get("/attack-of-the-day", (c) => {
+		const status = deps.getAttackOfTheDay();
+		if (!status) {
+			const message = "Attack of the day is not enabled";
+			return c.json(lokiError("attack_of_the_day_disabled", message), 404);
+		}
+		return c.json(status);
+	});
+
+	// ===== Chaos Mode =====
+
+	// The chaos rate, the plugins it draws from and what it has drawn
+	app.get("/chaos", (c) => {
+		const status = deps.getChaos();
+		if (!status) {
+			const message = "Chaos mode is not enabled";
+			return c.json(lokiError("chaos_disabled", message), 404);
+		}
+		return c.json(status);
+	});
+
+	// ===== Probes =====
+
+	// Crawl an issuer's discovery document, JWKS and a sample token for inconsistencies
+	app.post("/probe/discovery-consistency", async (c) => {
+		const body = await c.req.json<unknown>().catch(() => undefined);
+		const options = parseProbeOptions(body);
+		if (typeof options === "string") {
+			return c.json(lokiError("invalid_parameter", options), 400);
+		}
+		return c.json(await probeDiscoveryConsistency(options));
+	});
+
+	// ===== Rogue JWKS =====
+
+	// Attacker keys a session's jku-injection tokens point at
+	app.get("/rogue-jwks/:sessionId", (c) => {
+		const sessionId = c.req.param("sessionId");
+		const jwks = deps.getRogueJwks(sessionId);
+		if (!jwks) {
+			const message = "No rogue keys were served for that session";
+			return c.json(lokiError("rogue_jwks_not_found", message, { sessionId }), 404);
+		}
+		c.header("Cache-Control", "no-store");
+		return c.json(jwks);
+	});
+
+	// Attacker certificate chain a session's x5u-injection tokens point at
+	app.get("/rogue-x5u/:sessionId", (c) => {
+		const sessionId = c.req.param("sessionId");
+		const chain = deps.getRogueX5u(sessionId);
+		if (!chain) {
+			const message = "No rogue certificate chain was served for that session";
+			return c.json(lokiError("rogue_x5u_not_found", message, { sessionId }), 404);
+		}
+		c.header("Cache-Control", "no-store");
+		c.header("Content-Type", "application/pem-certificate-chain");
+		return c.body(chain);
+	});
+
 	// ===== Admin Actions =====
 
 	// Reset everything
@@ -192,3 +1111,83 @@ export function createAdminApi(deps: AdminDependencies): Hono {
 
 	return app;
 }
+
+/**
+ * A batch spec named with the batch's prefix: before its own name, or its
+ * index in the batch if it has none. Specs that aren't objects, or whose
+ * name isn't a string, are left for validation to reject.
+ */
+function withNamePrefix(spec: unknown, prefix: string, index: number): unknown {
+	if (!isPlainObject(spec)) {
+		return spec;
+	}
+	if (spec.name === undefined) {
+		return { ...spec, name: `${prefix}${index}` };
+	}
+	return typeof spec.name === "string" ? { ...spec, name: `${prefix}${spec.name}` } : spec;
+}
+
+function unknownMischiefMessage(unknown: string[]): string {
+	const quoted = unknown.map((id) => `'${id}'`).join(", ");
+	return `Unknown mischief ${quoted}; GET /admin/mischief lists the loaded plugins`;
+}
+
+/**
+ * Validate a token verdict body; returns an error message if it's invalid
+ */
+function parseOutcomeReport(body: unknown): OutcomeReport | string {
+	if (!isPlainObject(body)) {
+		return "Body must be an object with jti and accepted";
+	}
+	const { jti, accepted, error, notes } = body;
+	if (typeof jti !== "string" || jti.length === 0) {
+		return "jti must be a non-empty string";
+	}
+	if (typeof accepted !== "boolean") {
+		return "accepted must be a boolean";
+	}
+	if (error !== undefined && typeof error !== "string") {
+		return "error must be a string";
+	}
+	if (notes !== undefined && typeof notes !== "string") {
+		return "notes must be a string";
+	}
+	const report: OutcomeReport = { jti, accepted };
+	if (error !== undefined) report.error = error;
+	if (notes !== undefined) report.notes = notes;
+	return report;
+}
+
+/**
+ * Validate a consistency probe body; returns an error message if it's invalid
+ */
+function parseProbeOptions(body: unknown): ConsistencyProbeOptions | string {
+	if (!isPlainObject(body)) {
+		return "Body must be an object with an issuer";
+	}
+	const { issuer, token, headers, timeoutMs } = body;
+	if (typeof issuer !== "string" || !URL.canParse(issuer)) {
+		return "issuer must be an absolute URL";
+	}
+	if (token !== undefined && typeof token !== "string") {
+		return "token must be a string";
+	}
+	if (
+		headers !== undefined &&
+		!(isPlainObject(headers) && Object.values(headers).every((v) => typeof v === "string"))
+	) {
+		return "headers must be an object of strings";
+	}
+	if (timeoutMs !== undefined && !(Number.isInteger(timeoutMs) && (timeoutMs as number) > 0)) {
+		return "timeoutMs must be a positive integer";
+	}
+	const options: ConsistencyProbeOptions = { issuer };
+	if (token !== undefined) options.token = token;
+	if (headers !== undefined) options.headers = headers as Record<string, string>;
+	if (timeoutMs !== undefined) options.timeoutMs = timeoutMs as number;
+	return options;
+}
+
+function errorMessage(err: unknown): string {
+	return err instanceof Error ? err.message : String(err);
+}
@@ -0,0 +1,141 @@
+/**
+ * Attack Rotation - the "attack of the day" session
+ *
+ * A built-in session whose single active plugin rotates through the
+ * catalog, so a CI job that keeps running against the same session header
+ * covers every attack over time without enumerating them. By default the
+ * attack changes once per UTC day and is chosen by day number, so every
+ * Loki with the same catalog runs the same attack on the same day; with
+ * `everyRequests` it changes after that many token requests instead.
+ */
+
+import type { AttackRotationConfig } from "./types.js";
+
+/** Default session id clients send in X-Loki-Session */
+export const ATTACK_OF_THE_DAY_SESSION = "attack-of-the-day";
+
+/** Rotations remembered for auditing */
+const MAX_HISTORY = 1000;
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+export interface AttackRotationEntry {
+	plugin: string;
+	/** Position in the rotation order */
+	index: number;
+	startedAt: string;
+}
+
+export interface AttackRotationStatus {
+	sessionId: string;
+	cadence: "daily" | "requests";
+	everyRequests?: number;
+	order: string[];
+	current: AttackRotationEntry;
+	/** When a daily rotation next changes attack */
+	nextRotationAt?: string;
+	/** Token requests left before a request-based rotation changes attack */
+	requestsUntilNext?: number;
+	history: AttackRotationEntry[];
+}
+
+/**
+ * Check a rotation config against the loaded plugins; throws on the first problem
+ */
+export function validateAttackRotation(config: AttackRotationConfig, catalog: string[]): void {
+	if (config.order !== undefined) {
+		if (config.order.length === 0) {
+			throw new Error("order must list at least one plugin");
+		}
+		const unknown = config.order.find((id) => !catalog.includes(id));
+		if (unknown !== undefined) {
+			throw new Error(`order names unknown plugin '${unknown}'`);
+		}
+	} else if (catalog.length === 0) {
+		throw new Error("no plugins are loaded to rotate through");
+	}
+	const { everyRequests } = config;
+	if (everyRequests !== undefined && !(Number.isInteger(everyRequests) && everyRequests >= 1)) {
+		throw new Error(`everyRequests must be a positive integer, got ${everyRequests}`);
+	}
+}
+
+export class AttackRotation {
+	readonly sessionId: string;
+	private readonly order: string[];
+	private readonly everyRequests: number | undefined;
+	private readonly now: () => number;
+	private tokenRequests = 0;
+	/** Rotation step (day number or request block) the last history entry started */
+	private lastStep: number | undefined;
+	private readonly history: AttackRotationEntry[] = [];
+
+	constructor(config: AttackRotationConfig, catalog: string[], now: () => number = Date.now) {
+		validateAttackRotation(config, catalog);
+		this.sessionId = config.sessionId ?? ATTACK_OF_THE_DAY_SESSION;
+		this.order = config.order ?? catalog;
+		this.everyRequests = config.everyRequests;
+		this.now = now;
+	}
+
+	/**
+	 * The active attack; returns the new entry when this call rotated to it
+	 */
+	advance(): { plugin: string; rotated?: AttackRotationEntry } {
+		const step = this.currentStep();
+		const last = this.history[this.history.length - 1];
+		if (last && step === this.lastStep) {
+			return { plugin: last.plugin };
+		}
+		const entry = this.entry(step % this.order.length);
+		this.lastStep = step;
+		this.history.push(entry);
+		if (this.history.length > MAX_HISTORY) {
+			this.history.shift();
+		}
+		return { plugin: entry.plugin, rotated: entry };
+	}
+
+	/**
+	 * Count a token request served by the session
+	 */
+	countTokenRequest(): void {
+		this.tokenRequests++;
+	}
+
+	getStatus(): AttackRotationStatus {
+		const step = this.currentStep();
+		const last = this.history[this.history.length - 1];
+		const current = last && step === this.lastStep ? last : this.entry(step % this.order.length);
+
+		const status: AttackRotationStatus = {
+			sessionId: this.sessionId,
+			cadence: this.everyRequests === undefined ? "daily" : "requests",
+			order: [...this.order],
+			current,
+			history: [...this.history],
+		};
+		if (this.everyRequests === undefined) {
+			const day = Math.floor(this.now() / DAY_MS);
+			status.nextRotationAt = new Date((day + 1) * DAY_MS).toISOString();
+		} else {
+			status.everyRequests = this.everyRequests;
+			status.requestsUntilNext = this.everyRequests - (this.tokenRequests % this.everyRequests);
+		}
+		return status;
+	}
+
+	private entry(index: number): AttackRotationEntry {
+		return {
+			plugin: this.order[index] as string,
+			index,
+			startedAt: new Date(this.now()).toISOString(),
+		};
+	}
+
+	private currentStep(): number {
+		return this.everyRequests === undefined
+			? Math.floor(this.now() / DAY_MS)
+			: Math.floor(this.tokenRequests / this.everyRequests);
+	}
+}
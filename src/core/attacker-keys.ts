@@ -0,0 +1,53 @@
+/**
+ * Attacker Keys - signing keys Loki never publishes in its JWKS
+ *
+ * Mischief that signs tokens as an attacker would uses these instead of
+ * Loki's keys. One key per algorithm is generated on first use and kept
+ * for the life of the process, so every token forged with an algorithm
+ * carries the same attacker kid (and certificate).
+ */
+
+import * as jose from "jose";
+import { type SigningAlgorithm, generateSigningKey } from "./key-manager.js";
+import { type SelfSignedCertificate, selfSignedCertificate } from "./x509.js";
+
+export interface AttackerKey {
+	kid: string;
+	alg: SigningAlgorithm;
+	/** Private key as PKCS8 PEM, ready for ForgeableToken.sign */
+	pem: string;
+	/** Public JWK, with kid, alg and use set */
+	publicJwk: jose.JWK;
+	/** Self-signed certificate for the key, for x5c and x5u headers */
+	certificate: SelfSignedCertificate;
+}
+
+const generated = new Map<SigningAlgorithm, Promise<AttackerKey>>();
+
+/**
+ * The attacker key for `alg`, generated on first use
+ */
+export function attackerKey(alg: SigningAlgorithm): Promise<AttackerKey> {
+	let key = generated.get(alg);
+	if (!key) {
+		key = generateSigningKey(alg).then(async (managed) => {
+			const pem = await jose.exportPKCS8(managed.privateKey);
+			return {
+				kid: managed.kid,
+				alg,
+				pem,
+				publicJwk: managed.publicJwk,
+				certificate: selfSignedCertificate({ privateKey: pem, commonName: `Loki Attacker ${alg}` }),
+			};
+		});
+		generated.set(alg, key);
+	}
+	return key;
+}
+
+/**
+ * Every attacker key generated so far
+ */
+export function generatedAttackerKeys(): Promise<AttackerKey[]> {
+	return Promise.all(generated.values());
+}
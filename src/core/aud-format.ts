@@ -0,0 +1,44 @@
+/**
+ * Audience Format - a single audience as a string or a one-element array
+ *
+ * RFC 7519 Section 4.1.3 lets `aud` be an array of audiences or, when
+ * there is exactly one, a plain string. Both are valid, yet parsers often
+ * handle only the form their issuer happened to send. A session's
+ * `audFormat` picks the form its tokens' single audience is serialized
+ * in, so a client can be checked against each; the aud-type-flip mischief
+ * sends whichever form the token didn't have.
+ */
+
+import type { AudFormat } from "./types.js";
+
+export const AUD_FORMATS: AudFormat[] = ["string", "array"];
+
+/**
+ * The form an `aud` value is serialized in; undefined when it is neither a
+ * string nor an array of strings
+ */
+export function audFormatOf(aud: unknown): AudFormat | undefined {
+	if (typeof aud === "string") {
+		return "string";
+	}
+	if (Array.isArray(aud) && aud.every((entry) => typeof entry === "string")) {
+		return "array";
+	}
+	return undefined;
+}
+
+/**
+ * A single audience in the given form: `"a"` or `["a"]`; undefined when
+ * `aud` names no single audience or already has that form
+ */
+export function formatAudience(aud: unknown, format: AudFormat): string | string[] | undefined {
+	const current = audFormatOf(aud);
+	if (current === undefined || current === format) {
+		return undefined;
+	}
+	if (current === "string") {
+		return [aud as string];
+	}
+	const audiences = aud as string[];
+	return audiences.length === 1 ? audiences[0] : undefined;
+}
@@ -0,0 +1,93 @@
+/**
+ * Chaos Mode - random mischief for a share of every token request
+ *
+ * For resilience testing of a whole environment rather than one client:
+ * with a chaos rate set, that fraction of token requests that no session
+ * claims (no X-Loki-Session header, no refresh token or client default
+ * session) is served one mischief plugin drawn at random. Clients across
+ * the fleet that accept a bad token then show up without each of them
+ * having to opt in. Draws come from random(), so a seeded Loki replays
+ * the same chaos for the same requests.
+ *
+ * Chaos issuances are recorded under a built-in session, `chaos`, so they
+ * have a report, a ledger and events like any other session's.
+ */
+
+import { random, randomInt } from "./random.js";
+import type { ChaosConfig, MischiefPhase } from "./types.js";
+
+/** Session id chaos-mode issuances are recorded under */
+export const CHAOS_SESSION = "chaos";
+
+/** Phases of the plugins chaos draws from by default: those that act on a token response */
+export const CHAOS_PHASES: MischiefPhase[] = ["token-claims", "token-signing", "response"];
+
+export interface ChaosStatus {
+	sessionId: string;
+	rate: number;
+	/** Plugins chaos draws from */
+	pool: string[];
+	/** Session-less token requests considered */
+	tokenRequests: number;
+	/** Requests given a mischief, by plugin */
+	applied: Record<string, number>;
+}
+
+/**
+ * Check a chaos config against the plugins it may draw from (those that
+ * act on a token response); throws on the first problem
+ */
+export function validateChaosConfig(config: ChaosConfig, catalog: string[]): void {
+	const { rate, allowlist } = config;
+	if (typeof rate !== "number" || !(rate >= 0 && rate <= 1)) {
+		throw new Error(`rate must be a number from 0 to 1, got ${rate}`);
+	}
+	if (allowlist !== undefined) {
+		if (allowlist.length === 0) {
+			throw new Error("allowlist must name at least one plugin");
+		}
+		const unknown = allowlist.find((id) => !catalog.includes(id));
+		if (unknown !== undefined) {
+			throw new Error(`allowlist names '${unknown}', which isn't a loaded token plugin`);
+		}
+	} else if (catalog.length === 0) {
+		throw new Error("no token plugins are loaded to draw from");
+	}
+}
+
+export class ChaosMode {
+	readonly sessionId = CHAOS_SESSION;
+	private readonly rate: number;
+	private readonly pool: string[];
+	private tokenRequests = 0;
+	private readonly applied = new Map<string, number>();
+
+	constructor(config: ChaosConfig, catalog: string[]) {
+		validateChaosConfig(config, catalog);
+		this.rate = config.rate;
+		this.pool = config.allowlist ?? catalog;
+	}
+
+	/**
+	 * Count a session-less token request and draw its mischief, if it gets one
+	 */
+	draw(): string | undefined {
+		this.tokenRequests++;
+		if (random() >= this.rate) {
+			return undefined;
+		}
+		const plugin = this.pool[randomInt(this.pool.length)] as string;
+		this.applied.set(plugin, (this.applied.get(plugin) ?? 0) + 1);
+		return plugin;
+	}
+
+	getStatus(): ChaosStatus {
+		return {
+			sessionId: this.sessionId,
+			rate: this.rate,
+			pool: [...this.pool],
+			tokenRequests: this.tokenRequests,
+			applied: Object.fromEntries(this.applied),
+		};
+	}
+}
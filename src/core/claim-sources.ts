@@ -0,0 +1,228 @@
+/**
+ * Claim Sources - aggregated and distributed claims (OIDC Core 1.0 Section 5.6.2)
+ *
+ * Aggregated claims embed a JWT signed by a claims provider directly in the
+ * token. Distributed claims point at an endpoint (hosted here, under
+ * /claims/:id) that returns the JWT when called with the right access token.
+ *
+ * Either kind can be tampered: the JWT is signed over the genuine claims and
+ * the payload is then swapped for altered ones, so the signature no longer
+ * verifies. Clients that resolve claim sources without checking signatures
+ * will happily accept the altered data.
+ */
+
+import * as jose from "jose";
+import { oauthError } from "./errors.js";
+import type { ManagedKey } from "./key-manager.js";
+import { randomId } from "./random.js";
+
+export interface ClaimSourceOptions {
+	/** Claims actually served in place of the signed ones (breaks the signature) */
+	tamperedClaims?: Record<string, unknown>;
+}
+
+export interface AggregatedClaimSource {
+	JWT: string;
+}
+
+export interface DistributedClaimSource {
+	endpoint: string;
+	access_token: string;
+}
+
+export interface DistributedClaimRecord {
+	id: string;
+	sessionId: string;
+	accessToken: string;
+	jwt: string;
+	tampered: boolean;
+	createdAt: Date;
+}
+
+/**
+ * Claim source helpers handed to plugins, bound to the current session
+ */
+export interface ClaimSourceFactory {
+	aggregated(
+		claims: Record<string, unknown>,
+		options?: ClaimSourceOptions,
+	): Promise<AggregatedClaimSource>;
+	distributed(
+		claims: Record<string, unknown>,
+		options?: ClaimSourceOptions,
+	): Promise<DistributedClaimSource>;
+}
+
+export interface ClaimSourceStoreOptions {
+	issuer: string;
+	/** Key the claims provider signs with */
+	getSigningKey: () => ManagedKey;
+	/** Called whenever a distributed claim endpoint is resolved */
+	onResolve?: (record: DistributedClaimRecord) => void;
+}
+
+export interface ClaimSourceResponse {
+	status: number;
+	headers: Record<string, string>;
+	body: string;
+}
+
+/** Upper bound on registered distributed sources */
+const MAX_DISTRIBUTED_SOURCES = 1000;
+
+/**
+ * Claim Source Store - signs claim JWTs and serves distributed claims
+ */
+export class ClaimSourceStore {
+	private readonly issuer: string;
+	private readonly getSigningKey: () => ManagedKey;
+	private readonly onResolve?: (record: DistributedClaimRecord) => void;
+	private readonly distributed = new Map<string, DistributedClaimRecord>(); // id -> record
+
+	constructor(options: ClaimSourceStoreOptions) {
+		this.issuer = options.issuer;
+		this.getSigningKey = options.getSigningKey;
+		if (options.onResolve) {
+			this.onResolve = options.onResolve;
+		}
+	}
+
+	/**
+	 * Build an aggregated claim source with an embedded JWT
+	 */
+	async createAggregated(
+		claims: Record<string, unknown>,
+		options?: ClaimSourceOptions,
+	): Promise<AggregatedClaimSource> {
+		return { JWT: await this.signClaims(claims, options?.tamperedClaims) };
+	}
+
+	/**
+	 * Register a distributed claim source served at /claims/:id
+	 */
+	async registerDistributed(
+		sessionId: string,
+		claims: Record<string, unknown>,
+		options?: ClaimSourceOptions,
+	): Promise<DistributedClaimSource> {
+		const record: DistributedClaimRecord = {
+			id: `cs_${randomId(12)}`,
+			sessionId,
+			accessToken: randomId(32),
+			jwt: await this.signClaims(claims, options?.tamperedClaims),
+			tampered: options?.tamperedClaims !== undefined,
+			createdAt: new Date(),
+		};
+
+		this.distributed.set(record.id, record);
+		if (this.distributed.size > MAX_DISTRIBUTED_SOURCES) {
+			const oldest = this.distributed.keys().next().value;
+			if (oldest !== undefined) {
+				this.distributed.delete(oldest);
+			}
+		}
+
+		return {
+			endpoint: `${this.issuer}/claims/${record.id}`,
+			access_token: record.accessToken,
+		};
+	}
+
+	/**
+	 * Resolve a distributed claim request
+	 *
+	 * The access token must be presented as a Bearer token, as it would be
+	 * for any other claims provider.
+	 */
+	resolve(id: string, authorization: string | undefined): ClaimSourceResponse {
+		const record = this.distributed.get(id);
+		if (!record) {
+			const message = "unknown distributed claim source";
+			return jsonResponse(404, oauthError("not_found", "claim_source_not_found", message, { id }));
+		}
+
+		const match = /^Bearer\s+(.+)$/i.exec(authorization ?? "");
+		if (!match || match[1] !== record.accessToken) {
+			return {
+				...jsonResponse(
+					401,
+					oauthError("invalid_token", "invalid_access_token", "invalid or missing access token"),
+				),
+				headers: {
+					"Content-Type": "application/json",
+					"WWW-Authenticate": 'Bearer error="invalid_token"',
+				},
+			};
+		}
+
+		if (this.onResolve) {
+			this.onResolve(record);
+		}
+
+		return {
+			status: 200,
+			headers: { "Content-Type": "application/jwt" },
+			body: record.jwt,
+		};
+	}
+
+	/**
+	 * Claim source helpers bound to a session
+	 */
+	forSession(sessionId: string): ClaimSourceFactory {
+		return {
+			aggregated: (claims, options) => this.createAggregated(claims, options),
+			distributed: (claims, options) => this.registerDistributed(sessionId, claims, options),
+		};
+	}
+
+	/**
+	 * Drop distributed sources registered by a session
+	 */
+	clear(sessionId: string): void {
+		for (const [id, record] of this.distributed) {
+			if (record.sessionId === sessionId) {
+				this.distributed.delete(id);
+			}
+		}
+	}
+
+	/**
+	 * Drop all distributed sources
+	 */
+	clearAll(): void {
+		this.distributed.clear();
+	}
+
+	/**
+	 * Sign claims as the claims provider, optionally swapping in tampered claims afterwards
+	 */
+	private async signClaims(
+		claims: Record<string, unknown>,
+		tamperedClaims?: Record<string, unknown>,
+	): Promise<string> {
+		const key = this.getSigningKey();
+		const jwt = await new jose.SignJWT({ ...claims })
+			.setProtectedHeader({ alg: key.alg, kid: key.kid, typ: "JWT" })
+			.setIssuer(this.issuer)
+			.setIssuedAt()
+			.sign(key.privateKey);
+
+		if (!tamperedClaims) {
+			return jwt;
+		}
+
+		const [header, payload, signature] = jwt.split(".");
+		const original = JSON.parse(Buffer.from(payload ?? "", "base64url").toString());
+		const altered = JSON.stringify({ ...original, ...tamperedClaims });
+		return `${header}.${Buffer.from(altered).toString("base64url")}.${signature}`;
+	}
+}
+
+function jsonResponse(status: number, body: unknown): ClaimSourceResponse {
+	return {
+		status,
+		headers: { "Content-Type": "application/json" },
+		body: JSON.stringify(body),
+	};
+}
@@ -0,0 +1,219 @@
+/**
+ * Client Assertions - private_key_jwt client authentication
+ *
+ * A confidential client whose public keys are registered through
+ * /admin/clients may authenticate at the token endpoint with a JWT it
+ * signed itself (`client_assertion_type` jwt-bearer and `client_assertion`,
+ * RFC 7523 Section 2.2). Loki verifies the assertion against those keys:
+ * the signature, `iss` and `sub` both equal to the client_id, an `aud`
+ * naming the issuer or the token endpoint, and an `exp` still in the
+ * future (OIDC Core Section 9). The provider only knows the client's
+ * secret, so an assertion Loki accepts is swapped for it before the
+ * request goes on.
+ */
+
+import * as jose from "jose";
+
+export const JWT_BEARER_ASSERTION = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer";
+
+/** Upper bound on public keys registered per client */
+const MAX_KEYS_PER_CLIENT = 10;
+
+/** Private and symmetric key members a public client key must not carry */
+const PRIVATE_MEMBERS = ["d", "p", "q", "dp", "dq", "qi", "oth", "k"];
+
+/** The alg an EC key without one is imported for, by curve */
+const EC_ALGS: Record<string, string> = { "P-256": "ES256", "P-384": "ES384", "P-521": "ES512" };
+
+/** Why a client assertion was refused */
+export type ClientAssertionFailure =
+	| "unsupported-type"
+	| "malformed"
+	| "no-keys"
+	| "wrong-key"
+	| "expired"
+	| "invalid-claims";
+
+/**
+ * A client assertion checked against its client's registered keys
+ */
+export interface ClientAssertionCheck {
+	clientId: string;
+	/** The assertion header's kid and alg, null when absent or unreadable */
+	kid: string | null;
+	alg: string | null;
+	/** Undefined when the assertion is valid */
+	failure?: ClientAssertionFailure;
+	/** What failed, e.g. the claim that didn't match */
+	reason?: string;
+}
+
+/**
+ * A client's registered public keys, as the admin API reports them
+ */
+export interface ClientKeysStatus {
+	clientId: string;
+	keys: { kid: string | null; kty: string; alg: string | null }[];
+	registeredAt: string;
+}
+
+/**
+ * The client an assertion claims to come from (its `sub`, else `iss`), unverified
+ */
+export function assertionClientId(assertion: string): string | undefined {
+	try {
+		const { sub, iss } = jose.decodeJwt(assertion);
+		return sub ?? iss;
+	} catch {
+		return undefined;
+	}
+}
+
+/**
+ * Verify a token request's client assertion for a client
+ *
+ * `audiences` are the values the assertion's `aud` may name.
+ */
+export async function verifyClientAssertion(
+	params: Record<string, string>,
+	clientId: string,
+	keys: jose.JWK[],
+	audiences: string[],
+	now: number = Date.now(),
+): Promise<ClientAssertionCheck> {
+	const assertion = params.client_assertion ?? "";
+	const check: ClientAssertionCheck = { clientId, kid: null, alg: null };
+	try {
+		const header = jose.decodeProtectedHeader(assertion);
+		check.kid = header.kid ?? null;
+		check.alg = header.alg ?? null;
+	} catch {
+		return { ...check, failure: "malformed", reason: "client_assertion is not a JWS" };
+	}
+	if (params.client_assertion_type !== JWT_BEARER_ASSERTION) {
+		return { ...check, failure: "unsupported-type", reason: `expected ${JWT_BEARER_ASSERTION}` };
+	}
+	if (keys.length === 0) {
+		return { ...check, failure: "no-keys", reason: "the client has no registered keys" };
+	}
+
+	try {
+		await jose.jwtVerify(assertion, jose.createLocalJWKSet({ keys }), {
+			issuer: clientId,
+			subject: clientId,
+			audience: audiences,
+			currentDate: new Date(now),
+			requiredClaims: ["exp"],
+		});
+		return check;
+	} catch (err) {
+		return { ...check, failure: assertionFailure(err), reason: String(err) };
+	}
+}
+
+function assertionFailure(err: unknown): ClientAssertionFailure {
+	const code = err instanceof jose.errors.JOSEError ? err.code : undefined;
+	switch (code) {
+		case "ERR_JWT_EXPIRED":
+			return "expired";
+		case "ERR_JWT_CLAIM_VALIDATION_FAILED":
+			return "invalid-claims";
+		case "ERR_JWS_INVALID":
+		case "ERR_JWT_INVALID":
+			return "malformed";
+		default:
+			return "wrong-key";
+	}
+}
+
+/**
+ * Client Key Store - the public keys clients sign their assertions with
+ */
+export class ClientKeyStore {
+	private readonly clients = new Map<string, { keys: jose.JWK[]; registeredAt: Date }>();
+
+	/**
+	 * Register a client's public keys, replacing any it had; throws if the
+	 * JWKS isn't a set of importable public keys
+	 */
+	async register(clientId: string, jwks: unknown): Promise<ClientKeysStatus> {
+		const keys = isKeySet(jwks) ? jwks.keys : undefined;
+		if (!keys || keys.length === 0) {
+			throw new Error("jwks must be an object with a non-empty keys array");
+		}
+		if (keys.length > MAX_KEYS_PER_CLIENT) {
+			throw new Error(`jwks may hold at most ${MAX_KEYS_PER_CLIENT} keys`);
+		}
+		for (const [index, jwk] of keys.entries()) {
+			const member = PRIVATE_MEMBERS.find((name) => name in jwk);
+			if (member !== undefined) {
+				throw new Error(`keys[${index}] must be a public key; it has '${member}'`);
+			}
+			try {
+				await jose.importJWK(jwk, jwk.alg ?? defaultAlg(jwk));
+			} catch (err) {
+				throw new Error(`keys[${index}] is not a usable public key: ${String(err)}`);
+			}
+		}
+
+		this.clients.set(clientId, { keys: [...keys], registeredAt: new Date() });
+		return this.status(clientId) as ClientKeysStatus;
+	}
+
+	/**
+	 * A client's registered public keys
+	 */
+	keys(clientId: string): jose.JWK[] {
+		return this.clients.get(clientId)?.keys ?? [];
+	}
+
+	status(clientId: string): ClientKeysStatus | undefined {
+		const entry = this.clients.get(clientId);
+		if (!entry) {
+			return undefined;
+		}
+		return {
+			clientId,
+			keys: entry.keys.map((jwk) => ({
+				kid: jwk.kid ?? null,
+				kty: jwk.kty ?? "",
+				alg: jwk.alg ?? null,
+			})),
+			registeredAt: entry.registeredAt.toISOString(),
+		};
+	}
+
+	/**
+	 * Drop a client's keys; returns false if it had none
+	 */
+	remove(clientId: string): boolean {
+		return this.clients.delete(clientId);
+	}
+}
+
+function isKeySet(value: unknown): value is { keys: jose.JWK[] } {
+	if (typeof value !== "object" || value === null) {
+		return false;
+	}
+	const keys = (value as { keys?: unknown }).keys;
+	return (
+		Array.isArray(keys) &&
+		keys.every((jwk) => typeof jwk === "object" && jwk !== null && !Array.isArray(jwk))
+	);
+}
+
+/**
+ * The alg to import a key without one for, from its type and curve
+ */
+function defaultAlg(jwk: jose.JWK): string | undefined {
+	switch (jwk.kty) {
+		case "RSA":
+			return "RS256";
+		case "EC":
+			return EC_ALGS[jwk.crv ?? ""];
+		case "OKP":
+			return "EdDSA";
+		default:
+			return undefined;
+	}
+}
@@ -0,0 +1,187 @@
+/**
+ * Client Auth - public vs confidential clients at the token endpoint
+ *
+ * A client registered with `token_endpoint_auth_method: none` is public:
+ * it has no secret, so it must not present one and can't use the
+ * client_credentials grant (RFC 6749 Sections 2.1 and 4.4). Every other
+ * client is confidential and must authenticate.
+ *
+ * Loki checks each token request against the client's registration before
+ * the provider sees it. The provider registers public clients for
+ * client_credentials too, so this check is what refuses them - and what
+ * `public-client-secret-accept` mischief switches off.
+ */
+
+import type { IncomingHttpHeaders } from "node:http";
+import { secretMatches } from "./shared-secret.js";
+import type { ClientConfig, TokenEndpointAuthMethod } from "./types.js";
+
+export type ClientType = "public" | "confidential";
+
+/** How a token request authenticated the client */
+export type PresentedAuthMethod =
+	| "client_secret_basic"
+	| "client_secret_post"
+	| "client_assertion"
+	| "none";
+
+/** A client/auth combination the token endpoint must refuse */
+export type ClientAuthViolation =
+	| "public-client-secret"
+	| "public-client-credentials"
+	| "confidential-unauthenticated";
+
+/**
+ * What one token request presented, checked against the client's registration
+ */
+export interface ClientAuthCheck {
+	clientId: string;
+	clientType: ClientType;
+	authMethod: PresentedAuthMethod;
+	grantType: string | null;
+	/** Undefined when the combination is allowed */
+	violation?: ClientAuthViolation;
+}
+
+/**
+ * The method a client is registered with: explicit, or basic if it has a secret
+ */
+export function registeredAuthMethod(client: ClientConfig): TokenEndpointAuthMethod {
+	if (client.token_endpoint_auth_method !== undefined) {
+		return client.token_endpoint_auth_method;
+	}
+	return client.client_secret ? "client_secret_basic" : "none";
+}
+
+export function clientType(client: ClientConfig): ClientType {
+	return registeredAuthMethod(client) === "none" ? "public" : "confidential";
+}
+
+/**
+ * The way a token request authenticates, from its Authorization header and form parameters
+ */
+export function presentedAuthMethod(
+	headers: IncomingHttpHeaders,
+	params: Record<string, string>,
+): PresentedAuthMethod {
+	if (headers.authorization?.toLowerCase().startsWith("basic ")) {
+		return "client_secret_basic";
+	}
+	if (params.client_secret !== undefined) {
+		return "client_secret_post";
+	}
+	if (params.client_assertion !== undefined) {
+		return "client_assertion";
+	}
+	return "none";
+}
+
+/**
+ * Check a token request from a registered client
+ */
+export function checkClientAuth(
+	client: ClientConfig,
+	authMethod: PresentedAuthMethod,
+	grantType: string | undefined,
+): ClientAuthCheck {
+	const check: ClientAuthCheck = {
+		clientId: client.client_id,
+		clientType: clientType(client),
+		authMethod,
+		grantType: grantType ?? null,
+	};
+	if (check.clientType === "confidential") {
+		if (authMethod === "none") {
+			check.violation = "confidential-unauthenticated";
+		}
+	} else if (authMethod !== "none") {
+		check.violation = "public-client-secret";
+	} else if (grantType === "client_credentials") {
+		check.violation = "public-client-credentials";
+	}
+	return check;
+}
+
+/**
+ * Whether a request authenticates as a client with its registered secret,
+ * by HTTP Basic or client_secret_post
+ */
+export function authenticatesWithSecret(
+	client: ClientConfig,
+	headers: IncomingHttpHeaders,
+	params: Record<string, string>,
+): boolean {
+	const secret = presentedSecret(headers.authorization, params);
+	if (client.client_secret === undefined || secret === undefined) {
+		return false;
+	}
+	return secretMatches(secret, client.client_secret);
+}
+
+function presentedSecret(
+	authorization: string | undefined,
+	params: Record<string, string>,
+): string | undefined {
+	if (!authorization?.toLowerCase().startsWith("basic ")) {
+		return params.client_secret;
+	}
+	const credentials = Buffer.from(authorization.slice(6), "base64").toString();
+	const separator = credentials.indexOf(":");
+	if (separator < 0) {
+		return undefined;
+	}
+	try {
+		// Basic credentials are form-encoded (RFC 6749 Section 2.3.1)
+		return decodeURIComponent(credentials.slice(separator + 1).replace(/\+/g, " "));
+	} catch {
+		return undefined;
+	}
+}
+
+/**
+ * Drop a public client's credentials from a token request, so the provider
+ * sees an unauthenticated request identified by `client_id`
+ */
+export function stripClientCredentials(
+	headers: IncomingHttpHeaders,
+	body: Buffer,
+	clientId: string,
+): { headers: IncomingHttpHeaders; body: Buffer } {
+	const form = new URLSearchParams(body.toString());
+	form.delete("client_secret");
+	form.delete("client_assertion");
+	form.delete("client_assertion_type");
+	form.set("client_id", clientId);
+	const stripped = Buffer.from(form.toString());
+
+	const { authorization: _, ...rest } = headers;
+	return { headers: { ...rest, "content-length": String(stripped.length) }, body: stripped };
+}
+
+/**
+ * Swap a token request's client assertion for the client's registered
+ * secret, sent by HTTP Basic, so the provider sees the client authenticated
+ */
+export function withClientSecret(
+	headers: IncomingHttpHeaders,
+	body: Buffer,
+	client: ClientConfig,
+): { headers: IncomingHttpHeaders; body: Buffer } {
+	const form = new URLSearchParams(body.toString());
+	form.delete("client_assertion");
+	form.delete("client_assertion_type");
+	form.delete("client_id");
+	const rewritten = Buffer.from(form.toString());
+
+	// Basic credentials are form-encoded (RFC 6749 Section 2.3.1)
+	const encode = (value: string) => encodeURIComponent(value).replace(/%20/g, "+");
+	const credentials = `${encode(client.client_id)}:${encode(client.client_secret ?? "")}`;
+	return {
+		headers: {
+			...headers,
+			authorization: `Basic ${Buffer.from(credentials).toString("base64")}`,
+			"content-length": String(rewritten.length),
+		},
+		body: rewritten,
+	};
+}
@@ -0,0 +1,368 @@
+/**
+ * Client Registry - the OAuth clients Loki's endpoints accept
+ *
+ * Clients come from config (`provider.clients`) or are registered while
+ * Loki runs through /admin/clients: each with a secret, public keys for
+ * private_key_jwt, or neither (a public client), plus its grant types and
+ * redirect URIs. The provider looks registered clients up here, so they
+ * can come and go without a restart; configured clients are fixed and can
+ * only be given keys.
+ *
+ * A registered client can also name a public key its ID tokens are
+ * encrypted to (see id-token-encryption.ts).
+ *
+ * A registered client may name default mischief. Token requests it makes
+ * without a session header then run in a session of its own, so several
+ * clients can model different security postures side by side.
+ *
+ * Changes are applied one at a time: concurrent registrations and
+ * deletions queue behind each other, and a lookup never sees half of one.
+ */
+
+import type * as jose from "jose";
+import { ClientKeyStore, type ClientKeysStatus } from "./client-assertion.js";
+import { type ClientType, clientType, registeredAuthMethod } from "./client-auth.js";
+import { DEVICE_CODE_GRANT } from "./device-authorization.js";
+import {
+	type IdTokenEncryption,
+	checkIdTokenEncryption,
+	parseIdTokenEncryption,
+} from "./id-token-encryption.js";
+import { randomBytes } from "./random.js";
+import { isPlainObject } from "./session-spec.js";
+import { TOKEN_EXCHANGE_GRANT } from "./token-exchange.js";
+import type { ClientConfig, TokenEndpointAuthMethod } from "./types.js";
+
+/** Grant types a registered client may ask for */
+export const CLIENT_GRANT_TYPES = [
+	"authorization_code",
+	"refresh_token",
+	"client_credentials",
+	DEVICE_CODE_GRANT,
+	TOKEN_EXCHANGE_GRANT,
+];
+
+/** Upper bound on clients registered through the admin API */
+const MAX_REGISTERED_CLIENTS = 100;
+
+/**
+ * A client registration from the admin API
+ */
+export interface ClientRegistration {
+	clientId: string;
+	clientSecret?: string;
+	/** Public keys for private_key_jwt, as a JWKS */
+	jwks?: unknown;
+	grantTypes?: string[];
+	redirectUris?: string[];
+	/** Mischief for the client's token requests that carry no session header */
+	mischief?: string[];
+	/** The public key (and alg and enc) its ID tokens are encrypted to */
+	idTokenEncryption?: IdTokenEncryption;
+}
+
+/**
+ * A client as the admin API reports it; its secret is never included
+ */
+export interface ClientStatus {
+	clientId: string;
+	clientType: ClientType;
+	authMethod: TokenEndpointAuthMethod;
+	source: "config" | "admin";
+	grantTypes: string[];
+	redirectUris: string[];
+	mischief: string[];
+	/** The session the client's session-less token requests run in, once there is one */
+	sessionId: string | null;
+	/** Empty until keys are registered; public clients can't have any */
+	keys: ClientKeysStatus["keys"];
+	keysRegisteredAt: string | null;
+	/** How its ID tokens are encrypted; null when they're only signed */
+	idTokenEncryption: { alg: string; enc: string; kid: string | null } | null;
+}
+
+interface ClientEntry {
+	config: ClientConfig;
+	source: "config" | "admin";
+	mischief: string[];
+	sessionId?: string;
+	idTokenEncryption?: IdTokenEncryption;
+}
+
+/**
+ * Validate a client registration body; returns an error message if it's invalid
+ */
+export function parseClientRegistration(body: unknown): ClientRegistration | string {
+	if (!isPlainObject(body)) {
+		return "Body must be an object with a clientId";
+	}
+	const {
+		clientId,
+		clientSecret,
+		jwks,
+		grantTypes,
+		redirectUris,
+		mischief,
+		idTokenEncryption,
+	} = body;
+	if (typeof clientId !== "string" || clientId.trim().length === 0) {
+		return "clientId must be a non-empty string";
+	}
+	if (clientSecret !== undefined && (typeof clientSecret !== "string" || clientSecret === "")) {
+		return "clientSecret must be a non-empty string";
+	}
+	if (grantTypes !== undefined && !isStringArray(grantTypes)) {
+		return "grantTypes must be an array of strings";
+	}
+	if (grantTypes?.some((grant) => !CLIENT_GRANT_TYPES.includes(grant))) {
+		return `grantTypes must be among: ${CLIENT_GRANT_TYPES.join(", ")}`;
+	}
+	if (
+		redirectUris !== undefined &&
+		!(isStringArray(redirectUris) && redirectUris.every((uri) => URL.canParse(uri)))
+	) {
+		return "redirectUris must be an array of absolute URLs";
+	}
+	if (mischief !== undefined && !isStringArray(mischief)) {
+		return "mischief must be an array of plugin IDs";
+	}
+	const encryption =
+		idTokenEncryption === undefined ? undefined : parseIdTokenEncryption(idTokenEncryption);
+	if (typeof encryption === "string") {
+		return encryption;
+	}
+	const isPublic = clientSecret === undefined && jwks === undefined;
+	if (isPublic && grantTypes?.includes("client_credentials")) {
+		return `Public client '${clientId}' cannot use client_credentials`;
+	}
+
+	const registration: ClientRegistration = { clientId };
+	if (clientSecret !== undefined) registration.clientSecret = clientSecret;
+	if (jwks !== undefined) registration.jwks = jwks;
+	if (grantTypes !== undefined) registration.grantTypes = grantTypes;
+	if (redirectUris !== undefined) registration.redirectUris = redirectUris;
+	if (mischief !== undefined) registration.mischief = mischief;
+	if (encryption !== undefined) registration.idTokenEncryption = encryption;
+	return registration;
+}
+
+function isStringArray(value: unknown): value is string[] {
+	return Array.isArray(value) && value.every((item) => typeof item === "string");
+}
+
+/**
+ * Client Registry - configured and admin-registered clients, with their keys
+ */
+export class ClientRegistry {
+	private readonly entries = new Map<string, ClientEntry>();
+	private readonly clientKeys = new ClientKeyStore();
+	private queue: Promise<unknown> = Promise.resolve();
+
+	constructor(configured: ClientConfig[]) {
+		for (const config of configured) {
+			this.entries.set(config.client_id, { config, source: "config", mischief: [] });
+		}
+	}
+
+	/**
+	 * A client by ID, configured or registered
+	 */
+	get(clientId: string | undefined): ClientConfig | undefined {
+		return clientId === undefined ? undefined : this.entries.get(clientId)?.config;
+	}
+
+	/**
+	 * A client registered through the admin API; undefined for configured ones
+	 */
+	registered(clientId: string): ClientConfig | undefined {
+		const entry = this.entries.get(clientId);
+		return entry?.source === "admin" ? entry.config : undefined;
+	}
+
+	/**
+	 * The public keys a client signs its assertions with
+	 */
+	keys(clientId: string): jose.JWK[] {
+		return this.clientKeys.keys(clientId);
+	}
+
+	/**
+	 * The key a client's ID tokens are encrypted to, if it registered one
+	 */
+	idTokenEncryption(clientId: string): IdTokenEncryption | undefined {
+		return this.entries.get(clientId)?.idTokenEncryption;
+	}
+
+	list(): ClientStatus[] {
+		return [...this.entries.keys()].map((clientId) => this.status(clientId) as ClientStatus);
+	}
+
+	status(clientId: string): ClientStatus | undefined {
+		const entry = this.entries.get(clientId);
+		if (!entry) {
+			return undefined;
+		}
+		const keys = this.clientKeys.status(clientId);
+		const encryption = entry.idTokenEncryption;
+		return {
+			clientId,
+			clientType: clientType(entry.config),
+			authMethod: registeredAuthMethod(entry.config),
+			source: entry.source,
+			grantTypes: entry.config.grant_types ?? ["authorization_code"],
+			redirectUris: entry.config.redirect_uris ?? [],
+			mischief: [...entry.mischief],
+			sessionId: entry.sessionId ?? null,
+			keys: keys?.keys ?? [],
+			keysRegisteredAt: keys?.registeredAt ?? null,
+			idTokenEncryption: encryption
+				? { alg: encryption.alg, enc: encryption.enc, kid: encryption.jwk.kid ?? null }
+				: null,
+		};
+	}
+
+	/**
+	 * Register a client, replacing an earlier registration under the same
+	 * ID; resolves to the session the replaced registration ran in, if any.
+	 * Throws for configured clients and invalid keys.
+	 */
+	register(registration: ClientRegistration): Promise<{ replacedSession?: string }> {
+		return this.serialize(async () => {
+			const { clientId } = registration;
+			const existing = this.entries.get(clientId);
+			if (existing?.source === "config") {
+				throw new Error(`Client '${clientId}' is configured; only its keys can be registered`);
+			}
+			if (!existing && this.registeredCount() >= MAX_REGISTERED_CLIENTS) {
+				throw new Error(`At most ${MAX_REGISTERED_CLIENTS} clients can be registered`);
+			}
+
+			const config = clientConfig(registration);
+			if (registration.idTokenEncryption) {
+				await checkIdTokenEncryption(registration.idTokenEncryption);
+			}
+			if (registration.jwks !== undefined) {
+				await this.clientKeys.register(clientId, registration.jwks);
+			} else {
+				this.clientKeys.remove(clientId);
+			}
+			const entry: ClientEntry = {
+				config,
+				source: "admin",
+				mischief: [...(registration.mischief ?? [])],
+			};
+			if (registration.idTokenEncryption) {
+				entry.idTokenEncryption = registration.idTokenEncryption;
+			}
+			this.entries.set(clientId, entry);
+			return existing?.sessionId === undefined ? {} : { replacedSession: existing.sessionId };
+		});
+	}
+
+	/**
+	 * Register a confidential client's public keys for private_key_jwt,
+	 * replacing any it had; throws if the client is public or the keys are invalid
+	 */
+	registerKeys(clientId: string, jwks: unknown): Promise<void> {
+		return this.serialize(async () => {
+			const entry = this.entries.get(clientId);
+			if (!entry) {
+				throw new Error(`No client '${clientId}' is registered`);
+			}
+			if (clientType(entry.config) === "public") {
+				throw new Error(`Public client '${clientId}' can't authenticate with private_key_jwt`);
+			}
+			await this.clientKeys.register(clientId, jwks);
+		});
+	}
+
+	/**
+	 * Drop a client's keys; returns false if it had none
+	 */
+	removeKeys(clientId: string): boolean {
+		return this.clientKeys.remove(clientId);
+	}
+
+	/**
+	 * Delete a registered client; resolves to whether it existed and the
+	 * session it ran in. Throws for configured clients.
+	 */
+	remove(clientId: string): Promise<{ removed: boolean; session?: string }> {
+		return this.serialize(async () => {
+			const entry = this.entries.get(clientId);
+			if (!entry) {
+				return { removed: false };
+			}
+			if (entry.source === "config") {
+				throw new Error(`Client '${clientId}' is configured and can't be deleted`);
+			}
+			this.entries.delete(clientId);
+			this.clientKeys.remove(clientId);
+			return entry.sessionId === undefined
+				? { removed: true }
+				: { removed: true, session: entry.sessionId };
+		});
+	}
+
+	/**
+	 * A client's default mischief and the session it runs in, if any
+	 */
+	defaults(clientId: string): { mischief: string[]; sessionId?: string } | undefined {
+		const entry = this.entries.get(clientId);
+		if (!entry || entry.mischief.length === 0) {
+			return undefined;
+		}
+		return entry.sessionId === undefined
+			? { mischief: entry.mischief }
+			: { mischief: entry.mischief, sessionId: entry.sessionId };
+	}
+
+	/**
+	 * Remember the session a client's default mischief runs in
+	 */
+	setSession(clientId: string, sessionId: string): void {
+		const entry = this.entries.get(clientId);
+		if (entry) {
+			entry.sessionId = sessionId;
+		}
+	}
+
+	private registeredCount(): number {
+		return [...this.entries.values()].filter((entry) => entry.source === "admin").length;
+	}
+
+	/**
+	 * Run a change once every earlier one has finished, whether or not it failed
+	 */
+	private serialize<T>(change: () => Promise<T>): Promise<T> {
+		const run = this.queue.then(change, change);
+		this.queue = run.catch(() => undefined);
+		return run;
+	}
+}
+
+/**
+ * The client config a registration stands for
+ *
+ * A client with keys but no secret authenticates with private_key_jwt
+ * only; it gets a random secret nobody is told, which Loki presents to
+ * the provider once an assertion checks out.
+ */
+function clientConfig(registration: ClientRegistration): ClientConfig {
+	const config: ClientConfig = { client_id: registration.clientId };
+	if (registration.clientSecret !== undefined) {
+		config.client_secret = registration.clientSecret;
+	} else if (registration.jwks !== undefined) {
+		config.client_secret = randomBytes(32).toString("base64url");
+		config.token_endpoint_auth_method = "private_key_jwt";
+	} else {
+		config.token_endpoint_auth_method = "none";
+	}
+	if (registration.grantTypes !== undefined) {
+		config.grant_types = [...registration.grantTypes];
+	}
+	if (registration.redirectUris !== undefined) {
+		config.redirect_uris = [...registration.redirectUris];
+	}
+	return config;
+}
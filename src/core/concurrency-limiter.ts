@@ -0,0 +1,53 @@
+/**
+ * Concurrency Limiter - server-wide cap on in-flight requests
+ *
+ * A counting semaphore that never queues: once the limit is reached, new
+ * requests are turned away straight away (503 + Retry-After) instead of
+ * piling up until everything times out. Keeps a shared instance responsive
+ * when a runaway load test points at it.
+ */
+
+export interface ConcurrencyStatus {
+	inFlight: number;
+	maxInFlight: number;
+	rejected: number;
+}
+
+export class ConcurrencyLimiter {
+	private inFlight = 0;
+	private rejected = 0;
+
+	/**
+	 * @param maxInFlight Maximum concurrent requests; 0 disables the limit
+	 */
+	constructor(private readonly maxInFlight: number) {
+		if (!Number.isInteger(maxInFlight) || maxInFlight < 0) {
+			throw new Error("maxInFlightRequests must be a non-negative integer");
+		}
+	}
+
+	/**
+	 * Take a slot, returning its release function; undefined if the limit is reached
+	 *
+	 * The release function is idempotent.
+	 */
+	tryAcquire(): (() => void) | undefined {
+		if (this.maxInFlight > 0 && this.inFlight >= this.maxInFlight) {
+			this.rejected++;
+			return undefined;
+		}
+
+		this.inFlight++;
+		let released = false;
+		return () => {
+			if (!released) {
+				released = true;
+				this.inFlight--;
+			}
+		};
+	}
+
+	getStatus(): ConcurrencyStatus {
+		return { inFlight: this.inFlight, maxInFlight: this.maxInFlight, rejected: this.rejected };
+	}
+}
@@ -0,0 +1,105 @@
+/**
+ * Device Authorization - the device code grant's polling side (RFC 8628)
+ *
+ * oidc-provider issues device codes at /device_authorization and redeems
+ * them at the token endpoint. Loki records each code it hands out, with
+ * its lifetime and polling interval, so it can answer polls itself: a code
+ * past its lifetime gets the standard `expired_token` error (the provider
+ * forgets expired codes and would say `invalid_grant`), and each poll is
+ * timed against the previous one so mischief and event logs can show
+ * whether a client keeps to the interval.
+ */
+
+/** grant_type of a device access token request (RFC 8628 Section 3.4) */
+export const DEVICE_CODE_GRANT = "urn:ietf:params:oauth:grant-type:device_code";
+
+/** Polling interval when the authorization response names none (RFC 8628 Section 3.2) */
+export const DEFAULT_POLLING_INTERVAL = 5;
+
+/** Upper bound on device codes remembered */
+const MAX_CODES = 10000;
+
+export interface DeviceCodeRecord {
+	clientId: string | undefined;
+	/** Epoch milliseconds after which the code is expired */
+	expiresAt: number;
+	/** Seconds the client must wait between polls */
+	interval: number;
+	/** Polls so far */
+	polls: number;
+	/** Epoch milliseconds of the previous poll, undefined before the first */
+	lastPolledAt: number | undefined;
+}
+
+export interface DevicePoll {
+	/** Seconds the client must wait between polls */
+	interval: number;
+	/** Which poll this is, from 1 */
+	polls: number;
+	/** Milliseconds since the previous poll, null on the first */
+	sinceLastPollMs: number | null;
+	/** Whether the code is past its lifetime */
+	expired: boolean;
+}
+
+export interface DeviceCodeLedgerOptions {
+	/** Clock override, in epoch milliseconds (for tests) */
+	now?: () => number;
+}
+
+/**
+ * The device codes issued, with their lifetimes and polls
+ */
+export class DeviceCodeLedger {
+	private readonly now: () => number;
+	private readonly codes = new Map<string, DeviceCodeRecord>(); // device_code -> record
+
+	constructor(options: DeviceCodeLedgerOptions = {}) {
+		this.now = options.now ?? Date.now;
+	}
+
+	/**
+	 * Record a device authorization response
+	 *
+	 * Responses without a device_code or expires_in are ignored.
+	 */
+	issue(response: Record<string, unknown>, clientId: string | undefined): void {
+		const { device_code: deviceCode, expires_in: expiresIn, interval } = response;
+		if (typeof deviceCode !== "string" || typeof expiresIn !== "number") {
+			return;
+		}
+		this.codes.set(deviceCode, {
+			clientId,
+			expiresAt: this.now() + expiresIn * 1000,
+			interval: typeof interval === "number" ? interval : DEFAULT_POLLING_INTERVAL,
+			polls: 0,
+			lastPolledAt: undefined,
+		});
+		if (this.codes.size > MAX_CODES) {
+			const oldest = this.codes.keys().next().value;
+			if (oldest !== undefined) {
+				this.codes.delete(oldest);
+			}
+		}
+	}
+
+	/**
+	 * Record a poll of a device code; undefined if Loki never issued it
+	 */
+	poll(deviceCode: string): DevicePoll | undefined {
+		const record = this.codes.get(deviceCode);
+		if (!record) {
+			return undefined;
+		}
+		const now = this.now();
+		const previous = record.lastPolledAt;
+		record.polls++;
+		record.lastPolledAt = now;
+		return {
+			interval: record.interval,
+			polls: record.polls,
+			sinceLastPollMs: previous === undefined ? null : now - previous,
+			expired: now >= record.expiresAt,
+		};
+	}
+}
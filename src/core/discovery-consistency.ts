@@ -0,0 +1,369 @@
+/**
+ * Discovery Consistency - audit an issuer's discovery document, JWKS and tokens
+ *
+ * Crawls `<issuer>/.well-known/openid-configuration`, the JWKS it points
+ * to and, optionally, a sample token, and reports every place they
+ * disagree: an `issuer` that isn't the URL it was fetched from, a
+ * `jwks_uri` on another origin, a token signed with an algorithm or key
+ * the metadata doesn't advertise. The checks are the ones a careful client
+ * makes, so the probe works as well against a third-party IdP as against
+ * a Loki session serving deliberately inconsistent metadata (pass its
+ * `X-Loki-Session` in `headers`).
+ */
+
+import * as jose from "jose";
+import { isPlainObject } from "./session-spec.js";
+import type { Severity } from "./types.js";
+
+/** Header parameters that point a verifier at a key of the signer's choosing */
+const KEY_HEADERS = ["jku", "x5u", "jwk"];
+
+/** Members only private JWKs have */
+const PRIVATE_MEMBERS = ["d", "p", "q", "dp", "dq", "qi", "k"];
+
+const DEFAULT_TIMEOUT_MS = 5000;
+
+export interface ConsistencyProbeOptions {
+	issuer: string;
+	/** A token the issuer signed, checked against its metadata and keys */
+	token?: string;
+	/** Extra request headers, e.g. X-Loki-Session */
+	headers?: Record<string, string>;
+	timeoutMs?: number;
+	/** Fetch implementation (for tests) */
+	fetch?: typeof fetch;
+}
+
+export interface ConsistencyFinding {
+	/** Stable identifier, e.g. "iss-mismatch" */
+	check: string;
+	severity: Severity;
+	message: string;
+	/** Spec the finding violates */
+	spec?: string;
+	evidence?: Record<string, unknown>;
+}
+
+export interface ConsistencyReport {
+	issuer: string;
+	discoveryUrl: string;
+	jwksUri: string | null;
+	/** Keys found in the JWKS */
+	keys: number;
+	tokenChecked: boolean;
+	/** No findings above low severity */
+	consistent: boolean;
+	findings: ConsistencyFinding[];
+}
+
+type Fetched = { ok: true; body: unknown } | { ok: false; error: string };
+
+/**
+ * Crawl an issuer's metadata and report inconsistencies
+ */
+export async function probeDiscoveryConsistency(
+	options: ConsistencyProbeOptions,
+): Promise<ConsistencyReport> {
+	const issuer = options.issuer;
+	const discoveryUrl = `${issuer.replace(/\/+$/, "")}/.well-known/openid-configuration`;
+	const findings: ConsistencyFinding[] = [];
+	const report: ConsistencyReport = {
+		issuer,
+		discoveryUrl,
+		jwksUri: null,
+		keys: 0,
+		tokenChecked: false,
+		consistent: false,
+		findings,
+	};
+	const get = (url: string) => fetchJson(url, options);
+
+	const discovery = await get(discoveryUrl);
+	if (!discovery.ok || !isPlainObject(discovery.body)) {
+		findings.push({
+			check: "discovery-unavailable",
+			severity: "critical",
+			message: discovery.ok
+				? "Discovery document is not a JSON object"
+				: `Discovery document could not be fetched: ${discovery.error}`,
+			spec: "OpenID Connect Discovery 1.0 Section 4",
+		});
+		return finish(report);
+	}
+	const metadata = discovery.body;
+	checkMetadata(issuer, metadata, findings);
+
+	const advertisedAlgs = stringArray(metadata.id_token_signing_alg_values_supported);
+	let jwks: jose.JSONWebKeySet | undefined;
+	if (typeof metadata.jwks_uri === "string") {
+		report.jwksUri = metadata.jwks_uri;
+		const fetched = await get(metadata.jwks_uri);
+		if (fetched.ok && isPlainObject(fetched.body) && Array.isArray(fetched.body.keys)) {
+			jwks = fetched.body as unknown as jose.JSONWebKeySet;
+			report.keys = jwks.keys.length;
+			checkJwks(jwks, advertisedAlgs, findings);
+		} else {
+			findings.push({
+				check: "jwks-unavailable",
+				severity: "high",
+				message: fetched.ok
+					? "JWKS is not a JSON object with a keys array"
+					: `JWKS could not be fetched: ${fetched.error}`,
+				spec: "RFC 7517 Section 5",
+				evidence: { jwksUri: metadata.jwks_uri },
+			});
+		}
+	}
+
+	if (options.token !== undefined) {
+		report.tokenChecked = true;
+		await checkToken(options.token, metadata, advertisedAlgs, jwks, findings);
+	}
+
+	return finish(report);
+}
+
+/**
+ * Discovery document checks: issuer, jwks_uri and advertised algorithms
+ */
+function checkMetadata(
+	issuer: string,
+	metadata: Record<string, unknown>,
+	findings: ConsistencyFinding[],
+): void {
+	if (metadata.issuer !== issuer) {
+		findings.push({
+			check: "iss-mismatch",
+			severity: "critical",
+			message: "Discovery issuer is not identical to the issuer it was fetched for",
+			spec: "OpenID Connect Discovery 1.0 Section 4.3",
+			evidence: { expected: issuer, advertised: metadata.issuer ?? null },
+		});
+	}
+
+	const jwksUri = metadata.jwks_uri;
+	if (typeof jwksUri !== "string") {
+		findings.push({
+			check: "jwks-uri-missing",
+			severity: "high",
+			message: "Discovery document has no jwks_uri",
+			spec: "OpenID Connect Discovery 1.0 Section 3",
+		});
+	} else if (origin(jwksUri) !== origin(issuer)) {
+		findings.push({
+			check: "jwks-uri-foreign",
+			severity: "high",
+			message: "jwks_uri points to a different origin than the issuer",
+			spec: "RFC 8414 Section 2",
+			evidence: { issuer, jwksUri },
+		});
+	} else if (!jwksUri.startsWith("https:") && issuer.startsWith("https:")) {
+		findings.push({
+			check: "jwks-uri-insecure",
+			severity: "high",
+			message: "jwks_uri is not https although the issuer is",
+			spec: "RFC 8414 Section 2",
+			evidence: { jwksUri },
+		});
+	}
+
+	const algs = stringArray(metadata.id_token_signing_alg_values_supported);
+	if (algs.includes("none")) {
+		findings.push({
+			check: "alg-none-advertised",
+			severity: "high",
+			message: "id_token_signing_alg_values_supported includes none",
+			spec: "OpenID Connect Discovery 1.0 Section 3",
+			evidence: { advertised: algs },
+		});
+	}
+}
+
+/**
+ * JWKS checks: no private material, unique kids, algorithms the metadata advertises
+ */
+function checkJwks(
+	jwks: jose.JSONWebKeySet,
+	advertisedAlgs: string[],
+	findings: ConsistencyFinding[],
+): void {
+	if (jwks.keys.length === 0) {
+		findings.push({
+			check: "jwks-empty",
+			severity: "high",
+			message: "JWKS has no keys",
+			spec: "RFC 7517 Section 5",
+		});
+	}
+
+	const seen = new Set<string>();
+	for (const key of jwks.keys) {
+		const members = PRIVATE_MEMBERS.filter((member) => member in key);
+		if (members.length > 0) {
+			findings.push({
+				check: "jwks-private-key",
+				severity: "critical",
+				message: "JWKS publishes private key material",
+				spec: "RFC 7517 Section 9.3",
+				evidence: { kid: key.kid ?? null, members },
+			});
+		}
+		if (key.kid !== undefined) {
+			if (seen.has(key.kid)) {
+				findings.push({
+					check: "jwks-duplicate-kid",
+					severity: "medium",
+					message: "Several JWKS keys share a kid",
+					spec: "RFC 7517 Section 4.5",
+					evidence: { kid: key.kid },
+				});
+			}
+			seen.add(key.kid);
+		}
+		if (key.alg !== undefined && advertisedAlgs.length > 0 && !advertisedAlgs.includes(key.alg)) {
+			findings.push({
+				check: "jwks-alg-not-advertised",
+				severity: "low",
+				message: "A JWKS key's alg isn't in id_token_signing_alg_values_supported",
+				spec: "OpenID Connect Discovery 1.0 Section 3",
+				evidence: { kid: key.kid ?? null, alg: key.alg, advertised: advertisedAlgs },
+			});
+		}
+	}
+}
+
+/**
+ * Token checks: issuer, algorithm and key against the metadata, then the signature
+ */
+async function checkToken(
+	token: string,
+	metadata: Record<string, unknown>,
+	advertisedAlgs: string[],
+	jwks: jose.JSONWebKeySet | undefined,
+	findings: ConsistencyFinding[],
+): Promise<void> {
+	let header: jose.ProtectedHeaderParameters;
+	let claims: jose.JWTPayload;
+	try {
+		header = jose.decodeProtectedHeader(token);
+		claims = jose.decodeJwt(token);
+	} catch {
+		findings.push({
+			check: "token-undecodable",
+			severity: "high",
+			message: "Sample token is not a decodable JWT",
+			spec: "RFC 7519 Section 7.2",
+		});
+		return;
+	}
+
+	if (claims.iss !== metadata.issuer) {
+		findings.push({
+			check: "token-iss-mismatch",
+			severity: "critical",
+			message: "Token iss differs from the discovery issuer",
+			spec: "OpenID Connect Core 1.0 Section 3.1.3.7",
+			evidence: { tokenIss: claims.iss ?? null, issuer: metadata.issuer ?? null },
+		});
+	}
+
+	const alg = header.alg;
+	if (alg === "none") {
+		findings.push({
+			check: "token-alg-none",
+			severity: "critical",
+			message: "Token is unsigned (alg none)",
+			spec: "RFC 8725 Section 3.1",
+		});
+	} else if (alg !== undefined && advertisedAlgs.length > 0 && !advertisedAlgs.includes(alg)) {
+		findings.push({
+			check: "token-alg-not-advertised",
+			severity: "high",
+			message: "Token alg isn't in id_token_signing_alg_values_supported",
+			spec: "OpenID Connect Discovery 1.0 Section 3",
+			evidence: { alg, advertised: advertisedAlgs },
+		});
+	}
+
+	const keyHeaders = KEY_HEADERS.filter((name) => name in header);
+	if (keyHeaders.length > 0) {
+		findings.push({
+			check: "token-key-header",
+			severity: "high",
+			message: "Token header names its own verification key",
+			spec: "RFC 8725 Section 3.10",
+			evidence: { headers: keyHeaders },
+		});
+	}
+
+	if (!jwks || alg === "none") {
+		return;
+	}
+	const candidates = jwks.keys.filter((key) => header.kid === undefined || key.kid === header.kid);
+	if (candidates.length === 0) {
+		findings.push({
+			check: "token-kid-unknown",
+			severity: "high",
+			message: "No JWKS key has the token's kid",
+			spec: "RFC 7515 Section 4.1.4",
+			evidence: { kid: header.kid ?? null },
+		});
+		return;
+	}
+	const mismatched = candidates.filter((key) => key.alg !== undefined && key.alg !== alg);
+	if (mismatched.length === candidates.length) {
+		findings.push({
+			check: "token-alg-mismatch",
+			severity: "high",
+			message: "Token alg differs from the alg of its JWKS key",
+			spec: "RFC 7517 Section 4.4",
+			evidence: { alg: alg ?? null, keyAlgs: mismatched.map((key) => key.alg) },
+		});
+		return;
+	}
+
+	try {
+		await jose.compactVerify(token, jose.createLocalJWKSet(jwks));
+	} catch (err) {
+		findings.push({
+			check: "token-signature-invalid",
+			severity: "critical",
+			message: "Token signature doesn't verify against the JWKS",
+			spec: "RFC 7515 Section 5.2",
+			evidence: { error: err instanceof Error ? err.message : String(err) },
+		});
+	}
+}
+
+function finish(report: ConsistencyReport): ConsistencyReport {
+	report.consistent = report.findings.every((finding) => finding.severity === "low");
+	return report;
+}
+
+async function fetchJson(url: string, options: ConsistencyProbeOptions): Promise<Fetched> {
+	const fetcher = options.fetch ?? fetch;
+	try {
+		const response = await fetcher(url, {
+			headers: { Accept: "application/json", ...options.headers },
+			signal: AbortSignal.timeout(options.timeoutMs ?? DEFAULT_TIMEOUT_MS),
+		});
+		if (!response.ok) {
+			return { ok: false, error: `HTTP ${response.status}` };
+		}
+		return { ok: true, body: await response.json() };
+	} catch (err) {
+		return { ok: false, error: err instanceof Error ? err.message : String(err) };
+	}
+}
+
+function origin(url: string): string | undefined {
+	try {
+		return new URL(url).origin;
+	} catch {
+		return undefined;
+	}
+}
+
+function stringArray(value: unknown): string[] {
+	return Array.isArray(value) ? value.filter((v): v is string => typeof v === "string") : [];
+}
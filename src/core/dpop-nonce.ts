@@ -0,0 +1,77 @@
+/**
+ * DPoP Nonce - server-provided nonces at the token endpoint
+ *
+ * RFC 9449 Section 8 lets the server demand a nonce in DPoP proofs: a proof
+ * without one is answered with `400 use_dpop_nonce` and a `DPoP-Nonce`
+ * header, and the client retries with that nonce in its proof. oidc-provider
+ * implements the loop; Loki decides per request whether a nonce is
+ * required (always with `requireDpopNonce`, or when session mischief asks)
+ * and records each exchange as a session event.
+ *
+ * Mischief can also make the loop unwinnable: `reject-valid` answers the
+ * correct nonce with yet another challenge, and `never-issue` keeps
+ * demanding a nonce without ever sending one. Clients must give up after
+ * a retry instead of looping.
+ */
+
+import type { ServerResponse } from "node:http";
+import { oauthError, sendError } from "./errors.js";
+import { randomBytes } from "./random.js";
+
+export type DpopNonceMode = "require" | "reject-valid" | "never-issue";
+
+export const DPOP_NONCE_MODES: readonly DpopNonceMode[] = [
+	"require",
+	"reject-valid",
+	"never-issue",
+];
+
+/**
+ * What Loki decided about one token request's DPoP proof
+ */
+export interface DpopNonceExchange {
+	/** Nonce in the proof; null when it carried none */
+	presented: string | null;
+	/** Mischief mode in force, if any */
+	mode?: DpopNonceMode;
+	/** Whether oidc-provider must demand a nonce */
+	requireNonce: boolean;
+}
+
+/**
+ * The nonce claim of a DPoP proof: null when it has none, undefined when
+ * the proof can't be decoded (oidc-provider rejects those itself)
+ */
+export function dpopProofNonce(proof: string): string | null | undefined {
+	try {
+		const payload: unknown = JSON.parse(
+			Buffer.from(proof.split(".")[1] ?? "", "base64url").toString("utf8"),
+		);
+		if (typeof payload !== "object" || payload === null) {
+			return undefined;
+		}
+		const nonce = (payload as Record<string, unknown>).nonce;
+		return typeof nonce === "string" ? nonce : null;
+	} catch {
+		return undefined;
+	}
+}
+
+/**
+ * Answer with a `use_dpop_nonce` challenge, with a fresh nonce unless `nonce` is null
+ */
+export function sendUseDpopNonce(res: ServerResponse, nonce: string | null): void {
+	const headers: Record<string, string> = { "Cache-Control": "no-store" };
+	if (nonce !== null) {
+		headers["DPoP-Nonce"] = nonce;
+	}
+	const message = "Authorization server requires nonce in DPoP proof";
+	sendError(res, 400, oauthError("use_dpop_nonce", "dpop_nonce_required", message), headers);
+}
+
+/**
+ * A nonce in the format oidc-provider issues, for challenges Loki answers itself
+ */
+export function generateDpopNonce(): string {
+	return randomBytes(32).toString("base64url");
+}
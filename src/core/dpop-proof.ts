@@ -0,0 +1,156 @@
+/**
+ * DPoP Proof - proof-of-possession at the token endpoint (RFC 9449)
+ *
+ * A client sends a DPoP proof with its token request: a JWT signed with a
+ * key of its own, whose public half it carries in the `jwk` header. Loki
+ * checks every proof sent to /token before the provider sees the request
+ * (Section 4.3): the `typ` is `dpop+jwt`, the signature verifies with the
+ * embedded key under an asymmetric algorithm, `htm` and `htu` name this
+ * request, `iat` is recent and the `jti` hasn't been seen before. A proof
+ * failing any check gets `400 invalid_dpop_proof`.
+ *
+ * The access token issued is bound to the proof's key: its `cnf` claim
+ * carries the key's RFC 7638 thumbprint as `jkt` (Section 6.1), which a
+ * resource server must match against the key of the proof sent with the
+ * token. The session's attack report shows the thumbprint expected next to
+ * the one the token was sent with.
+ */
+
+import * as jose from "jose";
+import { isPlainObject } from "./session-spec.js";
+
+/** The `typ` of a DPoP proof */
+export const DPOP_TYP = "dpop+jwt";
+
+/** Asymmetric algorithms a proof may be signed with (Section 4.2) */
+export const DPOP_ALGORITHMS = [
+	"ES256",
+	"ES384",
+	"ES512",
+	"EdDSA",
+	"PS256",
+	"PS384",
+	"PS512",
+	"RS256",
+	"RS384",
+	"RS512",
+];
+
+/** Seconds a proof is accepted after its `iat` */
+export const DPOP_PROOF_LIFETIME = 300;
+
+/** Seconds a proof's `iat` may lie ahead of Loki's clock */
+const CLOCK_TOLERANCE = 5;
+
+/** Upper bound on proof jtis remembered */
+const MAX_JTIS = 10000;
+
+/** A verified proof: the thumbprint of its key, and its jti */
+export interface DpopProof {
+	thumbprint: string;
+	jti: string;
+}
+
+/**
+ * Verify a DPoP proof sent with a `method` request to `endpoint`, the URL
+ * the client should have put in `htu`; a string is why it's invalid.
+ * Replay is checked separately, with {@link DpopJtiCache}
+ */
+export async function verifyDpopProof(
+	proof: string,
+	method: string,
+	endpoint: string,
+	now: number = Date.now(),
+): Promise<DpopProof | string> {
+	let jwk: unknown;
+	try {
+		jwk = jose.decodeProtectedHeader(proof).jwk;
+	} catch {
+		return "the DPoP proof is not a JWS";
+	}
+	if (!isPlainObject(jwk) || "d" in jwk) {
+		return "the DPoP proof must carry a public key in its jwk header";
+	}
+
+	let claims: jose.JWTPayload;
+	try {
+		({ payload: claims } = await jose.jwtVerify(proof, jose.EmbeddedJWK, {
+			typ: DPOP_TYP,
+			algorithms: DPOP_ALGORITHMS,
+			maxTokenAge: DPOP_PROOF_LIFETIME,
+			clockTolerance: CLOCK_TOLERANCE,
+			currentDate: new Date(now),
+		}));
+	} catch (err) {
+		return `the DPoP proof failed verification: ${(err as Error).message}`;
+	}
+
+	if (claims.htm !== method) {
+		return `the DPoP proof's htm must be ${method}`;
+	}
+	if (typeof claims.htu !== "string" || !sameEndpoint(claims.htu, endpoint)) {
+		return `the DPoP proof's htu must be ${endpoint}`;
+	}
+	if (typeof claims.jti !== "string" || claims.jti === "") {
+		return "the DPoP proof must carry a jti";
+	}
+	const thumbprint = await jose.calculateJwkThumbprint(jwk as jose.JWK, "sha256");
+	return { thumbprint, jti: claims.jti };
+}
+
+/**
+ * Bind a token's claims to a DPoP key, keeping any other confirmation
+ * method (a certificate's `x5t#S256`); false if they were already bound to it
+ */
+export function bindDpopKey(claims: Record<string, unknown>, thumbprint: string): boolean {
+	const cnf = isPlainObject(claims.cnf) ? claims.cnf : {};
+	if (cnf.jkt === thumbprint) {
+		return false;
+	}
+	claims.cnf = { ...cnf, jkt: thumbprint };
+	return true;
+}
+
+/**
+ * Whether `htu` names `endpoint`, ignoring any query and fragment (Section 4.3)
+ */
+function sameEndpoint(htu: string, endpoint: string): boolean {
+	if (!URL.canParse(htu)) {
+		return false;
+	}
+	const sent = new URL(htu);
+	const expected = new URL(endpoint);
+	return sent.origin === expected.origin && sent.pathname === expected.pathname;
+}
+
+/**
+ * The jtis of proofs accepted within their lifetime, so none is used twice
+ */
+export class DpopJtiCache {
+	/** jti -> epoch milliseconds after which it may be forgotten */
+	private readonly seen = new Map<string, number>();
+
+	constructor(private readonly now: () => number = Date.now) {}
+
+	/**
+	 * Remember a jti; returns true if it was already used
+	 */
+	use(jti: string): boolean {
+		const now = this.now();
+		for (const [seenJti, forgetAt] of this.seen) {
+			if (forgetAt > now && this.seen.size < MAX_JTIS) {
+				break;
+			}
+			this.seen.delete(seenJti);
+		}
+		if (this.seen.has(jti)) {
+			return true;
+		}
+		this.seen.set(jti, now + (DPOP_PROOF_LIFETIME + CLOCK_TOLERANCE) * 1000);
+		return false;
+	}
+
+	clear(): void {
+		this.seen.clear();
+	}
+}
@@ -0,0 +1,40 @@
+/**
+ * Durations - Go's duration syntax, for offsets given in session config
+ *
+ * A duration is a sequence of decimal numbers, each with an optional
+ * fraction and a unit (`ns`, `us`/`µs`, `ms`, `s`, `m`, `h`), optionally
+ * signed: "262800h", "1h30m", "-1.5h". "0" needs no unit. This is what Go's
+ * `time.Duration.String()` produces, so Go test suites can pass theirs as is.
+ */
+
+/** Milliseconds per unit */
+const UNITS: Record<string, number> = {
+	ns: 1e-6,
+	us: 1e-3,
+	"µs": 1e-3,
+	"μs": 1e-3,
+	ms: 1,
+	s: 1000,
+	m: 60 * 1000,
+	h: 60 * 60 * 1000,
+};
+
+const DURATION = /^[-+]?(?:(?:\d+(?:\.\d*)?|\.\d+)(?:ns|us|µs|μs|ms|s|m|h))+$/;
+const COMPONENT = /(\d+(?:\.\d*)?|\.\d+)(ns|us|µs|μs|ms|s|m|h)/g;
+
+/**
+ * Parse a Go duration string into milliseconds; undefined if it isn't one
+ */
+export function parseDuration(value: string): number | undefined {
+	if (value === "0" || value === "+0" || value === "-0") {
+		return 0;
+	}
+	if (!DURATION.test(value)) {
+		return undefined;
+	}
+	let total = 0;
+	for (const [, amount, unit] of value.matchAll(COMPONENT)) {
+		total += Number(amount) * (UNITS[unit as string] as number);
+	}
+	return value.startsWith("-") ? -total : total;
+}
@@ -0,0 +1,101 @@
+/**
+ * Endpoint Flags - switching individual OIDC endpoints off
+ *
+ * A test deployment standing in for a real IdP should offer no more than
+ * that IdP does: a client that calls userinfo against Loki, when the real
+ * IdP has none, passes its tests and then fails in production. Each
+ * endpoint below can be disabled by name; a disabled endpoint answers 404
+ * like any unknown route, and the discovery members that advertise it are
+ * left out of the discovery document.
+ */
+
+/** An endpoint that can be disabled: the paths it serves and the metadata advertising it */
+export interface ToggleableEndpoint {
+	paths: string[];
+	metadata: string[];
+}
+
+export const TOGGLEABLE_ENDPOINTS: Record<string, ToggleableEndpoint> = {
+	authorization: { paths: ["/auth"], metadata: ["authorization_endpoint"] },
+	token: { paths: ["/token"], metadata: ["token_endpoint"] },
+	userinfo: { paths: ["/me", "/userinfo"], metadata: ["userinfo_endpoint"] },
+	jwks: { paths: ["/jwks", "/.well-known/jwks.json"], metadata: ["jwks_uri"] },
+	revocation: { paths: ["/token/revocation", "/revoke"], metadata: ["revocation_endpoint"] },
+	introspection: {
+		paths: ["/token/introspection", "/introspect"],
+		metadata: ["introspection_endpoint"],
+	},
+	device_authorization: {
+		paths: ["/device_authorization"],
+		metadata: ["device_authorization_endpoint"],
+	},
+	par: {
+		paths: ["/request"],
+		metadata: ["pushed_authorization_request_endpoint", "require_pushed_authorization_requests"],
+	},
+	end_session: {
+		paths: ["/session/end", "/session/end/confirm", "/session/end/success"],
+		metadata: ["end_session_endpoint"],
+	},
+};
+
+/**
+ * The names of the endpoints switched off by a set of flags
+ *
+ * Flags are keyed by endpoint name, optionally with a leading slash
+ * (`/userinfo`), or by a path the endpoint serves (`/me`). Unknown keys throw.
+ */
+export function disabledEndpoints(flags: Record<string, boolean>): Set<string> {
+	const disabled = new Set<string>();
+	for (const [key, enabled] of Object.entries(flags)) {
+		const name = endpointName(key);
+		if (name === undefined) {
+			const known = Object.keys(TOGGLEABLE_ENDPOINTS).join(", ");
+			throw new Error(`Unknown endpoint '${key}' (expected one of: ${known})`);
+		}
+		if (enabled) {
+			disabled.delete(name);
+		} else {
+			disabled.add(name);
+		}
+	}
+	return disabled;
+}
+
+/**
+ * The disabled endpoint serving `path`, if any
+ */
+export function disabledEndpointAt(path: string, disabled: ReadonlySet<string>): string | undefined {
+	for (const name of disabled) {
+		if (TOGGLEABLE_ENDPOINTS[name]?.paths.includes(path)) {
+			return name;
+		}
+	}
+	return undefined;
+}
+
+/**
+ * A discovery document without the members advertising disabled endpoints
+ */
+export function withoutDisabledEndpoints(
+	metadata: Record<string, unknown>,
+	disabled: ReadonlySet<string>,
+): Record<string, unknown> {
+	const result = { ...metadata };
+	for (const name of disabled) {
+		for (const member of TOGGLEABLE_ENDPOINTS[name]?.metadata ?? []) {
+			delete result[member];
+		}
+	}
+	return result;
+}
+
+function endpointName(key: string): string | undefined {
+	const bare = key.startsWith("/") ? key.slice(1) : key;
+	if (TOGGLEABLE_ENDPOINTS[bare]) {
+		return bare;
+	}
+	return Object.keys(TOGGLEABLE_ENDPOINTS).find((name) =>
+		TOGGLEABLE_ENDPOINTS[name]?.paths.includes(key),
+	);
+}
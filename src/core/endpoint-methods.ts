@@ -0,0 +1,44 @@
+/**
+ * Endpoint Methods - HEAD and OPTIONS on the OIDC endpoints
+ *
+ * Some clients and caches probe the discovery document, the JWKS and the
+ * token endpoint with HEAD or OPTIONS before (or instead of) fetching them.
+ * Loki answers HEAD with exactly the headers GET would send - Content-Length
+ * included - and OPTIONS with the allowed methods and CORS preflight headers.
+ */
+
+const METADATA_METHODS = ["GET", "HEAD", "OPTIONS"];
+
+/** Methods each probed endpoint supports, keyed by path */
+export const ENDPOINT_METHODS: Record<string, string[]> = {
+	"/.well-known/openid-configuration": METADATA_METHODS,
+	"/.well-known/oauth-authorization-server": METADATA_METHODS,
+	"/jwks": METADATA_METHODS,
+	"/.well-known/jwks.json": METADATA_METHODS,
+	"/token": ["POST", "OPTIONS"],
+};
+
+/**
+ * Headers for an OPTIONS response
+ *
+ * Preflight requests get the CORS headers; any Access-Control-Request-Headers
+ * are echoed back so clients can send Authorization and X-Loki-Session.
+ */
+export function optionsHeaders(
+	methods: string[],
+	requestHeaders: Record<string, string | string[] | undefined>,
+): Record<string, string> {
+	const allow = methods.join(", ");
+	const headers: Record<string, string> = { Allow: allow };
+	if (requestHeaders.origin !== undefined) {
+		const requested = requestHeaders["access-control-request-headers"];
+		headers["Access-Control-Allow-Origin"] = "*";
+		headers["Access-Control-Allow-Methods"] = allow;
+		headers["Access-Control-Allow-Headers"] =
+			typeof requested === "string" && requested.length > 0
+				? requested
+				: "Authorization, Content-Type, X-Loki-Session";
+		headers["Access-Control-Max-Age"] = "600";
+	}
+	return headers;
+}
@@ -0,0 +1,146 @@
+/**
+ * Errors - the stable codes Loki rejects requests with
+ *
+ * Every rejection Loki makes itself (the admin API, and the checks it runs
+ * in front of the OIDC endpoints) answers with a JSON body carrying a
+ * machine-readable `code`, a human-readable `message` and `details`
+ * (structured context; `{}` when there is none). Harnesses branch on the
+ * code instead of matching message text, which may change.
+ *
+ * `error` stays alongside for existing clients: on the admin API it repeats
+ * the message; at the OIDC endpoints it is the OAuth error code, with the
+ * message as `error_description` (RFC 6749 Section 5.2). Rejections made by
+ * oidc-provider itself carry only the OAuth members.
+ *
+ * The code list is append-only: codes are never renamed, reused or removed.
+ */
+
+import type { ServerResponse } from "node:http";
+
+/** Every code, with what it means */
+export const ERROR_CODES = {
+	// Admin API
+	admin_token_required: "The admin token is missing or wrong",
+	invalid_json: "The request body is not valid JSON",
+	invalid_parameter: "A query parameter or body member is invalid",
+	invalid_session_spec: "A session spec is invalid; nothing was created",
+	invalid_batch: "A batch body is not an array of session specs or {sessions: [...]}",
+	oversized_request: "The request asks for more than Loki accepts at once",
+	session_not_found: "No session has that ID",
+	session_not_frozen: "The session doesn't exist or isn't frozen",
+	key_export_forbidden: "Signing key export requires an admin token",
+	unknown_token: "No token with that jti was issued in the session",
+	unknown_mischief: "No mischief plugin has that ID",
+	invalid_rollover_plan: "The rollover plan is invalid",
+	rollover_plan_not_found: "No rollover plan is configured",
+	invalid_key_set: "The key set, or the key to retire, is invalid",
+	key_set_not_found: "No key set is configured",
+	invalid_fault_config: "The fault configuration is invalid",
+	invalid_topology: "The topology document is invalid; nothing was applied",
+	request_not_found: "Nothing was recorded for that request ID",
+	attack_of_the_day_disabled: "Attack of the day is not enabled",
+	chaos_disabled: "Chaos mode is not enabled",
+	internal_error: "Loki failed while serving the request",
+	rogue_jwks_not_found: "No rogue keys were served for that session",
+	invalid_signing_key: "The signing key registration or rotation is invalid",
+	signing_key_not_found: "No signing key is registered under that id",
+	no_token_issued: "The session hasn't issued a token yet",
+	client_not_found: "No client is configured or registered with that client_id",
+	invalid_client_keys: "The client key registration is invalid",
+	invalid_client_registration: "The client registration is invalid",
+	client_not_deletable: "Configured clients can't be deleted",
+	rogue_x5u_not_found: "No rogue certificate chain was served for that session",
+	session_expired: "The session outlived its ttl and was evicted",
+	invalid_tenant: "The tenant id is invalid, reserved or already registered",
+	tenant_not_found: "No tenant has that id",
+
+	// OIDC endpoints
+	endpoint_disabled: "The endpoint is switched off by config",
+	overloaded: "Too many requests are in flight; retry later",
+	injected_fault: "An error-rate fault failed the request on purpose",
+	method_not_allowed: "The endpoint doesn't support the method",
+	public_client_secret: "A public client presented a client secret",
+	public_client_credentials: "A public client asked for the client_credentials grant",
+	dpop_nonce_required: "The DPoP proof must carry the server-provided nonce",
+	request_object_replayed: "The request object's jti was already used",
+	invalid_authorization_details: "authorization_details is malformed",
+	invalid_access_token: "The access token is missing, invalid or expired",
+	jwks_auth_required: "The JWKS requires a bearer token",
+	claim_source_not_found: "No distributed claim source has that ID",
+	device_code_expired: "The device code is past its lifetime",
+	device_authorization_pending: "Mischief kept the device authorization pending",
+	authorization_code_session_mismatch: "The authorization code was issued to another session",
+	pkce_verification_failed: "The code_verifier doesn't match the code_challenge",
+	client_authentication_failed: "The client is unknown or its credentials are wrong",
+	token_missing: "The request has no token parameter",
+	client_assertion_invalid: "The client assertion is malformed, expired or signed with another key",
+	rate_limited: "The session's maxTokensPerSecond is spent; retry later",
+	injected_token_error: "Mischief answered the token request with an error",
+	invalid_resource: "A resource indicator isn't an absolute URI without a fragment",
+	not_ready: "Loki is still starting: its signing keys or session store aren't ready",
+	grant_not_registered: "The client isn't registered for the grant type it asked for",
+	invalid_token_exchange: "The token exchange request lacks a subject token or names a bad type",
+	subject_token_invalid: "The subject or actor token isn't Loki's, or is expired or revoked",
+	actor_not_permitted: "The subject token's may_act names another actor",
+	dpop_proof_invalid: "The DPoP proof is malformed, mis-signed, stale, replayed or for another URL",
+	invalid_claims_request: "The claims request parameter isn't a JSON object of claim requests",
+	source_not_allowed: "The request's source address isn't in the allowlist",
+} as const;
+
+export type LokiErrorCode = keyof typeof ERROR_CODES;
+
+/**
+ * The body of a rejection
+ */
+export interface LokiErrorBody {
+	/** The message (admin API) or the OAuth error code (OIDC endpoints) */
+	error: string;
+	/** RFC 6749 error description (OIDC endpoints only) */
+	error_description?: string;
+	code: LokiErrorCode;
+	message: string;
+	details: Record<string, unknown>;
+}
+
+/**
+ * An admin API rejection
+ */
+export function lokiError(
+	code: LokiErrorCode,
+	message: string,
+	details: Record<string, unknown> = {},
+): LokiErrorBody {
+	return { error: message, code, message, details };
+}
+
+/**
+ * A rejection at an OIDC endpoint: the OAuth error members plus the Loki code
+ */
+export function oauthError(
+	error: string,
+	code: LokiErrorCode,
+	message: string,
+	details: Record<string, unknown> = {},
+): LokiErrorBody {
+	return { error, error_description: message, code, message, details };
+}
+
+/**
+ * Answer with a rejection body
+ */
+export function sendError(
+	res: ServerResponse,
+	status: number,
+	body: LokiErrorBody,
+	headers: Record<string, string> = {},
+): void {
+	res.writeHead(status, { "Content-Type": "application/json", ...headers });
+	res.end(JSON.stringify(body));
+}
+
+/**
+ * Answer 500 for a failure while serving a request
+ */
+export function sendInternalError(res: ServerResponse, err: unknown): void {
+	sendError(res, 500, lokiError("internal_error", "Internal server error", { cause: String(err) }));
+}
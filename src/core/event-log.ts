@@ -0,0 +1,196 @@
+/**
+ * Event Log - per-session timeline of notable transitions
+ *
+ * The ledger records each act of mischief; the event log records what
+ * happened around it (warm-up ending, state changes) so a test run can be
+ * reconstructed in order.
+ *
+ * Each session's events are numbered from 1 (`seq`), so a consumer can
+ * resume after the last event it saw. Long soak runs rotate: beyond
+ * `maxEventsPerSession` the oldest events are dropped, and the gap shows
+ * as a jump in `seq`.
+ */
+
+import { randomId } from "./random.js";
+import { activeRequestId } from "./request-id.js";
+
+export type SessionEventType =
+	| "warmup-complete"
+	| "claim-source-resolved"
+	| "userinfo-served"
+	| "token-frozen"
+	| "interaction-rendered"
+	| "pkce-challenge"
+	| "request-object-replayed"
+	| "authorization-details-requested"
+	| "claims-requested"
+	| "max-age-requested"
+	| "response-mode-requested"
+	| "redirect-uri-mismatch"
+	| "auth-time-issued"
+	| "dpop-nonce-exchanged"
+	| "client-auth-checked"
+	| "client-assertion-checked"
+	| "attack-rotated"
+	| "chaos-drawn"
+	| "signing-keys-exported"
+	| "token-reported"
+	| "condition-evaluated"
+	| "jwks-served"
+	| "rogue-jwks-fetched"
+	| "rogue-x5u-fetched"
+	| "device-code-polled"
+	| "pkce-verified"
+	| "token-introspected"
+	| "token-revoked"
+	| "token-content-type"
+	| "webhook-delivered";
+
+export interface SessionEvent {
+	id: string;
+	sessionId: string;
+	type: SessionEventType;
+	timestamp: string;
+	/** Position in the session's timeline, from 1; a cursor for `since` */
+	seq: number;
+	/** Correlation ID of the request that produced the event */
+	requestId?: string;
+	data: Record<string, unknown>;
+}
+
+export interface EventLogOptions {
+	/** Optional callback for persisting events */
+	onEvent?: (event: SessionEvent) => void;
+	/** Events kept per session before the oldest are dropped (default: 0 = unlimited) */
+	maxEventsPerSession?: number;
+	/** Called with the last seq dropped when a session's events rotate */
+	onRotate?: (sessionId: string, throughSeq: number) => void;
+}
+
+export class EventLog {
+	private readonly events = new Map<string, SessionEvent[]>(); // sessionId -> events
+	private readonly lastSeq = new Map<string, number>(); // sessionId -> last seq issued
+	private readonly onEvent?: (event: SessionEvent) => void;
+	private readonly onRotate?: (sessionId: string, throughSeq: number) => void;
+	private readonly maxEventsPerSession: number;
+
+	constructor(options?: EventLogOptions) {
+		if (options?.onEvent) {
+			this.onEvent = options.onEvent;
+		}
+		if (options?.onRotate) {
+			this.onRotate = options.onRotate;
+		}
+		const max = options?.maxEventsPerSession ?? 0;
+		if (!Number.isInteger(max) || max < 0) {
+			throw new Error(`maxEventsPerSession must be a non-negative integer, got ${max}`);
+		}
+		this.maxEventsPerSession = max;
+	}
+
+	/**
+	 * Record an event for a session
+	 */
+	record(
+		sessionId: string,
+		type: SessionEventType,
+		data: Record<string, unknown> = {},
+	): SessionEvent {
+		const seq = (this.lastSeq.get(sessionId) ?? 0) + 1;
+		this.lastSeq.set(sessionId, seq);
+		const event: SessionEvent = {
+			id: `evt_${randomId(8)}`,
+			sessionId,
+			type,
+			timestamp: new Date().toISOString(),
+			seq,
+			data,
+		};
+		const requestId = activeRequestId();
+		if (requestId !== undefined) {
+			event.requestId = requestId;
+		}
+
+		const events = this.events.get(sessionId) ?? [];
+		events.push(event);
+		this.events.set(sessionId, events);
+
+		if (this.onEvent) {
+			this.onEvent(event);
+		}
+		this.rotate(sessionId, events);
+
+		return event;
+	}
+
+	/**
+	 * Restore previously persisted events without re-emitting them
+	 */
+	restore(events: SessionEvent[]): void {
+		for (const event of events) {
+			const existing = this.events.get(event.sessionId) ?? [];
+			existing.push(event);
+			this.events.set(event.sessionId, existing);
+			this.lastSeq.set(event.sessionId, event.seq);
+		}
+		for (const [sessionId, existing] of this.events) {
+			this.rotate(sessionId, existing);
+		}
+	}
+
+	/**
+	 * Get events for a session, oldest first; only those after `since` if given
+	 *
+	 * The list is a copy, so callers can iterate it while events are still
+	 * recorded and rotated out.
+	 */
+	list(sessionId: string, since?: number): SessionEvent[] {
+		const events = this.events.get(sessionId) ?? [];
+		if (since === undefined) {
+			return [...events];
+		}
+		return events.filter((event) => event.seq > since);
+	}
+
+	/**
+	 * Get every session's events produced by one request
+	 */
+	findByRequest(requestId: string): SessionEvent[] {
+		const found: SessionEvent[] = [];
+		for (const events of this.events.values()) {
+			found.push(...events.filter((event) => event.requestId === requestId));
+		}
+		return found;
+	}
+
+	/**
+	 * Drop events for a session
+	 */
+	clear(sessionId: string): void {
+		this.events.delete(sessionId);
+		this.lastSeq.delete(sessionId);
+	}
+
+	/**
+	 * Drop all events
+	 */
+	clearAll(): void {
+		this.events.clear();
+		this.lastSeq.clear();
+	}
+
+	/**
+	 * Drop a session's oldest events beyond the retention limit
+	 */
+	private rotate(sessionId: string, events: SessionEvent[]): void {
+		const excess = events.length - this.maxEventsPerSession;
+		if (this.maxEventsPerSession === 0 || excess <= 0) {
+			return;
+		}
+		const dropped = events.splice(0, excess);
+		const last = dropped.at(-1);
+		if (last && this.onRotate) {
+			this.onRotate(sessionId, last.seq);
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/**
+ * Fault Injector - global, session-independent error injection
+ *
+ * Fails a configurable fraction of requests to chosen endpoints with a 5xx,
+ * regardless of which session (if any) the request belongs to. Useful in a
+ * shared environment for exercising client retry and caching behaviour.
+ *
+ * JWKS endpoints only start failing after they've served at least one good
+ * response, so every client has had a chance to cache keys — the point is
+ * to see whether they fall back to them.
+ */
+
+import { random } from "./random.js";
+import type { FaultConfig } from "./types.js";
+
+export interface InjectedFault {
+	endpoint: string;
+	status: number;
+	timestamp: string;
+}
+
+export interface FaultStatus {
+	errorRates: Record<string, number>;
+	statuses: number[];
+	injected: Record<string, number>;
+	recent: InjectedFault[];
+}
+
+export interface FaultInjectorOptions {
+	/** Random source override (for tests) */
+	random?: () => number;
+	/** Called for every injected fault */
+	onFault?: (fault: InjectedFault) => void;
+}
+
+/** Upper bound on recorded recent faults */
+const MAX_RECENT = 100;
+
+const JWKS_PATHS = new Set(["/jwks", "/.well-known/jwks.json"]);
+
+/**
+ * Validate a fault config, throwing a descriptive error if it's invalid
+ */
+export function validateFaultConfig(config: FaultConfig): void {
+	if (typeof config?.errorRates !== "object" || config.errorRates === null) {
+		throw new Error("errorRates must be an object mapping endpoint paths to rates");
+	}
+	for (const [endpoint, rate] of Object.entries(config.errorRates)) {
+		if (!endpoint.startsWith("/")) {
+			throw new Error(`Endpoint '${endpoint}' must be a path starting with '/'`);
+		}
+		if (typeof rate !== "number" || !(rate >= 0 && rate <= 1)) {
+			throw new Error(`Error rate for '${endpoint}' must be a number between 0 and 1`);
+		}
+	}
+	for (const status of config.statuses ?? []) {
+		if (!Number.isInteger(status) || status < 500 || status > 599) {
+			throw new Error(`Status ${String(status)} is not a 5xx status code`);
+		}
+	}
+}
+
+export class FaultInjector {
+	private config: FaultConfig;
+	private readonly random: () => number;
+	private readonly onFault?: (fault: InjectedFault) => void;
+	private readonly injected = new Map<string, number>(); // endpoint -> count
+	private readonly recent: InjectedFault[] = [];
+	private readonly servedJwks = new Set<string>();
+
+	constructor(config: FaultConfig, options?: FaultInjectorOptions) {
+		validateFaultConfig(config);
+		this.config = config;
+		this.random = options?.random ?? random;
+		if (options?.onFault) {
+			this.onFault = options.onFault;
+		}
+	}
+
+	/**
+	 * Replace the rates and statuses (counters are kept)
+	 */
+	configure(config: FaultConfig): FaultStatus {
+		validateFaultConfig(config);
+		this.config = config;
+		return this.getStatus();
+	}
+
+	/**
+	 * Decide whether to fail a request, returning the status to send if so
+	 */
+	check(url: string): number | undefined {
+		const endpoint = url.split("?")[0] ?? url;
+		const rate = this.config.errorRates[endpoint];
+		if (rate === undefined || rate <= 0) {
+			return undefined;
+		}
+
+		// Let clients cache keys before JWKS starts failing
+		if (JWKS_PATHS.has(endpoint) && !this.servedJwks.has(endpoint)) {
+			this.servedJwks.add(endpoint);
+			return undefined;
+		}
+
+		if (this.random() >= rate) {
+			return undefined;
+		}
+
+		const statuses = this.config.statuses?.length ? this.config.statuses : [503];
+		const status = statuses[Math.floor(this.random() * statuses.length)] ?? 503;
+		const fault: InjectedFault = { endpoint, status, timestamp: new Date().toISOString() };
+
+		this.injected.set(endpoint, (this.injected.get(endpoint) ?? 0) + 1);
+		this.recent.push(fault);
+		if (this.recent.length > MAX_RECENT) {
+			this.recent.shift();
+		}
+		if (this.onFault) {
+			this.onFault(fault);
+		}
+
+		return status;
+	}
+
+	/**
+	 * Current configuration and injected fault counts
+	 */
+	getStatus(): FaultStatus {
+		return {
+			errorRates: { ...this.config.errorRates },
+			statuses: this.config.statuses?.length ? [...this.config.statuses] : [503],
+			injected: Object.fromEntries(this.injected),
+			recent: [...this.recent],
+		};
+	}
+}
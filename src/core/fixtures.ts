@@ -0,0 +1,310 @@
+/**
+ * Fixtures - attack tokens written to disk for offline tests
+ *
+ * Unit tests that can't reach a running Loki can check static tokens
+ * instead. Each fixture is a baseline token run through one mischief plugin
+ * by the same MischiefEngine that serves `/token`, signed with a key kept
+ * in the fixture directory. A manifest maps every token file to its
+ * decoded header and claims and to the reason a client must reject it; the
+ * baseline token is the one it must accept.
+ *
+ * Generation is deterministic: the clock is pinned to `issuedAt` and
+ * Loki's random choices (see random.ts), and Math.random for custom
+ * plugins, are seeded from `seed` and the plugin id, so regenerating with
+ * the same config and key rewrites identical files. Plugins that generate
+ * keys through jose, or sign with ECDSA or RSA-PSS, still differ from run
+ * to run. Don't generate fixtures in a process that is serving requests.
+ */
+
+import { type KeyObject, createHash, createPublicKey } from "node:crypto";
+import { existsSync, mkdirSync, readFileSync, readdirSync, rmSync, writeFileSync } from "node:fs";
+import { join } from "node:path";
+import * as jose from "jose";
+import type { PluginRegistry } from "../plugins/registry.js";
+import type { PluginConfig, SpecReference } from "../plugins/types.js";
+import { type ManagedKey, type SigningAlgorithm, generateSigningKey } from "./key-manager.js";
+import { MischiefEngine } from "./mischief-engine.js";
+import { random, seedRandom } from "./random.js";
+import type { Session, Severity } from "./types.js";
+
+const DEFAULT_ISSUER = "http://localhost:3000";
+const DEFAULT_AUDIENCE = "test-client";
+const DEFAULT_SEED = "oidc-loki";
+/** 2025-01-01T00:00:00Z */
+const DEFAULT_ISSUED_AT = 1735689600;
+/** Long enough that checked-in fixtures never expire */
+const DEFAULT_EXPIRES_IN = 100 * 365 * 24 * 60 * 60;
+
+const KEY_FILE = "signing-key.json";
+const JWKS_FILE = "jwks.json";
+const MANIFEST_FILE = "manifest.json";
+const BASELINE_FILE = "baseline.jwt";
+
+export interface FixtureConfig {
+	/** The `sub` of every token */
+	subject: string;
+	/** Plugins to forge a token with, one each (default: every token plugin) */
+	mischief?: string[];
+	/** Per-plugin config, as on a session */
+	pluginConfig?: Record<string, PluginConfig>;
+	issuer?: string;
+	audience?: string;
+	/** Extra claims for the baseline token */
+	claims?: Record<string, unknown>;
+	/** Seed for jti values and plugin randomness */
+	seed?: string;
+	/** Token issue time, in epoch seconds */
+	issuedAt?: number;
+	/** Token lifetime, in seconds */
+	expiresIn?: number;
+}
+
+export interface FixtureEntry {
+	/** Token file, relative to the fixture directory */
+	file: string;
+	/** Plugin that forged the token; null for the baseline */
+	mischief: string | null;
+	expect: "accept" | "reject";
+	/** Why a client must reject the token (or that it's valid) */
+	reason: string;
+	severity?: Severity;
+	spec?: SpecReference;
+	/** What the plugin changed */
+	mutation?: string;
+	header: Record<string, unknown>;
+	claims: Record<string, unknown>;
+}
+
+export interface FixtureManifest {
+	seed: string;
+	issuer: string;
+	audience: string;
+	subject: string;
+	issuedAt: number;
+	expiresAt: number;
+	/** Public keys the tokens are signed with, relative to the fixture directory */
+	jwks: string;
+	fixtures: FixtureEntry[];
+	/** Requested plugins that produced no token */
+	skipped: { mischief: string; reason: string }[];
+}
+
+export interface FixtureSet {
+	manifest: FixtureManifest;
+	/** Raw tokens by file name */
+	tokens: Record<string, string>;
+}
+
+/**
+ * Forge a baseline token and one token per plugin, signed with `key`
+ */
+export async function generateFixtures(
+	config: FixtureConfig,
+	registry: PluginRegistry,
+	key: ManagedKey,
+): Promise<FixtureSet> {
+	const seed = config.seed ?? DEFAULT_SEED;
+	const issuer = config.issuer ?? DEFAULT_ISSUER;
+	const audience = config.audience ?? DEFAULT_AUDIENCE;
+	const issuedAt = config.issuedAt ?? DEFAULT_ISSUED_AT;
+	const expiresAt = issuedAt + (config.expiresIn ?? DEFAULT_EXPIRES_IN);
+
+	const ids =
+		config.mischief ??
+		registry
+			.getAll()
+			.filter((plugin) => plugin.phase === "token-signing" || plugin.phase === "token-claims")
+			.map((plugin) => plugin.id);
+	const unknown = ids.find((id) => !registry.has(id));
+	if (unknown !== undefined) {
+		throw new Error(`Unknown plugin '${unknown}'`);
+	}
+
+	const baseline = await new jose.SignJWT({
+		iss: issuer,
+		sub: config.subject,
+		aud: audience,
+		iat: issuedAt,
+		nbf: issuedAt,
+		exp: expiresAt,
+		jti: seededId(`${seed}:jti`),
+		...config.claims,
+	})
+		.setProtectedHeader({ alg: key.alg, typ: "JWT", kid: key.kid })
+		.sign(key.privateKey);
+
+	const manifest: FixtureManifest = {
+		seed,
+		issuer,
+		audience,
+		subject: config.subject,
+		issuedAt,
+		expiresAt,
+		jwks: JWKS_FILE,
+		fixtures: [
+			{
+				file: BASELINE_FILE,
+				mischief: null,
+				expect: "accept",
+				reason: "Valid token signed with a key in the JWKS",
+				...decodeToken(baseline),
+			},
+		],
+		skipped: [],
+	};
+	const tokens: Record<string, string> = { [BASELINE_FILE]: baseline };
+
+	const engine = new MischiefEngine({
+		pluginRegistry: registry,
+		getPublicKey: () => jose.exportSPKI(key.publicKey),
+		getSigningKey: () => key,
+	});
+	const timestamp = new Date(issuedAt * 1000);
+
+	for (const id of ids) {
+		const plugin = registry.get(id);
+		if (!plugin) {
+			continue;
+		}
+		if (plugin.phase !== "token-signing" && plugin.phase !== "token-claims") {
+			manifest.skipped.push({ mischief: id, reason: `A ${plugin.phase} plugin forges no tokens` });
+			continue;
+		}
+
+		const session: Session = {
+			id: `fixtures-${id}`,
+			mode: "explicit",
+			mischief: [id],
+			startedAt: timestamp,
+		};
+		const pluginConfig = config.pluginConfig?.[id];
+		if (pluginConfig) {
+			session.pluginConfig = { [id]: pluginConfig };
+		}
+		const { token, applications } = await deterministic(`${seed}:${id}`, issuedAt * 1000, () =>
+			engine.applyToToken(baseline, {
+				requestId: `fixture_${id}`,
+				session,
+				endpoint: "/token",
+				method: "POST",
+				timestamp,
+			}),
+		);
+
+		const application = applications[0];
+		if (!application) {
+			manifest.skipped.push({ mischief: id, reason: "Did not apply to the baseline token" });
+			continue;
+		}
+		const file = `${id}.jwt`;
+		tokens[file] = token;
+		manifest.fixtures.push({
+			file,
+			mischief: id,
+			expect: "reject",
+			reason: plugin.spec.description,
+			severity: plugin.severity,
+			spec: plugin.spec,
+			mutation: application.result.mutation,
+			...decodeToken(token),
+		});
+	}
+
+	return { manifest, tokens };
+}
+
+/**
+ * Generate fixtures into a directory, reusing its signing key if it has one
+ *
+ * Token files from an earlier run are replaced, so fixtures for plugins no
+ * longer requested disappear.
+ */
+export async function writeFixtures(
+	dir: string,
+	config: FixtureConfig,
+	registry: PluginRegistry,
+): Promise<FixtureManifest> {
+	mkdirSync(dir, { recursive: true });
+	const key = await loadFixtureKey(join(dir, KEY_FILE));
+	const { manifest, tokens } = await generateFixtures(config, registry, key);
+
+	for (const file of readdirSync(dir)) {
+		if (file.endsWith(".jwt")) {
+			rmSync(join(dir, file));
+		}
+	}
+	for (const [file, token] of Object.entries(tokens)) {
+		writeFileSync(join(dir, file), `${token}\n`);
+	}
+	writeJson(join(dir, JWKS_FILE), { keys: [key.publicJwk] });
+	writeJson(join(dir, MANIFEST_FILE), manifest);
+	return manifest;
+}
+
+/**
+ * Load the fixture signing key, generating and saving an RS256 key if there is none
+ */
+async function loadFixtureKey(path: string): Promise<ManagedKey> {
+	if (!existsSync(path)) {
+		const key = await generateSigningKey("RS256");
+		writeJson(path, key.privateJwk);
+		return key;
+	}
+
+	const privateJwk = JSON.parse(readFileSync(path, "utf8")) as jose.JWK;
+	const alg = (privateJwk.alg ?? "RS256") as SigningAlgorithm;
+	const privateKey = (await jose.importJWK(privateJwk, alg)) as KeyObject;
+	const publicKey = createPublicKey(privateKey);
+
+	const publicJwk = await jose.exportJWK(publicKey);
+	const kid = privateJwk.kid ?? (await jose.calculateJwkThumbprint(publicJwk));
+	Object.assign(publicJwk, { kid, alg, use: "sig" });
+
+	return { kid, alg, privateKey, publicKey, publicJwk, privateJwk, createdAt: new Date() };
+}
+
+/**
+ * Run `fn` with a pinned clock and seeded random choices
+ */
+async function deterministic<T>(seed: string, nowMs: number, fn: () => Promise<T>): Promise<T> {
+	const mathRandom = Math.random;
+	const now = Date.now;
+	const restore = seedRandom(seed);
+	Math.random = random;
+	Date.now = () => nowMs;
+	try {
+		return await fn();
+	} finally {
+		restore();
+		Math.random = mathRandom;
+		Date.now = now;
+	}
+}
+
+function seededId(seed: string): string {
+	return createHash("sha256").update(seed).digest("base64url").slice(0, 22);
+}
+
+/**
+ * Decode a token's header and claims for the manifest; segments that
+ * aren't JSON objects decode to {}
+ */
+function decodeToken(token: string): Pick<FixtureEntry, "header" | "claims"> {
+	const [header = "", claims = ""] = token.split(".");
+	return { header: decodeSegment(header), claims: decodeSegment(claims) };
+}
+
+function decodeSegment(segment: string): Record<string, unknown> {
+	try {
+		const value: unknown = JSON.parse(Buffer.from(segment, "base64url").toString("utf8"));
+		return typeof value === "object" && value !== null && !Array.isArray(value)
+			? (value as Record<string, unknown>)
+			: {};
+	} catch {
+		return {};
+	}
+}
+
+function writeJson(path: string, value: unknown): void {
+	writeFileSync(path, `${JSON.stringify(value, null, 2)}\n`);
+}
@@ -0,0 +1,136 @@
+/**
+ * Fuzz - random mischief combinations for a broad test matrix
+ *
+ * POST /admin/fuzz creates `count` explicit sessions, each with a random
+ * combination of one to `maxMischief` distinct plugins from the catalog
+ * (narrowed to `include`, less `exclude`). The combinations are drawn from
+ * a generator keyed by the request's `seed`, or by one Loki picks and
+ * reports, so sending the reported seed back reproduces the matrix. With a
+ * global seed (`--seed`) the picked seeds repeat too: a fresh Loki sent the
+ * same requests generates the same matrices.
+ */
+
+import { MAX_SEED, randomSeed } from "./probabilistic-draw.js";
+import { randomInt, seedRandom } from "./random.js";
+
+/** Most plugins combined in one session, unless the request says otherwise */
+export const DEFAULT_FUZZ_MISCHIEF = 3;
+
+/**
+ * A validated fuzz request
+ */
+export interface FuzzRequest {
+	count: number;
+	/** The plugins combinations are drawn from, in catalog order */
+	pool: string[];
+	maxMischief: number;
+	seed: number;
+}
+
+export type FuzzRequestResult =
+	| { ok: true; request: FuzzRequest }
+	| { ok: false; error: string; parameter: string; pluginIds?: string[] };
+
+/**
+ * What a fuzz request generated
+ */
+export interface FuzzSummary {
+	sessions: number;
+	/** Distinct combinations among the sessions */
+	combinations: number;
+	/** Sessions each plugin was drawn into */
+	plugins: Record<string, number>;
+}
+
+/**
+ * Validate a fuzz request body against the plugin catalog
+ */
+export function parseFuzzRequest(
+	body: Record<string, unknown>,
+	catalog: string[],
+	maxCount: number,
+): FuzzRequestResult {
+	const { count, include, exclude, maxMischief = DEFAULT_FUZZ_MISCHIEF, seed } = body;
+	if (typeof count !== "number" || !Number.isInteger(count) || count < 1 || count > maxCount) {
+		const error = `count must be an integer from 1 to ${maxCount}`;
+		return { ok: false, error, parameter: "count" };
+	}
+	for (const [parameter, ids] of [
+		["include", include],
+		["exclude", exclude],
+	] as const) {
+		if (ids === undefined) {
+			continue;
+		}
+		if (!Array.isArray(ids) || !ids.every((id) => typeof id === "string")) {
+			return { ok: false, error: `${parameter} must be an array of plugin IDs`, parameter };
+		}
+		const unknown = ids.filter((id: string) => !catalog.includes(id));
+		if (unknown.length > 0) {
+			return { ok: false, error: "Unknown mischief plugins", parameter, pluginIds: unknown };
+		}
+	}
+	if (typeof maxMischief !== "number" || !Number.isInteger(maxMischief) || maxMischief < 1) {
+		const error = "maxMischief must be a positive integer";
+		return { ok: false, error, parameter: "maxMischief" };
+	}
+	if (
+		seed !== undefined &&
+		(typeof seed !== "number" || !Number.isInteger(seed) || seed < 0 || seed > MAX_SEED)
+	) {
+		return { ok: false, error: `seed must be an integer from 0 to ${MAX_SEED}`, parameter: "seed" };
+	}
+
+	const included = (include as string[] | undefined) ?? catalog;
+	const excluded = (exclude as string[] | undefined) ?? [];
+	const pool = catalog.filter((id) => included.includes(id) && !excluded.includes(id));
+	if (pool.length === 0) {
+		const error = "include and exclude leave no plugins to combine";
+		return { ok: false, error, parameter: exclude === undefined ? "include" : "exclude" };
+	}
+	return {
+		ok: true,
+		request: { count, pool, maxMischief, seed: (seed as number | undefined) ?? randomSeed() },
+	};
+}
+
+/**
+ * Draw a combination for each session the request asks for; the same
+ * request always draws the same combinations
+ */
+export function fuzzCombinations(request: FuzzRequest): string[][] {
+	const { count, pool, seed } = request;
+	const maxMischief = Math.min(request.maxMischief, pool.length);
+	const restore = seedRandom(`fuzz:${seed}`);
+	try {
+		return Array.from({ length: count }, () => {
+			const remaining = [...pool];
+			const picked = new Set<string>();
+			const size = 1 + randomInt(maxMischief);
+			while (picked.size < size) {
+				const [id] = remaining.splice(randomInt(remaining.length), 1);
+				picked.add(id as string);
+			}
+			return pool.filter((id) => picked.has(id));
+		});
+	} finally {
+		restore();
+	}
+}
+
+/**
+ * Count the sessions, distinct combinations and each plugin's draws
+ */
+export function summarizeFuzz(combinations: string[][]): FuzzSummary {
+	const plugins: Record<string, number> = {};
+	for (const combination of combinations) {
+		for (const id of combination) {
+			plugins[id] = (plugins[id] ?? 0) + 1;
+		}
+	}
+	return {
+		sessions: combinations.length,
+		combinations: new Set(combinations.map((combination) => combination.join(","))).size,
+		plugins,
+	};
+}
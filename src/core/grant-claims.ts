@@ -0,0 +1,95 @@
+/**
+ * Grant Claims - which claims a token carries for the grant it was issued under
+ *
+ * A client_credentials token (RFC 6749 Section 4.4) is machine-to-machine:
+ * the client acts for itself, so the token's `sub` is the client's ID and
+ * it carries none of the claims that describe a user or the login that
+ * authenticated them (`nonce`, `at_hash`, `auth_time`, `acr`, profile
+ * claims, ...). Every other grant issues tokens for a user. Loki strips
+ * user-only claims from machine tokens before any mischief runs, so any
+ * that reach the client were put there by mischief; each issuance in the
+ * session report records its grant, profile and the claims its profile
+ * doesn't expect.
+ */
+
+/** Who a token is issued for: a client acting for itself, or a user */
+export type GrantProfile = "machine" | "user";
+
+/** Claims that only describe a user or a login (OIDC Core Sections 2, 3.3.2.11 and 5.1) */
+export const USER_ONLY_CLAIMS = [
+	"nonce",
+	"at_hash",
+	"c_hash",
+	"s_hash",
+	"auth_time",
+	"acr",
+	"amr",
+	"sid",
+	"name",
+	"given_name",
+	"family_name",
+	"middle_name",
+	"nickname",
+	"preferred_username",
+	"profile",
+	"picture",
+	"website",
+	"email",
+	"email_verified",
+	"gender",
+	"birthdate",
+	"zoneinfo",
+	"locale",
+	"phone_number",
+	"phone_number_verified",
+	"address",
+	"updated_at",
+];
+
+/** A token's grant, its profile, and the claims that profile doesn't expect */
+export interface GrantClaims {
+	/** The token request's grant_type */
+	grantType: string;
+	profile: GrantProfile;
+	/** Claims the token carries that its profile excludes; `sub` when it isn't the client's ID */
+	unexpected: string[];
+}
+
+/**
+ * The profile of the tokens a grant issues
+ */
+export function grantProfile(grantType: string | undefined): GrantProfile {
+	return grantType === "client_credentials" ? "machine" : "user";
+}
+
+/**
+ * Make a machine token's claims the client's own: `sub` is its client ID
+ * and user-only claims are dropped; returns the claims changed
+ */
+export function toMachineClaims(claims: Record<string, unknown>): string[] {
+	const changed = USER_ONLY_CLAIMS.filter((name) => name in claims);
+	for (const name of changed) {
+		delete claims[name];
+	}
+	const clientId = claims.client_id;
+	if (typeof clientId === "string" && claims.sub !== clientId) {
+		claims.sub = clientId;
+		changed.push("sub");
+	}
+	return changed;
+}
+
+/**
+ * Check a token's claims against the profile of the grant it was issued under
+ */
+export function grantClaims(grantType: string, claims: Record<string, unknown>): GrantClaims {
+	const profile = grantProfile(grantType);
+	const unexpected: string[] = [];
+	if (profile === "machine") {
+		unexpected.push(...USER_ONLY_CLAIMS.filter((name) => name in claims));
+		if (typeof claims.client_id === "string" && claims.sub !== claims.client_id) {
+			unexpected.push("sub");
+		}
+	}
+	return { grantType, profile, unexpected };
+}
@@ -0,0 +1,447 @@
+/**
+ * HAR Recorder - each session's HTTP exchanges, exportable as HAR 1.2
+ *
+ * Attaching a failing run to a security finding needs more than the token
+ * Loki issued: the request that got it, the response byte for byte, and
+ * what the client did with it next at introspection or userinfo. Every
+ * request that names a session with `X-Loki-Session` (or, for discovery
+ * and the JWKS, `loki_session`) is recorded under it, as is a request Loki
+ * binds to a session by the token or client it presents. Requests no
+ * session claims are not kept.
+ *
+ * Credentials are redacted before anything is stored: the value of each
+ * redacted header (an Authorization header keeps its scheme), and each
+ * redacted parameter in the query string, a form body or a JSON body,
+ * request and response alike. The configured names add to the defaults.
+ *
+ * Each session keeps its most recent exchanges, and each body its first
+ * `maxBodyBytes`; a truncated body says so in its `comment`.
+ */
+
+import { isUtf8 } from "node:buffer";
+import type { IncomingMessage, ServerResponse } from "node:http";
+import type { HarConfig } from "./types.js";
+
+/** Headers and parameters redacted whatever the configuration */
+export const DEFAULT_HAR_REDACTION = {
+	headers: ["authorization", "proxy-authorization", "cookie", "set-cookie"],
+	params: ["client_secret", "client_assertion", "password"],
+};
+
+export const REDACTED = "[REDACTED]";
+
+const DEFAULT_MAX_ENTRIES = 1000;
+const DEFAULT_MAX_BODY_BYTES = 64 * 1024;
+
+const CREATOR = { name: "oidc-loki", version: "0.1.0" };
+
+export interface HarNameValue {
+	name: string;
+	value: string;
+}
+
+export interface HarPostData {
+	mimeType: string;
+	text: string;
+	comment?: string;
+}
+
+export interface HarContent {
+	size: number;
+	mimeType: string;
+	text: string;
+	encoding?: "base64";
+	comment?: string;
+}
+
+export interface HarEntry {
+	startedDateTime: string;
+	time: number;
+	request: {
+		method: string;
+		url: string;
+		httpVersion: string;
+		cookies: HarNameValue[];
+		headers: HarNameValue[];
+		queryString: HarNameValue[];
+		postData?: HarPostData;
+		headersSize: number;
+		bodySize: number;
+	};
+	response: {
+		status: number;
+		statusText: string;
+		httpVersion: string;
+		cookies: HarNameValue[];
+		headers: HarNameValue[];
+		content: HarContent;
+		redirectURL: string;
+		headersSize: number;
+		bodySize: number;
+	};
+	cache: Record<string, never>;
+	timings: { send: number; wait: number; receive: number };
+	/** The exchange's correlation ID, as in Loki's logs and reports */
+	_requestId: string;
+}
+
+export interface Har {
+	log: {
+		version: "1.2";
+		creator: { name: string; version: string };
+		entries: HarEntry[];
+	};
+}
+
+/**
+ * The first bytes of a body, and how many there were in all
+ */
+class BodyBuffer {
+	private readonly chunks: Buffer[] = [];
+	private kept = 0;
+	size = 0;
+
+	constructor(private readonly limit: number) {}
+
+	add(chunk: unknown, encoding?: BufferEncoding): void {
+		if (chunk === null || chunk === undefined || typeof chunk === "function") {
+			return;
+		}
+		const bytes =
+			typeof chunk === "string" ? Buffer.from(chunk, encoding) : Buffer.from(chunk as Uint8Array);
+		this.size += bytes.length;
+		if (this.kept < this.limit) {
+			const kept = bytes.subarray(0, this.limit - this.kept);
+			this.chunks.push(kept);
+			this.kept += kept.length;
+		}
+	}
+
+	get bytes(): Buffer {
+		return Buffer.concat(this.chunks);
+	}
+
+	get truncated(): boolean {
+		return this.size > this.kept;
+	}
+}
+
+interface Capture {
+	sessionId?: string;
+}
+
+/**
+ * HAR Recorder - records exchanges per session and exports them as HAR
+ */
+export class HarRecorder {
+	private readonly entries = new Map<string, HarEntry[]>();
+	private readonly captures = new WeakMap<ServerResponse, Capture>();
+	private readonly redactHeaders: Set<string>;
+	private readonly redactParams: Set<string>;
+	private readonly maxEntries: number;
+	private readonly maxBodyBytes: number;
+
+	/**
+	 * @param isSession - whether a session still exists when its exchange completes
+	 */
+	constructor(
+		config: HarConfig = {},
+		private readonly isSession: (id: string) => boolean = () => true,
+	) {
+		const headers = [...DEFAULT_HAR_REDACTION.headers, ...(config.redactHeaders ?? [])];
+		this.redactHeaders = new Set(headers.map((name) => name.toLowerCase()));
+		this.redactParams = new Set([...DEFAULT_HAR_REDACTION.params, ...(config.redactParams ?? [])]);
+		this.maxEntries = config.maxEntriesPerSession ?? DEFAULT_MAX_ENTRIES;
+		this.maxBodyBytes = config.maxBodyBytes ?? DEFAULT_MAX_BODY_BYTES;
+	}
+
+	/**
+	 * Record an exchange once its response is sent, under the session it
+	 * names or is later bound to
+	 */
+	capture(req: IncomingMessage, res: ServerResponse, requestId: string, sessionId?: string): void {
+		const capture: Capture = {};
+		if (sessionId !== undefined) {
+			capture.sessionId = sessionId;
+		}
+		this.captures.set(res, capture);
+
+		const startedAt = new Date();
+		const started = performance.now();
+		const url = req.url ?? "/";
+		const requestBody = new BodyBuffer(this.maxBodyBytes);
+		const responseBody = new BodyBuffer(this.maxBodyBytes);
+
+		// Tee the request body as it's read, and the response body as it's written
+		const push = req.push;
+		req.push = (chunk: unknown, encoding?: BufferEncoding) => {
+			requestBody.add(chunk, encoding);
+			return push.call(req, chunk, encoding);
+		};
+		const write = res.write;
+		const end = res.end;
+		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+		(res as any).write = (chunk: unknown, ...args: any[]) => {
+			responseBody.add(chunk, typeof args[0] === "string" ? (args[0] as BufferEncoding) : "utf8");
+			// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+			return (write as any).call(res, chunk, ...args);
+		};
+		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+		(res as any).end = (chunk?: unknown, ...args: any[]) => {
+			responseBody.add(chunk, typeof args[0] === "string" ? (args[0] as BufferEncoding) : "utf8");
+			// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+			return (end as any).call(res, chunk, ...args);
+		};
+
+		res.once("close", () => {
+			const { sessionId: id } = capture;
+			if (id === undefined || !this.isSession(id)) {
+				return;
+			}
+			const time = Math.round(performance.now() - started);
+			const entry = this.entry(req, res, url, requestBody, responseBody);
+			this.add(id, {
+				startedDateTime: startedAt.toISOString(),
+				time,
+				...entry,
+				cache: {},
+				timings: { send: 0, wait: time, receive: 0 },
+				_requestId: requestId,
+			});
+		});
+	}
+
+	/**
+	 * Record a captured exchange under a session, e.g. the one its token
+	 * was issued by
+	 */
+	bind(res: ServerResponse, sessionId: string): void {
+		const capture = this.captures.get(res);
+		if (capture) {
+			capture.sessionId = sessionId;
+		}
+	}
+
+	/**
+	 * A session's exchanges as a HAR log, oldest first
+	 */
+	har(sessionId: string): Har {
+		const entries = [...(this.entries.get(sessionId) ?? [])].sort((a, b) =>
+			a.startedDateTime.localeCompare(b.startedDateTime),
+		);
+		return { log: { version: "1.2", creator: { ...CREATOR }, entries } };
+	}
+
+	/**
+	 * Forget a session's exchanges
+	 */
+	clear(sessionId: string): void {
+		this.entries.delete(sessionId);
+	}
+
+	/**
+	 * Forget every session's exchanges
+	 */
+	clearAll(): void {
+		this.entries.clear();
+	}
+
+	private add(sessionId: string, entry: HarEntry): void {
+		let entries = this.entries.get(sessionId);
+		if (!entries) {
+			entries = [];
+			this.entries.set(sessionId, entries);
+		}
+		entries.push(entry);
+		if (entries.length > this.maxEntries) {
+			entries.splice(0, entries.length - this.maxEntries);
+		}
+	}
+
+	private entry(
+		req: IncomingMessage,
+		res: ServerResponse,
+		url: string,
+		requestBody: BodyBuffer,
+		responseBody: BodyBuffer,
+	): Pick<HarEntry, "request" | "response"> {
+		const httpVersion = `HTTP/${req.httpVersion}`;
+		const mark = url.indexOf("?");
+		const path = mark === -1 ? url : url.slice(0, mark);
+		const query = mark === -1 ? "" : url.slice(mark + 1);
+		const queryString = this.redactedParams(new URLSearchParams(query));
+		const search = new URLSearchParams(queryString.map(({ name, value }) => [name, value]));
+		const host = req.headers.host ?? "localhost";
+
+		const request: HarEntry["request"] = {
+			method: req.method ?? "GET",
+			url: `http://${host}${path}${queryString.length > 0 ? `?${search}` : ""}`,
+			httpVersion,
+			cookies: [],
+			headers: this.redactedHeaders(req.rawHeaders),
+			queryString,
+			headersSize: -1,
+			bodySize: requestBody.size,
+		};
+		if (requestBody.size > 0) {
+			const mimeType = req.headers["content-type"] ?? "application/octet-stream";
+			const postData: HarPostData = {
+				mimeType,
+				text: this.redactedBody(requestBody.bytes.toString("utf8"), mimeType),
+			};
+			if (requestBody.truncated) {
+				postData.comment = truncation(requestBody);
+			}
+			request.postData = postData;
+		}
+
+		const rawHeaders = sentHeaders(res);
+		const mimeType = headerValue(rawHeaders, "content-type") ?? "x-unknown";
+		const content: HarContent = { size: responseBody.size, mimeType, text: "" };
+		if (responseBody.size > 0) {
+			const bytes = responseBody.bytes;
+			if (isText(mimeType) || (mimeType === "x-unknown" && isUtf8(bytes))) {
+				content.text = this.redactedBody(bytes.toString("utf8"), mimeType);
+			} else {
+				content.text = bytes.toString("base64");
+				content.encoding = "base64";
+			}
+		}
+		if (responseBody.truncated) {
+			content.comment = truncation(responseBody);
+		}
+
+		return {
+			request,
+			response: {
+				status: res.statusCode,
+				statusText: res.statusMessage ?? "",
+				httpVersion,
+				cookies: [],
+				headers: this.redactedHeaders(rawHeaders),
+				content,
+				redirectURL: headerValue(rawHeaders, "location") ?? "",
+				headersSize: -1,
+				bodySize: responseBody.size,
+			},
+		};
+	}
+
+	/**
+	 * Headers from a flat name/value list, redacted values replaced
+	 */
+	private redactedHeaders(raw: string[]): HarNameValue[] {
+		const headers: HarNameValue[] = [];
+		for (let i = 0; i + 1 < raw.length; i += 2) {
+			const name = raw[i] as string;
+			let value = raw[i + 1] as string;
+			if (this.redactHeaders.has(name.toLowerCase())) {
+				const scheme = name.toLowerCase().endsWith("authorization") ? /^\S+ /.exec(value) : null;
+				value = `${scheme?.[0] ?? ""}${REDACTED}`;
+			}
+			headers.push({ name, value });
+		}
+		return headers;
+	}
+
+	private redactedParams(params: URLSearchParams): HarNameValue[] {
+		return [...params].map(([name, value]) => ({
+			name,
+			value: this.redactParams.has(name) ? REDACTED : value,
+		}));
+	}
+
+	/**
+	 * A form or JSON body with its redacted parameters replaced; other
+	 * bodies, and bodies with nothing to redact, are kept as they are.
+	 * Any body that parses as JSON counts, labelled or not
+	 */
+	private redactedBody(text: string, mimeType: string): string {
+		if (mimeType.startsWith("application/x-www-form-urlencoded")) {
+			const params = new URLSearchParams(text);
+			if (![...params.keys()].some((name) => this.redactParams.has(name))) {
+				return text;
+			}
+			const redacted = this.redactedParams(params).map(({ name, value }) => [name, value]);
+			return new URLSearchParams(redacted).toString();
+		}
+		try {
+			const parsed: unknown = JSON.parse(text);
+			const redacted = this.redactedJson(parsed);
+			return redacted.changed ? JSON.stringify(redacted.value) : text;
+		} catch {
+			return text;
+		}
+	}
+
+	private redactedJson(value: unknown): { value: unknown; changed: boolean } {
+		if (Array.isArray(value)) {
+			const items = value.map((item) => this.redactedJson(item));
+			return {
+				value: items.map((item) => item.value),
+				changed: items.some((item) => item.changed),
+			};
+		}
+		if (!value || typeof value !== "object") {
+			return { value, changed: false };
+		}
+		const members: Record<string, unknown> = {};
+		let changed = false;
+		for (const [name, member] of Object.entries(value)) {
+			if (this.redactParams.has(name)) {
+				members[name] = REDACTED;
+				changed = true;
+				continue;
+			}
+			const redacted = this.redactedJson(member);
+			members[name] = redacted.value;
+			changed = changed || redacted.changed;
+		}
+		return { value: members, changed };
+	}
+}
+
+/**
+ * A response's headers as a flat name/value list, read from the header
+ * block it sent: handlers that write headers straight through writeHead
+ * leave them out of getHeaders()
+ */
+function sentHeaders(res: ServerResponse): string[] {
+	const block = (res as unknown as { _header?: unknown })._header;
+	const raw: string[] = [];
+	if (typeof block !== "string") {
+		for (const [name, value] of Object.entries(res.getHeaders())) {
+			for (const item of Array.isArray(value) ? value : [value]) {
+				raw.push(name, String(item));
+			}
+		}
+		return raw;
+	}
+	for (const line of block.split("\r\n").slice(1)) {
+		const colon = line.indexOf(":");
+		if (colon > 0) {
+			raw.push(line.slice(0, colon), line.slice(colon + 1).trim());
+		}
+	}
+	return raw;
+}
+
+function headerValue(raw: string[], name: string): string | undefined {
+	for (let i = 0; i + 1 < raw.length; i += 2) {
+		if (raw[i]?.toLowerCase() === name) {
+			return raw[i + 1];
+		}
+	}
+	return undefined;
+}
+
+function isText(mimeType: string): boolean {
+	return (
+		mimeType.startsWith("text/") ||
+		/json|xml|javascript|x-www-form-urlencoded|jwt/.test(mimeType.split(";")[0] ?? "")
+	);
+}
+
+function truncation(body: BodyBuffer): string {
+	return `truncated to the first ${body.bytes.length} of ${body.size} bytes`;
+}
@@ -0,0 +1,111 @@
+/**
+ * HTTP helpers for intercepting requests before oidc-provider sees them
+ */
+
+import { IncomingMessage } from "node:http";
+import { assertionClientId } from "./client-assertion.js";
+
+/**
+ * Read a request body fully
+ */
+export async function readBody(req: IncomingMessage): Promise<Buffer> {
+	const chunks: Buffer[] = [];
+	for await (const chunk of req) {
+		chunks.push(Buffer.isBuffer(chunk) ? chunk : Buffer.from(String(chunk)));
+	}
+	return Buffer.concat(chunks);
+}
+
+/**
+ * Build a fresh request carrying an already-consumed body
+ *
+ * Once Loki has read a body to inspect it, the original stream is spent;
+ * the replay lets oidc-provider parse it as if it were untouched.
+ */
+export function replayRequest(req: IncomingMessage, body: Buffer): IncomingMessage {
+	const replay = new IncomingMessage(req.socket);
+	replay.method = req.method ?? "GET";
+	replay.url = req.url ?? "/";
+	replay.headers = req.headers;
+	replay.rawHeaders = req.rawHeaders;
+	replay.httpVersion = req.httpVersion;
+	replay.httpVersionMajor = req.httpVersionMajor;
+	replay.httpVersionMinor = req.httpVersionMinor;
+	replay.push(body);
+	replay.push(null);
+	return replay;
+}
+
+/**
+ * Parse form-encoded body parameters merged over query parameters
+ */
+export function parseParams(url: string, body: Buffer): Record<string, string> {
+	const params: Record<string, string> = {};
+	const query = url.includes("?") ? url.slice(url.indexOf("?") + 1) : "";
+	for (const [key, value] of new URLSearchParams(query)) {
+		params[key] = value;
+	}
+	for (const [key, value] of new URLSearchParams(body.toString())) {
+		params[key] = value;
+	}
+	return params;
+}
+
+/**
+ * The client a request identifies: its HTTP Basic credentials, otherwise
+ * the `client_id` parameter, otherwise the subject of its client assertion
+ */
+export function requestClientId(
+	authorization: string | undefined,
+	params: Record<string, string>,
+): string | undefined {
+	if (authorization?.toLowerCase().startsWith("basic ")) {
+		const credentials = Buffer.from(authorization.slice(6), "base64").toString();
+		const separator = credentials.indexOf(":");
+		if (separator > 0) {
+			try {
+				// Basic credentials are form-encoded (RFC 6749 Section 2.3.1)
+				return decodeURIComponent(credentials.slice(0, separator).replace(/\+/g, " "));
+			} catch {
+				return undefined;
+			}
+		}
+	}
+	if (params.client_id === undefined && params.client_assertion !== undefined) {
+		return assertionClientId(params.client_assertion);
+	}
+	return params.client_id;
+}
+
+/**
+ * The value of a header, whatever the case of its name
+ */
+export function headerValue(
+	headers: Record<string, string | string[] | number | undefined>,
+	name: string,
+): string | undefined {
+	const lower = name.toLowerCase();
+	for (const [key, value] of Object.entries(headers)) {
+		if (key.toLowerCase() === lower && value !== undefined) {
+			return String(value);
+		}
+	}
+	return undefined;
+}
+
+/**
+ * Set a header, replacing it under any other case of its name
+ */
+export function setHeaderValue(
+	headers: Record<string, string | string[] | number | undefined>,
+	name: string,
+	value: string,
+): void {
+	const lower = name.toLowerCase();
+	for (const key of Object.keys(headers)) {
+		if (key.toLowerCase() === lower) {
+			delete headers[key];
+		}
+	}
+	headers[lower] = value;
+}
@@ -0,0 +1,110 @@
+/**
+ * ID Token Encryption - nested JWS-in-JWE ID tokens
+ *
+ * A client registered through /admin/clients with an `idTokenEncryption`
+ * public key receives its ID tokens signed and then encrypted to that key
+ * (OIDC Core Section 10.2): a compact JWE whose protected header carries
+ * the key management `alg`, the content encryption `enc` and `cty: "JWT"`.
+ * Access tokens are left as they are. The registration's alg defaults to
+ * the key's own, else RSA-OAEP or ECDH-ES by key type, and its enc to
+ * A256GCM.
+ */
+
+import * as jose from "jose";
+import { isPlainObject } from "./session-spec.js";
+
+/** Key management algorithms an ID token can be encrypted with */
+export const ID_TOKEN_ENCRYPTION_ALGS = ["RSA-OAEP", "RSA-OAEP-256", "ECDH-ES", "ECDH-ES+A256KW"];
+
+/** Content encryption algorithms an ID token can be encrypted with */
+export const ID_TOKEN_ENCRYPTION_ENCS = [
+	"A128GCM",
+	"A192GCM",
+	"A256GCM",
+	"A128CBC-HS256",
+	"A256CBC-HS512",
+];
+
+/**
+ * The key and algorithms a client's ID tokens are encrypted with
+ */
+export interface IdTokenEncryption {
+	/** The client's public encryption key */
+	jwk: jose.JWK;
+	alg: string;
+	enc: string;
+}
+
+/**
+ * Validate a registration's `idTokenEncryption`; returns an error message if it's invalid
+ */
+export function parseIdTokenEncryption(value: unknown): IdTokenEncryption | string {
+	if (!isPlainObject(value) || !isPlainObject(value.jwk)) {
+		return "idTokenEncryption must be an object with a jwk";
+	}
+	const jwk = value.jwk as jose.JWK;
+	const alg = value.alg ?? jwk.alg ?? defaultAlg(jwk);
+	const enc = value.enc ?? "A256GCM";
+	if (typeof alg !== "string" || !ID_TOKEN_ENCRYPTION_ALGS.includes(alg)) {
+		return `idTokenEncryption.alg must be one of ${ID_TOKEN_ENCRYPTION_ALGS.join(", ")}`;
+	}
+	if (typeof enc !== "string" || !ID_TOKEN_ENCRYPTION_ENCS.includes(enc)) {
+		return `idTokenEncryption.enc must be one of ${ID_TOKEN_ENCRYPTION_ENCS.join(", ")}`;
+	}
+	if (jwk.kty !== keyType(alg)) {
+		return `idTokenEncryption.jwk must be an ${keyType(alg)} key for ${alg}`;
+	}
+	if ("d" in jwk) {
+		return "idTokenEncryption.jwk must be a public key; it has 'd'";
+	}
+	return { jwk, alg, enc };
+}
+
+/**
+ * Check that the key imports for its alg; throws if it doesn't
+ */
+export async function checkIdTokenEncryption(encryption: IdTokenEncryption): Promise<void> {
+	try {
+		await jose.importJWK(encryption.jwk, encryption.alg);
+	} catch (err) {
+		throw new Error(`idTokenEncryption.jwk is not a usable public key: ${String(err)}`);
+	}
+}
+
+/**
+ * Encrypt a signed ID token to the client's key, with its registered alg
+ * and enc unless others are given
+ */
+export async function encryptIdToken(
+	jws: string,
+	encryption: IdTokenEncryption,
+	alg: string = encryption.alg,
+	enc: string = encryption.enc,
+): Promise<string> {
+	const key = await jose.importJWK(encryption.jwk, alg);
+	const header: jose.CompactJWEHeaderParameters = { alg, enc, cty: "JWT" };
+	if (encryption.jwk.kid !== undefined) {
+		header.kid = encryption.jwk.kid;
+	}
+	return new jose.CompactEncrypt(new TextEncoder().encode(jws))
+		.setProtectedHeader(header)
+		.encrypt(key);
+}
+
+/**
+ * The key type a key management algorithm takes
+ */
+export function keyType(alg: string): "RSA" | "EC" {
+	return alg.startsWith("RSA") ? "RSA" : "EC";
+}
+
+function defaultAlg(jwk: jose.JWK): string | undefined {
+	switch (jwk.kty) {
+		case "RSA":
+			return "RSA-OAEP";
+		case "EC":
+			return "ECDH-ES";
+		default:
+			return undefined;
+	}
+}
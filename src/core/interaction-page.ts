@@ -0,0 +1,77 @@
+/**
+ * Interaction Page - `display` and `ui_locales` handling for the login UI
+ *
+ * oidc-provider's development login page ignores both parameters. Loki
+ * decorates it so the page reflects the requested display mode (a narrow
+ * popup, a touch layout, ...) and the first supported UI locale, which lets
+ * clients that embed the IdP in popups or webviews check they are honoured.
+ */
+
+/** Display values defined by OIDC Core Section 3.1.2.1 */
+export const DISPLAY_VALUES = ["page", "popup", "touch", "wap"] as const;
+
+export type DisplayMode = (typeof DISPLAY_VALUES)[number];
+
+/** Locales the login page has strings for */
+export const SUPPORTED_UI_LOCALES = ["en", "de", "es", "fr", "ja"] as const;
+
+const SIGN_IN: Record<(typeof SUPPORTED_UI_LOCALES)[number], string> = {
+	en: "Sign in",
+	de: "Anmelden",
+	es: "Iniciar sesión",
+	fr: "Se connecter",
+	ja: "サインイン",
+};
+
+const DISPLAY_STYLES: Record<DisplayMode, string> = {
+	page: "",
+	popup: "body{max-width:450px;margin:0 auto;}",
+	touch: "body{font-size:1.4em;}input,button{min-height:48px;font-size:1em;}",
+	wap: "body{font-size:0.8em;}img{max-width:100%;}",
+};
+
+export interface InteractionPresentation {
+	display: DisplayMode;
+	locale: string;
+}
+
+/**
+ * The display mode to render; unknown or missing values fall back to "page"
+ */
+export function resolveDisplay(requested: string | undefined): DisplayMode {
+	return DISPLAY_VALUES.find((d) => d === requested) ?? "page";
+}
+
+/**
+ * The first requested locale the page supports, matched on language; "en" otherwise
+ */
+export function resolveLocale(uiLocales: string | undefined): string {
+	for (const tag of (uiLocales ?? "").split(" ").filter(Boolean)) {
+		const language = tag.split("-")[0]?.toLowerCase();
+		const match = SUPPORTED_UI_LOCALES.find((l) => l === language);
+		if (match) {
+			return match;
+		}
+	}
+	return "en";
+}
+
+/**
+ * Rewrite the login page to reflect the display mode and locale
+ */
+export function decorateInteractionPage(html: string, presentation: InteractionPresentation): string {
+	const { display, locale } = presentation;
+	const heading = SIGN_IN[locale as keyof typeof SIGN_IN] ?? SIGN_IN.en;
+	const head = [
+		'<meta name="viewport" content="width=device-width, initial-scale=1">',
+		`<style>${DISPLAY_STYLES[display]}</style>`,
+	].join("");
+	const banner =
+		`<p class="loki-presentation" data-display="${display}" data-locale="${locale}">` +
+		`${heading}</p>`;
+
+	return html
+		.replace(/<html[^>]*>/i, `<html lang="${locale}" data-display="${display}">`)
+		.replace(/<\/head>/i, `${head}</head>`)
+		.replace(/<body([^>]*)>/i, `<body$1 class="loki-display-${display}">${banner}`);
+}
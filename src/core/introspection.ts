@@ -0,0 +1,106 @@
+/**
+ * Introspection - RFC 7662 answers from what Loki actually issued
+ *
+ * Loki serves its own introspection endpoint at /introspect. A token is
+ * active when Loki issued it exactly as presented (a session token in the
+ * issuance log, or a JWT carrying a valid signature from one of Loki's
+ * keys), it is within its validity window and it hasn't been revoked.
+ * Anything else is inactive, with a reason Loki keeps to itself: the
+ * response only ever says `active: false` (RFC 7662 Section 2.2).
+ *
+ * Mischief may lie about inactive tokens and answer `active: true`, to
+ * check that a gateway doesn't trust introspection over its own checks.
+ * An active token's `scope` is the scope it was granted, not whatever
+ * mischief put in its claim.
+ */
+
+/** The path Loki serves introspection at */
+export const INTROSPECTION_PATH = "/introspect";
+
+/** Why a token is inactive */
+export type InactiveReason = "unknown" | "expired" | "not-yet-valid" | "revoked";
+
+/** What Loki knows about a presented token */
+export interface TokenState {
+	/** Null when the token is active */
+	reason: InactiveReason | null;
+	/** The token's claims, if it's a decodable JWT */
+	claims: Record<string, unknown> | null;
+	/** access_token or id_token, when Loki knows which it issued */
+	tokenType: string | null;
+	/** The scope the token was granted, when Loki issued it with one */
+	grantedScope?: string;
+}
+
+/** What Loki issued, as far as introspection is concerned */
+export interface IssuedToken {
+	claims: Record<string, unknown>;
+	tokenType: string | null;
+	grantedScope?: string;
+}
+
+/** Claims an active response repeats (RFC 7662 Section 2.2) */
+const RESPONSE_CLAIMS = [
+	"scope",
+	"client_id",
+	"username",
+	"exp",
+	"iat",
+	"nbf",
+	"sub",
+	"aud",
+	"iss",
+	"jti",
+];
+
+/**
+ * The state of a presented token: `issued` is what Loki issued, if it did,
+ * and `presented` the presented token's claims, if it decodes
+ */
+export function tokenState(
+	issued: IssuedToken | undefined,
+	presented: Record<string, unknown> | null,
+	isRevoked: (jti: string) => boolean,
+	now: number = Date.now(),
+): TokenState {
+	if (!issued) {
+		return { reason: "unknown", claims: presented, tokenType: null };
+	}
+	const { claims, tokenType } = issued;
+	const seconds = Math.floor(now / 1000);
+	let reason: InactiveReason | null = null;
+	if (typeof claims.exp === "number" && claims.exp <= seconds) {
+		reason = "expired";
+	} else if (typeof claims.nbf === "number" && claims.nbf > seconds) {
+		reason = "not-yet-valid";
+	} else if (typeof claims.jti === "string" && isRevoked(claims.jti)) {
+		reason = "revoked";
+	}
+	const state: TokenState = { reason, claims, tokenType };
+	if (issued.grantedScope !== undefined) {
+		state.grantedScope = issued.grantedScope;
+	}
+	return state;
+}
+
+/**
+ * The introspection response for a token, as active or not
+ */
+export function introspectionResponse(state: TokenState, active: boolean): Record<string, unknown> {
+	if (!active) {
+		return { active: false };
+	}
+	const response: Record<string, unknown> = { active: true };
+	for (const claim of RESPONSE_CLAIMS) {
+		if (state.claims?.[claim] !== undefined) {
+			response[claim] = state.claims[claim];
+		}
+	}
+	if (state.grantedScope !== undefined) {
+		response.scope = state.grantedScope;
+	}
+	if (state.tokenType === "access_token") {
+		response.token_type = "Bearer";
+	}
+	return response;
+}
@@ -0,0 +1,481 @@
+/**
+ * Issuance Log - what Loki did to each token a session issued
+ *
+ * Every JWT a session's token response carries is recorded with the token
+ * mischief applied to it: each plugin's mutation and evidence, the header
+ * parameters and claims that differ from the token the provider signed,
+ * the final header as the client decodes it, and the fingerprint of the
+ * key whose signature it carries. A client's accept/reject decision can
+ * then be matched against exactly what was sent.
+ *
+ * The log also remembers each of those JWTs exactly as sent, so
+ * introspection can answer from what was actually issued, and records
+ * each userinfo response mischief made diverge from the token it answered
+ * and each revocation a session's client asked for.
+ */
+
+import * as jose from "jose";
+import { audFormatOf } from "./aud-format.js";
+import { type GrantClaims, grantClaims } from "./grant-claims.js";
+import { type ClaimsDelivery, type RequestedClaims, claimsDelivery } from "./request-claims.js";
+import { activeRequestId } from "./request-id.js";
+import { resourceAudience } from "./request-resource.js";
+import { isPlainObject } from "./session-spec.js";
+import { actorChain } from "./token-exchange.js";
+import { type TokenExpiry, tokenExpiry } from "./token-lifetime.js";
+import type { TransientKeyRecord } from "./transient-keys.js";
+import type { AudFormat } from "./types.js";
+
+/** Issuances remembered per session */
+export const MAX_ISSUANCES = 1000;
+
+/** Issued tokens remembered for introspection */
+const MAX_ISSUED = 10000;
+
+/** A header parameter or claim the mischief changed; an absent side was absent in that token */
+export interface FieldChange {
+	name: string;
+	before?: unknown;
+	after?: unknown;
+}
+
+/** One plugin's edit to an issued token */
+export interface TokenMutation {
+	plugin: string;
+	mutation: string;
+	evidence: Record<string, unknown>;
+}
+
+/** Where a signing key came from */
+export type SigningKeySource = "loki" | "rogue-jwks" | "transient" | "attacker";
+
+/** The key whose signature a token carries */
+export interface SigningKeyFingerprint {
+	kid: string | null;
+	/** RFC 7638 JWK thumbprint (SHA-256) of the public key */
+	thumbprint: string;
+	source: SigningKeySource;
+}
+
+/** A candidate for the key that signed a token */
+export interface CandidateKey {
+	jwk: jose.JWK;
+	source: SigningKeySource;
+}
+
+export interface TokenIssuance {
+	tokenType: string;
+	jti: string | null;
+	/** Set when an earlier token the session was issued carried the same jti */
+	jtiReused?: true;
+	issuedAt: string;
+	/** Correlation ID of the token request that issued it */
+	requestId?: string;
+	/** Token mischief applied, in order; empty for a baseline token */
+	mischief: string[];
+	mutations: TokenMutation[];
+	changes: { header: FieldChange[]; claims: FieldChange[] };
+	/** The final JWT header, decoded */
+	header: Record<string, unknown>;
+	/** Null when no known key verifies the signature (alg none, HMAC, a corrupted signature) */
+	signingKey: SigningKeyFingerprint | null;
+	/** For an ID token whose client sent a nonce: that nonce, and the claim sent (null if absent) */
+	nonce?: { expected: string; actual: unknown };
+	/** For an ID token whose client sent a claims request: the claims requested, and those sent */
+	requestedClaims?: ClaimsDelivery;
+	/** For an access token whose client named resources: the aud they ask for, and the aud sent */
+	audience?: { requested: string | string[]; issued: unknown };
+	/** For a token carrying a string or string-array aud: its form, and the aud as serialized */
+	aud?: { format: AudFormat; serialized: string };
+	/** For an exchanged access token: the actor chain issued and sent, current actor first */
+	actors?: { expected: string[]; actual: string[] };
+	/** For an access token requested with a DPoP proof: its key's jkt, and the cnf.jkt sent */
+	dpop?: { expected: string; issued: unknown };
+	/** For a probabilistic session: the plugins drawn for the token request, fired or not */
+	drawn?: string[];
+	/** For an access token sent with expires_in: that, next to the exp it carries */
+	expiry?: TokenExpiry;
+	/** The grant the token was issued under, its claim profile and the claims it doesn't expect */
+	grant?: GrantClaims;
+}
+
+/** What the token request a JWT was issued for asked of it */
+export interface IssuanceContext {
+	/** The nonce an ID token's client requested */
+	expectedNonce?: string;
+	/** The claims an ID token's client requested for it (OIDC Core Section 5.5) */
+	requestedClaims?: RequestedClaims;
+	/** The resources an access token's client requested (RFC 8707) */
+	requestedAudience?: string[];
+	/** The actor chain an exchanged access token was issued with (RFC 8693) */
+	actors?: string[];
+	/** The thumbprint of the DPoP key an access token's client proved possession of */
+	dpopThumbprint?: string;
+	/** The plugins a probabilistic session drew for the request */
+	drawn?: string[];
+	/** The expires_in an access token was sent with */
+	expiresIn?: number;
+	/** The token request's grant_type */
+	grantType?: string;
+}
+
+/** A token Loki handed out, exactly as sent */
+export interface IssuedJwt {
+	tokenType: string;
+	claims: Record<string, unknown>;
+	sessionId: string;
+	/** The scope granted, as it stood before mischief (tokens that carried one) */
+	grantedScope?: string;
+}
+
+/** A userinfo response that no longer matches the token it was served for */
+export interface UserinfoDivergence {
+	servedAt: string;
+	requestId?: string;
+	/** The access token's subject */
+	tokenSub: string;
+	/** Endpoint mischief applied to the response, in order */
+	mischief: string[];
+	mutations: TokenMutation[];
+	/** Claims that differ from the baseline response */
+	changes: FieldChange[];
+}
+
+/** A revocation request, and whether Loki actually revoked the token */
+export interface TokenRevocation {
+	revokedAt: string;
+	requestId?: string;
+	/** The token's jti, or the token itself when it is opaque */
+	jti: string;
+	/** The revoked token's type, when Loki issued it to a session */
+	tokenType: string | null;
+	clientId: string | null;
+	/** True when mischief answered success but left the token active */
+	ignored: boolean;
+	/** Endpoint mischief applied to the request, in order */
+	mischief: string[];
+	mutations: TokenMutation[];
+}
+
+/** A session's attack report: every issuance, oldest first */
+export interface SessionReport {
+	sessionId: string;
+	mode: string;
+	/** Every plugin that mutated an issued token, in order of first use */
+	mischief: string[];
+	issuances: TokenIssuance[];
+	/** Userinfo responses mischief made diverge, when there were any */
+	userinfo?: UserinfoDivergence[];
+	/** Revocations the session's clients asked for, when there were any */
+	revocations?: TokenRevocation[];
+	/** Keys published in the session's JWKS for a window, when there were any */
+	transientKeys?: TransientKeyRecord[];
+}
+
+/**
+ * Token issuances, per session
+ */
+export class IssuanceLog {
+	private readonly sessions = new Map<string, TokenIssuance[]>();
+	private readonly userinfo = new Map<string, UserinfoDivergence[]>();
+	private readonly revocations = new Map<string, TokenRevocation[]>();
+	private readonly issued = new Map<string, IssuedJwt>(); // token -> issued
+
+	/**
+	 * Record a JWT issued to a session
+	 *
+	 * `original` is the token before mischief; the changes are the
+	 * difference between it and `token`. Resolves to the issuance recorded,
+	 * or undefined if `token` isn't a JWT.
+	 */
+	async record(
+		sessionId: string,
+		tokenType: string,
+		original: string,
+		token: string,
+		mutations: TokenMutation[],
+		candidates: CandidateKey[],
+		context: IssuanceContext = {},
+	): Promise<TokenIssuance | undefined> {
+		const decoded = decodeJwt(token);
+		if (!decoded) {
+			return undefined;
+		}
+		const before = decodeJwt(original) ?? { header: {}, claims: {} };
+		const issued: IssuedJwt = { tokenType, claims: decoded.claims, sessionId };
+		if (typeof before.claims.scope === "string") {
+			issued.grantedScope = before.claims.scope;
+		}
+		this.remember(token, issued);
+		const jti = decoded.claims.jti;
+		const issuance: TokenIssuance = {
+			tokenType,
+			jti: typeof jti === "string" ? jti : null,
+			issuedAt: new Date().toISOString(),
+			mischief: mutations.map((m) => m.plugin),
+			mutations,
+			changes: {
+				header: diffFields(before.header, decoded.header),
+				claims: diffFields(before.claims, decoded.claims),
+			},
+			header: decoded.header,
+			signingKey: await signingKeyOf(token, decoded.header, candidates),
+		};
+		const requestId = activeRequestId();
+		if (requestId !== undefined) {
+			issuance.requestId = requestId;
+		}
+		if (context.expectedNonce !== undefined) {
+			const actual = decoded.claims.nonce ?? null;
+			issuance.nonce = { expected: context.expectedNonce, actual };
+		}
+		if (context.requestedClaims !== undefined) {
+			issuance.requestedClaims = claimsDelivery(context.requestedClaims, decoded.claims);
+		}
+		if (context.requestedAudience !== undefined) {
+			const requested = resourceAudience(context.requestedAudience);
+			issuance.audience = { requested, issued: decoded.claims.aud ?? null };
+		}
+		const audFormat = audFormatOf(decoded.claims.aud);
+		if (audFormat !== undefined) {
+			issuance.aud = { format: audFormat, serialized: JSON.stringify(decoded.claims.aud) };
+		}
+		if (context.actors !== undefined) {
+			issuance.actors = { expected: context.actors, actual: actorChain(decoded.claims.act) };
+		}
+		if (context.dpopThumbprint !== undefined) {
+			const { cnf } = decoded.claims;
+			const issued = isPlainObject(cnf) ? (cnf.jkt ?? null) : null;
+			issuance.dpop = { expected: context.dpopThumbprint, issued };
+		}
+		if (context.drawn !== undefined) {
+			issuance.drawn = context.drawn;
+		}
+		if (context.expiresIn !== undefined) {
+			issuance.expiry = tokenExpiry(decoded.claims, context.expiresIn);
+		}
+		if (context.grantType !== undefined) {
+			issuance.grant = grantClaims(context.grantType, decoded.claims);
+		}
+
+		let issuances = this.sessions.get(sessionId);
+		if (!issuances) {
+			issuances = [];
+			this.sessions.set(sessionId, issuances);
+		}
+		if (issuance.jti !== null && issuances.some((earlier) => earlier.jti === issuance.jti)) {
+			issuance.jtiReused = true;
+		}
+		issuances.push(issuance);
+		if (issuances.length > MAX_ISSUANCES) {
+			issuances.shift();
+		}
+		return issuance;
+	}
+
+	/**
+	 * Replace a session's issuances with ones persisted earlier (or by
+	 * another replica)
+	 */
+	restore(sessionId: string, issuances: TokenIssuance[]): void {
+		if (issuances.length === 0) {
+			this.sessions.delete(sessionId);
+			return;
+		}
+		this.sessions.set(sessionId, issuances.slice(-MAX_ISSUANCES));
+	}
+
+	/**
+	 * The token as Loki issued it; undefined if Loki never sent it (or
+	 * someone changed a byte)
+	 */
+	lookup(token: string): IssuedJwt | undefined {
+		return this.issued.get(token);
+	}
+
+	/**
+	 * Record a userinfo response served to a session, if mischief changed it
+	 *
+	 * `baseline` is the response before mischief. Returns the divergence
+	 * recorded, or undefined if the response served matches it.
+	 */
+	recordUserinfo(
+		sessionId: string,
+		tokenSub: string,
+		baseline: Record<string, unknown>,
+		served: Record<string, unknown>,
+		mutations: TokenMutation[],
+	): UserinfoDivergence | undefined {
+		const changes = diffFields(baseline, served);
+		if (changes.length === 0) {
+			return undefined;
+		}
+		const divergence: UserinfoDivergence = {
+			servedAt: new Date().toISOString(),
+			tokenSub,
+			mischief: mutations.map((m) => m.plugin),
+			mutations,
+			changes,
+		};
+		const requestId = activeRequestId();
+		if (requestId !== undefined) {
+			divergence.requestId = requestId;
+		}
+
+		let divergences = this.userinfo.get(sessionId);
+		if (!divergences) {
+			divergences = [];
+			this.userinfo.set(sessionId, divergences);
+		}
+		divergences.push(divergence);
+		if (divergences.length > MAX_ISSUANCES) {
+			divergences.shift();
+		}
+		return divergence;
+	}
+
+	/**
+	 * Record a revocation requested for a session's token
+	 */
+	recordRevocation(
+		sessionId: string,
+		revocation: Omit<TokenRevocation, "revokedAt" | "requestId" | "mischief">,
+	): TokenRevocation {
+		const recorded: TokenRevocation = {
+			revokedAt: new Date().toISOString(),
+			...revocation,
+			mischief: revocation.mutations.map((m) => m.plugin),
+		};
+		const requestId = activeRequestId();
+		if (requestId !== undefined) {
+			recorded.requestId = requestId;
+		}
+
+		let revocations = this.revocations.get(sessionId);
+		if (!revocations) {
+			revocations = [];
+			this.revocations.set(sessionId, revocations);
+		}
+		revocations.push(recorded);
+		if (revocations.length > MAX_ISSUANCES) {
+			revocations.shift();
+		}
+		return recorded;
+	}
+
+	getReport(sessionId: string, mode: string): SessionReport {
+		const issuances = [...(this.sessions.get(sessionId) ?? [])];
+		const mischief = [...new Set(issuances.flatMap((issuance) => issuance.mischief))];
+		const report: SessionReport = { sessionId, mode, mischief, issuances };
+		const userinfo = this.userinfo.get(sessionId) ?? [];
+		if (userinfo.length > 0) {
+			report.userinfo = [...userinfo];
+		}
+		const revocations = this.revocations.get(sessionId) ?? [];
+		if (revocations.length > 0) {
+			report.revocations = [...revocations];
+		}
+		return report;
+	}
+
+	clear(sessionId: string): void {
+		this.sessions.delete(sessionId);
+		this.userinfo.delete(sessionId);
+		this.revocations.delete(sessionId);
+		for (const [token, issued] of this.issued) {
+			if (issued.sessionId === sessionId) {
+				this.issued.delete(token);
+			}
+		}
+	}
+
+	clearAll(): void {
+		this.sessions.clear();
+		this.userinfo.clear();
+		this.revocations.clear();
+		this.issued.clear();
+	}
+
+	private remember(token: string, issued: IssuedJwt): void {
+		this.issued.delete(token);
+		this.issued.set(token, issued);
+		if (this.issued.size > MAX_ISSUED) {
+			const oldest = this.issued.keys().next().value;
+			if (oldest !== undefined) {
+				this.issued.delete(oldest);
+			}
+		}
+	}
+}
+
+function decodeJwt(
+	token: string,
+): { header: Record<string, unknown>; claims: Record<string, unknown> } | undefined {
+	if (token.split(".").length !== 3) {
+		return undefined;
+	}
+	try {
+		return {
+			header: jose.decodeProtectedHeader(token) as Record<string, unknown>,
+			claims: jose.decodeJwt(token) as Record<string, unknown>,
+		};
+	} catch {
+		return undefined;
+	}
+}
+
+/**
+ * The fields added, removed or changed between two decoded JSON objects
+ */
+export function diffFields(
+	before: Record<string, unknown>,
+	after: Record<string, unknown>,
+): FieldChange[] {
+	const changes: FieldChange[] = [];
+	for (const name of new Set([...Object.keys(before), ...Object.keys(after)])) {
+		const had = Object.hasOwn(before, name);
+		const has = Object.hasOwn(after, name);
+		if (had && has && JSON.stringify(before[name]) === JSON.stringify(after[name])) {
+			continue;
+		}
+		const change: FieldChange = { name };
+		if (had) change.before = before[name];
+		if (has) change.after = after[name];
+		changes.push(change);
+	}
+	return changes;
+}
+
+/**
+ * The first candidate key that verifies a token's signature, preferring
+ * keys whose kid matches the header's
+ */
+export async function signingKeyOf(
+	token: string,
+	header: Record<string, unknown>,
+	candidates: CandidateKey[],
+): Promise<SigningKeyFingerprint | null> {
+	const alg = header.alg;
+	if (typeof alg !== "string" || alg === "none" || alg.startsWith("HS")) {
+		return null;
+	}
+	const ordered = [
+		...candidates.filter((c) => c.jwk.kid === header.kid),
+		...candidates.filter((c) => c.jwk.kid !== header.kid),
+	];
+	for (const candidate of ordered) {
+		try {
+			const key = await jose.importJWK(candidate.jwk, alg);
+			// An SD-JWT's signature covers the JWS before its disclosures
+			await jose.compactVerify(token.split("~")[0] ?? token, key);
+		} catch {
+			continue;
+		}
+		return {
+			kid: candidate.jwk.kid ?? null,
+			thumbprint: await jose.calculateJwkThumbprint(candidate.jwk),
+			source: candidate.source,
+		};
+	}
+	return null;
+}
@@ -0,0 +1,92 @@
+/**
+ * JWKS Auth - gating the JWKS behind a bearer token
+ *
+ * Some deployments only serve the JWKS to callers that authenticate. With
+ * `provider.jwksBearerToken` set, `/jwks` (and `/.well-known/jwks.json`)
+ * answer `401` to any fetch without `Authorization: Bearer <token>`.
+ *
+ * A misconfigured IdP may instead answer unauthenticated fetches with a
+ * different, decoy key set (`jwks-decoy-keys` mischief). Each session fetch
+ * of a gated JWKS, or that got decoys, is recorded with who fetched it and
+ * which key set they got, so a client's keys can be traced back to the
+ * fetch that produced them.
+ *
+ * Mischief can also change how a fetch's JWKS is framed on the wire
+ * (`jwks-transport-abuse`): gzip content-encoding, chunked transfer, or
+ * both. Loki still honors Accept-Encoding, so a fetch that refuses gzip
+ * gets the JWKS unencoded.
+ */
+
+import type { IncomingHttpHeaders } from "node:http";
+import { oauthError } from "./errors.js";
+import { presentsToken } from "./shared-secret.js";
+
+/**
+ * One JWKS fetch: whether it authenticated, and the key set it is served
+ */
+export interface JwksFetch {
+	/** Whether the fetch presented the configured bearer token */
+	authenticated: boolean;
+	/** Whether the JWKS requires authentication */
+	authRequired: boolean;
+	/** The key set served; mischief sets "decoy" when it replaces the keys */
+	keySet: "real" | "decoy";
+	/** The client the fetch was made for, which keys visible to some clients only depend on */
+	clientId?: string;
+	/** How the JWKS is sent; mischief sets it, the default is identity with a Content-Length */
+	encoding?: JwksEncoding;
+}
+
+/** How a JWKS response is framed: gzip-encoded, chunked, both, or neither */
+export type JwksEncoding = "identity" | "gzip" | "chunked" | "gzip-chunked";
+
+/**
+ * Describe a JWKS fetch from its headers, against the configured token if any
+ */
+export function jwksFetch(headers: IncomingHttpHeaders, token: string | undefined): JwksFetch {
+	return {
+		authenticated: token !== undefined && presentsToken(headers.authorization, token),
+		authRequired: token !== undefined,
+		keySet: "real",
+	};
+}
+
+/**
+ * Whether a fetch must be refused: auth is required and it would get the real keys without it
+ */
+export function refusesJwksFetch(fetch: JwksFetch): boolean {
+	return fetch.authRequired && !fetch.authenticated && fetch.keySet === "real";
+}
+
+/** The answer to a refused JWKS fetch */
+export const JWKS_UNAUTHORIZED = {
+	status: 401,
+	headers: {
+		"content-type": "application/json",
+		"cache-control": "no-store",
+		"www-authenticate": 'Bearer realm="jwks"',
+	},
+	body: JSON.stringify(
+		oauthError("invalid_token", "jwks_auth_required", "The JWKS requires a bearer token"),
+	),
+};
+
+/**
+ * Whether a request's Accept-Encoding allows gzip (RFC 9110 Section 12.5.3)
+ *
+ * A request without the header accepts any coding; one with it accepts
+ * gzip when it lists `gzip` (or `x-gzip`, or `*`) with a non-zero weight.
+ */
+export function acceptsGzip(header: string | string[] | undefined): boolean {
+	if (header === undefined) {
+		return true;
+	}
+	const weights = new Map<string, number>();
+	for (const entry of (Array.isArray(header) ? header.join(",") : header).split(",")) {
+		const [coding = "", ...params] = entry.split(";").map((part) => part.trim().toLowerCase());
+		const q = params.find((param) => param.startsWith("q="));
+		weights.set(coding, q === undefined ? 1 : Number(q.slice(2)));
+	}
+	const weight = weights.get("gzip") ?? weights.get("x-gzip") ?? weights.get("*") ?? 0;
+	return weight > 0;
+}
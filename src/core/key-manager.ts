@@ -0,0 +1,1014 @@
+/**
+ * Key Manager - signing key lifecycle
+ *
+ * Owns the key material Loki signs tokens with and publishes in its JWKS.
+ * The primary key is handed to oidc-provider at startup; rollover plans
+ * script a sequence of algorithm changes (e.g. RS256 → ES256 → EdDSA) over
+ * time so clients can be tested against an IdP that switches algorithm family.
+ * Key sets instead keep several keys valid at once and sign each token with
+ * the next one in turn, so clients must pick the verification key by `kid`.
+ * Only one of the two is active at a time; starting either replaces the other.
+ *
+ * Registered keys sit alongside all of these: named keys (generated, or
+ * imported from a private JWK) that are always published, and that sign a
+ * session's tokens when the session names one as its `keyId`. Rotating a
+ * registered key swaps in new material, and a new kid, under the same name.
+ * A registered key can be made visible to some clients only: the JWKS a
+ * client fetches then holds it, while every other fetch's leaves it out.
+ */
+
+import * as jose from "jose";
+import { isSeeded } from "./random.js";
+import { seededPrivateJwk } from "./seeded-keys.js";
+import { parseToken } from "./token-forge.js";
+
+export type SigningAlgorithm =
+	| "RS256"
+	| "RS384"
+	| "RS512"
+	| "PS256"
+	| "PS384"
+	| "PS512"
+	| "ES256"
+	| "ES384"
+	| "ES512"
+	| "EdDSA";
+
+export const SUPPORTED_SIGNING_ALGORITHMS: readonly SigningAlgorithm[] = [
+	"RS256",
+	"RS384",
+	"RS512",
+	"PS256",
+	"PS384",
+	"PS512",
+	"ES256",
+	"ES384",
+	"ES512",
+	"EdDSA",
+];
+
+export interface ManagedKey {
+	kid: string;
+	alg: SigningAlgorithm;
+	privateKey: jose.KeyLike;
+	publicKey: jose.KeyLike;
+	/** Public JWK as published in the JWKS */
+	publicJwk: jose.JWK;
+	/** Private JWK (used to configure oidc-provider) */
+	privateJwk: jose.JWK;
+	createdAt: Date;
+}
+
+export interface RolloverStep {
+	alg: SigningAlgorithm;
+	/** How long this algorithm stays active before the next step */
+	durationSeconds: number;
+}
+
+export interface RolloverPlanConfig {
+	steps: RolloverStep[];
+	/** Seconds both neighbouring keys are published around each transition */
+	overlapSeconds?: number;
+	/** Restart from the first step after the last one instead of staying on it */
+	loop?: boolean;
+}
+
+export interface RolloverHistoryEntry {
+	step: number;
+	alg: SigningAlgorithm;
+	kid: string;
+	activatedAt: string;
+}
+
+export interface RolloverStatus {
+	startedAt: string;
+	overlapSeconds: number;
+	loop: boolean;
+	steps: { alg: SigningAlgorithm; durationSeconds: number; kid: string }[];
+	currentStep: number;
+	activeKey: { kid: string; alg: SigningAlgorithm };
+	publishedKids: string[];
+	history: RolloverHistoryEntry[];
+}
+
+export interface KeySetConfig {
+	/** Number of concurrently valid signing keys */
+	count: number;
+	/** Algorithm of every key in the set (default: RS256) */
+	alg?: SigningAlgorithm;
+}
+
+export interface KeySigning {
+	kid: string;
+	/** "access_token" or "id_token" when known */
+	tokenType?: string;
+	jti?: string;
+	sub?: string;
+	signedAt: string;
+}
+
+export interface KeySetStatus {
+	startedAt: string;
+	alg: SigningAlgorithm;
+	keys: { kid: string; createdAt: string; signed: number }[];
+	/** Kid that will sign the next token */
+	nextKid: string;
+	retired: { kid: string; retiredAt: string }[];
+	/** Which key signed each token, oldest first */
+	signings: KeySigning[];
+}
+
+export interface KeyRegistration {
+	/** Name sessions pick the key by as `keyId` (default: the key's kid) */
+	id?: string;
+	alg: SigningAlgorithm;
+	/** Private key material to use instead of a generated key; its kid is kept */
+	privateJwk?: jose.JWK;
+	/** Clients whose JWKS fetches see the key (default: every fetch) */
+	visibleTo?: string[];
+}
+
+export interface RegisteredKeyStatus {
+	id: string;
+	kid: string;
+	alg: SigningAlgorithm;
+	publicJwk: jose.JWK;
+	registeredAt: string;
+	/** When the material was last rotated */
+	rotatedAt?: string;
+	/** Kids the key was published under before each rotation, oldest first */
+	previousKids: string[];
+	/** Clients whose JWKS fetches see the key; absent when every fetch does */
+	visibleTo?: string[];
+}
+
+/**
+ * A signing key with its private material, for tests that forge tokens themselves
+ */
+export interface ExportedSigningKey {
+	kid: string;
+	alg: SigningAlgorithm;
+	/** Whether this key signs the next token */
+	active: boolean;
+	publicJwk: jose.JWK;
+	privateJwk: jose.JWK;
+	/** SPKI PEM */
+	publicPem: string;
+	/** PKCS#8 PEM */
+	privatePem: string;
+}
+
+export interface KeyManagerOptions {
+	/** Clock override, in epoch milliseconds (for tests) */
+	now?: () => number;
+}
+
+interface RolloverPlan {
+	startedAt: number;
+	overlapMs: number;
+	loop: boolean;
+	steps: { alg: SigningAlgorithm; durationMs: number; key: ManagedKey }[];
+	history: RolloverHistoryEntry[];
+}
+
+interface RegisteredKey {
+	id: string;
+	key: ManagedKey;
+	registeredAt: number;
+	rotatedAt?: number;
+	previousKids: string[];
+	visibleTo?: string[];
+}
+
+interface KeySet {
+	startedAt: number;
+	alg: SigningAlgorithm;
+	keys: ManagedKey[];
+	/** Index into keys of the key that signs the next token */
+	next: number;
+	signed: Map<string, number>;
+	retired: { kid: string; retiredAt: string }[];
+	signings: KeySigning[];
+}
+
+/** Upper bound on recorded rollover history entries (and key set signings) */
+const MAX_HISTORY = 1000;
+
+/** Most keys a key set may hold */
+const MAX_KEY_SET_SIZE = 10;
+
+/** Most keys that may be registered at once */
+const MAX_REGISTERED_KEYS = 20;
+
+/** Most clients a registered key may be visible to */
+const MAX_VISIBLE_CLIENTS = 50;
+
+/** Names usable for registered keys (they are sent back as a session's keyId) */
+const KEY_ID_PATTERN = /^[A-Za-z0-9][A-Za-z0-9_.:-]{0,63}$/;
+
+/** The JWK key type (and curve) each algorithm signs with */
+const KEY_TYPES: Record<SigningAlgorithm, { kty: string; crv?: string }> = {
+	RS256: { kty: "RSA" },
+	RS384: { kty: "RSA" },
+	RS512: { kty: "RSA" },
+	PS256: { kty: "RSA" },
+	PS384: { kty: "RSA" },
+	PS512: { kty: "RSA" },
+	ES256: { kty: "EC", crv: "P-256" },
+	ES384: { kty: "EC", crv: "P-384" },
+	ES512: { kty: "EC", crv: "P-521" },
+	EdDSA: { kty: "OKP", crv: "Ed25519" },
+};
+
+/** Public members of each key type's JWK */
+const PUBLIC_MEMBERS: Record<string, string[]> = {
+	RSA: ["kty", "n", "e"],
+	EC: ["kty", "crv", "x", "y"],
+	OKP: ["kty", "crv", "x"],
+};
+
+/**
+ * Generate a signing key pair for an algorithm; with a global seed, the
+ * key is derived from it
+ */
+export async function generateSigningKey(alg: SigningAlgorithm): Promise<ManagedKey> {
+	if (isSeeded()) {
+		const { kty, crv } = KEY_TYPES[alg];
+		return importSigningKey(alg, seededPrivateJwk(kty, crv));
+	}
+	const { publicKey, privateKey } = await jose.generateKeyPair(
+		alg,
+		alg === "EdDSA" ? { crv: "Ed25519", extractable: true } : { extractable: true },
+	);
+
+	const publicJwk = await jose.exportJWK(publicKey);
+	const kid = await jose.calculateJwkThumbprint(publicJwk);
+	Object.assign(publicJwk, { kid, alg, use: "sig" });
+
+	const privateJwk = await jose.exportJWK(privateKey);
+	Object.assign(privateJwk, { kid, alg, use: "sig" });
+
+	return { kid, alg, privateKey, publicKey, publicJwk, privateJwk, createdAt: new Date() };
+}
+
+/**
+ * Import a signing key pair from a private JWK; the JWK's kid is kept, or
+ * its thumbprint used
+ */
+export async function importSigningKey(
+	alg: SigningAlgorithm,
+	jwk: jose.JWK,
+): Promise<ManagedKey> {
+	const expected = KEY_TYPES[alg];
+	if (jwk.kty !== expected.kty || (expected.crv !== undefined && jwk.crv !== expected.crv)) {
+		const type = expected.crv ? `${expected.kty} ${expected.crv}` : expected.kty;
+		throw new Error(`privateJwk must be an ${type} key for ${alg}`);
+	}
+	if (typeof jwk.d !== "string") {
+		throw new Error("privateJwk must include the private key (d)");
+	}
+
+	const publicJwk: jose.JWK = {};
+	for (const member of PUBLIC_MEMBERS[expected.kty] ?? []) {
+		(publicJwk as Record<string, unknown>)[member] = (jwk as Record<string, unknown>)[member];
+	}
+	let privateKey: jose.KeyLike;
+	let publicKey: jose.KeyLike;
+	try {
+		privateKey = (await jose.importJWK(jwk, alg)) as jose.KeyLike;
+		publicKey = (await jose.importJWK(publicJwk, alg)) as jose.KeyLike;
+	} catch (err) {
+		throw new Error(`privateJwk is not a valid key: ${(err as Error).message}`);
+	}
+
+	const kid = jwk.kid ?? (await jose.calculateJwkThumbprint(publicJwk));
+	Object.assign(publicJwk, { kid, alg, use: "sig" });
+	const privateJwk = { ...jwk, kid, alg, use: "sig" };
+
+	return { kid, alg, privateKey, publicKey, publicJwk, privateJwk, createdAt: new Date() };
+}
+
+/**
+ * The key ID a tenant's tokens are signed under; the `/` keeps it apart
+ * from every registered key's ID
+ */
+export function tenantKeyId(tenant: string): string {
+	return `tenant/${tenant}`;
+}
+
+/**
+ * Key Manager - generates, rotates and publishes signing keys
+ */
+export class KeyManager {
+	private readonly now: () => number;
+	private primary: ManagedKey | null = null;
+	private plan: RolloverPlan | null = null;
+	private keySet: KeySet | null = null;
+	private readonly registered = new Map<string, RegisteredKey>();
+	/** Keys signing each tenant's tokens, by tenantKeyId; only the tenant's JWKS publishes them */
+	private readonly tenantKeys = new Map<string, ManagedKey>();
+
+	constructor(options?: KeyManagerOptions) {
+		this.now = options?.now ?? Date.now;
+	}
+
+	/**
+	 * Adopt `primary` (replicas sharing a store sign with one key), or
+	 * generate the primary RS256 key if it doesn't exist yet
+	 */
+	async initialize(primary?: ManagedKey): Promise<void> {
+		if (primary) {
+			this.primary = primary;
+		} else if (!this.primary) {
+			this.primary = await generateSigningKey("RS256");
+		}
+	}
+
+	/**
+	 * The primary key, used by oidc-provider for baseline signing
+	 */
+	get primaryKey(): ManagedKey {
+		if (!this.primary) {
+			throw new Error("KeyManager not initialized");
+		}
+		return this.primary;
+	}
+
+	/**
+	 * Private JWKS for oidc-provider's `jwks` configuration
+	 */
+	getProviderJwks(): { keys: jose.JWK[] } {
+		return { keys: [this.primaryKey.privateJwk] };
+	}
+
+	/**
+	 * Whether a rollover plan is currently configured
+	 */
+	get hasRolloverPlan(): boolean {
+		return this.plan !== null;
+	}
+
+	/**
+	 * Whether tokens are re-signed and the JWKS rewritten (a rollover plan or key set is active)
+	 */
+	get overridesSigning(): boolean {
+		return this.plan !== null || this.keySet !== null;
+	}
+
+	/**
+	 * Whether the JWKS is rewritten: signing is overridden or keys are registered
+	 */
+	get overridesJwks(): boolean {
+		return this.overridesSigning || this.registered.size > 0;
+	}
+
+	/**
+	 * Whether any registered key is visible to some clients only
+	 */
+	get restrictsJwks(): boolean {
+		return [...this.registered.values()].some((r) => r.visibleTo !== undefined);
+	}
+
+	/**
+	 * Start a rollover plan, replacing any existing one (or key set)
+	 *
+	 * Keys for every step are generated up front so each transition is instant.
+	 */
+	async startRolloverPlan(config: RolloverPlanConfig): Promise<RolloverStatus> {
+		validateRolloverPlan(config);
+
+		const steps: RolloverPlan["steps"] = [];
+		for (const step of config.steps) {
+			steps.push({
+				alg: step.alg,
+				durationMs: step.durationSeconds * 1000,
+				key: await generateSigningKey(step.alg),
+			});
+		}
+
+		this.keySet = null;
+		this.plan = {
+			startedAt: this.now(),
+			overlapMs: (config.overlapSeconds ?? 0) * 1000,
+			loop: config.loop ?? false,
+			steps,
+			history: [],
+		};
+
+		return this.getRolloverStatus() as RolloverStatus;
+	}
+
+	/**
+	 * Stop the rollover plan and revert to the primary key
+	 */
+	clearRolloverPlan(): boolean {
+		const had = this.plan !== null;
+		this.plan = null;
+		return had;
+	}
+
+	/**
+	 * Start a key set, replacing any existing one (or rollover plan)
+	 */
+	async startKeySet(config: KeySetConfig): Promise<KeySetStatus> {
+		validateKeySet(config);
+
+		const alg = config.alg ?? "RS256";
+		const keys: ManagedKey[] = [];
+		for (let i = 0; i < config.count; i++) {
+			keys.push(await generateSigningKey(alg));
+		}
+
+		this.plan = null;
+		this.keySet = {
+			startedAt: this.now(),
+			alg,
+			keys,
+			next: 0,
+			signed: new Map(),
+			retired: [],
+			signings: [],
+		};
+
+		return this.getKeySetStatus() as KeySetStatus;
+	}
+
+	/**
+	 * Retire a key from the set: it stops signing and leaves the JWKS
+	 *
+	 * With `replace`, a fresh key takes its place so the set keeps its size
+	 * (a rotation); otherwise the set shrinks. The last key can't be retired.
+	 */
+	async retireKeySetKey(kid: string, options: { replace?: boolean } = {}): Promise<KeySetStatus> {
+		const keySet = this.keySet;
+		if (!keySet) {
+			throw new Error("No key set configured");
+		}
+		const index = keySet.keys.findIndex((k) => k.kid === kid);
+		if (index === -1) {
+			throw new Error(`Key '${kid}' is not in the key set`);
+		}
+		if (keySet.keys.length === 1 && !options.replace) {
+			throw new Error("Cannot retire the last key in the set");
+		}
+
+		const replacement = options.replace ? await generateSigningKey(keySet.alg) : undefined;
+		if (replacement) {
+			keySet.keys.splice(index, 1, replacement);
+		} else {
+			keySet.keys.splice(index, 1);
+			if (keySet.next > index) {
+				keySet.next--;
+			}
+			keySet.next %= keySet.keys.length;
+		}
+		keySet.retired.push({ kid, retiredAt: new Date(this.now()).toISOString() });
+
+		return this.getKeySetStatus() as KeySetStatus;
+	}
+
+	/**
+	 * Stop the key set and revert to the primary key
+	 */
+	clearKeySet(): boolean {
+		const had = this.keySet !== null;
+		this.keySet = null;
+		return had;
+	}
+
+	/**
+	 * Describe the key set, or undefined if none is configured
+	 */
+	getKeySetStatus(): KeySetStatus | undefined {
+		const keySet = this.keySet;
+		if (!keySet) {
+			return undefined;
+		}
+		return {
+			startedAt: new Date(keySet.startedAt).toISOString(),
+			alg: keySet.alg,
+			keys: keySet.keys.map((k) => ({
+				kid: k.kid,
+				createdAt: k.createdAt.toISOString(),
+				signed: keySet.signed.get(k.kid) ?? 0,
+			})),
+			nextKid: (keySet.keys[keySet.next] as ManagedKey).kid,
+			retired: [...keySet.retired],
+			signings: [...keySet.signings],
+		};
+	}
+
+	/**
+	 * Register a named signing key, generated or imported
+	 */
+	async registerKey(registration: KeyRegistration): Promise<RegisteredKeyStatus> {
+		validateKeyRegistration(registration);
+		if (registration.id !== undefined && this.registered.has(registration.id)) {
+			throw new Error(`A key is already registered as '${registration.id}'`);
+		}
+		if (this.registered.size >= MAX_REGISTERED_KEYS) {
+			throw new Error(`At most ${MAX_REGISTERED_KEYS} keys can be registered`);
+		}
+
+		const key = await registrationKey(registration.alg, registration.privateJwk);
+		const id = registration.id ?? key.kid;
+		if (this.registered.has(id)) {
+			throw new Error(`A key is already registered as '${id}'`);
+		}
+		this.assertKidFree(key.kid);
+
+		const entry: RegisteredKey = { id, key, registeredAt: this.now(), previousKids: [] };
+		if (registration.visibleTo !== undefined) {
+			entry.visibleTo = [...registration.visibleTo];
+		}
+		this.registered.set(id, entry);
+		return registeredStatus(entry);
+	}
+
+	/**
+	 * Replace a registered key's material (and kid), keeping its name and algorithm
+	 *
+	 * The old key leaves the JWKS at once, so clients holding a cached JWKS
+	 * meet a kid they don't know.
+	 */
+	async rotateRegisteredKey(id: string, privateJwk?: jose.JWK): Promise<RegisteredKeyStatus> {
+		const entry = this.registered.get(id);
+		if (!entry) {
+			throw new Error(`No key is registered as '${id}'`);
+		}
+		const key = await registrationKey(entry.key.alg, privateJwk);
+		if (key.kid !== entry.key.kid) {
+			this.assertKidFree(key.kid);
+		}
+
+		entry.previousKids.push(entry.key.kid);
+		if (entry.previousKids.length > MAX_HISTORY) {
+			entry.previousKids.shift();
+		}
+		entry.key = key;
+		entry.rotatedAt = this.now();
+		return registeredStatus(entry);
+	}
+
+	/**
+	 * Make a registered key visible to these clients only, or with none to
+	 * every JWKS fetch again
+	 */
+	setKeyVisibility(id: string, visibleTo: string[] | undefined): RegisteredKeyStatus {
+		const entry = this.registered.get(id);
+		if (!entry) {
+			throw new Error(`No key is registered as '${id}'`);
+		}
+		if (visibleTo === undefined) {
+			delete entry.visibleTo;
+		} else {
+			validateVisibleTo(visibleTo);
+			entry.visibleTo = [...visibleTo];
+		}
+		return registeredStatus(entry);
+	}
+
+	/**
+	 * Remove a registered key; sessions naming it go back to the active key
+	 */
+	removeRegisteredKey(id: string): boolean {
+		return this.registered.delete(id);
+	}
+
+	/**
+	 * Describe a registered key, or undefined if none has that name
+	 */
+	getRegisteredKey(id: string): RegisteredKeyStatus | undefined {
+		const entry = this.registered.get(id);
+		return entry ? registeredStatus(entry) : undefined;
+	}
+
+	/**
+	 * Describe every registered key, in registration order
+	 */
+	getRegisteredKeys(): RegisteredKeyStatus[] {
+		return [...this.registered.values()].map(registeredStatus);
+	}
+
+	/**
+	 * Generate the key a tenant's tokens are signed with, unless it has one
+	 */
+	async addTenantKey(tenant: string): Promise<ManagedKey> {
+		const id = tenantKeyId(tenant);
+		const existing = this.tenantKeys.get(id);
+		if (existing) {
+			return existing;
+		}
+		const key = await generateSigningKey("RS256");
+		this.tenantKeys.set(id, key);
+		return key;
+	}
+
+	/**
+	 * Drop a tenant's key
+	 */
+	removeTenantKey(tenant: string): boolean {
+		return this.tenantKeys.delete(tenantKeyId(tenant));
+	}
+
+	/**
+	 * The key a tenant's tokens are signed with, if it has one
+	 */
+	getTenantKey(tenant: string): ManagedKey | undefined {
+		return this.tenantKeys.get(tenantKeyId(tenant));
+	}
+
+	/**
+	 * The JWKS a tenant publishes: its own key only
+	 */
+	getTenantJwks(tenant: string): { keys: jose.JWK[] } {
+		const key = this.getTenantKey(tenant);
+		return { keys: key ? [key.publicJwk] : [] };
+	}
+
+	/**
+	 * The key that signs tokens for a session naming `keyId`: the registered
+	 * (or tenant) key, or the active key if it names none
+	 */
+	signingKeyFor(keyId: string | undefined): ManagedKey {
+		return this.namedKey(keyId) ?? this.getActiveKey();
+	}
+
+	/**
+	 * The key that should sign tokens right now
+	 *
+	 * For a key set this is the key the next token will be signed with.
+	 */
+	getActiveKey(): ManagedKey {
+		if (this.keySet) {
+			return this.keySet.keys[this.keySet.next] as ManagedKey;
+		}
+		if (!this.plan) {
+			return this.primaryKey;
+		}
+		const { index } = this.locate(this.plan, this.now());
+		return (this.plan.steps[index] as RolloverPlan["steps"][number]).key;
+	}
+
+	/**
+	 * Public JWKS currently advertised
+	 *
+	 * During an overlap window both the outgoing and incoming keys are
+	 * published so clients with a warm cache can still verify either.
+	 */
+	getPublishedJwks(): { keys: jose.JWK[] } {
+		return { keys: [...this.baseKeys(), ...this.registeredKeys()].map((k) => k.publicJwk) };
+	}
+
+	/**
+	 * The JWKS a fetch by `clientId` (or by no client in particular) is
+	 * served: the published keys, less registered keys visible to other
+	 * clients only
+	 */
+	getClientJwks(clientId: string | undefined): { keys: jose.JWK[] } {
+		const hidden = new Set(
+			[...this.registered.values()]
+				.filter((r) => r.visibleTo && (clientId === undefined || !r.visibleTo.includes(clientId)))
+				.map((r) => r.key.kid),
+		);
+		return { keys: this.getPublishedJwks().keys.filter((jwk) => !hidden.has(jwk.kid as string)) };
+	}
+
+	/**
+	 * Every key currently published in the JWKS, with its private half
+	 *
+	 * Only for test clients that need the exact key bytes, e.g. to HMAC-sign
+	 * with the RSA public key as key-confusion does. With `keyId`, the key
+	 * registered under it is included and marked active.
+	 */
+	async exportSigningKeys(keyId?: string): Promise<ExportedSigningKey[]> {
+		const active = this.signingKeyFor(keyId);
+		const keys = this.baseKeys();
+		if (!keys.includes(active)) {
+			keys.push(active);
+		}
+
+		const exported: ExportedSigningKey[] = [];
+		for (const key of keys) {
+			exported.push({
+				kid: key.kid,
+				alg: key.alg,
+				active: key.kid === active.kid,
+				publicJwk: key.publicJwk,
+				privateJwk: key.privateJwk,
+				publicPem: await jose.exportSPKI(key.publicKey),
+				privatePem: await jose.exportPKCS8(key.privateKey),
+			});
+		}
+		return exported;
+	}
+
+	/**
+	 * Re-sign a JWT with the currently active key, or the key registered
+	 * (or the tenant's, by tenantKeyId) as `keyId`
+	 *
+	 * A key set signs with its next key in turn and records the signing. A
+	 * token the set has already signed keeps its key: edits made after
+	 * signing neither move the set on nor count as another signing.
+	 */
+	async resign(
+		jwt: string,
+		tokenType?: string,
+		keyId?: string,
+	): Promise<{ token: string; kid: string; alg: SigningAlgorithm }> {
+		const named = this.namedKey(keyId);
+		const token = parseToken(jwt);
+		const kept = named ? undefined : this.keySet?.keys.find((k) => k.kid === token.header.kid);
+		const key = named ?? kept ?? this.getActiveKey();
+		// Take the key's turn before signing, so concurrent requests get the next keys
+		const keySet = this.keySet && !named && !kept ? this.keySet : undefined;
+		if (keySet) {
+			keySet.next = (keySet.next + 1) % keySet.keys.length;
+		}
+		token.header.kid = key.kid;
+		await token.sign(key.alg, key.privateKey);
+		if (keySet) {
+			this.recordSigning(keySet, key, token.claims, tokenType);
+		}
+		return { token: token.build(), kid: key.kid, alg: key.alg };
+	}
+
+	private recordSigning(
+		keySet: KeySet,
+		key: ManagedKey,
+		claims: Record<string, unknown>,
+		tokenType: string | undefined,
+	): void {
+		keySet.signed.set(key.kid, (keySet.signed.get(key.kid) ?? 0) + 1);
+
+		const signing: KeySigning = { kid: key.kid, signedAt: new Date(this.now()).toISOString() };
+		if (tokenType !== undefined) {
+			signing.tokenType = tokenType;
+		}
+		if (typeof claims.jti === "string") {
+			signing.jti = claims.jti;
+		}
+		if (typeof claims.sub === "string") {
+			signing.sub = claims.sub;
+		}
+		keySet.signings.push(signing);
+		if (keySet.signings.length > MAX_HISTORY) {
+			keySet.signings.shift();
+		}
+	}
+
+	/**
+	 * Describe the rollover plan, or undefined if none is configured
+	 */
+	getRolloverStatus(): RolloverStatus | undefined {
+		const plan = this.plan;
+		if (!plan) {
+			return undefined;
+		}
+
+		const { index } = this.locate(plan, this.now());
+		const active = (plan.steps[index] as RolloverPlan["steps"][number]).key;
+
+		return {
+			startedAt: new Date(plan.startedAt).toISOString(),
+			overlapSeconds: plan.overlapMs / 1000,
+			loop: plan.loop,
+			steps: plan.steps.map((s) => ({
+				alg: s.alg,
+				durationSeconds: s.durationMs / 1000,
+				kid: s.key.kid,
+			})),
+			currentStep: index,
+			activeKey: { kid: active.kid, alg: active.alg },
+			publishedKids: this.publishedKeys(plan).map((k) => k.kid),
+			history: [...plan.history],
+		};
+	}
+
+	/**
+	 * Find the active step at a point in time and record transitions
+	 */
+	private locate(plan: RolloverPlan, at: number): { index: number; start: number; end: number } {
+		const cycleMs = plan.steps.reduce((sum, s) => sum + s.durationMs, 0);
+		let elapsed = Math.max(0, at - plan.startedAt);
+		let cycleStart = plan.startedAt;
+
+		if (plan.loop) {
+			const cycles = Math.floor(elapsed / cycleMs);
+			cycleStart += cycles * cycleMs;
+			elapsed -= cycles * cycleMs;
+		}
+
+		let index = plan.steps.length - 1;
+		let offset = 0;
+		for (let i = 0; i < plan.steps.length; i++) {
+			const duration = (plan.steps[i] as RolloverPlan["steps"][number]).durationMs;
+			if (elapsed < offset + duration) {
+				index = i;
+				break;
+			}
+			if (i < plan.steps.length - 1) {
+				offset += duration;
+			}
+		}
+
+		const step = plan.steps[index] as RolloverPlan["steps"][number];
+		const start = cycleStart + offset;
+		const located = { index, start, end: start + step.durationMs };
+
+		const last = plan.history[plan.history.length - 1];
+		if (!last || last.kid !== step.key.kid) {
+			plan.history.push({
+				step: index,
+				alg: step.alg,
+				kid: step.key.kid,
+				activatedAt: new Date(start).toISOString(),
+			});
+			if (plan.history.length > MAX_HISTORY) {
+				plan.history.shift();
+			}
+		}
+
+		return located;
+	}
+
+	/**
+	 * The registered or tenant key named `keyId`, if any
+	 */
+	private namedKey(keyId: string | undefined): ManagedKey | undefined {
+		if (keyId === undefined) {
+			return undefined;
+		}
+		return this.registered.get(keyId)?.key ?? this.tenantKeys.get(keyId);
+	}
+
+	/**
+	 * The keys the JWKS publishes before registered keys: the key set's, the
+	 * rollover plan's or the primary key
+	 */
+	private baseKeys(): ManagedKey[] {
+		if (this.keySet) {
+			return [...this.keySet.keys];
+		}
+		if (this.plan) {
+			return this.publishedKeys(this.plan);
+		}
+		return [this.primaryKey];
+	}
+
+	/**
+	 * Registered keys whose kid isn't already published by the base keys
+	 */
+	private registeredKeys(): ManagedKey[] {
+		const base = new Set(this.baseKeys().map((k) => k.kid));
+		return [...this.registered.values()].map((r) => r.key).filter((k) => !base.has(k.kid));
+	}
+
+	/**
+	 * Refuse a kid another published or registered key already uses
+	 */
+	private assertKidFree(kid: string): void {
+		const taken = [...this.baseKeys(), ...[...this.registered.values()].map((r) => r.key)];
+		if (taken.some((k) => k.kid === kid)) {
+			throw new Error(`A key with kid '${kid}' is already published`);
+		}
+	}
+
+	/**
+	 * Keys valid at the current time: active key plus neighbours inside the overlap window
+	 */
+	private publishedKeys(plan: RolloverPlan): ManagedKey[] {
+		const at = this.now();
+		const { index, start, end } = this.locate(plan, at);
+		const count = plan.steps.length;
+		const keys: ManagedKey[] = [];
+
+		const isLastStep = index === count - 1 && !plan.loop;
+		const hasPrevious = index > 0 || (plan.loop && start > plan.startedAt);
+
+		if (plan.overlapMs > 0 && hasPrevious && at < start + plan.overlapMs) {
+			const prev = plan.steps[(index - 1 + count) % count];
+			if (prev) keys.push(prev.key);
+		}
+
+		keys.push((plan.steps[index] as RolloverPlan["steps"][number]).key);
+
+		if (plan.overlapMs > 0 && !isLastStep && at >= end - plan.overlapMs) {
+			const next = plan.steps[(index + 1) % count];
+			if (next) keys.push(next.key);
+		}
+
+		// A single-step looping plan would otherwise publish the same key twice
+		return keys.filter((k, i) => keys.findIndex((other) => other.kid === k.kid) === i);
+	}
+}
+
+/**
+ * Validate a key set, throwing a descriptive error if it's invalid
+ */
+export function validateKeySet(config: KeySetConfig): void {
+	const count = config?.count;
+	if (!Number.isInteger(count) || count < 2 || count > MAX_KEY_SET_SIZE) {
+		throw new Error(`count must be an integer from 2 to ${MAX_KEY_SET_SIZE}`);
+	}
+	if (config.alg !== undefined && !SUPPORTED_SIGNING_ALGORITHMS.includes(config.alg)) {
+		throw new Error(
+			`Unsupported algorithm '${String(config.alg)}' (supported: ${SUPPORTED_SIGNING_ALGORITHMS.join(", ")})`,
+		);
+	}
+}
+
+/**
+ * Validate a key registration, throwing a descriptive error if it's invalid
+ */
+export function validateKeyRegistration(registration: KeyRegistration): void {
+	if (typeof registration !== "object" || registration === null) {
+		throw new Error("Key registration must be an object");
+	}
+	if (registration.id !== undefined) {
+		if (typeof registration.id !== "string" || !KEY_ID_PATTERN.test(registration.id)) {
+			throw new Error("id must be 1-64 letters, digits, '_', '.', ':' or '-'");
+		}
+	}
+	if (!SUPPORTED_SIGNING_ALGORITHMS.includes(registration.alg)) {
+		throw new Error(
+			`Unsupported algorithm '${String(registration.alg)}' (supported: ${SUPPORTED_SIGNING_ALGORITHMS.join(", ")})`,
+		);
+	}
+	const jwk = registration.privateJwk;
+	if (jwk !== undefined && (typeof jwk !== "object" || jwk === null || Array.isArray(jwk))) {
+		throw new Error("privateJwk must be a JWK object");
+	}
+	if (registration.visibleTo !== undefined) {
+		validateVisibleTo(registration.visibleTo);
+	}
+}
+
+/**
+ * Validate the clients a key is visible to, throwing if they're invalid
+ */
+function validateVisibleTo(visibleTo: unknown): void {
+	if (
+		!Array.isArray(visibleTo) ||
+		visibleTo.length === 0 ||
+		visibleTo.length > MAX_VISIBLE_CLIENTS ||
+		!visibleTo.every((clientId) => typeof clientId === "string" && clientId.length > 0)
+	) {
+		throw new Error(`visibleTo must be 1-${MAX_VISIBLE_CLIENTS} client IDs`);
+	}
+}
+
+/**
+ * Material for a registered key: imported from a private JWK, or generated
+ */
+function registrationKey(alg: SigningAlgorithm, privateJwk?: jose.JWK): Promise<ManagedKey> {
+	return privateJwk === undefined ? generateSigningKey(alg) : importSigningKey(alg, privateJwk);
+}
+
+function registeredStatus(entry: RegisteredKey): RegisteredKeyStatus {
+	const status: RegisteredKeyStatus = {
+		id: entry.id,
+		kid: entry.key.kid,
+		alg: entry.key.alg,
+		publicJwk: entry.key.publicJwk,
+		registeredAt: new Date(entry.registeredAt).toISOString(),
+		previousKids: [...entry.previousKids],
+	};
+	if (entry.rotatedAt !== undefined) {
+		status.rotatedAt = new Date(entry.rotatedAt).toISOString();
+	}
+	if (entry.visibleTo !== undefined) {
+		status.visibleTo = [...entry.visibleTo];
+	}
+	return status;
+}
+
+/**
+ * Validate a rollover plan, throwing a descriptive error if it's invalid
+ */
+export function validateRolloverPlan(config: RolloverPlanConfig): void {
+	if (!Array.isArray(config?.steps) || config.steps.length === 0) {
+		throw new Error("Rollover plan requires at least one step");
+	}
+
+	for (const [i, step] of config.steps.entries()) {
+		if (!SUPPORTED_SIGNING_ALGORITHMS.includes(step?.alg)) {
+			throw new Error(
+				`Step ${i}: unsupported algorithm '${String(step?.alg)}' (supported: ${SUPPORTED_SIGNING_ALGORITHMS.join(", ")})`,
+			);
+		}
+		if (typeof step.durationSeconds !== "number" || !(step.durationSeconds > 0)) {
+			throw new Error(`Step ${i}: durationSeconds must be a positive number`);
+		}
+	}
+
+	const overlap = config.overlapSeconds ?? 0;
+	if (typeof overlap !== "number" || overlap < 0) {
+		throw new Error("overlapSeconds must be a non-negative number");
+	}
+
+	const shortest = Math.min(...config.steps.map((s) => s.durationSeconds));
+	if (overlap * 2 > shortest) {
+		throw new Error("overlapSeconds must be at most half the shortest step duration");
+	}
+}
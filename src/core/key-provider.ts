@@ -0,0 +1,115 @@
+/**
+ * Key Provider - signing keys loaded rather than generated
+ *
+ * Loki generates its primary signing key on each start unless one is
+ * configured. A configured key is a PEM private key (PKCS#8, PKCS#1 or
+ * SEC1; encrypted with a passphrase or not) fetched from a `KeyProvider`:
+ * a file, an environment variable, or any other source such as a KMS or
+ * Vault behind the same interface. The key's algorithm follows from its
+ * type, and its kid is its JWK thumbprint, so the kid clients cache stays
+ * the same across restarts.
+ */
+
+import { type KeyObject, createPrivateKey } from "node:crypto";
+import { readFile } from "node:fs/promises";
+import type * as jose from "jose";
+import { type ManagedKey, type SigningAlgorithm, importSigningKey } from "./key-manager.js";
+import type { KeyProvider, SigningKeyConfig } from "./types.js";
+
+/** Signing algorithm for each EC curve, by its OpenSSL name */
+const EC_ALGORITHMS: Record<string, SigningAlgorithm> = {
+	prime256v1: "ES256",
+	secp384r1: "ES384",
+	secp521r1: "ES512",
+};
+
+/** Shortest RSA modulus JWS allows (RFC 7518 Section 3.3) */
+const MIN_RSA_BITS = 2048;
+
+/**
+ * Reads the PEM from a file, e.g. one mounted from a secret store
+ */
+export class FileKeyProvider implements KeyProvider {
+	readonly source: string;
+
+	constructor(private readonly path: string) {
+		this.source = `file ${path}`;
+	}
+
+	async loadPem(): Promise<string> {
+		return readFile(this.path, "utf8");
+	}
+}
+
+/**
+ * Reads the PEM from an environment variable
+ */
+export class EnvKeyProvider implements KeyProvider {
+	readonly source: string;
+
+	constructor(
+		private readonly variable = "LOKI_SIGNING_KEY_PEM",
+		private readonly env: NodeJS.ProcessEnv = process.env,
+	) {
+		this.source = `environment variable ${variable}`;
+	}
+
+	async loadPem(): Promise<string> {
+		const pem = this.env[this.variable];
+		if (!pem) {
+			throw new Error(`${this.variable} is not set`);
+		}
+		return pem;
+	}
+}
+
+/**
+ * Load the configured signing key; errors name the provider's source
+ */
+export async function loadSigningKey(config: SigningKeyConfig): Promise<ManagedKey> {
+	const { provider, passphrase } = config;
+	try {
+		const pem = await provider.loadPem();
+		return await importPemSigningKey(pem, passphrase);
+	} catch (err) {
+		throw new Error(`Cannot load signing key from ${provider.source}: ${(err as Error).message}`);
+	}
+}
+
+/**
+ * Import a PEM private key as a signing key, its algorithm picked by key
+ * type: RS256 for RSA, ES256/384/512 by EC curve, EdDSA for Ed25519
+ */
+export async function importPemSigningKey(pem: string, passphrase?: string): Promise<ManagedKey> {
+	let key: KeyObject;
+	try {
+		key = createPrivateKey(passphrase === undefined ? pem : { key: pem, passphrase });
+	} catch (err) {
+		throw new Error(`not a PEM private key: ${(err as Error).message}`);
+	}
+
+	const alg = signingAlgorithm(key);
+	return importSigningKey(alg, key.export({ format: "jwk" }) as jose.JWK);
+}
+
+function signingAlgorithm(key: KeyObject): SigningAlgorithm {
+	const details = key.asymmetricKeyDetails ?? {};
+	switch (key.asymmetricKeyType) {
+		case "rsa":
+			if ((details.modulusLength ?? 0) < MIN_RSA_BITS) {
+				throw new Error(`RSA keys must be at least ${MIN_RSA_BITS} bits`);
+			}
+			return "RS256";
+		case "ec": {
+			const alg = EC_ALGORITHMS[details.namedCurve ?? ""];
+			if (!alg) {
+				throw new Error(`EC curve ${details.namedCurve} is not P-256, P-384 or P-521`);
+			}
+			return alg;
+		}
+		case "ed25519":
+			return "EdDSA";
+		default:
+			throw new Error(`${key.asymmetricKeyType} keys can't sign tokens`);
+	}
+}
@@ -0,0 +1,201 @@
+/**
+ * Live Events - a session's token activity, streamed as it happens
+ *
+ * Each token issued to a session, and each introspection or revocation of
+ * one, is published to whoever is watching the session (the admin API's
+ * server-sent events stream), so a dashboard follows a run without polling
+ * the report. Events identify the token by its SHA-256 fingerprint rather
+ * than carrying it. Nothing is kept for sessions nobody watches, and each
+ * watcher gets a bounded buffer: a consumer that falls behind loses its
+ * oldest undelivered events, and is told how many, rather than growing
+ * Loki's memory.
+ */
+
+import { createHash } from "node:crypto";
+
+/** Events buffered per watcher before the oldest are dropped */
+const DEFAULT_MAX_BUFFERED = 256;
+
+export type LiveEventType = "token.issued" | "token.introspected" | "token.revoked";
+
+export interface LiveEvent {
+	type: LiveEventType;
+	sessionId: string;
+	/** Position among the session's events published while watched, from 1 */
+	seq: number;
+	timestamp: string;
+	/** Correlation ID of the request that produced the event */
+	requestId: string | null;
+	/** The token's type, null when Loki doesn't know the token */
+	tokenType: string | null;
+	jti: string | null;
+	/** Mischief applied: to the token when issued, to the endpoint otherwise */
+	mischief: string[];
+	/** SHA-256 of the token as sent or presented, base64url */
+	fingerprint: string;
+	/** What else the event records, e.g. whether introspection reported the token active */
+	details: Record<string, unknown>;
+}
+
+/** A live event before the hub numbers it */
+export type LiveEventInput = Omit<LiveEvent, "seq" | "timestamp">;
+
+/**
+ * The fingerprint a token is identified by: SHA-256 of its exact string, base64url
+ */
+export function tokenFingerprint(token: string): string {
+	return createHash("sha256").update(token).digest("base64url");
+}
+
+/**
+ * One watcher's view of a session's live events
+ */
+export class LiveSubscription {
+	private readonly buffer: LiveEvent[] = [];
+	private droppedCount = 0;
+	private waiting: ((event: LiveEvent | null | undefined) => void) | null = null;
+	private closed = false;
+
+	constructor(
+		private readonly maxBuffered: number,
+		private readonly onClose: () => void,
+	) {}
+
+	/**
+	 * The next event; null if none arrives within `timeoutMs`, undefined once
+	 * the subscription is closed
+	 */
+	next(timeoutMs: number): Promise<LiveEvent | null | undefined> {
+		const event = this.buffer.shift();
+		if (event || this.closed) {
+			return Promise.resolve(event);
+		}
+		return new Promise((resolve) => {
+			const timer = setTimeout(() => {
+				this.waiting = null;
+				resolve(null);
+			}, timeoutMs);
+			this.waiting = (next) => {
+				clearTimeout(timer);
+				this.waiting = null;
+				resolve(next);
+			};
+		});
+	}
+
+	/**
+	 * How many events were dropped since the last call, for a consumer
+	 * that fell behind
+	 */
+	takeDropped(): number {
+		const dropped = this.droppedCount;
+		this.droppedCount = 0;
+		return dropped;
+	}
+
+	/**
+	 * Stop receiving events; a pending next() resolves undefined
+	 */
+	close(): void {
+		if (this.closed) {
+			return;
+		}
+		this.closed = true;
+		this.buffer.length = 0;
+		this.waiting?.(undefined);
+		this.onClose();
+	}
+
+	/**
+	 * Deliver an event, dropping the oldest buffered one if the buffer is full
+	 */
+	push(event: LiveEvent): void {
+		if (this.waiting) {
+			this.waiting(event);
+			return;
+		}
+		if (this.buffer.length >= this.maxBuffered) {
+			this.buffer.shift();
+			this.droppedCount++;
+		}
+		this.buffer.push(event);
+	}
+}
+
+/**
+ * Live Event Hub - fans a session's events out to its watchers
+ */
+export class LiveEventHub {
+	private readonly watchers = new Map<string, Set<LiveSubscription>>(); // sessionId -> watchers
+	private readonly lastSeq = new Map<string, number>(); // sessionId -> last seq published
+
+	/**
+	 * Watch a session's events from now on
+	 */
+	subscribe(sessionId: string, maxBuffered = DEFAULT_MAX_BUFFERED): LiveSubscription {
+		if (!(Number.isInteger(maxBuffered) && maxBuffered >= 1)) {
+			throw new Error(`maxBuffered must be a positive integer, got ${maxBuffered}`);
+		}
+		const subscription = new LiveSubscription(maxBuffered, () => {
+			const watchers = this.watchers.get(sessionId);
+			watchers?.delete(subscription);
+			if (watchers?.size === 0) {
+				this.watchers.delete(sessionId);
+			}
+		});
+		const watchers = this.watchers.get(sessionId) ?? new Set();
+		watchers.add(subscription);
+		this.watchers.set(sessionId, watchers);
+		return subscription;
+	}
+
+	/**
+	 * Publish an event to the session's watchers, if it has any
+	 */
+	publish(input: LiveEventInput): LiveEvent | undefined {
+		const watchers = this.watchers.get(input.sessionId);
+		if (!watchers) {
+			return undefined;
+		}
+		const seq = (this.lastSeq.get(input.sessionId) ?? 0) + 1;
+		this.lastSeq.set(input.sessionId, seq);
+		const event: LiveEvent = { ...input, seq, timestamp: new Date().toISOString() };
+		for (const watcher of watchers) {
+			watcher.push(event);
+		}
+		return event;
+	}
+
+	/**
+	 * Number of watchers, across sessions or of one
+	 */
+	watcherCount(sessionId?: string): number {
+		if (sessionId !== undefined) {
+			return this.watchers.get(sessionId)?.size ?? 0;
+		}
+		let count = 0;
+		for (const watchers of this.watchers.values()) {
+			count += watchers.size;
+		}
+		return count;
+	}
+
+	/**
+	 * End a session's streams (the session was deleted) and forget it
+	 */
+	clear(sessionId: string): void {
+		for (const watcher of [...(this.watchers.get(sessionId) ?? [])]) {
+			watcher.close();
+		}
+		this.lastSeq.delete(sessionId);
+	}
+
+	/**
+	 * End every stream, e.g. on shutdown
+	 */
+	closeAll(): void {
+		for (const sessionId of [...this.watchers.keys()]) {
+			this.clear(sessionId);
+		}
+	}
+}
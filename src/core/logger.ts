@@ -0,0 +1,102 @@
+/**
+ * Logger - structured JSON log lines, one object per line
+ *
+ * Every line carries the time, level and message, plus the ID of the
+ * request being served when there is one, so the lines a request produced
+ * can be found by the `X-Loki-Request-Id` its response carried:
+ *
+ *   {"time":"...","level":"info","msg":"request","requestId":"req_...","endpoint":"/token",...}
+ *
+ * Lines below the configured level are dropped; `silent` drops them all.
+ */
+
+import type { ServerResponse } from "node:http";
+import { activeRequestId } from "./request-id.js";
+
+export const LOG_LEVELS = ["debug", "info", "warn", "error", "silent"] as const;
+export type LogLevel = (typeof LOG_LEVELS)[number];
+
+export interface LoggerOptions {
+	/** Least severe level written (default: info) */
+	level?: LogLevel;
+	/** Where lines go (default: stdout) */
+	write?: (line: string) => void;
+	now?: () => Date;
+}
+
+export function isLogLevel(value: unknown): value is LogLevel {
+	return typeof value === "string" && (LOG_LEVELS as readonly string[]).includes(value);
+}
+
+/**
+ * How a request ended: by its status, or `aborted` if the client went away
+ * before the response was sent
+ */
+export function responseOutcome(
+	res: Pick<ServerResponse, "statusCode" | "writableFinished">,
+): "ok" | "client-error" | "server-error" | "aborted" {
+	if (!res.writableFinished) {
+		return "aborted";
+	}
+	if (res.statusCode >= 500) {
+		return "server-error";
+	}
+	if (res.statusCode >= 400) {
+		return "client-error";
+	}
+	return "ok";
+}
+
+/**
+ * Logger - writes JSON lines at or above a level
+ */
+export class Logger {
+	private readonly threshold: number;
+	private readonly write: (line: string) => void;
+	private readonly now: () => Date;
+
+	constructor(options: LoggerOptions = {}) {
+		this.threshold = LOG_LEVELS.indexOf(options.level ?? "info");
+		this.write = options.write ?? ((line) => process.stdout.write(`${line}\n`));
+		this.now = options.now ?? (() => new Date());
+	}
+
+	/**
+	 * Whether lines at `level` are written
+	 */
+	enabled(level: Exclude<LogLevel, "silent">): boolean {
+		return LOG_LEVELS.indexOf(level) >= this.threshold;
+	}
+
+	debug(msg: string, fields?: Record<string, unknown>): void {
+		this.log("debug", msg, fields);
+	}
+
+	info(msg: string, fields?: Record<string, unknown>): void {
+		this.log("info", msg, fields);
+	}
+
+	warn(msg: string, fields?: Record<string, unknown>): void {
+		this.log("warn", msg, fields);
+	}
+
+	error(msg: string, fields?: Record<string, unknown>): void {
+		this.log("error", msg, fields);
+	}
+
+	private log(
+		level: Exclude<LogLevel, "silent">,
+		msg: string,
+		fields: Record<string, unknown> = {},
+	): void {
+		if (!this.enabled(level)) {
+			return;
+		}
+		const line: Record<string, unknown> = { time: this.now().toISOString(), level, msg };
+		const requestId = activeRequestId();
+		if (requestId !== undefined) {
+			line.requestId = requestId;
+		}
+		this.write(JSON.stringify({ ...line, ...fields }));
+	}
+}
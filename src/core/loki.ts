@@ -3,45 +3,423 @@
  */
 
 import { existsSync, mkdirSync } from "node:fs";
-import { type IncomingMessage, type Server, ServerResponse, createServer } from "node:http";
+import { type IncomingMessage, type Server, type ServerResponse, createServer } from "node:http";
+import { type Server as HttpsServer, createServer as createHttpsServer } from "node:https";
 import { dirname } from "node:path";
+import { Readable } from "node:stream";
+import { pipeline } from "node:stream/promises";
+import { gzipSync } from "node:zlib";
 import type { Hono } from "hono";
 import * as jose from "jose";
-import { nanoid } from "nanoid";
 import type Provider from "oidc-provider";
 import { createAdminApi } from "../admin/routes.js";
-import type { MischiefLedger } from "../ledger/types.js";
+import type { MischiefLedger, OutcomeReport } from "../ledger/types.js";
 import { LokiDatabase } from "../persistence/database.js";
+import { JsonFileStore } from "../persistence/json-store.js";
+import { RedisSessionStore } from "../persistence/redis-store.js";
+import {
+	STORE_KINDS,
+	type SessionStore,
+	type SharedSessionStore,
+	isSharedStore,
+} from "../persistence/session-store.js";
 import { PluginRegistry } from "../plugins/registry.js";
+import type { EndpointContext } from "../plugins/types.js";
+import { AttackRotation, type AttackRotationStatus } from "./attack-rotation.js";
+import { generatedAttackerKeys } from "./attacker-keys.js";
+import { formatAudience } from "./aud-format.js";
+import {
+	type AuthorizationDetail,
+	AuthorizationDetailsStore,
+	parseAuthorizationDetails,
+} from "./authorization-details.js";
+import { CHAOS_PHASES, ChaosMode, type ChaosStatus } from "./chaos-mode.js";
+import { ClaimSourceStore } from "./claim-sources.js";
+import { verifyClientAssertion } from "./client-assertion.js";
+import {
+	authenticatesWithSecret,
+	checkClientAuth,
+	clientType,
+	presentedAuthMethod,
+	stripClientCredentials,
+	withClientSecret,
+} from "./client-auth.js";
+import {
+	type ClientRegistration,
+	ClientRegistry,
+	type ClientStatus,
+} from "./client-registry.js";
+import { ConcurrencyLimiter } from "./concurrency-limiter.js";
+import {
+	DEFAULT_POLLING_INTERVAL,
+	DEVICE_CODE_GRANT,
+	DeviceCodeLedger,
+} from "./device-authorization.js";
+import {
+	type DpopNonceExchange,
+	type DpopNonceMode,
+	dpopProofNonce,
+	generateDpopNonce,
+	sendUseDpopNonce,
+} from "./dpop-nonce.js";
+import { DpopJtiCache, bindDpopKey, verifyDpopProof } from "./dpop-proof.js";
+import {
+	disabledEndpointAt,
+	disabledEndpoints,
+	withoutDisabledEndpoints,
+} from "./endpoint-flags.js";
+import { ENDPOINT_METHODS, optionsHeaders } from "./endpoint-methods.js";
+import { lokiError, oauthError, sendError, sendInternalError } from "./errors.js";
+import { EventLog, type SessionEvent } from "./event-log.js";
+import { FaultInjector } from "./fault-injector.js";
+import { grantProfile, toMachineClaims } from "./grant-claims.js";
+import { type Har, HarRecorder } from "./har-recorder.js";
+import {
+	headerValue,
+	parseParams,
+	readBody,
+	replayRequest,
+	requestClientId,
+	setHeaderValue,
+} from "./http-utils.js";
+import { type IdTokenEncryption, encryptIdToken } from "./id-token-encryption.js";
 import {
+	type InteractionPresentation,
+	decorateInteractionPage,
+	resolveDisplay,
+	resolveLocale,
+} from "./interaction-page.js";
+import {
+	INTROSPECTION_PATH,
+	type IssuedToken,
+	type TokenState,
+	introspectionResponse,
+	tokenState,
+} from "./introspection.js";
+import {
+	type CandidateKey,
+	type IssuanceContext,
+	IssuanceLog,
+	type SessionReport,
+	type TokenIssuance,
+	type TokenMutation,
+	signingKeyOf,
+} from "./issuance-log.js";
+import {
+	JWKS_UNAUTHORIZED,
+	type JwksEncoding,
+	type JwksFetch,
+	acceptsGzip,
+	jwksFetch,
+	refusesJwksFetch,
+} from "./jwks-auth.js";
+import {
+	type ExportedSigningKey,
+	KeyManager,
+	SUPPORTED_SIGNING_ALGORITHMS,
+	type SigningAlgorithm,
+	generateSigningKey,
+	importSigningKey,
+	tenantKeyId,
+} from "./key-manager.js";
+import { loadSigningKey } from "./key-provider.js";
+import { LiveEventHub, type LiveSubscription, tokenFingerprint } from "./live-events.js";
+import { LOG_LEVELS, Logger, isLogLevel, responseOutcome } from "./logger.js";
+import {
+	type MaxAgeRequest,
+	MaxAgeRequests,
+	authTimeHonors,
+	parseMaxAge,
+	requireLogin,
+	withoutMaxAge,
+} from "./max-age.js";
+import {
+	type DiscoveryServed,
+	type MischiefApplication,
 	MischiefEngine,
 	type MischiefEngineOptions,
 	type RequestContext,
+	type TokenServed,
 } from "./mischief-engine.js";
-import { createProvider } from "./provider-adapter.js";
-import { DEFAULT_CONFIG, type LokiConfig, type Session, type SessionConfig } from "./types.js";
+import { Metrics, endpointLabel } from "./metrics.js";
+import { bindCertificate, clientCertificateThumbprint } from "./mtls.js";
+import {
+	PkceBindings,
+	upgradePlainChallenge,
+	verifierMatches,
+	withS256Challenge,
+} from "./pkce.js";
+import { drawMischief, randomSeed } from "./probabilistic-draw.js";
+import {
+	type ProviderAdapterOptions,
+	createProvider,
+	registeredRedirectUris,
+} from "./provider-adapter.js";
+import { random, randomId, seedRandom } from "./random.js";
+import { type ComponentState, type ReadinessReport, readinessReport } from "./readiness.js";
+import {
+	AcceptedRedirectUris,
+	type RedirectUriCheck,
+	redirectUriRegistered,
+} from "./redirect-uri.js";
+import { RefreshLedger, type RefreshLedgerReport, isOpaqueRefreshToken } from "./refresh-ledger.js";
+import {
+	LOKI_REQUEST_ID_HEADER,
+	REQUEST_ID_HEADER,
+	type RequestTrace,
+	currentRequestId,
+	resolveRequestId,
+	withRequestId,
+} from "./request-id.js";
+import {
+	ClaimsRequests,
+	type RequestedClaims,
+	claimsDelivery,
+	parseClaimsRequest,
+	withRequestedClaims,
+} from "./request-claims.js";
+import { NonceRequests } from "./request-nonce.js";
+import {
+	DEFAULT_RESOURCE,
+	ResourceRequests,
+	invalidResource,
+	parseResources,
+	resourceAudience,
+	withoutResources,
+} from "./request-resource.js";
+import { ScopeRequests, parseScope } from "./request-scope.js";
+import { RequestObjectReplayCache, requestObjectJti } from "./request-object.js";
+import { isResponseMode, withResponseMode } from "./response-mode.js";
+import {
+	REVOCATION_PATH,
+	RevocationList,
+	type RevocationListFormat,
+	tokenIdentifier,
+} from "./revocation-list.js";
+import {
+	METADATA_PATHS,
+	type ProviderMetadata,
+	metadataDocumentAt,
+	renderMetadata,
+} from "./provider-metadata.js";
+import { RogueJwksStore } from "./rogue-jwks.js";
+import { discloseClaims } from "./sd-jwt.js";
+import { EvictedSessions, SWEEP_INTERVAL_MS, expiresAt, isTtl } from "./session-expiry.js";
+import { querySessionId, withSessionQuery } from "./session-query.js";
+import { type SessionStats, SessionStatsStore } from "./session-stats.js";
+import { CidrSet, conditionCidrs, resolveSourceAddress } from "./source-address.js";
+import { TenantRegistry, type TenantStatus, tenantMetadata } from "./tenants.js";
+import {
+	FORM_MEDIA_TYPE,
+	JSON_MEDIA_TYPE,
+	formEncodeTokenResponse,
+	mediaTypeOf,
+	negotiateTokenMediaType,
+} from "./token-content-type.js";
+import {
+	ACCESS_TOKEN_TYPE,
+	EXCHANGED_TOKEN_LIFETIME,
+	TOKEN_EXCHANGE_GRANT,
+	type TokenExchange,
+	actorChain,
+	delegate,
+	mayAct,
+	parseExchangeRequest,
+} from "./token-exchange.js";
+import { type JWTClaims, createToken, parseToken, tokenHash } from "./token-forge.js";
+import { refreshTokenTimes } from "./token-freeze.js";
+import { tokenLifetimeSeconds } from "./token-lifetime.js";
+import { type SessionResults, TokenResults, tokenJti } from "./token-results.js";
+import {
+	type TopologyParseResult,
+	type TopologyPlanResult,
+	diffTopology,
+	exportTopology,
+	parseTopology,
+} from "./topology.js";
+import { TransientKeyStore } from "./transient-keys.js";
+import {
+	type AttackRotationConfig,
+	type AudFormat,
+	type ChaosConfig,
+	DEFAULT_CONFIG,
+	type LokiConfig,
+	type SdJwtConfig,
+	type Session,
+	type SessionConfig,
+	type SessionFreeze,
+	type SessionsConfig,
+	type SigningKeyConfig,
+	type TopologyDocument,
+} from "./types.js";
+import { USERINFO_PATHS, accountClaims, claimsForScopes, isAccessTokenJwt } from "./userinfo.js";
+import { WebhookDispatcher, isWebhookUrl, tokenIssuedEvent } from "./webhooks.js";
+import { certificateThumbprints } from "./x509.js";
+
+/** The token mischief applied to a JWT, and the token it was applied to */
+interface AppliedMischief {
+	original: string;
+	applications: MischiefApplication[];
+}
+
+/** The token mischief applied to each JWT in a token response */
+interface IssuedMischief {
+	access_token?: AppliedMischief;
+	id_token?: AppliedMischief;
+}
+
+/** The longest timeout setTimeout can hold (about 24.8 days) */
+const MAX_TIMEOUT_MS = 2 ** 31 - 1;
+
+/** Size of each piece a chunked JWKS is written in */
+const JWKS_CHUNK_BYTES = 512;
 
 export class Loki {
-	private readonly config: Required<LokiConfig>;
-	private server: Server | null = null;
+	private readonly config: Required<
+		Omit<
+			LokiConfig,
+			"topology" | "attackOfTheDay" | "chaos" | "webhook" | "har" | "seed" | "signingKey"
+		>
+	>;
+	private readonly topology: TopologyDocument | undefined;
+	private readonly attackOfTheDay: AttackRotationConfig | undefined;
+	private readonly chaosConfig: ChaosConfig | undefined;
+	/** Where the primary signing key is loaded from; generated if unset */
+	private readonly signingKey: SigningKeyConfig | undefined;
+	/** Global webhook URL; sessions may name their own */
+	private readonly webhookUrl: string | undefined;
+	private readonly webhooks: WebhookDispatcher;
+	private attackRotation: AttackRotation | null = null;
+	private chaos: ChaosMode | null = null;
+	private server: Server | HttpsServer | null = null;
+	/** Serves everything but the probes, once start() has everything ready */
+	private handler: ((req: IncomingMessage, res: ServerResponse) => void) | null = null;
+	/** Whether the signing keys (and tenants' keys) are generated or loaded */
+	private keysReady = false;
 	private provider: Provider | null = null;
 	private mischiefEngine: MischiefEngine | null = null;
-	private database: LokiDatabase | null = null;
+	private database: SessionStore | null = null;
 	private adminApi: Hono | null = null;
 	private readonly sessions = new Map<string, Session>();
 	private readonly pluginRegistry: PluginRegistry;
-	private jwksCache: string | null = null;
+	private readonly keyManager = new KeyManager();
+	private eventLog: EventLog;
+	/** Token activity streamed to the sessions' watchers */
+	private readonly liveEvents = new LiveEventHub();
+	private claimSources: ClaimSourceStore | null = null;
+	private rogueJwks: RogueJwksStore | null = null;
+	private revocationList: RevocationList | null = null;
+	private readonly requestObjects = new RequestObjectReplayCache();
+	private readonly refreshLedger = new RefreshLedger();
+	private readonly deviceCodes = new DeviceCodeLedger();
+	private readonly pkceBindings = new PkceBindings();
+	private readonly tokenResults = new TokenResults();
+	private readonly issuanceLog = new IssuanceLog();
+	private readonly sessionStats = new SessionStatsStore();
+	private readonly authorizationDetails = new AuthorizationDetailsStore();
+	private readonly maxAgeRequests = new MaxAgeRequests();
+	private readonly nonceRequests = new NonceRequests();
+	private readonly acceptedRedirectUris = new AcceptedRedirectUris();
+	private readonly claimsRequests = new ClaimsRequests();
+	private readonly scopeRequests = new ScopeRequests();
+	private readonly resourceRequests = new ResourceRequests();
+	private readonly transientKeys = new TransientKeyStore();
+	/** Each session's HTTP exchanges, for its HAR export */
+	private readonly harRecorder: HarRecorder;
+	private readonly clients: ClientRegistry;
+	private readonly tenants: TenantRegistry;
+	/** The tenant each request in flight was addressed to, by its response */
+	private readonly tenantRequests = new WeakMap<ServerResponse, TenantStatus>();
+	/** The last token response body each session sent, byte for byte */
+	private readonly lastTokenResponses = new Map<string, string>();
+	/** DPoP nonce decisions for token requests on their way to the provider */
+	private readonly dpopExchanges = new WeakMap<IncomingMessage, DpopNonceExchange>();
+	/** The DPoP key each token request in flight proved possession of, by its response */
+	private readonly dpopThumbprints = new WeakMap<ServerResponse, string>();
+	private readonly dpopJtis = new DpopJtiCache();
+	/** Token exchanges Loki answered, by their response: the audience asked for and actors issued */
+	private readonly tokenExchanges = new WeakMap<ServerResponse, TokenExchange>();
+	/** The grant_type of each token request in flight, by its response */
+	private readonly tokenGrants = new WeakMap<ServerResponse, string>();
+	private readonly faultInjector: FaultInjector;
+	private readonly concurrencyLimiter: ConcurrencyLimiter;
+	/** Issuance, mischief and request counters served at /metrics */
+	private readonly metrics = new Metrics();
+	/** Sessions evicted by their ttl, answered with 410 */
+	private readonly evictedSessions = new EvictedSessions();
+	private expirySweep: NodeJS.Timeout | null = null;
+	/** Set while stop() waits for requests in flight */
+	private draining = false;
+	/** Releases for responses mischief is holding back, called when stop() begins */
+	private readonly heldResponses = new Set<() => void>();
+	private readonly trustedProxies: CidrSet;
+	/** Networks requests may come from; undefined allows any */
+	private readonly allowedSources: CidrSet | undefined;
+	/** Endpoints switched off by config: they 404 and discovery omits them */
+	private readonly disabledEndpoints: ReadonlySet<string>;
+	private readonly logger: Logger;
+	/** Plugins applied by each request in flight, for its log line */
+	private readonly requestMischief = new Map<string, string[]>();
 
 	/** The issuer URL for this Loki instance */
 	public readonly issuer: string;
 
 	constructor(config: LokiConfig) {
 		this.config = this.mergeConfig(config);
+		if (config.seed !== undefined) {
+			seedRandom(config.seed);
+		}
 		this.issuer = this.config.provider.issuer;
+		this.topology = config.topology;
+		this.attackOfTheDay = config.attackOfTheDay;
+		this.chaosConfig = config.chaos;
+		this.signingKey = config.signingKey;
+		const { url: webhookUrl, ...webhookOptions } = config.webhook ?? {};
+		if (webhookUrl !== undefined && !isWebhookUrl(webhookUrl)) {
+			throw new Error(`webhook.url must be an absolute http(s) URL, got '${webhookUrl}'`);
+		}
+		this.webhookUrl = webhookUrl;
+		this.webhooks = new WebhookDispatcher(webhookOptions);
+		const { logLevel = "warn" } = this.config.server;
+		if (!isLogLevel(logLevel)) {
+			throw new Error(`server.logLevel must be one of ${LOG_LEVELS.join(", ")}, got '${logLevel}'`);
+		}
+		this.logger = new Logger({ level: logLevel });
+		const { store } = this.config.persistence;
+		if (store !== undefined && !STORE_KINDS.includes(store)) {
+			throw new Error(`persistence.store must be one of ${STORE_KINDS.join(", ")}, got '${store}'`);
+		}
+		const { ttl } = this.config.sessions;
+		if (ttl !== undefined && !isTtl(ttl)) {
+			throw new Error(`sessions.ttl must be a Go duration of at least 1s, got '${ttl}'`);
+		}
 		this.pluginRegistry = new PluginRegistry(this.config.plugins);
+		this.faultInjector = new FaultInjector(this.config.faults, {
+			onFault: (fault) => {
+				this.logger.warn("fault injected", { endpoint: fault.endpoint, status: fault.status });
+			},
+		});
+		this.concurrencyLimiter = new ConcurrencyLimiter(this.config.server.maxInFlightRequests ?? 0);
+		this.eventLog = new EventLog({
+			maxEventsPerSession: this.config.sessions.maxEventsPerSession ?? 0,
+		});
+		this.trustedProxies = new CidrSet(this.config.server.trustedProxies ?? []);
+		const { allowedSources } = this.config.server;
+		this.allowedSources = allowedSources?.length ? new CidrSet(allowedSources) : undefined;
+		this.disabledEndpoints = disabledEndpoints(this.config.provider.endpoints ?? {});
+		this.clients = new ClientRegistry(this.config.provider.clients);
+		this.tenants = new TenantRegistry(this.issuer, this.config.provider.tenants);
+		this.harRecorder = new HarRecorder(config.har, (id) => this.sessions.has(id));
 	}
 
-	private mergeConfig(config: LokiConfig): Required<LokiConfig> {
+	private mergeConfig(
+		config: LokiConfig,
+	): Required<
+		Omit<
+			LokiConfig,
+			"topology" | "attackOfTheDay" | "chaos" | "webhook" | "har" | "seed" | "signingKey"
+		>
+	> {
 		return {
 			server: { ...DEFAULT_CONFIG.server, ...config.server },
 			provider: config.provider,
@@ -49,6 +427,8 @@ export class Loki {
 			plugins: { ...DEFAULT_CONFIG.plugins, ...config.plugins },
 			ledger: { ...DEFAULT_CONFIG.ledger, ...config.ledger },
 			persistence: { ...DEFAULT_CONFIG.persistence, ...config.persistence },
+			faults: { ...DEFAULT_CONFIG.faults, ...config.faults },
+			sessions: { ...DEFAULT_CONFIG.sessions, ...config.sessions },
 		};
 	}
 
@@ -60,40 +440,187 @@ export class Loki {
 			throw new Error("Loki is already running");
 		}
 
-		// Initialize database if persistence is enabled
+		// Listen first, so liveness and readiness probes are answered while the
+		// keys are generated and the store connects; other requests are turned
+		// away until everything is ready. Over TLS any client certificate is
+		// accepted; it only names the key tokens are bound to
+		const { tls, port, host } = this.config.server;
+		const dispatch = (req: IncomingMessage, res: ServerResponse) => this.dispatch(req, res);
+		const server = tls
+			? createHttpsServer({ ...tls, requestCert: true, rejectUnauthorized: false }, dispatch)
+			: createServer(dispatch);
+		this.server = server;
+		await new Promise<void>((resolve) => {
+			server.listen(port, host, () => resolve());
+		});
+
+		try {
+			await this.prepare();
+		} catch (err) {
+			this.server = null;
+			this.keysReady = false;
+			await new Promise<void>((resolve) => server.close(() => resolve()));
+			throw err;
+		}
+
+		this.expirySweep = setInterval(() => this.evictExpiredSessions(), SWEEP_INTERVAL_MS);
+		this.expirySweep.unref();
+	}
+
+	/**
+	 * Load plugins, open the store, generate the signing keys and build the
+	 * provider and router; requests are served once this resolves
+	 */
+	private async prepare(): Promise<void> {
+		// Load plugins
+		await this.pluginRegistry.loadBuiltIn();
+		await this.pluginRegistry.discoverCustom();
+
+		// Open the session store once every plugin is loaded, so stored plugin
+		// config can be migrated to the schema versions now in use
 		if (this.config.persistence.enabled) {
-			const dbPath = this.config.persistence.path;
-			const dbDir = dirname(dbPath);
-			if (!existsSync(dbDir)) {
-				mkdirSync(dbDir, { recursive: true });
-			}
-			this.database = new LokiDatabase({ path: dbPath });
+			const db = await this.openStore();
+			this.database = db;
+			this.eventLog = new EventLog({
+				onEvent: (event) => db.saveEvent(event),
+				maxEventsPerSession: this.config.sessions.maxEventsPerSession ?? 0,
+				onRotate: (sessionId, throughSeq) => db.deleteEventsThrough(sessionId, throughSeq),
+			});
 
-			// Load existing sessions from database
-			const storedSessions = this.database.loadAllSessions();
+			// Load existing sessions (with their event timelines, issuances and
+			// last token responses) from the store
+			const storedSessions = db.loadAllSessions();
 			for (const session of storedSessions) {
 				this.sessions.set(session.id, session);
+				this.eventLog.restore(db.loadEvents(session.id));
+				this.issuanceLog.restore(session.id, db.loadIssuances(session.id));
+				const lastTokenResponse = db.loadLastTokenResponse(session.id);
+				if (lastTokenResponse !== undefined) {
+					this.lastTokenResponses.set(session.id, lastTokenResponse);
+				}
 			}
 		}
 
-		// Load plugins
-		await this.pluginRegistry.loadBuiltIn();
-		await this.pluginRegistry.discoverCustom();
+		// Reconcile declared sessions once persisted ones and every plugin are loaded,
+		// so a restart is a no-op and plugin config can be checked and migrated
+		if (this.topology) {
+			const result = this.applyTopology(this.topology);
+			if (!result.ok) {
+				throw new Error(`Invalid topology: ${result.errors.join("; ")}`);
+			}
+		}
+
+		// The attack of the day rotates through the plugins loaded above
+		if (this.attackOfTheDay) {
+			const catalog = this.pluginRegistry.getAll().map((plugin) => plugin.id);
+			let rotation: AttackRotation;
+			try {
+				rotation = new AttackRotation(this.attackOfTheDay, catalog);
+			} catch (err) {
+				throw new Error(`Invalid attack of the day: ${(err as Error).message}`);
+			}
+			if (this.sessions.get(rotation.sessionId)?.declared) {
+				throw new Error(`Invalid attack of the day: session '${rotation.sessionId}' is declared`);
+			}
+			this.attackRotation = rotation;
+			this.rotateAttackOfTheDay(rotation, false);
+		}
+
+		// Chaos draws from the loaded plugins that act on a token response
+		if (this.chaosConfig) {
+			const catalog = this.pluginRegistry
+				.getAll()
+				.filter((plugin) => CHAOS_PHASES.includes(plugin.phase))
+				.map((plugin) => plugin.id);
+			try {
+				this.chaos = new ChaosMode(this.chaosConfig, catalog);
+			} catch (err) {
+				throw new Error(`Invalid chaos config: ${(err as Error).message}`);
+			}
+			if (this.sessions.get(this.chaos.sessionId)?.declared) {
+				throw new Error(`Invalid chaos config: session '${this.chaos.sessionId}' is declared`);
+			}
+		}
+
+		// Load or generate signing keys before the provider needs them; without
+		// a configured key, replicas sharing a store all sign with the first one's
+		if (this.signingKey) {
+			await this.keyManager.initialize(await loadSigningKey(this.signingKey));
+		} else if (this.database && isSharedStore(this.database)) {
+			const candidate = await generateSigningKey("RS256");
+			const claimed = await this.database.claimSigningKey(candidate.privateJwk);
+			await this.keyManager.initialize(await importSigningKey("RS256", claimed));
+		} else {
+			await this.keyManager.initialize();
+		}
+		for (const tenant of this.tenants.list()) {
+			await this.keyManager.addTenantKey(tenant.id);
+		}
+		this.keysReady = true;
 
 		// Create OIDC provider
-		this.provider = createProvider({ config: this.config.provider });
+		this.provider = createProvider({
+			config: this.config.provider,
+			jwks: this.keyManager.getProviderJwks() as NonNullable<ProviderAdapterOptions["jwks"]>,
+			requireDpopNonce: (ctx) => this.dpopExchanges.get(ctx.req)?.requireNonce === true,
+			findClient: (clientId) => this.clients.registered(clientId),
+			acceptRedirectUri: (clientId, uri) => this.acceptedRedirectUris.has(clientId, uri),
+		});
 		const providerCallback = this.provider.callback();
 
+		// Claim sources are signed by the active key and served under /claims
+		const claimSources = new ClaimSourceStore({
+			issuer: this.issuer,
+			getSigningKey: () => this.keyManager.getActiveKey(),
+			onResolve: (record) =>
+				this.eventLog.record(record.sessionId, "claim-source-resolved", {
+					sourceId: record.id,
+					tampered: record.tampered,
+				}),
+		});
+		this.claimSources = claimSources;
+
+		// jku- and x5u-injection point tokens at attacker keys served under
+		// /admin/rogue-jwks and certificates served under /admin/rogue-x5u
+		const rogueJwks = new RogueJwksStore({ issuer: this.issuer });
+		this.rogueJwks = rogueJwks;
+
+		// Revocations are published for resource servers that poll instead of introspecting
+		const revocationList = new RevocationList({
+			issuer: this.issuer,
+			getSigningKey: () => this.keyManager.getActiveKey(),
+		});
+		this.revocationList = revocationList;
+
 		// Initialize mischief engine with persistence callback
 		const engineOptions: MischiefEngineOptions = {
 			pluginRegistry: this.pluginRegistry,
 			getPublicKey: async () => this.getPublicKeyPem(),
+			getSigningKey: (session, tenant) =>
+				this.keyManager.signingKeyFor(tenant ? tenantKeyId(tenant) : session.keyId),
+			claimSources,
+			rogueJwks,
+			transientKeys: this.transientKeys,
+		};
+		engineOptions.onLedgerEntry = (sessionId, entry) => {
+			if (this.database) {
+				this.database.saveLedgerEntry(sessionId, entry);
+			}
+			this.requestMischief.get(entry.requestId)?.push(entry.plugin.id);
+			this.metrics.countMischief(entry.plugin.id);
+			this.logger.debug("mischief applied", {
+				sessionId,
+				plugin: entry.plugin.id,
+				severity: entry.plugin.severity,
+				violation: entry.spec.violation,
+			});
 		};
+		this.mischiefEngine = new MischiefEngine(engineOptions);
 		if (this.database) {
-			const db = this.database;
-			engineOptions.onLedgerEntry = (sessionId, entry) => db.saveLedgerEntry(sessionId, entry);
+			for (const id of this.sessions.keys()) {
+				this.mischiefEngine.restoreLedger(id, this.database.loadLedgerEntries(id));
+			}
 		}
-		this.mischiefEngine = new MischiefEngine(engineOptions);
 
 		// Initialize admin API
 		this.adminApi = createAdminApi({
@@ -105,10 +632,72 @@ export class Loki {
 			getSession: (id) => this.getSession(id),
 			deleteSession: (id) => this.deleteSession(id),
 			purgeSessions: () => this.purgeSessions(),
+			getSessionEvents: (id, since) => this.getSessionEvents(id, since),
+			watchSessionEvents: (id) => this.watchSessionEvents(id),
+			getRefreshLedger: (id) => this.getRefreshLedger(id),
+			getLastTokenResponse: (id) => this.getLastTokenResponse(id),
+			reportTokenOutcome: (id, report) => this.reportTokenOutcome(id, report),
+			getSessionResults: (id) => this.getSessionResults(id),
+			freezeSession: (id, options) => this.freezeSession(id, options),
+			unfreezeSession: (id) => this.unfreezeSession(id),
+			startRolloverPlan: (plan) => this.keyManager.startRolloverPlan(plan),
+			getRolloverStatus: () => this.keyManager.getRolloverStatus(),
+			clearRolloverPlan: () => this.keyManager.clearRolloverPlan(),
+			startKeySet: (config) => this.keyManager.startKeySet(config),
+			getKeySetStatus: () => this.keyManager.getKeySetStatus(),
+			retireKeySetKey: (kid, options) => this.keyManager.retireKeySetKey(kid, options),
+			clearKeySet: () => this.keyManager.clearKeySet(),
+			registerSigningKey: (registration) => this.keyManager.registerKey(registration),
+			getSigningKeys: () => this.keyManager.getRegisteredKeys(),
+			getSigningKey: (id) => this.keyManager.getRegisteredKey(id),
+			rotateSigningKey: (id, privateJwk) => this.keyManager.rotateRegisteredKey(id, privateJwk),
+			removeSigningKey: (id) => this.keyManager.removeRegisteredKey(id),
+			setSigningKeyVisibility: (id, visibleTo) => this.keyManager.setKeyVisibility(id, visibleTo),
+			getClients: () => this.clients.list(),
+			getClient: (id) => this.clients.status(id),
+			registerClient: (registration) => this.registerClient(registration),
+			deleteClient: (id) => this.deleteClient(id),
+			registerClientKeys: (id, jwks) => this.registerClientKeys(id, jwks),
+			removeClientKeys: (id) => this.clients.removeKeys(id),
+			getTenants: () => this.getTenants(),
+			getTenant: (id) => this.getTenants().find((tenant) => tenant.id === id),
+			registerTenant: (id) => this.registerTenant(id),
+			removeTenant: (id) => this.removeTenant(id),
+			getFaultStatus: () => this.faultInjector.getStatus(),
+			configureFaults: (config) => this.faultInjector.configure(config),
+			getRevocationReport: (sessionId) => revocationList.getReport(sessionId),
+			getSessionsConfig: () => this.config.sessions as Required<SessionsConfig>,
+			planTopology: (document) => this.planTopology(document),
+			applyTopology: (document) => this.applyTopology(document),
+			exportTopology: () => this.exportTopology(),
+			getAttackOfTheDay: () => this.getAttackOfTheDay(),
+			getChaos: () => this.getChaos(),
+			exportSigningKeys: (id) => this.exportSigningKeys(id),
+			getRequestTrace: (requestId) => this.getRequestTrace(requestId),
+			getSessionReport: (id) => this.getSessionReport(id),
+			getSessionStats: (id) => this.getSessionStats(id),
+			getSessionHar: (id) => this.getSessionHar(id),
+			getRogueJwks: (sessionId) => this.fetchRogueJwks(sessionId),
+			getRogueX5u: (sessionId) => this.fetchRogueX5u(sessionId),
+			getAdminToken: () => this.config.server.adminToken,
+			getSessionEvictedAt: (id) => this.sessionEvictedAt(id),
 		});
 
-		// Create HTTP server that routes to admin API or OIDC provider
-		this.server = createServer((req: IncomingMessage, res: ServerResponse) => {
+		// Route a request to the admin API or the OIDC provider
+		const route = (req: IncomingMessage, res: ServerResponse): void => {
+			// A tenant's endpoints are the plain ones under its prefix
+			const scoped = this.tenants.match(req.url ?? "/");
+			if (scoped) {
+				req.url = scoped.url;
+				this.tenantRequests.set(res, scoped.tenant);
+			}
+			const tenant = scoped?.tenant;
+
+			// `/authorize` is served as the provider's `/auth`, which discovery advertises
+			const requested = req.url ?? "/";
+			if (requested === "/authorize" || requested.startsWith("/authorize?")) {
+				req.url = `/auth${requested.slice("/authorize".length)}`;
+			}
 			const url = req.url ?? "/";
 
 			// Health check
@@ -124,195 +713,3509 @@ export class Loki {
 				return;
 			}
 
+			// Prometheus metrics
+			if (url === "/metrics") {
+				res.writeHead(200, { "Content-Type": "text/plain; version=0.0.4" });
+				res.end(this.renderMetrics());
+				return;
+			}
+
 			// Admin API routes
 			if (url.startsWith("/admin")) {
 				this.handleAdminRequest(req, res, url).catch((err) => {
-					res.writeHead(500, { "Content-Type": "application/json" });
-					res.end(JSON.stringify({ error: "Internal server error", message: String(err) }));
+					sendInternalError(res, err);
+				});
+				return;
+			}
+
+			// Endpoints switched off by config don't exist
+			const path = url.split("?")[0] ?? "/";
+			const disabled = disabledEndpointAt(path, this.disabledEndpoints);
+			if (disabled !== undefined) {
+				const message = `unrecognized route (${req.method} on ${path})`;
+				const body = oauthError("invalid_request", "endpoint_disabled", message, {
+					endpoint: disabled,
+				});
+				sendError(res, 404, body, { "Cache-Control": "no-store" });
+				return;
+			}
+
+			// Backpressure: beyond the in-flight limit, turn requests away rather than queue them
+			const release = this.concurrencyLimiter.tryAcquire();
+			if (!release) {
+				const message = "Too many requests in flight";
+				sendError(res, 503, oauthError("temporarily_unavailable", "overloaded", message), {
+					"Cache-Control": "no-store",
+					"Retry-After": "1",
+				});
+				return;
+			}
+			res.once("close", release);
+
+			// Global error-rate faults apply regardless of session
+			const faultStatus = this.faultInjector.check(url);
+			if (faultStatus !== undefined) {
+				const body = oauthError("temporarily_unavailable", "injected_fault", "Injected fault", {
+					status: faultStatus,
+				});
+				sendError(res, faultStatus, body, { "Cache-Control": "no-store" });
+				return;
+			}
+
+			// Distributed claim endpoints
+			if (url.startsWith("/claims/")) {
+				const id = url.slice("/claims/".length).split("?")[0] ?? "";
+				const result = claimSources.resolve(id, req.headers.authorization);
+				res.writeHead(result.status, result.headers);
+				res.end(result.body);
+				return;
+			}
+
+			// Published revocation list
+			if (url === "/revocations" || url.startsWith("/revocations?")) {
+				const format = new URLSearchParams(url.split("?")[1] ?? "").get("format") ?? "json";
+				if (format !== "json" && format !== "jwt") {
+					const message = "format must be 'json' or 'jwt'";
+					sendError(res, 400, lokiError("invalid_parameter", message, { parameter: "format" }));
+					return;
+				}
+				revocationList
+					.render(format as RevocationListFormat)
+					.then(({ contentType, body }) => {
+						res.writeHead(200, { "Content-Type": contentType, "Cache-Control": "no-store" });
+						res.end(body);
+					})
+					.catch((err) => {
+						sendInternalError(res, err);
+					});
+				return;
+			}
+
+			// Get the session the request names; a session evicted by its ttl is gone
+			const sessionId = this.namedSessionId(req);
+			const evictedAt = sessionId ? this.sessionEvictedAt(sessionId) : undefined;
+			if (sessionId && evictedAt) {
+				const message = "The session outlived its ttl and was evicted";
+				const body = oauthError("invalid_request", "session_expired", message, {
+					sessionId,
+					evictedAt: evictedAt.toISOString(),
+				});
+				sendError(res, 410, body, { "Cache-Control": "no-store" });
+				return;
+			}
+			let candidate = sessionId ? this.sessions.get(sessionId) : undefined;
+			if (this.attackRotation && sessionId === this.attackRotation.sessionId) {
+				const tokenRequest = req.method === "POST" && url.split("?")[0] === "/token";
+				candidate = this.rotateAttackOfTheDay(this.attackRotation, tokenRequest);
+			}
+			// A conditional session treats requests it doesn't target as session-less
+			const session = candidate && this.matchesCondition(candidate, req) ? candidate : undefined;
+
+			// HEAD and OPTIONS probes of discovery, JWKS and token
+			const allowedMethods = ENDPOINT_METHODS[url.split("?")[0] ?? ""];
+			if (allowedMethods && req.method === "OPTIONS") {
+				res.writeHead(204, optionsHeaders(allowedMethods, req.headers));
+				res.end();
+				return;
+			}
+			if (allowedMethods && req.method === "HEAD") {
+				this.handleHeadRequest(req, res, session, allowedMethods, providerCallback).catch((err) => {
+					sendInternalError(res, err);
+				});
+				return;
+			}
+
+			// Revocations are recorded (and possibly withheld from the list) on the way through
+			if (req.method === "POST" && url.split("?")[0] === "/token/revocation") {
+				this.handleRevocationRequest(req, res, session, providerCallback).catch((err) => {
+					sendInternalError(res, err);
+				});
+				return;
+			}
+
+			// Loki answers its own introspection endpoint from what it issued
+			if (req.method === "POST" && url.split("?")[0] === INTROSPECTION_PATH) {
+				this.handleIntrospect(req, res, session).catch((err) => {
+					sendInternalError(res, err);
 				});
 				return;
 			}
 
-			// Get session from header if present
-			const sessionId = req.headers["x-loki-session"] as string | undefined;
-			const session = sessionId ? this.sessions.get(sessionId) : undefined;
+			// Loki answers its own revocation endpoint, whatever the token
+			if (req.method === "POST" && url.split("?")[0] === REVOCATION_PATH) {
+				this.handleRevoke(req, res, session).catch((err) => {
+					sendInternalError(res, err);
+				});
+				return;
+			}
+
+			// Introspection timing can be shaped by endpoint mischief
+			if (session && req.method === "POST" && url.split("?")[0] === "/token/introspection") {
+				this.handleIntrospectionRequest(req, res, session, providerCallback).catch((err) => {
+					sendInternalError(res, err);
+				});
+				return;
+			}
+
+			// PKCE challenges are checked against the minimum method (mischief may accept plain)
+			if (req.method === "GET" && url.split("?")[0] === "/auth") {
+				this.handleAuthorizationRequest(req, res, session, providerCallback).catch((err) => {
+					sendInternalError(res, err);
+				});
+				return;
+			}
+
+			// Pushed authorization requests may carry authorization_details (RFC 9396)
+			if (session && req.method === "POST" && url.split("?")[0] === "/request") {
+				this.handlePushedAuthorizationRequest(req, res, session, providerCallback).catch((err) => {
+					sendInternalError(res, err);
+				});
+				return;
+			}
+
+			// The login page reflects display and ui_locales (unless mischief ignores them)
+			if (req.method === "GET" && /^\/interaction\/[^/?]+(\?|$)/.test(url)) {
+				this.handleInteractionPage(req, res, session, providerCallback).catch((err) => {
+					sendInternalError(res, err);
+				});
+				return;
+			}
+
+			// Device codes are recorded on the way out, so Loki can answer their polls
+			if (req.method === "POST" && url.split("?")[0] === "/device_authorization") {
+				this.handleDeviceAuthorizationRequest(req, res, providerCallback).catch((err) => {
+					sendInternalError(res, err);
+				});
+				return;
+			}
+
+			// Userinfo is served by Loki so the scope-to-claim map is under its control;
+			// without a session header, the access token's own session applies
+			if (USERINFO_PATHS.includes(url.split("?")[0] ?? "")) {
+				this.handleUserinfoRequest(req, res, session, sessionId === undefined).catch((err) => {
+					sendInternalError(res, err);
+				});
+				return;
+			}
+
+			// A rollover plan or key set re-signs every token and rewrites every JWKS response
+			const rollover = this.keyManager.overridesSigning;
 
-			// If this is a token endpoint and we have an active session, intercept
-			if (session && (url === "/token" || url.startsWith("/token?"))) {
-				this.handleTokenRequest(req, res, session, providerCallback);
+			// Token requests are checked against the client's registration, then
+			// intercepted if we have an active session or must bind a client certificate
+			if (url === "/token" || url.startsWith("/token?")) {
+				if (req.method !== "POST") {
+					if (session || rollover || tenant) {
+						this.handleTokenRequest(req, res, session, providerCallback);
+					} else {
+						providerCallback(req, res);
+					}
+					return;
+				}
+				// A refresh grant without a session header is handled by the session
+				// that issued its token, and any other request by the client's default
+				// mischief session, or else chaos mode if it draws one; client auth,
+				// then session DPoP proofs and refresh grants, are checked first
+				const bound =
+					sessionId === undefined
+						? this.bindRefreshSession(req).then((refresh) =>
+								refresh.session ? refresh : this.bindClientSession(refresh.request),
+							)
+						: Promise.resolve({ request: req, session });
+				bound
+					.then(async ({ request: bindable, session: boundSession }) => {
+						const tokenSession =
+							boundSession ?? (sessionId === undefined ? this.drawChaos() : undefined);
+						if (tokenSession) {
+							this.harRecorder.bind(res, tokenSession.id);
+						}
+						if (tokenSession && !this.withinTokenRate(tokenSession, res)) {
+							return;
+						}
+						const prepared = await this.prepareTokenRequest(bindable, res, tokenSession);
+						if (!prepared) {
+							return;
+						}
+						const { request, refreshToken } = prepared;
+						const respond = this.tokenResponder(providerCallback);
+						const constrained =
+							clientCertificateThumbprint(request) !== undefined || this.dpopThumbprints.has(res);
+						const negotiated = negotiateTokenMediaType(request.headers.accept) !== JSON_MEDIA_TYPE;
+						if (tokenSession || rollover || tenant || constrained || negotiated) {
+							this.handleTokenRequest(request, res, tokenSession, respond, refreshToken);
+						} else {
+							respond(request, res);
+						}
+					})
+					.catch((err) => {
+						sendInternalError(res, err);
+					});
 				return;
 			}
 
-			// If this is a discovery endpoint and we have an active session, intercept
+			// If this is a discovery endpoint and we have an active session, disabled
+			// endpoints to leave out or a tenant's issuer to name, intercept; the
+			// RFC 8414 document is always rendered here
+			const document = metadataDocumentAt(url.split("?")[0] ?? "");
 			if (
-				session &&
-				(url === "/.well-known/openid-configuration" ||
-					url.startsWith("/.well-known/openid-configuration?"))
+				document === "oauth-authorization-server" ||
+				(document && (session || tenant || this.disabledEndpoints.size > 0))
 			) {
 				this.handleDiscoveryRequest(req, res, session, providerCallback, "discovery");
 				return;
 			}
 
-			// If this is a JWKS endpoint and we have an active session, intercept
-			if (
-				session &&
-				(url === "/jwks" ||
-					url.startsWith("/jwks?") ||
-					url === "/.well-known/jwks.json" ||
-					url.startsWith("/.well-known/jwks.json?"))
-			) {
-				this.handleDiscoveryRequest(req, res, session, providerCallback, "jwks");
-				return;
-			}
+			// If this is a JWKS endpoint and we have an active session or a tenant's key to
+			// publish, or it is gated, intercept
+			if (
+				(session || rollover || tenant || this.config.provider.jwksBearerToken !== undefined) &&
+				(url === "/jwks" ||
+					url.startsWith("/jwks?") ||
+					url === "/.well-known/jwks.json" ||
+					url.startsWith("/.well-known/jwks.json?"))
+			) {
+				this.handleDiscoveryRequest(req, res, session, providerCallback, "jwks");
+				return;
+			}
+
+			// All other routes go to OIDC provider directly
+			providerCallback(req, res);
+		};
+
+		// Every request is served (and logged) under a correlation ID, echoed in
+		// the response, and recorded for the session it names or is bound to.
+		// With a shared store, the session it names is first brought up to date
+		const serve = (req: IncomingMessage, res: ServerResponse) => {
+			const requestId = resolveRequestId(req);
+			// While stopping, a connection is closed as soon as its last response is sent
+			res.once("finish", () => {
+				if (this.draining) {
+					this.server?.closeIdleConnections();
+				}
+			});
+			res.setHeader(REQUEST_ID_HEADER, requestId);
+			res.setHeader(LOKI_REQUEST_ID_HEADER, requestId);
+			if (!req.url?.startsWith("/admin/")) {
+				this.harRecorder.capture(req, res, requestId, this.namedSessionId(req));
+			}
+			this.observeRequest(req, res);
+			withRequestId(requestId, () => {
+				this.logRequest(requestId, req, res);
+				const db = this.database;
+				if (!db || !isSharedStore(db)) {
+					route(req, res);
+					return;
+				}
+				this.syncSharedSessions(db, req).then(
+					() => route(req, res),
+					(err) => sendInternalError(res, err),
+				);
+			});
+		};
+
+		this.handler = serve;
+	}
+
+	/**
+	 * Turn away sources outside the allowlist, answer liveness and readiness
+	 * probes, and hand every other request to the router once Loki is ready for it
+	 */
+	private dispatch(req: IncomingMessage, res: ServerResponse): void {
+		// Nothing, probes included, is served to a source outside the allowlist
+		if (this.allowedSources) {
+			const sourceAddress = resolveSourceAddress(
+				req.socket.remoteAddress,
+				req.headers["x-forwarded-for"],
+				this.trustedProxies,
+			);
+			if (sourceAddress === undefined || !this.allowedSources.has(sourceAddress)) {
+				const rejection = oauthError("access_denied", "source_not_allowed", "source not allowed", {
+					sourceAddress: sourceAddress ?? null,
+				});
+				sendError(res, 403, rejection, { "Cache-Control": "no-store" });
+				return;
+			}
+		}
+		const path = (req.url ?? "/").split("?")[0];
+		if (path === "/healthz") {
+			res.writeHead(200, { "Content-Type": "application/json", "Cache-Control": "no-store" });
+			res.end(JSON.stringify({ status: "ok" }));
+			return;
+		}
+		if (path === "/readyz") {
+			const report = this.readiness();
+			res.writeHead(report.status === "ready" ? 200 : 503, {
+				"Content-Type": "application/json",
+				"Cache-Control": "no-store",
+			});
+			res.end(JSON.stringify(report));
+			return;
+		}
+		if (!this.handler) {
+			const rejection = oauthError("temporarily_unavailable", "not_ready", "Loki is starting");
+			sendError(res, 503, rejection, { "Cache-Control": "no-store", "Retry-After": "1" });
+			return;
+		}
+		this.handler(req, res);
+	}
+
+	/**
+	 * Whether Loki can mint tokens: its signing keys, its session store (when
+	 * persistence is on) and its provider and router
+	 */
+	private readiness(): ReadinessReport {
+		const { enabled, store = "sqlite" } = this.config.persistence;
+		let sessionStore: ComponentState;
+		if (!enabled) {
+			sessionStore = { status: "disabled" };
+		} else if (!this.database) {
+			sessionStore = { status: "pending", store };
+		} else if (isSharedStore(this.database) && !this.database.connected) {
+			sessionStore = { status: "down", store };
+		} else {
+			sessionStore = { status: "ready", store };
+		}
+		return readinessReport({
+			signingKeys: { status: this.keysReady ? "ready" : "pending" },
+			sessionStore,
+			provider: { status: this.handler ? "ready" : "pending" },
+		});
+	}
+
+	/**
+	 * Count a request by endpoint, status and latency once its response is
+	 * sent (or the client goes away), and a successful token request as an issuance
+	 */
+	private observeRequest(req: IncomingMessage, res: ServerResponse): void {
+		const startedAt = performance.now();
+		res.once("close", () => {
+			const endpoint = endpointLabel(req.url ?? "/");
+			this.metrics.observeRequest(endpoint, res.statusCode, (performance.now() - startedAt) / 1000);
+			if (endpoint === "token" && req.method === "POST" && res.statusCode === 200) {
+				this.metrics.countIssuance();
+			}
+		});
+	}
+
+	/**
+	 * Log a request once its response is sent (or the client goes away):
+	 * the endpoint, the session it named, the mischief applied and the outcome
+	 */
+	private logRequest(requestId: string, req: IncomingMessage, res: ServerResponse): void {
+		if (!this.logger.enabled("info")) {
+			return;
+		}
+		const startedAt = performance.now();
+		const mischief: string[] = [];
+		this.requestMischief.set(requestId, mischief);
+		res.once("close", () => {
+			this.requestMischief.delete(requestId);
+			const fields: Record<string, unknown> = {
+				method: req.method,
+				endpoint: (req.url ?? "/").split("?")[0],
+			};
+			const sessionId = this.namedSessionId(req);
+			if (sessionId !== undefined) {
+				fields.sessionId = sessionId;
+			}
+			fields.mischief = mischief;
+			fields.status = res.statusCode;
+			fields.outcome = responseOutcome(res);
+			fields.durationMs = Math.round(performance.now() - startedAt);
+			withRequestId(requestId, () => this.logger.info("request", fields));
+		});
+	}
+
+	/**
+	 * Open the configured session store, creating its directory if need be
+	 */
+	private async openStore(): Promise<SessionStore> {
+		const { path: dbPath, store, redisAddr } = this.config.persistence;
+		if (store === "redis") {
+			return RedisSessionStore.open({
+				addr: redisAddr ?? "127.0.0.1:6379",
+				plugins: this.pluginRegistry,
+				onWriteError: (command, err) =>
+					this.logger.warn("redis write failed", { command, error: err.message }),
+			});
+		}
+		const dbDir = dirname(dbPath);
+		if (!existsSync(dbDir)) {
+			mkdirSync(dbDir, { recursive: true });
+		}
+		const storeConfig = { path: dbPath, plugins: this.pluginRegistry };
+		return store === "json" ? new JsonFileStore(storeConfig) : new LokiDatabase(storeConfig);
+	}
+
+	/**
+	 * The session a request names: its `X-Loki-Session` header or, for
+	 * discovery and the JWKS, the `loki_session` query parameter
+	 */
+	private namedSessionId(req: IncomingMessage): string | undefined {
+		const header = req.headers["x-loki-session"];
+		return typeof header === "string" ? header : querySessionId(req.url ?? "/");
+	}
+
+	/**
+	 * Fetch the latest state of the sessions a request touches from a store
+	 * other replicas write to: the one it or its admin path names, or every
+	 * session when they're listed
+	 */
+	private async syncSharedSessions(db: SharedSessionStore, req: IncomingMessage): Promise<void> {
+		const path = (req.url ?? "/").split("?")[0] ?? "/";
+		if (path === "/admin/sessions" && req.method === "GET") {
+			const ids = new Set([...(await db.fetchSessionIds()), ...this.sessions.keys()]);
+			for (const id of ids) {
+				await this.syncSharedSession(db, id);
+			}
+			return;
+		}
+		const adminId = /^\/admin\/sessions\/([^/]+)/.exec(path)?.[1];
+		const id = adminId ?? this.namedSessionId(req);
+		if (typeof id === "string" && id !== "") {
+			await this.syncSharedSession(db, decodeURIComponent(id));
+		}
+	}
+
+	/**
+	 * Replace what this replica holds for a session with the shared store's
+	 * state, forgetting the session if another replica deleted it
+	 */
+	private async syncSharedSession(db: SharedSessionStore, id: string): Promise<void> {
+		const state = await db.fetchSession(id);
+		if (!state) {
+			this.forgetSession(id);
+			return;
+		}
+		this.sessions.set(id, state.session);
+		this.mischiefEngine?.clearLedger(id);
+		this.mischiefEngine?.restoreLedger(id, state.ledger);
+		this.eventLog.clear(id);
+		this.eventLog.restore(state.events);
+		this.issuanceLog.restore(id, state.issuances);
+		if (state.lastTokenResponse === undefined) {
+			this.lastTokenResponses.delete(id);
+		} else {
+			this.lastTokenResponses.set(id, state.lastTokenResponse);
+		}
+	}
+
+	/**
+	 * The attack-of-the-day session, switched to the attack now due
+	 *
+	 * The session is recreated if it was deleted. Token requests count
+	 * towards request-based rotation, and each switch is recorded as an
+	 * `attack-rotated` event.
+	 */
+	private rotateAttackOfTheDay(rotation: AttackRotation, tokenRequest: boolean): Session {
+		let session = this.sessions.get(rotation.sessionId);
+		if (!session) {
+			session = {
+				id: rotation.sessionId,
+				name: "Attack of the day",
+				mode: "explicit",
+				mischief: [],
+				startedAt: new Date(),
+			};
+			this.sessions.set(session.id, session);
+			if (this.database) {
+				this.database.saveSession(session);
+			}
+		}
+
+		const { plugin, rotated } = rotation.advance();
+		if (tokenRequest) {
+			rotation.countTokenRequest();
+		}
+		const previous = session.mischief[0];
+		session.mode = "explicit";
+		session.mischief = [plugin];
+		if (rotated) {
+			this.eventLog.record(session.id, "attack-rotated", {
+				from: previous ?? null,
+				to: plugin,
+				index: rotated.index,
+			});
+			if (this.database) {
+				this.database.saveSession(session);
+			}
+		}
+		return session;
+	}
+
+	/**
+	 * The chaos session, serving the mischief drawn for a token request no
+	 * session claimed; undefined when chaos mode is off or the draw missed
+	 *
+	 * The session is recreated if it was deleted. Each request is served a
+	 * copy holding just its own plugin, so concurrent draws don't mix, and
+	 * each draw is recorded as a `chaos-drawn` event, logged and counted.
+	 */
+	private drawChaos(): Session | undefined {
+		const plugin = this.chaos?.draw();
+		if (!this.chaos || plugin === undefined) {
+			return undefined;
+		}
+		let session = this.sessions.get(this.chaos.sessionId);
+		if (!session) {
+			session = {
+				id: this.chaos.sessionId,
+				name: "Chaos mode",
+				mode: "explicit",
+				mischief: [],
+				startedAt: new Date(),
+			};
+			this.sessions.set(session.id, session);
+			if (this.database) {
+				this.database.saveSession(session);
+			}
+		}
+		this.eventLog.record(session.id, "chaos-drawn", { plugin });
+		this.metrics.countChaos(plugin);
+		this.logger.info("chaos mischief drawn", { plugin });
+		return { ...session, mode: "explicit", mischief: [plugin] };
+	}
+
+	/**
+	 * Take a token request from the session's maxTokensPerSecond budget,
+	 * answering 429 if it's spent
+	 */
+	private withinTokenRate(session: Session, res: ServerResponse): boolean {
+		const rate = session.maxTokensPerSecond;
+		if (rate === undefined || this.sessionStats.tryTake(session.id, rate)) {
+			return true;
+		}
+		const message = `Session allows ${rate} token requests per second`;
+		const body = oauthError("temporarily_unavailable", "rate_limited", message, {
+			sessionId: session.id,
+			maxTokensPerSecond: rate,
+		});
+		sendError(res, 429, body, {
+			"Cache-Control": "no-store",
+			"Retry-After": String(this.sessionStats.retryAfter(session.id, rate)),
+		});
+		return false;
+	}
+
+	/**
+	 * Whether a request satisfies the session's `when` condition
+	 *
+	 * Sessions without one match every request. The decision is recorded as a
+	 * `condition-evaluated` event either way.
+	 */
+	private matchesCondition(session: Session, req: IncomingMessage): boolean {
+		if (session.when === undefined) {
+			return true;
+		}
+		const cidrs = conditionCidrs(session.when);
+		const sourceAddress = resolveSourceAddress(
+			req.socket.remoteAddress,
+			req.headers["x-forwarded-for"],
+			this.trustedProxies,
+		);
+		const matched = sourceAddress !== undefined && new CidrSet(cidrs).has(sourceAddress);
+		this.eventLog.record(session.id, "condition-evaluated", {
+			sourceAddress: sourceAddress ?? null,
+			sourceCIDR: cidrs,
+			matched,
+		});
+		return matched;
+	}
+
+	/**
+	 * Run a token request through the client auth check, the device code
+	 * and PKCE checks and, for sessions, injected token errors, the DPoP
+	 * nonce check and the refresh ledger; undefined if Loki already answered it
+	 */
+	private async prepareTokenRequest(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+	): Promise<{ request: IncomingMessage; refreshToken?: string } | undefined> {
+		const authenticated = await this.checkTokenClientAuth(req, res, session);
+		if (!authenticated) {
+			return undefined;
+		}
+		const asserted = await this.checkClientAssertion(authenticated, res, session);
+		if (!asserted) {
+			return undefined;
+		}
+		const polled = await this.checkDevicePoll(asserted, res, session);
+		if (!polled) {
+			return undefined;
+		}
+		const verified = await this.checkCodeVerifier(polled, res, session);
+		if (!verified) {
+			return undefined;
+		}
+		if (!(await this.checkDpopProof(verified, res, session))) {
+			return undefined;
+		}
+		if (!session) {
+			return { request: verified };
+		}
+		const accepted = await this.checkTokenError(verified, res, session);
+		if (!accepted) {
+			return undefined;
+		}
+		const noted = await this.noteTokenRequest(accepted, res, session);
+		if (!noted) {
+			return undefined;
+		}
+		const checked = await this.checkDpopNonce(noted, res, session);
+		if (!checked) {
+			return undefined;
+		}
+		const prepared = await this.checkRefreshGrant(checked.request, session);
+		if (checked.exchange) {
+			this.dpopExchanges.set(prepared.request, checked.exchange);
+		}
+		return prepared;
+	}
+
+	/**
+	 * Let endpoint mischief answer a session's token request with an OAuth
+	 * error (RFC 6749 Section 5.2) instead of a token
+	 */
+	private async checkTokenError(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session,
+	): Promise<IncomingMessage | undefined> {
+		const url = req.url ?? "/token";
+		const body = await readBody(req);
+		if (!this.mischiefEngine) {
+			return replayRequest(req, body);
+		}
+		const params = parseParams(url, body);
+		const requestCtx: RequestContext = {
+			requestId: currentRequestId(),
+			session,
+			endpoint: url,
+			method: "POST",
+			timestamp: new Date(),
+		};
+		const { actions } = await this.mischiefEngine.applyToEndpoint(
+			{ path: "/token", params, status: 0, tokenRequest: true },
+			requestCtx,
+		);
+		const injected = actions.tokenError as
+			| { error: string; description: string; status: number }
+			| undefined;
+		if (!injected) {
+			return replayRequest(req, body);
+		}
+
+		const headers: Record<string, string> = { "Cache-Control": "no-store" };
+		if (injected.status === 401) {
+			headers["WWW-Authenticate"] = 'Basic realm="loki"';
+		}
+		const rejection = oauthError(injected.error, "injected_token_error", injected.description, {
+			sessionId: session.id,
+		});
+		sendError(res, injected.status, rejection, headers);
+		return undefined;
+	}
+
+	/**
+	 * Remember a `nonce` sent with a session token request as the one its
+	 * client's ID token must echo, its `scope` as what the client's access
+	 * token is granted and its `resource` indicators as the token's
+	 * audience; undefined if Loki refused a malformed resource
+	 *
+	 * The resources are taken out of the request: the provider would refuse
+	 * more than one, so Loki sets the access token's `aud` itself.
+	 */
+	private async noteTokenRequest(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session,
+	): Promise<IncomingMessage | undefined> {
+		const body = await readBody(req);
+		const params = parseParams(req.url ?? "/token", body);
+		const resources = parseResources(body);
+		const invalid = invalidResource(resources);
+		if (invalid !== undefined) {
+			const rejection = oauthError(
+				"invalid_target",
+				"invalid_resource",
+				"resource must be an absolute URI without a fragment",
+				{ resource: invalid, sessionId: session.id },
+			);
+			sendError(res, 400, rejection, { "Cache-Control": "no-store" });
+			return undefined;
+		}
+		const clientId = requestClientId(req.headers.authorization, params);
+		if (clientId !== undefined) {
+			// A machine-to-machine grant issues no ID token to echo a nonce in
+			if (params.nonce !== undefined && grantProfile(params.grant_type) === "user") {
+				this.nonceRequests.request(session.id, clientId, params.nonce);
+			}
+			this.scopeRequests.request(session.id, clientId, parseScope(params.scope ?? ""));
+			this.resourceRequests.request(session.id, clientId, resources);
+		}
+		return replayRequest(req, resources.length > 0 ? withoutResources(body) : body);
+	}
+
+	/**
+	 * Check a token request against its client's registration
+	 *
+	 * A client the registry doesn't know gets `401 invalid_client`; known
+	 * clients' secrets are checked by the provider, which looks registered
+	 * clients up in the registry. A public client presenting a secret gets
+	 * `401 invalid_client`, and one
+	 * asking for client_credentials gets `400 unauthorized_client`, unless
+	 * session mischief accepts the combination; an accepted secret is dropped
+	 * before the provider sees the request. Confidential clients without
+	 * credentials are left to the provider to refuse. For sessions, requests
+	 * from public clients and those that violate the client's type are
+	 * recorded as `client-auth-checked` events.
+	 */
+	private async checkTokenClientAuth(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+	): Promise<IncomingMessage | undefined> {
+		const url = req.url ?? "/token";
+		const body = await readBody(req);
+		const params = parseParams(url, body);
+		const clientId = requestClientId(req.headers.authorization, params);
+		const client = this.clients.get(clientId);
+		if (params.grant_type !== undefined) {
+			this.tokenGrants.set(res, params.grant_type);
+		}
+		if (!client) {
+			const rejection = oauthError(
+				"invalid_client",
+				"client_authentication_failed",
+				"client authentication failed",
+				{ clientId: clientId ?? null },
+			);
+			sendError(res, 401, rejection, {
+				"Cache-Control": "no-store",
+				"WWW-Authenticate": 'Basic realm="loki"',
+			});
+			return undefined;
+		}
+
+		const check = checkClientAuth(
+			client,
+			presentedAuthMethod(req.headers, params),
+			params.grant_type,
+		);
+		const refusable =
+			check.violation === "public-client-secret" ||
+			check.violation === "public-client-credentials";
+
+		let accepted = false;
+		if (session && refusable && this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: "POST",
+				timestamp: new Date(),
+			};
+			const { actions } = await this.mischiefEngine.applyToEndpoint(
+				{ path: "/token", params, status: 0, clientAuth: check },
+				requestCtx,
+			);
+			accepted = actions.acceptClientAuth === true;
+		}
+
+		if (session && (check.clientType === "public" || check.violation !== undefined)) {
+			this.eventLog.record(session.id, "client-auth-checked", {
+				clientId: check.clientId,
+				clientType: check.clientType,
+				authMethod: check.authMethod,
+				grantType: check.grantType,
+				violation: check.violation ?? null,
+				wronglyAllowed: accepted,
+			});
+		}
+
+		if (refusable && !accepted) {
+			const details = { clientId: check.clientId };
+			const body =
+				check.violation === "public-client-secret"
+					? oauthError(
+							"invalid_client",
+							"public_client_secret",
+							`public client '${check.clientId}' must not authenticate with a client secret`,
+							details,
+						)
+					: oauthError(
+							"unauthorized_client",
+							"public_client_credentials",
+							`public client '${check.clientId}' cannot use the client_credentials grant`,
+							details,
+						);
+			const status = body.code === "public_client_secret" ? 401 : 400;
+			sendError(res, status, body, { "Cache-Control": "no-store" });
+			return undefined;
+		}
+
+		if (accepted && check.authMethod !== "none") {
+			const stripped = stripClientCredentials(req.headers, body, check.clientId);
+			const request = replayRequest(req, stripped.body);
+			request.headers = stripped.headers;
+			return request;
+		}
+		return replayRequest(req, body);
+	}
+
+	/**
+	 * Verify a token request's client assertion (private_key_jwt)
+	 *
+	 * An assertion from a confidential client is checked against the public
+	 * keys registered for it; one that fails gets `401 invalid_client`,
+	 * unless session mischief accepts it. An accepted assertion is swapped
+	 * for the client's secret before the provider sees the request. For
+	 * sessions, each check is recorded as a `client-assertion-checked` event.
+	 */
+	private async checkClientAssertion(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+	): Promise<IncomingMessage | undefined> {
+		const url = req.url ?? "/token";
+		const body = await readBody(req);
+		const params = parseParams(url, body);
+		const clientId = requestClientId(req.headers.authorization, params);
+		const client = this.clients.get(clientId);
+		if (
+			!client ||
+			clientType(client) === "public" ||
+			presentedAuthMethod(req.headers, params) !== "client_assertion"
+		) {
+			return replayRequest(req, body);
+		}
+
+		const check = await verifyClientAssertion(
+			params,
+			client.client_id,
+			this.clients.keys(client.client_id),
+			[this.issuer, `${this.issuer}/token`],
+		);
+		let accepted = false;
+		if (session && check.failure !== undefined && this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: "POST",
+				timestamp: new Date(),
+			};
+			const { actions } = await this.mischiefEngine.applyToEndpoint(
+				{ path: "/token", params, status: 0, clientAssertion: check },
+				requestCtx,
+			);
+			accepted = actions.acceptClientAssertion === true;
+		}
+		if (session) {
+			this.eventLog.record(session.id, "client-assertion-checked", {
+				clientId: check.clientId,
+				kid: check.kid,
+				alg: check.alg,
+				failure: check.failure ?? null,
+				wronglyAllowed: accepted,
+			});
+		}
+
+		if (check.failure !== undefined && !accepted) {
+			const rejection = oauthError(
+				"invalid_client",
+				"client_assertion_invalid",
+				`client assertion for '${check.clientId}' is invalid (${check.failure})`,
+				{ clientId: check.clientId, failure: check.failure, reason: check.reason ?? null },
+			);
+			sendError(res, 401, rejection, { "Cache-Control": "no-store" });
+			return undefined;
+		}
+
+		const swapped = withClientSecret(req.headers, body, client);
+		const request = replayRequest(req, swapped.body);
+		request.headers = swapped.headers;
+		return request;
+	}
+
+	/**
+	 * Answer a device code poll Loki can decide itself
+	 *
+	 * A code past its lifetime gets `400 expired_token` (RFC 8628 Section
+	 * 3.5). For sessions, endpoint mischief may keep the authorization
+	 * pending whatever the user did, and each poll is recorded as a
+	 * `device-code-polled` event. Codes Loki didn't issue, and live ones,
+	 * go on to the provider.
+	 */
+	private async checkDevicePoll(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+	): Promise<IncomingMessage | undefined> {
+		const url = req.url ?? "/token";
+		const body = await readBody(req);
+		const params = parseParams(url, body);
+		const deviceCode = params.device_code;
+		const poll =
+			params.grant_type === DEVICE_CODE_GRANT && deviceCode !== undefined
+				? this.deviceCodes.poll(deviceCode)
+				: undefined;
+		if (!poll) {
+			return replayRequest(req, body);
+		}
+
+		let outcome: "expired" | "pending" | "forwarded" = "forwarded";
+		if (poll.expired) {
+			outcome = "expired";
+		} else if (session && this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: "POST",
+				timestamp: new Date(),
+			};
+			const { actions } = await this.mischiefEngine.applyToEndpoint(
+				{ path: "/token", params, status: 0, devicePoll: poll },
+				requestCtx,
+			);
+			if (actions.holdAuthorizationPending === true) {
+				outcome = "pending";
+			}
+		}
+
+		if (session) {
+			this.eventLog.record(session.id, "device-code-polled", {
+				clientId: requestClientId(req.headers.authorization, params) ?? null,
+				polls: poll.polls,
+				interval: poll.interval,
+				sinceLastPollMs: poll.sinceLastPollMs,
+				outcome,
+			});
+		}
+
+		if (outcome === "forwarded") {
+			return replayRequest(req, body);
+		}
+		const rejection =
+			outcome === "expired"
+				? oauthError("expired_token", "device_code_expired", "device code is expired")
+				: oauthError(
+						"authorization_pending",
+						"device_authorization_pending",
+						"authorization request is still pending",
+					);
+		sendError(res, 400, rejection, { "Cache-Control": "no-store" });
+		return undefined;
+	}
+
+	/**
+	 * Verify the code_verifier of a code a session's PKCE authorization issued
+	 *
+	 * The code must be redeemed in the session that asked for it, and the
+	 * client's verifier must match the client's challenge, unless endpoint
+	 * mischief ignores it; either failure is a `400 invalid_grant`. The
+	 * provider is then given the verifier for the challenge Loki substituted.
+	 * Each verification is recorded as a `pkce-verified` event. Codes from
+	 * session-less or challenge-less authorizations go to the provider as is.
+	 */
+	private async checkCodeVerifier(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+	): Promise<IncomingMessage | undefined> {
+		const url = req.url ?? "/token";
+		const body = await readBody(req);
+		const params = parseParams(url, body);
+		if (params.grant_type !== "authorization_code" || !params.code || !this.provider) {
+			return replayRequest(req, body);
+		}
+		const code = await this.provider.AuthorizationCode.find(params.code).catch(() => undefined);
+		const binding = code?.codeChallenge ? this.pkceBindings.get(code.codeChallenge) : undefined;
+		if (!binding) {
+			return replayRequest(req, body);
+		}
+
+		if (!session || binding.sessionId !== session.id) {
+			const message = "authorization code was issued to another session";
+			const rejection = oauthError("invalid_grant", "authorization_code_session_mismatch", message);
+			sendError(res, 400, rejection, { "Cache-Control": "no-store" });
+			return undefined;
+		}
+
+		const presented = params.code_verifier;
+		const valid = presented !== undefined && verifierMatches(binding, presented);
+		let ignored = false;
+		if (!valid && this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: "POST",
+				timestamp: new Date(),
+			};
+			const pkce = { method: binding.method, verifierPresented: presented !== undefined };
+			const { actions } = await this.mischiefEngine.applyToEndpoint(
+				{ path: "/token", params, status: 0, pkce },
+				requestCtx,
+			);
+			ignored = actions.ignoreCodeVerifier === true;
+		}
+		this.eventLog.record(session.id, "pkce-verified", {
+			method: binding.method,
+			verifierPresented: presented !== undefined,
+			valid,
+			ignored,
+		});
+
+		if (!valid && !ignored) {
+			const message = "PKCE verification failed";
+			const rejection = oauthError("invalid_grant", "pkce_verification_failed", message);
+			sendError(res, 400, rejection, { "Cache-Control": "no-store" });
+			return undefined;
+		}
+
+		const form = new URLSearchParams(body.toString());
+		form.set("code_verifier", binding.verifier);
+		const rewritten = Buffer.from(form.toString());
+		const request = replayRequest(req, rewritten);
+		request.headers = { ...req.headers, "content-length": String(rewritten.length) };
+		return request;
+	}
+
+	/**
+	 * Decide whether a session token request's DPoP proof needs a nonce
+	 *
+	 * Endpoint mischief may demand one (the provider then runs the
+	 * challenge), answer even the correct nonce with another challenge, or
+	 * challenge without ever issuing a nonce. The last two are answered here,
+	 * before the provider sees the request, and recorded straight away;
+	 * the rest are recorded with the provider's response.
+	 */
+	private async checkDpopNonce(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session,
+	): Promise<{ request: IncomingMessage; exchange?: DpopNonceExchange } | undefined> {
+		const proof = req.headers.dpop;
+		const presented = typeof proof === "string" ? dpopProofNonce(proof) : undefined;
+		if (presented === undefined) {
+			return { request: req };
+		}
+
+		const url = req.url ?? "/token";
+		const body = await readBody(req);
+		let actions: Record<string, unknown> = {};
+		if (this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: "POST",
+				timestamp: new Date(),
+			};
+			({ actions } = await this.mischiefEngine.applyToEndpoint(
+				{ path: "/token", params: parseParams(url, body), status: 0, dpopNonce: presented },
+				requestCtx,
+			));
+		}
+
+		const mode = actions.dpopNonce as DpopNonceMode | undefined;
+		const exchange: DpopNonceExchange = {
+			presented,
+			requireNonce: mode !== undefined || this.config.provider.requireDpopNonce === true,
+		};
+		if (mode !== undefined) {
+			exchange.mode = mode;
+		}
+
+		if (mode === "never-issue" || (mode === "reject-valid" && presented !== null)) {
+			const issued = mode === "never-issue" ? null : generateDpopNonce();
+			sendUseDpopNonce(res, issued);
+			this.recordDpopExchange(session, exchange, "challenged", issued);
+			return undefined;
+		}
+		return { request: replayRequest(req, body), exchange };
+	}
+
+	/**
+	 * Verify a token request's DPoP proof (RFC 9449 Section 4.3), if it sends
+	 * one, and remember the thumbprint of its key for the access token to be
+	 * bound to; a proof that fails, or whose jti was already used, gets
+	 * `400 invalid_dpop_proof`
+	 */
+	private async checkDpopProof(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+	): Promise<boolean> {
+		const proof = req.headers.dpop;
+		if (proof === undefined) {
+			return true;
+		}
+		const path = (req.url ?? "/token").split("?")[0] ?? "/token";
+		const endpoint = `${this.tenantRequests.get(res)?.issuer ?? this.issuer}${path}`;
+		const checked =
+			typeof proof === "string"
+				? await verifyDpopProof(proof, req.method ?? "POST", endpoint)
+				: "send a single DPoP proof";
+		let reason: string;
+		if (typeof checked === "string") {
+			reason = checked;
+		} else if (this.dpopJtis.use(checked.jti)) {
+			reason = "the DPoP proof's jti was already used";
+		} else {
+			this.dpopThumbprints.set(res, checked.thumbprint);
+			return true;
+		}
+		const details = session ? { sessionId: session.id } : {};
+		const rejection = oauthError("invalid_dpop_proof", "dpop_proof_invalid", reason, details);
+		sendError(res, 400, rejection, { "Cache-Control": "no-store" });
+		return false;
+	}
+
+	/**
+	 * Record one round of a session's DPoP nonce exchange
+	 */
+	private recordDpopExchange(
+		session: Session,
+		exchange: DpopNonceExchange,
+		outcome: "challenged" | "accepted" | "rejected",
+		issued: string | null,
+	): void {
+		this.eventLog.record(session.id, "dpop-nonce-exchanged", {
+			presented: exchange.presented,
+			issued,
+			required: exchange.requireNonce,
+			mode: exchange.mode ?? null,
+			outcome,
+		});
+	}
+
+	/**
+	 * Find the session a session-less refresh grant's token was issued in
+	 *
+	 * The request is replayed with that session's header, so the provider
+	 * rotates the token as it would for any session request.
+	 */
+	private async bindRefreshSession(
+		req: IncomingMessage,
+	): Promise<{ request: IncomingMessage; session: Session | undefined }> {
+		const body = await readBody(req);
+		const params = parseParams(req.url ?? "/token", body);
+		const request = replayRequest(req, body);
+		const owner =
+			params.grant_type === "refresh_token" && params.refresh_token !== undefined
+				? this.refreshLedger.sessionFor(params.refresh_token)
+				: undefined;
+		const session = owner === undefined ? undefined : this.sessions.get(owner);
+		if (!session || !this.matchesCondition(session, req)) {
+			return { request, session: undefined };
+		}
+		request.headers = { ...req.headers, "x-loki-session": session.id };
+		return { request, session };
+	}
+
+	/**
+	 * Find the session a session-less token request's client runs its
+	 * default mischief in, replaying the request with that session's header
+	 */
+	private async bindClientSession(
+		req: IncomingMessage,
+	): Promise<{ request: IncomingMessage; session: Session | undefined }> {
+		const body = await readBody(req);
+		const params = parseParams(req.url ?? "/token", body);
+		const request = replayRequest(req, body);
+		const session = this.clientSession(requestClientId(req.headers.authorization, params));
+		if (!session || !this.matchesCondition(session, req)) {
+			return { request, session: undefined };
+		}
+		request.headers = { ...req.headers, "x-loki-session": session.id };
+		return { request, session };
+	}
+
+	/**
+	 * Check a session's refresh_token grant against the rotation ledger
+	 *
+	 * A rotated token presented again is a reuse. Unless endpoint mischief
+	 * accepts it, the request passes through untouched and oidc-provider
+	 * revokes the grant; an accepted reuse is rewritten to present the chain's
+	 * current token instead. Resolves to the request to hand the provider and
+	 * the opaque refresh token it will see.
+	 */
+	private async checkRefreshGrant(
+		req: IncomingMessage,
+		session: Session,
+	): Promise<{ request: IncomingMessage; refreshToken?: string }> {
+		const url = req.url ?? "/token";
+		const body = await readBody(req);
+		const params = parseParams(url, body);
+		const presented = params.refresh_token;
+		if (
+			params.grant_type !== "refresh_token" ||
+			presented === undefined ||
+			!isOpaqueRefreshToken(presented)
+		) {
+			return { request: replayRequest(req, body) };
+		}
+
+		const current = this.refreshLedger.currentFor(session.id, presented);
+		if (current === undefined) {
+			return { request: replayRequest(req, body), refreshToken: presented };
+		}
+
+		let actions: Record<string, unknown> = {};
+		if (this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: "POST",
+				timestamp: new Date(),
+			};
+			({ actions } = await this.mischiefEngine.applyToEndpoint(
+				{ path: "/token", params, status: 0, refreshTokenReused: true },
+				requestCtx,
+			));
+		}
+
+		const accepted = actions.acceptRefreshReuse === true;
+		this.refreshLedger.recordReuse(session.id, presented, current, accepted);
+		if (!accepted) {
+			return { request: replayRequest(req, body) };
+		}
+
+		const form = new URLSearchParams(body.toString());
+		form.set("refresh_token", current);
+		const rewritten = Buffer.from(form.toString());
+		const request = replayRequest(req, rewritten);
+		request.headers = { ...req.headers, "content-length": String(rewritten.length) };
+		return { request, refreshToken: current };
+	}
+
+	/**
+	 * Handle token endpoint with mischief interception
+	 *
+	 * We intercept by monkey-patching res.write/res.end to capture the response,
+	 * apply mischief, then write the modified response. Opaque refresh
+	 * tokens a session is issued are bound to it in the refresh ledger, along
+	 * with the rotation when it presented one.
+	 */
+	private handleTokenRequest(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+		providerCallback: (req: IncomingMessage, res: ServerResponse) => unknown,
+		refreshToken?: string,
+	): void {
+		const startedAt = Date.now();
+		const chunks: Buffer[] = [];
+		let statusCode = 200;
+		let headers: Record<string, string | string[] | number | undefined> = {};
+
+		// Capture the status code; the end put back is the one found here, so
+		// anything already teeing the response (the HAR recorder) still sees it
+		const originalWriteHead = res.writeHead.bind(res);
+		const originalEnd = res.end.bind(res);
+		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+		(res as any).writeHead = (code: number, ...args: any[]) => {
+			statusCode = code;
+			// Extract headers if provided
+			if (args.length > 0 && typeof args[args.length - 1] === "object") {
+				headers = args[args.length - 1];
+			}
+			// Don't call originalWriteHead yet - we'll do it after mischief
+			return res;
+		};
+
+		// Capture setHeader calls
+		const capturedHeaders: Record<string, string | string[]> = {};
+		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+		(res as any).setHeader = (name: string, value: any) => {
+			capturedHeaders[name.toLowerCase()] = value;
+			return res;
+		};
+
+		// Capture writes - don't write yet, just buffer
+		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+		(res as any).write = (chunk: any, _encoding?: any, _cb?: any) => {
+			if (chunk) {
+				chunks.push(Buffer.isBuffer(chunk) ? chunk : Buffer.from(String(chunk)));
+			}
+			return true;
+		};
+
+		// Intercept end - this is where we apply mischief and write everything
+		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+		(res as any).end = (chunk?: any, _encoding?: any, _cb?: any) => {
+			if (chunk && typeof chunk !== "function") {
+				chunks.push(Buffer.isBuffer(chunk) ? chunk : Buffer.from(String(chunk)));
+			}
+
+			const body = Buffer.concat(chunks).toString();
+			const extraHeaders: Record<string, string> = {};
+			if (session && statusCode === 200) {
+				this.recordRefreshIssuance(session, body, refreshToken);
+			}
+			const exchange = this.dpopExchanges.get(req);
+			if (session && exchange) {
+				const nonce = capturedHeaders["dpop-nonce"] ?? headers["DPoP-Nonce"];
+				let outcome: "challenged" | "accepted" | "rejected" = "rejected";
+				if (statusCode === 200) {
+					outcome = "accepted";
+				} else if (statusCode === 400 && body.includes('"use_dpop_nonce"')) {
+					outcome = "challenged";
+				}
+				this.recordDpopExchange(session, exchange, outcome, nonce ? String(nonce) : null);
+			}
+
+			// Apply mischief asynchronously then complete the response
+			const endpoint = req.url ?? "/token";
+			const thumbprint = clientCertificateThumbprint(req);
+			const tenant = this.tenantRequests.get(res);
+			this.applyMischiefToTokenResponse(
+				body,
+				session,
+				endpoint,
+				extraHeaders,
+				thumbprint,
+				tenant,
+				this.tokenExchanges.get(res),
+				this.dpopThumbprints.get(res),
+				this.tokenGrants.get(res),
+			)
+				.then(async (modifiedBody) => {
+					await this.applyResponseTiming(
+						res,
+						endpoint,
+						{},
+						statusCode,
+						modifiedBody,
+						session,
+						startedAt,
+					);
+
+					// Keep what was sent, so it can be replayed verbatim
+					if (session && statusCode === 200) {
+						this.lastTokenResponses.set(session.id, modifiedBody);
+						if (this.database) {
+							this.database.saveLastTokenResponse(session.id, modifiedBody);
+						}
+					}
+
+					// Merge headers
+					const finalHeaders = { ...capturedHeaders, ...headers, ...extraHeaders };
+					const sent = this.negotiateTokenResponse(
+						req,
+						session,
+						statusCode,
+						modifiedBody,
+						finalHeaders,
+						extraHeaders,
+					);
+					// Update content-length for modified body
+					finalHeaders["content-length"] = Buffer.byteLength(sent);
+
+					// Now actually write the response
+					originalWriteHead(statusCode, finalHeaders);
+					res.end = originalEnd;
+					res.end(sent);
+				})
+				.catch(() => {
+					// On error, send original body
+					const finalHeaders = { ...capturedHeaders, ...headers };
+					originalWriteHead(statusCode, finalHeaders);
+					res.end = originalEnd;
+					res.end(body);
+				});
+		};
+
+		providerCallback(req, res);
+	}
+
+	/**
+	 * Form-encode a token response whose client's `Accept` prefers it; a
+	 * Content-Type mischief set in `overrides` is served whatever was
+	 * negotiated. For sessions, a response served as anything but JSON is
+	 * recorded
+	 */
+	private negotiateTokenResponse(
+		req: IncomingMessage,
+		session: Session | undefined,
+		status: number,
+		body: string,
+		headers: Record<string, string | string[] | number | undefined>,
+		overrides: Record<string, string>,
+	): string {
+		const accept = req.headers.accept;
+		const negotiated = negotiateTokenMediaType(accept);
+		const form = negotiated === FORM_MEDIA_TYPE ? formEncodeTokenResponse(body) : undefined;
+		if (form !== undefined) {
+			setHeaderValue(headers, "content-type", FORM_MEDIA_TYPE);
+		}
+		const override = headerValue(overrides, "content-type");
+		if (override !== undefined) {
+			setHeaderValue(headers, "content-type", override);
+		}
+		const served = headerValue(headers, "content-type");
+		if (session && served !== undefined && mediaTypeOf(served) !== JSON_MEDIA_TYPE) {
+			this.eventLog.record(session.id, "token-content-type", {
+				status,
+				accept: accept ?? null,
+				negotiated,
+				served,
+			});
+		}
+		return form ?? body;
+	}
+
+	/**
+	 * Bind the refresh token a successful token request issued to the
+	 * session, recorded as the successor of the one presented, if any
+	 */
+	private recordRefreshIssuance(session: Session, body: string, presented?: string): void {
+		try {
+			const issued = JSON.parse(body).refresh_token;
+			if (typeof issued === "string" && isOpaqueRefreshToken(issued)) {
+				this.refreshLedger.issue(session.id, issued);
+				if (presented !== undefined) {
+					this.refreshLedger.rotate(session.id, presented, issued);
+				}
+			}
+		} catch {
+			// Not JSON, nothing was issued
+		}
+	}
+
+	/**
+	 * The token endpoint as the provider serves it, except that Loki answers
+	 * token exchange requests (RFC 8693) itself
+	 */
+	private tokenResponder(
+		providerCallback: ReturnType<Provider["callback"]>,
+	): (req: IncomingMessage, res: ServerResponse) => void {
+		return (req, res) => {
+			readBody(req)
+				.then(async (body) => {
+					const params = parseParams(req.url ?? "/token", body);
+					if (params.grant_type === TOKEN_EXCHANGE_GRANT) {
+						await this.exchangeToken(req, res, params, body);
+					} else {
+						providerCallback(replayRequest(req, body), res);
+					}
+				})
+				.catch((err) => {
+					sendInternalError(res, err);
+				});
+		};
+	}
+
+	/**
+	 * Answer a token exchange request with a new access token for the subject
+	 * token's subject, acted for by the actor token's subject or the client
+	 *
+	 * The client must authenticate if it has a secret, and be registered for
+	 * the grant (`400 unauthorized_client` otherwise). A subject or actor
+	 * token Loki didn't issue, or that is expired or revoked, gets
+	 * `400 invalid_grant`, as does an actor the subject token's `may_act`
+	 * doesn't name. The response goes out through whatever intercepts it, so
+	 * session mischief applies as for any other grant.
+	 */
+	private async exchangeToken(
+		req: IncomingMessage,
+		res: ServerResponse,
+		params: Record<string, string>,
+		body: Buffer,
+	): Promise<void> {
+		const noStore = { "Cache-Control": "no-store" };
+		const clientId = requestClientId(req.headers.authorization, params);
+		const client = this.clients.get(clientId);
+		if (
+			!client ||
+			(clientType(client) === "confidential" &&
+				!authenticatesWithSecret(client, req.headers, params))
+		) {
+			const rejection = oauthError(
+				"invalid_client",
+				"client_authentication_failed",
+				"client authentication failed",
+				{ clientId: clientId ?? null },
+			);
+			sendError(res, 401, rejection, { ...noStore, "WWW-Authenticate": 'Basic realm="loki"' });
+			return;
+		}
+		if (!client.grant_types?.includes(TOKEN_EXCHANGE_GRANT)) {
+			const rejection = oauthError(
+				"unauthorized_client",
+				"grant_not_registered",
+				"the client isn't registered for token exchange",
+				{ clientId: client.client_id, grantType: TOKEN_EXCHANGE_GRANT },
+			);
+			sendError(res, 400, rejection, noStore);
+			return;
+		}
+		const request = parseExchangeRequest(body);
+		if (typeof request === "string") {
+			const rejection = oauthError("invalid_request", "invalid_token_exchange", request);
+			sendError(res, 400, rejection, noStore);
+			return;
+		}
+
+		const refuse = (code: "subject_token_invalid" | "actor_not_permitted", message: string) => {
+			const rejection = oauthError("invalid_grant", code, message, { clientId: client.client_id });
+			sendError(res, 400, rejection, noStore);
+		};
+		const subject = await this.exchangeableClaims(request.subjectToken, "subject_token");
+		if (typeof subject === "string") {
+			refuse("subject_token_invalid", subject);
+			return;
+		}
+		let actor: unknown = client.client_id;
+		if (request.actorToken !== undefined) {
+			const actorClaims = await this.exchangeableClaims(request.actorToken, "actor_token");
+			if (typeof actorClaims === "string") {
+				refuse("subject_token_invalid", actorClaims);
+				return;
+			}
+			actor = actorClaims.sub;
+		}
+		if (typeof subject.sub !== "string" || typeof actor !== "string") {
+			refuse("subject_token_invalid", "the subject and actor tokens must name a subject");
+			return;
+		}
+		if (!mayAct(subject.may_act, actor)) {
+			refuse("actor_not_permitted", `${actor} may not act for ${subject.sub}`);
+			return;
+		}
+
+		const issuedAt = Math.floor(Date.now() / 1000);
+		const claims: JWTClaims = {
+			iss: this.issuer,
+			sub: subject.sub,
+			aud: request.audience.length > 0 ? resourceAudience(request.audience) : DEFAULT_RESOURCE,
+			client_id: client.client_id,
+			iat: issuedAt,
+			exp: issuedAt + EXCHANGED_TOKEN_LIFETIME,
+			jti: randomId(21),
+			act: delegate(actor, subject.act),
+		};
+		const scope = params.scope ?? subject.scope;
+		if (typeof scope === "string") {
+			claims.scope = scope;
+		}
+		if (subject.may_act !== undefined) {
+			claims.may_act = subject.may_act;
+		}
+		const unsigned = createToken({ alg: "none", typ: "at+jwt" }, claims).build();
+		const { token } = await this.keyManager.resign(unsigned, "access_token");
+
+		this.tokenExchanges.set(res, { audience: request.audience, actors: actorChain(claims.act) });
+		const response: Record<string, unknown> = {
+			access_token: token,
+			issued_token_type: ACCESS_TOKEN_TYPE,
+			token_type: this.dpopThumbprints.has(res) ? "DPoP" : "Bearer",
+			expires_in: EXCHANGED_TOKEN_LIFETIME,
+		};
+		if (typeof scope === "string") {
+			response.scope = scope;
+		}
+		res.writeHead(200, { "Content-Type": "application/json", ...noStore });
+		res.end(JSON.stringify(response));
+	}
+
+	/**
+	 * The claims of a subject or actor token Loki issued, signed with one of
+	 * its keys for one of its issuers and still valid; otherwise why not
+	 */
+	private async exchangeableClaims(
+		token: string,
+		parameter: string,
+	): Promise<Record<string, unknown> | string> {
+		const jws = token.split("~")[0] ?? token;
+		let claims: Record<string, unknown>;
+		let header: Record<string, unknown>;
+		try {
+			claims = jose.decodeJwt(jws) as Record<string, unknown>;
+			header = jose.decodeProtectedHeader(jws) as Record<string, unknown>;
+		} catch {
+			return `${parameter} is not a JWT`;
+		}
+		const issuers = [this.issuer, ...Object.values(this.tenants.issuers())];
+		if (
+			typeof claims.iss !== "string" ||
+			!issuers.includes(claims.iss) ||
+			!(await signingKeyOf(jws, header, this.lokiSigningKeys()))
+		) {
+			return `${parameter} wasn't issued by Loki`;
+		}
+		const isRevoked = (jti: string) => this.revocationList?.isRevoked(jti) ?? false;
+		const { reason } = tokenState({ claims, tokenType: null }, claims, isRevoked);
+		return reason === null ? claims : `${parameter} is ${reason}`;
+	}
+
+	/**
+	 * Apply mischief to a token endpoint response
+	 */
+	private async applyMischiefToTokenResponse(
+		body: string,
+		session: Session | undefined,
+		endpoint: string,
+		extraHeaders: Record<string, string>,
+		certThumbprint?: string,
+		tenant?: TenantStatus,
+		exchange?: TokenExchange,
+		dpopThumbprint?: string,
+		grantType?: string,
+	): Promise<string> {
+		if (!this.mischiefEngine) {
+			return body;
+		}
+
+		// Try to parse as JSON
+		let response: Record<string, unknown>;
+		try {
+			response = JSON.parse(body);
+		} catch {
+			// Not JSON, return as-is
+			return body;
+		}
+
+		// Check if this is a token response
+		const accessToken = response.access_token as string | undefined;
+		const idToken = response.id_token as string | undefined;
+
+		if (!accessToken && !idToken) {
+			// Not a token response
+			return body;
+		}
+
+		// A tenant's tokens are signed with its own key, and a session's naming
+		// a registered key with that
+		const keyId = tenant ? tenantKeyId(tenant.id) : session?.keyId;
+
+		// Grant the authorization details the client requested (RFC 9396 Section 7)
+		const granted = session && accessToken ? this.grantedDetails(session, accessToken) : undefined;
+		if (granted && accessToken) {
+			const token = parseToken(accessToken);
+			token.claims.authorization_details = granted;
+			const resigned = await this.keyManager.resign(token.build(), "access_token", keyId);
+			response.access_token = resigned.token;
+			response.authorization_details = granted;
+		}
+
+		// Bind the access token to the client certificate presented (RFC 8705 Section 3.1)
+		const bindable = response.access_token;
+		if (certThumbprint && typeof bindable === "string" && bindable.split(".").length === 3) {
+			const token = parseToken(bindable);
+			if (bindCertificate(token.claims, certThumbprint)) {
+				const resigned = await this.keyManager.resign(token.build(), "access_token", keyId);
+				response.access_token = resigned.token;
+			}
+		}
+
+		// Bind it to the key the DPoP proof was signed with (RFC 9449 Section 6.1)
+		const proven = response.access_token;
+		if (dpopThumbprint && typeof proven === "string" && proven.split(".").length === 3) {
+			const token = parseToken(proven);
+			if (bindDpopKey(token.claims, dpopThumbprint)) {
+				const resigned = await this.keyManager.resign(token.build(), "access_token", keyId);
+				response.access_token = resigned.token;
+			}
+		}
+
+		// Grant the scope the client requested (RFC 6749 Section 3.3), for the
+		// resources it named (RFC 8707 Section 2)
+		const issuance: IssuanceContext = {};
+		if (grantType !== undefined) {
+			issuance.grantType = grantType;
+		}
+		if (dpopThumbprint !== undefined) {
+			issuance.dpopThumbprint = dpopThumbprint;
+		}
+		if (session) {
+			const resources = await this.grantRequestedResources(session, response, keyId);
+			if (resources) {
+				issuance.requestedAudience = resources;
+			}
+			await this.grantRequestedScope(session, response, keyId);
+		}
+
+		// An exchanged token is reported with the audience it was asked for, and
+		// the actor chain it was issued with (RFC 8693 Section 4.1)
+		if (exchange) {
+			if (exchange.audience.length > 0) {
+				issuance.requestedAudience ??= exchange.audience;
+			}
+			issuance.actors = exchange.actors;
+		}
+
+		// Check the ID token's auth_time against the max_age its client requested,
+		// echo the nonce it sent and add the claims it asked for
+		if (session && idToken) {
+			const answered = await this.answerMaxAge(session, idToken);
+			const reflected = await this.reflectNonce(session, answered);
+			const claimed = await this.deliverRequestedClaims(session, reflected.token);
+			response.id_token = claimed.token;
+			if (reflected.nonce !== undefined) {
+				issuance.expectedNonce = reflected.nonce;
+			}
+			if (claimed.requested !== undefined) {
+				issuance.requestedClaims = claimed.requested;
+			}
+		}
+
+		// A tenant's tokens carry the tenant's issuer, signed with its key
+		if (tenant) {
+			for (const field of ["access_token", "id_token"] as const) {
+				const issued = response[field];
+				if (typeof issued === "string" && issued.split(".").length === 3) {
+					const token = parseToken(issued);
+					token.claims.iss = tenant.issuer;
+					response[field] = (await this.keyManager.resign(token.build(), field, keyId)).token;
+				}
+			}
+		}
+
+		// A client_credentials token speaks for its client alone: no user or login claims
+		if (grantProfile(grantType) === "machine") {
+			await this.issueMachineToken(response, keyId);
+		}
+
+		// Re-sign with the rollover plan's, key set's or session's key before any mischief runs
+		if (this.keyManager.overridesSigning || keyId !== undefined) {
+			if (accessToken?.includes(".") && response.access_token === accessToken) {
+				const resigned = await this.keyManager.resign(accessToken, "access_token", keyId);
+				response.access_token = resigned.token;
+			}
+			if (idToken?.includes(".") && response.id_token === idToken) {
+				response.id_token = (await this.keyManager.resign(idToken, "id_token", keyId)).token;
+			}
+		}
+
+		// Every JWT carries iat, so freshness checks have something to go on
+		if (this.config.provider.requireIat !== false) {
+			for (const field of ["access_token", "id_token"] as const) {
+				const token = response[field];
+				const stamped =
+					typeof token === "string" ? await this.stampIat(token, field, keyId) : undefined;
+				if (stamped) {
+					response[field] = stamped;
+				}
+			}
+		}
+
+		// A session may pick the form a single audience is serialized in
+		if (session?.audFormat) {
+			await this.formatSessionAudience(session.audFormat, response, keyId);
+		}
+
+		// A session may set how long its access tokens live
+		if (session?.tokenLifetime) {
+			await this.applyTokenLifetime(tokenLifetimeSeconds(session.tokenLifetime), response, keyId);
+		}
+
+		// A session issuing SD-JWTs sends its claims as disclosures
+		if (session?.sdJwt) {
+			await this.discloseSessionClaims(session.sdJwt, response, keyId);
+		}
+
+		// The ID token's at_hash covers the access token as the client receives it
+		await this.bindAccessTokenHash(response, keyId);
+
+		// Found before mischief can change the ID token's aud or azp
+		const encryption = this.idTokenEncryptionFor(response);
+
+		// A frozen session replays its captured response
+		if (session?.freeze?.response) {
+			extraHeaders["x-loki-frozen"] = "true";
+			return this.serveFrozen(session.freeze, session.keyId);
+		}
+
+		if (!session || this.consumeWarmup(session, extraHeaders)) {
+			const sent = await this.encryptIdToken(response, encryption);
+			if (session) {
+				this.captureFreeze(session, sent);
+				await this.recordIssued(session, response, {}, issuance);
+			}
+			return JSON.stringify(sent);
+		}
+
+		const requestCtx: RequestContext = {
+			requestId: currentRequestId(),
+			session,
+			endpoint,
+			method: "POST",
+			timestamp: new Date(),
+			tenant: { id: tenant?.id ?? null, issuers: this.tenants.issuers() },
+		};
+
+		// A probabilistic session draws once per token request, for every token it carries
+		if (session.mode === "probabilistic") {
+			requestCtx.mischief = drawMischief(session);
+			issuance.drawn = requestCtx.mischief;
+			if (this.database) {
+				this.database.saveSession(session);
+			}
+		}
+
+		// Apply mischief to access_token if present and looks like JWT
+		const applied: IssuedMischief = {};
+		const signedAccessToken = response.access_token as string | undefined;
+		if (signedAccessToken?.includes(".")) {
+			const result = await this.mischiefEngine.applyToToken(
+				signedAccessToken,
+				requestCtx,
+				"access_token",
+			);
+			if (result.applications.length > 0) {
+				response.access_token = result.token;
+				applied.access_token = {
+					original: signedAccessToken,
+					applications: result.applications,
+				};
+			}
+		}
+
+		// Apply mischief to id_token if present, with the access token its at_hash covers
+		if (applied.access_token) {
+			await this.bindAccessTokenHash(response, keyId);
+		}
+		const signedIdToken = response.id_token as string | undefined;
+		if (signedIdToken?.includes(".")) {
+			const result = await this.mischiefEngine.applyToToken(
+				signedIdToken,
+				requestCtx,
+				"id_token",
+				typeof response.access_token === "string" ? response.access_token : undefined,
+				issuance.requestedClaims,
+			);
+			if (result.applications.length > 0) {
+				response.id_token = result.token;
+				applied.id_token = { original: signedIdToken, applications: result.applications };
+			}
+		}
+
+		// Encrypt the ID token (OIDC Core Section 10.2) before response-phase mischief sees it
+		let sent = await this.encryptIdToken(response, encryption);
+		const served: TokenServed = {};
+		const signed = response.id_token;
+		if (encryption && typeof signed === "string" && sent.id_token !== signed) {
+			served.idTokenEncryption = {
+				alg: encryption.alg,
+				enc: encryption.enc,
+				signed,
+				encrypt: (alg, enc) => encryptIdToken(signed, encryption, alg, enc),
+			};
+		}
+
+		// Apply response-phase mischief (like latency injection or extra fields)
+		const responsePhase = await this.mischiefEngine.applyToResponse(requestCtx, sent, served);
+		Object.assign(extraHeaders, responsePhase.headers);
+		const responseBody = responsePhase.body;
+		if (typeof responseBody === "object" && responseBody !== null && !Array.isArray(responseBody)) {
+			sent = responseBody as Record<string, unknown>;
+		}
+
+		// The issuance log keeps the signed ID token an encrypted one carries
+		const issued =
+			served.idTokenEncryption && "id_token" in sent ? { ...sent, id_token: signed } : sent;
+		this.captureFreeze(session, sent);
+		await this.recordIssued(session, issued, applied, issuance);
+		return JSON.stringify(sent);
+	}
+
+	/**
+	 * The ID token encryption registered by the client a token response's
+	 * ID token was issued to (its azp, else its aud), if any
+	 */
+	private idTokenEncryptionFor(response: Record<string, unknown>): IdTokenEncryption | undefined {
+		const idToken = response.id_token;
+		if (typeof idToken !== "string" || idToken.split(".").length !== 3) {
+			return undefined;
+		}
+		let clientId: unknown;
+		try {
+			const { aud, azp } = jose.decodeJwt(idToken);
+			clientId = azp ?? (Array.isArray(aud) ? aud[0] : aud);
+		} catch {
+			return undefined;
+		}
+		return typeof clientId === "string" ? this.clients.idTokenEncryption(clientId) : undefined;
+	}
+
+	/**
+	 * A token response with its ID token encrypted to the client's key; the
+	 * response itself when there's no key or no signed ID token
+	 */
+	private async encryptIdToken(
+		response: Record<string, unknown>,
+		encryption: IdTokenEncryption | undefined,
+	): Promise<Record<string, unknown>> {
+		const idToken = response.id_token;
+		if (!encryption || typeof idToken !== "string" || idToken.split(".").length !== 3) {
+			return response;
+		}
+		return { ...response, id_token: await encryptIdToken(idToken, encryption) };
+	}
+
+	/**
+	 * Add `iat` to a JWT that lacks one and re-sign it; undefined if it has one
+	 */
+	private async stampIat(
+		token: string,
+		field: "access_token" | "id_token",
+		keyId: string | undefined,
+	): Promise<string | undefined> {
+		if (token.split(".").length !== 3) {
+			return undefined;
+		}
+		const forged = parseToken(token);
+		if (typeof forged.claims.iat === "number") {
+			return undefined;
+		}
+		forged.claims.iat = Math.floor(Date.now() / 1000);
+		return (await this.keyManager.resign(forged.build(), field, keyId)).token;
+	}
+
+	/**
+	 * Serialize the single audience of a token response's JWTs in the
+	 * session's form, re-signing only the tokens that change
+	 */
+	private async formatSessionAudience(
+		format: AudFormat,
+		response: Record<string, unknown>,
+		keyId: string | undefined,
+	): Promise<void> {
+		for (const field of ["access_token", "id_token"] as const) {
+			const issued = response[field];
+			if (typeof issued !== "string" || issued.split(".").length !== 3) {
+				continue;
+			}
+			const token = parseToken(issued);
+			const aud = formatAudience(token.claims.aud, format);
+			if (aud !== undefined) {
+				token.claims.aud = aud;
+				response[field] = (await this.keyManager.resign(token.build(), field, keyId)).token;
+			}
+		}
+	}
+
+	/**
+	 * Set a token response's JWT access token to expire `seconds` after its
+	 * iat, re-signed, and its expires_in to match
+	 */
+	private async applyTokenLifetime(
+		seconds: number,
+		response: Record<string, unknown>,
+		keyId: string | undefined,
+	): Promise<void> {
+		const issued = response.access_token;
+		if (typeof issued !== "string" || issued.split(".").length !== 3) {
+			return;
+		}
+		const token = parseToken(issued);
+		const { iat } = token.claims;
+		token.claims.exp = (typeof iat === "number" ? iat : Math.floor(Date.now() / 1000)) + seconds;
+		const resigned = await this.keyManager.resign(token.build(), "access_token", keyId);
+		response.access_token = resigned.token;
+		response.expires_in = seconds;
+	}
+
+	/**
+	 * Issue a token response's JWTs as SD-JWTs, moving the configured claims
+	 * each carries into disclosures and re-signing its payload with their digests
+	 */
+	private async discloseSessionClaims(
+		sdJwt: SdJwtConfig,
+		response: Record<string, unknown>,
+		keyId: string | undefined,
+	): Promise<void> {
+		const target = sdJwt.tokens ?? "both";
+		for (const field of ["access_token", "id_token"] as const) {
+			const issued = response[field];
+			if (target !== "both" && target !== field) {
+				continue;
+			}
+			if (typeof issued !== "string" || issued.split(".").length !== 3) {
+				continue;
+			}
+			const token = parseToken(issued);
+			const disclosures = discloseClaims(token.claims, sdJwt.claims);
+			token.disclosures = [...(token.disclosures ?? []), ...disclosures];
+			response[field] = (await this.keyManager.resign(token.build(), field, keyId)).token;
+		}
+	}
+
+	/**
+	 * Strip user-only claims from a machine-to-machine access token and make
+	 * its `sub` the client's ID, re-signing only when a claim changes
+	 */
+	private async issueMachineToken(
+		response: Record<string, unknown>,
+		keyId: string | undefined,
+	): Promise<void> {
+		const accessToken = response.access_token;
+		if (typeof accessToken !== "string" || accessToken.split(".").length !== 3) {
+			return;
+		}
+		const token = parseToken(accessToken);
+		if (toMachineClaims(token.claims).length === 0) {
+			return;
+		}
+		const resigned = await this.keyManager.resign(token.build(), "access_token", keyId);
+		response.access_token = resigned.token;
+	}
+
+	/**
+	 * Set the ID token's at_hash to cover the access token sent with it: the
+	 * left-most half of its hash under the alg of the key that re-signs the ID
+	 * token (OIDC Core Section 3.3.2.11), re-signing only when the claim changes
+	 */
+	private async bindAccessTokenHash(
+		response: Record<string, unknown>,
+		keyId: string | undefined,
+	): Promise<void> {
+		const { access_token: accessToken, id_token: idToken } = response;
+		if (typeof accessToken !== "string" || typeof idToken !== "string") {
+			return;
+		}
+		if (idToken.split(".").length !== 3) {
+			return;
+		}
+		const forged = parseToken(idToken);
+		if (!SUPPORTED_SIGNING_ALGORITHMS.includes(forged.header.alg as SigningAlgorithm)) {
+			return;
+		}
+		const atHash = tokenHash(accessToken, this.keyManager.signingKeyFor(keyId).alg);
+		if (forged.claims.at_hash === atHash) {
+			return;
+		}
+		forged.claims.at_hash = atHash;
+		response.id_token = (await this.keyManager.resign(forged.build(), "id_token", keyId)).token;
+	}
+
+	/**
+	 * Put the scope a JWT access token's client requested at the token
+	 * endpoint in the token's `scope` claim and the response's `scope`,
+	 * re-signing only when the claim changes
+	 */
+	private async grantRequestedScope(
+		session: Session,
+		response: Record<string, unknown>,
+		keyId: string | undefined,
+	): Promise<void> {
+		const accessToken = response.access_token;
+		if (typeof accessToken !== "string" || accessToken.split(".").length !== 3) {
+			return;
+		}
+		let clientId: unknown;
+		try {
+			clientId = jose.decodeJwt(accessToken).client_id;
+		} catch {
+			return;
+		}
+		const scopes =
+			typeof clientId === "string" ? this.scopeRequests.take(session.id, clientId) : undefined;
+		if (!scopes) {
+			return;
+		}
+		const scope = scopes.join(" ");
+		response.scope = scope;
+		const token = parseToken(accessToken);
+		if (token.claims.scope === scope) {
+			return;
+		}
+		token.claims.scope = scope;
+		const resigned = await this.keyManager.resign(token.build(), "access_token", keyId);
+		response.access_token = resigned.token;
+	}
+
+	/**
+	 * Set a JWT access token's `aud` to the resources its client requested at
+	 * the token endpoint, re-signing only when the claim changes; resolves to
+	 * the resources, if the client named any
+	 */
+	private async grantRequestedResources(
+		session: Session,
+		response: Record<string, unknown>,
+		keyId: string | undefined,
+	): Promise<string[] | undefined> {
+		const accessToken = response.access_token;
+		if (typeof accessToken !== "string" || accessToken.split(".").length !== 3) {
+			return undefined;
+		}
+		let clientId: unknown;
+		try {
+			clientId = jose.decodeJwt(accessToken).client_id;
+		} catch {
+			return undefined;
+		}
+		const resources =
+			typeof clientId === "string" ? this.resourceRequests.take(session.id, clientId) : undefined;
+		if (!resources) {
+			return undefined;
+		}
+		const token = parseToken(accessToken);
+		const aud = resourceAudience(resources);
+		if (JSON.stringify(token.claims.aud) !== JSON.stringify(aud)) {
+			token.claims.aud = aud;
+			const resigned = await this.keyManager.resign(token.build(), "access_token", keyId);
+			response.access_token = resigned.token;
+		}
+		return resources;
+	}
+
+	/**
+	 * The authorization details requested for a JWT access token's client, if any
+	 */
+	private grantedDetails(session: Session, accessToken: string): AuthorizationDetail[] | undefined {
+		if (accessToken.split(".").length !== 3) {
+			return undefined;
+		}
+		try {
+			const { client_id: clientId } = jose.decodeJwt(accessToken);
+			return typeof clientId === "string"
+				? this.authorizationDetails.granted(session.id, clientId)
+				: undefined;
+		} catch {
+			return undefined;
+		}
+	}
+
+	/**
+	 * Record whether an ID token's auth_time satisfies the max_age its client
+	 * requested
+	 *
+	 * When mischief ignored `max_age=0` but the user logged in anyway, the
+	 * auth_time is backdated so the token still claims a stale login.
+	 */
+	private async answerMaxAge(session: Session, idToken: string): Promise<string> {
+		if (idToken.split(".").length !== 3) {
+			return idToken;
+		}
+		let claims: jose.JWTPayload;
+		try {
+			claims = jose.decodeJwt(idToken);
+		} catch {
+			return idToken;
+		}
+		const clientId = typeof claims.azp === "string" ? claims.azp : [claims.aud ?? []].flat()[0];
+		const request = clientId ? this.maxAgeRequests.take(session.id, clientId) : undefined;
+		if (!request) {
+			return idToken;
+		}
+
+		let token = idToken;
+		let authTime = typeof claims.auth_time === "number" ? claims.auth_time : undefined;
+		const fresh = authTime === undefined || authTime >= request.requestedAt;
+		if (request.staleSeconds !== undefined && fresh) {
+			const forged = parseToken(idToken);
+			authTime = request.requestedAt - request.staleSeconds;
+			forged.claims.auth_time = authTime;
+			token = (await this.keyManager.resign(forged.build(), "id_token", session.keyId)).token;
+		}
+
+		this.eventLog.record(session.id, "auth-time-issued", {
+			clientId,
+			maxAge: request.maxAge,
+			authTime: authTime ?? null,
+			honored: authTimeHonors(request, authTime),
+		});
+		return token;
+	}
+
+	/**
+	 * Echo the nonce an ID token's client requested, re-signing the token
+	 * if the provider's doesn't already carry it
+	 */
+	private async reflectNonce(
+		session: Session,
+		idToken: string,
+	): Promise<{ token: string; nonce?: string }> {
+		if (idToken.split(".").length !== 3) {
+			return { token: idToken };
+		}
+		let claims: jose.JWTPayload;
+		try {
+			claims = jose.decodeJwt(idToken);
+		} catch {
+			return { token: idToken };
+		}
+		const clientId = typeof claims.azp === "string" ? claims.azp : [claims.aud ?? []].flat()[0];
+		const nonce = clientId ? this.nonceRequests.take(session.id, clientId) : undefined;
+		if (nonce === undefined) {
+			return { token: idToken };
+		}
+		if (claims.nonce === nonce) {
+			return { token: idToken, nonce };
+		}
+		const forged = parseToken(idToken);
+		forged.claims.nonce = nonce;
+		const resigned = await this.keyManager.resign(forged.build(), "id_token", session.keyId);
+		return { token: resigned.token, nonce };
+	}
+
+	/**
+	 * Add the claims an ID token's client requested for it that the account
+	 * holds, re-signing the token if the provider's lacks any
+	 */
+	private async deliverRequestedClaims(
+		session: Session,
+		idToken: string,
+	): Promise<{ token: string; requested?: RequestedClaims }> {
+		if (idToken.split(".").length !== 3) {
+			return { token: idToken };
+		}
+		let claims: jose.JWTPayload;
+		try {
+			claims = jose.decodeJwt(idToken);
+		} catch {
+			return { token: idToken };
+		}
+		const clientId = typeof claims.azp === "string" ? claims.azp : [claims.aud ?? []].flat()[0];
+		const requested = clientId ? this.claimsRequests.get(session.id, clientId)?.idToken : undefined;
+		if (!requested || Object.keys(requested).length === 0 || typeof claims.sub !== "string") {
+			return { token: idToken };
+		}
+		const delivered = withRequestedClaims(claims, accountClaims(claims.sub), requested);
+		if (Object.keys(delivered).length === Object.keys(claims).length) {
+			return { token: idToken, requested };
+		}
+		const forged = parseToken(idToken);
+		Object.assign(forged.claims, delivered);
+		const resigned = await this.keyManager.resign(forged.build(), "id_token", session.keyId);
+		return { token: resigned.token, requested };
+	}
+
+	/**
+	 * Remember the JWTs a token response carries by jti, so the client can
+	 * report whether it accepted them, and log what mischief did to each
+	 * (and, for the ID token, the nonce it should have echoed)
+	 */
+	private async recordIssued(
+		session: Session,
+		response: Record<string, unknown>,
+		applied: IssuedMischief,
+		context: IssuanceContext = {},
+	): Promise<void> {
+		let candidates: CandidateKey[] | undefined;
+		for (const field of ["access_token", "id_token"] as const) {
+			const token = response[field];
+			if (typeof token !== "string") {
+				continue;
+			}
+			const applications = applied[field]?.applications ?? [];
+			const mischief = applications.map((a) => a.pluginId);
+			this.sessionStats.recordIssuance(session.id, mischief);
+			const jti = tokenJti(token);
+			if (jti !== undefined) {
+				this.tokenResults.issue(session.id, jti, field, mischief);
+			}
+			if (token.split(".").length === 3) {
+				if (!candidates) {
+					candidates = await this.candidateSigningKeys(session.id);
+				}
+				const mutations = applications.map((a) => ({
+					plugin: a.pluginId,
+					mutation: a.result.mutation,
+					evidence: a.result.evidence,
+				}));
+				const original = applied[field]?.original ?? token;
+				const issuance = { ...context };
+				if (field === "access_token" && typeof response.expires_in === "number") {
+					issuance.expiresIn = response.expires_in;
+				}
+				if (field !== "id_token") {
+					delete issuance.expectedNonce;
+					delete issuance.requestedClaims;
+				}
+				if (field !== "access_token") {
+					delete issuance.requestedAudience;
+					delete issuance.actors;
+					delete issuance.dpopThumbprint;
+				}
+				const recorded = await this.issuanceLog.record(
+					session.id,
+					field,
+					original,
+					token,
+					mutations,
+					candidates,
+					issuance,
+				);
+				if (recorded) {
+					if (this.database) {
+						this.database.saveIssuance(session.id, recorded);
+					}
+					this.announceIssuance(session, token, recorded);
+					this.liveEvents.publish({
+						type: "token.issued",
+						sessionId: session.id,
+						requestId: recorded.requestId ?? null,
+						tokenType: recorded.tokenType,
+						jti: recorded.jti,
+						mischief: recorded.mischief,
+						fingerprint: tokenFingerprint(token),
+						details: { signingKey: recorded.signingKey },
+					});
+				}
+			}
+		}
+	}
+
+	/**
+	 * POST an issuance to the session's webhook (or the global one) in the
+	 * background, recording the delivery's outcome as a session event
+	 */
+	private announceIssuance(session: Session, token: string, issuance: TokenIssuance): void {
+		const url = session.webhook ?? this.webhookUrl;
+		if (url === undefined) {
+			return;
+		}
+		const event = tokenIssuedEvent(session.id, token, issuance);
+		const queued = this.webhooks.send(url, event, (delivery) => {
+			// The session may have been deleted while the delivery was retrying
+			if (this.sessions.has(session.id)) {
+				this.eventLog.record(session.id, "webhook-delivered", { ...delivery, jti: event.jti });
+			}
+		});
+		if (!queued) {
+			const dropped = { url, delivered: false, attempts: 0, status: null, jti: event.jti };
+			this.eventLog.record(session.id, "webhook-delivered", { ...dropped, error: "queue full" });
+		}
+	}
+
+	/**
+	 * Every key a session's token could be signed with: Loki's, the
+	 * session's rogue JWKS and transient keys, and the attacker keys
+	 */
+	private async candidateSigningKeys(sessionId: string): Promise<CandidateKey[]> {
+		return [
+			...this.lokiSigningKeys(),
+			...(this.rogueJwks?.jwks(sessionId)?.keys ?? []).map((jwk) => ({
+				jwk,
+				source: "rogue-jwks" as const,
+			})),
+			...this.transientKeys.keys(sessionId).map((jwk) => ({
+				jwk,
+				source: "transient" as const,
+			})),
+			...(await generatedAttackerKeys()).map((key) => ({
+				jwk: key.publicJwk,
+				source: "attacker" as const,
+			})),
+		];
+	}
+
+	/**
+	 * Capture a token response for a session waiting to freeze
+	 */
+	private captureFreeze(session: Session, response: Record<string, unknown>): void {
+		const freeze = session.freeze;
+		if (!freeze || freeze.response) {
+			return;
+		}
+
+		freeze.response = { ...response };
+		freeze.capturedAt = new Date().toISOString();
+		if (this.database) {
+			this.database.saveSession(session);
+		}
+		this.eventLog.record(session.id, "token-frozen", {
+			keepFresh: freeze.keepFresh,
+			accessToken: response.access_token,
+			idToken: response.id_token,
+		});
+	}
+
+	/**
+	 * Serve a frozen token response, optionally with refreshed timestamps
+	 */
+	private async serveFrozen(freeze: SessionFreeze, keyId: string | undefined): Promise<string> {
+		const response = { ...freeze.response };
+		if (freeze.keepFresh) {
+			const key = this.keyManager.signingKeyFor(keyId);
+			const now = Math.floor(Date.now() / 1000);
+			for (const field of ["access_token", "id_token"]) {
+				const token = response[field];
+				if (typeof token === "string" && token.split(".").length === 3) {
+					response[field] = await refreshTokenTimes(token, key, now);
+				}
+			}
+		}
+		return JSON.stringify(response);
+	}
+
+	/**
+	 * Handle the revocation endpoint, recording successful revocations
+	 *
+	 * The request body is read to find the token, then replayed to the
+	 * provider. The revocation is recorded before the response is sent so a
+	 * resource server polling right after /revoke sees a consistent list
+	 * (unless mischief says otherwise).
+	 */
+	private async handleRevocationRequest(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+		providerCallback: ReturnType<Provider["callback"]>,
+	): Promise<void> {
+		const url = req.url ?? "/token/revocation";
+		const body = await readBody(req);
+		const params = parseParams(url, body);
+
+		const clientId = requestClientId(req.headers.authorization, params);
+
+		const originalEnd = res.end.bind(res);
+		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+		(res as any).end = (...args: any[]) => {
+			this.recordRevocation(url, params, res.statusCode, session, clientId)
+				.catch(() => {
+					// Recording is best-effort; never block the provider's response
+				})
+				.finally(() => {
+					res.end = originalEnd;
+					// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+					(originalEnd as any)(...args);
+				});
+			return res;
+		};
+
+		providerCallback(replayRequest(req, body), res);
+	}
+
+	/**
+	 * Record the device codes the provider issues
+	 *
+	 * The response gains the polling `interval` if the provider left it out,
+	 * so clients always know how long to wait between polls.
+	 */
+	private async handleDeviceAuthorizationRequest(
+		req: IncomingMessage,
+		res: ServerResponse,
+		providerCallback: ReturnType<Provider["callback"]>,
+	): Promise<void> {
+		const url = req.url ?? "/device_authorization";
+		const body = await readBody(req);
+		const clientId = requestClientId(req.headers.authorization, parseParams(url, body));
+
+		const originalEnd = res.end.bind(res);
+		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+		(res as any).end = (...args: any[]) => {
+			res.end = originalEnd;
+			const chunk = typeof args[0] === "function" ? undefined : args[0];
+			if (res.statusCode !== 200 || !chunk || res.headersSent) {
+				// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+				return (originalEnd as any)(...args);
+			}
+			let response: Record<string, unknown>;
+			try {
+				response = JSON.parse(String(chunk));
+			} catch {
+				// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+				return (originalEnd as any)(...args);
+			}
+			if (response.interval === undefined) {
+				response.interval = DEFAULT_POLLING_INTERVAL;
+			}
+			this.deviceCodes.issue(response, clientId);
+			const rewritten = JSON.stringify(response);
+			res.setHeader("Content-Length", Buffer.byteLength(rewritten));
+			return originalEnd(rewritten);
+		};
+
+		providerCallback(replayRequest(req, body), res);
+	}
+
+	/**
+	 * Handle introspection so endpoint mischief can shape its response timing
+	 */
+	private async handleIntrospectionRequest(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session,
+		providerCallback: ReturnType<Provider["callback"]>,
+	): Promise<void> {
+		const startedAt = Date.now();
+		const url = req.url ?? "/token/introspection";
+		const body = await readBody(req);
+		const params = parseParams(url, body);
+
+		const originalEnd = res.end.bind(res);
+		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+		(res as any).end = (...args: any[]) => {
+			const chunk = typeof args[0] === "function" ? undefined : args[0];
+			const responseBody = chunk ? String(chunk) : "";
+			const timing = this.applyResponseTiming(
+				res,
+				url,
+				params,
+				res.statusCode,
+				responseBody,
+				session,
+				startedAt,
+			);
+			timing.finally(() => {
+				res.end = originalEnd;
+				// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+				(originalEnd as any)(...args);
+			});
+			return res;
+		};
+
+		providerCallback(replayRequest(req, body), res);
+	}
+
+	/**
+	 * Answer a revocation request (RFC 7009)
+	 *
+	 * The caller must authenticate as a client with a secret. Any token is
+	 * answered with 200, whether or not Loki issued it (Section 2.2); the
+	 * token is revoked unless session mischief ignores the request. Without
+	 * a session header, a session token is revoked for the session that
+	 * issued it.
+	 */
+	private async handleRevoke(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+	): Promise<void> {
+		const url = req.url ?? REVOCATION_PATH;
+		const params = parseParams(url, await readBody(req));
+		const noStore = { "Cache-Control": "no-store" };
+
+		const clientId = requestClientId(req.headers.authorization, params);
+		const client = this.clients.get(clientId);
+		if (!client || !authenticatesWithSecret(client, req.headers, params)) {
+			const body = oauthError(
+				"invalid_client",
+				"client_authentication_failed",
+				"client authentication failed",
+				{ clientId: clientId ?? null },
+			);
+			sendError(res, 401, body, { ...noStore, "WWW-Authenticate": 'Basic realm="loki"' });
+			return;
+		}
+		const token = params.token;
+		if (!token) {
+			const body = oauthError("invalid_request", "token_missing", "token is required");
+			sendError(res, 400, body, noStore);
+			return;
+		}
+
+		let owner = session;
+		const issued = session ? undefined : this.issuanceLog.lookup(token);
+		if (issued) {
+			this.harRecorder.bind(res, issued.sessionId);
+			const bound = this.sessions.get(issued.sessionId);
+			owner = bound && this.matchesCondition(bound, req) ? bound : undefined;
+		}
+
+		await this.recordRevocation(url, params, 200, owner, client.client_id);
+		res.writeHead(200, noStore);
+		res.end();
+	}
+
+	/**
+	 * Answer an introspection request (RFC 7662) from the issuance log
+	 *
+	 * The caller must authenticate as a client with a secret. A token is
+	 * active if Loki issued it exactly as presented, within its validity
+	 * window and unrevoked; session mischief may report an inactive token
+	 * as active. Sessions get a `token-introspected` event either way.
+	 */
+	private async handleIntrospect(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+	): Promise<void> {
+		const url = req.url ?? INTROSPECTION_PATH;
+		const params = parseParams(url, await readBody(req));
+		const noStore = { "Cache-Control": "no-store" };
+
+		const clientId = requestClientId(req.headers.authorization, params);
+		const client = this.clients.get(clientId);
+		if (!client || !authenticatesWithSecret(client, req.headers, params)) {
+			const body = oauthError(
+				"invalid_client",
+				"client_authentication_failed",
+				"client authentication failed",
+				{ clientId: clientId ?? null },
+			);
+			sendError(res, 401, body, { ...noStore, "WWW-Authenticate": 'Basic realm="loki"' });
+			return;
+		}
+		const token = params.token;
+		if (!token) {
+			const body = oauthError("invalid_request", "token_missing", "token is required");
+			sendError(res, 400, body, noStore);
+			return;
+		}
+
+		// Without a session header, the exchange is recorded for the session the token came from
+		const issuedTo = session ? undefined : this.issuanceLog.lookup(token)?.sessionId;
+		if (issuedTo !== undefined) {
+			this.harRecorder.bind(res, issuedTo);
+		}
+
+		const state = await this.introspectedState(token);
+		let active = state.reason === null;
+		let mischief: string[] = [];
+		if (!active && session && state.reason !== null && this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: INTROSPECTION_PATH,
+				method: "POST",
+				timestamp: new Date(),
+			};
+			const introspection = { reason: state.reason, tokenType: state.tokenType };
+			const { actions, applications } = await this.mischiefEngine.applyToEndpoint(
+				{ path: INTROSPECTION_PATH, params, status: 0, introspection },
+				requestCtx,
+			);
+			active = actions.reportActive === true;
+			mischief = applications.map((a) => a.pluginId);
+		}
+
+		if (session) {
+			const jti = typeof state.claims?.jti === "string" ? state.claims.jti : null;
+			this.eventLog.record(session.id, "token-introspected", {
+				clientId: client.client_id,
+				jti,
+				reason: state.reason,
+				reportedActive: active,
+			});
+			this.liveEvents.publish({
+				type: "token.introspected",
+				sessionId: session.id,
+				requestId: currentRequestId(),
+				tokenType: state.tokenType,
+				jti,
+				mischief,
+				fingerprint: tokenFingerprint(token),
+				details: { clientId: client.client_id, reason: state.reason, reportedActive: active },
+			});
+		}
+		res.writeHead(200, { "Content-Type": "application/json", ...noStore });
+		res.end(JSON.stringify(introspectionResponse(state, active)));
+	}
+
+	/**
+	 * What Loki knows about a presented token: a session token from the
+	 * issuance log, otherwise any JWT one of Loki's keys signed
+	 */
+	private async introspectedState(token: string): Promise<TokenState> {
+		let presented: Record<string, unknown> | null = null;
+		try {
+			presented = jose.decodeJwt(token) as Record<string, unknown>;
+		} catch {
+			// Opaque or malformed; Loki only issues JWTs it can answer for
+		}
+
+		let issued: IssuedToken | undefined = this.issuanceLog.lookup(token);
+		if (!issued && presented) {
+			const header = jose.decodeProtectedHeader(token) as Record<string, unknown>;
+			if (await signingKeyOf(token, header, this.lokiSigningKeys())) {
+				issued = { claims: presented, tokenType: null };
+			}
+		}
+		const isRevoked = (jti: string) => this.revocationList?.isRevoked(jti) ?? false;
+		return tokenState(issued, presented, isRevoked);
+	}
+
+	/**
+	 * Hold a response back as long as endpoint mischief asks
+	 *
+	 * Plugins either request a fixed delay (`responseDelayMs`) or a total
+	 * duration measured from when the request arrived (`responsePadToMs`),
+	 * or that the response never be sent (`hangResponse`).
+	 * Best-effort: failures never block the provider's response.
+	 */
+	private async applyResponseTiming(
+		res: ServerResponse,
+		url: string,
+		params: Record<string, string>,
+		status: number,
+		body: string,
+		session: Session | undefined,
+		startedAt: number,
+	): Promise<void> {
+		if (!session || !this.mischiefEngine) {
+			return;
+		}
+
+		try {
+			const endpoint: Omit<EndpointContext, "actions"> = {
+				path: url.split("?")[0] ?? url,
+				params,
+				status,
+			};
+			try {
+				const parsed = JSON.parse(body);
+				if (parsed && typeof parsed === "object" && !Array.isArray(parsed)) {
+					endpoint.response = parsed;
+				}
+			} catch {
+				// Not JSON; plugins decide from the status alone
+			}
+
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: "POST",
+				timestamp: new Date(),
+			};
+			const { actions } = await this.mischiefEngine.applyToEndpoint(endpoint, requestCtx);
+
+			const delayMs = typeof actions.responseDelayMs === "number" ? actions.responseDelayMs : 0;
+			const padToMs = typeof actions.responsePadToMs === "number" ? actions.responsePadToMs : 0;
+			const waitMs = Math.max(delayMs, padToMs - (Date.now() - startedAt));
+			if (actions.hangResponse === true) {
+				await this.holdResponse(res);
+			} else if (waitMs > 0) {
+				await this.holdResponse(res, waitMs);
+			}
+		} catch {
+			// Timing is best-effort
+		}
+	}
+
+	/**
+	 * Wait `ms` before a response is sent, or without `ms` until the client
+	 * disconnects. Stopping Loki cuts the wait short; a hanging response's
+	 * connection is closed then rather than answered.
+	 */
+	private holdResponse(res: ServerResponse, ms?: number): Promise<void> {
+		return new Promise((resolve) => {
+			let timer: NodeJS.Timeout | undefined;
+			const release = () => {
+				clearTimeout(timer);
+				res.off("close", release);
+				this.heldResponses.delete(stop);
+				resolve();
+			};
+			const stop = () => {
+				release();
+				if (ms === undefined) {
+					res.destroy();
+				}
+			};
+			if (ms !== undefined) {
+				timer = setTimeout(release, Math.min(ms, MAX_TIMEOUT_MS));
+			}
+			res.once("close", release);
+			this.heldResponses.add(stop);
+		});
+	}
+
+	/**
+	 * Answer HEAD with the headers the GET response would carry
+	 *
+	 * The request is served as a GET; Node drops the body of a HEAD response
+	 * but keeps its Content-Length. Endpoint mischief may misreport that
+	 * length. HEAD on an endpoint without GET (the token endpoint) gets 405.
+	 */
+	private async handleHeadRequest(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+		allowedMethods: string[],
+		providerCallback: ReturnType<Provider["callback"]>,
+	): Promise<void> {
+		const url = req.url ?? "/";
+		const path = url.split("?")[0] ?? "/";
+		if (!allowedMethods.includes("GET")) {
+			const body = JSON.stringify(
+				oauthError("invalid_request", "method_not_allowed", `${path} does not support HEAD`, {
+					allow: allowedMethods,
+				}),
+			);
+			res.writeHead(405, {
+				Allow: allowedMethods.join(", "),
+				"Content-Type": "application/json",
+				"Content-Length": Buffer.byteLength(body),
+			});
+			res.end();
+			return;
+		}
+
+		let actions: Record<string, unknown> = {};
+		if (session && this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: "HEAD",
+				timestamp: new Date(),
+			};
+			({ actions } = await this.mischiefEngine.applyToEndpoint(
+				{ path, params: parseParams(url, Buffer.alloc(0)), status: 0 },
+				requestCtx,
+			));
+		}
+
+		const delta = actions.headContentLengthDelta;
+		if (typeof delta === "number" && delta !== 0) {
+			const originalWriteHead = res.writeHead.bind(res);
+			// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+			(res as any).writeHead = (status: number, ...args: any[]) => {
+				res.writeHead = originalWriteHead;
+				const headers = args[args.length - 1];
+				const key =
+					typeof headers === "object" && headers !== null && !Array.isArray(headers)
+						? Object.keys(headers).find((k) => k.toLowerCase() === "content-length")
+						: undefined;
+				const actual = Number(key ? headers[key] : res.getHeader("content-length"));
+				if (Number.isFinite(actual)) {
+					const advertised = Math.max(0, actual + delta);
+					if (key) {
+						headers[key] = advertised;
+					} else {
+						res.setHeader("content-length", advertised);
+					}
+				}
+				// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+				return (originalWriteHead as any)(status, ...args);
+			};
+		}
+
+		req.method = "GET";
+		const document = metadataDocumentAt(path);
+		const endpointType = document ? "discovery" : "jwks";
+		const intercepted =
+			endpointType === "discovery"
+				? document === "oauth-authorization-server" ||
+					session ||
+					this.tenantRequests.has(res) ||
+					this.disabledEndpoints.size > 0
+				: session ||
+					this.tenantRequests.has(res) ||
+					this.keyManager.overridesJwks ||
+					this.config.provider.jwksBearerToken !== undefined;
+		if (intercepted) {
+			this.handleDiscoveryRequest(req, res, session, providerCallback, endpointType);
+		} else {
+			providerCallback(req, res);
+		}
+	}
+
+	/**
+	 * Check the authorization request before the provider sees it
+	 *
+	 * oidc-provider only implements S256. A plain challenge is accepted when
+	 * the configured minimum allows it or endpoint mischief downgrades the
+	 * check, by rewriting it to the equivalent S256 challenge. A signed
+	 * request object whose jti the session has already used is refused unless
+	 * mischief accepts the replay. A session's `authorization_details` are
+	 * validated and remembered for the client, as are its `claims`, `max_age`
+	 * and `nonce`; `max_age=0` always forces a fresh login unless mischief
+	 * ignores it. The `response_mode` requested is honored by the provider
+	 * unless mischief picks another. A `redirect_uri` the client didn't
+	 * register is refused by the provider unless mischief accepts it. Outcomes
+	 * are recorded on the session's event log.
+	 */
+	private async handleAuthorizationRequest(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session | undefined,
+		providerCallback: ReturnType<Provider["callback"]>,
+	): Promise<void> {
+		const url = req.url ?? "/auth";
+		const params = parseParams(url, Buffer.alloc(0));
+		if (session && !this.requestAuthorizationDetails(session, res, params, params.client_id)) {
+			return;
+		}
+		if (session && !this.requestClaims(session, res, params, params.client_id)) {
+			return;
+		}
+		const jti = session && params.request ? requestObjectJti(params.request) : undefined;
+		const maxAge = parseMaxAge(params.max_age);
+		if (session && params.client_id !== undefined) {
+			this.nonceRequests.request(session.id, params.client_id, params.nonce);
+		}
+		const redirectUri = session ? this.unregisteredRedirectUri(params) : undefined;
+		if (
+			params.code_challenge === undefined &&
+			jti === undefined &&
+			maxAge === undefined &&
+			params.response_mode === undefined &&
+			redirectUri === undefined
+		) {
+			providerCallback(req, res);
+			return;
+		}
+
+		const replayed = session && jti ? this.requestObjects.use(session.id, jti) : false;
+		let actions: Record<string, unknown> = {};
+		if (session && this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: "GET",
+				timestamp: new Date(),
+			};
+			({ actions } = await this.mischiefEngine.applyToEndpoint(
+				{
+					path: "/auth",
+					params,
+					status: 0,
+					requestObjectReplayed: replayed,
+					...(redirectUri ? { redirectUri } : {}),
+				},
+				requestCtx,
+			));
+		}
+
+		if (session && redirectUri && params.client_id !== undefined) {
+			const accepted = actions.acceptUnregisteredRedirectUri === true;
+			if (accepted) {
+				this.acceptedRedirectUris.accept(params.client_id, redirectUri.requested);
+			}
+			this.eventLog.record(session.id, "redirect-uri-mismatch", {
+				clientId: params.client_id,
+				requested: redirectUri.requested,
+				registered: redirectUri.registered,
+				accepted,
+			});
+		}
+
+		if (session && replayed) {
+			const accepted = actions.acceptRequestObjectReplay === true;
+			this.eventLog.record(session.id, "request-object-replayed", { jti, accepted });
+			if (!accepted) {
+				const message = `request object jti '${jti}' has already been used`;
+				const details = { jti };
+				sendError(
+					res,
+					400,
+					oauthError("invalid_request_object", "request_object_replayed", message, details),
+				);
+				return;
+			}
+		}
+
+		if (params.code_challenge !== undefined) {
+			// An absent method means plain (RFC 7636 Section 4.3)
+			const method = params.code_challenge_method ?? "plain";
+			const allowPlain =
+				this.config.provider.pkceMinimumMethod === "plain" || actions.acceptPlainPkce === true;
+			const accepted = method === "S256" || (method === "plain" && allowPlain);
+			if (session && accepted && (method === "S256" || method === "plain")) {
+				const substitute = this.pkceBindings.bind(session.id, params.code_challenge, method);
+				req.url = withS256Challenge(url, substitute);
+			} else if (method === "plain" && allowPlain) {
+				req.url = upgradePlainChallenge(url) ?? url;
+			}
+			if (session) {
+				this.eventLog.record(session.id, "pkce-challenge", {
+					method,
+					accepted,
+					downgraded: method === "plain" && actions.acceptPlainPkce === true,
+				});
+			}
+		}
+
+		if (maxAge !== undefined) {
+			this.requestMaxAge(req, session, params.client_id, maxAge, actions);
+		}
+
+		if (session && params.response_mode !== undefined) {
+			this.requestResponseMode(req, session, params, actions);
+		}
+
+		providerCallback(req, res);
+	}
+
+	/**
+	 * The requested redirect URI next to the client's registered ones, when
+	 * it isn't one of them
+	 */
+	private unregisteredRedirectUri(params: Record<string, string>): RedirectUriCheck | undefined {
+		const { client_id: clientId, redirect_uri: requested } = params;
+		const client = clientId === undefined ? undefined : this.clients.get(clientId);
+		if (!client || requested === undefined) {
+			return undefined;
+		}
+		const registered = registeredRedirectUris(client);
+		return redirectUriRegistered(registered, requested) ? undefined : { requested, registered };
+	}
+
+	/**
+	 * Respond in the mode mischief picks rather than the one requested, and
+	 * record both
+	 */
+	private requestResponseMode(
+		req: IncomingMessage,
+		session: Session,
+		params: Record<string, string>,
+		actions: Record<string, unknown>,
+	): void {
+		const requested = params.response_mode;
+		let served = requested;
+		if (isResponseMode(actions.responseMode) && actions.responseMode !== requested) {
+			served = actions.responseMode;
+			req.url = withResponseMode(req.url ?? "/auth", actions.responseMode);
+		}
+		this.eventLog.record(session.id, "response-mode-requested", {
+			clientId: params.client_id ?? null,
+			requested,
+			served,
+			downgraded: served !== requested,
+		});
+	}
+
+	/**
+	 * Force re-authentication for `max_age=0` unless mischief ignores it,
+	 * and remember the request so the client's ID token can be checked
+	 */
+	private requestMaxAge(
+		req: IncomingMessage,
+		session: Session | undefined,
+		clientId: string | undefined,
+		maxAge: number,
+		actions: Record<string, unknown>,
+	): void {
+		const url = req.url ?? "/auth";
+		const ignored = maxAge === 0 && actions.ignoreMaxAge === true;
+		if (ignored) {
+			req.url = withoutMaxAge(url);
+		} else if (maxAge === 0) {
+			req.url = requireLogin(url);
+		}
+
+		if (!session || clientId === undefined) {
+			return;
+		}
+		const request: MaxAgeRequest = {
+			maxAge,
+			requestedAt: Math.floor(Date.now() / 1000),
+			reauthForced: maxAge === 0 && !ignored,
+		};
+		if (ignored && typeof actions.staleAuthTimeSeconds === "number") {
+			request.staleSeconds = actions.staleAuthTimeSeconds;
+		}
+		this.maxAgeRequests.request(session.id, clientId, request);
+		this.eventLog.record(session.id, "max-age-requested", {
+			clientId,
+			maxAge,
+			reauthForced: request.reauthForced,
+			ignored,
+		});
+	}
+
+	/**
+	 * Remember the authorization details a pushed authorization request asks for
+	 */
+	private async handlePushedAuthorizationRequest(
+		req: IncomingMessage,
+		res: ServerResponse,
+		session: Session,
+		providerCallback: ReturnType<Provider["callback"]>,
+	): Promise<void> {
+		const body = await readBody(req);
+		const params = parseParams(req.url ?? "/request", body);
+		const clientId = requestClientId(req.headers.authorization, params);
+		if (this.requestAuthorizationDetails(session, res, params, clientId)) {
+			providerCallback(replayRequest(req, body), res);
+		}
+	}
 
-			// All other routes go to OIDC provider directly
-			providerCallback(req, res);
+	/**
+	 * Validate and remember a request's `authorization_details` for its
+	 * client; answers 400 and returns false if they are invalid
+	 */
+	private requestAuthorizationDetails(
+		session: Session,
+		res: ServerResponse,
+		params: Record<string, string>,
+		clientId: string | undefined,
+	): boolean {
+		const value = params.authorization_details;
+		if (value === undefined || clientId === undefined) {
+			return true;
+		}
+		const result = parseAuthorizationDetails(value);
+		if (!result.ok) {
+			const error = "invalid_authorization_details";
+			sendError(res, 400, oauthError(error, "invalid_authorization_details", result.error));
+			return false;
+		}
+		this.authorizationDetails.request(session.id, clientId, result.details);
+		this.eventLog.record(session.id, "authorization-details-requested", {
+			clientId,
+			authorizationDetails: result.details,
 		});
+		return true;
+	}
 
-		const { port, host } = this.config.server;
-		await new Promise<void>((resolve) => {
-			this.server?.listen(port, host, () => resolve());
+	/**
+	 * Validate and remember the claims a client requested (OIDC Core Section
+	 * 5.5); a request without `claims` forgets the client's earlier one.
+	 * Returns false once a malformed one has been answered
+	 */
+	private requestClaims(
+		session: Session,
+		res: ServerResponse,
+		params: Record<string, string>,
+		clientId: string | undefined,
+	): boolean {
+		if (clientId === undefined) {
+			return true;
+		}
+		const value = params.claims;
+		if (value === undefined) {
+			this.claimsRequests.request(session.id, clientId, undefined);
+			return true;
+		}
+		const request = parseClaimsRequest(value);
+		if (typeof request === "string") {
+			sendError(res, 400, oauthError("invalid_request", "invalid_claims_request", request));
+			return false;
+		}
+		this.claimsRequests.request(session.id, clientId, request);
+		this.eventLog.record(session.id, "claims-requested", {
+			clientId,
+			idToken: Object.keys(request.idToken),
+			userinfo: Object.keys(request.userinfo),
 		});
+		return true;
 	}
 
 	/**
-	 * Handle token endpoint with mischief interception
+	 * Render the login page with the requested display mode and UI locale
 	 *
-	 * We intercept by monkey-patching res.write/res.end to capture the response,
-	 * apply mischief, then write the modified response.
+	 * The provider's page is decorated on the way out. Requested vs honoured
+	 * presentation is recorded on the session's event log.
 	 */
-	private handleTokenRequest(
+	private async handleInteractionPage(
 		req: IncomingMessage,
 		res: ServerResponse,
-		session: Session,
+		session: Session | undefined,
 		providerCallback: ReturnType<Provider["callback"]>,
-	): void {
-		const chunks: Buffer[] = [];
-		let statusCode = 200;
-		let headers: Record<string, string | string[] | number | undefined> = {};
+	): Promise<void> {
+		let params: Record<string, unknown>;
+		try {
+			params = (await this.provider?.interactionDetails(req, res))?.params ?? {};
+		} catch {
+			// Unknown or expired interaction; let the provider render its error
+			providerCallback(req, res);
+			return;
+		}
 
-		// Capture the status code
-		const originalWriteHead = res.writeHead.bind(res);
-		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
-		(res as any).writeHead = (code: number, ...args: any[]) => {
-			statusCode = code;
-			// Extract headers if provided
-			if (args.length > 0 && typeof args[args.length - 1] === "object") {
-				headers = args[args.length - 1];
+		const display = typeof params.display === "string" ? params.display : undefined;
+		const uiLocales = typeof params.ui_locales === "string" ? params.ui_locales : undefined;
+
+		let actions: Record<string, unknown> = {};
+		if (session && this.mischiefEngine) {
+			const endpointParams: Record<string, string> = {};
+			if (display !== undefined) {
+				endpointParams.display = display;
 			}
-			// Don't call originalWriteHead yet - we'll do it after mischief
-			return res;
-		};
+			if (uiLocales !== undefined) {
+				endpointParams.ui_locales = uiLocales;
+			}
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: req.url ?? "/interaction",
+				method: "GET",
+				timestamp: new Date(),
+			};
+			({ actions } = await this.mischiefEngine.applyToEndpoint(
+				{ path: "/interaction", params: endpointParams, status: 200 },
+				requestCtx,
+			));
+		}
 
-		// Capture setHeader calls
-		const capturedHeaders: Record<string, string | string[]> = {};
-		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
-		(res as any).setHeader = (name: string, value: any) => {
-			capturedHeaders[name.toLowerCase()] = value;
-			return res;
+		const presentation: InteractionPresentation = {
+			display: actions.ignoreDisplay ? "page" : resolveDisplay(display),
+			locale: actions.ignoreUiLocales ? "en" : resolveLocale(uiLocales),
 		};
+		if (session) {
+			this.eventLog.record(session.id, "interaction-rendered", {
+				requested: { display, uiLocales },
+				honored: presentation,
+			});
+		}
 
-		// Capture writes - don't write yet, just buffer
+		const originalEnd = res.end.bind(res);
 		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
-		(res as any).write = (chunk: any, _encoding?: any, _cb?: any) => {
-			if (chunk) {
-				chunks.push(Buffer.isBuffer(chunk) ? chunk : Buffer.from(String(chunk)));
+		(res as any).end = (chunk?: any, ...rest: any[]) => {
+			res.end = originalEnd;
+			const isHtml = String(res.getHeader("content-type") ?? "").includes("text/html");
+			if (!isHtml || !chunk || typeof chunk === "function" || res.headersSent) {
+				// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+				return (originalEnd as any)(chunk, ...rest);
 			}
-			return true;
+			const html = decorateInteractionPage(String(chunk), presentation);
+			res.setHeader("content-length", Buffer.byteLength(html));
+			// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
+			return (originalEnd as any)(html, ...rest);
 		};
 
-		// Intercept end - this is where we apply mischief and write everything
-		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
-		(res as any).end = (chunk?: any, _encoding?: any, _cb?: any) => {
-			if (chunk && typeof chunk !== "function") {
-				chunks.push(Buffer.isBuffer(chunk) ? chunk : Buffer.from(String(chunk)));
-			}
+		providerCallback(req, res);
+	}
 
-			const body = Buffer.concat(chunks).toString();
+	/**
+	 * Serve /me (and /userinfo): release the claims the access token's scopes
+	 * authorize, and those its client requested for userinfo with `claims`
+	 *
+	 * Endpoint mischief may replace the released claims to over-disclose,
+	 * withhold or tamper with them. Requested scopes and returned claims are
+	 * recorded on the session's event log either way, and a response that
+	 * no longer matches the baseline is recorded in the session's report.
+	 * With `bindToToken`, an access token a session was issued brings its
+	 * session along.
+	 */
+	private async handleUserinfoRequest(
+		req: IncomingMessage,
+		res: ServerResponse,
+		requested: Session | undefined,
+		bindToToken: boolean,
+	): Promise<void> {
+		const url = req.url ?? "/me";
+		const body = req.method === "POST" ? await readBody(req) : Buffer.alloc(0);
+		const params = parseParams(url, body);
+		const authorization = req.headers.authorization;
+		const token = authorization?.startsWith("Bearer ")
+			? authorization.slice("Bearer ".length)
+			: params.access_token;
 
-			// Apply mischief asynchronously then complete the response
-			this.applyMischiefToTokenResponse(body, session, req.url ?? "/token")
-				.then((modifiedBody) => {
-					// Merge headers
-					const finalHeaders = { ...capturedHeaders, ...headers };
-					// Update content-length for modified body
-					finalHeaders["content-length"] = Buffer.byteLength(modifiedBody);
+		const tenant = this.tenantRequests.get(res);
+		const grant = token ? await this.resolveAccessToken(token, tenant) : undefined;
+		if (!grant) {
+			const message = "invalid or expired access token";
+			sendError(res, 401, oauthError("invalid_token", "invalid_access_token", message), {
+				"WWW-Authenticate": 'Bearer error="invalid_token"',
+			});
+			return;
+		}
 
-					// Now actually write the response
-					originalWriteHead(statusCode, finalHeaders);
-					res.end = ServerResponse.prototype.end.bind(res);
-					res.end(modifiedBody);
-				})
-				.catch(() => {
-					// On error, send original body
-					const finalHeaders = { ...capturedHeaders, ...headers };
-					originalWriteHead(statusCode, finalHeaders);
-					res.end = ServerResponse.prototype.end.bind(res);
-					res.end(body);
-				});
-		};
+		let session = requested;
+		const issued = token && bindToToken ? this.issuanceLog.lookup(token) : undefined;
+		if (issued) {
+			this.harRecorder.bind(res, issued.sessionId);
+			const bound = this.sessions.get(issued.sessionId);
+			session = bound && this.matchesCondition(bound, req) ? bound : undefined;
+		}
 
-		providerCallback(req, res);
+		const subjectClaims = accountClaims(grant.sub);
+		const scoped = claimsForScopes(subjectClaims, grant.scopes, this.config.provider.scopeClaims);
+		const requestedClaims =
+			session && grant.clientId !== undefined
+				? this.claimsRequests.get(session.id, grant.clientId)?.userinfo
+				: undefined;
+		const baseline = requestedClaims
+			? withRequestedClaims(scoped, subjectClaims, requestedClaims)
+			: scoped;
+		let claims = baseline;
+
+		if (session && this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: req.method ?? "GET",
+				timestamp: new Date(),
+			};
+			// Userinfo mischief sees one path, whichever the client called
+			const { actions, applications } = await this.mischiefEngine.applyToEndpoint(
+				{
+					path: "/me",
+					params: { scope: grant.scopes.join(" ") },
+					status: 200,
+					response: claims,
+					subjectClaims,
+				},
+				requestCtx,
+			);
+			const replaced = actions.responseBody;
+			if (typeof replaced === "object" && replaced !== null && !Array.isArray(replaced)) {
+				claims = replaced as Record<string, unknown>;
+			}
+			const mutations = applications.map((a) => ({
+				plugin: a.pluginId,
+				mutation: a.result.mutation,
+				evidence: a.result.evidence,
+			}));
+			this.issuanceLog.recordUserinfo(session.id, grant.sub, baseline, claims, mutations);
+
+			this.eventLog.record(session.id, "userinfo-served", {
+				scopes: grant.scopes,
+				claims: Object.keys(claims),
+				...(requestedClaims ? { requestedClaims: claimsDelivery(requestedClaims, claims) } : {}),
+			});
+		}
+
+		res.writeHead(200, { "Content-Type": "application/json", "Cache-Control": "no-store" });
+		res.end(JSON.stringify(claims));
 	}
 
 	/**
-	 * Apply mischief to a token endpoint response
+	 * Look up the subject, scopes and client an access token was granted
+	 *
+	 * JWT access tokens are verified against the keys Loki signs with, or
+	 * the tenant's key and issuer when asked under a tenant, and must be
+	 * access tokens rather than ID tokens; opaque ones are looked up in
+	 * oidc-provider's store.
 	 */
-	private async applyMischiefToTokenResponse(
-		body: string,
-		session: Session,
-		endpoint: string,
-	): Promise<string> {
-		if (!this.mischiefEngine) {
-			return body;
+	private async resolveAccessToken(
+		token: string,
+		tenant?: TenantStatus,
+	): Promise<{ sub: string; scopes: string[]; clientId?: string } | undefined> {
+		if (token.split(".").length === 3) {
+			try {
+				const jwks = tenant
+					? this.keyManager.getTenantJwks(tenant.id)
+					: this.keyManager.getPublishedJwks();
+				if (!tenant) {
+					jwks.keys.push(this.keyManager.primaryKey.publicJwk);
+				}
+				const { payload, protectedHeader } = await jose.jwtVerify(
+					token,
+					jose.createLocalJWKSet(jwks),
+					{ issuer: tenant?.issuer ?? this.issuer },
+				);
+				// An ID token, however valid, doesn't grant access
+				if (typeof payload.sub !== "string" || !isAccessTokenJwt(protectedHeader, payload)) {
+					return undefined;
+				}
+				const scope = typeof payload.scope === "string" ? payload.scope : "";
+				const grant = { sub: payload.sub, scopes: scope.split(" ").filter(Boolean) };
+				return typeof payload.client_id === "string"
+					? { ...grant, clientId: payload.client_id }
+					: grant;
+			} catch {
+				return undefined;
+			}
 		}
 
-		// Try to parse as JSON
-		let response: Record<string, unknown>;
-		try {
-			response = JSON.parse(body);
-		} catch {
-			// Not JSON, return as-is
-			return body;
+		const stored = await this.provider?.AccessToken.find(token);
+		if (!stored?.accountId || stored.isExpired) {
+			return undefined;
 		}
+		const scopes = (stored.scope ?? "").split(" ").filter(Boolean);
+		const grant = { sub: stored.accountId, scopes };
+		return stored.clientId ? { ...grant, clientId: stored.clientId } : grant;
+	}
 
-		// Check if this is a token response
-		const accessToken = response.access_token as string | undefined;
-		const idToken = response.id_token as string | undefined;
+	/**
+	 * Record a revocation, letting endpoint mischief delay or omit its
+	 * listing, or ignore it altogether
+	 *
+	 * Sessions get the revocation in their report and a `token-revoked`
+	 * event.
+	 */
+	private async recordRevocation(
+		url: string,
+		params: Record<string, string>,
+		status: number,
+		session: Session | undefined,
+		clientId: string | undefined,
+	): Promise<void> {
+		const token = params.token;
+		if (status !== 200 || !token || !this.revocationList) {
+			return;
+		}
 
-		if (!accessToken && !idToken) {
-			// Not a token response
-			return body;
+		let listAfterSeconds: number | null = 0;
+		let ignored = false;
+		let mutations: TokenMutation[] = [];
+		if (session && this.mischiefEngine) {
+			const requestCtx: RequestContext = {
+				requestId: currentRequestId(),
+				session,
+				endpoint: url,
+				method: "POST",
+				timestamp: new Date(),
+			};
+			const { actions, applications } = await this.mischiefEngine.applyToEndpoint(
+				{ path: url.split("?")[0] ?? url, params, status },
+				requestCtx,
+			);
+			if ("revocationListAfterSeconds" in actions) {
+				listAfterSeconds = actions.revocationListAfterSeconds as number | null;
+			}
+			ignored = actions.revocationIgnored === true;
+			mutations = applications.map((a) => ({
+				plugin: a.pluginId,
+				mutation: a.result.mutation,
+				evidence: a.result.evidence,
+			}));
 		}
 
-		const requestCtx: RequestContext = {
-			requestId: `req_${nanoid(8)}`,
-			session,
-			endpoint,
-			method: "POST",
-			timestamp: new Date(),
-		};
+		const jti = tokenIdentifier(token);
+		if (!ignored) {
+			this.revocationList.revoke(jti, session?.id, listAfterSeconds);
+		}
+		if (session) {
+			const tokenType = this.issuanceLog.lookup(token)?.tokenType ?? null;
+			this.issuanceLog.recordRevocation(session.id, {
+				jti,
+				tokenType,
+				clientId: clientId ?? null,
+				ignored,
+				mutations,
+			});
+			this.eventLog.record(session.id, "token-revoked", {
+				clientId: clientId ?? null,
+				jti,
+				known: tokenType !== null,
+				ignored,
+			});
+			this.liveEvents.publish({
+				type: "token.revoked",
+				sessionId: session.id,
+				requestId: currentRequestId(),
+				tokenType,
+				jti,
+				mischief: mutations.map((m) => m.plugin),
+				fingerprint: tokenFingerprint(token),
+				details: { clientId: clientId ?? null, ignored },
+			});
+		}
+	}
 
-		// Apply mischief to access_token if present and looks like JWT
-		if (accessToken?.includes(".")) {
-			const result = await this.mischiefEngine.applyToToken(accessToken, requestCtx);
-			if (result.applications.length > 0) {
-				response.access_token = result.token;
-			}
+	/**
+	 * Count a token request against the session's warm-up period
+	 *
+	 * Returns true while the request should still be served clean. The
+	 * remaining count is exposed in X-Loki-Warmup-Remaining, and the first
+	 * request after the warm-up records a transition event.
+	 */
+	private consumeWarmup(session: Session, extraHeaders: Record<string, string>): boolean {
+		const warmup = session.warmupRequests ?? 0;
+		if (warmup <= 0) {
+			return false;
 		}
 
-		// Apply mischief to id_token if present
-		if (idToken?.includes(".")) {
-			const result = await this.mischiefEngine.applyToToken(idToken, requestCtx);
-			if (result.applications.length > 0) {
-				response.id_token = result.token;
-			}
+		// Counting stops once the warm-up has ended
+		if ((session.tokenRequests ?? 0) > warmup) {
+			extraHeaders["x-loki-warmup-remaining"] = "0";
+			return false;
+		}
+
+		session.tokenRequests = (session.tokenRequests ?? 0) + 1;
+		if (this.database) {
+			this.database.saveSession(session);
 		}
 
-		// Apply response-phase mischief (like latency injection)
-		await this.mischiefEngine.applyToResponse(requestCtx);
+		const remaining = Math.max(0, warmup - session.tokenRequests);
+		extraHeaders["x-loki-warmup-remaining"] = String(remaining);
 
-		return JSON.stringify(response);
+		if (session.tokenRequests <= warmup) {
+			return true;
+		}
+
+		this.eventLog.record(session.id, "warmup-complete", {
+			warmupRequests: warmup,
+			firstMischiefRequest: session.tokenRequests,
+		});
+		return false;
 	}
 
 	/**
@@ -321,16 +4224,33 @@ export class Loki {
 	private handleDiscoveryRequest(
 		req: IncomingMessage,
 		res: ServerResponse,
-		session: Session,
+		session: Session | undefined,
 		providerCallback: ReturnType<Provider["callback"]>,
 		endpointType: "discovery" | "jwks",
 	): void {
 		const chunks: Buffer[] = [];
 		let statusCode = 200;
 		let headers: Record<string, string | string[] | number | undefined> = {};
+		const fetch =
+			endpointType === "jwks"
+				? jwksFetch(req.headers, this.config.provider.jwksBearerToken)
+				: undefined;
+		const clientId = fetch ? this.jwksClientId(req) : undefined;
+		if (fetch && clientId !== undefined) {
+			fetch.clientId = clientId;
+		}
+		const endpoint = req.url ?? "/";
+		const document =
+			endpointType === "discovery" ? metadataDocumentAt(endpoint.split("?")[0] ?? "") : undefined;
+		if (document === "oauth-authorization-server") {
+			// oidc-provider only serves the OpenID document; both are rendered from its metadata
+			req.url = endpoint.replace(METADATA_PATHS[document], METADATA_PATHS["openid-configuration"]);
+		}
 
 		// Capture the status code
 		const originalWriteHead = res.writeHead.bind(res);
+		const originalWrite = res.write.bind(res);
+		const originalEnd = res.end.bind(res);
 		// biome-ignore lint/suspicious/noExplicitAny: complex overloaded function
 		(res as any).writeHead = (code: number, ...args: any[]) => {
 			statusCode = code;
@@ -366,35 +4286,156 @@ export class Loki {
 
 			const body = Buffer.concat(chunks).toString();
 
-			// Apply mischief asynchronously
-			this.applyMischiefToDiscoveryResponse(body, session, req.url ?? "/", endpointType)
-				.then((modifiedBody) => {
-					const finalHeaders = { ...capturedHeaders, ...headers };
-					finalHeaders["content-length"] = Buffer.byteLength(modifiedBody);
+			const send = (served: string) => {
+				res.end = originalEnd;
 
+				// A gated JWKS only reaches unauthenticated fetches as decoys
+				if (fetch && refusesJwksFetch(fetch)) {
+					const { status, headers: refusal, body: error } = JWKS_UNAUTHORIZED;
+					originalWriteHead(status, { ...refusal, "content-length": Buffer.byteLength(error) });
+					res.end(error);
+					if (session) {
+						this.recordJwksFetch(session, req, fetch, status, undefined);
+					}
+					return;
+				}
+
+				const finalHeaders = { ...capturedHeaders, ...headers };
+				finalHeaders["content-length"] = Buffer.byteLength(served);
+				// A session's JWKS may be served with the Cache-Control mischief set
+				const cacheControl = session && fetch && this.transientKeys.cacheControl(session.id);
+				if (cacheControl) {
+					setHeaderValue(finalHeaders, "cache-control", cacheControl);
+				}
+
+				if (fetch?.encoding && fetch.encoding !== "identity") {
+					res.writeHead = originalWriteHead;
+					res.write = originalWrite;
+					this.writeEncodedJwks(req, res, statusCode, finalHeaders, served, fetch.encoding);
+				} else {
 					originalWriteHead(statusCode, finalHeaders);
-					res.end = ServerResponse.prototype.end.bind(res);
-					res.end(modifiedBody);
-				})
-				.catch(() => {
-					const finalHeaders = { ...capturedHeaders, ...headers };
-					originalWriteHead(statusCode, finalHeaders);
-					res.end = ServerResponse.prototype.end.bind(res);
-					res.end(body);
-				});
+					res.end(served);
+				}
+				const recorded =
+					fetch?.authRequired || fetch?.keySet === "decoy" || this.keyManager.restrictsJwks;
+				if (session && fetch && recorded) {
+					this.recordJwksFetch(session, req, fetch, statusCode, served);
+				}
+			};
+
+			// Apply mischief asynchronously; on error, send the original body
+			const serving: DiscoveryServed = {};
+			if (fetch) {
+				serving.jwksFetch = fetch;
+			}
+			if (document) {
+				serving.metadataDocument = document;
+			}
+			const tenant = this.tenantRequests.get(res);
+			this.applyMischiefToDiscoveryResponse(body, session, endpoint, endpointType, serving, tenant)
+				.then(send, () => send(body));
 		};
 
 		providerCallback(req, res);
 	}
 
+	/**
+	 * Send a JWKS gzip-encoded (when the fetch accepts gzip), chunked, or both
+	 *
+	 * A chunked JWKS has no Content-Length and is written in several pieces,
+	 * so Node frames it with `Transfer-Encoding: chunked`.
+	 */
+	private writeEncodedJwks(
+		req: IncomingMessage,
+		res: ServerResponse,
+		status: number,
+		headers: Record<string, string | string[] | number | undefined>,
+		served: string,
+		encoding: JwksEncoding,
+	): void {
+		let payload = Buffer.from(served);
+		if (encoding !== "chunked" && acceptsGzip(req.headers["accept-encoding"])) {
+			payload = gzipSync(payload);
+			setHeaderValue(headers, "content-encoding", "gzip");
+			setHeaderValue(headers, "vary", "Accept-Encoding");
+		}
+		if (encoding === "gzip") {
+			headers["content-length"] = payload.length;
+			res.writeHead(status, headers);
+			res.end(payload);
+			return;
+		}
+
+		delete headers["content-length"];
+		res.writeHead(status, headers);
+		for (let offset = 0; offset < payload.length; offset += JWKS_CHUNK_BYTES) {
+			res.write(payload.subarray(offset, offset + JWKS_CHUNK_BYTES));
+		}
+		res.end();
+	}
+
+	/**
+	 * The client a JWKS fetch is made for: the one its Basic credentials
+	 * authenticate as, or the one its `client_id` query parameter names
+	 */
+	private jwksClientId(req: IncomingMessage): string | undefined {
+		const params = parseParams(req.url ?? "/jwks", Buffer.alloc(0));
+		const clientId = requestClientId(req.headers.authorization, params);
+		if (clientId === undefined || !req.headers.authorization?.toLowerCase().startsWith("basic ")) {
+			return clientId;
+		}
+		const client = this.clients.get(clientId);
+		return client && authenticatesWithSecret(client, req.headers, params) ? clientId : undefined;
+	}
+
+	/**
+	 * Record a session's JWKS fetch: who fetched it and which key set (and kids) they got
+	 *
+	 * Only fetches of a gated JWKS, that got decoys, or while keys are
+	 * visible to some clients only are recorded.
+	 */
+	private recordJwksFetch(
+		session: Session,
+		req: IncomingMessage,
+		fetch: JwksFetch,
+		status: number,
+		served: string | undefined,
+	): void {
+		let kids: unknown[] = [];
+		try {
+			const jwks = served === undefined ? undefined : JSON.parse(served);
+			if (Array.isArray(jwks?.keys)) {
+				kids = jwks.keys.map((key: { kid?: unknown }) => key.kid ?? null);
+			}
+		} catch {
+			// Not JSON (e.g. an error page); no keys were served
+		}
+		this.eventLog.record(session.id, "jwks-served", {
+			sourceAddress:
+				resolveSourceAddress(
+					req.socket.remoteAddress,
+					req.headers["x-forwarded-for"],
+					this.trustedProxies,
+				) ?? null,
+			authenticated: fetch.authenticated,
+			authRequired: fetch.authRequired,
+			clientId: fetch.clientId ?? null,
+			keySet: status === 200 ? fetch.keySet : null,
+			status,
+			kids,
+		});
+	}
+
 	/**
 	 * Apply mischief to a discovery/JWKS endpoint response
 	 */
 	private async applyMischiefToDiscoveryResponse(
 		body: string,
-		session: Session,
+		session: Session | undefined,
 		endpoint: string,
-		_endpointType: "discovery" | "jwks",
+		endpointType: "discovery" | "jwks",
+		served: DiscoveryServed = {},
+		tenant?: TenantStatus,
 	): Promise<string> {
 		if (!this.mischiefEngine) {
 			return body;
@@ -408,8 +4449,75 @@ export class Loki {
 			return body;
 		}
 
+		// Publish the rollover plan's keys (including overlap-window neighbours) or the key
+		// set, and every registered key the fetching client may see; a tenant publishes its
+		// own key only
+		const rollover =
+			endpointType === "jwks" && (tenant !== undefined || this.keyManager.overridesJwks);
+		if (rollover) {
+			response = tenant
+				? this.keyManager.getTenantJwks(tenant.id)
+				: this.keyManager.getClientJwks(served.jwksFetch?.clientId);
+		}
+
+		// A tenant's metadata names the tenant's issuer, and every endpoint under it
+		const reissued =
+			endpointType === "discovery" &&
+			tenant !== undefined &&
+			typeof response === "object" &&
+			response !== null;
+		if (reissued) {
+			response = tenantMetadata(response as Record<string, unknown>, this.issuer, tenant.issuer);
+		}
+
+		// Leave disabled endpoints out of the discovery document
+		const trimmed =
+			endpointType === "discovery" &&
+			this.disabledEndpoints.size > 0 &&
+			typeof response === "object" &&
+			response !== null;
+		if (trimmed) {
+			response = withoutDisabledEndpoints(
+				response as Record<string, unknown>,
+				this.disabledEndpoints,
+			);
+		}
+
+		// Render the document asked for from the provider's metadata
+		const document = served.metadataDocument;
+		const rendered =
+			document === "oauth-authorization-server" &&
+			typeof response === "object" &&
+			response !== null;
+		if (rendered) {
+			response = renderMetadata(response as ProviderMetadata, document);
+		}
+		const rewritten = rollover || reissued || trimmed || rendered;
+
+		if (!session) {
+			return rewritten ? JSON.stringify(response) : body;
+		}
+
+		// Publish the session's transient keys while their windows are open
+		const transient = endpointType === "jwks" ? this.transientKeys.serve(session.id) : [];
+		const keys = (response as { keys?: unknown } | null)?.keys;
+		const extended = transient.length > 0 && Array.isArray(keys);
+		if (extended) {
+			response = { ...(response as object), keys: [...keys, ...transient] };
+		}
+
+		// Discovery fetched with loki_session leads to a JWKS fetched with it too
+		const jwksUri = (response as { jwks_uri?: unknown } | null)?.jwks_uri;
+		const named =
+			endpointType === "discovery" &&
+			querySessionId(endpoint) === session.id &&
+			typeof jwksUri === "string";
+		if (named) {
+			response = { ...(response as object), jwks_uri: withSessionQuery(jwksUri, session.id) };
+		}
+
 		const requestCtx: RequestContext = {
-			requestId: `req_${nanoid(8)}`,
+			requestId: currentRequestId(),
 			session,
 			endpoint,
 			method: "GET",
@@ -417,9 +4525,9 @@ export class Loki {
 		};
 
 		// Apply discovery-phase mischief
-		const result = await this.mischiefEngine.applyToDiscovery(response, requestCtx);
+		const result = await this.mischiefEngine.applyToDiscovery(response, requestCtx, served);
 
-		if (result.applications.length > 0) {
+		if (result.applications.length > 0 || rewritten || extended || named) {
 			return JSON.stringify(result.body);
 		}
 
@@ -427,38 +4535,38 @@ export class Loki {
 	}
 
 	/**
-	 * Get the public key PEM from the JWKS endpoint
+	 * Get the public key PEM of the currently active signing key
 	 *
-	 * Follows RFC 7517 (JSON Web Key) for JWK parsing and
-	 * exports to SPKI format per RFC 5280.
+	 * This is the same key clients find in the JWKS, exported to SPKI
+	 * format per RFC 5280.
 	 */
 	private async getPublicKeyPem(): Promise<string> {
-		if (this.jwksCache) {
-			return this.jwksCache;
-		}
-
-		// Fetch from our own JWKS endpoint (RFC 7517 Section 5)
 		try {
-			const response = await fetch(`${this.issuer}/jwks`);
-			const jwks = (await response.json()) as jose.JSONWebKeySet;
-
-			// Get the first signing key
-			const jwk = jwks.keys.find((k) => k.use === "sig" || !k.use);
-			if (!jwk) {
-				return "";
-			}
-
-			// Import JWK and export to SPKI PEM format (RFC 7517 -> RFC 5280)
-			const keyLike = await jose.importJWK(jwk, jwk.alg);
-			const spkiPem = await jose.exportSPKI(keyLike as jose.KeyLike);
-
-			this.jwksCache = spkiPem;
-			return this.jwksCache;
+			return await jose.exportSPKI(this.keyManager.getActiveKey().publicKey);
 		} catch {
-			// Failed to fetch or parse JWKS
+			return "";
 		}
+	}
 
-		return "";
+	/**
+	 * Render /metrics in the Prometheus text exposition format
+	 */
+	private renderMetrics(): string {
+		const { inFlight, maxInFlight, rejected } = this.concurrencyLimiter.getStatus();
+		const activeSessions = [...this.sessions.values()].filter((s) => !s.endedAt).length;
+		return [
+			"# HELP loki_in_flight_requests Requests currently being served",
+			"# TYPE loki_in_flight_requests gauge",
+			`loki_in_flight_requests ${inFlight}`,
+			"# HELP loki_max_in_flight_requests In-flight request limit (0 = unlimited)",
+			"# TYPE loki_max_in_flight_requests gauge",
+			`loki_max_in_flight_requests ${maxInFlight}`,
+			"# HELP loki_rejected_requests_total Requests turned away with 503 at the limit",
+			"# TYPE loki_rejected_requests_total counter",
+			`loki_rejected_requests_total ${rejected}`,
+			...this.metrics.render(activeSessions),
+			"",
+		].join("\n");
 	}
 
 	/**
@@ -473,8 +4581,7 @@ export class Loki {
 		url: string,
 	): Promise<void> {
 		if (!this.adminApi) {
-			res.writeHead(500, { "Content-Type": "application/json" });
-			res.end(JSON.stringify({ error: "Admin API not initialized" }));
+			sendError(res, 500, lokiError("internal_error", "Admin API not initialized"));
 			return;
 		}
 
@@ -500,28 +4607,52 @@ export class Loki {
 		// Route through Hono
 		const webResponse = await this.adminApi.fetch(webRequest);
 
-		// Write response
+		// Write response, streaming the body so slow readers hold Hono back
 		res.writeHead(webResponse.status, Object.fromEntries(webResponse.headers.entries()));
-		const responseBody = await webResponse.text();
-		res.end(responseBody);
+		if (!webResponse.body) {
+			res.end();
+			return;
+		}
+		await pipeline(Readable.fromWeb(webResponse.body), res).catch(() => {
+			// The client went away mid-stream; the pipeline has already cancelled the body
+		});
 	}
 
 	/**
 	 * Stop the Loki server
 	 */
 	async stop(): Promise<void> {
-		if (!this.server) {
+		const server = this.server;
+		if (!server) {
 			return;
 		}
+		if (this.expirySweep) {
+			clearInterval(this.expirySweep);
+			this.expirySweep = null;
+		}
 
+		// Stop accepting connections and let requests in flight finish; any
+		// still running after the shutdown timeout have their connections closed
+		this.draining = true;
+		for (const release of this.heldResponses) {
+			release();
+		}
+		this.liveEvents.closeAll();
+		const { shutdownTimeoutMs = 10_000 } = this.config.server;
 		await new Promise<void>((resolve, reject) => {
-			this.server?.close((err) => {
+			const deadline = setTimeout(() => server.closeAllConnections(), shutdownTimeoutMs);
+			server.close((err) => {
+				clearTimeout(deadline);
 				if (err) reject(err);
 				else resolve();
 			});
+			server.closeIdleConnections();
 		});
+		this.draining = false;
 
 		this.server = null;
+		this.handler = null;
+		this.keysReady = false;
 
 		// Close database connection
 		if (this.database) {
@@ -541,7 +4672,8 @@ export class Loki {
 	 * Get the server address
 	 */
 	get address(): string {
-		return `http://${this.config.server.host}:${this.config.server.port}`;
+		const scheme = this.config.server.tls ? "https" : "http";
+		return `${scheme}://${this.config.server.host}:${this.config.server.port}`;
 	}
 
 	/**
@@ -549,31 +4681,176 @@ export class Loki {
 	 */
 	createSession(config?: Partial<SessionConfig>): SessionHandle {
 		const session: Session = {
-			id: `sess_${nanoid(12)}`,
-			mode: config?.mode ?? "explicit",
-			mischief: config?.mischief ?? [],
+			id: `sess_${randomId(12)}`,
+			mode: "explicit",
+			mischief: [],
 			startedAt: new Date(),
 		};
+		this.configureSession(session, config ?? {});
+
+		this.sessions.set(session.id, session);
+		this.evictedSessions.forget(session.id);
+
+		// Persist to database
+		if (this.database) {
+			this.database.saveSession(session);
+		}
+
+		return new SessionHandle(session, this);
+	}
+
+	/**
+	 * Set a session's declared settings, clearing any the config leaves out
+	 */
+	private configureSession(session: Session, config: Partial<SessionConfig>): void {
+		// Throws on an invalid CIDR before the session is touched
+		if (config.when !== undefined) {
+			conditionCidrs(config.when);
+		}
+
+		session.mode = config.mode ?? "explicit";
+		session.mischief =
+			config.mode === "probabilistic"
+				? Object.keys(config.probabilities ?? {})
+				: (config.mischief ?? []);
+		delete session.name;
+		delete session.probability;
+		delete session.probabilities;
+		delete session.seed;
+		delete session.randomState;
+		delete session.pluginConfig;
+		delete session.targets;
+		delete session.ttl;
+		delete session.when;
+		delete session.warmupRequests;
+		delete session.keyId;
+		delete session.webhook;
+		delete session.maxTokensPerSecond;
+		delete session.sdJwt;
+		delete session.audFormat;
+		delete session.tokenLifetime;
+		delete session.tokenRequests;
+		delete session.shuffleQueue;
 
 		// Only set optional properties if they have values
-		if (config?.name !== undefined) {
+		if (config.name !== undefined) {
 			session.name = config.name;
 		}
-		if (config?.probability !== undefined) {
+		if (config.probability !== undefined) {
 			session.probability = config.probability;
 		}
-		if (config?.mode === "shuffled") {
+		if (config.pluginConfig !== undefined) {
+			session.pluginConfig = config.pluginConfig;
+		}
+		if (config.targets !== undefined) {
+			session.targets = config.targets;
+		}
+		if (config.ttl !== undefined) {
+			session.ttl = config.ttl;
+		}
+		if (config.when !== undefined) {
+			session.when = config.when;
+		}
+		if (config.keyId !== undefined) {
+			session.keyId = config.keyId;
+		}
+		if (config.webhook !== undefined) {
+			session.webhook = config.webhook;
+		}
+		if (config.maxTokensPerSecond !== undefined) {
+			session.maxTokensPerSecond = config.maxTokensPerSecond;
+		}
+		if (config.sdJwt !== undefined) {
+			session.sdJwt = config.sdJwt;
+		}
+		if (config.audFormat !== undefined) {
+			session.audFormat = config.audFormat;
+		}
+		if (config.tokenLifetime !== undefined) {
+			session.tokenLifetime = config.tokenLifetime;
+		}
+		if (config.warmupRequests !== undefined && config.warmupRequests > 0) {
+			session.warmupRequests = config.warmupRequests;
+			session.tokenRequests = 0;
+		}
+		if (config.mode === "shuffled") {
 			session.shuffleQueue = this.shuffleArray([...(config.mischief ?? [])]);
 		}
+		if (config.mode === "probabilistic") {
+			session.probabilities = { ...config.probabilities };
+			session.seed = config.seed ?? randomSeed();
+		}
+	}
 
-		this.sessions.set(session.id, session);
+	/**
+	 * Work out what applying a topology document would change, without changing anything
+	 */
+	planTopology(document: unknown): TopologyPlanResult {
+		const parsed = this.parseTopology(document);
+		if (!parsed.ok) {
+			return parsed;
+		}
+		return diffTopology(this.listSessions(), parsed.sessions);
+	}
 
-		// Persist to database
-		if (this.database) {
-			this.database.saveSession(session);
+	/**
+	 * Reconcile declared sessions to a topology document
+	 *
+	 * The whole document is validated first; if anything is invalid nothing
+	 * is applied. Updated sessions keep their id, ledger and events.
+	 */
+	applyTopology(document: unknown): TopologyPlanResult {
+		const parsed = this.parseTopology(document);
+		if (!parsed.ok) {
+			return parsed;
+		}
+		const result = diffTopology(this.listSessions(), parsed.sessions);
+		if (!result.ok) {
+			return result;
 		}
 
-		return new SessionHandle(session, this);
+		const { plan } = result;
+		const declared = new Map(parsed.sessions.map((session) => [session.id, session.config]));
+		for (const id of plan.created) {
+			const session: Session = {
+				id,
+				mode: "explicit",
+				mischief: [],
+				startedAt: new Date(),
+				declared: true,
+			};
+			this.configureSession(session, declared.get(id) ?? {});
+			this.sessions.set(id, session);
+			this.evictedSessions.forget(id);
+			if (this.database) {
+				this.database.saveSession(session);
+			}
+		}
+		for (const { id } of plan.updated) {
+			const session = this.sessions.get(id);
+			if (session) {
+				this.configureSession(session, declared.get(id) ?? {});
+				if (this.database) {
+					this.database.saveSession(session);
+				}
+			}
+		}
+		for (const id of plan.deleted) {
+			this.deleteSession(id);
+		}
+		return result;
+	}
+
+	/**
+	 * Export declared sessions as a topology document (a shareable session bundle)
+	 */
+	exportTopology(): TopologyDocument {
+		return exportTopology(this.listSessions(), this.pluginRegistry);
+	}
+
+	private parseTopology(document: unknown): TopologyParseResult {
+		const sessionsConfig = this.config.sessions as Required<SessionsConfig>;
+		return parseTopology(document, sessionsConfig, this.pluginRegistry);
 	}
 
 	/**
@@ -598,17 +4875,304 @@ export class Loki {
 		}
 	}
 
+	/**
+	 * Freeze a session: capture its next token response and replay it from then on
+	 *
+	 * Re-freezing discards any previously captured response.
+	 */
+	freezeSession(id: string, options: { keepFresh?: boolean } = {}): SessionFreeze | undefined {
+		const session = this.sessions.get(id);
+		if (!session) {
+			return undefined;
+		}
+		session.freeze = {
+			keepFresh: options.keepFresh ?? false,
+			requestedAt: new Date().toISOString(),
+		};
+		if (this.database) {
+			this.database.saveSession(session);
+		}
+		return session.freeze;
+	}
+
+	/**
+	 * Unfreeze a session so it produces fresh tokens again
+	 *
+	 * Returns false if the session doesn't exist or wasn't frozen.
+	 */
+	unfreezeSession(id: string): boolean {
+		const session = this.sessions.get(id);
+		if (!session?.freeze) {
+			return false;
+		}
+		delete session.freeze;
+		if (this.database) {
+			this.database.saveSession(session);
+		}
+		return true;
+	}
+
+	/**
+	 * Get the event timeline for a session; only events after the `since`
+	 * cursor (an event's `seq`) if given
+	 */
+	getSessionEvents(id: string, since?: number): SessionEvent[] {
+		return this.eventLog.list(id, since);
+	}
+
+	/**
+	 * Watch a session's token issuances, introspections and revocations as
+	 * they happen; close the subscription when done
+	 */
+	watchSessionEvents(id: string): LiveSubscription {
+		return this.liveEvents.subscribe(id);
+	}
+
+	/**
+	 * The mischief, events and tokens one request produced; undefined if
+	 * Loki recorded nothing under that request ID
+	 */
+	getRequestTrace(requestId: string): RequestTrace | undefined {
+		const ledger: RequestTrace["ledger"] = [];
+		for (const sessionId of this.sessions.keys()) {
+			for (const entry of this.mischiefEngine?.getLedgerEntries(sessionId) ?? []) {
+				if (entry.requestId === requestId) {
+					ledger.push({ sessionId, ...entry });
+				}
+			}
+		}
+		const events = this.eventLog.findByRequest(requestId);
+		const tokens = this.tokenResults.findByRequest(requestId);
+		if (ledger.length === 0 && events.length === 0 && tokens.length === 0) {
+			return undefined;
+		}
+		return { requestId, ledger, events, tokens };
+	}
+
+	/**
+	 * The last token response a session sent, exactly as sent; undefined if
+	 * it hasn't issued one
+	 */
+	getLastTokenResponse(id: string): string | undefined {
+		return this.lastTokenResponses.get(id);
+	}
+
+	/**
+	 * Get a session's refresh token rotations and detected reuses
+	 */
+	getRefreshLedger(id: string): RefreshLedgerReport {
+		return this.refreshLedger.getReport(id);
+	}
+
+	/**
+	 * Record the client's verdict on a token the session issued; false if
+	 * the session never issued that jti
+	 */
+	reportTokenOutcome(id: string, report: OutcomeReport): boolean {
+		const token = this.tokenResults.report(id, report);
+		if (!token) {
+			return false;
+		}
+		this.eventLog.record(id, "token-reported", {
+			jti: report.jti,
+			tokenType: token.tokenType,
+			mischief: token.mischief,
+			accepted: report.accepted,
+		});
+		return true;
+	}
+
+	/**
+	 * The private keys that sign a session's tokens right now; undefined if
+	 * the session doesn't exist. Each export is recorded as an event.
+	 */
+	async exportSigningKeys(id: string): Promise<ExportedSigningKey[] | undefined> {
+		const session = this.sessions.get(id);
+		if (!session) {
+			return undefined;
+		}
+		const keys = await this.keyManager.exportSigningKeys(session.keyId);
+		this.eventLog.record(id, "signing-keys-exported", { kids: keys.map((key) => key.kid) });
+		return keys;
+	}
+
+	/**
+	 * Which attack the attack-of-the-day session is running, and its rotation
+	 * history; undefined unless it is enabled
+	 */
+	getAttackOfTheDay(): AttackRotationStatus | undefined {
+		return this.attackRotation?.getStatus();
+	}
+
+	/**
+	 * Chaos mode's rate, the plugins it draws from and what it has drawn;
+	 * undefined unless it is enabled
+	 */
+	getChaos(): ChaosStatus | undefined {
+		return this.chaos?.getStatus();
+	}
+
+	/**
+	 * Get a session's per-mischief pass rates from the reported verdicts
+	 */
+	getSessionResults(id: string): SessionResults {
+		return this.tokenResults.getResults(id);
+	}
+
+	/**
+	 * Loki's own signing keys: the primary key, every published one and every tenant's
+	 */
+	private lokiSigningKeys(): CandidateKey[] {
+		const keys = [this.keyManager.primaryKey.publicJwk, ...this.keyManager.getPublishedJwks().keys];
+		for (const tenant of this.tenants.list()) {
+			keys.push(...this.keyManager.getTenantJwks(tenant.id).keys);
+		}
+		return keys.map((jwk) => ({ jwk, source: "loki" }));
+	}
+
+	/**
+	 * Get what mischief did to each token a session issued; undefined if
+	 * the session doesn't exist
+	 */
+	getSessionReport(id: string): SessionReport | undefined {
+		const session = this.sessions.get(id);
+		if (!session) {
+			return undefined;
+		}
+		const report = this.issuanceLog.getReport(id, session.mode);
+		const transientKeys = this.transientKeys.report(id);
+		return transientKeys.length > 0 ? { ...report, transientKeys } : report;
+	}
+
+	/**
+	 * Get a session's issuance counters; undefined if the session doesn't exist
+	 */
+	getSessionStats(id: string): SessionStats | undefined {
+		const session = this.sessions.get(id);
+		if (!session) {
+			return undefined;
+		}
+		const stats = this.sessionStats.stats(id);
+		if (session.maxTokensPerSecond !== undefined) {
+			stats.maxTokensPerSecond = session.maxTokensPerSecond;
+		}
+		return stats;
+	}
+
+	/**
+	 * Get a session's recorded HTTP exchanges as HAR; undefined if the session doesn't exist
+	 */
+	getSessionHar(id: string): Har | undefined {
+		return this.sessions.has(id) ? this.harRecorder.har(id) : undefined;
+	}
+
+	/**
+	 * Serve a session's rogue JWKS, recording the fetch: the client followed a jku header
+	 */
+	private fetchRogueJwks(sessionId: string): { keys: unknown[] } | undefined {
+		const jwks = this.rogueJwks?.jwks(sessionId);
+		if (jwks && this.sessions.has(sessionId)) {
+			this.eventLog.record(sessionId, "rogue-jwks-fetched", {
+				kids: jwks.keys.map((key) => key.kid),
+			});
+		}
+		return jwks;
+	}
+
+	/**
+	 * Serve a session's rogue certificate chain, recording the fetch: the client followed x5u
+	 */
+	private fetchRogueX5u(sessionId: string): string | undefined {
+		const chain = this.rogueJwks?.chain(sessionId);
+		if (chain !== undefined && this.sessions.has(sessionId)) {
+			this.eventLog.record(sessionId, "rogue-x5u-fetched", {
+				x5tS256: certificateThumbprints(chain),
+			});
+		}
+		return chain;
+	}
+
+	/**
+	 * Evict every session past its ttl
+	 */
+	private evictExpiredSessions(): void {
+		for (const session of [...this.sessions.values()]) {
+			this.evictIfExpired(session);
+		}
+	}
+
+	/**
+	 * When a session was evicted by its ttl, evicting it first if it has
+	 * just expired; undefined for sessions that weren't
+	 */
+	private sessionEvictedAt(id: string): Date | undefined {
+		const session = this.sessions.get(id);
+		if (session) {
+			this.evictIfExpired(session);
+		}
+		return this.evictedSessions.evictedAt(id);
+	}
+
+	/**
+	 * Evict a session, and all that was recorded for it, if it's past its
+	 * ttl. Declared sessions, the attack of the day and the chaos session
+	 * stand until removed unless they set a ttl of their own.
+	 */
+	private evictIfExpired(session: Session): void {
+		const standing =
+			session.declared ||
+			session.id === this.attackRotation?.sessionId ||
+			session.id === this.chaos?.sessionId;
+		const ttl = session.ttl ?? (standing ? undefined : this.config.sessions.ttl);
+		const expiry = expiresAt(session, ttl);
+		if (expiry === undefined || expiry > Date.now()) {
+			return;
+		}
+		this.deleteSession(session.id);
+		this.evictedSessions.remember(session.id);
+		this.metrics.countEviction();
+		this.logger.info("session evicted", { sessionId: session.id, ttl });
+	}
+
 	/**
 	 * Delete a session
 	 */
 	deleteSession(id: string): boolean {
-		const deleted = this.sessions.delete(id);
+		const deleted = this.forgetSession(id);
 		if (deleted && this.database) {
 			this.database.deleteSession(id);
 		}
 		return deleted;
 	}
 
+	/**
+	 * Drop everything this replica holds for a session, leaving the store alone
+	 */
+	private forgetSession(id: string): boolean {
+		const deleted = this.sessions.delete(id);
+		this.mischiefEngine?.forgetSession(id);
+		this.eventLog.clear(id);
+		this.liveEvents.clear(id);
+		this.claimSources?.clear(id);
+		this.rogueJwks?.clear(id);
+		this.requestObjects.clear(id);
+		this.refreshLedger.clear(id);
+		this.pkceBindings.clear(id);
+		this.tokenResults.clear(id);
+		this.issuanceLog.clear(id);
+		this.sessionStats.clear(id);
+		this.harRecorder.clear(id);
+		this.authorizationDetails.clear(id);
+		this.maxAgeRequests.clear(id);
+		this.nonceRequests.clear(id);
+		this.claimsRequests.clear(id);
+		this.scopeRequests.clear(id);
+		this.resourceRequests.clear(id);
+		this.transientKeys.clear(id);
+		this.lastTokenResponses.delete(id);
+		return deleted;
+	}
+
 	/**
 	 * Get all sessions
 	 */
@@ -616,11 +5180,123 @@ export class Loki {
 		return Array.from(this.sessions.values());
 	}
 
+	/**
+	 * Every client the token endpoint accepts, configured or registered
+	 */
+	getClients(): ClientStatus[] {
+		return this.clients.list();
+	}
+
+	/**
+	 * Register a client, or replace one registered earlier; throws if the
+	 * ID is a configured client's or the keys are invalid. A replaced
+	 * client's default mischief session is deleted.
+	 */
+	async registerClient(registration: ClientRegistration): Promise<ClientStatus> {
+		const { replacedSession } = await this.clients.register(registration);
+		if (replacedSession !== undefined) {
+			this.deleteSession(replacedSession);
+		}
+		return this.clients.status(registration.clientId) as ClientStatus;
+	}
+
+	/**
+	 * Delete a registered client and its default mischief session; throws
+	 * for configured clients
+	 */
+	async deleteClient(clientId: string): Promise<boolean> {
+		const { removed, session } = await this.clients.remove(clientId);
+		if (session !== undefined) {
+			this.deleteSession(session);
+		}
+		return removed;
+	}
+
+	/**
+	 * Register a confidential client's public keys for private_key_jwt,
+	 * replacing any it had; throws if the client is unknown or public, or
+	 * the keys are invalid
+	 */
+	async registerClientKeys(clientId: string, jwks: unknown): Promise<ClientStatus> {
+		await this.clients.registerKeys(clientId, jwks);
+		return this.clients.status(clientId) as ClientStatus;
+	}
+
+	/**
+	 * Every tenant, with the kid its tokens are signed under
+	 */
+	getTenants(): TenantStatus[] {
+		return this.tenants.list().map((tenant) => {
+			const key = this.keyManager.getTenantKey(tenant.id);
+			return key ? { ...tenant, kid: key.kid } : tenant;
+		});
+	}
+
+	/**
+	 * Register a tenant and generate its signing key; returns an error
+	 * message if the ID is invalid, reserved or taken
+	 */
+	async registerTenant(id: unknown): Promise<TenantStatus | string> {
+		const tenant = this.tenants.register(id);
+		if (typeof tenant === "string") {
+			return tenant;
+		}
+		const key = await this.keyManager.addTenantKey(tenant.id);
+		return { ...tenant, kid: key.kid };
+	}
+
+	/**
+	 * Remove a tenant and its signing key
+	 */
+	removeTenant(id: string): boolean {
+		this.keyManager.removeTenantKey(id);
+		return this.tenants.remove(id);
+	}
+
+	/**
+	 * The session a client's token requests without a session header run
+	 * in, if it has default mischief; created on first use, and again if
+	 * it has since been deleted
+	 */
+	private clientSession(clientId: string | undefined): Session | undefined {
+		const defaults = clientId === undefined ? undefined : this.clients.defaults(clientId);
+		if (clientId === undefined || !defaults) {
+			return undefined;
+		}
+		const existing =
+			defaults.sessionId === undefined ? undefined : this.sessions.get(defaults.sessionId);
+		if (existing) {
+			return existing;
+		}
+		const { id } = this.createSession({ mode: "explicit", mischief: defaults.mischief });
+		this.clients.setSession(clientId, id);
+		return this.sessions.get(id);
+	}
+
 	/**
 	 * Purge all sessions
 	 */
 	purgeSessions(): void {
 		this.sessions.clear();
+		this.eventLog.clearAll();
+		this.claimSources?.clearAll();
+		this.rogueJwks?.clearAll();
+		this.requestObjects.clearAll();
+		this.refreshLedger.clearAll();
+		this.pkceBindings.clearAll();
+		this.tokenResults.clearAll();
+		this.issuanceLog.clearAll();
+		this.sessionStats.clearAll();
+		this.harRecorder.clearAll();
+		this.authorizationDetails.clearAll();
+		this.maxAgeRequests.clearAll();
+		this.nonceRequests.clearAll();
+		this.acceptedRedirectUris.clearAll();
+		this.claimsRequests.clearAll();
+		this.scopeRequests.clearAll();
+		this.resourceRequests.clearAll();
+		this.transientKeys.clearAll();
+		this.lastTokenResponses.clear();
 		if (this.database) {
 			this.database.purgeAll();
 		}
@@ -633,6 +5309,13 @@ export class Loki {
 		return this.pluginRegistry;
 	}
 
+	/**
+	 * Get the signing key manager (for rollover plans and key sets)
+	 */
+	get keys(): KeyManager {
+		return this.keyManager;
+	}
+
 	/**
 	 * Register a plugin programmatically
 	 */
@@ -650,7 +5333,7 @@ export class Loki {
 	private shuffleArray<T>(array: T[]): T[] {
 		const result = [...array];
 		for (let i = result.length - 1; i > 0; i--) {
-			const j = Math.floor(Math.random() * (i + 1));
+			const j = Math.floor(random() * (i + 1));
 			// biome-ignore lint/style/noNonNullAssertion: indices are always within bounds in Fisher-Yates shuffle
 			[result[i], result[j]] = [result[j]!, result[i]!];
 		}
@@ -679,6 +5362,53 @@ export class SessionHandle {
 		return this.session.endedAt !== undefined;
 	}
 
+	/**
+	 * Seed of a probabilistic session's draws
+	 */
+	get seed(): number | undefined {
+		return this.session.seed;
+	}
+
+	/**
+	 * Token requests left before mischief starts (0 once warmed up)
+	 */
+	get warmupRemaining(): number {
+		const warmup = this.session.warmupRequests ?? 0;
+		return Math.max(0, warmup - (this.session.tokenRequests ?? 0));
+	}
+
+	/**
+	 * Get the event timeline for this session
+	 */
+	getEvents(): SessionEvent[] {
+		return this.loki.getSessionEvents(this.session.id);
+	}
+
+	/**
+	 * Freeze state: "pending" until the next token is captured, then "frozen"
+	 */
+	get freezeState(): "pending" | "frozen" | undefined {
+		const freeze = this.session.freeze;
+		if (!freeze) {
+			return undefined;
+		}
+		return freeze.response ? "frozen" : "pending";
+	}
+
+	/**
+	 * Capture the next token response and serve it for every later request
+	 */
+	freeze(options?: { keepFresh?: boolean }): void {
+		this.loki.freezeSession(this.session.id, options);
+	}
+
+	/**
+	 * Go back to producing fresh tokens
+	 */
+	unfreeze(): void {
+		this.loki.unfreezeSession(this.session.id);
+	}
+
 	/**
 	 * Enable a mischief plugin for this session (explicit mode)
 	 */
@@ -0,0 +1,98 @@
+/**
+ * Max Age - re-authentication at the authorization endpoint
+ *
+ * `max_age=0` is how step-up flows demand a fresh login. oidc-provider
+ * compares the login time with one-second resolution, so a login in the
+ * same second as the request would satisfy `max_age=0`; Loki adds
+ * `prompt=login` to such requests so the user always authenticates again.
+ *
+ * For sessions, each request's `max_age` is remembered for its client, and
+ * the client's next ID token is checked against it: the `auth_time` it
+ * carries either falls within `max_age` of the request or the re-auth was
+ * not honoured.
+ */
+
+export interface MaxAgeRequest {
+	maxAge: number;
+	/** When the authorization request arrived (epoch seconds) */
+	requestedAt: number;
+	/** Whether Loki made the provider authenticate the user again */
+	reauthForced: boolean;
+	/** Backdate the ID token's auth_time by this much when it's fresh (mischief) */
+	staleSeconds?: number;
+}
+
+/**
+ * Parse a `max_age` parameter; undefined unless it's a non-negative integer
+ */
+export function parseMaxAge(value: string | undefined): number | undefined {
+	if (value === undefined || !/^\d+$/.test(value)) {
+		return undefined;
+	}
+	return Number(value);
+}
+
+/**
+ * Add `login` to an authorization URL's prompt so the provider re-authenticates
+ */
+export function requireLogin(url: string): string {
+	const [path, query = ""] = url.split("?", 2) as [string, string?];
+	const params = new URLSearchParams(query);
+	const prompts = (params.get("prompt") ?? "").split(" ").filter((p) => p.length > 0);
+	if (prompts.includes("login")) {
+		return url;
+	}
+	params.set("prompt", [...prompts, "login"].join(" "));
+	return `${path}?${params}`;
+}
+
+/**
+ * Remove `max_age` from an authorization URL
+ */
+export function withoutMaxAge(url: string): string {
+	const [path, query = ""] = url.split("?", 2) as [string, string?];
+	const params = new URLSearchParams(query);
+	params.delete("max_age");
+	return `${path}?${params}`;
+}
+
+/**
+ * Whether an auth_time satisfies a max_age request
+ */
+export function authTimeHonors(request: MaxAgeRequest, authTime: number | undefined): boolean {
+	return authTime !== undefined && authTime >= request.requestedAt - request.maxAge;
+}
+
+/**
+ * The max_age each client last requested, per session, until its ID token is issued
+ */
+export class MaxAgeRequests {
+	private readonly sessions = new Map<string, Map<string, MaxAgeRequest>>();
+
+	request(sessionId: string, clientId: string, request: MaxAgeRequest): void {
+		let clients = this.sessions.get(sessionId);
+		if (!clients) {
+			clients = new Map();
+			this.sessions.set(sessionId, clients);
+		}
+		clients.set(clientId, request);
+	}
+
+	/**
+	 * The client's outstanding request, which its next ID token answers
+	 */
+	take(sessionId: string, clientId: string): MaxAgeRequest | undefined {
+		const clients = this.sessions.get(sessionId);
+		const request = clients?.get(clientId);
+		clients?.delete(clientId);
+		return request;
+	}
+
+	clear(sessionId: string): void {
+		this.sessions.delete(sessionId);
+	}
+
+	clearAll(): void {
+		this.sessions.clear();
+	}
+}
@@ -0,0 +1,183 @@
+/**
+ * Metrics - issuance, mischief and request counters for /metrics
+ *
+ * Lets monitoring confirm a fuzzing job is really being served malicious
+ * tokens: tokens issued, mischief applied by plugin, and request counts and
+ * latencies by endpoint, rendered in the Prometheus text exposition format.
+ * Labels never carry session IDs or raw paths, so the number of series
+ * stays bounded: endpoints are named (see endpointLabel), and plugins are
+ * the ones loaded.
+ */
+
+import { TOGGLEABLE_ENDPOINTS } from "./endpoint-flags.js";
+
+/** Upper bounds of the latency histogram's buckets, in seconds (Prometheus' defaults) */
+export const LATENCY_BUCKETS = [0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10];
+
+/** Named endpoints besides the toggleable ones, by path */
+const NAMED_PATHS: Record<string, string> = {
+	"/authorize": "authorization",
+	"/.well-known/openid-configuration": "discovery",
+	"/.well-known/oauth-authorization-server": "discovery",
+	"/health": "health",
+	"/metrics": "metrics",
+};
+
+interface Histogram {
+	/** Observations at or below each of LATENCY_BUCKETS */
+	buckets: number[];
+	sum: number;
+	count: number;
+}
+
+/**
+ * The endpoint label for a request URL: the endpoint's name, `admin` for
+ * the Admin API, or `other` for anything else
+ */
+export function endpointLabel(url: string): string {
+	const path = url.split("?")[0] ?? "/";
+	if (path === "/admin" || path.startsWith("/admin/")) {
+		return "admin";
+	}
+	const named = NAMED_PATHS[path];
+	if (named) {
+		return named;
+	}
+	for (const [name, endpoint] of Object.entries(TOGGLEABLE_ENDPOINTS)) {
+		if (endpoint.paths.includes(path)) {
+			return name;
+		}
+	}
+	return "other";
+}
+
+export class Metrics {
+	private tokensIssued = 0;
+	private sessionsEvicted = 0;
+	private readonly mischiefApplied = new Map<string, number>();
+	/** Session-less token requests chaos mode gave a mischief, by plugin */
+	private readonly chaosDrawn = new Map<string, number>();
+	/** Requests by endpoint, then status code */
+	private readonly requests = new Map<string, Map<number, number>>();
+	private readonly latencies = new Map<string, Histogram>();
+
+	/**
+	 * Count a token endpoint response that issued tokens
+	 */
+	countIssuance(): void {
+		this.tokensIssued++;
+	}
+
+	/**
+	 * Count a session evicted by its ttl
+	 */
+	countEviction(): void {
+		this.sessionsEvicted++;
+	}
+
+	/**
+	 * Count one application of a mischief plugin
+	 */
+	countMischief(plugin: string): void {
+		this.mischiefApplied.set(plugin, (this.mischiefApplied.get(plugin) ?? 0) + 1);
+	}
+
+	/**
+	 * Count a token request chaos mode gave a mischief
+	 */
+	countChaos(plugin: string): void {
+		this.chaosDrawn.set(plugin, (this.chaosDrawn.get(plugin) ?? 0) + 1);
+	}
+
+	/**
+	 * Record a served request's endpoint label, status code and duration
+	 */
+	observeRequest(endpoint: string, status: number, seconds: number): void {
+		const statuses = this.requests.get(endpoint) ?? new Map<number, number>();
+		statuses.set(status, (statuses.get(status) ?? 0) + 1);
+		this.requests.set(endpoint, statuses);
+
+		const histogram = this.latencies.get(endpoint) ?? {
+			buckets: LATENCY_BUCKETS.map(() => 0),
+			sum: 0,
+			count: 0,
+		};
+		LATENCY_BUCKETS.forEach((bound, i) => {
+			if (seconds <= bound) {
+				histogram.buckets[i] = (histogram.buckets[i] ?? 0) + 1;
+			}
+		});
+		histogram.sum += seconds;
+		histogram.count++;
+		this.latencies.set(endpoint, histogram);
+	}
+
+	/**
+	 * The counters as exposition format lines, with the active session count
+	 */
+	render(activeSessions: number): string[] {
+		const lines = [
+			"# HELP loki_tokens_issued_total Token endpoint responses that issued tokens",
+			"# TYPE loki_tokens_issued_total counter",
+			`loki_tokens_issued_total ${this.tokensIssued}`,
+			"# HELP loki_mischief_applied_total Mischief applied, by plugin",
+			"# TYPE loki_mischief_applied_total counter",
+		];
+		for (const [plugin, count] of [...this.mischiefApplied].sort(byKey)) {
+			lines.push(`loki_mischief_applied_total{mischief="${escapeLabel(plugin)}"} ${count}`);
+		}
+		lines.push(
+			"# HELP loki_chaos_requests_total Token requests chaos mode served a mischief, by plugin",
+			"# TYPE loki_chaos_requests_total counter",
+		);
+		for (const [plugin, count] of [...this.chaosDrawn].sort(byKey)) {
+			lines.push(`loki_chaos_requests_total{mischief="${escapeLabel(plugin)}"} ${count}`);
+		}
+		lines.push(
+			"# HELP loki_active_sessions Sessions that haven't ended",
+			"# TYPE loki_active_sessions gauge",
+			`loki_active_sessions ${activeSessions}`,
+			"# HELP loki_sessions_evicted_total Sessions evicted by their ttl",
+			"# TYPE loki_sessions_evicted_total counter",
+			`loki_sessions_evicted_total ${this.sessionsEvicted}`,
+			"# HELP loki_http_requests_total Requests served, by endpoint and status code",
+			"# TYPE loki_http_requests_total counter",
+		);
+		for (const [endpoint, statuses] of [...this.requests].sort(byKey)) {
+			for (const [status, count] of [...statuses].sort(byKey)) {
+				lines.push(`loki_http_requests_total{endpoint="${endpoint}",status="${status}"} ${count}`);
+			}
+		}
+		lines.push(
+			"# HELP loki_http_request_duration_seconds Time to serve a request, by endpoint",
+			"# TYPE loki_http_request_duration_seconds histogram",
+		);
+		for (const [endpoint, histogram] of [...this.latencies].sort(byKey)) {
+			const name = "loki_http_request_duration_seconds";
+			LATENCY_BUCKETS.forEach((bound, i) => {
+				const count = histogram.buckets[i] ?? 0;
+				lines.push(`${name}_bucket{endpoint="${endpoint}",le="${bound}"} ${count}`);
+			});
+			lines.push(
+				`${name}_bucket{endpoint="${endpoint}",le="+Inf"} ${histogram.count}`,
+				`${name}_sum{endpoint="${endpoint}"} ${histogram.sum}`,
+				`${name}_count{endpoint="${endpoint}"} ${histogram.count}`,
+			);
+		}
+		return lines;
+	}
+}
+
+function byKey<K extends string | number>([a]: [K, unknown], [b]: [K, unknown]): number {
+	if (a === b) {
+		return 0;
+	}
+	return a < b ? -1 : 1;
+}
+
+/**
+ * Escape a label value: backslash, double quote and line feed
+ */
+function escapeLabel(value: string): string {
+	return value.replace(/\\/g, "\\\\").replace(/"/g, '\\"').replace(/\n/g, "\\n");
+}
@@ -0,0 +1,83 @@
+/**
+ * Mischief Catalog - what every loaded plugin does and how to ask for it
+ *
+ * Built from the plugin registry, so third-party plugins show up next to
+ * the built-in ones. Each entry says which part of the exchange the
+ * mischief touches (worked out from its phase), the options it reads from
+ * `pluginConfig`, the spec it violates, and a session payload that turns
+ * it on with those options at their defaults, ready to POST to
+ * /admin/sessions.
+ */
+
+import type { MischiefPlugin, PluginOption } from "../plugins/types.js";
+import type { TokenSegment } from "./token-forge.js";
+import type { MischiefPhase, SessionConfig, Severity } from "./types.js";
+
+/** The part of an exchange a mischief acts on */
+export type MischiefSurface = "token" | "token-response" | "endpoint" | "discovery";
+
+export interface MischiefAffects {
+	surface: MischiefSurface;
+	/** JWT segments it rewrites (token mischief) */
+	segments?: TokenSegment[];
+	/** Tokens it can apply to, narrowed per session with `targets` (token mischief) */
+	tokens?: ("access_token" | "id_token")[];
+}
+
+export interface MischiefCatalogEntry {
+	id: string;
+	name: string;
+	description: string;
+	severity: Severity;
+	phase: MischiefPhase;
+	affects: MischiefAffects;
+	options: PluginOption[];
+	reference: { rfc?: string; oidc?: string; cwe?: string; requirement: string };
+	/** A session spec applying just this mischief */
+	example: Partial<SessionConfig>;
+}
+
+const AFFECTS: Record<MischiefPhase, MischiefAffects> = {
+	"token-signing": {
+		surface: "token",
+		segments: ["header", "signature"],
+		tokens: ["access_token", "id_token"],
+	},
+	"token-claims": { surface: "token", segments: ["payload"], tokens: ["access_token", "id_token"] },
+	response: { surface: "token-response" },
+	endpoint: { surface: "endpoint" },
+	discovery: { surface: "discovery" },
+};
+
+/** Describe each plugin, in registry order */
+export function mischiefCatalog(plugins: MischiefPlugin[]): MischiefCatalogEntry[] {
+	return plugins.map((plugin) => {
+		const options = plugin.options ?? [];
+		const { description: requirement, ...refs } = plugin.spec;
+		return {
+			id: plugin.id,
+			name: plugin.name,
+			description: plugin.description,
+			severity: plugin.severity,
+			phase: plugin.phase,
+			affects: structuredClone(AFFECTS[plugin.phase]),
+			options,
+			reference: { ...refs, requirement },
+			example: examplePayload(plugin.id, options),
+		};
+	});
+}
+
+function examplePayload(id: string, options: PluginOption[]): Partial<SessionConfig> {
+	const example: Partial<SessionConfig> = { mode: "explicit", mischief: [id] };
+	const defaults: Record<string, unknown> = {};
+	for (const option of options) {
+		if (option.default !== undefined) {
+			defaults[option.name] = option.default;
+		}
+	}
+	if (Object.keys(defaults).length > 0) {
+		example.pluginConfig = { [id]: defaults };
+	}
+	return example;
+}
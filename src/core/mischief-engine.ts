@@ -5,11 +5,26 @@
  * applies active mischief plugins, and logs everything to the ledger.
  */
 
-import { nanoid } from "nanoid";
 import type { LedgerEntry, MischiefLedger } from "../ledger/types.js";
 import type { PluginRegistry } from "../plugins/registry.js";
-import type { MischiefContext, MischiefPlugin, MischiefResult } from "../plugins/types.js";
-import { type ForgeableToken, parseToken } from "./token-forge.js";
+import type {
+	EndpointContext,
+	MischiefContext,
+	MischiefPlugin,
+	MischiefResult,
+	ResponseContext,
+	TenantContext,
+	TokenContext,
+	TokenType,
+} from "../plugins/types.js";
+import type { ClaimSourceStore } from "./claim-sources.js";
+import type { ManagedKey } from "./key-manager.js";
+import { drawMischief } from "./probabilistic-draw.js";
+import { random, randomId, randomInt } from "./random.js";
+import type { RequestedClaims } from "./request-claims.js";
+import type { RogueJwksStore } from "./rogue-jwks.js";
+import { type ForgeableToken, type TokenSegment, parseToken } from "./token-forge.js";
+import type { TransientKeyStore } from "./transient-keys.js";
 import type { Session } from "./types.js";
 
 export interface MischiefEngineOptions {
@@ -17,6 +32,14 @@ export interface MischiefEngineOptions {
 	getPublicKey: () => Promise<string>;
 	/** Optional callback for persisting ledger entries */
 	onLedgerEntry?: (sessionId: string, entry: LedgerEntry) => void;
+	/** Optional store for aggregated/distributed claim sources */
+	claimSources?: ClaimSourceStore;
+	/** Optional store serving attacker key sets for jku to point at */
+	rogueJwks?: RogueJwksStore;
+	/** Optional store publishing keys in session JWKS responses for a window */
+	transientKeys?: TransientKeyStore;
+	/** Optional accessor for the key a session's tokens (or a tenant's) are currently signed with */
+	getSigningKey?: (session: Session, tenant?: string) => ManagedKey;
 }
 
 export interface RequestContext {
@@ -25,8 +48,18 @@ export interface RequestContext {
 	endpoint: string;
 	method: string;
 	timestamp: Date;
+	/** Plugin IDs already drawn for this request, used instead of the session's mode */
+	mischief?: string[];
+	/** The tenant the request was addressed to, and every tenant's issuer */
+	tenant?: TenantContext;
 }
 
+/** What a discovery or JWKS response is serving, and to whom */
+export type DiscoveryServed = Pick<ResponseContext, "jwksFetch" | "metadataDocument">;
+
+/** What a token response is serving */
+export type TokenServed = Pick<ResponseContext, "idTokenEncryption">;
+
 export interface MischiefApplication {
 	pluginId: string;
 	result: MischiefResult;
@@ -40,6 +73,10 @@ export class MischiefEngine {
 	private readonly pluginRegistry: PluginRegistry;
 	private readonly getPublicKey: () => Promise<string>;
 	private readonly onLedgerEntry?: (sessionId: string, entry: LedgerEntry) => void;
+	private readonly claimSources?: ClaimSourceStore;
+	private readonly rogueJwks?: RogueJwksStore;
+	private readonly transientKeys?: TransientKeyStore;
+	private readonly getSigningKey?: (session: Session, tenant?: string) => ManagedKey;
 	private readonly ledgerEntries = new Map<string, LedgerEntry[]>(); // sessionId -> entries
 
 	constructor(options: MischiefEngineOptions) {
@@ -48,16 +85,41 @@ export class MischiefEngine {
 		if (options.onLedgerEntry) {
 			this.onLedgerEntry = options.onLedgerEntry;
 		}
+		if (options.claimSources) {
+			this.claimSources = options.claimSources;
+		}
+		if (options.rogueJwks) {
+			this.rogueJwks = options.rogueJwks;
+		}
+		if (options.transientKeys) {
+			this.transientKeys = options.transientKeys;
+		}
+		if (options.getSigningKey) {
+			this.getSigningKey = options.getSigningKey;
+		}
 	}
 
 	/**
 	 * Apply mischief to a JWT token
+	 *
+	 * Claims plugins run before signing plugins, so a signature forged by
+	 * one covers the claims the others edited.
 	 */
 	async applyToToken(
 		jwt: string,
 		requestCtx: RequestContext,
+		tokenType: TokenType,
+		accessToken?: string,
+		requestedClaims?: RequestedClaims,
 	): Promise<{ token: string; applications: MischiefApplication[] }> {
-		const plugins = this.selectPlugins(requestCtx.session, ["token-signing", "token-claims"]);
+		const targets = requestCtx.session.targets ?? {};
+		const plugins = [
+			...this.selectPlugins(requestCtx, ["token-claims"]),
+			...this.selectPlugins(requestCtx, ["token-signing"]),
+		].filter((plugin) => {
+			const target = targets[plugin.id] ?? "both";
+			return target === "both" || target === tokenType;
+		});
 
 		if (plugins.length === 0) {
 			return { token: jwt, applications: [] };
@@ -68,7 +130,15 @@ export class MischiefEngine {
 		const applications: MischiefApplication[] = [];
 
 		for (const plugin of plugins) {
-			const context = this.buildTokenContext(forgeableToken, requestCtx.session, plugin);
+			const context = this.buildTokenContext(
+				forgeableToken,
+				requestCtx.session,
+				plugin,
+				tokenType,
+				accessToken,
+				requestCtx.tenant,
+				requestedClaims,
+			);
 			const result = await plugin.apply(context);
 
 			if (result.applied) {
@@ -85,14 +155,25 @@ export class MischiefEngine {
 
 	/**
 	 * Apply response-phase mischief (like latency injection)
+	 *
+	 * Plugins receive the token response in `response.body` and may edit it,
+	 * and may set `response.headers` to add or override response headers.
 	 */
 	async applyToResponse(
 		requestCtx: RequestContext,
-	): Promise<{ applications: MischiefApplication[]; delayMs: number }> {
-		const plugins = this.selectPlugins(requestCtx.session, ["response"]);
+		body: unknown = null,
+		served: TokenServed = {},
+	): Promise<{
+		applications: MischiefApplication[];
+		delayMs: number;
+		body: unknown;
+		headers: Record<string, string>;
+	}> {
+		const plugins = this.selectPlugins(requestCtx, ["response"]);
+		const headers: Record<string, string> = {};
 
 		if (plugins.length === 0) {
-			return { applications: [], delayMs: 0 };
+			return { applications: [], delayMs: 0, body, headers };
 		}
 
 		const applications: MischiefApplication[] = [];
@@ -100,7 +181,7 @@ export class MischiefEngine {
 
 		for (const plugin of plugins) {
 			const startTime = Date.now();
-			const context = this.buildResponseContext(requestCtx.session, plugin);
+			const context = this.buildResponseContext(requestCtx, plugin, body, served);
 			const result = await plugin.apply(context);
 			const elapsed = Date.now() - startTime;
 
@@ -108,10 +189,12 @@ export class MischiefEngine {
 				applications.push({ pluginId: plugin.id, result, plugin });
 				this.recordLedgerEntry(requestCtx, plugin, result);
 				totalDelay += elapsed;
+				body = context.response?.body;
+				Object.assign(headers, context.response?.headers);
 			}
 		}
 
-		return { applications, delayMs: totalDelay };
+		return { applications, delayMs: totalDelay, body, headers };
 	}
 
 	/**
@@ -120,8 +203,9 @@ export class MischiefEngine {
 	async applyToDiscovery(
 		body: unknown,
 		requestCtx: RequestContext,
+		served: DiscoveryServed = {},
 	): Promise<{ body: unknown; applications: MischiefApplication[] }> {
-		const plugins = this.selectPlugins(requestCtx.session, ["discovery"]);
+		const plugins = this.selectPlugins(requestCtx, ["discovery"]);
 
 		if (plugins.length === 0) {
 			return { body, applications: [] };
@@ -131,7 +215,7 @@ export class MischiefEngine {
 		let modifiedBody = body;
 
 		for (const plugin of plugins) {
-			const context = this.buildDiscoveryContext(modifiedBody, requestCtx.session, plugin);
+			const context = this.buildDiscoveryContext(modifiedBody, requestCtx.session, plugin, served);
 			const result = await plugin.apply(context);
 
 			if (result.applied) {
@@ -148,10 +232,50 @@ export class MischiefEngine {
 	}
 
 	/**
-	 * Select which plugins to apply based on session mode
+	 * Apply endpoint-phase mischief (behaviour of endpoints like revocation)
+	 *
+	 * Plugins inspect the endpoint and record what Loki should do differently
+	 * in `endpoint.actions`; the caller acts on them.
 	 */
-	private selectPlugins(session: Session, phases: MischiefPlugin["phase"][]): MischiefPlugin[] {
-		const enabledIds = this.getEnabledPlugins(session);
+	async applyToEndpoint(
+		endpoint: Omit<EndpointContext, "actions">,
+		requestCtx: RequestContext,
+	): Promise<{ actions: Record<string, unknown>; applications: MischiefApplication[] }> {
+		const plugins = this.selectPlugins(requestCtx, ["endpoint"]);
+		const actions: Record<string, unknown> = {};
+
+		if (plugins.length === 0) {
+			return { actions, applications: [] };
+		}
+
+		const applications: MischiefApplication[] = [];
+
+		for (const plugin of plugins) {
+			const context: MischiefContext = {
+				endpoint: { ...endpoint, actions },
+				config: this.getPluginConfig(requestCtx.session, plugin.id),
+				session: this.buildSessionInfo(requestCtx.session),
+			};
+			const result = await plugin.apply(context);
+
+			if (result.applied) {
+				applications.push({ pluginId: plugin.id, result, plugin });
+				this.recordLedgerEntry(requestCtx, plugin, result);
+			}
+		}
+
+		return { actions, applications };
+	}
+
+	/**
+	 * Select which plugins to apply based on session mode, unless the
+	 * request's plugins were already drawn
+	 */
+	private selectPlugins(
+		requestCtx: RequestContext,
+		phases: MischiefPlugin["phase"][],
+	): MischiefPlugin[] {
+		const enabledIds = requestCtx.mischief ?? this.getEnabledPlugins(requestCtx.session);
 		const plugins = enabledIds
 			.map((id) => this.pluginRegistry.get(id))
 			.filter((p): p is MischiefPlugin => p !== undefined)
@@ -170,11 +294,11 @@ export class MischiefEngine {
 
 			case "random": {
 				const probability = session.probability ?? 0.5;
-				if (Math.random() > probability) {
+				if (random() > probability) {
 					return []; // No mischief this time
 				}
 				// Pick a random plugin from the enabled set
-				const randomIndex = Math.floor(Math.random() * session.mischief.length);
+				const randomIndex = randomInt(session.mischief.length);
 				const selected = session.mischief[randomIndex];
 				return selected ? [selected] : [];
 			}
@@ -188,6 +312,9 @@ export class MischiefEngine {
 				return next ? [next] : [];
 			}
 
+			case "probabilistic":
+				return drawMischief(session);
+
 			default:
 				return [];
 		}
@@ -200,6 +327,10 @@ export class MischiefEngine {
 		token: ForgeableToken,
 		session: Session,
 		plugin: MischiefPlugin,
+		tokenType: TokenType,
+		accessToken?: string,
+		tenant?: TenantContext,
+		requestedClaims?: RequestedClaims,
 	): MischiefContext {
 		const sessionInfo: MischiefContext["session"] = {
 			id: session.id,
@@ -209,19 +340,80 @@ export class MischiefEngine {
 			sessionInfo.name = session.name;
 		}
 
-		return {
-			token: {
-				header: token.header,
-				claims: token.claims,
-				get signature() {
-					return token.signature;
-				},
-				set signature(value: string) {
-					token.signature = value;
-				},
-				getPublicKey: () => token.getPublicKey(),
-				sign: (alg: string, key: string | Buffer) => token.sign(alg, key),
+		const tokenContext: TokenContext = {
+			tokenType,
+			header: token.header,
+			claims: token.claims,
+			get signature() {
+				return token.signature;
+			},
+			set signature(value: string) {
+				token.signature = value;
+			},
+			get rawHeader() {
+				return token.rawHeader;
+			},
+			set rawHeader(value: string | undefined) {
+				token.rawHeader = value;
+			},
+			get rawPayload() {
+				return token.rawPayload;
 			},
+			set rawPayload(value: string | undefined) {
+				token.rawPayload = value;
+			},
+			get standardBase64() {
+				return token.standardBase64;
+			},
+			set standardBase64(value: TokenSegment[]) {
+				token.standardBase64 = value;
+			},
+			get disclosures() {
+				return token.disclosures;
+			},
+			set disclosures(value: string[] | undefined) {
+				token.disclosures = value;
+			},
+			getPublicKey: () => token.getPublicKey(),
+			sign: (alg: string, key: string | Buffer) => token.sign(alg, key),
+		};
+		if (this.getSigningKey) {
+			const getSigningKey = this.getSigningKey;
+			const home = tenant?.id ?? undefined;
+			tokenContext.resign = async () => {
+				const key = getSigningKey(session, home);
+				await token.sign(key.alg, key.privateKey);
+			};
+			tokenContext.publishedJwk = getSigningKey(session, home).publicJwk;
+			if (tenant) {
+				tokenContext.resignAsTenant = async (id: string) => {
+					const key = getSigningKey(session, id);
+					token.header.kid = key.kid;
+					await token.sign(key.alg, key.privateKey);
+				};
+			}
+		}
+		if (this.claimSources) {
+			tokenContext.claimSources = this.claimSources.forSession(session.id);
+		}
+		if (this.rogueJwks) {
+			tokenContext.rogueJwks = this.rogueJwks.forSession(session.id);
+		}
+		if (this.transientKeys) {
+			tokenContext.transientKeys = this.transientKeys.forSession(session.id);
+		}
+		if (accessToken !== undefined) {
+			tokenContext.accessToken = accessToken;
+		}
+		if (tenant) {
+			tokenContext.tenant = tenant;
+		}
+		if (requestedClaims !== undefined) {
+			tokenContext.requestedClaims = requestedClaims;
+		}
+
+		return {
+			token: tokenContext,
 			config: this.getPluginConfig(session, plugin.id),
 			session: sessionInfo,
 		};
@@ -230,7 +422,13 @@ export class MischiefEngine {
 	/**
 	 * Build context for response-phase plugins
 	 */
-	private buildResponseContext(session: Session, plugin: MischiefPlugin): MischiefContext {
+	private buildResponseContext(
+		requestCtx: RequestContext,
+		plugin: MischiefPlugin,
+		body: unknown,
+		served: TokenServed,
+	): MischiefContext {
+		const { session } = requestCtx;
 		const sessionInfo: MischiefContext["session"] = {
 			id: session.id,
 			mode: session.mode,
@@ -239,15 +437,21 @@ export class MischiefEngine {
 			sessionInfo.name = session.name;
 		}
 
-		return {
-			response: {
-				status: 200,
-				headers: {},
-				body: null,
-				delay: async (ms: number) => {
-					await new Promise((resolve) => setTimeout(resolve, ms));
-				},
+		const response: ResponseContext = {
+			status: 200,
+			headers: {},
+			body,
+			delay: async (ms: number) => {
+				await new Promise((resolve) => setTimeout(resolve, ms));
 			},
+			requestId: requestCtx.requestId,
+		};
+		if (served.idTokenEncryption) {
+			response.idTokenEncryption = served.idTokenEncryption;
+		}
+
+		return {
+			response,
 			config: this.getPluginConfig(session, plugin.id),
 			session: sessionInfo,
 		};
@@ -260,6 +464,7 @@ export class MischiefEngine {
 		body: unknown,
 		session: Session,
 		plugin: MischiefPlugin,
+		served: DiscoveryServed,
 	): MischiefContext {
 		const sessionInfo: MischiefContext["session"] = {
 			id: session.id,
@@ -269,26 +474,48 @@ export class MischiefEngine {
 			sessionInfo.name = session.name;
 		}
 
-		return {
-			response: {
-				status: 200,
-				headers: {},
-				body,
-				delay: async (ms: number) => {
-					await new Promise((resolve) => setTimeout(resolve, ms));
-				},
+		const response: ResponseContext = {
+			status: 200,
+			headers: {},
+			body,
+			delay: async (ms: number) => {
+				await new Promise((resolve) => setTimeout(resolve, ms));
 			},
+		};
+		// Shared, so a plugin serving decoy keys is visible to Loki and later plugins
+		if (served.jwksFetch) {
+			response.jwksFetch = served.jwksFetch;
+		}
+		if (served.metadataDocument) {
+			response.metadataDocument = served.metadataDocument;
+		}
+
+		return {
+			response,
 			config: this.getPluginConfig(session, plugin.id),
 			session: sessionInfo,
 		};
 	}
 
+	/**
+	 * Session details exposed to plugins
+	 */
+	private buildSessionInfo(session: Session): MischiefContext["session"] {
+		const sessionInfo: MischiefContext["session"] = {
+			id: session.id,
+			mode: session.mode,
+		};
+		if (session.name !== undefined) {
+			sessionInfo.name = session.name;
+		}
+		return sessionInfo;
+	}
+
 	/**
 	 * Get plugin-specific config from session
 	 */
-	private getPluginConfig(_session: Session, _pluginId: string): Record<string, unknown> {
-		// TODO: Store and retrieve per-plugin config from session
-		return {};
+	private getPluginConfig(session: Session, pluginId: string): Record<string, unknown> {
+		return { ...session.pluginConfig?.[pluginId] };
 	}
 
 	/**
@@ -314,7 +541,7 @@ export class MischiefEngine {
 		}
 
 		const entry: LedgerEntry = {
-			id: `entry_${nanoid(8)}`,
+			id: `entry_${randomId(8)}`,
 			requestId: requestCtx.requestId,
 			timestamp: requestCtx.timestamp.toISOString(),
 			plugin: {
@@ -340,6 +567,15 @@ export class MischiefEngine {
 		}
 	}
 
+	/**
+	 * Restore a session's ledger entries, as loaded from the session store
+	 */
+	restoreLedger(sessionId: string, entries: LedgerEntry[]): void {
+		if (entries.length > 0) {
+			this.ledgerEntries.set(sessionId, entries);
+		}
+	}
+
 	/**
 	 * Get ledger entries for a session
 	 */
@@ -400,4 +636,14 @@ export class MischiefEngine {
 	clearLedger(sessionId: string): void {
 		this.ledgerEntries.delete(sessionId);
 	}
+
+	/**
+	 * Clear a session's ledger and whatever plugins keep for it
+	 */
+	forgetSession(sessionId: string): void {
+		this.clearLedger(sessionId);
+		for (const plugin of this.pluginRegistry.getAll()) {
+			plugin.forgetSession?.(sessionId);
+		}
+	}
 }
@@ -0,0 +1,41 @@
+/**
+ * mTLS - certificate-bound access tokens
+ *
+ * Served over TLS, Loki asks every client for a certificate and accepts
+ * any it presents, as with self-signed certificate binding (RFC 8705
+ * Section 2.2): the certificate doesn't authenticate the client, it names
+ * the key its tokens are bound to. An access token issued over a
+ * connection that presented one carries the certificate's SHA-256
+ * thumbprint in its `cnf` claim (Section 3.1), which a resource server
+ * must match against the certificate of its own mTLS connection.
+ */
+
+import { createHash } from "node:crypto";
+import type { IncomingMessage } from "node:http";
+import type { TLSSocket } from "node:tls";
+import { isPlainObject } from "./session-spec.js";
+
+/** The `cnf` member holding a certificate's thumbprint */
+export const X5T_S256 = "x5t#S256";
+
+/**
+ * The x5t#S256 thumbprint of the certificate a request's client presented, if any
+ */
+export function clientCertificateThumbprint(req: IncomingMessage): string | undefined {
+	const socket = req.socket as Partial<TLSSocket>;
+	const raw = socket.getPeerCertificate?.().raw;
+	return raw ? createHash("sha256").update(raw).digest("base64url") : undefined;
+}
+
+/**
+ * Bind a token's claims to a certificate, keeping any other confirmation
+ * method (a DPoP key's `jkt`); false if they were already bound to it
+ */
+export function bindCertificate(claims: Record<string, unknown>, thumbprint: string): boolean {
+	const cnf = isPlainObject(claims.cnf) ? claims.cnf : {};
+	if (cnf[X5T_S256] === thumbprint) {
+		return false;
+	}
+	claims.cnf = { ...cnf, [X5T_S256]: thumbprint };
+	return true;
+}
@@ -0,0 +1,124 @@
+/**
+ * PKCE - code challenges Loki checks itself
+ *
+ * oidc-provider only supports S256. With `plain` the challenge is the
+ * verifier itself, so Loki can accept a plain challenge by rewriting it to
+ * its S256 form before the provider sees it: the client's later
+ * code_verifier then hashes to the stored challenge and the exchange
+ * succeeds exactly as a plain-accepting server would allow.
+ *
+ * For sessions Loki goes further and verifies the code_verifier itself:
+ * the provider is given a challenge for a verifier only Loki knows, and
+ * Loki swaps that verifier in at the token endpoint once the client's own
+ * verifier has checked out against the client's challenge (or mischief
+ * says to ignore it). The substitute challenge also binds the code to the
+ * session that asked for it.
+ */
+
+import { createHash } from "node:crypto";
+import { randomBytes } from "./random.js";
+import type { PkceMethod } from "./types.js";
+
+/** Authorizations remembered */
+const MAX_BINDINGS = 10000;
+
+/** A session's PKCE authorization, keyed by the substitute challenge the provider holds */
+export interface PkceBinding {
+	sessionId: string;
+	/** The client's code_challenge */
+	challenge: string;
+	/** The client's code_challenge_method */
+	method: PkceMethod;
+	/** The verifier Loki presents to the provider in the client's place */
+	verifier: string;
+}
+
+/**
+ * The S256 code challenge for a verifier (RFC 7636 Section 4.2)
+ */
+export function s256Challenge(verifier: string): string {
+	return createHash("sha256").update(verifier).digest("base64url");
+}
+
+/**
+ * Rewrite an authorization URL's plain code challenge to S256
+ *
+ * Returns undefined if the URL doesn't carry a plain challenge.
+ */
+export function upgradePlainChallenge(url: string): string | undefined {
+	const params = new URLSearchParams(url.split("?", 2)[1] ?? "");
+	const challenge = params.get("code_challenge");
+	// An absent method means plain (RFC 7636 Section 4.3)
+	if (!challenge || (params.get("code_challenge_method") ?? "plain") !== "plain") {
+		return undefined;
+	}
+	return withS256Challenge(url, s256Challenge(challenge));
+}
+
+/**
+ * An authorization URL carrying `challenge` as its S256 code challenge
+ */
+export function withS256Challenge(url: string, challenge: string): string {
+	const [path, query = ""] = url.split("?", 2) as [string, string?];
+	const params = new URLSearchParams(query);
+	params.set("code_challenge", challenge);
+	params.set("code_challenge_method", "S256");
+	return `${path}?${params}`;
+}
+
+/**
+ * Whether a code_verifier matches a binding's challenge (RFC 7636 Section 4.6)
+ */
+export function verifierMatches(binding: PkceBinding, verifier: string): boolean {
+	const derived = binding.method === "S256" ? s256Challenge(verifier) : verifier;
+	return derived === binding.challenge;
+}
+
+/**
+ * Session PKCE authorizations, by the substitute challenge given to the provider
+ */
+export class PkceBindings {
+	private readonly bindings = new Map<string, PkceBinding>();
+
+	/**
+	 * Stand in for a session's code challenge; returns the substitute
+	 * challenge to give the provider
+	 */
+	bind(sessionId: string, challenge: string, method: PkceMethod): string {
+		const verifier = randomBytes(32).toString("base64url");
+		const substitute = s256Challenge(verifier);
+		this.bindings.set(substitute, { sessionId, challenge, method, verifier });
+		if (this.bindings.size > MAX_BINDINGS) {
+			const oldest = this.bindings.keys().next().value;
+			if (oldest !== undefined) {
+				this.bindings.delete(oldest);
+			}
+		}
+		return substitute;
+	}
+
+	/**
+	 * The binding behind a challenge the provider holds, if Loki substituted it
+	 */
+	get(substitute: string): PkceBinding | undefined {
+		return this.bindings.get(substitute);
+	}
+
+	/**
+	 * Drop a session's bindings
+	 */
+	clear(sessionId: string): void {
+		for (const [substitute, binding] of this.bindings) {
+			if (binding.sessionId === sessionId) {
+				this.bindings.delete(substitute);
+			}
+		}
+	}
+
+	/**
+	 * Drop all bindings
+	 */
+	clearAll(): void {
+		this.bindings.clear();
+	}
+}
@@ -0,0 +1,53 @@
+/**
+ * Probabilistic Draw - independent per-plugin odds for probabilistic sessions
+ *
+ * A `probabilistic` session gives each plugin its own probability of
+ * firing, e.g. `{ "alg-none": 0.1, "aud-confusion": 0.25 }`, and draws every
+ * plugin independently once per token request. The draws come from a small
+ * seeded generator (mulberry32) whose state is kept on the session, so two
+ * sessions created with the same seed and sent the same requests draw the
+ * same mischief: a soak run that caught a client accepting a bad token can
+ * be replayed exactly. Sessions created without a seed are given one.
+ */
+
+import { randomInt } from "./random.js";
+import type { Session } from "./types.js";
+
+/** Seeds are unsigned 32-bit integers */
+export const MAX_SEED = 0xffffffff;
+
+/**
+ * A seed for a session created without one
+ */
+export function randomSeed(): number {
+	return randomInt(MAX_SEED + 1);
+}
+
+/**
+ * Draw the plugins that fire for one token request, in the session's
+ * mischief order, advancing the session's generator
+ */
+export function drawMischief(session: Session): string[] {
+	const probabilities = session.probabilities ?? {};
+	let state = session.randomState ?? session.seed ?? 0;
+	const drawn: string[] = [];
+	for (const id of session.mischief) {
+		const next = mulberry32(state);
+		state = next.state;
+		if (next.value < (probabilities[id] ?? 0)) {
+			drawn.push(id);
+		}
+	}
+	session.randomState = state;
+	return drawn;
+}
+
+/**
+ * One step of mulberry32: the next state and a value in [0, 1)
+ */
+function mulberry32(state: number): { state: number; value: number } {
+	const next = (state + 0x6d2b79f5) >>> 0;
+	let t = Math.imul(next ^ (next >>> 15), next | 1);
+	t ^= t + Math.imul(t ^ (t >>> 7), t | 61);
+	return { state: next, value: ((t ^ (t >>> 14)) >>> 0) / 0x100000000 };
+}
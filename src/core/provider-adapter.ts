@@ -9,11 +9,29 @@ import Provider, {
 	type KoaContextWithOIDC,
 	type ClientMetadata,
 } from "oidc-provider";
+import { registeredAuthMethod } from "./client-auth.js";
+import type { SigningAlgorithm } from "./key-manager.js";
+import { ProviderStorage } from "./provider-storage.js";
+import { randomBytes } from "./random.js";
+import { DEFAULT_RESOURCE } from "./request-resource.js";
+import { TOKEN_EXCHANGE_GRANT } from "./token-exchange.js";
 import type { ClientConfig, ProviderConfig } from "./types.js";
+import { DEFAULT_SCOPE_CLAIMS, accountClaims, subjectError } from "./userinfo.js";
+
+/** Grant types OAuth 2.1 removes */
+const OAUTH21_FORBIDDEN_GRANTS = ["implicit", "password"];
 
 export interface ProviderAdapterOptions {
 	config: ProviderConfig;
+	/** Private signing keys; oidc-provider falls back to its development key if omitted */
+	jwks?: NonNullable<Configuration["jwks"]>;
 	onTokenSign?: (ctx: KoaContextWithOIDC, token: TokenSignContext) => Promise<void>;
+	/** Whether a request's DPoP proof needs a server-provided nonce, besides requireDpopNonce */
+	requireDpopNonce?: (ctx: KoaContextWithOIDC) => boolean;
+	/** Clients registered while Loki runs, looked up when config has no such client */
+	findClient?: (clientId: string) => ClientConfig | undefined;
+	/** Whether mischief accepted a redirect URI the client didn't register */
+	acceptRedirectUri?: (clientId: string, redirectUri: string) => boolean;
 }
 
 export interface TokenSignContext {
@@ -26,28 +44,76 @@ export interface TokenSignContext {
  */
 export function createProvider(options: ProviderAdapterOptions): Provider {
 	const { config } = options;
+	const strict = config.profile === "oauth21";
+	const maxLength = config.subjectMaxLength;
+	if (maxLength !== undefined && !(Number.isInteger(maxLength) && maxLength >= 1)) {
+		throw new Error(`subjectMaxLength must be a positive integer, got ${maxLength}`);
+	}
+	const deviceCodeTtl = config.deviceCodeTtl ?? 600;
+	if (!(Number.isInteger(deviceCodeTtl) && deviceCodeTtl >= 1)) {
+		throw new Error(`deviceCodeTtl must be a positive integer, got ${deviceCodeTtl}`);
+	}
+	const accessTokenTtl = config.accessTokenTtl ?? 3600;
+	if (!(Number.isInteger(accessTokenTtl) && accessTokenTtl >= 1)) {
+		throw new Error(`accessTokenTtl must be a positive integer, got ${accessTokenTtl}`);
+	}
+	// A loaded EC or Ed25519 primary key signs tokens in RS256's place
+	const signingAlg = (options.jwks?.keys[0]?.alg ?? "RS256") as SigningAlgorithm;
+	assertClientAuth(config.clients);
+	if (strict) {
+		assertOAuth21Clients(config.clients);
+		if (config.pkceMinimumMethod === "plain") {
+			throw new Error("The oauth21 profile requires the S256 PKCE method; 'plain' is not allowed");
+		}
+	}
+
+	const { findClient } = options;
+	const storage = new ProviderStorage((clientId) => {
+		const client = findClient?.(clientId);
+		return client ? clientToOidcConfig(client) : undefined;
+	});
 
 	const configuration: Configuration = {
 		clients: config.clients.map(clientToOidcConfig),
 
+		// Signing keys managed by Loki so it can re-sign and rotate them
+		...(options.jwks ? { jwks: options.jwks } : {}),
+		clientDefaults: {
+			grant_types: ["authorization_code"],
+			id_token_signed_response_alg: signingAlg,
+			response_types: ["code"],
+			token_endpoint_auth_method: "client_secret_basic",
+		},
+
 		// Features we need for testing
 		features: {
 			devInteractions: { enabled: true }, // Simple login UI for testing
 			clientCredentials: { enabled: true },
+			deviceFlow: { enabled: true }, // RFC 8628, for input-constrained clients
 			introspection: { enabled: true },
 			revocation: { enabled: true },
+			// Sender-constrained tokens; nonces are demanded per request (RFC 9449 Section 8)
+			dPoP: {
+				enabled: true,
+				nonceSecret: randomBytes(32),
+				requireNonce: (ctx) =>
+					config.requireDpopNonce === true || options.requireDpopNonce?.(ctx) === true,
+			},
+			requestObjects: { enabled: true }, // JAR; Loki enforces jti single-use per session
+			claimsParameter: { enabled: true }, // OIDC Core Section 5.5; Loki fills in what's missing
 			resourceIndicators: {
 				enabled: true,
 				// Default resource when none specified - required for client_credentials to get JWT
 				defaultResource: async (_ctx, _client, _oneOf) => {
-					return "https://loki.test/api";
+					return DEFAULT_RESOURCE;
 				},
 				// Return resource server info with JWT format
 				getResourceServerInfo: async (_ctx, _resourceIndicator, _client) => {
 					return {
 						scope: "openid profile email",
 						accessTokenFormat: "jwt" as const,
-						accessTokenTTL: 3600,
+						accessTokenTTL: accessTokenTtl,
+						jwt: { sign: { alg: signingAlg } },
 					};
 				},
 				// Use the granted resource even when openid scope present
@@ -57,14 +123,35 @@ export function createProvider(options: ProviderAdapterOptions): Provider {
 			},
 		},
 
+		// RFC 8628 names no path; Loki serves the device authorization endpoint here
+		routes: {
+			device_authorization: "/device_authorization",
+		},
+
 		// Cookie keys (required)
 		cookies: {
 			keys: ["loki-secret-key-1", "loki-secret-key-2"],
 		},
 
-		// PKCE configuration
+		// PKCE configuration - optional for testing flexibility unless strict
 		pkce: {
-			required: () => false, // Don't require PKCE for testing flexibility
+			required: () => strict,
+		},
+
+		// OAuth 2.1: authorization code is the only response type
+		...(strict ? { responseTypes: ["code"] } : {}),
+
+		// Refresh tokens are one-time use under OAuth 2.1 and for Loki sessions, whose
+		// rotation ledger relies on it. Otherwise keep oidc-provider's default: rotate
+		// public clients' tokens and tokens past 70% of their lifetime.
+		rotateRefreshToken: (ctx) => {
+			if (strict || ctx.get("x-loki-session") !== "") {
+				return true;
+			}
+			const { Client: client, RefreshToken: refreshToken } = ctx.oidc.entities;
+			return (
+				client?.clientAuthMethod === "none" || (refreshToken?.ttlPercentagePassed() ?? 0) >= 70
+			);
 		},
 
 		// We don't need custom formats - oidc-provider uses JWT for id_tokens by default
@@ -72,33 +159,27 @@ export function createProvider(options: ProviderAdapterOptions): Provider {
 
 		// TTL configuration
 		ttl: {
-			AccessToken: 3600,
+			AccessToken: accessTokenTtl,
 			AuthorizationCode: 600,
+			DeviceCode: deviceCodeTtl,
 			IdToken: 3600,
 			RefreshToken: 86400,
 		},
 
-		// Claims configuration
-		claims: {
-			openid: ["sub"],
-			email: ["email", "email_verified"],
-			profile: ["name", "family_name", "given_name"],
-		},
+		// Claims configuration - the same map Loki's /me applies
+		claims: config.scopeClaims ?? DEFAULT_SCOPE_CLAIMS,
+
+		// In-memory storage that also answers for clients registered at runtime
+		adapter: (model: string) => storage.adapterFor(model),
 
-		// Simple in-memory adapter for testing
-		// In production, you'd use a persistent adapter
-		adapter: undefined, // Uses default in-memory adapter
-
-		// Find account by ID (for userinfo endpoint)
-		findAccount: async (_ctx: unknown, id: string) => ({
-			accountId: id,
-			claims: async () => ({
-				sub: id,
-				email: `${id}@loki.test`,
-				email_verified: true,
-				name: "Test User",
-			}),
-		}),
+		// Find account by ID (for userinfo endpoint). The login name becomes the
+		// subject, so names that aren't a valid sub have no account.
+		findAccount: async (_ctx: unknown, id: string) => {
+			if (subjectError(id, maxLength) !== undefined) {
+				return undefined;
+			}
+			return { accountId: id, claims: async () => accountClaims(id) };
+		},
 
 		// Allow insecure requests for local testing
 		renderError: async (ctx: { type: string; body: unknown }, out: unknown, _error: unknown) => {
@@ -109,6 +190,18 @@ export function createProvider(options: ProviderAdapterOptions): Provider {
 
 	const provider = new Provider(config.issuer, configuration);
 
+	// Exact matching against the registered URIs, unless mischief accepted this one
+	const { acceptRedirectUri } = options;
+	if (acceptRedirectUri) {
+		const client = provider.Client.prototype;
+		const redirectUriAllowed = client.redirectUriAllowed;
+		client.redirectUriAllowed = function (this: typeof client, redirectUri: string) {
+			return (
+				redirectUriAllowed.call(this, redirectUri) || acceptRedirectUri(this.clientId, redirectUri)
+			);
+		};
+	}
+
 	// Disable some security checks for local testing
 	// These would normally block http:// issuers
 	const originalProxyCheck = provider.proxy;
@@ -122,11 +215,41 @@ export function createProvider(options: ProviderAdapterOptions): Provider {
 	return provider;
 }
 
+/**
+ * Reject client registrations that OAuth 2.1 doesn't allow
+ */
+function assertOAuth21Clients(clients: ClientConfig[]): void {
+	for (const client of clients) {
+		const forbidden = (client.grant_types ?? []).filter((g) => OAUTH21_FORBIDDEN_GRANTS.includes(g));
+		if (forbidden.length > 0) {
+			throw new Error(
+				`Client '${client.client_id}' uses grant types removed in OAuth 2.1: ${forbidden.join(", ")}`,
+			);
+		}
+	}
+}
+
+/**
+ * Reject client registrations whose auth method and secret contradict each other
+ */
+function assertClientAuth(clients: ClientConfig[]): void {
+	for (const client of clients) {
+		const method = registeredAuthMethod(client);
+		if (method === "none" && client.grant_types?.includes("client_credentials")) {
+			throw new Error(`Public client '${client.client_id}' cannot use client_credentials`);
+		}
+		if (method !== "none" && !client.client_secret) {
+			throw new Error(`Client '${client.client_id}' uses ${method} but has no client_secret`);
+		}
+	}
+}
+
 /**
  * Convert our ClientConfig to oidc-provider's client format
  */
 function clientToOidcConfig(client: ClientConfig): ClientMetadata {
 	const grantTypes = client.grant_types ?? ["authorization_code"];
+	const authMethod = registeredAuthMethod(client);
 
 	// Determine response_types based on grant_types
 	// client_credentials only -> no response_types needed
@@ -134,20 +257,40 @@ function clientToOidcConfig(client: ClientConfig): ClientMetadata {
 	const needsCodeFlow = grantTypes.includes("authorization_code");
 	const responseTypes: ClientMetadata["response_types"] = needsCodeFlow ? ["code"] : [];
 
-	// redirect_uris required for authorization_code, not for client_credentials only
-	const redirectUris =
-		client.redirect_uris ?? (needsCodeFlow ? ["https://localhost/callback"] : []);
+	const redirectUris = registeredRedirectUris(client);
+
+	// Public clients are registered for client_credentials as well; Loki refuses
+	// them before the provider sees the request, unless mischief says otherwise.
+	// Token exchange is answered by Loki, so the provider never sees that grant
+	const providerGrants = grantTypes.filter((grant) => grant !== TOKEN_EXCHANGE_GRANT);
+	const registeredGrants =
+		authMethod === "none" ? [...providerGrants, "client_credentials"] : providerGrants;
+
+	// Loki verifies private_key_jwt assertions itself and hands the provider
+	// the client's secret in their place
+	const providerAuthMethod = authMethod === "private_key_jwt" ? "client_secret_basic" : authMethod;
 
 	return {
 		client_id: client.client_id,
 		client_secret: client.client_secret,
 		redirect_uris: redirectUris,
-		grant_types: grantTypes,
+		grant_types: registeredGrants,
 		response_types: responseTypes,
-		token_endpoint_auth_method: client.client_secret ? "client_secret_basic" : "none",
+		token_endpoint_auth_method: providerAuthMethod,
 	};
 }
 
+/**
+ * The redirect URIs a client is registered with
+ */
+export function registeredRedirectUris(client: ClientConfig): string[] {
+	// redirect_uris required for authorization_code, not for client_credentials only
+	const needsCodeFlow = (client.grant_types ?? ["authorization_code"]).includes(
+		"authorization_code",
+	);
+	return client.redirect_uris ?? (needsCodeFlow ? ["https://localhost/callback"] : []);
+}
+
 /**
  * Get the callback handler from the provider for use with Node's http server
  */
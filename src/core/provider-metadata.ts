@@ -0,0 +1,81 @@
+/**
+ * Provider Metadata - the OpenID and RFC 8414 discovery documents
+ *
+ * Clients find the provider through one of two documents:
+ * `/.well-known/openid-configuration` (OpenID Connect Discovery 1.0) or
+ * `/.well-known/oauth-authorization-server` (RFC 8414). Both are rendered
+ * from the same metadata, so they never drift apart unless mischief makes
+ * them: the RFC 8414 document is the OpenID one without the members only
+ * OpenID Connect defines (userinfo, ID token and session management).
+ */
+
+/** Provider metadata, as oidc-provider publishes it */
+export interface ProviderMetadata {
+	issuer: string;
+	[member: string]: unknown;
+}
+
+export type MetadataDocument = "openid-configuration" | "oauth-authorization-server";
+
+/** Where each document is served */
+export const METADATA_PATHS: Record<MetadataDocument, string> = {
+	"openid-configuration": "/.well-known/openid-configuration",
+	"oauth-authorization-server": "/.well-known/oauth-authorization-server",
+};
+
+/** Members only OpenID Connect Discovery and its extensions define */
+const OPENID_ONLY_MEMBERS = new Set([
+	"userinfo_endpoint",
+	"subject_types_supported",
+	"acr_values_supported",
+	"claims_supported",
+	"claim_types_supported",
+	"claims_parameter_supported",
+	"claims_locales_supported",
+	"display_values_supported",
+	"require_request_uri_registration",
+	"end_session_endpoint",
+	"check_session_iframe",
+]);
+
+/** Prefixes of OpenID-only member families */
+const OPENID_ONLY_PREFIXES = [
+	"userinfo_",
+	"id_token_",
+	"frontchannel_logout_",
+	"backchannel_logout_",
+];
+
+/**
+ * The document served at `path`, if it is one of the metadata documents
+ */
+export function metadataDocumentAt(path: string): MetadataDocument | undefined {
+	const documents = Object.keys(METADATA_PATHS) as MetadataDocument[];
+	return documents.find((document) => METADATA_PATHS[document] === path);
+}
+
+/**
+ * Render a metadata document
+ */
+export function renderMetadata(
+	metadata: ProviderMetadata,
+	document: MetadataDocument,
+): ProviderMetadata {
+	if (document === "openid-configuration") {
+		return { ...metadata };
+	}
+	const rendered: ProviderMetadata = { issuer: metadata.issuer };
+	for (const [member, value] of Object.entries(metadata)) {
+		if (!isOpenIdOnly(member)) {
+			rendered[member] = value;
+		}
+	}
+	return rendered;
+}
+
+function isOpenIdOnly(member: string): boolean {
+	return (
+		OPENID_ONLY_MEMBERS.has(member) ||
+		OPENID_ONLY_PREFIXES.some((prefix) => member.startsWith(prefix))
+	);
+}
@@ -0,0 +1,166 @@
+/**
+ * Provider Storage - the in-memory adapter oidc-provider keeps its models in
+ *
+ * Stands in for oidc-provider's built-in memory adapter so that clients
+ * can be looked up somewhere Loki controls: the provider asks the adapter
+ * for any client that isn't in its static config, and this one answers
+ * from Loki's client registry. Everything else (grants, codes, tokens,
+ * sessions, interactions) is kept here until it expires.
+ */
+
+import type { Adapter, AdapterPayload, ClientMetadata } from "oidc-provider";
+
+/** Upserts between sweeps for expired entries */
+const SWEEP_EVERY = 1000;
+
+interface StoredEntry {
+	value: unknown;
+	/** Epoch milliseconds; undefined for entries that don't expire */
+	expiresAt: number | undefined;
+}
+
+/**
+ * Provider Storage - one store shared by every model's adapter
+ */
+export class ProviderStorage {
+	private readonly entries = new Map<string, StoredEntry>();
+	private upserts = 0;
+
+	constructor(private readonly findClient: (clientId: string) => ClientMetadata | undefined) {}
+
+	/**
+	 * The adapter for one model, e.g. "AccessToken" or "Client"
+	 */
+	adapterFor(model: string): Adapter {
+		if (model === "Client") {
+			return new ClientAdapter(this.findClient);
+		}
+		return new ModelAdapter(this, model);
+	}
+
+	get(key: string): unknown {
+		const entry = this.entries.get(key);
+		if (entry?.expiresAt !== undefined && entry.expiresAt <= Date.now()) {
+			this.entries.delete(key);
+			return undefined;
+		}
+		return entry?.value;
+	}
+
+	set(key: string, value: unknown, expiresIn: number | undefined): void {
+		const expiresAt = expiresIn ? Date.now() + expiresIn * 1000 : undefined;
+		this.entries.set(key, { value, expiresAt });
+		this.upserts++;
+		if (this.upserts % SWEEP_EVERY === 0) {
+			this.sweep();
+		}
+	}
+
+	delete(key: string): void {
+		this.entries.delete(key);
+	}
+
+	private sweep(): void {
+		const now = Date.now();
+		for (const [key, entry] of this.entries) {
+			if (entry.expiresAt !== undefined && entry.expiresAt <= now) {
+				this.entries.delete(key);
+			}
+		}
+	}
+}
+
+/**
+ * A model's entries, indexed the way oidc-provider looks them up
+ */
+class ModelAdapter implements Adapter {
+	constructor(
+		private readonly storage: ProviderStorage,
+		private readonly model: string,
+	) {}
+
+	async upsert(id: string, payload: AdapterPayload, expiresIn: number): Promise<void> {
+		const key = this.key(id);
+		if (this.model === "Session" && payload.uid !== undefined) {
+			this.storage.set(`sessionUid:${payload.uid}`, id, expiresIn);
+		}
+		if (payload.grantId !== undefined) {
+			const grantKey = `grant:${payload.grantId}`;
+			const grant = this.storage.get(grantKey) as string[] | undefined;
+			if (grant) {
+				grant.push(key);
+			} else {
+				this.storage.set(grantKey, [key], expiresIn);
+			}
+		}
+		if (payload.userCode !== undefined) {
+			this.storage.set(`userCode:${payload.userCode}`, id, expiresIn);
+		}
+		this.storage.set(key, payload, expiresIn);
+	}
+
+	async find(id: string): Promise<AdapterPayload | undefined> {
+		return this.storage.get(this.key(id)) as AdapterPayload | undefined;
+	}
+
+	async findByUserCode(userCode: string): Promise<AdapterPayload | undefined> {
+		const id = this.storage.get(`userCode:${userCode}`) as string | undefined;
+		return id === undefined ? undefined : this.find(id);
+	}
+
+	async findByUid(uid: string): Promise<AdapterPayload | undefined> {
+		const id = this.storage.get(`sessionUid:${uid}`) as string | undefined;
+		return id === undefined ? undefined : this.find(id);
+	}
+
+	async consume(id: string): Promise<void> {
+		const payload = await this.find(id);
+		if (payload) {
+			payload.consumed = Math.floor(Date.now() / 1000);
+		}
+	}
+
+	async destroy(id: string): Promise<void> {
+		this.storage.delete(this.key(id));
+	}
+
+	async revokeByGrantId(grantId: string): Promise<void> {
+		const grantKey = `grant:${grantId}`;
+		const grant = this.storage.get(grantKey) as string[] | undefined;
+		for (const key of grant ?? []) {
+			this.storage.delete(key);
+		}
+		this.storage.delete(grantKey);
+	}
+
+	private key(id: string): string {
+		return `${this.model}:${id}`;
+	}
+}
+
+/**
+ * Clients, read from Loki's client registry; the provider never writes them
+ */
+class ClientAdapter implements Adapter {
+	constructor(private readonly findClient: (clientId: string) => ClientMetadata | undefined) {}
+
+	async find(id: string): Promise<AdapterPayload | undefined> {
+		return this.findClient(id) as AdapterPayload | undefined;
+	}
+
+	async upsert(): Promise<void> {}
+
+	async findByUserCode(): Promise<undefined> {
+		return undefined;
+	}
+
+	async findByUid(): Promise<undefined> {
+		return undefined;
+	}
+
+	async consume(): Promise<void> {}
+
+	async destroy(): Promise<void> {}
+
+	async revokeByGrantId(): Promise<void> {}
+}
@@ -0,0 +1,116 @@
+/**
+ * Random - the source of Loki's random choices
+ *
+ * Mischief variants, random and shuffled session picks, IDs, nonces,
+ * generated secrets and the signing keys Loki generates all draw from
+ * here. Unseeded, that's the platform's randomness. With a global seed
+ * (`--seed`, `LOKI_SEED` or `LokiConfig.seed`) it is a deterministic
+ * generator instead, SHA-256 in counter mode keyed by the seed, so a run
+ * sent the same requests in the same order makes the same choices and a
+ * CI failure can be replayed from its seed.
+ *
+ * The generator is per process: a seed set by one Loki applies to every
+ * Loki in it. Custom plugins should draw from `random()` rather than
+ * Math.random to be covered.
+ */
+
+import { createHash, randomBytes as cryptoRandomBytes } from "node:crypto";
+import { nanoid } from "nanoid";
+
+/** nanoid's alphabet, so seeded IDs look like unseeded ones */
+const ID_ALPHABET = "useandom-26T198340PX75pxJACKVERYMINDBUSHWOLF_GQZbfghjklqvwyzrict";
+
+/** Math.random as loaded, since fixtures swap in random() while they generate */
+const mathRandom = Math.random;
+
+/**
+ * SHA-256 of the seed's key and a block counter, read out byte by byte
+ */
+class SeededGenerator {
+	private readonly key: Buffer;
+	private counter = 0;
+	private pool = Buffer.alloc(0);
+
+	constructor(seed: string) {
+		this.key = createHash("sha256").update(seed).digest();
+	}
+
+	bytes(size: number): Buffer {
+		while (this.pool.length < size) {
+			const block = createHash("sha256").update(this.key).update(String(this.counter++)).digest();
+			this.pool = Buffer.concat([this.pool, block]);
+		}
+		const out = Buffer.from(this.pool.subarray(0, size));
+		this.pool = this.pool.subarray(size);
+		return out;
+	}
+}
+
+let seeded: SeededGenerator | undefined;
+
+/**
+ * Seed the generator, or go back to the platform's randomness with
+ * undefined; returns a function restoring the previous generator
+ */
+export function seedRandom(seed: string | undefined): () => void {
+	const previous = seeded;
+	seeded = seed === undefined ? undefined : new SeededGenerator(seed);
+	return () => {
+		seeded = previous;
+	};
+}
+
+/**
+ * Whether random choices currently come from a seed
+ */
+export function isSeeded(): boolean {
+	return seeded !== undefined;
+}
+
+/**
+ * A value in [0, 1), like Math.random
+ */
+export function random(): number {
+	return seeded ? seeded.bytes(4).readUInt32BE(0) / 0x100000000 : mathRandom();
+}
+
+/**
+ * An integer in [0, max)
+ */
+export function randomInt(max: number): number {
+	return Math.floor(random() * max);
+}
+
+/**
+ * `size` random bytes
+ */
+export function randomBytes(size: number): Buffer {
+	return seeded ? seeded.bytes(size) : cryptoRandomBytes(size);
+}
+
+/**
+ * A URL-safe ID of `size` characters, as nanoid makes them
+ */
+export function randomId(size: number): string {
+	if (!seeded) {
+		return nanoid(size);
+	}
+	return [...seeded.bytes(size)].map((byte) => ID_ALPHABET[byte & 63]).join("");
+}
+
+/**
+ * A version 4 UUID
+ */
+export function randomUUID(): string {
+	const bytes = randomBytes(16);
+	bytes[6] = ((bytes[6] ?? 0) & 0x0f) | 0x40;
+	bytes[8] = ((bytes[8] ?? 0) & 0x3f) | 0x80;
+	const hex = bytes.toString("hex");
+	return [
+		hex.slice(0, 8),
+		hex.slice(8, 12),
+		hex.slice(12, 16),
+		hex.slice(16, 20),
+		hex.slice(20),
+	].join("-");
+}
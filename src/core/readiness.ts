@@ -0,0 +1,39 @@
+/**
+ * Readiness - liveness and readiness probes
+ *
+ * Orchestrators probe Loki at `/healthz` (is the process alive?) and
+ * `/readyz` (can it mint tokens?). Loki listens as soon as it starts, so
+ * both are answered while it is still generating or loading its signing
+ * keys and connecting its session store; `/readyz` answers 503 until every
+ * component is ready, and every other endpoint turns requests away until
+ * then, so a load balancer never routes traffic to a replica that can't
+ * serve it. A shared store whose connection drops makes the replica
+ * unready again.
+ *
+ * Probes are answered before anything else: no admin token, no request
+ * metrics, logging or HAR capture.
+ */
+
+/** A component's state; disabled components don't hold readiness up */
+export type ComponentStatus = "pending" | "ready" | "disabled" | "down";
+
+export interface ComponentState {
+	status: ComponentStatus;
+	[detail: string]: unknown;
+}
+
+/** The body /readyz answers with */
+export interface ReadinessReport {
+	status: "ready" | "not_ready";
+	components: Record<string, ComponentState>;
+}
+
+/**
+ * The readiness of a set of components: ready when each one is ready or disabled
+ */
+export function readinessReport(components: Record<string, ComponentState>): ReadinessReport {
+	const ready = Object.values(components).every(
+		(component) => component.status === "ready" || component.status === "disabled",
+	);
+	return { status: ready ? "ready" : "not_ready", components };
+}
@@ -0,0 +1,60 @@
+/**
+ * Redirect URI - exact matching at the authorization endpoint
+ *
+ * A `redirect_uri` must be one of the client's registered URIs, compared as
+ * plain strings: no wildcards, no prefix or path matching (RFC 9700 Section
+ * 4.1.3). The provider enforces this and refuses a mismatch with
+ * `400 invalid_redirect_uri`, so an authorization response never reaches an
+ * unregistered URI. For sessions, Loki checks first and records each
+ * mismatch; mischief can accept one, and the provider then lets that client
+ * redirect there until an authorization started now would have finished:
+ * through login, consent and the code's redirect.
+ */
+
+/** How long an accepted unregistered redirect URI stays accepted: the code lifetime */
+const ACCEPTED_TTL_MS = 600_000;
+
+/** A redirect URI the client didn't register */
+export interface RedirectUriCheck {
+	requested: string;
+	/** The client's registered redirect URIs */
+	registered: string[];
+}
+
+/**
+ * Whether a redirect URI is registered, by exact string comparison
+ */
+export function redirectUriRegistered(registered: readonly string[], requested: string): boolean {
+	return registered.includes(requested);
+}
+
+/**
+ * Unregistered redirect URIs mischief has accepted, per client, until they lapse
+ */
+export class AcceptedRedirectUris {
+	private readonly accepted = new Map<string, number>();
+
+	accept(clientId: string, redirectUri: string, now = Date.now()): void {
+		this.accepted.set(key(clientId, redirectUri), now + ACCEPTED_TTL_MS);
+	}
+
+	has(clientId: string, redirectUri: string, now = Date.now()): boolean {
+		const expiresAt = this.accepted.get(key(clientId, redirectUri));
+		if (expiresAt === undefined) {
+			return false;
+		}
+		if (expiresAt <= now) {
+			this.accepted.delete(key(clientId, redirectUri));
+			return false;
+		}
+		return true;
+	}
+
+	clearAll(): void {
+		this.accepted.clear();
+	}
+}
+
+function key(clientId: string, redirectUri: string): string {
+	return JSON.stringify([clientId, redirectUri]);
+}
@@ -0,0 +1,172 @@
+/**
+ * Refresh Ledger - per-session rotation history for opaque refresh tokens
+ *
+ * Session token requests rotate refresh tokens: each use consumes the
+ * presented token and issues a successor. Loki records every rotation so it
+ * can recognise a rotated token when it is presented again. By default the
+ * reuse is left to oidc-provider, which revokes the whole grant (the
+ * revocation cascade of RFC 9700 Section 4.14.2); mischief can instead
+ * accept the reuse by swapping in the chain's current token.
+ *
+ * Every refresh token a session issues stays bound to that session, so a
+ * refresh grant presenting it is handled by the session (and its mischief)
+ * even when the client doesn't send the session header.
+ */
+
+/** Rotations and reuses kept per session */
+const MAX_RECORDS = 1000;
+
+export interface RefreshRotation {
+	/** The refresh token presented (and consumed) */
+	from: string;
+	/** The refresh token issued in its place */
+	to: string;
+	rotatedAt: string;
+}
+
+export interface RefreshReuse {
+	/** The already-rotated refresh token that was presented again */
+	token: string;
+	/** The newest token in its rotation chain when the reuse was detected */
+	current: string;
+	/** Whether the reuse was silently accepted instead of revoking the grant */
+	accepted: boolean;
+	detectedAt: string;
+}
+
+export interface RefreshLedgerReport {
+	sessionId: string;
+	rotations: RefreshRotation[];
+	reuses: RefreshReuse[];
+}
+
+interface SessionRefreshLedger {
+	/** Tokens bound to the session, oldest first */
+	issued: string[];
+	successors: Map<string, string>;
+	rotations: RefreshRotation[];
+	reuses: RefreshReuse[];
+}
+
+/**
+ * Whether a refresh token is opaque (not a JWS compact serialization)
+ */
+export function isOpaqueRefreshToken(token: string): boolean {
+	return token.length > 0 && token.split(".").length !== 3;
+}
+
+/**
+ * Rotation history of opaque refresh tokens, per session
+ */
+export class RefreshLedger {
+	private readonly sessions = new Map<string, SessionRefreshLedger>();
+	/** The session each bound token was issued in */
+	private readonly owners = new Map<string, string>();
+
+	/**
+	 * Bind a refresh token the session issued to it
+	 */
+	issue(sessionId: string, token: string): void {
+		if (this.owners.has(token)) {
+			return;
+		}
+		const ledger = this.ledger(sessionId);
+		this.owners.set(token, sessionId);
+		ledger.issued.push(token);
+		if (ledger.issued.length > MAX_RECORDS) {
+			const evicted = ledger.issued.shift();
+			if (evicted !== undefined) {
+				this.owners.delete(evicted);
+			}
+		}
+	}
+
+	/**
+	 * The session a refresh token was issued in; undefined if it isn't bound
+	 */
+	sessionFor(token: string): string | undefined {
+		return this.owners.get(token);
+	}
+
+	/**
+	 * Record that `from` was consumed and `to` issued in its place
+	 */
+	rotate(sessionId: string, from: string, to: string): void {
+		if (from === to) {
+			return;
+		}
+		const ledger = this.ledger(sessionId);
+		ledger.successors.set(from, to);
+		push(ledger.rotations, { from, to, rotatedAt: new Date().toISOString() });
+	}
+
+	/**
+	 * The newest token in a rotated token's chain; undefined if the token
+	 * was never rotated in this session
+	 */
+	currentFor(sessionId: string, token: string): string | undefined {
+		const successors = this.sessions.get(sessionId)?.successors;
+		let current = successors?.get(token);
+		if (current === undefined) {
+			return undefined;
+		}
+		// Chains never loop (every successor is freshly issued); the bound is defensive
+		for (let hops = 0; hops < MAX_RECORDS; hops++) {
+			const next = successors?.get(current);
+			if (next === undefined) {
+				break;
+			}
+			current = next;
+		}
+		return current;
+	}
+
+	/**
+	 * Record a rotated token being presented again
+	 */
+	recordReuse(sessionId: string, token: string, current: string, accepted: boolean): void {
+		push(this.ledger(sessionId).reuses, {
+			token,
+			current,
+			accepted,
+			detectedAt: new Date().toISOString(),
+		});
+	}
+
+	getReport(sessionId: string): RefreshLedgerReport {
+		const ledger = this.sessions.get(sessionId);
+		return {
+			sessionId,
+			rotations: [...(ledger?.rotations ?? [])],
+			reuses: [...(ledger?.reuses ?? [])],
+		};
+	}
+
+	clear(sessionId: string): void {
+		for (const token of this.sessions.get(sessionId)?.issued ?? []) {
+			this.owners.delete(token);
+		}
+		this.sessions.delete(sessionId);
+	}
+
+	clearAll(): void {
+		this.sessions.clear();
+		this.owners.clear();
+	}
+
+	private ledger(sessionId: string): SessionRefreshLedger {
+		let ledger = this.sessions.get(sessionId);
+		if (!ledger) {
+			ledger = { issued: [], successors: new Map(), rotations: [], reuses: [] };
+			this.sessions.set(sessionId, ledger);
+		}
+		return ledger;
+	}
+}
+
+function push<T>(records: T[], record: T): void {
+	records.push(record);
+	if (records.length > MAX_RECORDS) {
+		records.shift();
+	}
+}
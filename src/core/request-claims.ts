@@ -0,0 +1,189 @@
+/**
+ * Request Claims - the `claims` authorization request parameter
+ *
+ * A client can ask for individual claims rather than whole scopes with the
+ * `claims` parameter (OIDC Core Section 5.5): a JSON object whose
+ * `id_token` and `userinfo` members name the claims wanted in each, any of
+ * them marked `essential`. For sessions, the request each client sends to
+ * the authorization endpoint is remembered until it sends another. Loki
+ * adds the requested claims the account holds to the client's ID tokens
+ * and userinfo responses, so a requested claim that's missing is mischief.
+ *
+ * An authorization server doesn't fail the request when it can't deliver
+ * an essential claim (Section 5.5.1); it's the client that must notice. The
+ * session's attack report shows the claims requested, those marked
+ * essential and those the ID token was sent with.
+ */
+
+import { isPlainObject } from "./session-spec.js";
+
+/** How one claim was requested; every member is optional */
+export interface ClaimRequest {
+	essential?: boolean;
+	value?: unknown;
+	values?: unknown[];
+}
+
+/** The claims requested for one destination, by name */
+export type RequestedClaims = Record<string, ClaimRequest>;
+
+/** A parsed `claims` parameter: what the ID token and userinfo should carry */
+export interface ClaimsRequest {
+	idToken: RequestedClaims;
+	userinfo: RequestedClaims;
+}
+
+/** Requested claims set against those a token or response carries */
+export interface ClaimsDelivery {
+	requested: string[];
+	essential: string[];
+	delivered: string[];
+}
+
+/**
+ * Parse a `claims` parameter; a string is why it's invalid
+ */
+export function parseClaimsRequest(raw: string): ClaimsRequest | string {
+	let parsed: unknown;
+	try {
+		parsed = JSON.parse(raw);
+	} catch {
+		return "claims must be a JSON object";
+	}
+	if (!isPlainObject(parsed)) {
+		return "claims must be a JSON object";
+	}
+	const idToken = parseMember(parsed.id_token, "id_token");
+	if (typeof idToken === "string") {
+		return idToken;
+	}
+	const userinfo = parseMember(parsed.userinfo, "userinfo");
+	if (typeof userinfo === "string") {
+		return userinfo;
+	}
+	return { idToken, userinfo };
+}
+
+/**
+ * Parse the `id_token` or `userinfo` member: each claim maps to null or
+ * an object of `essential`, `value` and `values` (Section 5.5.1)
+ */
+function parseMember(member: unknown, name: string): RequestedClaims | string {
+	if (member === undefined) {
+		return {};
+	}
+	if (!isPlainObject(member)) {
+		return `claims.${name} must be an object`;
+	}
+	const requested: RequestedClaims = {};
+	for (const [claim, request] of Object.entries(member)) {
+		if (claim === "__proto__") {
+			continue;
+		}
+		if (request === null) {
+			requested[claim] = {};
+			continue;
+		}
+		if (!isPlainObject(request)) {
+			return `claims.${name}.${claim} must be null or an object`;
+		}
+		if (request.essential !== undefined && typeof request.essential !== "boolean") {
+			return `claims.${name}.${claim}.essential must be a boolean`;
+		}
+		if (request.values !== undefined && !Array.isArray(request.values)) {
+			return `claims.${name}.${claim}.values must be an array`;
+		}
+		const parsed: ClaimRequest = {};
+		if (request.essential !== undefined) {
+			parsed.essential = request.essential;
+		}
+		if ("value" in request) {
+			parsed.value = request.value;
+		}
+		if (Array.isArray(request.values)) {
+			parsed.values = request.values;
+		}
+		requested[claim] = parsed;
+	}
+	return requested;
+}
+
+/**
+ * The names of the claims marked essential
+ */
+export function essentialClaims(requested: RequestedClaims): string[] {
+	return Object.entries(requested)
+		.filter(([, request]) => request.essential === true)
+		.map(([claim]) => claim);
+}
+
+/**
+ * Add the requested claims the account holds to those already released,
+ * leaving released ones as they are
+ */
+export function withRequestedClaims(
+	released: Record<string, unknown>,
+	subjectClaims: Record<string, unknown>,
+	requested: RequestedClaims,
+): Record<string, unknown> {
+	const claims = { ...released };
+	for (const claim of Object.keys(requested)) {
+		if (!(claim in claims) && Object.hasOwn(subjectClaims, claim)) {
+			claims[claim] = subjectClaims[claim];
+		}
+	}
+	return claims;
+}
+
+/**
+ * Which requested claims `claims` carries
+ */
+export function claimsDelivery(
+	requested: RequestedClaims,
+	claims: Record<string, unknown>,
+): ClaimsDelivery {
+	const names = Object.keys(requested);
+	return {
+		requested: names,
+		essential: essentialClaims(requested),
+		delivered: names.filter((claim) => claims[claim] !== undefined),
+	};
+}
+
+/**
+ * The claims request each client last sent, per session
+ */
+export class ClaimsRequests {
+	private readonly sessions = new Map<string, Map<string, ClaimsRequest>>();
+
+	/**
+	 * Remember a client's claims request; a request without one forgets any earlier one
+	 */
+	request(sessionId: string, clientId: string, request: ClaimsRequest | undefined): void {
+		let clients = this.sessions.get(sessionId);
+		if (request === undefined) {
+			clients?.delete(clientId);
+			return;
+		}
+		if (!clients) {
+			clients = new Map();
+			this.sessions.set(sessionId, clients);
+		}
+		clients.set(clientId, request);
+	}
+
+	/**
+	 * The claims the client's ID tokens and userinfo responses should carry
+	 */
+	get(sessionId: string, clientId: string): ClaimsRequest | undefined {
+		return this.sessions.get(sessionId)?.get(clientId);
+	}
+
+	clear(sessionId: string): void {
+		this.sessions.delete(sessionId);
+	}
+
+	clearAll(): void {
+		this.sessions.clear();
+	}
+}
@@ -0,0 +1,81 @@
+/**
+ * Request ID - a correlation ID for every request Loki serves
+ *
+ * A request keeps the `X-Request-ID` (or `X-Loki-Request-Id`) it arrived
+ * with, if it has a usable one, and is given a fresh one otherwise. Loki
+ * echoes the ID in both headers of the response and stamps it on the log
+ * lines, ledger entries, session events and issued tokens the request
+ * produced, so a client that logs the ID of a rejected response leads an
+ * operator straight to the issuance behind it. Mischief may tamper with
+ * the `X-Request-ID` echo; `X-Loki-Request-Id` always carries the real ID.
+ *
+ * The current request's ID is carried through async work, so code deep in
+ * a request (or in oidc-provider's callbacks) can read it without it being
+ * passed along.
+ */
+
+import { AsyncLocalStorage } from "node:async_hooks";
+import type { IncomingMessage } from "node:http";
+import type { LedgerEntry } from "../ledger/types.js";
+import type { SessionEvent } from "./event-log.js";
+import { randomId } from "./random.js";
+import type { IssuedToken } from "./token-results.js";
+
+export const REQUEST_ID_HEADER = "X-Request-ID";
+
+/** Loki's own correlation header, which mischief never touches */
+export const LOKI_REQUEST_ID_HEADER = "X-Loki-Request-Id";
+
+/** Visible ASCII, short enough to log; anything else is replaced */
+const USABLE_REQUEST_ID = /^[\x21-\x7e]{1,128}$/;
+
+const requestIds = new AsyncLocalStorage<string>();
+
+/**
+ * Everything Loki recorded for one request, across sessions
+ */
+export interface RequestTrace {
+	requestId: string;
+	ledger: (LedgerEntry & { sessionId: string })[];
+	events: SessionEvent[];
+	tokens: (IssuedToken & { sessionId: string })[];
+}
+
+/**
+ * The request's own X-Request-ID (or X-Loki-Request-Id) if it's usable,
+ * otherwise a new ID
+ */
+export function resolveRequestId(req: IncomingMessage): string {
+	for (const name of ["x-request-id", "x-loki-request-id"]) {
+		const header = req.headers[name];
+		if (typeof header === "string" && USABLE_REQUEST_ID.test(header)) {
+			return header;
+		}
+	}
+	return newRequestId();
+}
+
+export function newRequestId(): string {
+	return `req_${randomId(12)}`;
+}
+
+/**
+ * Run `fn` (and everything it starts) as part of the request with this ID
+ */
+export function withRequestId<T>(requestId: string, fn: () => T): T {
+	return requestIds.run(requestId, fn);
+}
+
+/**
+ * The ID of the request being served, or a new one outside a request
+ */
+export function currentRequestId(): string {
+	return requestIds.getStore() ?? newRequestId();
+}
+
+/**
+ * The ID of the request being served, if there is one
+ */
+export function activeRequestId(): string | undefined {
+	return requestIds.getStore();
+}
@@ -0,0 +1,56 @@
+/**
+ * Request Nonce - the nonce an ID token must echo
+ *
+ * An OIDC client binds its ID token to its authentication request with a
+ * `nonce` (OIDC Core Section 3.1.2.1), and must reject an ID token whose
+ * `nonce` claim doesn't match it. For sessions, the nonce each client sends
+ * to the authorization endpoint is remembered until its next ID token is
+ * issued at the token endpoint; a `nonce` on the token request itself
+ * takes its place. Loki reflects the expected nonce into that ID token, so
+ * any difference the client sees is mischief, and the session's attack
+ * report shows the expected nonce next to the one actually sent.
+ *
+ * ID tokens issued straight from the authorization endpoint (implicit and
+ * hybrid flows) are left to the provider, which echoes the nonce itself.
+ */
+
+/**
+ * The nonce each client last requested, per session, until its ID token is issued
+ */
+export class NonceRequests {
+	private readonly sessions = new Map<string, Map<string, string>>();
+
+	/**
+	 * Remember a client's nonce; a request without one forgets any earlier nonce
+	 */
+	request(sessionId: string, clientId: string, nonce: string | undefined): void {
+		let clients = this.sessions.get(sessionId);
+		if (nonce === undefined) {
+			clients?.delete(clientId);
+			return;
+		}
+		if (!clients) {
+			clients = new Map();
+			this.sessions.set(sessionId, clients);
+		}
+		clients.set(clientId, nonce);
+	}
+
+	/**
+	 * The nonce the client's next ID token must carry
+	 */
+	take(sessionId: string, clientId: string): string | undefined {
+		const clients = this.sessions.get(sessionId);
+		const nonce = clients?.get(clientId);
+		clients?.delete(clientId);
+		return nonce;
+	}
+
+	clear(sessionId: string): void {
+		this.sessions.delete(sessionId);
+	}
+
+	clearAll(): void {
+		this.sessions.clear();
+	}
+}
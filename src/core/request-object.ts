@@ -0,0 +1,57 @@
+/**
+ * Request Objects - single-use enforcement for signed JAR request objects
+ *
+ * oidc-provider verifies a request object's signature but doesn't remember
+ * it, so a captured `request` parameter can be replayed to start the same
+ * authorization again. Loki remembers each session's request-object `jti`
+ * values and refuses one it has already seen (RFC 9101 Section 10.8).
+ */
+
+import * as jose from "jose";
+
+/**
+ * The jti of a signed request object; undefined if unsigned, malformed or absent
+ */
+export function requestObjectJti(requestObject: string): string | undefined {
+	try {
+		const header = jose.decodeProtectedHeader(requestObject);
+		if (!header.alg || header.alg === "none") {
+			return undefined;
+		}
+		const { jti } = jose.decodeJwt(requestObject);
+		return typeof jti === "string" && jti.length > 0 ? jti : undefined;
+	} catch {
+		return undefined;
+	}
+}
+
+/**
+ * Request-object jti values seen per session
+ */
+export class RequestObjectReplayCache {
+	private readonly seen = new Map<string, Set<string>>();
+
+	/**
+	 * Remember a jti for the session; returns true if it was already used
+	 */
+	use(sessionId: string, jti: string): boolean {
+		let jtis = this.seen.get(sessionId);
+		if (!jtis) {
+			jtis = new Set();
+			this.seen.set(sessionId, jtis);
+		}
+		if (jtis.has(jti)) {
+			return true;
+		}
+		jtis.add(jti);
+		return false;
+	}
+
+	clear(sessionId: string): void {
+		this.seen.delete(sessionId);
+	}
+
+	clearAll(): void {
+		this.seen.clear();
+	}
+}
@@ -0,0 +1,90 @@
+/**
+ * Request Resource - the resource indicators a token request names
+ *
+ * A client asks for an access token meant for specific resource servers by
+ * sending one or more `resource` parameters to the token endpoint (RFC 8707
+ * Section 2), and a resource server must reject tokens whose `aud` doesn't
+ * name it. For sessions, Loki takes the resources each client sends to the
+ * token endpoint over from the provider, which would refuse more than one:
+ * they are remembered until the client's access token is issued, and
+ * become its `aud`, a single resource as a string and several as an array.
+ * The session's attack report shows the requested audience next to the
+ * `aud` the token was actually sent with.
+ */
+
+/** The audience of access tokens whose client names no resource */
+export const DEFAULT_RESOURCE = "https://loki.test/api";
+
+/**
+ * The `resource` parameters in a form-encoded body, each listed once, in
+ * the order first given
+ */
+export function parseResources(body: Buffer): string[] {
+	return [...new Set(new URLSearchParams(body.toString()).getAll("resource"))];
+}
+
+/**
+ * A form-encoded body without its `resource` parameters
+ */
+export function withoutResources(body: Buffer): Buffer {
+	const form = new URLSearchParams(body.toString());
+	form.delete("resource");
+	return Buffer.from(form.toString());
+}
+
+/**
+ * The first resource that isn't an absolute URI without a fragment
+ * (RFC 8707 Section 2), if any
+ */
+export function invalidResource(resources: string[]): string | undefined {
+	return resources.find((resource) => !URL.canParse(resource) || resource.includes("#"));
+}
+
+/**
+ * The `aud` a token for `resources` carries: a single resource as is,
+ * several as an array
+ */
+export function resourceAudience(resources: string[]): string | string[] {
+	return resources.length === 1 ? (resources[0] as string) : resources;
+}
+
+/**
+ * The resources each client last requested, per session, until its access token is issued
+ */
+export class ResourceRequests {
+	private readonly sessions = new Map<string, Map<string, string[]>>();
+
+	/**
+	 * Remember a client's resources; a request without any forgets earlier ones
+	 */
+	request(sessionId: string, clientId: string, resources: string[]): void {
+		let clients = this.sessions.get(sessionId);
+		if (resources.length === 0) {
+			clients?.delete(clientId);
+			return;
+		}
+		if (!clients) {
+			clients = new Map();
+			this.sessions.set(sessionId, clients);
+		}
+		clients.set(clientId, resources);
+	}
+
+	/**
+	 * The resources the client's next access token is for
+	 */
+	take(sessionId: string, clientId: string): string[] | undefined {
+		const clients = this.sessions.get(sessionId);
+		const resources = clients?.get(clientId);
+		clients?.delete(clientId);
+		return resources;
+	}
+
+	clear(sessionId: string): void {
+		this.sessions.delete(sessionId);
+	}
+
+	clearAll(): void {
+		this.sessions.clear();
+	}
+}
@@ -0,0 +1,60 @@
+/**
+ * Request Scope - the scope a token request asked for
+ *
+ * oidc-provider only puts scopes its resource server knows into access
+ * tokens, and drops the rest of a token request's `scope` without a word.
+ * For sessions, Loki grants what the client asked for instead: the scopes
+ * each client sends to the token endpoint are remembered until its access
+ * token is issued, and become that token's `scope` claim and the token
+ * response's `scope` (RFC 6749 Section 3.3). Introspection then reports
+ * the scope granted, whatever mischief later does to the token's claim.
+ */
+
+/**
+ * The scopes in a `scope` parameter: space-delimited, case-sensitive,
+ * each listed once, in the order first given
+ */
+export function parseScope(scope: string): string[] {
+	return [...new Set(scope.split(" ").filter(Boolean))];
+}
+
+/**
+ * The scopes each client last requested, per session, until its access token is issued
+ */
+export class ScopeRequests {
+	private readonly sessions = new Map<string, Map<string, string[]>>();
+
+	/**
+	 * Remember a client's scopes; a request without any forgets earlier ones
+	 */
+	request(sessionId: string, clientId: string, scopes: string[]): void {
+		let clients = this.sessions.get(sessionId);
+		if (scopes.length === 0) {
+			clients?.delete(clientId);
+			return;
+		}
+		if (!clients) {
+			clients = new Map();
+			this.sessions.set(sessionId, clients);
+		}
+		clients.set(clientId, scopes);
+	}
+
+	/**
+	 * The scopes the client's next access token is granted
+	 */
+	take(sessionId: string, clientId: string): string[] | undefined {
+		const clients = this.sessions.get(sessionId);
+		const scopes = clients?.get(clientId);
+		clients?.delete(clientId);
+		return scopes;
+	}
+
+	clear(sessionId: string): void {
+		this.sessions.delete(sessionId);
+	}
+
+	clearAll(): void {
+		this.sessions.clear();
+	}
+}
@@ -0,0 +1,49 @@
+/**
+ * Response Mode - how the authorization endpoint delivers its response
+ *
+ * oidc-provider answers `/authorize` in the `response_mode` the client
+ * asks for: `query` redirects with the code in the redirect URI's query
+ * string, `fragment` puts it in the URL fragment, and `form_post` answers
+ * with an HTML page whose form POSTs the response to the redirect URI as
+ * soon as it loads. Without one, a response type returning only a code
+ * uses `query` and any other `fragment` (OAuth 2.0 Multiple Response Type
+ * Encoding Practices, Section 5).
+ *
+ * Mischief may send the response in another mode than the one requested,
+ * by rewriting the request before the provider sees it.
+ */
+
+export const RESPONSE_MODES = ["query", "fragment", "form_post"] as const;
+
+export type ResponseMode = (typeof RESPONSE_MODES)[number];
+
+export function isResponseMode(value: unknown): value is ResponseMode {
+	return RESPONSE_MODES.includes(value as ResponseMode);
+}
+
+/**
+ * The mode a response type is delivered in when the request names none
+ */
+export function defaultResponseMode(responseType: string | undefined): ResponseMode {
+	return responseType === undefined || responseType === "code" || responseType === "none"
+		? "query"
+		: "fragment";
+}
+
+/**
+ * Whether a mode can carry a response type's response; tokens never go in
+ * the query string (OAuth 2.0 Multiple Response Type Encoding Practices, Section 3)
+ */
+export function modeCarries(mode: ResponseMode, responseType: string | undefined): boolean {
+	return mode !== "query" || defaultResponseMode(responseType) === "query";
+}
+
+/**
+ * Set an authorization URL's `response_mode`
+ */
+export function withResponseMode(url: string, mode: ResponseMode): string {
+	const [path, query = ""] = url.split("?", 2) as [string, string?];
+	const params = new URLSearchParams(query);
+	params.set("response_mode", mode);
+	return `${path}?${params}`;
+}
@@ -0,0 +1,188 @@
+/**
+ * Revocation List - CRL-style list of revoked token identifiers
+ *
+ * Some architectures have resource servers poll a published list of revoked
+ * `jti`s instead of introspecting every token. Loki records every successful
+ * revocation and publishes the list at /revocations, either as plain JSON or
+ * as a JWT signed with the active key. Tokens are revoked through the
+ * provider's /token/revocation or Loki's own /revoke (RFC 7009), which
+ * answers 200 for any token, known or not, once the client authenticates.
+ *
+ * Mischief can make the list disagree with what /revoke reported: a revoked
+ * token is omitted (or only listed after a delay), so a resource server that
+ * trusts the list keeps accepting it.
+ */
+
+import * as jose from "jose";
+import type { ManagedKey } from "./key-manager.js";
+
+export type RevocationListFormat = "json" | "jwt";
+
+export interface RevocationRecord {
+	jti: string;
+	revokedAt: Date;
+	sessionId?: string;
+	/** When the jti appears in the published list; null means never */
+	listedFrom: Date | null;
+}
+
+export interface RevocationReport {
+	listed: { jti: string; revokedAt: string; sessionId?: string }[];
+	omitted: { jti: string; revokedAt: string; sessionId?: string; listedFrom: string | null }[];
+}
+
+export interface RevocationListOptions {
+	issuer: string;
+	getSigningKey: () => ManagedKey;
+	/** Clock override, in epoch milliseconds (for tests) */
+	now?: () => number;
+}
+
+/** The path Loki serves its own revocation endpoint at */
+export const REVOCATION_PATH = "/revoke";
+
+/** Upper bound on recorded revocations */
+const MAX_RECORDS = 10000;
+
+/**
+ * Extract the identifier a revocation list uses for a token
+ *
+ * JWTs are identified by their `jti`; opaque tokens from oidc-provider are
+ * their own identifier.
+ */
+export function tokenIdentifier(token: string): string {
+	if (token.split(".").length === 3) {
+		try {
+			const { jti } = jose.decodeJwt(token);
+			if (typeof jti === "string") {
+				return jti;
+			}
+		} catch {
+			// Not a decodable JWT, fall through
+		}
+	}
+	return token;
+}
+
+export class RevocationList {
+	private readonly issuer: string;
+	private readonly getSigningKey: () => ManagedKey;
+	private readonly now: () => number;
+	private readonly records = new Map<string, RevocationRecord>(); // jti -> record
+
+	constructor(options: RevocationListOptions) {
+		this.issuer = options.issuer;
+		this.getSigningKey = options.getSigningKey;
+		this.now = options.now ?? Date.now;
+	}
+
+	/**
+	 * Record a successful revocation
+	 *
+	 * @param listAfterSeconds - 0 lists immediately, null never lists
+	 */
+	revoke(jti: string, sessionId?: string, listAfterSeconds: number | null = 0): RevocationRecord {
+		const revokedAt = new Date(this.now());
+		const record: RevocationRecord = {
+			jti,
+			revokedAt,
+			listedFrom:
+				listAfterSeconds === null
+					? null
+					: new Date(revokedAt.getTime() + listAfterSeconds * 1000),
+		};
+		if (sessionId !== undefined) {
+			record.sessionId = sessionId;
+		}
+
+		this.records.delete(jti);
+		this.records.set(jti, record);
+		if (this.records.size > MAX_RECORDS) {
+			const oldest = this.records.keys().next().value;
+			if (oldest !== undefined) {
+				this.records.delete(oldest);
+			}
+		}
+
+		return record;
+	}
+
+	/**
+	 * Whether a token was revoked, listed yet or not
+	 */
+	isRevoked(jti: string): boolean {
+		return this.records.has(jti);
+	}
+
+	/**
+	 * Records currently visible in the published list
+	 */
+	published(): RevocationRecord[] {
+		const at = this.now();
+		return [...this.records.values()].filter(
+			(r) => r.listedFrom !== null && r.listedFrom.getTime() <= at,
+		);
+	}
+
+	/**
+	 * Render the published list
+	 */
+	async render(format: RevocationListFormat): Promise<{ contentType: string; body: string }> {
+		const revoked = this.published().map((r) => ({
+			jti: r.jti,
+			revoked_at: Math.floor(r.revokedAt.getTime() / 1000),
+		}));
+
+		if (format === "jwt") {
+			const key = this.getSigningKey();
+			const jwt = await new jose.SignJWT({ revoked })
+				.setProtectedHeader({ alg: key.alg, kid: key.kid, typ: "revocation-list+jwt" })
+				.setIssuer(this.issuer)
+				.setIssuedAt(Math.floor(this.now() / 1000))
+				.sign(key.privateKey);
+			return { contentType: "application/jwt", body: jwt };
+		}
+
+		return {
+			contentType: "application/json",
+			body: JSON.stringify({
+				iss: this.issuer,
+				updated_at: Math.floor(this.now() / 1000),
+				revoked,
+			}),
+		};
+	}
+
+	/**
+	 * Revoked-and-listed vs revoked-but-omitted, optionally for one session
+	 */
+	getReport(sessionId?: string): RevocationReport {
+		const at = this.now();
+		const report: RevocationReport = { listed: [], omitted: [] };
+
+		for (const r of this.records.values()) {
+			if (sessionId !== undefined && r.sessionId !== sessionId) {
+				continue;
+			}
+			const base = {
+				jti: r.jti,
+				revokedAt: r.revokedAt.toISOString(),
+				...(r.sessionId !== undefined ? { sessionId: r.sessionId } : {}),
+			};
+			if (r.listedFrom !== null && r.listedFrom.getTime() <= at) {
+				report.listed.push(base);
+			} else {
+				report.omitted.push({ ...base, listedFrom: r.listedFrom?.toISOString() ?? null });
+			}
+		}
+
+		return report;
+	}
+
+	/**
+	 * Forget all revocations
+	 */
+	clear(): void {
+		this.records.clear();
+	}
+}
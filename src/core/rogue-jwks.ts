@@ -0,0 +1,132 @@
+/**
+ * Rogue JWKS - attacker key sets served for jku-injection, and certificate
+ * chains for x5u-injection
+ *
+ * A token whose `jku` header names a URL is an invitation to fetch its
+ * verification key from there. Loki plays the attacker's key server: the
+ * public half of each key a session forged with is served under
+ * /admin/rogue-jwks/:sessionId, with the `kid` the token's header carries,
+ * so a client that follows `jku` finds a key that validates the token.
+ * An `x5u` header is the same invitation for an X.509 chain, which is
+ * served PEM encoded under /admin/rogue-x5u/:sessionId.
+ */
+
+import type * as jose from "jose";
+
+/** Upper bound on keys served per session */
+const MAX_KEYS_PER_SESSION = 10;
+
+/**
+ * Rogue JWKS helpers handed to plugins, bound to the current session
+ */
+export interface RogueJwksPublisher {
+	/** Where the session's rogue JWKS is served */
+	url: string;
+	/** Serve a public key in the session's rogue JWKS, replacing any with the same kid */
+	publish(jwk: jose.JWK): void;
+	/** Where the session's rogue certificate chain is served */
+	x5uUrl: string;
+	/** Serve a PEM certificate chain as the session's rogue chain, replacing the last */
+	publishChain(pem: string): void;
+}
+
+export interface RogueJwksStoreOptions {
+	issuer: string;
+}
+
+/**
+ * Rogue JWKS Store - the attacker key sets served per session
+ */
+export class RogueJwksStore {
+	private readonly issuer: string;
+	private readonly keys = new Map<string, Map<string, jose.JWK>>(); // sessionId -> kid -> key
+	private readonly chains = new Map<string, string>(); // sessionId -> PEM chain
+
+	constructor(options: RogueJwksStoreOptions) {
+		this.issuer = options.issuer;
+	}
+
+	/**
+	 * The URL a session's rogue JWKS is served at
+	 */
+	urlFor(sessionId: string): string {
+		return `${this.issuer}/admin/rogue-jwks/${encodeURIComponent(sessionId)}`;
+	}
+
+	/**
+	 * The URL a session's rogue certificate chain is served at
+	 */
+	x5uUrlFor(sessionId: string): string {
+		return `${this.issuer}/admin/rogue-x5u/${encodeURIComponent(sessionId)}`;
+	}
+
+	/**
+	 * Serve a public key in a session's rogue JWKS
+	 */
+	publish(sessionId: string, jwk: jose.JWK): void {
+		const kid = jwk.kid ?? "";
+		let keys = this.keys.get(sessionId);
+		if (!keys) {
+			keys = new Map();
+			this.keys.set(sessionId, keys);
+		}
+		keys.delete(kid);
+		keys.set(kid, jwk);
+		if (keys.size > MAX_KEYS_PER_SESSION) {
+			const oldest = keys.keys().next().value;
+			if (oldest !== undefined) {
+				keys.delete(oldest);
+			}
+		}
+	}
+
+	/**
+	 * A session's rogue JWKS, if it has published any keys
+	 */
+	jwks(sessionId: string): { keys: jose.JWK[] } | undefined {
+		const keys = this.keys.get(sessionId);
+		return keys ? { keys: [...keys.values()] } : undefined;
+	}
+
+	/**
+	 * Serve a PEM certificate chain as a session's rogue chain
+	 */
+	publishChain(sessionId: string, pem: string): void {
+		this.chains.set(sessionId, pem);
+	}
+
+	/**
+	 * A session's rogue certificate chain, if it has published one
+	 */
+	chain(sessionId: string): string | undefined {
+		return this.chains.get(sessionId);
+	}
+
+	/**
+	 * Rogue JWKS helpers bound to a session
+	 */
+	forSession(sessionId: string): RogueJwksPublisher {
+		return {
+			url: this.urlFor(sessionId),
+			publish: (jwk) => this.publish(sessionId, jwk),
+			x5uUrl: this.x5uUrlFor(sessionId),
+			publishChain: (pem) => this.publishChain(sessionId, pem),
+		};
+	}
+
+	/**
+	 * Drop a session's rogue keys and chain
+	 */
+	clear(sessionId: string): void {
+		this.keys.delete(sessionId);
+		this.chains.delete(sessionId);
+	}
+
+	/**
+	 * Drop all rogue keys and chains
+	 */
+	clearAll(): void {
+		this.keys.clear();
+		this.chains.clear();
+	}
+}
@@ -0,0 +1,85 @@
+/**
+ * SD-JWT - selectively disclosable claims
+ *
+ * A session with `sdJwt` issues its tokens as SD-JWTs (IETF
+ * draft-ietf-oauth-selective-disclosure-jwt): each configured claim a token
+ * carries is taken out of its payload and sent as a disclosure, the
+ * base64url-encoded JSON array `[salt, name, value]`, appended after the
+ * JWS with `~` separators. The payload's `_sd` array holds the SHA-256
+ * digest of each disclosure in its place, so the signature covers the
+ * claims without revealing them. A verifier recomputes the digest of every
+ * disclosure it is sent and must find it in `_sd`.
+ *
+ * Claims a verifier needs before it looks at disclosures (iss, aud, exp,
+ * nbf, iat, cnf) stay in the payload. Loki issues no key binding JWT, so
+ * each SD-JWT ends with `~`.
+ */
+
+import { createHash } from "node:crypto";
+import { randomBytes } from "./random.js";
+import type { JWTClaims } from "./token-forge.js";
+
+/** The hash algorithm `_sd_alg` names */
+export const SD_ALG = "sha-256";
+
+/** Claims that always stay in the payload */
+export const NON_DISCLOSABLE_CLAIMS = ["iss", "aud", "exp", "nbf", "iat", "cnf", "_sd", "_sd_alg"];
+
+/**
+ * Move the named claims a payload carries into disclosures, each with a
+ * fresh salt; returns the disclosures, and leaves their digests in `_sd`,
+ * sorted so their order gives nothing away
+ */
+export function discloseClaims(claims: JWTClaims, names: string[]): string[] {
+	const disclosures: string[] = [];
+	for (const name of names) {
+		if (!Object.hasOwn(claims, name)) {
+			continue;
+		}
+		disclosures.push(encodeDisclosure(randomBytes(16).toString("base64url"), name, claims[name]));
+		delete claims[name];
+	}
+	if (disclosures.length > 0) {
+		const listed = Array.isArray(claims._sd) ? claims._sd : [];
+		claims._sd = [...listed, ...disclosures.map(disclosureDigest)].sort();
+		claims._sd_alg = SD_ALG;
+	}
+	return disclosures;
+}
+
+/**
+ * Encode a disclosure of an object property
+ */
+export function encodeDisclosure(salt: string, name: string, value: unknown): string {
+	return Buffer.from(JSON.stringify([salt, name, value])).toString("base64url");
+}
+
+/**
+ * Decode a disclosure of an object property; undefined if it isn't one
+ */
+export function decodeDisclosure(
+	disclosure: string,
+): { salt: string; name: string; value: unknown } | undefined {
+	try {
+		const decoded: unknown = JSON.parse(Buffer.from(disclosure, "base64url").toString());
+		if (
+			!Array.isArray(decoded) ||
+			decoded.length !== 3 ||
+			typeof decoded[0] !== "string" ||
+			typeof decoded[1] !== "string"
+		) {
+			return undefined;
+		}
+		return { salt: decoded[0], name: decoded[1], value: decoded[2] };
+	} catch {
+		return undefined;
+	}
+}
+
+/**
+ * The digest `_sd` lists for a disclosure: base64url of the SHA-256 of its
+ * encoded form
+ */
+export function disclosureDigest(disclosure: string): string {
+	return createHash("sha256").update(disclosure).digest("base64url");
+}
@@ -0,0 +1,132 @@
+/**
+ * Seeded Keys - signing keys derived from the global seed
+ *
+ * node:crypto can't generate a key pair from a caller's randomness, so
+ * with a global seed (see random.ts) Loki derives the private key itself
+ * and imports it: an EC scalar or Ed25519 seed straight from the
+ * generator, or RSA primes found by testing candidates the generator
+ * draws. The same seed then yields the same keys, and the same kids, on
+ * every run.
+ */
+
+import { checkPrimeSync, createECDH, createPrivateKey } from "node:crypto";
+import type * as jose from "jose";
+import { randomBytes } from "./random.js";
+
+const RSA_MODULUS_BITS = 2048;
+const RSA_PUBLIC_EXPONENT = 65537n;
+
+/** Each JWK curve's OpenSSL name and private scalar size */
+const EC_CURVES: Record<string, { name: string; bytes: number }> = {
+	"P-256": { name: "prime256v1", bytes: 32 },
+	"P-384": { name: "secp384r1", bytes: 48 },
+	"P-521": { name: "secp521r1", bytes: 66 },
+};
+
+/** PKCS #8 DER preceding a 32-byte Ed25519 private key (RFC 8410) */
+const ED25519_PKCS8_PREFIX = Buffer.from("302e020100300506032b657004220420", "hex");
+
+/**
+ * A private JWK drawn from the seeded generator, for the key type and curve given
+ */
+export function seededPrivateJwk(kty: string, crv?: string): jose.JWK {
+	if (kty === "RSA") {
+		return rsaJwk();
+	}
+	if (kty === "EC") {
+		return ecJwk(crv ?? "P-256");
+	}
+	if (kty === "OKP" && crv === "Ed25519") {
+		const key = createPrivateKey({
+			key: Buffer.concat([ED25519_PKCS8_PREFIX, randomBytes(32)]),
+			format: "der",
+			type: "pkcs8",
+		});
+		return key.export({ format: "jwk" }) as jose.JWK;
+	}
+	throw new Error(`Cannot derive a ${kty} ${crv ?? ""} key from a seed`);
+}
+
+function ecJwk(crv: string): jose.JWK {
+	const curve = EC_CURVES[crv];
+	if (!curve) {
+		throw new Error(`Cannot derive a key on curve ${crv} from a seed`);
+	}
+	const ecdh = createECDH(curve.name);
+	for (;;) {
+		const d = randomBytes(curve.bytes);
+		if (crv === "P-521") {
+			d[0] = (d[0] ?? 0) & 0x01;
+		}
+		try {
+			// Throws for a scalar of zero or not below the curve order; draw again
+			ecdh.setPrivateKey(d);
+		} catch {
+			continue;
+		}
+		const point = ecdh.getPublicKey();
+		return {
+			kty: "EC",
+			crv,
+			x: point.subarray(1, 1 + curve.bytes).toString("base64url"),
+			y: point.subarray(1 + curve.bytes).toString("base64url"),
+			d: d.toString("base64url"),
+		};
+	}
+}
+
+function rsaJwk(): jose.JWK {
+	const e = RSA_PUBLIC_EXPONENT;
+	const p = rsaPrime(RSA_MODULUS_BITS / 2);
+	let q = rsaPrime(RSA_MODULUS_BITS / 2);
+	while (q === p) {
+		q = rsaPrime(RSA_MODULUS_BITS / 2);
+	}
+	const d = modInverse(e, (p - 1n) * (q - 1n));
+	return {
+		kty: "RSA",
+		n: toBase64url(p * q),
+		e: toBase64url(e),
+		d: toBase64url(d),
+		p: toBase64url(p),
+		q: toBase64url(q),
+		dp: toBase64url(d % (p - 1n)),
+		dq: toBase64url(d % (q - 1n)),
+		qi: toBase64url(modInverse(q, p)),
+	};
+}
+
+/**
+ * A prime of exactly `bits` bits, its top two bits set so two of them make
+ * a modulus of twice the size, with p - 1 coprime to the public exponent
+ */
+function rsaPrime(bits: number): bigint {
+	for (;;) {
+		const bytes = randomBytes(bits / 8);
+		bytes[0] = (bytes[0] ?? 0) | 0xc0;
+		bytes[bytes.length - 1] = (bytes[bytes.length - 1] ?? 0) | 0x01;
+		const candidate = BigInt(`0x${bytes.toString("hex")}`);
+		if ((candidate - 1n) % RSA_PUBLIC_EXPONENT !== 0n && checkPrimeSync(candidate)) {
+			return candidate;
+		}
+	}
+}
+
+/**
+ * The inverse of `a` modulo `m` (extended Euclid); `a` and `m` must be coprime
+ */
+function modInverse(a: bigint, m: bigint): bigint {
+	let [r0, r1] = [a % m, m];
+	let [s0, s1] = [1n, 0n];
+	while (r1 !== 0n) {
+		const quotient = r0 / r1;
+		[r0, r1] = [r1, r0 - quotient * r1];
+		[s0, s1] = [s1, s0 - quotient * s1];
+	}
+	return ((s0 % m) + m) % m;
+}
+
+function toBase64url(value: bigint): string {
+	const hex = value.toString(16);
+	return Buffer.from(hex.length % 2 === 0 ? hex : `0${hex}`, "hex").toString("base64url");
+}
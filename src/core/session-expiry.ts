@@ -0,0 +1,69 @@
+/**
+ * Session Expiry - evicting sessions that outlive their ttl
+ *
+ * A session's `ttl` (or `sessions.ttl` for sessions without one) is a Go
+ * duration counted from when the session started. Once it has passed, the
+ * session is evicted with everything recorded for it - ledger, events,
+ * issuances, HAR entries - so a long-lived Loki doesn't grow without bound.
+ * Evicted IDs are remembered (the most recent MAX_REMEMBERED of them) so
+ * that later use answers 410 Gone rather than looking like an unknown
+ * session, until Loki restarts.
+ */
+
+import { parseDuration } from "./duration.js";
+import type { Session } from "./types.js";
+
+/** How often Loki looks for expired sessions */
+export const SWEEP_INTERVAL_MS = 1000;
+
+/** Evicted session IDs remembered for 410 responses */
+export const MAX_REMEMBERED = 10_000;
+
+/** The shortest ttl accepted */
+export const MIN_TTL_MS = 1000;
+
+/**
+ * Whether a value is a Go duration usable as a ttl
+ */
+export function isTtl(value: unknown): value is string {
+	const ms = typeof value === "string" ? parseDuration(value) : undefined;
+	return ms !== undefined && ms >= MIN_TTL_MS;
+}
+
+/**
+ * When a session expires, in epoch milliseconds; undefined if it doesn't
+ */
+export function expiresAt(session: Session, ttl: string | undefined): number | undefined {
+	const ms = ttl === undefined ? undefined : parseDuration(ttl);
+	return ms === undefined ? undefined : session.startedAt.getTime() + ms;
+}
+
+export class EvictedSessions {
+	/** Session ID -> when it was evicted, oldest first */
+	private readonly evicted = new Map<string, Date>();
+
+	remember(sessionId: string, at = new Date()): void {
+		this.evicted.delete(sessionId);
+		this.evicted.set(sessionId, at);
+		if (this.evicted.size > MAX_REMEMBERED) {
+			const [oldest] = this.evicted.keys();
+			if (oldest !== undefined) {
+				this.evicted.delete(oldest);
+			}
+		}
+	}
+
+	/**
+	 * When a session was evicted, if it was (and is still remembered)
+	 */
+	evictedAt(sessionId: string): Date | undefined {
+		return this.evicted.get(sessionId);
+	}
+
+	/**
+	 * Forget an evicted ID, e.g. when a session is created under it again
+	 */
+	forget(sessionId: string): void {
+		this.evicted.delete(sessionId);
+	}
+}
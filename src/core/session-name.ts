@@ -0,0 +1,45 @@
+/**
+ * Session name sanitization
+ *
+ * Session names end up in logs, ledgers and reports, so an unchecked name is
+ * an injection vector into whoever reads them. Names are trimmed, bounded in
+ * length and restricted to an allowlist of characters.
+ */
+
+import type { SessionsConfig } from "./types.js";
+
+export type SessionNameResult = { ok: true; name: string } | { ok: false; error: string };
+
+/**
+ * Sanitize a session name, or explain why it's rejected
+ *
+ * The rejected value itself is never echoed back in the error.
+ */
+export function sanitizeSessionName(
+	name: unknown,
+	config: Required<SessionsConfig>,
+): SessionNameResult {
+	if (typeof name !== "string") {
+		return { ok: false, error: "name must be a string" };
+	}
+
+	const trimmed = name.trim();
+	if (trimmed.length === 0) {
+		return { ok: false, error: "name must not be empty" };
+	}
+
+	const length = [...trimmed].length;
+	if (length > config.nameMaxLength) {
+		return {
+			ok: false,
+			error: `name must be at most ${config.nameMaxLength} characters (got ${length})`,
+		};
+	}
+
+	const allowed = new RegExp(`^[${config.nameAllowedChars}]+$`, "u");
+	if (!allowed.test(trimmed)) {
+		return { ok: false, error: "name contains characters that are not allowed" };
+	}
+
+	return { ok: true, name: trimmed };
+}
@@ -0,0 +1,44 @@
+/**
+ * Session Query - naming a session where no header can be sent
+ *
+ * Clients fetch discovery documents and the JWKS with their own HTTP
+ * machinery, so they rarely send `X-Loki-Session`. Those requests may name
+ * their session with the `loki_session` query parameter instead:
+ * `/.well-known/openid-configuration?loki_session=<id>`, or
+ * `/jwks?loki_session=<id>`. A discovery document fetched that way
+ * advertises a `jwks_uri` carrying the parameter, so a client that follows
+ * discovery to the JWKS stays in the session. When a request carries both,
+ * the header wins; the parameter is ignored on every other endpoint.
+ */
+
+import { metadataDocumentAt } from "./provider-metadata.js";
+
+/** Query parameter naming the session a discovery or JWKS request is for */
+export const SESSION_QUERY_PARAM = "loki_session";
+
+/** Where the JWKS is served */
+const JWKS_PATHS = new Set(["/jwks", "/.well-known/jwks.json"]);
+
+/**
+ * The session a discovery or JWKS request names in its query, if any
+ */
+export function querySessionId(url: string): string | undefined {
+	const path = url.split("?")[0] ?? "";
+	if (!metadataDocumentAt(path) && !JWKS_PATHS.has(path)) {
+		return undefined;
+	}
+	const query = new URLSearchParams(url.split("?")[1] ?? "");
+	return query.get(SESSION_QUERY_PARAM) || undefined;
+}
+
+/**
+ * A URL naming a session in its query, replacing any session it named
+ */
+export function withSessionQuery(url: string, sessionId: string): string {
+	if (!URL.canParse(url)) {
+		return url;
+	}
+	const named = new URL(url);
+	named.searchParams.set(SESSION_QUERY_PARAM, sessionId);
+	return named.toString();
+}
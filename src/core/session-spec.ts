@@ -0,0 +1,461 @@
+/**
+ * Session Spec - validation of session specs supplied over the admin API
+ *
+ * Shared by single and batch session creation, cloning and topology
+ * documents, so a spec is accepted or rejected the same way wherever it
+ * comes from.
+ */
+
+import { isAcr, isAmr } from "../plugins/built-in/auth-context-spoof.js";
+import { MAX_TOKEN_PAD_BYTES, isTokenPadBytes } from "../plugins/built-in/oversized-token.js";
+import { AUD_FORMATS } from "./aud-format.js";
+import { parseDuration } from "./duration.js";
+import { MAX_SEED } from "./probabilistic-draw.js";
+import { NON_DISCLOSABLE_CLAIMS } from "./sd-jwt.js";
+import { isTtl } from "./session-expiry.js";
+import { sanitizeSessionName } from "./session-name.js";
+import { parseCidr } from "./source-address.js";
+import { isTokenLifetime } from "./token-lifetime.js";
+import type {
+	AudFormat,
+	MischiefCondition,
+	SdJwtConfig,
+	Session,
+	SessionConfig,
+	SessionsConfig,
+	TokenTarget,
+} from "./types.js";
+import { isWebhookUrl } from "./webhooks.js";
+
+const TOKEN_TARGETS: TokenTarget[] = ["access_token", "id_token", "both"];
+
+export type SessionSpecResult =
+	| { ok: true; config: Partial<SessionConfig> }
+	| { ok: false; error: string };
+
+/**
+ * Validate a session spec from a create request or topology document
+ *
+ * With `isSigningKey`, a `keyId` must name a registered signing key.
+ */
+export function parseSessionSpec(
+	body: unknown,
+	sessionsConfig: Required<SessionsConfig>,
+	isSigningKey?: (keyId: string) => boolean,
+): SessionSpecResult {
+	if (!isPlainObject(body)) {
+		return { ok: false, error: "session spec must be an object" };
+	}
+	const spec = body as Partial<SessionConfig>;
+	const config: Partial<SessionConfig> = {
+		mode: spec.mode ?? "explicit",
+		mischief: spec.mischief ?? [],
+	};
+	if (spec.name !== undefined) {
+		const result = sanitizeSessionName(spec.name, sessionsConfig);
+		if (!result.ok) {
+			return { ok: false, error: result.error };
+		}
+		config.name = result.name;
+	}
+	if (spec.probability !== undefined) {
+		config.probability = spec.probability;
+	}
+	if (spec.mode === "probabilistic") {
+		// Each plugin is drawn with its own probability; the map lists the session's mischief
+		if (!isProbabilityMap(spec.probabilities)) {
+			return { ok: false, error: "probabilities must map plugin IDs to numbers from 0 to 1" };
+		}
+		const listed = Object.keys(spec.probabilities);
+		const mischief = spec.mischief ?? listed;
+		if (mischief.length !== listed.length || !mischief.every((id) => listed.includes(id))) {
+			return { ok: false, error: "mischief must list the same plugins as probabilities" };
+		}
+		config.probabilities = spec.probabilities;
+		config.mischief = Object.keys(spec.probabilities);
+		if (spec.seed !== undefined) {
+			if (!Number.isInteger(spec.seed) || spec.seed < 0 || spec.seed > MAX_SEED) {
+				return { ok: false, error: `seed must be an integer from 0 to ${MAX_SEED}` };
+			}
+			config.seed = spec.seed;
+		}
+	} else if (spec.probabilities !== undefined || spec.seed !== undefined) {
+		return { ok: false, error: "probabilities and seed only apply to probabilistic mode" };
+	}
+	if (spec.warmupRequests !== undefined) {
+		if (!Number.isInteger(spec.warmupRequests) || spec.warmupRequests < 0) {
+			return { ok: false, error: "warmupRequests must be a non-negative integer" };
+		}
+		config.warmupRequests = spec.warmupRequests;
+	}
+	if (spec.pluginConfig !== undefined) {
+		if (!isPluginConfigMap(spec.pluginConfig)) {
+			return { ok: false, error: "pluginConfig must map plugin IDs to option objects" };
+		}
+		config.pluginConfig = spec.pluginConfig;
+	}
+	if (spec.targets !== undefined) {
+		if (!isTargetMap(spec.targets)) {
+			return {
+				ok: false,
+				error: `targets must map plugin IDs to one of ${TOKEN_TARGETS.join(", ")}`,
+			};
+		}
+		config.targets = spec.targets;
+	}
+	if (spec.ttl !== undefined) {
+		if (!isTtl(spec.ttl)) {
+			return { ok: false, error: 'ttl must be a Go duration of at least 1s, e.g. "1h"' };
+		}
+		config.ttl = spec.ttl;
+	}
+	if (body.jkuTarget !== undefined) {
+		// Shorthand for pluginConfig["jku-injection"].url
+		if (typeof body.jkuTarget !== "string" || !URL.canParse(body.jkuTarget)) {
+			return { ok: false, error: "jkuTarget must be an absolute URL" };
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"jku-injection": { ...pluginConfig["jku-injection"], url: body.jkuTarget },
+		};
+	}
+	if (body.audTarget !== undefined) {
+		// Shorthand for pluginConfig["aud-confusion"].target
+		if (typeof body.audTarget !== "string" || body.audTarget.length === 0) {
+			return { ok: false, error: "audTarget must be a non-empty string" };
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"aud-confusion": { ...pluginConfig["aud-confusion"], target: body.audTarget },
+		};
+	}
+	if (body.issTarget !== undefined) {
+		// Shorthand for pluginConfig["iss-mismatch"].issuer
+		if (typeof body.issTarget !== "string" || body.issTarget.length === 0) {
+			return { ok: false, error: "issTarget must be a non-empty string" };
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"iss-mismatch": { ...pluginConfig["iss-mismatch"], issuer: body.issTarget },
+		};
+	}
+	if (body.embeddedJwkKidCollision !== undefined) {
+		// Shorthand for pluginConfig["embedded-jwk"].kidCollision
+		if (typeof body.embeddedJwkKidCollision !== "boolean") {
+			return { ok: false, error: "embeddedJwkKidCollision must be a boolean" };
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"embedded-jwk": {
+				...pluginConfig["embedded-jwk"],
+				kidCollision: body.embeddedJwkKidCollision,
+			},
+		};
+	}
+	if (body.jwksRaceWindow !== undefined) {
+		// Shorthand for pluginConfig["jwks-key-rotation-race"].fetches and .seconds
+		const window = body.jwksRaceWindow;
+		const { fetches, seconds } = isPlainObject(window) ? window : {};
+		if (
+			!isPlainObject(window) ||
+			(fetches === undefined && seconds === undefined) ||
+			(fetches !== undefined && !(Number.isInteger(fetches) && (fetches as number) > 0)) ||
+			(seconds !== undefined && !(typeof seconds === "number" && seconds > 0))
+		) {
+			return {
+				ok: false,
+				error: "jwksRaceWindow must set fetches (a positive integer) and/or seconds (positive)",
+			};
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"jwks-key-rotation-race": {
+				...pluginConfig["jwks-key-rotation-race"],
+				...(fetches === undefined ? {} : { fetches }),
+				...(seconds === undefined ? {} : { seconds }),
+			},
+		};
+	}
+	if (body.jwksMaxAge !== undefined) {
+		// Shorthand for pluginConfig["jwks-cache-poison"].maxAge
+		const maxAge = body.jwksMaxAge;
+		if (!(typeof maxAge === "number" && Number.isInteger(maxAge) && maxAge > 0)) {
+			return { ok: false, error: "jwksMaxAge must be a positive integer (seconds)" };
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"jwks-cache-poison": { ...pluginConfig["jwks-cache-poison"], maxAge },
+		};
+	}
+	if (body.claims !== undefined) {
+		// Shorthand for pluginConfig["claim-injection"].claims
+		if (!isPlainObject(body.claims) || Object.keys(body.claims).length === 0) {
+			return { ok: false, error: "claims must be a non-empty object" };
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"claim-injection": { ...pluginConfig["claim-injection"], claims: body.claims },
+		};
+	}
+	if (body.headers !== undefined) {
+		// Shorthand for pluginConfig["header-injection"].headers
+		if (!isPlainObject(body.headers) || Object.keys(body.headers).length === 0) {
+			return { ok: false, error: "headers must be a non-empty object" };
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"header-injection": { ...pluginConfig["header-injection"], headers: body.headers },
+		};
+	}
+	for (const field of ["expOffset", "nbfOffset"]) {
+		// Shorthand for pluginConfig["temporal-future"].expOffset and .nbfOffset
+		const offset = body[field];
+		if (offset === undefined) {
+			continue;
+		}
+		const ms = typeof offset === "string" ? parseDuration(offset) : undefined;
+		if (ms === undefined || ms < 1000) {
+			return { ok: false, error: `${field} must be a Go duration of at least 1s, e.g. "262800h"` };
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"temporal-future": { ...pluginConfig["temporal-future"], [field]: offset },
+		};
+	}
+	if (body.tokenPadBytes !== undefined) {
+		// Shorthand for pluginConfig["oversized-token"].tokenPadBytes
+		if (!isTokenPadBytes(body.tokenPadBytes)) {
+			return {
+				ok: false,
+				error: `tokenPadBytes must be an integer from 1 to ${MAX_TOKEN_PAD_BYTES}`,
+			};
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"oversized-token": {
+				...pluginConfig["oversized-token"],
+				tokenPadBytes: body.tokenPadBytes,
+			},
+		};
+	}
+	if (body.tokenDelay !== undefined) {
+		// Shorthand for pluginConfig["slow-response"].delay
+		const ms = typeof body.tokenDelay === "string" ? parseDuration(body.tokenDelay) : undefined;
+		if (ms === undefined || ms <= 0) {
+			return { ok: false, error: 'tokenDelay must be a positive Go duration, e.g. "30s"' };
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"slow-response": { ...pluginConfig["slow-response"], delay: body.tokenDelay },
+		};
+	}
+	if (body.amr !== undefined || body.acr !== undefined) {
+		// Shorthand for pluginConfig["auth-context-spoof"].amr and .acr
+		if (body.amr !== undefined && !isAmr(body.amr)) {
+			return { ok: false, error: "amr must be a non-empty array of non-empty strings" };
+		}
+		if (body.acr !== undefined && !isAcr(body.acr)) {
+			return { ok: false, error: "acr must be a non-empty string" };
+		}
+		const pluginConfig = config.pluginConfig ?? {};
+		config.pluginConfig = {
+			...pluginConfig,
+			"auth-context-spoof": {
+				...pluginConfig["auth-context-spoof"],
+				...(body.amr === undefined ? {} : { amr: body.amr }),
+				...(body.acr === undefined ? {} : { acr: body.acr }),
+			},
+		};
+	}
+	if (spec.keyId !== undefined) {
+		if (typeof spec.keyId !== "string" || spec.keyId.length === 0) {
+			return { ok: false, error: "keyId must be a non-empty string" };
+		}
+		if (isSigningKey && !isSigningKey(spec.keyId)) {
+			return { ok: false, error: `keyId '${spec.keyId}' is not a registered signing key` };
+		}
+		config.keyId = spec.keyId;
+	}
+	if (spec.webhook !== undefined) {
+		if (typeof spec.webhook !== "string" || !isWebhookUrl(spec.webhook)) {
+			return { ok: false, error: "webhook must be an absolute http(s) URL" };
+		}
+		config.webhook = spec.webhook;
+	}
+	if (spec.maxTokensPerSecond !== undefined) {
+		const rate = spec.maxTokensPerSecond;
+		if (typeof rate !== "number" || !Number.isFinite(rate) || rate <= 0) {
+			return { ok: false, error: "maxTokensPerSecond must be a positive number" };
+		}
+		config.maxTokensPerSecond = rate;
+	}
+	if (spec.sdJwt !== undefined) {
+		const sdJwt = parseSdJwt(spec.sdJwt);
+		if (typeof sdJwt === "string") {
+			return { ok: false, error: sdJwt };
+		}
+		config.sdJwt = sdJwt;
+	}
+	if (spec.audFormat !== undefined) {
+		if (!AUD_FORMATS.includes(spec.audFormat as AudFormat)) {
+			return { ok: false, error: `audFormat must be one of ${AUD_FORMATS.join(", ")}` };
+		}
+		config.audFormat = spec.audFormat as AudFormat;
+	}
+	if (spec.tokenLifetime !== undefined) {
+		if (!isTokenLifetime(spec.tokenLifetime)) {
+			return {
+				ok: false,
+				error: 'tokenLifetime must be a Go duration in whole seconds, at least 1s, e.g. "5m"',
+			};
+		}
+		config.tokenLifetime = spec.tokenLifetime;
+	}
+	if (spec.when !== undefined) {
+		const when = parseCondition(spec.when);
+		if (typeof when === "string") {
+			return { ok: false, error: when };
+		}
+		config.when = when;
+	}
+	return { ok: true, config };
+}
+
+/**
+ * The spec a session was created from: the settings that recreate it,
+ * without its id or anything it accumulated since
+ */
+export function sessionSpec(session: Session): Partial<SessionConfig> {
+	const spec: Partial<SessionConfig> = { mode: session.mode, mischief: session.mischief };
+	if (session.name !== undefined) spec.name = session.name;
+	if (session.probability !== undefined) spec.probability = session.probability;
+	if (session.probabilities !== undefined) spec.probabilities = session.probabilities;
+	if (session.seed !== undefined) spec.seed = session.seed;
+	if (session.warmupRequests !== undefined) spec.warmupRequests = session.warmupRequests;
+	if (session.pluginConfig !== undefined) spec.pluginConfig = session.pluginConfig;
+	if (session.targets !== undefined) spec.targets = session.targets;
+	if (session.ttl !== undefined) spec.ttl = session.ttl;
+	if (session.when !== undefined) spec.when = session.when;
+	if (session.keyId !== undefined) spec.keyId = session.keyId;
+	if (session.webhook !== undefined) spec.webhook = session.webhook;
+	if (session.maxTokensPerSecond !== undefined) {
+		spec.maxTokensPerSecond = session.maxTokensPerSecond;
+	}
+	if (session.sdJwt !== undefined) spec.sdJwt = session.sdJwt;
+	if (session.audFormat !== undefined) spec.audFormat = session.audFormat;
+	if (session.tokenLifetime !== undefined) spec.tokenLifetime = session.tokenLifetime;
+	return spec;
+}
+
+/**
+ * Apply an override patch to a spec (RFC 7396 JSON merge patch)
+ *
+ * Objects in the patch are merged into the spec's, member by member; any
+ * other value replaces the spec's outright, arrays included, and null
+ * removes the member. The spec itself is left untouched.
+ */
+export function mergeSpecPatch(
+	spec: Record<string, unknown>,
+	patch: Record<string, unknown>,
+): Record<string, unknown> {
+	const merged: Record<string, unknown> = { ...spec };
+	for (const [key, value] of Object.entries(patch)) {
+		if (value === null) {
+			delete merged[key];
+		} else if (isPlainObject(value)) {
+			const current = merged[key];
+			merged[key] = mergeSpecPatch(isPlainObject(current) ? current : {}, value);
+		} else {
+			merged[key] = value;
+		}
+	}
+	return merged;
+}
+
+/**
+ * Validate an `sdJwt` setting; returns an error message if it's invalid
+ */
+function parseSdJwt(value: unknown): SdJwtConfig | string {
+	if (!isPlainObject(value)) {
+		return "sdJwt must be an object with claims";
+	}
+	const { claims, tokens } = value;
+	if (
+		!Array.isArray(claims) ||
+		claims.length === 0 ||
+		!claims.every((claim) => typeof claim === "string" && claim !== "")
+	) {
+		return "sdJwt.claims must be a non-empty array of claim names";
+	}
+	const fixed = claims.find((claim) => NON_DISCLOSABLE_CLAIMS.includes(claim));
+	if (fixed !== undefined) {
+		return `sdJwt.claims can't include '${fixed}'; it stays in the payload`;
+	}
+	if (tokens !== undefined && !TOKEN_TARGETS.includes(tokens as TokenTarget)) {
+		return `sdJwt.tokens must be one of ${TOKEN_TARGETS.join(", ")}`;
+	}
+	const sdJwt: SdJwtConfig = { claims: [...new Set(claims as string[])] };
+	if (tokens !== undefined) {
+		sdJwt.tokens = tokens as TokenTarget;
+	}
+	return sdJwt;
+}
+
+/**
+ * Validate a `when` condition; returns an error message if it's invalid
+ */
+function parseCondition(value: unknown): MischiefCondition | string {
+	if (!isPlainObject(value)) {
+		return "when must be an object";
+	}
+	const { sourceCIDR } = value;
+	const cidrs = typeof sourceCIDR === "string" ? [sourceCIDR] : sourceCIDR;
+	if (!Array.isArray(cidrs) || cidrs.length === 0) {
+		return "when.sourceCIDR must be a CIDR or a non-empty array of CIDRs";
+	}
+	for (const cidr of cidrs) {
+		if (typeof cidr !== "string") {
+			return "when.sourceCIDR must be a CIDR or a non-empty array of CIDRs";
+		}
+		try {
+			parseCidr(cidr);
+		} catch (err) {
+			return `when.sourceCIDR: ${(err as Error).message}`;
+		}
+	}
+	return { sourceCIDR: sourceCIDR as string | string[] };
+}
+
+export function isPlainObject(value: unknown): value is Record<string, unknown> {
+	return typeof value === "object" && value !== null && !Array.isArray(value);
+}
+
+function isProbabilityMap(value: unknown): value is Record<string, number> {
+	return (
+		isPlainObject(value) &&
+		Object.keys(value).length > 0 &&
+		Object.values(value).every((p) => typeof p === "number" && p >= 0 && p <= 1)
+	);
+}
+
+function isTargetMap(value: unknown): value is Record<string, TokenTarget> {
+	return (
+		isPlainObject(value) &&
+		Object.values(value).every((target) => TOKEN_TARGETS.includes(target as TokenTarget))
+	);
+}
+
+function isPluginConfigMap(value: unknown): value is Record<string, Record<string, unknown>> {
+	return isPlainObject(value) && Object.values(value).every(isPlainObject);
+}
@@ -0,0 +1,142 @@
+/**
+ * Session Stats - issuance counters and token rate limits, per session
+ *
+ * Soak tests need to know a session actually exercised each attack path:
+ * how many tokens it issued, how many each plugin touched, and when the
+ * first and last went out. Unlike the issuance report, nothing here is
+ * capped, so the counters stay exact over millions of requests. They
+ * count from when Loki started (or the session was created), not from
+ * what a restored store remembers.
+ *
+ * A session's `maxTokensPerSecond` is enforced with a token bucket that
+ * holds up to a second's worth of requests, so short bursts pass and
+ * sustained load beyond the rate gets 429.
+ */
+
+export interface SessionStats {
+	sessionId: string;
+	/** Tokens issued (access and ID tokens count separately) */
+	issuances: number;
+	/** Tokens issued without mischief */
+	clean: number;
+	/** Tokens each plugin was applied to */
+	mischief: Record<string, number>;
+	firstIssuedAt: string | null;
+	lastIssuedAt: string | null;
+	/** Token requests turned away by maxTokensPerSecond */
+	rateLimited: number;
+	/** The session's rate limit, if it has one */
+	maxTokensPerSecond?: number;
+}
+
+interface Counters {
+	issuances: number;
+	clean: number;
+	mischief: Map<string, number>;
+	firstIssuedAt?: Date;
+	lastIssuedAt?: Date;
+	rateLimited: number;
+}
+
+interface Bucket {
+	tokens: number;
+	refilledAt: number;
+}
+
+/**
+ * Session Stats Store - counters and rate limit buckets per session
+ */
+export class SessionStatsStore {
+	private readonly counters = new Map<string, Counters>();
+	private readonly buckets = new Map<string, Bucket>();
+
+	constructor(private readonly now: () => number = Date.now) {}
+
+	/**
+	 * Count a token issued with the given mischief
+	 */
+	recordIssuance(sessionId: string, mischief: string[]): void {
+		const counters = this.countersFor(sessionId);
+		const issuedAt = new Date(this.now());
+		counters.issuances++;
+		if (mischief.length === 0) {
+			counters.clean++;
+		}
+		for (const id of new Set(mischief)) {
+			counters.mischief.set(id, (counters.mischief.get(id) ?? 0) + 1);
+		}
+		if (!counters.firstIssuedAt) {
+			counters.firstIssuedAt = issuedAt;
+		}
+		counters.lastIssuedAt = issuedAt;
+	}
+
+	/**
+	 * Take one token request from a session's bucket; false (and counted)
+	 * if the session is over its rate
+	 */
+	tryTake(sessionId: string, maxTokensPerSecond: number): boolean {
+		const capacity = Math.max(1, maxTokensPerSecond);
+		const now = this.now();
+		const bucket = this.buckets.get(sessionId) ?? { tokens: capacity, refilledAt: now };
+		const elapsed = Math.max(0, now - bucket.refilledAt) / 1000;
+		bucket.tokens = Math.min(capacity, bucket.tokens + elapsed * maxTokensPerSecond);
+		bucket.refilledAt = now;
+		this.buckets.set(sessionId, bucket);
+		if (bucket.tokens < 1) {
+			this.countersFor(sessionId).rateLimited++;
+			return false;
+		}
+		bucket.tokens--;
+		return true;
+	}
+
+	/**
+	 * Seconds until a session's bucket holds a token again (at least 1, for Retry-After)
+	 */
+	retryAfter(sessionId: string, maxTokensPerSecond: number): number {
+		const tokens = this.buckets.get(sessionId)?.tokens ?? 1;
+		return Math.max(1, Math.ceil((1 - tokens) / maxTokensPerSecond));
+	}
+
+	/**
+	 * A session's counters; zeroes if it issued nothing yet
+	 */
+	stats(sessionId: string): SessionStats {
+		const counters = this.counters.get(sessionId);
+		return {
+			sessionId,
+			issuances: counters?.issuances ?? 0,
+			clean: counters?.clean ?? 0,
+			mischief: Object.fromEntries(counters?.mischief ?? []),
+			firstIssuedAt: counters?.firstIssuedAt?.toISOString() ?? null,
+			lastIssuedAt: counters?.lastIssuedAt?.toISOString() ?? null,
+			rateLimited: counters?.rateLimited ?? 0,
+		};
+	}
+
+	/**
+	 * Drop a session's counters and bucket
+	 */
+	clear(sessionId: string): void {
+		this.counters.delete(sessionId);
+		this.buckets.delete(sessionId);
+	}
+
+	/**
+	 * Drop every session's counters and buckets
+	 */
+	clearAll(): void {
+		this.counters.clear();
+		this.buckets.clear();
+	}
+
+	private countersFor(sessionId: string): Counters {
+		let counters = this.counters.get(sessionId);
+		if (!counters) {
+			counters = { issuances: 0, clean: 0, mischief: new Map(), rateLimited: 0 };
+			this.counters.set(sessionId, counters);
+		}
+		return counters;
+	}
+}
@@ -0,0 +1,43 @@
+/**
+ * Shared Secrets - checking the tokens and secrets requests present
+ *
+ * The admin token, the JWKS bearer token and client secrets are compared
+ * as SHA-256 digests in constant time, so how long a comparison takes
+ * gives away neither a secret's content nor its length.
+ */
+
+import { createHash, timingSafeEqual } from "node:crypto";
+
+/**
+ * Whether a presented secret is the expected one (compared in constant time)
+ */
+export function secretMatches(presented: string, expected: string): boolean {
+	const digest = (value: string) => createHash("sha256").update(value).digest();
+	return timingSafeEqual(digest(presented), digest(expected));
+}
+
+/**
+ * Whether an Authorization header carries the token (compared in constant
+ * time): as a bearer token or, when `basic` is set, as the password of
+ * Basic credentials, whatever the username
+ */
+export function presentsToken(
+	header: string | undefined,
+	token: string,
+	{ basic = false }: { basic?: boolean } = {},
+): boolean {
+	let presented: string;
+	if (header?.startsWith("Bearer ")) {
+		presented = header.slice("Bearer ".length);
+	} else if (basic && header?.toLowerCase().startsWith("basic ")) {
+		const credentials = Buffer.from(header.slice("Basic ".length), "base64").toString();
+		const separator = credentials.indexOf(":");
+		if (separator < 0) {
+			return false;
+		}
+		presented = credentials.slice(separator + 1);
+	} else {
+		return false;
+	}
+	return secretMatches(presented, token);
+}
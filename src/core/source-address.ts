@@ -0,0 +1,108 @@
+/**
+ * Source Address - client IP resolution and CIDR matching
+ *
+ * Sessions can restrict their mischief to requests from given networks
+ * (`when: { sourceCIDR }`). The client address is the socket's peer unless
+ * the peer is a trusted proxy; then X-Forwarded-For is walked right to left
+ * past every trusted hop. Entries further left were written by the client
+ * and are never trusted, so an untrusted caller can't spoof its way into
+ * (or out of) a targeted network.
+ */
+
+import { BlockList, isIPv4, isIPv6 } from "node:net";
+import type { MischiefCondition } from "./types.js";
+
+export interface ParsedCidr {
+	address: string;
+	prefix: number;
+	family: "ipv4" | "ipv6";
+}
+
+/**
+ * Parse a CIDR such as "10.0.0.0/8" or "2001:db8::/32"; a bare address is a single host
+ */
+export function parseCidr(cidr: string): ParsedCidr {
+	const [address = "", prefixText, ...rest] = cidr.trim().split("/");
+	const family = isIPv4(address) ? "ipv4" : isIPv6(address) ? "ipv6" : undefined;
+	const max = family === "ipv4" ? 32 : 128;
+	const prefix =
+		prefixText === undefined ? max : /^\d{1,3}$/.test(prefixText) ? Number(prefixText) : Number.NaN;
+	if (family === undefined || rest.length > 0 || !(prefix >= 0 && prefix <= max)) {
+		throw new Error(`Invalid CIDR '${cidr}'`);
+	}
+	return { address, prefix, family };
+}
+
+/**
+ * The networks a `when` condition targets; throws if any CIDR is invalid
+ */
+export function conditionCidrs(condition: MischiefCondition): string[] {
+	const cidrs = Array.isArray(condition.sourceCIDR) ? condition.sourceCIDR : [condition.sourceCIDR];
+	for (const cidr of cidrs) {
+		parseCidr(cidr);
+	}
+	return cidrs;
+}
+
+/**
+ * Unwrap an IPv4-mapped IPv6 address ("::ffff:10.0.0.1") to the IPv4 address it carries
+ */
+export function normalizeAddress(address: string): string {
+	const mapped = /^::ffff:(\d{1,3}(?:\.\d{1,3}){3})$/i.exec(address);
+	return mapped?.[1] ?? address;
+}
+
+/**
+ * A set of networks; throws on construction if any CIDR is invalid
+ */
+export class CidrSet {
+	private readonly list = new BlockList();
+
+	constructor(readonly cidrs: readonly string[]) {
+		for (const cidr of cidrs) {
+			const { address, prefix, family } = parseCidr(cidr);
+			this.list.addSubnet(address, prefix, family);
+		}
+	}
+
+	has(address: string): boolean {
+		const normalized = normalizeAddress(address);
+		const family = isIPv4(normalized) ? "ipv4" : isIPv6(normalized) ? "ipv6" : undefined;
+		return family !== undefined && this.list.check(normalized, family);
+	}
+}
+
+/**
+ * The address a request came from
+ *
+ * The socket peer, or, while that address is a trusted proxy, the next
+ * X-Forwarded-For entry from the right. A malformed entry stops the walk at
+ * the proxy that forwarded it.
+ */
+export function resolveSourceAddress(
+	remoteAddress: string | undefined,
+	forwardedFor: string | string[] | undefined,
+	trustedProxies: CidrSet,
+): string | undefined {
+	if (remoteAddress === undefined) {
+		return undefined;
+	}
+	const hops = (Array.isArray(forwardedFor) ? forwardedFor.join(",") : (forwardedFor ?? ""))
+		.split(",")
+		.map((hop) => hop.trim())
+		.filter((hop) => hop.length > 0);
+
+	let address = normalizeAddress(remoteAddress);
+	while (trustedProxies.has(address)) {
+		const hop = hops.pop();
+		if (hop === undefined) {
+			break;
+		}
+		const next = normalizeAddress(hop);
+		if (!isIPv4(next) && !isIPv6(next)) {
+			break;
+		}
+		address = next;
+	}
+	return address;
+}
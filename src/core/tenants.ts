@@ -0,0 +1,160 @@
+/**
+ * Tenants - issuers served under a path prefix
+ *
+ * A multi-tenant IdP gives each tenant its own issuer URL. Every tenant
+ * registered here (in `provider.tenants`, or at /admin/tenants) is served
+ * under `/{tenant}`: `/acme/token`, `/acme/jwks` and
+ * `/acme/.well-known/openid-configuration` answer as the plain endpoints
+ * do, but discovery names `{issuer}/acme` as the issuer (and every endpoint
+ * under it), and tokens issued there carry it as `iss`. Tenants share the
+ * provider and its clients, but each signs with a key of its own that only
+ * its JWKS (`/acme/jwks`) publishes.
+ */
+
+/** Tenant IDs: a path segment of letters, digits, `-` and `_` */
+const TENANT_ID = /^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$/;
+
+/** First path segments Loki serves itself; no tenant can shadow them */
+const RESERVED_SEGMENTS = new Set([
+	"admin",
+	"auth",
+	"authorize",
+	"claims",
+	"device",
+	"device_authorization",
+	"health",
+	"healthz",
+	"interaction",
+	"introspect",
+	"jwks",
+	"me",
+	"metrics",
+	"readyz",
+	"reg",
+	"request",
+	"revocations",
+	"session",
+	"token",
+	"userinfo",
+]);
+
+/**
+ * A registered tenant
+ */
+export interface TenantStatus {
+	id: string;
+	issuer: string;
+	/** Where the tenant came from: the config, or /admin/tenants */
+	source: "config" | "admin";
+	/** The kid of the key signing the tenant's tokens, once it has one */
+	kid?: string;
+}
+
+/**
+ * The tenant a request path is under, and the path without its prefix
+ */
+export interface TenantMatch {
+	tenant: TenantStatus;
+	url: string;
+}
+
+export class TenantRegistry {
+	private readonly tenants = new Map<string, TenantStatus>();
+
+	/**
+	 * @param issuer - Loki's own issuer, which each tenant's issuer extends
+	 * @param configured - Tenant IDs from `provider.tenants`; an invalid one throws
+	 */
+	constructor(
+		private readonly issuer: string,
+		configured: string[] = [],
+	) {
+		for (const id of configured) {
+			const error = this.add(id, "config");
+			if (error !== undefined) {
+				throw new Error(`provider.tenants: ${error}`);
+			}
+		}
+	}
+
+	/** Every tenant, in registration order */
+	list(): TenantStatus[] {
+		return [...this.tenants.values()];
+	}
+
+	get(id: string): TenantStatus | undefined {
+		return this.tenants.get(id);
+	}
+
+	/**
+	 * Register a tenant; returns an error message if the ID is invalid or taken
+	 */
+	register(id: unknown): TenantStatus | string {
+		const error = this.add(id, "admin");
+		return error ?? (this.tenants.get(id as string) as TenantStatus);
+	}
+
+	/**
+	 * Remove a tenant; returns whether it was registered
+	 */
+	remove(id: string): boolean {
+		return this.tenants.delete(id);
+	}
+
+	/**
+	 * Every tenant's issuer, keyed by tenant ID
+	 */
+	issuers(): Record<string, string> {
+		return Object.fromEntries([...this.tenants].map(([id, tenant]) => [id, tenant.issuer]));
+	}
+
+	/**
+	 * The tenant a request URL is under, if its first segment names one
+	 */
+	match(url: string): TenantMatch | undefined {
+		const end = url.slice(1).search(/[/?]/);
+		const segment = end === -1 ? url.slice(1) : url.slice(1, end + 1);
+		const tenant = this.tenants.get(segment);
+		if (!tenant) {
+			return undefined;
+		}
+		const rest = url.slice(segment.length + 1);
+		return { tenant, url: rest.startsWith("/") ? rest : `/${rest}` };
+	}
+
+	private add(id: unknown, source: TenantStatus["source"]): string | undefined {
+		if (typeof id !== "string" || !TENANT_ID.test(id)) {
+			return "tenant id must be 1-64 letters, digits, '-' or '_', starting with a letter or digit";
+		}
+		if (RESERVED_SEGMENTS.has(id.toLowerCase())) {
+			return `'${id}' is a path Loki serves itself`;
+		}
+		if (this.tenants.has(id)) {
+			return `tenant '${id}' is already registered`;
+		}
+		this.tenants.set(id, { id, issuer: `${this.issuer}/${id}`, source });
+		return undefined;
+	}
+}
+
+/**
+ * A metadata document re-issued for a tenant: the issuer, and every URL
+ * under it (nested ones included), moved under the tenant's issuer
+ */
+export function tenantMetadata(
+	metadata: Record<string, unknown>,
+	issuer: string,
+	tenantIssuer: string,
+): Record<string, unknown> {
+	const moved: Record<string, unknown> = {};
+	for (const [name, value] of Object.entries(metadata)) {
+		if (typeof value === "string" && (value === issuer || value.startsWith(`${issuer}/`))) {
+			moved[name] = tenantIssuer + value.slice(issuer.length);
+		} else if (typeof value === "object" && value !== null && !Array.isArray(value)) {
+			moved[name] = tenantMetadata(value as Record<string, unknown>, issuer, tenantIssuer);
+		} else {
+			moved[name] = value;
+		}
+	}
+	return moved;
+}
@@ -0,0 +1,77 @@
+/**
+ * Token Content Type - the media type a token response is served as
+ *
+ * Token responses, successful or not, are JSON (RFC 6749 Sections 5.1 and
+ * 5.2), sent with `Cache-Control: no-store`. Some legacy clients ask for
+ * them form-encoded instead, the way a few early OAuth servers answered;
+ * Loki honours an `Accept` header that prefers
+ * `application/x-www-form-urlencoded` over JSON. JSON wins ties, and is
+ * served when the header is absent or accepts neither.
+ *
+ * For sessions, a token response served as anything but JSON is recorded
+ * as a `token-content-type` event with the `Accept` sent, the type it
+ * negotiated and the type served (which mischief may have changed).
+ */
+
+export const JSON_MEDIA_TYPE = "application/json";
+export const FORM_MEDIA_TYPE = "application/x-www-form-urlencoded";
+
+/** The media types a token response can be negotiated to */
+export type TokenMediaType = typeof JSON_MEDIA_TYPE | typeof FORM_MEDIA_TYPE;
+
+/**
+ * The media type an `Accept` header prefers for a token response
+ */
+export function negotiateTokenMediaType(accept: string | undefined): TokenMediaType {
+	if (accept === undefined) {
+		return JSON_MEDIA_TYPE;
+	}
+	let json = 0;
+	let form = 0;
+	for (const range of accept.split(",")) {
+		const [type = "", ...params] = range.split(";").map((part) => part.trim().toLowerCase());
+		const q = params.find((param) => param.startsWith("q="));
+		const quality = q === undefined ? 1 : Number(q.slice(2));
+		if (!Number.isFinite(quality)) {
+			continue;
+		}
+		if (type === JSON_MEDIA_TYPE || type === "application/*" || type === "*/*") {
+			json = Math.max(json, quality);
+		}
+		if (type === FORM_MEDIA_TYPE || type === "application/*" || type === "*/*") {
+			form = Math.max(form, quality);
+		}
+	}
+	return form > json ? FORM_MEDIA_TYPE : JSON_MEDIA_TYPE;
+}
+
+/**
+ * A JSON token response as form parameters; objects and arrays are sent as
+ * JSON, null members are left out. Undefined if the body isn't a JSON object
+ */
+export function formEncodeTokenResponse(body: string): string | undefined {
+	let parsed: unknown;
+	try {
+		parsed = JSON.parse(body);
+	} catch {
+		return undefined;
+	}
+	if (typeof parsed !== "object" || parsed === null || Array.isArray(parsed)) {
+		return undefined;
+	}
+	const form = new URLSearchParams();
+	for (const [name, value] of Object.entries(parsed)) {
+		if (value === null || value === undefined) {
+			continue;
+		}
+		form.append(name, typeof value === "object" ? JSON.stringify(value) : String(value));
+	}
+	return form.toString();
+}
+
+/**
+ * The media type of a `Content-Type` value, without parameters, in lower case
+ */
+export function mediaTypeOf(contentType: string): string {
+	return (contentType.split(";")[0] ?? "").trim().toLowerCase();
+}
@@ -0,0 +1,145 @@
+/**
+ * Token Exchange - delegation at the token endpoint (RFC 8693)
+ *
+ * A client holding a token Loki issued (the subject token) sends it to
+ * /token with the token exchange grant and gets a new access token for the
+ * same subject, for the `audience` it names. Loki answers these requests
+ * itself: oidc-provider doesn't implement the grant. The subject token,
+ * and the actor token if one is sent, must carry a valid signature from
+ * one of Loki's keys, name a Loki issuer, be within their validity window
+ * and unrevoked; anything else gets `invalid_grant`.
+ *
+ * The new token records who is acting for the subject in its `act` claim
+ * (RFC 8693 Section 4.1): the actor token's `sub`, or the client's id when
+ * it sends none. A subject token that was itself exchanged keeps its own
+ * `act` nested inside, so the outermost actor is the current one and the
+ * chain reads outermost first. A subject token carrying `may_act` (Section
+ * 4.4) may only be exchanged by the actor it names, and the new token
+ * carries it on. The session's attack report shows the actor chain Loki
+ * issued next to the one the token was sent with.
+ */
+
+/** grant_type of a token exchange request (RFC 8693 Section 2.1) */
+export const TOKEN_EXCHANGE_GRANT = "urn:ietf:params:oauth:grant-type:token-exchange";
+
+/** Token type identifiers (RFC 8693 Section 3) */
+export const ACCESS_TOKEN_TYPE = "urn:ietf:params:oauth:token-type:access_token";
+export const JWT_TOKEN_TYPE = "urn:ietf:params:oauth:token-type:jwt";
+export const ID_TOKEN_TYPE = "urn:ietf:params:oauth:token-type:id_token";
+
+/** Token types a subject or actor token may be sent as */
+export const EXCHANGEABLE_TOKEN_TYPES = [ACCESS_TOKEN_TYPE, JWT_TOKEN_TYPE, ID_TOKEN_TYPE];
+
+/** Token types Loki issues in an exchange: a JWT access token either way */
+const ISSUED_TOKEN_TYPES = [ACCESS_TOKEN_TYPE, JWT_TOKEN_TYPE];
+
+/** Lifetime of an exchanged access token, in seconds */
+export const EXCHANGED_TOKEN_LIFETIME = 3600;
+
+/** Upper bound on the actors a chain is read to */
+const MAX_ACTORS = 32;
+
+/** A token exchange request's parameters */
+export interface ExchangeRequest {
+	subjectToken: string;
+	subjectTokenType: string;
+	actorToken?: string;
+	actorTokenType?: string;
+	/** The audiences named, each listed once, in the order first given */
+	audience: string[];
+}
+
+/** What an answered exchange asked for and issued, for the session's report */
+export interface TokenExchange {
+	/** The audiences requested; empty when the default was issued */
+	audience: string[];
+	/** The actor chain issued, the current actor first */
+	actors: string[];
+}
+
+/** An `act` claim: the current actor, and the actors before it */
+export interface ActClaim {
+	sub: string;
+	act?: unknown;
+}
+
+/**
+ * Read a token exchange request from its form-encoded body; a string is
+ * why it's invalid
+ */
+export function parseExchangeRequest(body: Buffer): ExchangeRequest | string {
+	const form = new URLSearchParams(body.toString());
+	const subjectToken = form.get("subject_token");
+	const subjectTokenType = form.get("subject_token_type");
+	if (!subjectToken || !subjectTokenType) {
+		return "subject_token and subject_token_type are required";
+	}
+	if (!EXCHANGEABLE_TOKEN_TYPES.includes(subjectTokenType)) {
+		return `subject_token_type must be one of ${EXCHANGEABLE_TOKEN_TYPES.join(", ")}`;
+	}
+	const request: ExchangeRequest = {
+		subjectToken,
+		subjectTokenType,
+		audience: [...new Set(form.getAll("audience"))],
+	};
+
+	const actorToken = form.get("actor_token");
+	const actorTokenType = form.get("actor_token_type");
+	if (actorToken) {
+		if (!actorTokenType || !EXCHANGEABLE_TOKEN_TYPES.includes(actorTokenType)) {
+			return `actor_token_type must be one of ${EXCHANGEABLE_TOKEN_TYPES.join(", ")}`;
+		}
+		request.actorToken = actorToken;
+		request.actorTokenType = actorTokenType;
+	} else if (actorTokenType) {
+		return "actor_token_type must not be sent without actor_token";
+	}
+
+	const requested = form.get("requested_token_type");
+	if (requested && !ISSUED_TOKEN_TYPES.includes(requested)) {
+		return `requested_token_type must be one of ${ISSUED_TOKEN_TYPES.join(", ")}`;
+	}
+	return request;
+}
+
+/**
+ * The `act` claim for `actor` acting on a subject token whose own `act`
+ * is `previous`
+ */
+export function delegate(actor: string, previous: unknown): ActClaim {
+	const act: ActClaim = { sub: actor };
+	if (isActClaim(previous)) {
+		act.act = previous;
+	}
+	return act;
+}
+
+/**
+ * The actors an `act` claim names, the current actor first; empty when
+ * there is none
+ */
+export function actorChain(act: unknown): string[] {
+	const chain: string[] = [];
+	let current = act;
+	while (isActClaim(current) && chain.length < MAX_ACTORS) {
+		chain.push(current.sub);
+		current = current.act;
+	}
+	return chain;
+}
+
+/**
+ * Whether a subject token's `may_act` lets `actor` act for it: any actor
+ * may when it carries none
+ */
+export function mayAct(mayActClaim: unknown, actor: string): boolean {
+	return mayActClaim === undefined || (isActClaim(mayActClaim) && mayActClaim.sub === actor);
+}
+
+function isActClaim(value: unknown): value is ActClaim {
+	return (
+		typeof value === "object" &&
+		value !== null &&
+		typeof (value as Record<string, unknown>).sub === "string"
+	);
+}
@@ -5,6 +5,13 @@
  * This is the heart of Loki's token corruption abilities.
  */
 
+import {
+	KeyObject,
+	constants,
+	createHash,
+	createPrivateKey,
+	sign as cryptoSign,
+} from "node:crypto";
 import * as jose from "jose";
 
 export interface ForgeableToken {
@@ -16,6 +23,37 @@ export interface ForgeableToken {
 	claims: JWTClaims;
 	/** Current signature (empty string for unsigned) */
 	signature: string;
+	/**
+	 * Exact header JSON to emit instead of serializing `header`
+	 *
+	 * Lets plugins produce headers a JSON object can't represent (duplicate
+	 * members, specific key order). Signing covers these exact bytes.
+	 */
+	rawHeader: string | undefined;
+	/**
+	 * Exact payload JSON to emit instead of serializing `claims`
+	 *
+	 * Lets plugins produce claims sets a JSON object can't represent
+	 * (duplicate claim names). Signing covers these exact bytes.
+	 */
+	rawPayload: string | undefined;
+	/**
+	 * Whether the header sets `b64: false` (RFC 7797): the payload is then
+	 * signed and emitted as is rather than base64url-encoded, and detached
+	 * (left out of the token) when it contains a '.'
+	 */
+	readonly unencodedPayload: boolean;
+	/**
+	 * Segments to emit in standard base64 (`+`, `/` and `=` padding) instead
+	 * of base64url; signing covers the header and payload as emitted
+	 */
+	standardBase64: TokenSegment[];
+	/**
+	 * SD-JWT disclosures emitted after the JWS, each followed by a `~`;
+	 * undefined for a plain JWT. They aren't signed: the payload's `_sd`
+	 * digests cover them
+	 */
+	disclosures: string[] | undefined;
 	/** Get the public key used to sign this token */
 	getPublicKey(): Promise<string>;
 	/** Re-sign the token with a specific algorithm and key */
@@ -24,6 +62,9 @@ export interface ForgeableToken {
 	build(): string;
 }
 
+/** The three segments of a compact JWS */
+export type TokenSegment = "header" | "payload" | "signature";
+
 export interface JWTHeader {
 	alg: string;
 	typ?: string;
@@ -43,10 +84,11 @@ export interface JWTClaims {
 }
 
 /**
- * Parse a JWT into a forgeable token
+ * Parse a JWT, or an SD-JWT with its disclosures, into a forgeable token
  */
 export function parseToken(jwt: string, publicKeyPem?: string): ForgeableToken {
-	const parts = jwt.split(".");
+	const [jws = "", ...disclosures] = jwt.split("~");
+	const parts = jws.split(".");
 	if (parts.length !== 3) {
 		throw new Error("Invalid JWT format: expected 3 parts");
 	}
@@ -54,9 +96,15 @@ export function parseToken(jwt: string, publicKeyPem?: string): ForgeableToken {
 	const [headerB64, payloadB64, signatureB64] = parts as [string, string, string];
 
 	const header = JSON.parse(base64UrlDecode(headerB64)) as JWTHeader;
-	const claims = JSON.parse(base64UrlDecode(payloadB64)) as JWTClaims;
+	// An unencoded payload (RFC 7797) is the claims JSON itself
+	const payload = header.b64 === false ? payloadB64 : base64UrlDecode(payloadB64);
+	const claims = JSON.parse(payload) as JWTClaims;
 
 	let currentSignature = signatureB64;
+	let currentRawHeader: string | undefined;
+	let currentRawPayload: string | undefined;
+	let currentStandardBase64: TokenSegment[] = [];
+	let currentDisclosures = jwt.includes("~") ? disclosures.filter((d) => d !== "") : undefined;
 	let currentHeader = { ...header };
 	let currentClaims = { ...claims };
 
@@ -84,6 +132,38 @@ export function parseToken(jwt: string, publicKeyPem?: string): ForgeableToken {
 			currentSignature = value;
 		},
 
+		get rawHeader() {
+			return currentRawHeader;
+		},
+		set rawHeader(value: string | undefined) {
+			currentRawHeader = value;
+		},
+
+		get rawPayload() {
+			return currentRawPayload;
+		},
+		set rawPayload(value: string | undefined) {
+			currentRawPayload = value;
+		},
+
+		get unencodedPayload() {
+			return emittedHeader(currentHeader, currentRawHeader).b64 === false;
+		},
+
+		get standardBase64() {
+			return currentStandardBase64;
+		},
+		set standardBase64(value: TokenSegment[]) {
+			currentStandardBase64 = value;
+		},
+
+		get disclosures() {
+			return currentDisclosures;
+		},
+		set disclosures(value: string[] | undefined) {
+			currentDisclosures = value;
+		},
+
 		async getPublicKey(): Promise<string> {
 			if (publicKeyPem) {
 				return publicKeyPem;
@@ -93,17 +173,22 @@ export function parseToken(jwt: string, publicKeyPem?: string): ForgeableToken {
 		},
 
 		async sign(alg: string, key: string | Uint8Array | jose.KeyLike): Promise<void> {
-			currentHeader.alg = alg;
+			if (currentRawHeader === undefined) {
+				currentHeader.alg = alg;
+			}
 
 			if (alg === "none") {
 				currentSignature = "";
 				return;
 			}
 
-			// Build the signing input
-			const headerB64New = base64UrlEncode(JSON.stringify(currentHeader));
-			const payloadB64New = base64UrlEncode(JSON.stringify(currentClaims));
+			// Build the signing input; an unencoded payload is signed as is (RFC 7797 Section 3)
+			const payload = currentRawPayload ?? JSON.stringify(currentClaims);
+			const headerJson = currentRawHeader ?? JSON.stringify(currentHeader);
+			const headerB64New = encodeSegment("header", headerJson);
+			const payloadB64New = token.unencodedPayload ? payload : encodeSegment("payload", payload);
 			const signingInput = `${headerB64New}.${payloadB64New}`;
+			const standardInput = currentStandardBase64.some((segment) => segment !== "signature");
 
 			// Sign based on algorithm family
 			if (alg.startsWith("HS")) {
@@ -122,12 +207,14 @@ export function parseToken(jwt: string, publicKeyPem?: string): ForgeableToken {
 					new TextEncoder().encode(signingInput),
 				);
 				currentSignature = base64UrlEncodeBytes(new Uint8Array(signatureBytes));
+			} else if (currentRawHeader !== undefined || token.unencodedPayload || standardInput) {
+				// jose would re-serialize the header (or encode the payload), so sign
+				// the raw bytes directly
+				currentSignature = signRaw(alg, signingInput, key);
 			} else {
 				// For RS/PS/ES algorithms, use jose
 				const privateKey = typeof key === "string" ? await jose.importPKCS8(key, alg) : key;
-				const jws = await new jose.CompactSign(
-					new TextEncoder().encode(JSON.stringify(currentClaims)),
-				)
+				const jws = await new jose.CompactSign(new TextEncoder().encode(payload))
 					.setProtectedHeader(currentHeader)
 					.sign(privateKey);
 				const newParts = jws.split(".");
@@ -136,21 +223,57 @@ export function parseToken(jwt: string, publicKeyPem?: string): ForgeableToken {
 		},
 
 		build(): string {
-			const headerB64 = base64UrlEncode(JSON.stringify(currentHeader));
-			const payloadB64 = base64UrlEncode(JSON.stringify(currentClaims));
-
-			if (currentHeader.alg === "none" || currentSignature === "") {
-				// For alg:none, some implementations expect trailing dot, some don't
-				return `${headerB64}.${payloadB64}.`;
+			const headerB64 = encodeSegment("header", currentRawHeader ?? JSON.stringify(currentHeader));
+			const payload = currentRawPayload ?? JSON.stringify(currentClaims);
+			let payloadB64 = encodeSegment("payload", payload);
+			if (token.unencodedPayload) {
+				// A '.' would split the compact form, so such a payload is detached (RFC 7797 Section 5.2)
+				payloadB64 = payload.includes(".") ? "" : payload;
 			}
+			const signature = currentStandardBase64.includes("signature")
+				? standardBase64(currentSignature)
+				: currentSignature;
 
-			return `${headerB64}.${payloadB64}.${currentSignature}`;
+			// An unsigned token keeps its trailing dot; an alg:none token only
+			// carries a signature when mischief put one there
+			const jws = `${headerB64}.${payloadB64}.${signature}`;
+			return currentDisclosures === undefined
+				? jws
+				: `${jws}~${currentDisclosures.map((d) => `${d}~`).join("")}`;
 		},
 	};
 
+	function encodeSegment(segment: TokenSegment, json: string): string {
+		const encoded = base64UrlEncode(json);
+		return currentStandardBase64.includes(segment) ? standardBase64(encoded) : encoded;
+	}
+
 	return token;
 }
 
+/**
+ * Re-encode a base64url string in standard base64, with `+`, `/` and `=` padding
+ */
+export function standardBase64(base64url: string): string {
+	const encoded = base64url.replace(/-/g, "+").replace(/_/g, "/");
+	return encoded.padEnd(Math.ceil(encoded.length / 4) * 4, "=");
+}
+
+/**
+ * The header a token emits: its raw header parsed, if it has one
+ */
+function emittedHeader(header: JWTHeader, rawHeader: string | undefined): Record<string, unknown> {
+	if (rawHeader === undefined) {
+		return header;
+	}
+	try {
+		const parsed: unknown = JSON.parse(rawHeader);
+		return typeof parsed === "object" && parsed !== null ? (parsed as Record<string, unknown>) : {};
+	} catch {
+		return {};
+	}
+}
+
 /**
  * Create a new token from scratch
  */
@@ -174,6 +297,54 @@ export async function signWithKeyConfusion(
 	await token.sign("HS256", publicKeyPem);
 }
 
+/**
+ * An at_hash or c_hash value: the left half of the token's hash under the
+ * ID token's alg, base64url-encoded (OIDC Core Section 3.3.2.11)
+ */
+export function tokenHash(value: string, alg: string): string {
+	const bits = alg === "EdDSA" ? "512" : alg.slice(2);
+	const digest = createHash(`sha${bits}`).update(value, "ascii").digest();
+	return digest.subarray(0, digest.length / 2).toString("base64url");
+}
+
+/**
+ * Sign a JWS signing input with an asymmetric key, without touching the header
+ */
+function signRaw(
+	alg: string,
+	signingInput: string,
+	key: string | Uint8Array | jose.KeyLike,
+): string {
+	let keyObject: KeyObject;
+	if (typeof key === "string") {
+		keyObject = createPrivateKey(key);
+	} else if (key instanceof KeyObject) {
+		keyObject = key;
+	} else if (key instanceof Uint8Array) {
+		throw new Error(`Raw key bytes are not supported for ${alg}`);
+	} else {
+		keyObject = KeyObject.from(key as CryptoKey);
+	}
+
+	const data = Buffer.from(signingInput);
+	const hash = alg === "EdDSA" ? null : `sha${alg.slice(2)}`;
+	let signature: Buffer;
+
+	if (alg.startsWith("PS")) {
+		signature = cryptoSign(hash, data, {
+			key: keyObject,
+			padding: constants.RSA_PKCS1_PSS_PADDING,
+			saltLength: constants.RSA_PSS_SALTLEN_DIGEST,
+		});
+	} else if (alg.startsWith("ES")) {
+		signature = cryptoSign(hash, data, { key: keyObject, dsaEncoding: "ieee-p1363" });
+	} else {
+		signature = cryptoSign(hash, data, keyObject);
+	}
+
+	return signature.toString("base64url");
+}
+
 // === Base64URL utilities ===
 
 function base64UrlEncode(str: string): string {
@@ -0,0 +1,48 @@
+/**
+ * Token Freeze - replay one captured token response
+ *
+ * A frozen session serves the exact token response it captured, so a
+ * client team can iterate against a single reproducible malicious token
+ * instead of one whose timestamps, jti and signature change per request.
+ */
+
+import type { ManagedKey } from "./key-manager.js";
+import { parseToken } from "./token-forge.js";
+
+/**
+ * Move a frozen JWT's iat/nbf/exp forward, keeping its lifetime
+ *
+ * Tokens signed with Loki's active algorithm are re-signed so they stay
+ * valid. Unsigned tokens stay unsigned; any other signature is carried over
+ * unchanged (and, like the mischief that produced it, won't verify).
+ */
+export async function refreshTokenTimes(
+	jwt: string,
+	key: ManagedKey,
+	nowSeconds: number,
+): Promise<string> {
+	// A detached payload (RFC 7797) leaves no times to move
+	if (jwt.split(".")[1] === "") {
+		return jwt;
+	}
+	const token = parseToken(jwt);
+	// Keep the header bytes exactly as captured (case, member order, duplicates)
+	token.rawHeader = Buffer.from(jwt.split(".")[0] ?? "", "base64url").toString();
+	const { iat, exp } = token.claims;
+	const lifetime = typeof iat === "number" && typeof exp === "number" ? exp - iat : undefined;
+
+	if (typeof iat === "number") {
+		token.claims.iat = nowSeconds;
+	}
+	if (typeof token.claims.nbf === "number") {
+		token.claims.nbf = nowSeconds;
+	}
+	if (lifetime !== undefined) {
+		token.claims.exp = nowSeconds + lifetime;
+	}
+
+	if (token.header.alg === key.alg && token.signature !== "") {
+		await token.sign(key.alg, key.privateKey);
+	}
+	return token.build();
+}
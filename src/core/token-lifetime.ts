@@ -0,0 +1,53 @@
+/**
+ * Token Lifetime - how long access tokens live, and what the client is told
+ *
+ * Access tokens live `provider.accessTokenTtl` seconds (default 3600). A
+ * session's `tokenLifetime` overrides that for its own JWT access tokens:
+ * `exp` is set that long after `iat` and the token re-signed, and the
+ * token response's `expires_in` says the same. A client may schedule its
+ * refresh from either, so the two only disagree under mischief
+ * (`expires-in-mismatch`); each access token's issuance in the session
+ * report records both.
+ */
+
+import { parseDuration } from "./duration.js";
+
+/** An access token's `expires_in` next to the `exp` it carries */
+export interface TokenExpiry {
+	/** The token response's expires_in, in seconds */
+	expiresIn: number;
+	/** The token's exp claim, null if absent */
+	exp: unknown;
+	/** Seconds exp lies past (negative: short of) what expires_in implies; null if not a number */
+	difference: number | null;
+}
+
+/**
+ * Whether a value is a token lifetime: a Go duration of whole seconds, at least 1s
+ */
+export function isTokenLifetime(value: unknown): value is string {
+	const ms = typeof value === "string" ? parseDuration(value) : undefined;
+	return ms !== undefined && ms >= 1000 && ms % 1000 === 0;
+}
+
+/**
+ * A token lifetime in seconds
+ */
+export function tokenLifetimeSeconds(lifetime: string): number {
+	return Math.floor((parseDuration(lifetime) ?? 0) / 1000);
+}
+
+/**
+ * Compare an access token's exp with the expires_in it was sent with,
+ * counted from its iat (or now, for a token without one)
+ */
+export function tokenExpiry(
+	claims: Record<string, unknown>,
+	expiresIn: number,
+	now = Math.floor(Date.now() / 1000),
+): TokenExpiry {
+	const exp = claims.exp ?? null;
+	const issuedAt = typeof claims.iat === "number" ? claims.iat : now;
+	const difference = typeof exp === "number" ? exp - (issuedAt + expiresIn) : null;
+	return { expiresIn, exp, difference };
+}
@@ -0,0 +1,191 @@
+/**
+ * Token Results - the client under test's verdict on each issued token
+ *
+ * Loki records every JWT a session issues under its `jti`, together with
+ * the token mischief applied to it. The client reports back whether it
+ * accepted or rejected each token, and the verdicts are aggregated per
+ * plugin: rejecting a tampered token passes, accepting it fails. Tokens
+ * issued without mischief are the baseline, which the client should
+ * accept - a client that rejects everything doesn't pass either.
+ *
+ * Tokens without a `jti` (oidc-provider's ID tokens, opaque tokens) can't
+ * be reported on and are not recorded.
+ */
+
+import * as jose from "jose";
+import type { OutcomeReport } from "../ledger/types.js";
+import { activeRequestId } from "./request-id.js";
+
+/** Issued tokens remembered per session */
+const MAX_TOKENS = 1000;
+
+/** Failed verdicts listed in a results report */
+const MAX_FAILURES = 100;
+
+export interface IssuedToken {
+	jti: string;
+	tokenType: string;
+	/** Token mischief applied; empty for a baseline token */
+	mischief: string[];
+	issuedAt: string;
+	/** Correlation ID of the token request that issued it */
+	requestId?: string;
+	verdict?: OutcomeReport & { reportedAt: string };
+}
+
+export interface OutcomeCounts {
+	issued: number;
+	/** Verdicts that match the expectation (tampered rejected, baseline accepted) */
+	passed: number;
+	failed: number;
+	/** Issued tokens nobody reported on yet */
+	pending: number;
+	/** passed / (passed + failed); null until something was reported */
+	passRate: number | null;
+}
+
+export interface SessionResults {
+	sessionId: string;
+	/** CI gate: at least one verdict, and none failed */
+	passed: boolean;
+	totals: OutcomeCounts;
+	baseline: OutcomeCounts;
+	mischief: Record<string, OutcomeCounts>;
+	/** Tokens whose verdict failed, most recent last */
+	failures: IssuedToken[];
+}
+
+/**
+ * Issued tokens and reported verdicts, per session
+ */
+export class TokenResults {
+	private readonly sessions = new Map<string, Map<string, IssuedToken>>();
+
+	/**
+	 * Record a token issued to a session
+	 */
+	issue(sessionId: string, jti: string, tokenType: string, mischief: string[]): void {
+		let tokens = this.sessions.get(sessionId);
+		if (!tokens) {
+			tokens = new Map();
+			this.sessions.set(sessionId, tokens);
+		}
+		const token: IssuedToken = { jti, tokenType, mischief, issuedAt: new Date().toISOString() };
+		const requestId = activeRequestId();
+		if (requestId !== undefined) {
+			token.requestId = requestId;
+		}
+		tokens.delete(jti);
+		tokens.set(jti, token);
+		if (tokens.size > MAX_TOKENS) {
+			const oldest = tokens.keys().next().value as string;
+			tokens.delete(oldest);
+		}
+	}
+
+	/**
+	 * Record the client's verdict on a token; a later report replaces an
+	 * earlier one. Returns the token, or undefined if the session never
+	 * issued that jti.
+	 */
+	report(sessionId: string, verdict: OutcomeReport): IssuedToken | undefined {
+		const token = this.sessions.get(sessionId)?.get(verdict.jti);
+		if (!token) {
+			return undefined;
+		}
+		token.verdict = { ...verdict, reportedAt: new Date().toISOString() };
+		return token;
+	}
+
+	getResults(sessionId: string): SessionResults {
+		const tokens = [...(this.sessions.get(sessionId)?.values() ?? [])];
+		const totals = emptyCounts();
+		const baseline = emptyCounts();
+		const mischief: Record<string, OutcomeCounts> = {};
+		const failures: IssuedToken[] = [];
+
+		for (const token of tokens) {
+			const outcome = outcomeOf(token);
+			const groups = token.mischief.length === 0 ? [baseline] : [];
+			for (const id of token.mischief) {
+				let counts = mischief[id];
+				if (!counts) {
+					counts = emptyCounts();
+					mischief[id] = counts;
+				}
+				groups.push(counts);
+			}
+			for (const counts of [totals, ...groups]) {
+				counts.issued++;
+				counts[outcome]++;
+			}
+			if (outcome === "failed") {
+				failures.push(token);
+			}
+		}
+
+		for (const counts of [totals, baseline, ...Object.values(mischief)]) {
+			const reported = counts.passed + counts.failed;
+			counts.passRate = reported > 0 ? counts.passed / reported : null;
+		}
+
+		return {
+			sessionId,
+			passed: totals.failed === 0 && totals.passed > 0,
+			totals,
+			baseline,
+			mischief,
+			failures: failures.slice(-MAX_FAILURES),
+		};
+	}
+
+	/**
+	 * Every session's tokens issued by one request
+	 */
+	findByRequest(requestId: string): (IssuedToken & { sessionId: string })[] {
+		const found: (IssuedToken & { sessionId: string })[] = [];
+		for (const [sessionId, tokens] of this.sessions) {
+			for (const token of tokens.values()) {
+				if (token.requestId === requestId) {
+					found.push({ sessionId, ...token });
+				}
+			}
+		}
+		return found;
+	}
+
+	clear(sessionId: string): void {
+		this.sessions.delete(sessionId);
+	}
+
+	clearAll(): void {
+		this.sessions.clear();
+	}
+}
+
+function outcomeOf(token: IssuedToken): "passed" | "failed" | "pending" {
+	if (!token.verdict) {
+		return "pending";
+	}
+	const expectAccepted = token.mischief.length === 0;
+	return token.verdict.accepted === expectAccepted ? "passed" : "failed";
+}
+
+function emptyCounts(): OutcomeCounts {
+	return { issued: 0, passed: 0, failed: 0, pending: 0, passRate: null };
+}
+
+/**
+ * The jti of a JWT; undefined for opaque or undecodable tokens and tokens without one
+ */
+export function tokenJti(token: string): string | undefined {
+	if (token.split(".").length !== 3) {
+		return undefined;
+	}
+	try {
+		const { jti } = jose.decodeJwt(token);
+		return typeof jti === "string" && jti.length > 0 ? jti : undefined;
+	} catch {
+		return undefined;
+	}
+}
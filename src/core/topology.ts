@@ -0,0 +1,264 @@
+/**
+ * Topology - declarative standing sessions
+ *
+ * A topology document lists the sessions that should exist, each under a
+ * stable id. Applying it reconciles Loki to the document: missing sessions
+ * are created, drifted ones are updated in place (keeping their ledger and
+ * events), and sessions from an earlier apply that the document no longer
+ * lists are deleted. Sessions created through the sessions API are never
+ * touched, and applying the same document twice changes nothing.
+ *
+ * Documents double as shareable session bundles. `pluginVersions` records
+ * the config schema version each plugin's `pluginConfig` was written for
+ * (a document without it predates versioning: every version is 1); config
+ * from an older schema is migrated by the plugin, and a document that can't
+ * be migrated is rejected like any other invalid one.
+ *
+ * Clients are part of the provider configuration and fixed at startup, and
+ * Loki has no realms, resources or users to declare, so documents naming
+ * them are rejected rather than half-applied.
+ */
+
+import type { PluginRegistry } from "../plugins/registry.js";
+import { isPlainObject, parseSessionSpec, sessionSpec } from "./session-spec.js";
+import type {
+	Session,
+	SessionConfig,
+	SessionsConfig,
+	TopologyDocument,
+	TopologySession,
+} from "./types.js";
+
+/** Ids usable for declared sessions (they are sent back in X-Loki-Session) */
+const SESSION_ID_PATTERN = /^[A-Za-z0-9][A-Za-z0-9_.:-]{0,127}$/;
+
+/** Session settings a topology declares, compared to detect drift */
+const DECLARED_FIELDS = [
+	"name",
+	"mode",
+	"mischief",
+	"probability",
+	"probabilities",
+	"seed",
+	"warmupRequests",
+	"pluginConfig",
+	"targets",
+	"ttl",
+	"when",
+	"keyId",
+	"webhook",
+	"maxTokensPerSecond",
+	"sdJwt",
+	"audFormat",
+	"tokenLifetime",
+] as const;
+
+/** Top-level keys other tools use that Loki can't reconcile */
+const UNSUPPORTED_KEYS: Record<string, string> = {
+	clients: "clients are fixed at startup by the provider configuration",
+	realms: "Loki serves a single issuer and has no realms",
+	resources: "Loki has no resource registry",
+	users: "Loki has no user registry",
+};
+
+export interface DeclaredSession {
+	id: string;
+	config: Partial<SessionConfig>;
+}
+
+export interface TopologyUpdate {
+	id: string;
+	/** Declared settings that differ from the running session */
+	fields: string[];
+}
+
+export interface TopologyPlan {
+	created: string[];
+	updated: TopologyUpdate[];
+	deleted: string[];
+	unchanged: string[];
+}
+
+export type TopologyParseResult =
+	| { ok: true; sessions: DeclaredSession[] }
+	| { ok: false; errors: string[] };
+
+export type TopologyPlanResult = { ok: true; plan: TopologyPlan } | { ok: false; errors: string[] };
+
+/**
+ * Validate a whole topology document, collecting every error
+ *
+ * With a plugin registry, mischief must name known plugins and plugin
+ * config is migrated to the current schema versions.
+ */
+export function parseTopology(
+	document: unknown,
+	sessionsConfig: Required<SessionsConfig>,
+	plugins?: PluginRegistry,
+): TopologyParseResult {
+	if (!isPlainObject(document)) {
+		return { ok: false, errors: ["topology must be an object"] };
+	}
+
+	const errors: string[] = [];
+	for (const key of Object.keys(document)) {
+		const unsupported = UNSUPPORTED_KEYS[key];
+		if (unsupported !== undefined) {
+			errors.push(`${key}: not supported (${unsupported})`);
+		} else if (key !== "sessions" && key !== "pluginVersions") {
+			errors.push(`${key}: unknown topology key`);
+		}
+	}
+
+	const versions = document.pluginVersions ?? {};
+	if (!isPlainObject(versions) || !Object.values(versions).every(isVersion)) {
+		return {
+			ok: false,
+			errors: [...errors, "pluginVersions must map plugin IDs to positive integer versions"],
+		};
+	}
+
+	const specs = document.sessions ?? [];
+	if (!Array.isArray(specs)) {
+		return { ok: false, errors: [...errors, "sessions must be an array"] };
+	}
+
+	const sessions: DeclaredSession[] = [];
+	const seen = new Set<string>();
+	specs.forEach((spec: unknown, index) => {
+		const id = isPlainObject(spec) ? spec.id : undefined;
+		if (typeof id !== "string" || !SESSION_ID_PATTERN.test(id)) {
+			errors.push(`sessions[${index}].id must be 1-128 letters, digits or '_', '.', ':', '-'`);
+			return;
+		}
+		if (seen.has(id)) {
+			errors.push(`sessions[${index}].id '${id}' is declared more than once`);
+			return;
+		}
+		seen.add(id);
+		const parsed = parseSessionSpec(spec, sessionsConfig);
+		if (!parsed.ok) {
+			errors.push(`sessions[${index}]: ${parsed.error}`);
+			return;
+		}
+		if (plugins) {
+			const error = migratePlugins(parsed.config, versions as Record<string, number>, plugins);
+			if (error !== undefined) {
+				errors.push(`sessions[${index}]: ${error}`);
+				return;
+			}
+		}
+		sessions.push({ id, config: parsed.config });
+	});
+
+	return errors.length > 0 ? { ok: false, errors } : { ok: true, sessions };
+}
+
+/**
+ * Work out what applying the declared sessions to the running ones would change
+ *
+ * A declared id that belongs to a session created through the sessions API
+ * is an error: the topology only manages sessions it created.
+ */
+export function diffTopology(current: Session[], declared: DeclaredSession[]): TopologyPlanResult {
+	const running = new Map(current.map((session) => [session.id, session]));
+	const plan: TopologyPlan = { created: [], updated: [], deleted: [], unchanged: [] };
+	const errors: string[] = [];
+
+	for (const { id, config } of declared) {
+		const session = running.get(id);
+		if (!session) {
+			plan.created.push(id);
+		} else if (!session.declared) {
+			errors.push(`session '${id}' exists but was not created by a topology`);
+		} else {
+			const fields = driftedFields(session, config);
+			if (fields.length > 0) {
+				plan.updated.push({ id, fields });
+			} else {
+				plan.unchanged.push(id);
+			}
+		}
+	}
+
+	const ids = new Set(declared.map((session) => session.id));
+	for (const session of current) {
+		if (session.declared && !ids.has(session.id)) {
+			plan.deleted.push(session.id);
+		}
+	}
+
+	return errors.length > 0 ? { ok: false, errors } : { ok: true, plan };
+}
+
+/**
+ * Check a session's plugins exist and migrate its plugin config in place;
+ * returns an error message if that's impossible
+ */
+function migratePlugins(
+	config: Partial<SessionConfig>,
+	versions: Record<string, number>,
+	plugins: PluginRegistry,
+): string | undefined {
+	const unknown = (config.mischief ?? []).find((id) => !plugins.has(id));
+	if (unknown !== undefined) {
+		return `unknown plugin '${unknown}'`;
+	}
+	if (config.pluginConfig === undefined) {
+		return undefined;
+	}
+	const migrated: Record<string, Record<string, unknown>> = {};
+	for (const [id, options] of Object.entries(config.pluginConfig)) {
+		try {
+			migrated[id] = plugins.migrateConfig(id, options, versions[id] ?? 1);
+		} catch (err) {
+			return `pluginConfig: ${(err as Error).message}`;
+		}
+	}
+	config.pluginConfig = migrated;
+	return undefined;
+}
+
+/**
+ * Declared sessions as a document that recreates them, stamped with the
+ * config schema version of every plugin they use
+ */
+export function exportTopology(sessions: Session[], plugins: PluginRegistry): TopologyDocument {
+	const declared = sessions.filter((session) => session.declared);
+	const used = new Set(
+		declared.flatMap((session) => [
+			...session.mischief,
+			...Object.keys(session.pluginConfig ?? {}),
+		]),
+	);
+
+	const pluginVersions: Record<string, number> = {};
+	for (const id of [...used].sort()) {
+		const version = plugins.configVersion(id);
+		if (version !== undefined) {
+			pluginVersions[id] = version;
+		}
+	}
+
+	return { pluginVersions, sessions: declared.map(topologySession) };
+}
+
+function topologySession(session: Session): TopologySession {
+	return { id: session.id, ...sessionSpec(session) };
+}
+
+function isVersion(value: unknown): boolean {
+	return Number.isInteger(value) && (value as number) >= 1;
+}
+
+function driftedFields(session: Session, config: Partial<SessionConfig>): string[] {
+	// A zero warm-up is never stored on the session, and an undeclared seed is picked at creation
+	const declared = {
+		...config,
+		warmupRequests: config.warmupRequests || undefined,
+		seed: config.seed ?? session.seed,
+	};
+	return DECLARED_FIELDS.filter(
+		(field) => JSON.stringify(session[field]) !== JSON.stringify(declared[field]),
+	);
+}
@@ -0,0 +1,175 @@
+/**
+ * Transient Keys - signing keys published in a session's JWKS for a short window
+ *
+ * A provider that rotates keys publishes the new key before signing with
+ * it, and a client that meets an unknown `kid` is expected to refetch the
+ * JWKS (OIDC Core Section 10.1.1). jwks-key-rotation-race signs a token
+ * with a brand-new key that Loki publishes only for a window: a number of
+ * JWKS fetches, or seconds after the key was added. A client that refetches
+ * when it sees the unknown kid finds the key; one that refetches too late,
+ * or revalidates against a JWKS cached after the key was removed, doesn't.
+ *
+ * When each key was added and removed is kept for the session's attack report.
+ *
+ * jwks-cache-poison and jwks-no-cache rotate to a new key for every token
+ * the same way, and also set the `Cache-Control` the session's JWKS is
+ * served with: a very long `max-age`, or `no-store`.
+ */
+
+import type * as jose from "jose";
+
+/** Upper bound on transient keys kept per session */
+const MAX_KEYS_PER_SESSION = 20;
+
+/**
+ * How long a transient key is published; whichever limit is reached first
+ * removes it, and a key with neither is served for a single JWKS fetch
+ */
+export interface TransientKeyWindow {
+	/** JWKS responses the key appears in */
+	fetches?: number;
+	/** Seconds after the key is added */
+	seconds?: number;
+}
+
+/** A transient key's lifetime, as reported */
+export interface TransientKeyRecord {
+	kid: string;
+	addedAt: string;
+	/** When the key left the JWKS; null while it is still published */
+	removedAt: string | null;
+	/** JWKS responses the key appeared in */
+	fetches: number;
+	window: TransientKeyWindow;
+}
+
+/**
+ * Transient key helpers handed to plugins, bound to the current session
+ */
+export interface TransientKeyPublisher {
+	/** Publish a public key in the session's JWKS for a window */
+	publish(jwk: jose.JWK, window: TransientKeyWindow): void;
+	/** Serve the session's JWKS with this Cache-Control */
+	cacheControl(value: string): void;
+}
+
+interface TransientKey {
+	jwk: jose.JWK;
+	window: TransientKeyWindow;
+	addedAt: number;
+	removedAt?: number;
+	fetches: number;
+}
+
+/**
+ * Transient Key Store - the keys each session publishes for a window
+ */
+export class TransientKeyStore {
+	private readonly sessions = new Map<string, TransientKey[]>();
+	private readonly cacheControls = new Map<string, string>();
+
+	/**
+	 * Publish a public key in a session's JWKS for a window
+	 */
+	publish(sessionId: string, jwk: jose.JWK, window: TransientKeyWindow, now = Date.now()): void {
+		let keys = this.sessions.get(sessionId);
+		if (!keys) {
+			keys = [];
+			this.sessions.set(sessionId, keys);
+		}
+		const limited = window.fetches !== undefined || window.seconds !== undefined;
+		keys.push({ jwk, window: limited ? window : { fetches: 1 }, addedAt: now, fetches: 0 });
+		if (keys.length > MAX_KEYS_PER_SESSION) {
+			keys.shift();
+		}
+	}
+
+	/**
+	 * The keys to add to a session's JWKS response, counting the fetch
+	 * against each key's window
+	 */
+	serve(sessionId: string, now = Date.now()): jose.JWK[] {
+		const served: jose.JWK[] = [];
+		for (const key of this.sessions.get(sessionId) ?? []) {
+			expire(key, now);
+			if (key.removedAt !== undefined) {
+				continue;
+			}
+			served.push(key.jwk);
+			key.fetches++;
+			if (key.window.fetches !== undefined && key.fetches >= key.window.fetches) {
+				key.removedAt = now;
+			}
+		}
+		return served;
+	}
+
+	/**
+	 * The Cache-Control a session's JWKS is served with, if mischief set one
+	 */
+	cacheControl(sessionId: string): string | undefined {
+		return this.cacheControls.get(sessionId);
+	}
+
+	/**
+	 * Every key a session has published, live or removed
+	 */
+	keys(sessionId: string): jose.JWK[] {
+		return (this.sessions.get(sessionId) ?? []).map((key) => key.jwk);
+	}
+
+	/**
+	 * When each of a session's keys was added and removed
+	 */
+	report(sessionId: string, now = Date.now()): TransientKeyRecord[] {
+		return (this.sessions.get(sessionId) ?? []).map((key) => {
+			expire(key, now);
+			return {
+				kid: key.jwk.kid ?? "",
+				addedAt: new Date(key.addedAt).toISOString(),
+				removedAt: key.removedAt === undefined ? null : new Date(key.removedAt).toISOString(),
+				fetches: key.fetches,
+				window: key.window,
+			};
+		});
+	}
+
+	/**
+	 * Transient key helpers bound to a session
+	 */
+	forSession(sessionId: string): TransientKeyPublisher {
+		return {
+			publish: (jwk, window) => this.publish(sessionId, jwk, window),
+			cacheControl: (value) => this.cacheControls.set(sessionId, value),
+		};
+	}
+
+	/**
+	 * Drop a session's transient keys and JWKS Cache-Control
+	 */
+	clear(sessionId: string): void {
+		this.sessions.delete(sessionId);
+		this.cacheControls.delete(sessionId);
+	}
+
+	/**
+	 * Drop all transient keys
+	 */
+	clearAll(): void {
+		this.sessions.clear();
+		this.cacheControls.clear();
+	}
+}
+
+/**
+ * Remove a key whose time window has closed, as of when it closed
+ */
+function expire(key: TransientKey, now: number): void {
+	if (key.removedAt !== undefined || key.window.seconds === undefined) {
+		return;
+	}
+	const expiresAt = key.addedAt + key.window.seconds * 1000;
+	if (now >= expiresAt) {
+		key.removedAt = expiresAt;
+	}
+}
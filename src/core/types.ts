@@ -2,9 +2,18 @@
  * Core types for OIDC-Loki
  */
 
-export type SessionMode = "explicit" | "random" | "shuffled";
+export type SessionMode = "explicit" | "random" | "shuffled" | "probabilistic";
+/** Which tokens in a token response a plugin applies to */
+export type TokenTarget = "access_token" | "id_token" | "both";
+/** How a single `aud` is serialized: a plain string or a one-element array */
+export type AudFormat = "string" | "array";
 export type Severity = "critical" | "high" | "medium" | "low";
-export type MischiefPhase = "token-signing" | "token-claims" | "response" | "discovery";
+export type MischiefPhase =
+	| "token-signing"
+	| "token-claims"
+	| "response"
+	| "discovery"
+	| "endpoint";
 
 export interface LokiConfig {
 	server?: ServerConfig;
@@ -13,23 +22,114 @@ export interface LokiConfig {
 	plugins?: PluginsConfig;
 	ledger?: LedgerConfig;
 	persistence?: PersistenceConfig;
+	faults?: FaultConfig;
+	sessions?: SessionsConfig;
+	/** Standing sessions reconciled on startup (see POST /admin/apply) */
+	topology?: TopologyDocument;
+	/** Built-in session whose active plugin rotates through the catalog */
+	attackOfTheDay?: AttackRotationConfig;
+	/** Random mischief for a share of token requests no session claims */
+	chaos?: ChaosConfig;
+	/** Where session token issuances are announced (see Session.webhook) */
+	webhook?: WebhookConfig;
+	/** Redaction and limits for recorded session exchanges (see GET /admin/sessions/:id/har) */
+	har?: HarConfig;
+	/** Makes Loki's random choices reproducible: same seed, same requests, same mischief */
+	seed?: string;
+	/** Primary signing key loaded on startup, with a stable kid (default: generated each start) */
+	signingKey?: SigningKeyConfig;
+}
+
+/**
+ * Where a signing key's PEM comes from: a file, an environment variable,
+ * or a KMS or Vault reference
+ */
+export interface KeyProvider {
+	/** Named in load errors, e.g. "file ./keys/signing.pem" */
+	readonly source: string;
+	/** Fetch the PEM-encoded private key */
+	loadPem(): Promise<string>;
+}
+
+export interface SigningKeyConfig {
+	provider: KeyProvider;
+	/** Passphrase of an encrypted PEM */
+	passphrase?: string;
 }
 
 export interface ServerConfig {
 	port: number;
 	host: string;
+	/** Concurrent requests served before new ones get 503 + Retry-After (0 = unlimited) */
+	maxInFlightRequests?: number;
+	/** Proxies (CIDRs) whose X-Forwarded-For is trusted when resolving a client's address */
+	trustedProxies?: string[];
+	/** Source addresses (CIDRs) allowed to reach Loki; others get 403 (default: any) */
+	allowedSources?: string[];
+	/** Bearer token every /admin request must present; signing key export requires one */
+	adminToken?: string;
+	/** Least severe structured log lines written to stdout (default: "warn") */
+	logLevel?: "debug" | "info" | "warn" | "error" | "silent";
+	/** Serve HTTPS, binding access tokens to the client certificate presented at /token */
+	tls?: TlsConfig;
+	/** Milliseconds stop() lets requests in flight finish before closing them (default: 10000) */
+	shutdownTimeoutMs?: number;
 }
 
+export interface TlsConfig {
+	/** PEM server certificate (chain) */
+	cert: string;
+	/** PEM private key for the certificate */
+	key: string;
+}
+
+export type ProviderProfile = "default" | "oauth21";
+
+export type PkceMethod = "plain" | "S256";
+
 export interface ProviderConfig {
 	issuer: string;
 	clients: ClientConfig[];
+	/** Baseline (no-mischief) behaviour: "default" is lenient, "oauth21" enforces OAuth 2.1 */
+	profile?: ProviderProfile;
+	/** Weakest code_challenge_method accepted (default: "S256"; "plain" is refused under oauth21) */
+	pkceMinimumMethod?: PkceMethod;
+	/** Claims each scope releases at /me and in ID tokens (default: OIDC Core Section 5.4) */
+	scopeClaims?: Record<string, string[]>;
+	/** Longest sub the baseline issues; longer login names have no account (default: 255) */
+	subjectMaxLength?: number;
+	/** Stamp `iat` on every issued JWT that lacks one (default: true) */
+	requireIat?: boolean;
+	/** Demand a server-provided nonce in every DPoP proof at the token endpoint (default: false) */
+	requireDpopNonce?: boolean;
+	/** Endpoints switched on or off by name, e.g. `{ userinfo: false }` (default: all on) */
+	endpoints?: Record<string, boolean>;
+	/** Bearer token every JWKS fetch must present; others get 401 (default: JWKS is public) */
+	jwksBearerToken?: string;
+	/** Lifetime of device codes in seconds (default: 600) */
+	deviceCodeTtl?: number;
+	/** Lifetime of access tokens in seconds, their `exp` and `expires_in` (default: 3600) */
+	accessTokenTtl?: number;
+	/** Tenants served under `/{tenant}` with `{issuer}/{tenant}` as issuer (default: none) */
+	tenants?: string[];
 }
 
+export type TokenEndpointAuthMethod =
+	| "client_secret_basic"
+	| "client_secret_post"
+	| "private_key_jwt"
+	| "none";
+
 export interface ClientConfig {
 	client_id: string;
 	client_secret?: string;
 	redirect_uris?: string[];
 	grant_types?: string[];
+	/**
+	 * "none" registers a public client; "private_key_jwt" clients authenticate
+	 * with assertions only (default: client_secret_basic with a secret, else none)
+	 */
+	token_endpoint_auth_method?: TokenEndpointAuthMethod;
 }
 
 export interface MischiefConfig {
@@ -51,6 +151,52 @@ export interface LedgerConfig {
 export interface PersistenceConfig {
 	enabled: boolean;
 	path: string;
+	/** Backend: a SQLite database (default), a single JSON file, or Redis shared by replicas */
+	store?: "sqlite" | "json" | "redis";
+	/**
+	 * The Redis server, for the redis store: `host:port`, or a
+	 * `redis://[[user]:password@]host:port` (`rediss://` for TLS) URL
+	 * (default: 127.0.0.1:6379)
+	 */
+	redisAddr?: string;
+}
+
+export interface HarConfig {
+	/** Headers redacted besides Authorization, Proxy-Authorization and cookies */
+	redactHeaders?: string[];
+	/** Query, form and JSON parameters redacted besides client_secret, client_assertion, password */
+	redactParams?: string[];
+	/** Exchanges kept per session, oldest dropped first (default: 1000) */
+	maxEntriesPerSession?: number;
+	/** Bytes of each request and response body kept (default: 65536) */
+	maxBodyBytes?: number;
+}
+
+export interface WebhookConfig {
+	/** URL every session's issuances are POSTed to, unless the session names its own */
+	url?: string;
+	/** Delivery attempts per event before it is dropped (default: 3) */
+	maxAttempts?: number;
+	/** Per-attempt timeout in milliseconds (default: 5000) */
+	timeoutMs?: number;
+}
+
+export interface FaultConfig {
+	/** Fraction of requests (0-1) failed per endpoint path, e.g. { "/jwks": 0.2 } */
+	errorRates: Record<string, number>;
+	/** 5xx status codes to pick from (default: [503]) */
+	statuses?: number[];
+}
+
+export interface SessionsConfig {
+	/** Maximum session name length in characters (default: 128) */
+	nameMaxLength?: number;
+	/** Characters allowed in session names, as a regex character class body */
+	nameAllowedChars?: string;
+	/** Events kept per session; the oldest are dropped beyond it (default: 10000, 0 = unlimited) */
+	maxEventsPerSession?: number;
+	/** Go duration after which sessions without their own ttl are evicted (default: never) */
+	ttl?: string;
 }
 
 export interface SessionConfig {
@@ -58,6 +204,80 @@ export interface SessionConfig {
 	mode: SessionMode;
 	mischief: string[];
 	probability?: number;
+	/** Per-plugin probability (0-1) of firing on each token request, for probabilistic mode */
+	probabilities?: Record<string, number>;
+	/** Seed for probabilistic mode's draws, so a run can be reproduced (0 to 2^32 - 1) */
+	seed?: number;
+	/** Number of initial token requests served clean before mischief begins */
+	warmupRequests?: number;
+	/** Per-plugin options, keyed by plugin ID (e.g. { "header-case": { variant: "duplicate" } }) */
+	pluginConfig?: Record<string, Record<string, unknown>>;
+	/** Token each plugin applies to, keyed by plugin ID (default: "both") */
+	targets?: Record<string, TokenTarget>;
+	/** Go duration from creation after which the session is evicted (default: sessions.ttl) */
+	ttl?: string;
+	/** Only apply mischief to requests matching this condition */
+	when?: MischiefCondition;
+	/** Registered signing key (see /admin/keys) that signs the session's valid tokens */
+	keyId?: string;
+	/** URL the session's issuances are POSTed to instead of the global webhook */
+	webhook?: string;
+	/** Token requests served per second before the rest get 429 */
+	maxTokensPerSecond?: number;
+	/** Issue the session's tokens as SD-JWTs, these claims selectively disclosable */
+	sdJwt?: SdJwtConfig;
+	/** Form a single audience is serialized in (default: as the provider issues it) */
+	audFormat?: AudFormat;
+	/** Go duration access tokens live: their `exp` and `expires_in` (default: accessTokenTtl) */
+	tokenLifetime?: string;
+}
+
+/**
+ * Issues tokens as SD-JWTs: the claims named are sent as disclosures after the JWS
+ */
+export interface SdJwtConfig {
+	/** Top-level claims moved out of the payload into disclosures */
+	claims: string[];
+	/** Tokens issued as SD-JWTs (default: "both") */
+	tokens?: TokenTarget;
+}
+
+/**
+ * Restricts a session's mischief to some requests; the rest are served clean
+ */
+export interface MischiefCondition {
+	/** Networks the request must come from (see ServerConfig.trustedProxies) */
+	sourceCIDR: string | string[];
+}
+
+export interface AttackRotationConfig {
+	/** Session id the rotating session is served under (default "attack-of-the-day") */
+	sessionId?: string;
+	/** Plugin IDs in rotation order (default: every loaded plugin, in catalog order) */
+	order?: string[];
+	/** Rotate after this many token requests instead of once per UTC day */
+	everyRequests?: number;
+}
+
+export interface ChaosConfig {
+	/** Share of session-less token requests served a random mischief, from 0 to 1 */
+	rate: number;
+	/** Plugin IDs chaos may draw (default: every loaded token or response plugin) */
+	allowlist?: string[];
+}
+
+/**
+ * Declarative standing sessions, reconciled by id
+ */
+export interface TopologyDocument {
+	/** Config schema version per plugin ID the sessions' pluginConfig was written for */
+	pluginVersions?: Record<string, number>;
+	sessions?: TopologySession[];
+}
+
+export interface TopologySession extends Partial<SessionConfig> {
+	/** Stable session id; the key an apply reconciles on */
+	id: string;
 }
 
 export interface Session {
@@ -66,17 +286,62 @@ export interface Session {
 	mode: SessionMode;
 	mischief: string[];
 	probability?: number;
+	probabilities?: Record<string, number>;
+	/** Seed of probabilistic mode's draws (given or picked at creation) */
+	seed?: number;
+	/** Generator state after the draws made so far */
+	randomState?: number;
 	startedAt: Date;
 	endedAt?: Date;
 	shuffleQueue?: string[];
+	warmupRequests?: number;
+	/** Token requests seen so far (tracked while a warm-up is configured) */
+	tokenRequests?: number;
+	pluginConfig?: Record<string, Record<string, unknown>>;
+	targets?: Record<string, TokenTarget>;
+	/** Go duration from startedAt after which the session is evicted */
+	ttl?: string;
+	when?: MischiefCondition;
+	/** Registered signing key that signs the session's tokens */
+	keyId?: string;
+	/** URL the session's issuances are POSTed to instead of the global webhook */
+	webhook?: string;
+	/** Token requests served per second before the rest get 429 */
+	maxTokensPerSecond?: number;
+	/** Claims the session's tokens send as SD-JWT disclosures */
+	sdJwt?: SdJwtConfig;
+	/** Form the session's tokens serialize a single audience in */
+	audFormat?: AudFormat;
+	/** Go duration the session's access tokens live */
+	tokenLifetime?: string;
+	/** Set on sessions created by a topology apply; only these are reconciled */
+	declared?: boolean;
+	/** Set while the session serves (or is about to capture) a frozen token response */
+	freeze?: SessionFreeze;
+}
+
+export interface SessionFreeze {
+	/** Move iat/exp forward on every serve instead of replaying them verbatim */
+	keepFresh: boolean;
+	/** ISO timestamp of the freeze request */
+	requestedAt: string;
+	/** ISO timestamp the token response was captured; absent until the next token request */
+	capturedAt?: string;
+	/** The captured token response body */
+	response?: Record<string, unknown>;
 }
 
 export const DEFAULT_CONFIG: Required<
-	Pick<LokiConfig, "server" | "mischief" | "plugins" | "ledger" | "persistence">
+	Pick<
+		LokiConfig,
+		"server" | "mischief" | "plugins" | "ledger" | "persistence" | "faults" | "sessions"
+	>
 > = {
 	server: {
 		port: 3000,
-		host: "localhost",
+		host: "127.0.0.1",
+		maxInFlightRequests: 256,
+		trustedProxies: [],
 	},
 	mischief: {
 		enabled: [],
@@ -98,4 +363,13 @@ export const DEFAULT_CONFIG: Required<
 		enabled: true,
 		path: "./data/loki.db",
 	},
+	faults: {
+		errorRates: {},
+	},
+	sessions: {
+		nameMaxLength: 128,
+		// Letters, digits, space and a few separators - no control characters or quotes
+		nameAllowedChars: "\\p{L}\\p{N} ._:@/+-",
+		maxEventsPerSession: 10_000,
+	},
 };
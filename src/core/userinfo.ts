@@ -0,0 +1,103 @@
+/**
+ * Userinfo - scope-to-claim mapping for the /me and /userinfo endpoints
+ *
+ * Loki answers userinfo requests itself so it controls exactly which claims
+ * each scope releases. The baseline honours the configured scope map;
+ * mischief can then over-disclose or withhold claims to test whether
+ * clients assume userinfo respects scope.
+ */
+
+/** Paths Loki serves userinfo at: the provider's advertised `/me`, and `/userinfo` */
+export const USERINFO_PATHS = ["/me", "/userinfo"];
+
+/** Default scope-to-claim map (OIDC Core Section 5.4) */
+export const DEFAULT_SCOPE_CLAIMS: Record<string, string[]> = {
+	openid: ["sub"],
+	email: ["email", "email_verified"],
+	profile: ["name", "family_name", "given_name", "picture"],
+};
+
+/** Longest `sub` the baseline issues (OIDC Core Section 2: at most 255 ASCII characters) */
+export const DEFAULT_SUBJECT_MAX_LENGTH = 255;
+
+/**
+ * Why `sub` can't identify an account, or undefined if it can
+ *
+ * A subject must be 1 to `maxLength` printable ASCII characters.
+ */
+export function subjectError(
+	sub: string,
+	maxLength: number = DEFAULT_SUBJECT_MAX_LENGTH,
+): string | undefined {
+	if (sub.length === 0) {
+		return "sub must not be empty";
+	}
+	if (sub.length > maxLength) {
+		return `sub is ${sub.length} characters, longer than ${maxLength}`;
+	}
+	if (!/^[\x20-\x7e]+$/.test(sub)) {
+		return "sub must be printable ASCII";
+	}
+	return undefined;
+}
+
+/**
+ * Whether a verified JWT is an access token, not an ID token presented as one
+ *
+ * An RFC 9068 token says so with `typ: at+jwt`; otherwise it must carry
+ * `client_id` or `scope` and none of the claims only ID tokens carry.
+ */
+export function isAccessTokenJwt(
+	header: { typ?: string | undefined },
+	payload: Record<string, unknown>,
+): boolean {
+	const typ = header.typ?.toLowerCase().replace(/^application\//, "");
+	if (typ === "at+jwt") {
+		return true;
+	}
+	if ("nonce" in payload || "at_hash" in payload) {
+		return false;
+	}
+	return typeof payload.client_id === "string" || typeof payload.scope === "string";
+}
+
+/**
+ * Every claim Loki holds for a test account
+ */
+export function accountClaims(sub: string): Record<string, unknown> {
+	return {
+		sub,
+		email: `${sub}@loki.test`,
+		email_verified: true,
+		name: "Test User",
+		given_name: "Test",
+		family_name: "User",
+		picture: `https://loki.test/avatars/${encodeURIComponent(sub)}.png`,
+	};
+}
+
+/**
+ * Release only the claims the granted scopes authorize
+ *
+ * `sub` is always released; unknown scopes release nothing.
+ */
+export function claimsForScopes(
+	claims: Record<string, unknown>,
+	scopes: string[],
+	scopeClaims: Record<string, string[]> = DEFAULT_SCOPE_CLAIMS,
+): Record<string, unknown> {
+	const allowed = new Set(["sub"]);
+	for (const scope of scopes) {
+		for (const claim of scopeClaims[scope] ?? []) {
+			allowed.add(claim);
+		}
+	}
+
+	const released: Record<string, unknown> = {};
+	for (const [name, value] of Object.entries(claims)) {
+		if (allowed.has(name)) {
+			released[name] = value;
+		}
+	}
+	return released;
+}
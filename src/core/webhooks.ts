@@ -0,0 +1,170 @@
+/**
+ * Webhooks - issuance notifications POSTed to an external URL
+ *
+ * Each token a session is issued can be announced to a webhook (the
+ * `webhook.url` config, or the session's own `webhook`), so a test harness
+ * collects results as they happen instead of polling the session report.
+ * Deliveries run in the background with a bounded number of attempts: a
+ * webhook that is slow or down never holds up the token response, and an
+ * event that can't be delivered is dropped after the last attempt.
+ */
+
+import type { SigningKeyFingerprint, TokenIssuance } from "./issuance-log.js";
+import { tokenFingerprint } from "./live-events.js";
+import type { WebhookConfig } from "./types.js";
+
+const DEFAULT_MAX_ATTEMPTS = 3;
+const DEFAULT_TIMEOUT_MS = 5000;
+
+/** Delay before the second attempt; doubled for each one after */
+const RETRY_DELAY_MS = 250;
+
+/** Deliveries in flight at once; events beyond it are dropped */
+const MAX_PENDING = 1000;
+
+/**
+ * The body POSTed for each token issued
+ */
+export interface TokenIssuedEvent {
+	event: "token.issued";
+	sessionId: string;
+	tokenType: string;
+	jti: string | null;
+	issuedAt: string;
+	requestId: string | null;
+	/** Token mischief applied, in order; empty for a baseline token */
+	mischief: string[];
+	fingerprint: {
+		/** SHA-256 of the token as sent, base64url */
+		sha256: string;
+		/** The key whose signature the token carries; null when no known key verifies it */
+		signingKey: SigningKeyFingerprint | null;
+	};
+}
+
+/**
+ * The outcome of delivering one event
+ */
+export interface WebhookDelivery {
+	url: string;
+	delivered: boolean;
+	attempts: number;
+	/** Status of the last response; null if none came back */
+	status: number | null;
+	/** Why the last attempt failed */
+	error?: string;
+}
+
+export interface WebhookDispatcherOptions extends Omit<WebhookConfig, "url"> {
+	/** Fetch implementation (for tests) */
+	fetch?: typeof fetch;
+}
+
+/**
+ * Whether a URL can take webhook deliveries: absolute, over http(s)
+ */
+export function isWebhookUrl(value: string): boolean {
+	const protocol = URL.canParse(value) ? new URL(value).protocol : "";
+	return protocol === "http:" || protocol === "https:";
+}
+
+/**
+ * The event announcing an issued token, identified by a fingerprint
+ * rather than the token itself
+ */
+export function tokenIssuedEvent(
+	sessionId: string,
+	token: string,
+	issuance: TokenIssuance,
+): TokenIssuedEvent {
+	return {
+		event: "token.issued",
+		sessionId,
+		tokenType: issuance.tokenType,
+		jti: issuance.jti,
+		issuedAt: issuance.issuedAt,
+		requestId: issuance.requestId ?? null,
+		mischief: issuance.mischief,
+		fingerprint: {
+			sha256: tokenFingerprint(token),
+			signingKey: issuance.signingKey,
+		},
+	};
+}
+
+/**
+ * Webhook Dispatcher - background delivery with bounded retries
+ */
+export class WebhookDispatcher {
+	private readonly pending = new Set<Promise<void>>();
+	private readonly maxAttempts: number;
+	private readonly timeoutMs: number;
+	private readonly fetch: typeof fetch;
+
+	constructor(options: WebhookDispatcherOptions = {}) {
+		this.maxAttempts = options.maxAttempts ?? DEFAULT_MAX_ATTEMPTS;
+		this.timeoutMs = options.timeoutMs ?? DEFAULT_TIMEOUT_MS;
+		if (!(Number.isInteger(this.maxAttempts) && this.maxAttempts >= 1)) {
+			throw new Error(`webhook.maxAttempts must be a positive integer, got ${this.maxAttempts}`);
+		}
+		if (!(Number.isInteger(this.timeoutMs) && this.timeoutMs >= 1)) {
+			throw new Error(`webhook.timeoutMs must be a positive integer, got ${this.timeoutMs}`);
+		}
+		this.fetch = options.fetch ?? fetch;
+	}
+
+	/**
+	 * Deliver an event in the background; `onDone` gets the outcome. Returns
+	 * false if too many deliveries are already in flight and the event was dropped.
+	 */
+	send(url: string, event: unknown, onDone?: (delivery: WebhookDelivery) => void): boolean {
+		if (this.pending.size >= MAX_PENDING) {
+			return false;
+		}
+		const delivery = this.deliver(url, JSON.stringify(event)).then((result) => onDone?.(result));
+		this.pending.add(delivery);
+		delivery.finally(() => this.pending.delete(delivery));
+		return true;
+	}
+
+	/**
+	 * Wait for every delivery in flight to finish
+	 */
+	async flush(): Promise<void> {
+		await Promise.all([...this.pending]);
+	}
+
+	private async deliver(url: string, body: string): Promise<WebhookDelivery> {
+		const result: WebhookDelivery = { url, delivered: false, attempts: 0, status: null };
+		while (result.attempts < this.maxAttempts) {
+			if (result.attempts > 0) {
+				await sleep(RETRY_DELAY_MS * 2 ** (result.attempts - 1));
+			}
+			result.attempts++;
+			try {
+				const response = await this.fetch(url, {
+					method: "POST",
+					headers: { "Content-Type": "application/json" },
+					body,
+					signal: AbortSignal.timeout(this.timeoutMs),
+				});
+				result.status = response.status;
+				await response.body?.cancel();
+				if (response.ok) {
+					result.delivered = true;
+					delete result.error;
+					return result;
+				}
+				result.error = `HTTP ${response.status}`;
+			} catch (err) {
+				result.status = null;
+				result.error = err instanceof Error ? err.message : String(err);
+			}
+		}
+		return result;
+	}
+}
+
+function sleep(ms: number): Promise<void> {
+	return new Promise((resolve) => setTimeout(resolve, ms));
+}
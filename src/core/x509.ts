@@ -0,0 +1,189 @@
+/**
+ * X.509 - self-signed certificates for the x5c and x5u headers
+ *
+ * Mischief that embeds (x5c) or points at (x5u) a certificate chain needs a
+ * real certificate for the attacker key, one that parses in the libraries
+ * clients use. Node can parse certificates but not create them, so this
+ * DER-encodes just enough of RFC 5280 for a self-signed v1 certificate:
+ * serial, signature algorithm, issuer and subject (a common name),
+ * validity and the subject public key.
+ *
+ * RFC 7515 carries the DER bytes base64 encoded (not base64url) in x5c and
+ * PEM encoded at an x5u URL.
+ */
+
+import {
+	type KeyObject,
+	createHash,
+	createPrivateKey,
+	createPublicKey,
+	sign,
+} from "node:crypto";
+import { randomBytes } from "./random.js";
+
+const OIDS = {
+	commonName: "2.5.4.3",
+	sha256WithRSAEncryption: "1.2.840.113549.1.1.11",
+	ecdsaWithSHA256: "1.2.840.10045.4.3.2",
+	ecdsaWithSHA384: "1.2.840.10045.4.3.3",
+	ecdsaWithSHA512: "1.2.840.10045.4.3.4",
+	ed25519: "1.3.101.112",
+};
+
+/** DER NULL, the parameters of an RSA signature algorithm */
+const NULL = Buffer.from([0x05, 0x00]);
+
+/** Hash and signature algorithm for each EC curve */
+const EC_SIGNATURES: Record<string, { hash: string; oid: string }> = {
+	prime256v1: { hash: "sha256", oid: OIDS.ecdsaWithSHA256 },
+	secp384r1: { hash: "sha384", oid: OIDS.ecdsaWithSHA384 },
+	secp521r1: { hash: "sha512", oid: OIDS.ecdsaWithSHA512 },
+};
+
+export interface CertificateOptions {
+	/** Private key, as a KeyObject or PKCS8 PEM; it signs the certificate and is its subject */
+	privateKey: KeyObject | string;
+	/** Subject and issuer common name */
+	commonName: string;
+	/** Start of validity (default: an hour ago, to allow for clock skew) */
+	notBefore?: Date;
+	/** Days the certificate is valid for (default: 365) */
+	validityDays?: number;
+}
+
+export interface SelfSignedCertificate {
+	der: Buffer;
+	/** Base64 DER, as an x5c entry */
+	x5c: string;
+	/** PEM, as served at an x5u URL */
+	pem: string;
+	/** Base64url SHA-256 of the DER, as the x5t#S256 header */
+	x5tS256: string;
+}
+
+/**
+ * Create a self-signed certificate for a key pair
+ */
+export function selfSignedCertificate(options: CertificateOptions): SelfSignedCertificate {
+	const privateKey =
+		typeof options.privateKey === "string"
+			? createPrivateKey(options.privateKey)
+			: options.privateKey;
+	const { hash, algorithm } = signatureAlgorithm(privateKey);
+	const notBefore = options.notBefore ?? new Date(Date.now() - 60 * 60 * 1000);
+	const notAfter = new Date(notBefore.getTime() + (options.validityDays ?? 365) * 86_400_000);
+	const name = sequence(set(sequence(oid(OIDS.commonName), utf8String(options.commonName))));
+
+	// A positive serial with its high byte set, so the INTEGER needs no padding
+	const serial = randomBytes(16);
+	serial[0] = ((serial[0] ?? 0) & 0x7f) | 0x40;
+
+	const tbs = sequence(
+		integer(serial),
+		algorithm,
+		name,
+		sequence(utcTime(notBefore), utcTime(notAfter)),
+		name,
+		createPublicKey(privateKey).export({ type: "spki", format: "der" }),
+	);
+	const der = sequence(tbs, algorithm, bitString(sign(hash, tbs, privateKey)));
+	return {
+		der,
+		x5c: der.toString("base64"),
+		pem: certificatePem(der),
+		x5tS256: createHash("sha256").update(der).digest("base64url"),
+	};
+}
+
+/**
+ * PEM-encode a DER certificate
+ */
+export function certificatePem(der: Buffer): string {
+	const lines = der.toString("base64").match(/.{1,64}/g) ?? [];
+	return `-----BEGIN CERTIFICATE-----\n${lines.join("\n")}\n-----END CERTIFICATE-----\n`;
+}
+
+/**
+ * The x5t#S256 thumbprint of each certificate in a PEM chain
+ */
+export function certificateThumbprints(pem: string): string[] {
+	const blocks = pem.matchAll(/-----BEGIN CERTIFICATE-----([^-]+)-----END CERTIFICATE-----/g);
+	return [...blocks].map(([, body]) =>
+		createHash("sha256")
+			.update(Buffer.from(body ?? "", "base64"))
+			.digest("base64url"),
+	);
+}
+
+function signatureAlgorithm(key: KeyObject): { hash: string | null; algorithm: Buffer } {
+	switch (key.asymmetricKeyType) {
+		case "rsa":
+			return { hash: "sha256", algorithm: sequence(oid(OIDS.sha256WithRSAEncryption), NULL) };
+		case "ec": {
+			const curve = key.asymmetricKeyDetails?.namedCurve ?? "";
+			const ec = EC_SIGNATURES[curve];
+			if (!ec) {
+				throw new Error(`Unsupported EC curve for a certificate: ${curve}`);
+			}
+			return { hash: ec.hash, algorithm: sequence(oid(ec.oid)) };
+		}
+		case "ed25519":
+			return { hash: null, algorithm: sequence(oid(OIDS.ed25519)) };
+		default:
+			throw new Error(`Unsupported key type for a certificate: ${key.asymmetricKeyType}`);
+	}
+}
+
+// ===== DER =====
+
+function tlv(tag: number, content: Buffer): Buffer {
+	if (content.length < 0x80) {
+		return Buffer.concat([Buffer.from([tag, content.length]), content]);
+	}
+	const length: number[] = [];
+	for (let remaining = content.length; remaining > 0; remaining >>= 8) {
+		length.unshift(remaining & 0xff);
+	}
+	return Buffer.concat([Buffer.from([tag, 0x80 | length.length, ...length]), content]);
+}
+
+function sequence(...items: Buffer[]): Buffer {
+	return tlv(0x30, Buffer.concat(items));
+}
+
+function set(...items: Buffer[]): Buffer {
+	return tlv(0x31, Buffer.concat(items));
+}
+
+function integer(value: Buffer): Buffer {
+	return tlv(0x02, value);
+}
+
+function bitString(value: Buffer): Buffer {
+	return tlv(0x03, Buffer.concat([Buffer.from([0]), value]));
+}
+
+function utf8String(value: string): Buffer {
+	return tlv(0x0c, Buffer.from(value, "utf8"));
+}
+
+/** UTCTime, YYMMDDHHMMSSZ; RFC 5280 uses it for dates before 2050 */
+function utcTime(date: Date): Buffer {
+	const iso = date.toISOString();
+	const digits = `${iso.slice(2, 4)}${iso.slice(5, 7)}${iso.slice(8, 10)}`;
+	const time = `${iso.slice(11, 13)}${iso.slice(14, 16)}${iso.slice(17, 19)}`;
+	return tlv(0x17, Buffer.from(`${digits}${time}Z`, "ascii"));
+}
+
+function oid(dotted: string): Buffer {
+	const [first = 0, second = 0, ...rest] = dotted.split(".").map(Number);
+	const bytes = [first * 40 + second];
+	for (const arc of rest) {
+		const base128 = [arc & 0x7f];
+		for (let remaining = arc >> 7; remaining > 0; remaining >>= 7) {
+			base128.unshift(0x80 | (remaining & 0x7f));
+		}
+		bytes.push(...base128);
+	}
+	return tlv(0x06, Buffer.from(bytes));
+}
@@ -8,15 +8,30 @@ export { Loki, SessionHandle } from "./core/loki.js";
 export type {
 	LokiConfig,
 	ServerConfig,
+	TlsConfig,
 	ProviderConfig,
+	ProviderProfile,
 	ClientConfig,
+	TokenEndpointAuthMethod,
 	MischiefConfig,
 	PluginsConfig,
 	LedgerConfig,
 	PersistenceConfig,
+	FaultConfig,
 	SessionConfig,
+	MischiefCondition,
 	Session,
+	SessionFreeze,
 	SessionMode,
+	TokenTarget,
+	AudFormat,
+	TopologyDocument,
+	TopologySession,
+	AttackRotationConfig,
+	ChaosConfig,
+	HarConfig,
+	KeyProvider,
+	SigningKeyConfig,
 	Severity,
 	MischiefPhase,
 } from "./core/types.js";
@@ -30,7 +45,10 @@ export type {
 	JWTHeader,
 	JWTClaims,
 	ResponseContext,
+	EndpointContext,
 	PluginConfig,
+	PluginOption,
+	PluginOptionType,
 	SessionInfo,
 } from "./plugins/types.js";
 
@@ -43,3 +61,118 @@ export type {
 } from "./ledger/types.js";
 
 export { PluginRegistry } from "./plugins/registry.js";
+
+export { KeyManager } from "./core/key-manager.js";
+export type {
+	ManagedKey,
+	SigningAlgorithm,
+	RolloverStep,
+	RolloverPlanConfig,
+	RolloverStatus,
+	RolloverHistoryEntry,
+	KeySetConfig,
+	KeySetStatus,
+	KeySigning,
+	ExportedSigningKey,
+	KeyRegistration,
+	RegisteredKeyStatus,
+} from "./core/key-manager.js";
+export {
+	EnvKeyProvider,
+	FileKeyProvider,
+	importPemSigningKey,
+	loadSigningKey,
+} from "./core/key-provider.js";
+
+export { EventLog } from "./core/event-log.js";
+export type { SessionEvent, SessionEventType } from "./core/event-log.js";
+export { LiveEventHub, LiveSubscription, tokenFingerprint } from "./core/live-events.js";
+export type { LiveEvent, LiveEventType } from "./core/live-events.js";
+
+export { ClaimSourceStore } from "./core/claim-sources.js";
+export { RogueJwksStore } from "./core/rogue-jwks.js";
+export type { RogueJwksPublisher } from "./core/rogue-jwks.js";
+export { TransientKeyStore } from "./core/transient-keys.js";
+export type {
+	TransientKeyPublisher,
+	TransientKeyRecord,
+	TransientKeyWindow,
+} from "./core/transient-keys.js";
+export type {
+	AggregatedClaimSource,
+	ClaimSourceFactory,
+	ClaimSourceOptions,
+	DistributedClaimSource,
+	DistributedClaimRecord,
+} from "./core/claim-sources.js";
+
+export { FaultInjector } from "./core/fault-injector.js";
+export type { FaultStatus, InjectedFault } from "./core/fault-injector.js";
+
+export { RevocationList } from "./core/revocation-list.js";
+export type {
+	RevocationListFormat,
+	RevocationRecord,
+	RevocationReport,
+} from "./core/revocation-list.js";
+
+export { TokenResults } from "./core/token-results.js";
+export type { IssuedToken, OutcomeCounts, SessionResults } from "./core/token-results.js";
+
+export { IssuanceLog } from "./core/issuance-log.js";
+export type {
+	FieldChange,
+	SessionReport,
+	SigningKeyFingerprint,
+	TokenIssuance,
+	TokenMutation,
+	TokenRevocation,
+} from "./core/issuance-log.js";
+
+export { HarRecorder } from "./core/har-recorder.js";
+export type { Har, HarEntry } from "./core/har-recorder.js";
+
+export { ATTACK_OF_THE_DAY_SESSION, AttackRotation } from "./core/attack-rotation.js";
+export type { AttackRotationEntry, AttackRotationStatus } from "./core/attack-rotation.js";
+
+export { CHAOS_SESSION, ChaosMode } from "./core/chaos-mode.js";
+export type { ChaosStatus } from "./core/chaos-mode.js";
+
+export { mischiefCatalog } from "./core/mischief-catalog.js";
+export type {
+	MischiefAffects,
+	MischiefCatalogEntry,
+	MischiefSurface,
+} from "./core/mischief-catalog.js";
+
+export { generateFixtures, writeFixtures } from "./core/fixtures.js";
+export type { FixtureConfig, FixtureEntry, FixtureManifest, FixtureSet } from "./core/fixtures.js";
+
+export { random, randomBytes, randomId, randomInt, randomUUID, seedRandom } from "./core/random.js";
+
+export { probeDiscoveryConsistency } from "./core/discovery-consistency.js";
+export type {
+	ConsistencyFinding,
+	ConsistencyProbeOptions,
+	ConsistencyReport,
+} from "./core/discovery-consistency.js";
+
+export type {
+	ClientAuthCheck,
+	ClientAuthViolation,
+	ClientType,
+	PresentedAuthMethod,
+} from "./core/client-auth.js";
+
+export { REQUEST_ID_HEADER } from "./core/request-id.js";
+export type { RequestTrace } from "./core/request-id.js";
+
+export { DEFAULT_SCOPE_CLAIMS, claimsForScopes } from "./core/userinfo.js";
+
+export type { TopologyPlan, TopologyPlanResult, TopologyUpdate } from "./core/topology.js";
+
+export { METADATA_PATHS, renderMetadata } from "./core/provider-metadata.js";
+export type { MetadataDocument, ProviderMetadata } from "./core/provider-metadata.js";
+
+export { ERROR_CODES } from "./core/errors.js";
+export type { LokiErrorBody, LokiErrorCode } from "./core/errors.js";
@@ -51,9 +51,13 @@ export interface LedgerEntry {
 	config?: Record<string, unknown>;
 }
 
+/**
+ * The client under test's verdict on one issued token
+ */
 export interface OutcomeReport {
-	requestId: string;
+	jti: string;
 	accepted: boolean;
+	/** Why the client rejected the token, if it did */
 	error?: string;
 	notes?: string;
 }
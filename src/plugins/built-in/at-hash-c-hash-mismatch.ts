@@ -1,3 +1,4 @@
+import { random } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const atHashCHashMismatch: MischiefPlugin = {
@@ -23,12 +24,12 @@ export const atHashCHashMismatch: MischiefPlugin = {
 		const fakeHash = "AAAAAAAAAAAAAAAAAAAAAA";
 		const mutations: string[] = [];
 
-		if (originalAtHash !== undefined || Math.random() > 0.5) {
+		if (originalAtHash !== undefined || random() > 0.5) {
 			ctx.token.claims.at_hash = fakeHash;
 			mutations.push("at_hash");
 		}
 
-		if (originalCHash !== undefined || Math.random() > 0.5) {
+		if (originalCHash !== undefined || random() > 0.5) {
 			ctx.token.claims.c_hash = fakeHash;
 			mutations.push("c_hash");
 		}
@@ -0,0 +1,88 @@
+/**
+ * Audience Array Confusion
+ *
+ * Issues tokens whose `aud` is an array naming the client the token was
+ * issued to alongside a resource nobody asked for (`audience`, default
+ * https://attacker.example/api), or, with `target` set, that value alone.
+ * A resource server must reject any token whose `aud` doesn't name it; one
+ * that accepts "the client is in there somewhere", or any array at all,
+ * will take tokens minted for other services.
+ *
+ * Tokens are re-signed with Loki's key, so only the audience is wrong.
+ *
+ * Config:
+ * - audience: the rogue audience added next to the client
+ * - target: the only audience (sessions may set it with `audTarget`)
+ *
+ * Spec: RFC 7519 Section 4.1.3 - a recipient not identified in aud MUST reject the token
+ * CWE-284: Improper Access Control
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+/** Injected unless the session says otherwise */
+const ROGUE_AUDIENCE = "https://attacker.example/api";
+
+export const audConfusion: MischiefPlugin = {
+	id: "aud-confusion",
+	name: "Audience Array Confusion",
+	severity: "critical",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 4.1.3",
+		cwe: "CWE-284",
+		description: "A recipient that doesn't identify itself in 'aud' MUST reject the token",
+	},
+
+	description: "Issues tokens with an array aud naming the client and a rogue resource",
+
+	options: [
+		{
+			name: "audience",
+			type: "string",
+			default: ROGUE_AUDIENCE,
+			description: "The rogue audience added next to the client",
+		},
+		{
+			name: "target",
+			type: "string",
+			description: "The only audience, replacing the array (session shorthand: audTarget)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const { claims } = ctx.token;
+		const originalAud = claims.aud;
+		const target = ctx.config.target as string | undefined;
+		let aud: string | string[];
+		let mutation: string;
+		if (target !== undefined) {
+			aud = target;
+			mutation = `Set aud to '${target}' alone`;
+		} else {
+			const audience = (ctx.config.audience as string | undefined) ?? ROGUE_AUDIENCE;
+			const clientId = claims.client_id ?? claims.azp ?? [originalAud ?? []].flat()[0];
+			aud = typeof clientId === "string" ? [clientId, audience] : [audience];
+			mutation = `Set aud to ${JSON.stringify(aud)}`;
+		}
+
+		claims.aud = aud;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation,
+			evidence: {
+				originalAud: originalAud ?? null,
+				aud,
+			},
+		};
+	},
+};
@@ -0,0 +1,68 @@
+/**
+ * Audience Type Flip
+ *
+ * Serializes a token's single audience in the other form RFC 7519 allows:
+ * `"aud": "test-client"` becomes `"aud": ["test-client"]`, and a
+ * one-element array becomes a plain string. Both forms are valid, and the
+ * token is re-signed with Loki's key, so a client should accept it exactly
+ * as it accepts the baseline. One that rejects it, or crashes on it, only
+ * parses the form its issuer usually sends. Tokens naming several
+ * audiences are left alone.
+ *
+ * The audience as serialized is recorded in the evidence.
+ *
+ * Spec: RFC 7519 Section 4.1.3 - aud is an array of strings, or a single
+ * string when there is one audience
+ * CWE-843: Access of Resource Using Incompatible Type ('Type Confusion')
+ */
+
+import { audFormatOf, formatAudience } from "../../core/aud-format.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const audTypeFlip: MischiefPlugin = {
+	id: "aud-type-flip",
+	name: "Audience Type Flip",
+	severity: "medium",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 4.1.3",
+		cwe: "CWE-843",
+		description: "A single audience MAY be a string or a one-element array; both MUST parse",
+	},
+
+	description: "Sends a single aud as a one-element array, or a one-element array as a string",
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const { claims } = ctx.token;
+		const original = claims.aud;
+		const format = audFormatOf(original) === "string" ? "array" : "string";
+		const aud = formatAudience(original, format);
+		if (aud === undefined) {
+			return {
+				applied: false,
+				mutation: "Token has no single audience to flip",
+				evidence: { aud: original ?? null },
+			};
+		}
+
+		claims.aud = aud;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Serialized aud as ${format === "array" ? "a one-element array" : "a string"}`,
+			evidence: {
+				originalAud: original,
+				format,
+				serialized: JSON.stringify(aud),
+			},
+		};
+	},
+};
@@ -36,6 +36,22 @@ export const audienceConfusionPlugin: MischiefPlugin = {
 
 	description: "Manipulates audience claim to test aud validation",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["inject", "replace", "remove", "wildcard"],
+			default: "inject",
+			description: "How the aud claim is manipulated",
+		},
+		{
+			name: "maliciousAudience",
+			type: "string",
+			default: "https://attacker.com",
+			description: "The attacker-controlled audience injected or swapped in",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
@@ -0,0 +1,95 @@
+/**
+ * Audience Ignoring
+ *
+ * Ignores the `resource` indicators a client sent with its token request
+ * and issues the access token for a broad audience instead: by default the
+ * provider's catch-all API audience, as if no resource had been named. The
+ * token is re-signed with Loki's key, so only the audience is wrong. A
+ * resource server must reject a token whose `aud` doesn't name it, however
+ * valid it is otherwise; a client that asked for a narrowly scoped token
+ * shouldn't forward one it didn't get.
+ *
+ * Config:
+ * - audience: the audience to issue instead, a string or an array of
+ *   strings (default: https://loki.test/api)
+ *
+ * Only access tokens are touched; the session's attack report shows the
+ * audience the client requested next to the one issued.
+ *
+ * Spec: RFC 8707 Section 2 - the authorization server should audience-restrict
+ * tokens to the requested resource; RFC 7519 Section 4.1.3
+ * CWE-863: Incorrect Authorization
+ */
+
+import { DEFAULT_RESOURCE } from "../../core/request-resource.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const audienceIgnoring: MischiefPlugin = {
+	id: "audience-ignoring",
+	name: "Audience Ignoring",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 8707 Section 2",
+		cwe: "CWE-863",
+		description: "Access tokens should be audience-restricted to the resources requested",
+	},
+
+	description: "Ignores the requested resource and issues the access token for a broad audience",
+
+	options: [
+		{
+			name: "audience",
+			type: ["string", "array"],
+			default: DEFAULT_RESOURCE,
+			description: "The audience issued instead of the requested resources",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (ctx.token.tokenType === "id_token") {
+			return { applied: false, mutation: "ID tokens aren't issued for resources", evidence: {} };
+		}
+
+		const audience = ctx.config.audience ?? DEFAULT_RESOURCE;
+		const valid =
+			typeof audience === "string"
+				? audience !== ""
+				: Array.isArray(audience) &&
+					audience.length > 0 &&
+					audience.every((a) => typeof a === "string" && a !== "");
+		if (!valid) {
+			return {
+				applied: false,
+				mutation: "audience must be a non-empty string or array of strings",
+				evidence: { audience },
+			};
+		}
+
+		const { claims } = ctx.token;
+		const requested = claims.aud ?? null;
+		if (JSON.stringify(requested) === JSON.stringify(audience)) {
+			return {
+				applied: false,
+				mutation: "The token is already issued for that audience",
+				evidence: { requested },
+			};
+		}
+
+		claims.aud = audience as string | string[];
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		const issued = JSON.stringify(audience);
+		return {
+			applied: true,
+			mutation: `Ignored the requested audience ${JSON.stringify(requested)} and issued ${issued}`,
+			evidence: { requested, issued: audience },
+		};
+	},
+};
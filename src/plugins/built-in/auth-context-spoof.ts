@@ -0,0 +1,128 @@
+/**
+ * Authentication Context Spoofing
+ *
+ * Step-up gates read `amr` (RFC 8176 authentication methods, e.g. `mfa`)
+ * and `acr` (the authentication context class) to decide whether the user
+ * already passed MFA. This plugin claims they did: the configured `amr`
+ * and `acr` replace the token's own, and by default the token is NOT
+ * re-signed, so its signature no longer covers its claims. A gate that
+ * decodes the token and reads `amr` before (or instead of) verifying it
+ * lets an attacker skip MFA by editing the payload; one that verifies
+ * first rejects the token outright.
+ *
+ * With `signed`, the token is re-signed with Loki's key instead, for
+ * checking that a gate trusts `acr` only from issuers whose policy it
+ * knows.
+ *
+ * Config:
+ * - amr: the methods claimed, an array of strings (default: ["pwd", "mfa"]);
+ *   sessions may set it with `amr`
+ * - acr: the context class claimed (default: the OpenID PAPE multi-factor
+ *   policy); sessions may set it with `acr`
+ * - signed: re-sign with Loki's key (default: false)
+ *
+ * Spec: OIDC Core Section 2 - `acr` and `amr`; RFC 8176 - amr values;
+ * RFC 8725 Section 3.2 - validate the signature before using any claim
+ * CWE-345: Insufficient Verification of Data Authenticity
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+const DEFAULT_AMR = ["pwd", "mfa"];
+
+/** OpenID Provider Authentication Policy Extension: multi-factor authentication */
+const DEFAULT_ACR = "http://schemas.openid.net/pape/policies/2007/06/multi-factor";
+
+export const authContextSpoof: MischiefPlugin = {
+	id: "auth-context-spoof",
+	name: "Authentication Context Spoofing",
+	severity: "critical",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core Section 2",
+		rfc: "RFC 8176",
+		cwe: "CWE-345",
+		description: "amr and acr may only be trusted from a token whose signature has been verified",
+	},
+
+	description: "Claims MFA was performed via injected amr/acr, leaving the signature stale",
+
+	options: [
+		{
+			name: "amr",
+			type: "array",
+			default: DEFAULT_AMR,
+			description: "The authentication methods claimed (session shorthand: amr)",
+		},
+		{
+			name: "acr",
+			type: "string",
+			default: DEFAULT_ACR,
+			description: "The authentication context class claimed (session shorthand: acr)",
+		},
+		{
+			name: "signed",
+			type: "boolean",
+			default: false,
+			description: "Re-sign the token with Loki's key instead of leaving the signature stale",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const amr = ctx.config.amr ?? DEFAULT_AMR;
+		const acr = ctx.config.acr ?? DEFAULT_ACR;
+		if (!isAmr(amr) || !isAcr(acr)) {
+			return {
+				applied: false,
+				mutation: "amr must be a non-empty array of strings and acr a non-empty string",
+				evidence: { amr, acr },
+			};
+		}
+
+		const { claims } = ctx.token;
+		const originalAmr = claims.amr ?? null;
+		const originalAcr = claims.acr ?? null;
+		claims.amr = [...amr];
+		claims.acr = acr;
+		const signed = ctx.config.signed === true && ctx.token.resign !== undefined;
+		if (signed) {
+			await ctx.token.resign?.();
+		}
+
+		return {
+			applied: true,
+			mutation: `Claimed amr ${JSON.stringify(amr)} and acr ${acr}${signed ? ", re-signed" : ""}`,
+			evidence: {
+				tokenType: ctx.token.tokenType ?? null,
+				originalAmr,
+				amr,
+				originalAcr,
+				acr,
+				signatureValid: signed,
+			},
+		};
+	},
+};
+
+/**
+ * Whether a value is an amr the plugin accepts: a non-empty array of non-empty strings
+ */
+export function isAmr(value: unknown): value is string[] {
+	return (
+		Array.isArray(value) &&
+		value.length > 0 &&
+		value.every((method) => typeof method === "string" && method.length > 0)
+	);
+}
+
+/**
+ * Whether a value is an acr the plugin accepts: a non-empty string
+ */
+export function isAcr(value: unknown): value is string {
+	return typeof value === "string" && value.length > 0;
+}
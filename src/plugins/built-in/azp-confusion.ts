@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const azpConfusion: MischiefPlugin = {
@@ -27,8 +28,7 @@ export const azpConfusion: MischiefPlugin = {
 			"internal-api",
 		];
 
-		const selectedClient =
-			attackerClients[Math.floor(Math.random() * attackerClients.length)] ?? "attacker-client";
+		const selectedClient = attackerClients[randomInt(attackerClients.length)] ?? "attacker-client";
 
 		ctx.token.claims.azp = selectedClient;
 
@@ -0,0 +1,94 @@
+/**
+ * Unencoded Payload Attack (b64: false)
+ *
+ * Re-issues the token as an RFC 7797 JWS: the header carries `"b64": false`
+ * and lists `b64` in `crit`, and the payload is signed and emitted as the
+ * claims JSON itself rather than base64url-encoded. A payload containing a
+ * '.' can't sit in the compact form, so it is detached and the token's
+ * middle segment left empty (RFC 7797 Section 5.2). The token is validly
+ * signed over the unencoded payload: a client must either verify it as
+ * RFC 7797 describes or reject it, never verify it as an ordinary JWS or
+ * read claims from it without verifying.
+ *
+ * Config:
+ * - preserveHeaderOrder: keep the header's members in the order Loki
+ *   issued them, `b64` and `crit` last (default: true); false puts `crit`
+ *   and `b64` first, ahead of `alg`, for validators sensitive to order
+ *
+ * Spec: RFC 7797 Section 3 - b64 MUST be listed in crit; Section 6 -
+ * recipients that don't support it MUST reject the JWS
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const b64False: MischiefPlugin = {
+	id: "b64-false",
+	name: "Unencoded Payload (b64: false)",
+	severity: "high",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 7797 Section 3",
+		cwe: "CWE-347",
+		description: "A JWS with b64 false signs the payload unencoded and MUST list b64 in crit",
+	},
+
+	description: "Re-signs the token as an RFC 7797 JWS with an unencoded payload",
+
+	options: [
+		{
+			name: "preserveHeaderOrder",
+			type: "boolean",
+			default: true,
+			description: "Keep b64 and crit last in the header; false puts them ahead of alg",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (!ctx.token.resign) {
+			return { applied: false, mutation: "Signing key not available", evidence: {} };
+		}
+		if (ctx.token.rawHeader !== undefined) {
+			return {
+				applied: false,
+				mutation: "Earlier mischief already emits the header verbatim",
+				evidence: { rawHeader: ctx.token.rawHeader },
+			};
+		}
+		const preserveHeaderOrder = ctx.config.preserveHeaderOrder ?? true;
+		if (typeof preserveHeaderOrder !== "boolean") {
+			return { applied: false, mutation: "preserveHeaderOrder must be a boolean", evidence: {} };
+		}
+
+		const { header } = ctx.token;
+		const existing = Array.isArray(header.crit) ? header.crit : [];
+		const crit = existing.includes("b64") ? [...existing] : [...existing, "b64"];
+		header.crit = crit;
+		header.b64 = false;
+		if (!preserveHeaderOrder) {
+			const { crit: _crit, b64: _b64, ...rest } = header;
+			ctx.token.rawHeader = JSON.stringify({ crit, b64: false, ...rest });
+		}
+		await ctx.token.resign();
+
+		const payload = ctx.token.rawPayload ?? JSON.stringify(ctx.token.claims);
+		const detached = payload.includes(".");
+		return {
+			applied: true,
+			mutation: detached
+				? "Signed the payload unencoded (b64: false) and detached it, as it contains a '.'"
+				: "Signed and emitted the payload unencoded (b64: false)",
+			evidence: {
+				header: JSON.parse(ctx.token.rawHeader ?? JSON.stringify(header)),
+				preserveHeaderOrder,
+				detached,
+				payload,
+				signatureValid: true,
+			},
+		};
+	},
+};
@@ -0,0 +1,101 @@
+/**
+ * Certificate-Bound Token Mismatch
+ *
+ * Served over TLS, Loki binds each access token to the certificate the
+ * client presented at /token: the token's `cnf` claim carries the
+ * certificate's SHA-256 thumbprint (`x5t#S256`). This plugin swaps in a
+ * thumbprint of a certificate the client doesn't hold and re-signs the
+ * token with Loki's key. A resource server that matches the binding
+ * against the certificate of its mTLS connection rejects the token; one
+ * that ignores `cnf` would also accept a stolen token replayed over any
+ * connection. Tokens issued without a client certificate are given the
+ * mismatched binding all the same.
+ *
+ * Config:
+ * - thumbprint: the x5t#S256 put in `cnf`, a base64url SHA-256 digest
+ *   (default: a random one for every token)
+ *
+ * Spec: RFC 8705 Section 3 - the resource server must verify that the
+ * token's x5t#S256 matches the client certificate of the TLS connection
+ * CWE-295: Improper Certificate Validation
+ */
+
+import { X5T_S256, bindCertificate } from "../../core/mtls.js";
+import { randomBytes } from "../../core/random.js";
+import { isPlainObject } from "../../core/session-spec.js";
+import type { MischiefPlugin } from "../types.js";
+
+/** Base64url SHA-256: 32 bytes in 43 characters */
+const THUMBPRINT = /^[A-Za-z0-9_-]{43}$/;
+
+export const certBoundTokenMismatch: MischiefPlugin = {
+	id: "cert-bound-token-mismatch",
+	name: "Certificate-Bound Token Mismatch",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 8705 Section 3",
+		cwe: "CWE-295",
+		description: "Resource servers MUST match cnf.x5t#S256 to the mTLS client certificate",
+	},
+
+	description: "Binds the access token to a certificate the client doesn't hold, validly signed",
+
+	options: [
+		{
+			name: "thumbprint",
+			type: "string",
+			description:
+				"The x5t#S256 put in cnf, a base64url SHA-256 digest (default: random per token)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (ctx.token.tokenType === "id_token") {
+			return { applied: false, mutation: "ID tokens carry no certificate binding", evidence: {} };
+		}
+
+		const thumbprint = ctx.config.thumbprint ?? randomBytes(32).toString("base64url");
+		if (!isThumbprint(thumbprint)) {
+			return {
+				applied: false,
+				mutation: "thumbprint must be a base64url SHA-256 digest",
+				evidence: { thumbprint },
+			};
+		}
+
+		const { claims } = ctx.token;
+		const expected = isPlainObject(claims.cnf) ? (claims.cnf[X5T_S256] ?? null) : null;
+		if (!bindCertificate(claims, thumbprint)) {
+			return {
+				applied: false,
+				mutation: "The token is already bound to that certificate",
+				evidence: { expected, thumbprint },
+			};
+		}
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Bound the token to certificate ${thumbprint} instead of ${expected ?? "none"}`,
+			evidence: {
+				expected,
+				emitted: thumbprint,
+				signatureValid: ctx.token.resign !== undefined,
+			},
+		};
+	},
+};
+
+/**
+ * Whether a value is an x5t#S256 thumbprint: a base64url SHA-256 digest
+ */
+function isThumbprint(value: unknown): value is string {
+	return typeof value === "string" && THUMBPRINT.test(value);
+}
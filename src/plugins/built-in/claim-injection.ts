@@ -0,0 +1,122 @@
+/**
+ * Claim Injection
+ *
+ * Merges attacker-chosen claims into the access and ID tokens after the
+ * provider has set the standard ones, e.g. `"roles": ["admin"]` or
+ * `"groups": ["superusers"]`. The token is otherwise valid and signed by
+ * Loki's key, so this probes authorization logic downstream: a policy
+ * engine that grants privileges from claims it never expected this issuer
+ * to send is over-trusting the token.
+ *
+ * Nested objects are merged key by key; any other value (arrays included)
+ * replaces the claim. Overwriting protected claims such as `iss` or `aud`
+ * is allowed, but each one is flagged in the evidence.
+ *
+ * Config:
+ * - claims: the object to merge (sessions may set it with `claims`)
+ *
+ * Spec: RFC 7519 Section 4 - claims an implementation doesn't understand MUST be ignored
+ * CWE-863: Incorrect Authorization
+ */
+
+import { isPlainObject } from "../../core/session-spec.js";
+import type { MischiefPlugin } from "../types.js";
+
+/** Claims whose change alters who issued the token, for whom, or when it's valid */
+const PROTECTED_CLAIMS = [
+	"iss",
+	"sub",
+	"aud",
+	"exp",
+	"nbf",
+	"iat",
+	"jti",
+	"azp",
+	"nonce",
+	"auth_time",
+	"at_hash",
+	"c_hash",
+	"cnf",
+	"client_id",
+	"scope",
+];
+
+export const claimInjection: MischiefPlugin = {
+	id: "claim-injection",
+	name: "Claim Injection",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 4",
+		cwe: "CWE-863",
+		description: "Authorization must not be granted on claims the issuer isn't trusted to assert",
+	},
+
+	description: "Merges attacker-controlled claims (e.g. roles, groups) into the token",
+
+	options: [
+		{
+			name: "claims",
+			type: "object",
+			description: "The claims merged into the token (session shorthand: claims)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const injected = ctx.config.claims;
+		if (!isPlainObject(injected) || Object.keys(injected).length === 0) {
+			return { applied: false, mutation: "No claims configured", evidence: {} };
+		}
+
+		const { claims } = ctx.token;
+		const previous: Record<string, unknown> = {};
+		for (const name of Object.keys(injected)) {
+			previous[name] = claims[name] ?? null;
+		}
+		deepMerge(claims, injected);
+		const protectedOverwrites = Object.keys(injected).filter((name) =>
+			PROTECTED_CLAIMS.includes(name),
+		);
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		const names = Object.keys(injected).join(", ");
+		return {
+			applied: true,
+			mutation:
+				protectedOverwrites.length > 0
+					? `Injected ${names}, overwriting protected ${protectedOverwrites.join(", ")}`
+					: `Injected ${names}`,
+			evidence: {
+				injected,
+				previous,
+				protectedOverwrites,
+			},
+		};
+	},
+};
+
+/**
+ * Merge `source` into `target`: nested objects key by key, anything else replaced
+ */
+function deepMerge(target: Record<string, unknown>, source: Record<string, unknown>): void {
+	for (const [key, value] of Object.entries(source)) {
+		if (key === "__proto__") {
+			continue;
+		}
+		const existing = target[key];
+		if (isPlainObject(value) && isPlainObject(existing)) {
+			const merged = { ...existing };
+			deepMerge(merged, value);
+			target[key] = merged;
+		} else {
+			target[key] = structuredClone(value);
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/**
+ * Claim Source Tampering Attack
+ *
+ * Moves claims out of the token into aggregated and distributed claim
+ * sources, then tampers with them. The aggregated source embeds a JWT whose
+ * payload was altered after signing; the distributed source is hosted by
+ * Loki at /claims/:id and returns a JWT with the same defect. The token
+ * carrying the sources is re-signed, so only the sources fail verification.
+ *
+ * A client that resolves claim sources must verify each JWT against the
+ * claims provider's keys. One that trusts them blindly will pick up
+ * elevated groups/roles the provider never asserted.
+ *
+ * Modes:
+ * - aggregated: One aggregated source with a bad signature
+ * - distributed: One distributed source returning tampered data
+ * - both: One of each (default)
+ *
+ * Set `tamper: false` to serve valid sources, as a baseline for checking
+ * that the client resolves them at all.
+ *
+ * Spec: OIDC Core 1.0 Section 5.6.2 - claim source JWTs MUST be verified
+ * CWE-345: Insufficient Verification of Data Authenticity
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type ClaimSourceMode = "aggregated" | "distributed" | "both";
+
+const AGGREGATED_SOURCE = "src_aggregated";
+const DISTRIBUTED_SOURCE = "src_distributed";
+
+export const claimSourceTamperingPlugin: MischiefPlugin = {
+	id: "claim-source-tampering",
+	name: "Claim Source Tampering",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 5.6.2",
+		cwe: "CWE-345",
+		description:
+			"Aggregated and distributed claims MUST be verified against the claims provider's signature",
+	},
+
+	description: "Serves aggregated/distributed claims with bad signatures or tampered data",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["aggregated", "distributed", "both"],
+			default: "both",
+			description: "Which claim sources are added",
+		},
+		{
+			name: "tamper",
+			type: "boolean",
+			default: true,
+			description: "Tamper with the sources; false serves valid ones as a baseline",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (!ctx.token.claimSources) {
+			return { applied: false, mutation: "Claim sources not available", evidence: {} };
+		}
+
+		const mode = (ctx.config.mode as ClaimSourceMode | undefined) ?? "both";
+		if (mode !== "aggregated" && mode !== "distributed" && mode !== "both") {
+			return {
+				applied: false,
+				mutation: `Unknown mode: ${mode}`,
+				evidence: { mode },
+			};
+		}
+		const tamper = (ctx.config.tamper as boolean | undefined) ?? true;
+
+		const claimNames: Record<string, string> = {};
+		const claimSources: Record<string, unknown> = {};
+		const sources: Record<string, unknown>[] = [];
+		const sub = ctx.token.claims.sub;
+
+		if (mode === "aggregated" || mode === "both") {
+			const signed = { sub, groups: ["users"] };
+			const tampered = { groups: ["users", "admin"] };
+			claimSources[AGGREGATED_SOURCE] = await ctx.token.claimSources.aggregated(
+				signed,
+				tamper ? { tamperedClaims: tampered } : {},
+			);
+			claimNames.groups = AGGREGATED_SOURCE;
+			sources.push({
+				name: AGGREGATED_SOURCE,
+				type: "aggregated",
+				claims: ["groups"],
+				tampered: tamper,
+				signedValue: signed.groups,
+				servedValue: tamper ? tampered.groups : signed.groups,
+			});
+		}
+
+		if (mode === "distributed" || mode === "both") {
+			const signed = { sub, roles: ["viewer"] };
+			const tampered = { roles: ["admin"] };
+			const source = await ctx.token.claimSources.distributed(
+				signed,
+				tamper ? { tamperedClaims: tampered } : {},
+			);
+			claimSources[DISTRIBUTED_SOURCE] = source;
+			claimNames.roles = DISTRIBUTED_SOURCE;
+			sources.push({
+				name: DISTRIBUTED_SOURCE,
+				type: "distributed",
+				endpoint: source.endpoint,
+				claims: ["roles"],
+				tampered: tamper,
+				signedValue: signed.roles,
+				servedValue: tamper ? tampered.roles : signed.roles,
+			});
+		}
+
+		// Claims delivered through sources must not also appear inline
+		for (const claim of Object.keys(claimNames)) {
+			delete ctx.token.claims[claim];
+		}
+		ctx.token.claims._claim_names = claimNames;
+		ctx.token.claims._claim_sources = claimSources;
+		// The token itself stays validly signed: only its sources are bad
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		const tamperedNames = sources.filter((s) => s.tampered).map((s) => s.name);
+
+		return {
+			applied: true,
+			mutation: tamper
+				? `Added ${sources.length} claim source(s) with tampered data: ${tamperedNames.join(", ")}`
+				: `Added ${sources.length} valid claim source(s)`,
+			evidence: {
+				mode,
+				sources,
+				tamperedSources: tamperedNames,
+				attackType: "claim-source-tampering",
+			},
+		};
+	},
+};
@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const claimTypeCoercion: MischiefPlugin = {
@@ -49,9 +50,7 @@ export const claimTypeCoercion: MischiefPlugin = {
 			},
 		];
 
-		const selectedCoercion = coercions[
-			Math.floor(Math.random() * coercions.length)
-		] as (typeof coercions)[0];
+		const selectedCoercion = coercions[randomInt(coercions.length)] as (typeof coercions)[0];
 		selectedCoercion.apply();
 
 		return {
@@ -0,0 +1,89 @@
+/**
+ * Client Assertion Bypass
+ *
+ * Issues tokens to a client authenticating with `private_key_jwt` even
+ * though its client assertion fails verification, instead of
+ * `401 invalid_client`. Modes (config `mode`):
+ * - expired: accepts an assertion past its `exp`
+ * - wrong-key: accepts an assertion signed with a key the client never
+ *   registered (or carrying an unsupported alg)
+ * - any: also accepts malformed assertions and wrong `iss`/`sub`/`aud`
+ * - both (default): expired or wrong-key
+ *
+ * The token endpoint is where a client assertion is checked. A test that
+ * gets a token here with a stale or forged assertion shows that nothing in
+ * between - a proxy or gateway in front of the authorization server -
+ * enforces it either.
+ *
+ * Spec: RFC 7523 Section 3 - the JWT MUST be rejected if expired or its signature is invalid
+ * CWE-287: Improper Authentication
+ */
+
+import type { ClientAssertionFailure } from "../../core/client-assertion.js";
+import type { MischiefPlugin } from "../types.js";
+
+const MODES: Record<string, ClientAssertionFailure[]> = {
+	expired: ["expired"],
+	"wrong-key": ["wrong-key"],
+	both: ["expired", "wrong-key"],
+	any: ["expired", "wrong-key", "malformed", "invalid-claims", "unsupported-type"],
+};
+
+export const clientAssertionBypass: MischiefPlugin = {
+	id: "client-assertion-bypass",
+	name: "Client Assertion Bypass",
+	severity: "high",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 7523 Section 3",
+		cwe: "CWE-287",
+		description: "A client assertion that is expired or wrongly signed MUST be rejected",
+	},
+
+	description: "Issues tokens for expired or wrongly signed private_key_jwt client assertions",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["expired", "wrong-key", "both", "any"],
+			default: "both",
+			description: "Which failing client assertions are accepted",
+		},
+	],
+
+	async apply(ctx) {
+		const check = ctx.endpoint?.clientAssertion;
+		if (!ctx.endpoint || check?.failure === undefined) {
+			return { applied: false, mutation: "No failed client assertion", evidence: {} };
+		}
+
+		const mode = (ctx.config.mode as string | undefined) ?? "both";
+		const accepted = MODES[mode];
+		if (!accepted) {
+			return { applied: false, mutation: `Unknown mode: ${mode}`, evidence: { mode } };
+		}
+		if (!accepted.includes(check.failure)) {
+			return {
+				applied: false,
+				mutation: `Mode ${mode} does not accept a ${check.failure} assertion`,
+				evidence: { failure: check.failure },
+			};
+		}
+		ctx.endpoint.actions.acceptClientAssertion = true;
+
+		return {
+			applied: true,
+			mutation: `Accepted a ${check.failure} client assertion from ${check.clientId}`,
+			evidence: {
+				clientId: check.clientId,
+				kid: check.kid,
+				alg: check.alg,
+				failure: check.failure,
+				reason: check.reason ?? null,
+				vulnerability: "Client authentication may be enforced nowhere along the path",
+			},
+		};
+	},
+};
@@ -0,0 +1,168 @@
+/**
+ * Clock Skew Probe
+ *
+ * Puts chosen timestamps a precise skew on the wrong side of now: `iat`
+ * and `nbf` after it (issued in, or valid from, the future), `exp` before
+ * it (just expired). Every client allows some clock skew, but one that
+ * allows too much accepts tokens well outside their validity. Running
+ * sessions with different skews binary-searches the window a client
+ * accepts; the evidence says whether each offset fell within a typical
+ * tolerance.
+ *
+ * Config (Go durations, e.g. "10m" or "2m30s"):
+ * - claims: the claims to skew, any of iat, nbf, exp (default ["iat", "nbf"])
+ * - skew: how far each lies on the wrong side of now (default "10m")
+ * - iatSkew, nbfSkew, expSkew: a claim's own skew, overriding `skew`
+ * - tolerance: the skew a client is expected to allow (default "5m")
+ *
+ * If `nbf` is skewed past an `exp` that isn't, `exp` is moved to keep the
+ * token's original lifetime after `nbf`. Tokens are re-signed with Loki's
+ * key, so only the timestamps are off.
+ *
+ * Spec: RFC 7519 Section 4.1.4 - "some small leeway, usually no more than a few minutes"
+ * CWE-613: Insufficient Session Expiration
+ */
+
+import { parseDuration } from "../../core/duration.js";
+import type { MischiefPlugin } from "../types.js";
+
+type SkewedClaim = "iat" | "nbf" | "exp";
+
+const SKEWED_CLAIMS: SkewedClaim[] = ["iat", "nbf", "exp"];
+
+const DEFAULT_SKEW = "10m";
+const DEFAULT_TOLERANCE = "5m";
+
+/** Lifetime given a token without usable iat/exp when exp has to move */
+const FALLBACK_LIFETIME_SECONDS = 3600;
+
+export const clockSkewProbe: MischiefPlugin = {
+	id: "clock-skew-probe",
+	name: "Clock Skew Probe",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 4.1.4",
+		cwe: "CWE-613",
+		description: "Clock skew leeway should be small, usually no more than a few minutes",
+	},
+
+	description: "Skews iat/nbf/exp by a precise offset to probe a client's clock-skew tolerance",
+
+	options: [
+		{
+			name: "claims",
+			type: "array",
+			default: ["iat", "nbf"],
+			description: "The claims to skew: any of iat, nbf and exp",
+		},
+		{
+			name: "skew",
+			type: "string",
+			default: DEFAULT_SKEW,
+			description: "How far each claim lies on the wrong side of now, as a Go duration",
+		},
+		{
+			name: "iatSkew",
+			type: "string",
+			description: "The skew for iat, overriding skew",
+		},
+		{
+			name: "nbfSkew",
+			type: "string",
+			description: "The skew for nbf, overriding skew",
+		},
+		{
+			name: "expSkew",
+			type: "string",
+			description: "The skew for exp, overriding skew",
+		},
+		{
+			name: "tolerance",
+			type: "string",
+			default: DEFAULT_TOLERANCE,
+			description: "The skew a client is expected to allow, as a Go duration",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const claims = (ctx.config.claims as unknown[] | undefined) ?? ["iat", "nbf"];
+		if (
+			!Array.isArray(claims) ||
+			claims.length === 0 ||
+			!claims.every((claim) => SKEWED_CLAIMS.includes(claim as SkewedClaim))
+		) {
+			return {
+				applied: false,
+				mutation: "claims must be a non-empty array of iat, nbf and exp",
+				evidence: { claims },
+			};
+		}
+		const tolerance = ctx.config.tolerance ?? DEFAULT_TOLERANCE;
+		const toleranceMs = typeof tolerance === "string" ? parseDuration(tolerance) : undefined;
+		if (toleranceMs === undefined || toleranceMs < 0) {
+			return {
+				applied: false,
+				mutation: "tolerance must be a Go duration",
+				evidence: { tolerance },
+			};
+		}
+		const skews: [SkewedClaim, string, number][] = [];
+		for (const claim of claims as SkewedClaim[]) {
+			const skew = ctx.config[`${claim}Skew`] ?? ctx.config.skew ?? DEFAULT_SKEW;
+			const ms = typeof skew === "string" ? parseDuration(skew) : undefined;
+			if (ms === undefined || ms < 1000) {
+				return {
+					applied: false,
+					mutation: `${claim}'s skew must be a Go duration of at least 1s`,
+					evidence: { claim, skew },
+				};
+			}
+			skews.push([claim, skew as string, Math.floor(ms / 1000)]);
+		}
+
+		const token = ctx.token.claims;
+		const original = { iat: token.iat ?? null, nbf: token.nbf ?? null, exp: token.exp ?? null };
+		const now = Math.floor(Date.now() / 1000);
+		const probes: Record<string, unknown> = {};
+		for (const [claim, skew, seconds] of skews) {
+			token[claim] = claim === "exp" ? now - seconds : now + seconds;
+			probes[claim] = {
+				skew,
+				value: token[claim],
+				withinTolerance: seconds * 1000 <= toleranceMs,
+			};
+		}
+		const nbf = token.nbf;
+		if (!("exp" in probes) && typeof nbf === "number" && (token.exp ?? 0) <= nbf) {
+			const lifetime =
+				typeof original.exp === "number" && typeof original.iat === "number"
+					? original.exp - original.iat
+					: FALLBACK_LIFETIME_SECONDS;
+			token.exp = nbf + Math.max(lifetime, 1);
+		}
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		const offsets = skews.map(
+			([claim, skew]) => `${claim} ${skew} ${claim === "exp" ? "before" : "after"} now`,
+		);
+		return {
+			applied: true,
+			mutation: `Set ${offsets.join(", ")} (tolerance ${tolerance})`,
+			evidence: {
+				tolerance,
+				probes,
+				original,
+				exp: token.exp ?? null,
+				expMoved: (token.exp ?? null) !== original.exp,
+			},
+		};
+	},
+};
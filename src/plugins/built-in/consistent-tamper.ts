@@ -0,0 +1,147 @@
+/**
+ * Consistent Tamper
+ *
+ * Changes claims and signs the result with an attacker key instead of
+ * Loki's, keeping everything else about the token consistent: the ID
+ * token's `at_hash` is recomputed for the access token the client receives,
+ * `c_hash` is untouched (the code and hash algorithm are unchanged, so it
+ * still matches), and by default the header keeps Loki's `kid`. Every claim
+ * check passes; only the signature gives the tampering away.
+ *
+ * The attacker key is never published in the JWKS. Config:
+ * - claims: claim changes to apply (default `{ "sub": "admin" }`)
+ * - key: "generated" (default; one key per alg, generated once) or a
+ *   private JWK
+ * - keepKid: keep Loki's kid in the header (default true); false uses the
+ *   attacker key's kid, which no JWKS entry matches
+ *
+ * Spec: RFC 7515 Section 5.2 - the JWS signature must validate before the payload is trusted
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import * as jose from "jose";
+import { attackerKey as generatedKey } from "../../core/attacker-keys.js";
+import { SUPPORTED_SIGNING_ALGORITHMS, type SigningAlgorithm } from "../../core/key-manager.js";
+import { tokenHash } from "../../core/token-forge.js";
+import type { MischiefPlugin } from "../types.js";
+
+interface AttackerKey {
+	kid: string;
+	pem: string;
+}
+
+export const consistentTamper: MischiefPlugin = {
+	id: "consistent-tamper",
+	name: "Consistent Tamper",
+	severity: "critical",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7515 Section 5.2",
+		oidc: "OIDC Core Section 3.1.3.7",
+		cwe: "CWE-347",
+		description:
+			"Clients MUST validate the signature against the issuer's keys before trusting any claim",
+	},
+
+	description: "Modifies claims and re-signs with an unpublished attacker key, hashes kept valid",
+
+	options: [
+		{
+			name: "claims",
+			type: "object",
+			default: { sub: "admin" },
+			description: "The claim changes applied",
+		},
+		{
+			name: "key",
+			type: ["string", "object"],
+			default: "generated",
+			description: "\"generated\" for a generated attacker key, or a private JWK",
+		},
+		{
+			name: "keepKid",
+			type: "boolean",
+			default: true,
+			description: "Keep Loki's kid in the header; false uses the attacker key's",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const alg = ctx.token.header.alg;
+		if (alg === "none" || alg.startsWith("HS")) {
+			return { applied: false, mutation: `Not an asymmetric signature: ${alg}`, evidence: {} };
+		}
+
+		const claims = (ctx.config.claims as Record<string, unknown> | undefined) ?? { sub: "admin" };
+		const keepKid = (ctx.config.keepKid as boolean | undefined) ?? true;
+		let attacker: AttackerKey;
+		try {
+			attacker = await attackerKey(alg, ctx.config.key);
+		} catch (err) {
+			const message = err instanceof Error ? err.message : String(err);
+			return { applied: false, mutation: `Unusable attacker key: ${message}`, evidence: { alg } };
+		}
+
+		const changedClaims: Record<string, { from: unknown; to: unknown }> = {};
+		for (const [name, value] of Object.entries(claims)) {
+			changedClaims[name] = { from: ctx.token.claims[name], to: value };
+			ctx.token.claims[name] = value;
+		}
+
+		const accessToken = ctx.token.accessToken;
+		const atHashUpdated = ctx.token.claims.at_hash !== undefined && accessToken !== undefined;
+		if (atHashUpdated) {
+			ctx.token.claims.at_hash = tokenHash(accessToken, alg);
+		}
+
+		const originalKid = ctx.token.header.kid;
+		if (!keepKid) {
+			ctx.token.header.kid = attacker.kid;
+		}
+		await ctx.token.sign(alg, attacker.pem);
+
+		const changed = Object.keys(claims).join(", ");
+		return {
+			applied: true,
+			mutation: `Changed ${changed} and signed with attacker key ${attacker.kid}`,
+			evidence: {
+				signedWith: "attacker-key",
+				attackerKid: attacker.kid,
+				originalKid,
+				headerKid: ctx.token.header.kid,
+				changedClaims,
+				atHashUpdated,
+			},
+		};
+	},
+};
+
+/**
+ * The configured attacker key as PKCS8 PEM, or the generated one for `alg`
+ */
+async function attackerKey(alg: string, config: unknown): Promise<AttackerKey> {
+	if (config !== undefined && config !== "generated") {
+		if (typeof config !== "object" || config === null) {
+			throw new Error('key must be "generated" or a private JWK');
+		}
+		const jwk = config as jose.JWK;
+		const privateKey = await jose.importJWK(jwk, alg);
+		if (privateKey instanceof Uint8Array) {
+			throw new Error("key must be an asymmetric private JWK");
+		}
+		return {
+			kid: jwk.kid ?? (await jose.calculateJwkThumbprint(jwk)),
+			pem: await jose.exportPKCS8(privateKey),
+		};
+	}
+
+	if (!SUPPORTED_SIGNING_ALGORITHMS.includes(alg as SigningAlgorithm)) {
+		throw new Error(`cannot generate a key for ${alg}`);
+	}
+	return generatedKey(alg as SigningAlgorithm);
+}
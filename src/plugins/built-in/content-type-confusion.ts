@@ -0,0 +1,79 @@
+/**
+ * Content Type Confusion
+ *
+ * Serves the token response with a Content-Type other than the JSON (or
+ * form encoding) the client negotiated; the body is left as it was. By
+ * default it's labelled `text/html`, which a browser or a careless client
+ * may render or sniff instead of parsing. Clients should check the media
+ * type before parsing a token response and refuse one they didn't ask for,
+ * rather than parsing whatever arrives.
+ *
+ * Config:
+ * - contentType: the Content-Type to serve (default: text/html; charset=utf-8)
+ *
+ * The negotiated and served types are recorded as a `token-content-type`
+ * session event.
+ *
+ * Spec: RFC 6749 Section 5.1 - parameters are included in the entity-body
+ * using the application/json media type
+ * CWE-436: Interpretation Conflict
+ */
+
+import { JSON_MEDIA_TYPE, mediaTypeOf } from "../../core/token-content-type.js";
+import type { MischiefPlugin } from "../types.js";
+
+const DEFAULT_CONTENT_TYPE = "text/html; charset=utf-8";
+
+export const contentTypeConfusion: MischiefPlugin = {
+	id: "content-type-confusion",
+	name: "Content Type Confusion",
+	severity: "medium",
+	phase: "response",
+
+	spec: {
+		rfc: "RFC 6749 Section 5.1",
+		cwe: "CWE-436",
+		description: "Token responses MUST use the application/json media type",
+	},
+
+	description: "Serves the token response as text/html or another mismatched Content-Type",
+
+	options: [
+		{
+			name: "contentType",
+			type: "string",
+			default: DEFAULT_CONTENT_TYPE,
+			description: "The Content-Type served; JSON types are refused",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.response) {
+			return { applied: false, mutation: "No response context", evidence: {} };
+		}
+
+		const configured = ctx.config.contentType;
+		if (configured !== undefined && (typeof configured !== "string" || configured === "")) {
+			return {
+				applied: false,
+				mutation: "contentType must be a non-empty string",
+				evidence: { contentType: configured },
+			};
+		}
+		const served = configured ?? DEFAULT_CONTENT_TYPE;
+		if (mediaTypeOf(served) === JSON_MEDIA_TYPE) {
+			return {
+				applied: false,
+				mutation: "contentType is the JSON a token response is served as",
+				evidence: { contentType: served },
+			};
+		}
+		ctx.response.headers["Content-Type"] = served;
+
+		return {
+			applied: true,
+			mutation: `Served the token response as ${served}`,
+			evidence: { expected: JSON_MEDIA_TYPE, served },
+		};
+	},
+};
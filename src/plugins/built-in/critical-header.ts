@@ -0,0 +1,111 @@
+/**
+ * Critical Header Attack
+ *
+ * Marks a header parameter the client can't know as critical: the token
+ * carries `"crit": ["loki-evil"]` and a `loki-evil` member. A validator
+ * that doesn't understand a parameter listed in `crit` MUST reject the
+ * token; naive validators ignore `crit` and accept it. The token is
+ * re-signed, so `crit` is the only reason left to reject it.
+ *
+ * Config:
+ * - param: the critical parameter's name (default: loki-evil)
+ * - value: the parameter's value (default: true)
+ *
+ * Spec: RFC 7515 Section 4.1.11 - a recipient that doesn't understand a
+ * parameter listed in `crit` MUST reject the JWS
+ * CWE-358: Improperly Implemented Security Check for Standard
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+const DEFAULT_PARAM = "loki-evil";
+
+/** Parameters RFC 7515 and RFC 7518 define, which `crit` MUST NOT list */
+const REGISTERED_PARAMS = new Set([
+	"alg",
+	"jku",
+	"jwk",
+	"kid",
+	"x5u",
+	"x5c",
+	"x5t",
+	"x5t#S256",
+	"typ",
+	"cty",
+	"crit",
+	"epk",
+	"apu",
+	"apv",
+	"iv",
+	"tag",
+	"p2s",
+	"p2c",
+]);
+
+export const criticalHeader: MischiefPlugin = {
+	id: "critical-header",
+	name: "Unrecognized Critical Header",
+	severity: "high",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 7515 Section 4.1.11",
+		cwe: "CWE-358",
+		description: "Unknown parameters listed in crit MUST cause the JWS to be rejected",
+	},
+
+	description: "Lists an unrecognized header parameter in crit and sets it",
+
+	options: [
+		{
+			name: "param",
+			type: "string",
+			default: DEFAULT_PARAM,
+			description: "The critical parameter's name; registered JOSE parameters are refused",
+		},
+		{
+			name: "value",
+			type: ["string", "number", "boolean", "array", "object"],
+			default: true,
+			description: "The critical parameter's value",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const param = ctx.config.param ?? DEFAULT_PARAM;
+		if (typeof param !== "string" || param === "") {
+			return { applied: false, mutation: "param must be a non-empty string", evidence: {} };
+		}
+		if (REGISTERED_PARAMS.has(param)) {
+			return {
+				applied: false,
+				mutation: `param '${param}' is a registered header parameter, which crit must not list`,
+				evidence: { param },
+			};
+		}
+		const value = ctx.config.value ?? true;
+
+		// Add to any crit list earlier mischief set
+		const existing = Array.isArray(ctx.token.header.crit) ? ctx.token.header.crit : [];
+		const crit = existing.includes(param) ? [...existing] : [...existing, param];
+		ctx.token.header.crit = crit;
+		ctx.token.header[param] = value;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Marked unrecognized header parameter '${param}' as critical`,
+			evidence: {
+				crit,
+				header: { [param]: value },
+				signatureValid: ctx.token.resign !== undefined,
+			},
+		};
+	},
+};
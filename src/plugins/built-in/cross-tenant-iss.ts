@@ -0,0 +1,95 @@
+/**
+ * Cross-Tenant Issuer
+ *
+ * Answers a token request made to one tenant (`/{tenant}/token`) with a
+ * token whose `iss` is another tenant's issuer, but signed with the
+ * requesting tenant's own key: published in that tenant's JWKS, absent
+ * from the claimed tenant's. A client that verifies the signature against
+ * any JWKS it can reach (the last one it fetched, or every tenant's),
+ * instead of the JWKS of the issuer the token claims, accepts it.
+ *
+ * Config:
+ * - tenant: the tenant whose issuer the token claims (default: the first
+ *   registered tenant other than the one asked)
+ *
+ * A request to Loki's own issuer counts as no tenant; its token is then
+ * signed with Loki's own key. The evidence records the requesting tenant,
+ * the claimed tenant and issuer, and the tenant whose key signed it.
+ *
+ * Spec: RFC 8725 Section 3.8 - the keys MUST belong to the issuer
+ * OIDC: OpenID Connect Core 1.0 Section 3.1.3.7 - use the keys provided by the Issuer
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const crossTenantIss: MischiefPlugin = {
+	id: "cross-tenant-iss",
+	name: "Cross-Tenant Issuer",
+	severity: "critical",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 8725 Section 3.8",
+		oidc: "OIDC Core 1.0 Section 3.1.3.7",
+		cwe: "CWE-347",
+		description: "A token's signing key MUST belong to the issuer its iss names",
+	},
+
+	description: "Claims another tenant's issuer while signing with the requesting tenant's key",
+
+	options: [
+		{
+			name: "tenant",
+			type: "string",
+			description: "The tenant whose issuer the token claims (default: another registered tenant)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const requested = ctx.token.tenant?.id ?? null;
+		const issuers = ctx.token.tenant?.issuers ?? {};
+		const configured = ctx.config.tenant;
+		const others = Object.keys(issuers).filter((id) => id !== requested);
+		const tenant = configured ?? others[0];
+		if (tenant === undefined) {
+			return {
+				applied: false,
+				mutation: "No other tenant to claim the issuer of",
+				evidence: { requestedTenant: requested },
+			};
+		}
+		if (typeof tenant !== "string" || !others.includes(tenant)) {
+			return {
+				applied: false,
+				mutation: "tenant must name a registered tenant other than the one asked",
+				evidence: { requestedTenant: requested, tenant },
+			};
+		}
+
+		const expectedIssuer = ctx.token.claims.iss;
+		const claimedIssuer = issuers[tenant] as string;
+		ctx.token.claims.iss = claimedIssuer;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		const signer = requested === null ? "Loki's own key" : `the key of tenant '${requested}'`;
+		return {
+			applied: true,
+			mutation: `Set iss to '${claimedIssuer}' (tenant '${tenant}'), signed with ${signer}`,
+			evidence: {
+				requestedTenant: requested,
+				claimedTenant: tenant,
+				claimedIssuer,
+				signingKeyTenant: requested,
+				kid: ctx.token.header.kid ?? null,
+				expectedIssuer: expectedIssuer ?? null,
+			},
+		};
+	},
+};
@@ -0,0 +1,91 @@
+/**
+ * Cross-Tenant Token
+ *
+ * Answers a token request made to one tenant (`/{tenant}/token`) with a
+ * token issued by another: its `iss` is the other tenant's issuer, and it
+ * is signed with that tenant's key, so it verifies against that tenant's
+ * JWKS. A client that only checks `iss` against a pattern (any
+ * `https://idp.example.com/*`), or that looks up the issuer and keys from
+ * the token itself, accepts tenant A's token as tenant B's.
+ *
+ * Config:
+ * - tenant: the tenant whose issuer to use (default: the first registered
+ *   tenant other than the one asked)
+ *
+ * Needs at least one tenant besides the one the request was made to; a
+ * request to Loki's own issuer counts as no tenant.
+ *
+ * Spec: OIDC Core 1.0 Section 3.1.3.7 - iss MUST exactly match the configured issuer
+ * CWE-863: Incorrect Authorization
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const crossTenantToken: MischiefPlugin = {
+	id: "cross-tenant-token",
+	name: "Cross-Tenant Token",
+	severity: "critical",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 4.1.1",
+		oidc: "OIDC Core 1.0 Section 3.1.3.7",
+		cwe: "CWE-863",
+		description: "The 'iss' claim MUST exactly match the tenant's issuer the client expects",
+	},
+
+	description: "Issues a token from another tenant's issuer in answer to a tenant's token request",
+
+	options: [
+		{
+			name: "tenant",
+			type: "string",
+			description: "The tenant that issues the token (default: another registered tenant)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const requested = ctx.token.tenant?.id ?? null;
+		const issuers = ctx.token.tenant?.issuers ?? {};
+		const configured = ctx.config.tenant;
+		const others = Object.keys(issuers).filter((id) => id !== requested);
+		const tenant = configured ?? others[0];
+		if (tenant === undefined) {
+			return {
+				applied: false,
+				mutation: "No other tenant to take a token from",
+				evidence: { requestedTenant: requested },
+			};
+		}
+		if (typeof tenant !== "string" || !others.includes(tenant)) {
+			return {
+				applied: false,
+				mutation: "tenant must name a registered tenant other than the one asked",
+				evidence: { requestedTenant: requested, tenant },
+			};
+		}
+
+		const expectedIssuer = ctx.token.claims.iss;
+		const issuer = issuers[tenant] as string;
+		ctx.token.claims.iss = issuer;
+		if (ctx.token.resignAsTenant) {
+			await ctx.token.resignAsTenant(tenant);
+		}
+
+		return {
+			applied: true,
+			mutation: `Set iss to '${issuer}', the issuer of tenant '${tenant}'`,
+			evidence: {
+				requestedTenant: requested,
+				tenant,
+				expectedIssuer: expectedIssuer ?? null,
+				issuer,
+				kid: ctx.token.header.kid ?? null,
+			},
+		};
+	},
+};
@@ -0,0 +1,133 @@
+/**
+ * Delegation Escalation
+ *
+ * Tampers with an access token issued by token exchange (one carrying an
+ * `act` claim) and re-signs it with Loki's key. Dropping the actor chain
+ * makes a token one service obtained on a user's behalf look like the
+ * user's own, so a downstream service that authorizes or audits by actor
+ * can no longer tell who is acting. Escalating the audience makes the
+ * token good at services the exchange never asked for. A resource server
+ * must check `act` where delegation matters, and `aud` always.
+ *
+ * Modes:
+ * - drop-act: Removes the `act` claim, so no actor is recorded (default)
+ * - audience: Adds audiences beyond those requested
+ *
+ * Config:
+ * - mode: one of the modes above
+ * - audience: for the audience mode, a string or array of strings to add
+ *   (default: https://loki.test/api)
+ *
+ * The session's attack report shows the actor chain and audience issued
+ * next to those the token was sent with.
+ *
+ * Spec: RFC 8693 Section 4.1 - the act claim identifies the acting party;
+ * RFC 7519 Section 4.1.3
+ * CWE-441: Unintended Proxy or Intermediary ('Confused Deputy')
+ */
+
+import { DEFAULT_RESOURCE } from "../../core/request-resource.js";
+import { actorChain } from "../../core/token-exchange.js";
+import type { MischiefPlugin } from "../types.js";
+
+type DelegationEscalationMode = "drop-act" | "audience";
+
+const MODES: DelegationEscalationMode[] = ["drop-act", "audience"];
+
+export const delegationEscalation: MischiefPlugin = {
+	id: "delegation-escalation",
+	name: "Delegation Escalation",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 8693 Section 4.1",
+		cwe: "CWE-441",
+		description: "Exchanged tokens must keep the actor chain and the audience requested",
+	},
+
+	description: "Drops the actor chain from an exchanged token, or widens its audience",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["drop-act", "audience"],
+			default: "drop-act",
+			description: "Drop the act claim, or add audiences beyond those requested",
+		},
+		{
+			name: "audience",
+			type: ["string", "array"],
+			default: DEFAULT_RESOURCE,
+			description: "The audiences added in audience mode",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		const { claims } = ctx.token;
+		const actors = actorChain(claims.act);
+		if (actors.length === 0) {
+			return { applied: false, mutation: "Not an exchanged token: no act claim", evidence: {} };
+		}
+
+		const mode = (ctx.config.mode as DelegationEscalationMode | undefined) ?? "drop-act";
+		if (!MODES.includes(mode)) {
+			return {
+				applied: false,
+				mutation: `mode must be one of ${MODES.join(", ")}`,
+				evidence: { mode },
+			};
+		}
+
+		if (mode === "drop-act") {
+			delete claims.act;
+			if (ctx.token.resign) {
+				await ctx.token.resign();
+			}
+			return {
+				applied: true,
+				mutation: `Dropped the actor chain ${actors.join(" <- ")}`,
+				evidence: { mode, actors },
+			};
+		}
+
+		const configured = ctx.config.audience ?? DEFAULT_RESOURCE;
+		const added = typeof configured === "string" ? [configured] : configured;
+		if (
+			!Array.isArray(added) ||
+			added.length === 0 ||
+			!added.every((a) => typeof a === "string" && a !== "")
+		) {
+			return {
+				applied: false,
+				mutation: "audience must be a non-empty string or array of strings",
+				evidence: { audience: configured },
+			};
+		}
+		const requested = claims.aud ?? null;
+		const current = requested === null ? [] : [requested].flat();
+		const escalated = [...new Set([...current, ...(added as string[])])];
+		if (escalated.length === current.length) {
+			return {
+				applied: false,
+				mutation: "The token is already issued for that audience",
+				evidence: { requested },
+			};
+		}
+
+		claims.aud = escalated;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+		const change = `${JSON.stringify(requested)} to ${JSON.stringify(escalated)}`;
+		return {
+			applied: true,
+			mutation: `Escalated the audience from ${change}`,
+			evidence: { mode, actors, requested, issued: escalated },
+		};
+	},
+};
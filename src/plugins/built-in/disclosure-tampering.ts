@@ -0,0 +1,156 @@
+/**
+ * Disclosure Tampering
+ *
+ * Alters a disclosure of an SD-JWT (issued by a session with `sdJwt`)
+ * after the token is signed, so its digest no longer matches any listed in
+ * the payload's `_sd` array. The JWS is untouched and verifies. A verifier
+ * must recompute the digest of every disclosure it is sent and reject the
+ * SD-JWT when one isn't listed; one that trusts disclosures as sent
+ * accepts whatever claims a holder cares to put in them.
+ *
+ * Modes:
+ * - value: Changes the disclosed claim's value (default)
+ * - name: Renames the disclosed claim, keeping its value
+ * - unlisted: Appends a disclosure of its own, whose digest `_sd` doesn't list
+ *
+ * Config:
+ * - mode: one of the modes above
+ * - claim: the disclosed claim to tamper with (default: the first
+ *   disclosure's), or the claim an unlisted disclosure adds (default: "admin")
+ * - value: the value to disclose instead (default: a changed copy of the
+ *   original, or `true` for an unlisted disclosure)
+ *
+ * Spec: draft-ietf-oauth-selective-disclosure-jwt Section 7.1 - Verification
+ * of the SD-JWT, every disclosure's digest must be found in the payload
+ * CWE-345: Insufficient Verification of Data Authenticity
+ */
+
+import { randomBytes } from "../../core/random.js";
+import { decodeDisclosure, disclosureDigest, encodeDisclosure } from "../../core/sd-jwt.js";
+import type { MischiefPlugin } from "../types.js";
+
+type DisclosureTamperingMode = "value" | "name" | "unlisted";
+
+const MODES: DisclosureTamperingMode[] = ["value", "name", "unlisted"];
+
+export const disclosureTampering: MischiefPlugin = {
+	id: "disclosure-tampering",
+	name: "SD-JWT Disclosure Tampering",
+	severity: "critical",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "draft-ietf-oauth-selective-disclosure-jwt Section 7.1",
+		cwe: "CWE-345",
+		description: "Verifiers must reject a disclosure whose digest isn't listed in the SD-JWT",
+	},
+
+	description: "Alters an SD-JWT disclosure so its digest no longer matches the _sd array",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["value", "name", "unlisted"],
+			default: "value",
+			description: "Change a disclosure's value or name, or add an unlisted one",
+		},
+		{
+			name: "claim",
+			type: "string",
+			description: "The disclosed claim to tamper with, or the claim an unlisted disclosure adds",
+		},
+		{
+			name: "value",
+			type: ["string", "number", "boolean", "array", "object"],
+			description: "The value disclosed instead (default: a changed copy of the original)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		const { disclosures } = ctx.token;
+		if (disclosures === undefined) {
+			return { applied: false, mutation: "Token is not an SD-JWT", evidence: {} };
+		}
+
+		const mode = (ctx.config.mode as DisclosureTamperingMode | undefined) ?? "value";
+		if (!MODES.includes(mode)) {
+			return {
+				applied: false,
+				mutation: `mode must be one of ${MODES.join(", ")}`,
+				evidence: { mode },
+			};
+		}
+		const claim = ctx.config.claim as string | undefined;
+
+		if (mode === "unlisted") {
+			const name = claim ?? "admin";
+			const value = ctx.config.value ?? true;
+			const added = encodeDisclosure(randomBytes(16).toString("base64url"), name, value);
+			ctx.token.disclosures = [...disclosures, added];
+			return {
+				applied: true,
+				mutation: `Appended an unlisted disclosure of ${name}: ${JSON.stringify(value)}`,
+				evidence: { mode, claim: name, value, disclosure: added, digest: disclosureDigest(added) },
+			};
+		}
+
+		const index = disclosures.findIndex((disclosure) => {
+			const decoded = decodeDisclosure(disclosure);
+			return decoded !== undefined && (claim === undefined || decoded.name === claim);
+		});
+		const original = disclosures[index];
+		const decoded = original === undefined ? undefined : decodeDisclosure(original);
+		if (original === undefined || decoded === undefined) {
+			const mutation =
+				claim === undefined ? "The SD-JWT carries no disclosures" : `No disclosure of ${claim}`;
+			return { applied: false, mutation, evidence: { claim } };
+		}
+
+		let name = decoded.name;
+		let value = decoded.value;
+		let mutation: string;
+		if (mode === "name") {
+			name = `${decoded.name}_`;
+			mutation = `Renamed the disclosed ${decoded.name} to ${name}`;
+		} else {
+			value = ctx.config.value ?? tamperedValue(decoded.value);
+			const change = `${JSON.stringify(decoded.value)} to ${JSON.stringify(value)}`;
+			mutation = `Changed the disclosed ${decoded.name} from ${change}`;
+		}
+		const tampered = encodeDisclosure(decoded.salt, name, value);
+		ctx.token.disclosures = disclosures.with(index, tampered);
+
+		return {
+			applied: true,
+			mutation,
+			evidence: {
+				mode,
+				claim: decoded.name,
+				original: { name: decoded.name, value: decoded.value },
+				tampered: { name, value },
+				listedDigest: disclosureDigest(original),
+				digest: disclosureDigest(tampered),
+			},
+		};
+	},
+};
+
+/**
+ * A value of the same type that differs from the original
+ */
+function tamperedValue(value: unknown): unknown {
+	if (typeof value === "boolean") {
+		return !value;
+	}
+	if (typeof value === "number") {
+		return value + 1;
+	}
+	if (typeof value === "string") {
+		return `${value}.tampered`;
+	}
+	return "tampered";
+}
@@ -60,6 +60,40 @@ export const discoveryConfusionPlugin: MischiefPlugin = {
 
 	description: "Manipulates OIDC discovery document to test metadata validation",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: [
+				"issuer-mismatch",
+				"malicious-jwks",
+				"malicious-token",
+				"weak-algorithms",
+				"remove-required",
+			],
+			default: "issuer-mismatch",
+			description: "How the discovery document is manipulated",
+		},
+		{
+			name: "fakeIssuer",
+			type: "string",
+			default: "https://evil-idp.attacker.com",
+			description: "The issuer advertised in issuer-mismatch mode",
+		},
+		{
+			name: "maliciousJwksUri",
+			type: "string",
+			default: "https://attacker.com/jwks.json",
+			description: "The jwks_uri advertised in malicious-jwks mode",
+		},
+		{
+			name: "maliciousTokenEndpoint",
+			type: "string",
+			default: "https://attacker.com/token",
+			description: "The token_endpoint advertised in malicious-token mode",
+		},
+	],
+
 	async apply(ctx) {
 		// Discovery plugins receive the discovery document in response.body
 		if (!ctx.response?.body) {
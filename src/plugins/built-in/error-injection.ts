@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const errorInjection: MischiefPlugin = {
@@ -36,7 +37,7 @@ export const errorInjection: MischiefPlugin = {
 		];
 
 		const selectedPayload = errorPayloads[
-			Math.floor(Math.random() * errorPayloads.length)
+			randomInt(errorPayloads.length)
 		] as (typeof errorPayloads)[0];
 
 		ctx.token.claims.error = selectedPayload.error;
@@ -0,0 +1,86 @@
+/**
+ * Essential Claim Omission
+ *
+ * A client can mark the claims it can't do without as essential in its
+ * `claims` request parameter. An authorization server that can't deliver
+ * one still answers normally rather than failing the request, so it's the
+ * client that must check the ID token for them. This plugin drops an
+ * essential claim from ID tokens whose client requested one, and re-signs
+ * the token with Loki's key. A client that assumes every essential claim
+ * arrives goes on with an account missing the attribute it relies on (an
+ * email it keys accounts on, say).
+ *
+ * Config:
+ * - claim: the essential claim to drop (default: the first one the token carries)
+ *
+ * Spec: OIDC Core 1.0 Section 5.5.1 - essential claims may be withheld,
+ * without an error
+ * CWE-754: Improper Check for Unusual or Exceptional Conditions
+ */
+
+import { essentialClaims } from "../../core/request-claims.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const essentialClaimOmission: MischiefPlugin = {
+	id: "essential-claim-omission",
+	name: "Essential Claim Omission",
+	severity: "medium",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 5.5.1",
+		cwe: "CWE-754",
+		description: "Clients MUST check that the essential claims they requested were returned",
+	},
+
+	description: "Drops an essential claim the client requested from its ID token",
+
+	options: [
+		{
+			name: "claim",
+			type: "string",
+			description: "The essential claim dropped (default: the first one the token carries)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		const requested = ctx.token.requestedClaims;
+		if (ctx.token.tokenType === "access_token" || !requested) {
+			return { applied: false, mutation: "No claims request for this token", evidence: {} };
+		}
+
+		const { claims } = ctx.token;
+		const essential = essentialClaims(requested);
+		const configured = ctx.config.claim;
+		if (configured !== undefined && typeof configured !== "string") {
+			return {
+				applied: false,
+				mutation: "claim must be a string",
+				evidence: { claim: configured },
+			};
+		}
+		const claim = configured ?? essential.find((name) => claims[name] !== undefined);
+		if (claim === undefined || !essential.includes(claim) || claims[claim] === undefined) {
+			return {
+				applied: false,
+				mutation: "The token carries no such essential claim",
+				evidence: { essential, claim: claim ?? null },
+			};
+		}
+
+		const value = claims[claim];
+		claims[claim] = undefined;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Removed the essential claim ${claim}`,
+			evidence: { essential, omitted: claim, value },
+		};
+	},
+};
@@ -0,0 +1,85 @@
+/**
+ * expires_in Mismatch
+ *
+ * Moves the access token's `exp` so it disagrees with the `expires_in` the
+ * token response reports: by default the response still says the token
+ * lives an hour (or the session's `tokenLifetime`) while `exp` is 10
+ * seconds after `iat`. A client that schedules its refresh from
+ * `expires_in` alone keeps sending a token resource servers already
+ * reject; one that reads `exp`, or refreshes on a 401, recovers.
+ *
+ * Config:
+ * - expSeconds: how long after `iat` the token's `exp` lies (default 10);
+ *   longer than `expires_in`, the token outlives what the client was told
+ *
+ * Tokens are re-signed with Loki's key, so only `exp` is off. The session
+ * report shows each access token's `expires_in` next to its `exp`.
+ *
+ * Spec: RFC 6749 Section 5.1 - expires_in is the lifetime of the access token
+ * CWE-613: Insufficient Session Expiration
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+const DEFAULT_EXP_SECONDS = 10;
+
+export const expiresInMismatch: MischiefPlugin = {
+	id: "expires-in-mismatch",
+	name: "expires_in Mismatch",
+	severity: "medium",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 6749 Section 5.1",
+		cwe: "CWE-613",
+		description: "expires_in is the lifetime of the access token, which its exp must reflect",
+	},
+
+	description: "Access token exp disagrees with the expires_in the token response reports",
+
+	options: [
+		{
+			name: "expSeconds",
+			type: "integer",
+			default: DEFAULT_EXP_SECONDS,
+			description: "How long after iat the access token's exp lies",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (ctx.token.tokenType === "id_token") {
+			return { applied: false, mutation: "expires_in describes the access token", evidence: {} };
+		}
+
+		const expSeconds = ctx.config.expSeconds ?? DEFAULT_EXP_SECONDS;
+		if (!(Number.isInteger(expSeconds) && (expSeconds as number) >= 1)) {
+			return {
+				applied: false,
+				mutation: "expSeconds must be a positive integer",
+				evidence: { expSeconds },
+			};
+		}
+
+		const { claims } = ctx.token;
+		const originalExp = claims.exp;
+		const iat = typeof claims.iat === "number" ? claims.iat : Math.floor(Date.now() / 1000);
+		claims.exp = iat + (expSeconds as number);
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Set exp ${expSeconds}s after iat, leaving expires_in as reported`,
+			evidence: {
+				originalExp,
+				exp: claims.exp,
+				expSeconds,
+				signatureValid: ctx.token.resign !== undefined,
+			},
+		};
+	},
+};
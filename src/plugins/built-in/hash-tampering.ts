@@ -0,0 +1,128 @@
+/**
+ * Hash Tampering
+ *
+ * Corrupts the ID token's `at_hash` and `c_hash` while keeping them
+ * plausible, then re-signs the token with Loki's key, so the signature,
+ * the claims' format and their length all check out and only a client that
+ * recomputes the hashes notices. Loki otherwise keeps `at_hash` matching
+ * the access token the client receives.
+ *
+ * Config:
+ * - technique: how the hashes are corrupted
+ *   - "flip" (default): one bit of each hash the token carries is flipped
+ *   - "wrong-alg": `at_hash` is hashed with SHA-512 for an alg that calls
+ *     for SHA-256, and with SHA-256 otherwise
+ *   - "full-digest": `at_hash` is the whole digest, not its left-most half
+ *
+ * Spec: OIDC Core 1.0 Section 3.3.2.11 - at_hash and c_hash are the left-most
+ * half of the hash under the ID token's alg
+ * CWE-354: Improper Validation of Integrity Check Value
+ */
+
+import { createHash } from "node:crypto";
+import { tokenHash } from "../../core/token-forge.js";
+import type { MischiefPlugin } from "../types.js";
+
+const TECHNIQUES = ["flip", "wrong-alg", "full-digest"] as const;
+type Technique = (typeof TECHNIQUES)[number];
+
+export const hashTampering: MischiefPlugin = {
+	id: "hash-tampering",
+	name: "Hash Tampering",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 3.3.2.11",
+		cwe: "CWE-354",
+		description: "at_hash and c_hash must be recomputed and compared, not just parsed",
+	},
+
+	description: "Corrupts at_hash and c_hash in validly signed ID tokens",
+
+	options: [
+		{
+			name: "technique",
+			type: "string",
+			values: TECHNIQUES,
+			default: "flip",
+			description: "How at_hash and c_hash are corrupted",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const technique = (ctx.config.technique as string | undefined) ?? "flip";
+		if (!TECHNIQUES.includes(technique as Technique)) {
+			return {
+				applied: false,
+				mutation: `technique must be one of: ${TECHNIQUES.join(", ")}`,
+				evidence: { technique },
+			};
+		}
+
+		const claims = ctx.token.claims;
+		const alg = ctx.token.header.alg;
+		const accessToken = ctx.token.accessToken;
+		const tampered: Record<string, { before: unknown; after: string }> = {};
+
+		if (technique === "flip") {
+			for (const claim of ["at_hash", "c_hash"] as const) {
+				const value = claims[claim];
+				if (typeof value === "string" && value.length > 0) {
+					tampered[claim] = { before: value, after: flipBit(value) };
+				}
+			}
+		} else if (accessToken !== undefined) {
+			tampered.at_hash = {
+				before: claims.at_hash,
+				after:
+					technique === "wrong-alg"
+						? tokenHash(accessToken, alg.endsWith("256") ? "RS512" : "RS256")
+						: fullDigest(accessToken, alg),
+			};
+		}
+
+		const names = Object.keys(tampered);
+		if (names.length === 0) {
+			return { applied: false, mutation: "No at_hash or c_hash to tamper with", evidence: {} };
+		}
+
+		for (const [claim, { after }] of Object.entries(tampered)) {
+			claims[claim] = after;
+		}
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Tampered with ${names.join(" and ")} (${technique})`,
+			evidence: {
+				technique,
+				tampered,
+				vulnerability: "Client may accept an ID token without recomputing its hashes",
+			},
+		};
+	},
+};
+
+/**
+ * Flip the lowest bit of a base64url value's first byte, keeping its length
+ */
+function flipBit(value: string): string {
+	const bytes = Buffer.from(value, "base64url");
+	bytes[0] = (bytes[0] ?? 0) ^ 1;
+	return bytes.toString("base64url");
+}
+
+/**
+ * The whole digest an alg's hash produces, where only its left half belongs
+ */
+function fullDigest(value: string, alg: string): string {
+	const bits = alg === "EdDSA" ? "512" : alg.slice(2);
+	return createHash(`sha${bits}`).update(value, "ascii").digest("base64url");
+}
@@ -0,0 +1,71 @@
+/**
+ * HEAD Content-Length Mismatch
+ *
+ * Answers HEAD on the discovery document and the JWKS with a
+ * Content-Length that doesn't match the GET body. Caches and clients that
+ * probe with HEAD and trust its metadata - to size a buffer, to decide
+ * whether a cached copy changed - act on a length that is wrong.
+ *
+ * Config:
+ * - delta: Bytes added to the real length; negative shrinks it (default 1024)
+ *
+ * Spec: RFC 9110 Section 9.3.2 - HEAD SHOULD send the same header fields as GET
+ * CWE-436: Interpretation Conflict
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+const METADATA_PATHS = new Set([
+	"/.well-known/openid-configuration",
+	"/jwks",
+	"/.well-known/jwks.json",
+]);
+
+export const headContentLengthMismatch: MischiefPlugin = {
+	id: "head-content-length-mismatch",
+	name: "HEAD Content-Length Mismatch",
+	severity: "medium",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 9110 Section 9.3.2",
+		cwe: "CWE-436",
+		description: "A HEAD response SHOULD carry the same Content-Length as the GET response",
+	},
+
+	description: "Misreports Content-Length on HEAD for discovery and JWKS",
+
+	options: [
+		{
+			name: "delta",
+			type: "integer",
+			default: 1024,
+			description: "Bytes added to the real Content-Length; negative shrinks it",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (!METADATA_PATHS.has(ctx.endpoint.path)) {
+			return { applied: false, mutation: "Not a discovery or JWKS HEAD request", evidence: {} };
+		}
+
+		const delta = (ctx.config.delta as number | undefined) ?? 1024;
+		if (delta === 0) {
+			return { applied: false, mutation: "Delta of 0 leaves Content-Length correct", evidence: {} };
+		}
+
+		ctx.endpoint.actions.headContentLengthDelta = delta;
+
+		return {
+			applied: true,
+			mutation: `HEAD Content-Length off by ${delta > 0 ? "+" : ""}${delta} bytes`,
+			evidence: {
+				path: ctx.endpoint.path,
+				delta,
+			},
+		};
+	},
+};
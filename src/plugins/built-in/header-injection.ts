@@ -0,0 +1,112 @@
+/**
+ * Header Injection
+ *
+ * The protected-header counterpart of claim-injection: merges
+ * attacker-chosen parameters into the JWS header, e.g. `"cty":
+ * "application/json"` or a vendor field such as `"x-tenant": "globex"`.
+ * Clients must ignore header parameters they don't understand (unless
+ * `crit` lists them), so one that changes how it parses the payload on
+ * `cty`, or trips over a field it didn't expect, is reading the header too
+ * eagerly. The token is re-signed with Loki's key.
+ *
+ * Values replace the header's own, `alg` and `kid` included: that's the
+ * point of testing against them. An injected `alg` is kept as written, so
+ * the header names an algorithm other than the one that signed it. Each
+ * overridden registered parameter is flagged in the evidence, along with
+ * the header as assembled.
+ *
+ * Config:
+ * - headers: the parameters to merge (sessions may set it with `headers`)
+ *
+ * Spec: RFC 7515 Section 4 - header parameters that aren't understood
+ * MUST be ignored, unless listed in crit
+ * CWE-345: Insufficient Verification of Data Authenticity
+ */
+
+import { isPlainObject } from "../../core/session-spec.js";
+import type { MischiefPlugin } from "../types.js";
+
+/** Header parameters RFC 7515 registers, whose override is flagged */
+const REGISTERED_PARAMS = [
+	"alg",
+	"jku",
+	"jwk",
+	"kid",
+	"x5u",
+	"x5c",
+	"x5t",
+	"x5t#S256",
+	"typ",
+	"cty",
+	"crit",
+];
+
+export const headerInjection: MischiefPlugin = {
+	id: "header-injection",
+	name: "Header Injection",
+	severity: "high",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 7515 Section 4",
+		cwe: "CWE-345",
+		description: "Header parameters a client doesn't understand MUST be ignored",
+	},
+
+	description: "Merges attacker-controlled parameters (e.g. cty) into the JWS header",
+
+	options: [
+		{
+			name: "headers",
+			type: "object",
+			description: "The parameters merged into the JWS header (session shorthand: headers)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const injected = ctx.config.headers;
+		if (!isPlainObject(injected) || Object.keys(injected).length === 0) {
+			return { applied: false, mutation: "No headers configured", evidence: {} };
+		}
+
+		const { header } = ctx.token;
+		const previous: Record<string, unknown> = {};
+		for (const [name, value] of Object.entries(injected)) {
+			if (name === "__proto__") {
+				continue;
+			}
+			previous[name] = header[name] ?? null;
+			header[name] = structuredClone(value);
+		}
+		const registeredOverrides = Object.keys(previous).filter((name) =>
+			REGISTERED_PARAMS.includes(name),
+		);
+		// Signing sets alg to the key's, unless the header is emitted as is
+		if ("alg" in previous) {
+			ctx.token.rawHeader = JSON.stringify(header);
+		}
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		const names = Object.keys(previous).join(", ");
+		return {
+			applied: true,
+			mutation:
+				registeredOverrides.length > 0
+					? `Injected header ${names}, overriding registered ${registeredOverrides.join(", ")}`
+					: `Injected header ${names}`,
+			evidence: {
+				injected,
+				previous,
+				registeredOverrides,
+				header: JSON.parse(ctx.token.rawHeader ?? JSON.stringify(header)),
+				resigned: ctx.token.resign !== undefined,
+			},
+		};
+	},
+};
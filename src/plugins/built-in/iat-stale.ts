@@ -0,0 +1,71 @@
+/**
+ * Stale iat
+ *
+ * Some clients bound replay by rejecting tokens issued too long ago,
+ * computing a token's age from `iat` rather than trusting `exp` alone.
+ * This plugin moves `iat` far into the past (`staleSeconds`, default one
+ * week) and leaves `exp` untouched, so the token is unexpired but claims
+ * to be old. Clients that enforce a maximum age should reject it; clients
+ * that only check `exp` accept it.
+ *
+ * Tokens are re-signed with Loki's key, so only the issue time is wrong.
+ *
+ * Spec: OIDC Core 1.0 Section 3.1.3.7 - iat can reject tokens issued too long ago
+ * CWE-294: Authentication Bypass by Capture-replay
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const iatStale: MischiefPlugin = {
+	id: "iat-stale",
+	name: "Stale iat",
+	severity: "medium",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 3.1.3.7",
+		rfc: "RFC 7519 Section 4.1.6",
+		cwe: "CWE-294",
+		description: "Clients enforcing a maximum token age must reject tokens issued too long ago",
+	},
+
+	description: "Emits an iat far in the past while exp is still valid",
+
+	options: [
+		{
+			name: "staleSeconds",
+			type: "integer",
+			default: 604800,
+			description: "How far before now iat is moved",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const staleSeconds = (ctx.config.staleSeconds as number | undefined) ?? 7 * 24 * 60 * 60;
+		if (!Number.isInteger(staleSeconds) || staleSeconds < 1) {
+			return {
+				applied: false,
+				mutation: "staleSeconds must be a positive integer",
+				evidence: { staleSeconds },
+			};
+		}
+
+		const { claims } = ctx.token;
+		const originalIat = claims.iat;
+		const iat = Math.floor(Date.now() / 1000) - staleSeconds;
+		claims.iat = iat;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Set iat ${staleSeconds}s in the past; exp unchanged`,
+			evidence: { originalIat: originalIat ?? null, iat, staleSeconds, exp: claims.exp ?? null },
+		};
+	},
+};
@@ -2,45 +2,111 @@
  * Built-in mischief plugins
  *
  * Organized by attack category:
- * - Signature attacks: alg-none, key-confusion, kid-manipulation, token-type-confusion, weak-algorithms, jku-injection, x5u-injection, embedded-jwk-attack, crit-header-bypass, curve-confusion
- * - Claims attacks: issuer-confusion, audience-confusion, subject-manipulation, temporal-tampering, scope-injection, azp-confusion, at-hash-c-hash-mismatch, token-lifetime-abuse, claim-type-coercion, unicode-normalization, json-parsing-differentials
- * - Flow attacks: nonce-bypass, state-bypass, pkce-downgrade, response-mode-mismatch, iss-in-response-attack, response-type-confusion
- * - Discovery attacks: discovery-confusion, jwks-injection, jwks-domain-mismatch, massive-jwks, massive-metadata
- * - Resilience: latency-injection, massive-token, error-injection, partial-success
+ * - Signature attacks: alg-none, alg-none-partial, signature-stripping, key-confusion, ec-key-confusion, kid-manipulation, token-type-confusion, typ-confusion, weak-algorithms, jku-injection, x5u-injection, x5c-injection, embedded-jwk-attack, embedded-jwk, crit-header-bypass, critical-header, curve-confusion, header-case, header-injection, b64-false, consistent-tamper, kid-confusion, jwe-tampering, none-with-signature, split-validity, malformed-base64, segment-count, disclosure-tampering
+ * - Claims attacks: issuer-confusion, iss-mismatch, cross-tenant-token, cross-tenant-iss, audience-confusion, aud-confusion, audience-ignoring, subject-manipulation, sub-tampering, sub-omission, temporal-tampering, temporal-future, nbf-future, scope-injection, scope-escalation, auth-context-spoof, azp-confusion, at-hash-c-hash-mismatch, hash-tampering, token-lifetime-abuse, claim-type-coercion, unicode-normalization, json-parsing-differentials, duplicate-claims, claim-source-tampering, verified-flags, claim-injection, iss-sub-collision, sub-overlong, rar-over-grant, iat-stale, clock-skew-probe, malformed-timestamps, aud-type-flip, expires-in-mismatch
+ * - Flow attacks: nonce-bypass, nonce-omission, nonce-mismatch, state-bypass, pkce-downgrade, response-mode-mismatch, iss-in-response-attack, response-type-confusion, revocation-list-omission, userinfo-scope-violation, userinfo-tampering, display-param-ignored, response-field-injection, pkce-plain-accept, request-object-replay, refresh-reuse-detection-off, max-age-ignored, dpop-nonce-challenge, cert-bound-token-mismatch, public-client-secret-accept, client-assertion-bypass, slow-down-storm, introspection-lies, response-mode-downgrade, delegation-escalation, dpop-binding-mismatch, essential-claim-omission, jti-reuse, revocation-ignored, redirect-uri-validation-bypass
+ * - Discovery attacks: discovery-confusion, jwks-injection, jwks-domain-mismatch, massive-jwks, massive-metadata, head-content-length-mismatch, kid-key-swap, jwks-decoy-keys, metadata-mismatch, jwks-key-rotation-race, mixed-key-type-jwks, jwks-cache-poison, jwks-no-cache, jwks-transport-abuse, discovery-tampering
+ * - Resilience: latency-injection, massive-token, oversized-token, error-injection, token-error, partial-success, response-timing, request-id-mismatch, slow-response, content-type-confusion
  */
 
 // Signature/Algorithm attacks
 export { algNonePlugin } from "./alg-none.js";
+export { algNonePartial } from "./alg-none-partial.js";
+export { noneWithSignature } from "./none-with-signature.js";
+export { splitValidity } from "./split-validity.js";
+export { signatureStripping } from "./signature-stripping.js";
 export { keyConfusionPlugin } from "./key-confusion.js";
+export { ecKeyConfusion } from "./ec-key-confusion.js";
 export { kidManipulationPlugin } from "./kid-manipulation.js";
+export { kidConfusion } from "./kid-confusion.js";
 export { tokenTypeConfusionPlugin } from "./token-type-confusion.js";
+export { typConfusion } from "./typ-confusion.js";
 export { weakAlgorithms } from "./weak-algorithms.js";
 export { jkuInjection } from "./jku-injection.js";
 export { x5uInjection } from "./x5u-injection.js";
+export { x5cInjection } from "./x5c-injection.js";
 export { embeddedJwkAttack } from "./embedded-jwk-attack.js";
+export { embeddedJwk } from "./embedded-jwk.js";
 export { critHeaderBypass } from "./crit-header-bypass.js";
+export { criticalHeader } from "./critical-header.js";
+export { malformedBase64 } from "./malformed-base64.js";
+export { segmentCount } from "./segment-count.js";
 export { curveConfusion } from "./curve-confusion.js";
+export { headerCase } from "./header-case.js";
+export { headerInjection } from "./header-injection.js";
+export { b64False } from "./b64-false.js";
+export { consistentTamper } from "./consistent-tamper.js";
+export { jweTampering } from "./jwe-tampering.js";
+export { disclosureTampering } from "./disclosure-tampering.js";
 
 // Claims manipulation attacks
 export { issuerConfusionPlugin } from "./issuer-confusion.js";
+export { issMismatch } from "./iss-mismatch.js";
+export { crossTenantToken } from "./cross-tenant-token.js";
+export { crossTenantIss } from "./cross-tenant-iss.js";
 export { audienceConfusionPlugin } from "./audience-confusion.js";
+export { audConfusion } from "./aud-confusion.js";
+export { audienceIgnoring } from "./audience-ignoring.js";
 export { subjectManipulationPlugin } from "./subject-manipulation.js";
+export { subTampering } from "./sub-tampering.js";
+export { subOmission } from "./sub-omission.js";
 export { temporalTamperingPlugin } from "./temporal-tampering.js";
+export { temporalFuture } from "./temporal-future.js";
+export { nbfFuture } from "./nbf-future.js";
+export { clockSkewProbe } from "./clock-skew-probe.js";
+export { expiresInMismatch } from "./expires-in-mismatch.js";
 export { scopeInjectionPlugin } from "./scope-injection.js";
+export { scopeEscalation } from "./scope-escalation.js";
+export { authContextSpoof } from "./auth-context-spoof.js";
 export { azpConfusion } from "./azp-confusion.js";
 export { atHashCHashMismatch } from "./at-hash-c-hash-mismatch.js";
+export { hashTampering } from "./hash-tampering.js";
 export { tokenLifetimeAbuse } from "./token-lifetime-abuse.js";
 export { claimTypeCoercion } from "./claim-type-coercion.js";
 export { unicodeNormalization } from "./unicode-normalization.js";
 export { jsonParsingDifferentials } from "./json-parsing-differentials.js";
+export { duplicateClaims } from "./duplicate-claims.js";
+export { claimSourceTamperingPlugin } from "./claim-source-tampering.js";
+export { verifiedFlags } from "./verified-flags.js";
+export { claimInjection } from "./claim-injection.js";
+export { issSubCollision } from "./iss-sub-collision.js";
+export { subOverlong } from "./sub-overlong.js";
+export { rarOverGrant } from "./rar-over-grant.js";
+export { iatStale } from "./iat-stale.js";
+export { malformedTimestamps } from "./malformed-timestamps.js";
+export { audTypeFlip } from "./aud-type-flip.js";
 
 // Flow/Protocol attacks
 export { nonceBypassPlugin } from "./nonce-bypass.js";
+export { nonceOmission } from "./nonce-omission.js";
+export { nonceMismatch } from "./nonce-mismatch.js";
 export { stateBypassPlugin } from "./state-bypass.js";
 export { pkceDowngradePlugin } from "./pkce-downgrade.js";
 export { responseModeMismatch } from "./response-mode-mismatch.js";
 export { issInResponseAttack } from "./iss-in-response-attack.js";
 export { responseTypeConfusion } from "./response-type-confusion.js";
+export { revocationListOmission } from "./revocation-list-omission.js";
+export { userinfoScopeViolation } from "./userinfo-scope-violation.js";
+export { userinfoTampering } from "./userinfo-tampering.js";
+export { displayParamIgnored } from "./display-param-ignored.js";
+export { responseFieldInjection } from "./response-field-injection.js";
+export { pkcePlainAccept } from "./pkce-plain-accept.js";
+export { requestObjectReplay } from "./request-object-replay.js";
+export { refreshReuseDetectionOff } from "./refresh-reuse-detection-off.js";
+export { maxAgeIgnored } from "./max-age-ignored.js";
+export { dpopNonceChallenge } from "./dpop-nonce-challenge.js";
+export { certBoundTokenMismatch } from "./cert-bound-token-mismatch.js";
+export { slowDownStorm } from "./slow-down-storm.js";
+export { introspectionLies } from "./introspection-lies.js";
+export { publicClientSecretAccept } from "./public-client-secret-accept.js";
+export { clientAssertionBypass } from "./client-assertion-bypass.js";
+export { responseModeDowngrade } from "./response-mode-downgrade.js";
+export { delegationEscalation } from "./delegation-escalation.js";
+export { dpopBindingMismatch } from "./dpop-binding-mismatch.js";
+export { essentialClaimOmission } from "./essential-claim-omission.js";
+export { jtiReuse } from "./jti-reuse.js";
+export { revocationIgnored } from "./revocation-ignored.js";
+export { redirectUriValidationBypass } from "./redirect-uri-validation-bypass.js";
 
 // Discovery/JWKS attacks
 export { discoveryConfusionPlugin } from "./discovery-confusion.js";
@@ -48,71 +114,186 @@ export { jwksInjectionPlugin } from "./jwks-injection.js";
 export { jwksDomainMismatch } from "./jwks-domain-mismatch.js";
 export { massiveJwks } from "./massive-jwks.js";
 export { massiveMetadata } from "./massive-metadata.js";
+export { headContentLengthMismatch } from "./head-content-length-mismatch.js";
+export { kidKeySwap } from "./kid-key-swap.js";
+export { jwksDecoyKeys } from "./jwks-decoy-keys.js";
+export { metadataMismatch } from "./metadata-mismatch.js";
+export { jwksKeyRotationRace } from "./jwks-key-rotation-race.js";
+export { mixedKeyTypeJwks } from "./mixed-key-type-jwks.js";
+export { jwksCachePoison } from "./jwks-cache-poison.js";
+export { jwksNoCache } from "./jwks-no-cache.js";
+export { jwksTransportAbuse } from "./jwks-transport-abuse.js";
+export { discoveryTampering } from "./discovery-tampering.js";
 
 // Resilience testing
 export { latencyInjectionPlugin } from "./latency-injection.js";
 export { massiveToken } from "./massive-token.js";
+export { oversizedToken } from "./oversized-token.js";
 export { errorInjection } from "./error-injection.js";
+export { tokenError } from "./token-error.js";
 export { partialSuccess } from "./partial-success.js";
+export { responseTiming } from "./response-timing.js";
+export { requestIdMismatch } from "./request-id-mismatch.js";
+export { slowResponse } from "./slow-response.js";
+export { contentTypeConfusion } from "./content-type-confusion.js";
 
 import type { MischiefPlugin } from "../types.js";
+import { algNonePartial } from "./alg-none-partial.js";
 import { algNonePlugin } from "./alg-none.js";
 import { atHashCHashMismatch } from "./at-hash-c-hash-mismatch.js";
+import { audConfusion } from "./aud-confusion.js";
+import { audTypeFlip } from "./aud-type-flip.js";
 import { audienceConfusionPlugin } from "./audience-confusion.js";
+import { audienceIgnoring } from "./audience-ignoring.js";
+import { authContextSpoof } from "./auth-context-spoof.js";
 import { azpConfusion } from "./azp-confusion.js";
+import { b64False } from "./b64-false.js";
+import { certBoundTokenMismatch } from "./cert-bound-token-mismatch.js";
+import { claimInjection } from "./claim-injection.js";
+import { claimSourceTamperingPlugin } from "./claim-source-tampering.js";
 import { claimTypeCoercion } from "./claim-type-coercion.js";
+import { clientAssertionBypass } from "./client-assertion-bypass.js";
+import { clockSkewProbe } from "./clock-skew-probe.js";
+import { consistentTamper } from "./consistent-tamper.js";
+import { contentTypeConfusion } from "./content-type-confusion.js";
 import { critHeaderBypass } from "./crit-header-bypass.js";
+import { criticalHeader } from "./critical-header.js";
+import { crossTenantIss } from "./cross-tenant-iss.js";
+import { crossTenantToken } from "./cross-tenant-token.js";
 import { curveConfusion } from "./curve-confusion.js";
+import { delegationEscalation } from "./delegation-escalation.js";
+import { disclosureTampering } from "./disclosure-tampering.js";
 import { discoveryConfusionPlugin } from "./discovery-confusion.js";
+import { discoveryTampering } from "./discovery-tampering.js";
+import { displayParamIgnored } from "./display-param-ignored.js";
+import { dpopBindingMismatch } from "./dpop-binding-mismatch.js";
+import { dpopNonceChallenge } from "./dpop-nonce-challenge.js";
+import { duplicateClaims } from "./duplicate-claims.js";
+import { ecKeyConfusion } from "./ec-key-confusion.js";
+import { embeddedJwk } from "./embedded-jwk.js";
 import { embeddedJwkAttack } from "./embedded-jwk-attack.js";
 import { errorInjection } from "./error-injection.js";
+import { essentialClaimOmission } from "./essential-claim-omission.js";
+import { expiresInMismatch } from "./expires-in-mismatch.js";
+import { hashTampering } from "./hash-tampering.js";
+import { headContentLengthMismatch } from "./head-content-length-mismatch.js";
+import { headerCase } from "./header-case.js";
+import { headerInjection } from "./header-injection.js";
+import { iatStale } from "./iat-stale.js";
+import { introspectionLies } from "./introspection-lies.js";
 import { issInResponseAttack } from "./iss-in-response-attack.js";
+import { issMismatch } from "./iss-mismatch.js";
+import { issSubCollision } from "./iss-sub-collision.js";
 import { issuerConfusionPlugin } from "./issuer-confusion.js";
 import { jkuInjection } from "./jku-injection.js";
 import { jsonParsingDifferentials } from "./json-parsing-differentials.js";
+import { jtiReuse } from "./jti-reuse.js";
+import { jweTampering } from "./jwe-tampering.js";
+import { jwksCachePoison } from "./jwks-cache-poison.js";
+import { jwksDecoyKeys } from "./jwks-decoy-keys.js";
 import { jwksDomainMismatch } from "./jwks-domain-mismatch.js";
 import { jwksInjectionPlugin } from "./jwks-injection.js";
+import { jwksKeyRotationRace } from "./jwks-key-rotation-race.js";
+import { jwksNoCache } from "./jwks-no-cache.js";
+import { jwksTransportAbuse } from "./jwks-transport-abuse.js";
 import { keyConfusionPlugin } from "./key-confusion.js";
+import { kidConfusion } from "./kid-confusion.js";
+import { kidKeySwap } from "./kid-key-swap.js";
 import { kidManipulationPlugin } from "./kid-manipulation.js";
 import { latencyInjectionPlugin } from "./latency-injection.js";
+import { malformedBase64 } from "./malformed-base64.js";
+import { malformedTimestamps } from "./malformed-timestamps.js";
 import { massiveJwks } from "./massive-jwks.js";
+import { maxAgeIgnored } from "./max-age-ignored.js";
 import { massiveMetadata } from "./massive-metadata.js";
 import { massiveToken } from "./massive-token.js";
+import { metadataMismatch } from "./metadata-mismatch.js";
+import { mixedKeyTypeJwks } from "./mixed-key-type-jwks.js";
+import { nbfFuture } from "./nbf-future.js";
 import { nonceBypassPlugin } from "./nonce-bypass.js";
+import { nonceMismatch } from "./nonce-mismatch.js";
+import { nonceOmission } from "./nonce-omission.js";
+import { noneWithSignature } from "./none-with-signature.js";
+import { oversizedToken } from "./oversized-token.js";
 import { partialSuccess } from "./partial-success.js";
 import { pkceDowngradePlugin } from "./pkce-downgrade.js";
+import { pkcePlainAccept } from "./pkce-plain-accept.js";
+import { publicClientSecretAccept } from "./public-client-secret-accept.js";
+import { rarOverGrant } from "./rar-over-grant.js";
+import { redirectUriValidationBypass } from "./redirect-uri-validation-bypass.js";
+import { refreshReuseDetectionOff } from "./refresh-reuse-detection-off.js";
+import { requestIdMismatch } from "./request-id-mismatch.js";
+import { requestObjectReplay } from "./request-object-replay.js";
+import { responseFieldInjection } from "./response-field-injection.js";
+import { responseModeDowngrade } from "./response-mode-downgrade.js";
 import { responseModeMismatch } from "./response-mode-mismatch.js";
+import { responseTiming } from "./response-timing.js";
 import { responseTypeConfusion } from "./response-type-confusion.js";
+import { revocationIgnored } from "./revocation-ignored.js";
+import { revocationListOmission } from "./revocation-list-omission.js";
+import { scopeEscalation } from "./scope-escalation.js";
 import { scopeInjectionPlugin } from "./scope-injection.js";
+import { segmentCount } from "./segment-count.js";
+import { signatureStripping } from "./signature-stripping.js";
+import { slowDownStorm } from "./slow-down-storm.js";
+import { slowResponse } from "./slow-response.js";
+import { splitValidity } from "./split-validity.js";
 import { stateBypassPlugin } from "./state-bypass.js";
+import { subOmission } from "./sub-omission.js";
+import { subOverlong } from "./sub-overlong.js";
+import { subTampering } from "./sub-tampering.js";
 import { subjectManipulationPlugin } from "./subject-manipulation.js";
+import { temporalFuture } from "./temporal-future.js";
 import { temporalTamperingPlugin } from "./temporal-tampering.js";
+import { tokenError } from "./token-error.js";
 import { tokenLifetimeAbuse } from "./token-lifetime-abuse.js";
 import { tokenTypeConfusionPlugin } from "./token-type-confusion.js";
+import { typConfusion } from "./typ-confusion.js";
 import { unicodeNormalization } from "./unicode-normalization.js";
+import { userinfoScopeViolation } from "./userinfo-scope-violation.js";
+import { userinfoTampering } from "./userinfo-tampering.js";
+import { verifiedFlags } from "./verified-flags.js";
 import { weakAlgorithms } from "./weak-algorithms.js";
+import { x5cInjection } from "./x5c-injection.js";
 import { x5uInjection } from "./x5u-injection.js";
 
 /**
- * All built-in plugins (36 total)
+ * All built-in plugins (118 total)
  */
 export const builtInPlugins: MischiefPlugin[] = [
 	// Critical severity - signature bypass
 	algNonePlugin,
+	algNonePartial,
+	noneWithSignature,
+	signatureStripping,
 	keyConfusionPlugin,
+	ecKeyConfusion,
 	weakAlgorithms,
 	jkuInjection,
 	x5uInjection,
+	x5cInjection,
 	embeddedJwkAttack,
+	embeddedJwk,
 	curveConfusion,
 	jwksDomainMismatch,
+	consistentTamper,
+	kidConfusion,
+	disclosureTampering,
 
 	// Critical severity - identity spoofing
 	issuerConfusionPlugin,
+	issMismatch,
+	crossTenantToken,
+	crossTenantIss,
 	audienceConfusionPlugin,
+	audConfusion,
 	subjectManipulationPlugin,
+	subTampering,
 	scopeInjectionPlugin,
+	scopeEscalation,
+	authContextSpoof,
 	issInResponseAttack,
+	userinfoTampering,
 
 	// Critical severity - discovery attacks
 	discoveryConfusionPlugin,
@@ -121,27 +302,92 @@ export const builtInPlugins: MischiefPlugin[] = [
 	// High severity - key/flow attacks
 	kidManipulationPlugin,
 	tokenTypeConfusionPlugin,
+	typConfusion,
 	temporalTamperingPlugin,
+	temporalFuture,
+	nbfFuture,
+	clockSkewProbe,
 	nonceBypassPlugin,
+	nonceOmission,
+	nonceMismatch,
 	stateBypassPlugin,
 	pkceDowngradePlugin,
 	critHeaderBypass,
+	criticalHeader,
+	headerCase,
+	headerInjection,
+	b64False,
 	azpConfusion,
 	atHashCHashMismatch,
+	hashTampering,
+	splitValidity,
 	tokenLifetimeAbuse,
 	responseTypeConfusion,
+	claimSourceTamperingPlugin,
+	verifiedFlags,
+	claimInjection,
+	duplicateClaims,
+	revocationListOmission,
+	revocationIgnored,
+	introspectionLies,
+	userinfoScopeViolation,
+	responseFieldInjection,
+	pkcePlainAccept,
+	requestObjectReplay,
+	redirectUriValidationBypass,
+	refreshReuseDetectionOff,
+	jtiReuse,
+	publicClientSecretAccept,
+	clientAssertionBypass,
+	kidKeySwap,
+	jwksDecoyKeys,
+	metadataMismatch,
+	jwksKeyRotationRace,
+	mixedKeyTypeJwks,
+	jwksCachePoison,
+	issSubCollision,
+	subOverlong,
+	subOmission,
+	rarOverGrant,
+	audienceIgnoring,
+	delegationEscalation,
+	maxAgeIgnored,
+	certBoundTokenMismatch,
+	dpopBindingMismatch,
+	jweTampering,
 
 	// Medium severity - resilience & parsing
 	latencyInjectionPlugin,
 	massiveToken,
+	oversizedToken,
 	massiveJwks,
 	massiveMetadata,
+	headContentLengthMismatch,
+	jwksNoCache,
+	jwksTransportAbuse,
+	discoveryTampering,
 	responseModeMismatch,
+	responseModeDowngrade,
+	displayParamIgnored,
+	essentialClaimOmission,
+	dpopNonceChallenge,
+	slowDownStorm,
 	claimTypeCoercion,
 	unicodeNormalization,
 	jsonParsingDifferentials,
+	malformedBase64,
+	segmentCount,
+	malformedTimestamps,
+	audTypeFlip,
+	iatStale,
+	expiresInMismatch,
 	errorInjection,
+	tokenError,
 	partialSuccess,
+	responseTiming,
+	requestIdMismatch,
+	slowResponse,
+	contentTypeConfusion,
 ];
 
 /**
@@ -152,15 +398,31 @@ export const attackProfiles: Record<string, string[]> = {
 	"critical-only": builtInPlugins.filter((p) => p.severity === "critical").map((p) => p.id),
 	"token-validation": [
 		"alg-none",
+		"alg-none-partial",
+		"none-with-signature",
+		"split-validity",
+		"signature-stripping",
 		"key-confusion",
+		"ec-key-confusion",
 		"weak-algorithms",
 		"jku-injection",
 		"x5u-injection",
+		"x5c-injection",
 		"embedded-jwk-attack",
+		"embedded-jwk",
 		"curve-confusion",
 		"kid-manipulation",
 		"token-type-confusion",
+		"typ-confusion",
 		"crit-header-bypass",
+		"critical-header",
+		"header-case",
+		"header-injection",
+		"b64-false",
+		"consistent-tamper",
+		"kid-confusion",
+		"jwe-tampering",
+		"disclosure-tampering",
 	],
 	"discovery-attacks": [
 		"discovery-confusion",
@@ -168,24 +430,73 @@ export const attackProfiles: Record<string, string[]> = {
 		"jwks-domain-mismatch",
 		"massive-jwks",
 		"massive-metadata",
+		"head-content-length-mismatch",
+		"kid-key-swap",
+		"jwks-decoy-keys",
+		"metadata-mismatch",
+		"jwks-key-rotation-race",
+		"mixed-key-type-jwks",
+		"jwks-cache-poison",
+		"jwks-no-cache",
+		"jwks-transport-abuse",
+		"discovery-tampering",
 	],
 	"flow-attacks": [
 		"nonce-bypass",
+		"nonce-omission",
+		"nonce-mismatch",
 		"state-bypass",
 		"pkce-downgrade",
 		"response-mode-mismatch",
 		"iss-in-response-attack",
 		"response-type-confusion",
+		"revocation-list-omission",
+		"userinfo-scope-violation",
+		"userinfo-tampering",
+		"display-param-ignored",
+		"response-field-injection",
+		"pkce-plain-accept",
+		"request-object-replay",
+		"refresh-reuse-detection-off",
+		"max-age-ignored",
+		"dpop-nonce-challenge",
+		"cert-bound-token-mismatch",
+		"public-client-secret-accept",
+		"client-assertion-bypass",
+		"slow-down-storm",
+		"introspection-lies",
+		"response-mode-downgrade",
+		"delegation-escalation",
+		"dpop-binding-mismatch",
+		"essential-claim-omission",
+		"jti-reuse",
+		"revocation-ignored",
+		"redirect-uri-validation-bypass",
 	],
 	resilience: [
 		"latency-injection",
 		"massive-token",
+		"oversized-token",
 		"massive-jwks",
 		"massive-metadata",
 		"error-injection",
+		"token-error",
 		"partial-success",
+		"response-timing",
+		"request-id-mismatch",
+		"slow-response",
+	],
+	"parsing-attacks": [
+		"claim-type-coercion",
+		"unicode-normalization",
+		"json-parsing-differentials",
+		"duplicate-claims",
+		"malformed-base64",
+		"segment-count",
+		"malformed-timestamps",
+		"aud-type-flip",
+		"content-type-confusion",
 	],
-	"parsing-attacks": ["claim-type-coercion", "unicode-normalization", "json-parsing-differentials"],
 };
 
 /**
@@ -0,0 +1,72 @@
+/**
+ * Introspection Lies
+ *
+ * Loki's introspection endpoint (/introspect) answers `active: true` for a
+ * token that isn't: one that expired, isn't valid yet, was revoked, or
+ * that Loki never issued at all. A gateway that trusts introspection
+ * without checking `exp` itself, or that introspects tokens it should have
+ * refused outright, lets them through.
+ *
+ * Config:
+ * - reasons: which inactive tokens to lie about (`unknown`, `expired`,
+ *   `not-yet-valid`, `revoked`); all of them by default
+ *
+ * Spec: RFC 7662 Section 2.2 - active MUST be false for expired, revoked or unknown tokens
+ * CWE-345: Insufficient Verification of Data Authenticity
+ */
+
+import type { InactiveReason } from "../../core/introspection.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const introspectionLies: MischiefPlugin = {
+	id: "introspection-lies",
+	name: "Introspection Lies",
+	severity: "high",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 7662 Section 2.2",
+		cwe: "CWE-345",
+		description: "Introspection MUST report expired, revoked and unknown tokens as inactive",
+	},
+
+	description: "Reports expired or never-issued tokens as active on introspection",
+
+	options: [
+		{
+			name: "reasons",
+			type: "array",
+			default: ["unknown", "expired", "not-yet-valid", "revoked"],
+			description: "The inactive tokens lied about: unknown, expired, not-yet-valid or revoked",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		const introspection = ctx.endpoint.introspection;
+		if (!introspection) {
+			return { applied: false, mutation: "No inactive token introspected", evidence: {} };
+		}
+		const reasons = ctx.config.reasons as InactiveReason[] | undefined;
+		if (reasons && !reasons.includes(introspection.reason)) {
+			return {
+				applied: false,
+				mutation: `Not lying about ${introspection.reason} tokens`,
+				evidence: { reason: introspection.reason },
+			};
+		}
+
+		ctx.endpoint.actions.reportActive = true;
+
+		return {
+			applied: true,
+			mutation: `Reported a ${introspection.reason} token as active`,
+			evidence: {
+				reason: introspection.reason,
+				tokenType: introspection.tokenType,
+			},
+		};
+	},
+};
@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const issInResponseAttack: MischiefPlugin = {
@@ -23,9 +24,7 @@ export const issInResponseAttack: MischiefPlugin = {
 			{ type: "subdomain", issuer: "https://issuer.attacker.com" },
 		];
 
-		const selectedAttack = attacks[
-			Math.floor(Math.random() * attacks.length)
-		] as (typeof attacks)[0];
+		const selectedAttack = attacks[randomInt(attacks.length)] as (typeof attacks)[0];
 		const originalIss = ctx.token.claims.iss;
 		ctx.token.claims.iss = selectedAttack.issuer;
 
@@ -0,0 +1,72 @@
+/**
+ * Issuer Mismatch
+ *
+ * Issues tokens whose `iss` names a different, real-looking identity
+ * provider (`issuer`, default https://accounts.google.com) while discovery
+ * and the JWKS keep advertising Loki. The token is re-signed with Loki's
+ * key, so a client that verifies the signature but never compares `iss`
+ * with the issuer it was configured for accepts a token claiming to come
+ * from someone else.
+ *
+ * Config:
+ * - issuer: the impersonated issuer (sessions may set it with `issTarget`)
+ *
+ * Spec: OIDC Core 1.0 Section 3.1.3.7 - iss MUST exactly match the configured issuer
+ * CWE-290: Authentication Bypass by Spoofing
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+/** Impersonated unless the session says otherwise */
+const IMPERSONATED_ISSUER = "https://accounts.google.com";
+
+export const issMismatch: MischiefPlugin = {
+	id: "iss-mismatch",
+	name: "Issuer Mismatch",
+	severity: "critical",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 4.1.1",
+		oidc: "OIDC Core 1.0 Section 3.1.3.7",
+		cwe: "CWE-290",
+		description: "The 'iss' claim MUST exactly match the issuer from discovery",
+	},
+
+	description: "Issues validly signed tokens whose iss names another identity provider",
+
+	options: [
+		{
+			name: "issuer",
+			type: "string",
+			default: IMPERSONATED_ISSUER,
+			description: "The impersonated issuer (session shorthand: issTarget)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const expectedIssuer = ctx.token.claims.iss;
+		const issuer = (ctx.config.issuer as string | undefined) ?? IMPERSONATED_ISSUER;
+		if (issuer === expectedIssuer) {
+			return { applied: false, mutation: "Issuer already matches", evidence: { issuer } };
+		}
+
+		ctx.token.claims.iss = issuer;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Set iss to '${issuer}'`,
+			evidence: {
+				expectedIssuer: expectedIssuer ?? null,
+				issuer,
+			},
+		};
+	},
+};
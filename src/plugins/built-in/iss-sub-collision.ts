@@ -0,0 +1,163 @@
+/**
+ * Issuer/Subject Collision
+ *
+ * OIDC identifies an end-user by the (iss, sub) pair: sub is only unique
+ * within its issuer. This plugin cycles a session's tokens through
+ * configured pairs so one subject shows up under different issuers (mode
+ * "cross-issuer", the default), or different users share one (iss, sub)
+ * (mode "shared-subject"). A relying party that keys accounts on sub alone
+ * merges identities from separate IdPs - cross-IdP account takeover.
+ *
+ * Tokens from one response (an id_token and access_token share their iat)
+ * get the same pair. Tokens are re-signed with Loki's key, so the collision
+ * is only meaningful to a client that trusts Loki's JWKS for every issuer
+ * it is shown; Loki itself serves a single issuer.
+ *
+ * Spec: OIDC Core 1.0 Section 5.7 - only iss and sub together are a stable identifier
+ * CWE-287: Improper Authentication
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type CollisionMode = "cross-issuer" | "shared-subject";
+
+interface IssSubPair {
+	iss?: string;
+	sub?: string;
+}
+
+interface SessionCycle {
+	index: number;
+	lastIat: unknown;
+	emitted: { iss: unknown; sub: unknown }[];
+}
+
+/** Distinct (iss, sub) combinations remembered per session */
+const MAX_EMITTED = 100;
+
+/** Where each session is in its pair cycle, until the session is deleted */
+const cycles = new Map<string, SessionCycle>();
+
+export const issSubCollision: MischiefPlugin = {
+	id: "iss-sub-collision",
+	name: "Issuer/Subject Collision",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 5.7",
+		cwe: "CWE-287",
+		description: "Accounts MUST be keyed on the (iss, sub) pair, never on sub alone",
+	},
+
+	description: "Reuses a sub across issuers, or one (iss, sub) across users",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["cross-issuer", "shared-subject"],
+			default: "cross-issuer",
+			description: "One subject under two issuers, or one (iss, sub) for every user",
+		},
+		{
+			name: "otherIssuer",
+			type: "string",
+			default: "https://other-idp.example",
+			description: "The second issuer in cross-issuer mode",
+		},
+		{
+			name: "subject",
+			type: "string",
+			default: "loki-shared-subject",
+			description: "The sub every token carries in shared-subject mode",
+		},
+		{
+			name: "pairs",
+			type: "array",
+			description: "The {iss, sub} pairs tokens cycle through, overriding mode",
+		},
+	],
+
+	forgetSession(sessionId) {
+		cycles.delete(sessionId);
+	},
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const { claims } = ctx.token;
+		const pairs = configuredPairs(ctx.config);
+		if (!pairs) {
+			return { applied: false, mutation: `Unknown mode: ${ctx.config.mode}`, evidence: {} };
+		}
+		if (pairs.length === 0) {
+			return { applied: false, mutation: "No (iss, sub) pairs configured", evidence: {} };
+		}
+
+		// Advance once per response: tokens issued together share their iat
+		let cycle = cycles.get(ctx.session.id);
+		if (!cycle) {
+			cycle = { index: 0, lastIat: claims.iat, emitted: [] };
+			cycles.set(ctx.session.id, cycle);
+		} else if (claims.iat === undefined || claims.iat !== cycle.lastIat) {
+			cycle.index = (cycle.index + 1) % pairs.length;
+			cycle.lastIat = claims.iat;
+		}
+		const index = cycle.index % pairs.length;
+		const pair = pairs[index] as IssSubPair;
+
+		const originalIss = claims.iss;
+		const originalSub = claims.sub;
+		if (pair.iss !== undefined) {
+			claims.iss = pair.iss;
+		}
+		if (pair.sub !== undefined) {
+			claims.sub = pair.sub;
+		}
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		const seen = cycle.emitted.some((e) => e.iss === claims.iss && e.sub === claims.sub);
+		if (!seen && cycle.emitted.length < MAX_EMITTED) {
+			cycle.emitted.push({ iss: claims.iss, sub: claims.sub });
+		}
+
+		return {
+			applied: true,
+			mutation: `Issued (${claims.iss}, ${claims.sub}) as pair ${index + 1} of ${pairs.length}`,
+			evidence: {
+				pairIndex: index,
+				iss: claims.iss,
+				sub: claims.sub,
+				originalIss,
+				originalSub,
+				emitted: [...cycle.emitted],
+			},
+		};
+	},
+};
+
+/**
+ * The pairs to cycle through: `pairs` if configured, otherwise the mode's default
+ * (undefined for an unknown mode). A pair field left out keeps the original value.
+ */
+function configuredPairs(config: Record<string, unknown>): IssSubPair[] | undefined {
+	if (Array.isArray(config.pairs)) {
+		return config.pairs as IssSubPair[];
+	}
+	const mode = (config.mode as CollisionMode | undefined) ?? "cross-issuer";
+	switch (mode) {
+		case "cross-issuer": {
+			const otherIssuer = (config.otherIssuer as string | undefined) ?? "https://other-idp.example";
+			return [{}, { iss: otherIssuer }];
+		}
+		case "shared-subject":
+			return [{ sub: (config.subject as string | undefined) ?? "loki-shared-subject" }];
+		default:
+			return undefined;
+	}
+}
@@ -36,6 +36,22 @@ export const issuerConfusionPlugin: MischiefPlugin = {
 
 	description: "Spoofs the issuer claim to test iss validation",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["evil", "similar", "empty", "null"],
+			default: "evil",
+			description: "How the iss claim is changed",
+		},
+		{
+			name: "evilIssuer",
+			type: "string",
+			default: "https://evil-idp.attacker.com",
+			description: "The issuer set in evil mode",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
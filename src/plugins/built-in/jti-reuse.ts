@@ -0,0 +1,97 @@
+/**
+ * JTI Reuse
+ *
+ * Every token Loki issues normally carries its own `jti`. This plugin
+ * gives all of a session's tokens the same one: the first token keeps its
+ * `jti` and every later token is issued with it too, re-signed with Loki's
+ * key. A resource server that enforces one-time use, or keeps a replay
+ * cache, should reject the second token presented; one that doesn't
+ * accepts what looks exactly like a replayed token. Tokens without a `jti`
+ * (oidc-provider's ID tokens) are left alone.
+ *
+ * Config:
+ * - jti: the `jti` every token carries (default: the session's first token's)
+ *
+ * Spec: RFC 7519 Section 4.1.7 - the jti MUST be unique, and can be used to
+ * prevent the JWT from being replayed
+ * CWE-294: Authentication Bypass by Capture-replay
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+/** The jti each session's tokens share, until the session is deleted */
+const sharedJtis = new Map<string, string>();
+
+export const jtiReuse: MischiefPlugin = {
+	id: "jti-reuse",
+	name: "JTI Reuse",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 4.1.7",
+		cwe: "CWE-294",
+		description: "A jti MUST identify one token; replayed jtis MUST be rejected",
+	},
+
+	description: "Issues a session's tokens with the same jti, validly signed",
+
+	options: [
+		{
+			name: "jti",
+			type: "string",
+			description: "The jti every token carries (default: the session's first token's)",
+		},
+	],
+
+	forgetSession(sessionId) {
+		sharedJtis.delete(sessionId);
+	},
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		const { claims } = ctx.token;
+		if (typeof claims.jti !== "string") {
+			return { applied: false, mutation: "Token carries no jti", evidence: {} };
+		}
+
+		const configured = ctx.config.jti;
+		if (configured !== undefined && (typeof configured !== "string" || configured === "")) {
+			return {
+				applied: false,
+				mutation: "jti must be a non-empty string",
+				evidence: { jti: configured },
+			};
+		}
+		const shared = configured ?? sharedJtis.get(ctx.session.id);
+		if (shared === undefined) {
+			sharedJtis.set(ctx.session.id, claims.jti);
+			return {
+				applied: false,
+				mutation: `First token: later ones will reuse jti ${claims.jti}`,
+				evidence: { jti: claims.jti },
+			};
+		}
+
+		const originalJti = claims.jti;
+		if (originalJti === shared) {
+			return {
+				applied: false,
+				mutation: "The token already carries the shared jti",
+				evidence: { jti: shared },
+			};
+		}
+		claims.jti = shared;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Reused jti ${shared} in place of ${originalJti}`,
+			evidence: { jti: shared, originalJti },
+		};
+	},
+};
@@ -0,0 +1,130 @@
+/**
+ * JWE Tampering
+ *
+ * Tampers with the encrypted ID token sent to a client that registered an
+ * encryption key (`idTokenEncryption` at /admin/clients). The nested JWS is
+ * validly signed throughout; what changes is the JWE around it. A client
+ * must reject a JWE whose authentication tag doesn't verify, and one
+ * encrypted with an alg or enc other than those it registered, rather than
+ * falling back to whatever the header names.
+ *
+ * Modes:
+ * - tag: Flips a bit of the authentication tag
+ * - ciphertext: Flips a bit of the ciphertext, leaving the tag as it was
+ * - enc: Encrypts again with a content encryption the client didn't register
+ * - alg: Encrypts again with a key management alg the client didn't register
+ *
+ * Only token responses whose ID token is encrypted are affected.
+ *
+ * Spec: RFC 7516 Section 5.2 - Message Decryption
+ * OIDC: OpenID Connect Core 1.0 Section 10.2 - Encryption
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type JweTamperingMode = "tag" | "ciphertext" | "enc" | "alg";
+
+/** The JWE part each bit-flipping mode corrupts */
+const PARTS: Record<string, number> = { ciphertext: 3, tag: 4 };
+
+/** An unregistered alternative to each supported alg and enc */
+const OTHER_ALG: Record<string, string> = {
+	"RSA-OAEP": "RSA-OAEP-256",
+	"RSA-OAEP-256": "RSA-OAEP",
+	"ECDH-ES": "ECDH-ES+A256KW",
+	"ECDH-ES+A256KW": "ECDH-ES",
+};
+const OTHER_ENC: Record<string, string> = {
+	A128GCM: "A256GCM",
+	A192GCM: "A256GCM",
+	A256GCM: "A128CBC-HS256",
+	"A128CBC-HS256": "A256GCM",
+	"A256CBC-HS512": "A256GCM",
+};
+
+export const jweTampering: MischiefPlugin = {
+	id: "jwe-tampering",
+	name: "JWE Tampering",
+	severity: "high",
+	phase: "response",
+
+	spec: {
+		rfc: "RFC 7516 Section 5.2",
+		oidc: "OIDC Core 1.0 Section 10.2",
+		cwe: "CWE-347",
+		description:
+			"Clients must reject a JWE whose tag fails or whose alg/enc isn't the one they registered",
+	},
+
+	description: "Corrupts the encrypted ID token's auth tag or re-encrypts it with another alg/enc",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["tag", "ciphertext", "enc", "alg"],
+			default: "tag",
+			description: "Which part of the JWE is tampered with",
+		},
+	],
+
+	async apply(ctx) {
+		const encryption = ctx.response?.idTokenEncryption;
+		const body = ctx.response?.body as Record<string, unknown> | undefined;
+		const jwe = body?.id_token;
+		if (!ctx.response || !encryption || !body || typeof jwe !== "string") {
+			return { applied: false, mutation: "No encrypted ID token", evidence: {} };
+		}
+
+		const mode = (ctx.config.mode as JweTamperingMode | undefined) ?? "tag";
+		let tampered: string;
+		let mutation: string;
+		const evidence: Record<string, unknown> = {
+			mode,
+			registeredAlg: encryption.alg,
+			registeredEnc: encryption.enc,
+		};
+
+		switch (mode) {
+			case "enc": {
+				const enc = OTHER_ENC[encryption.enc] ?? "A256GCM";
+				tampered = await encryption.encrypt(encryption.alg, enc);
+				mutation = `Encrypted the ID token with enc ${enc} instead of ${encryption.enc}`;
+				evidence.enc = enc;
+				break;
+			}
+
+			case "alg": {
+				const alg = OTHER_ALG[encryption.alg] ?? encryption.alg;
+				tampered = await encryption.encrypt(alg, encryption.enc);
+				mutation = `Encrypted the ID token with alg ${alg} instead of ${encryption.alg}`;
+				evidence.alg = alg;
+				break;
+			}
+
+			default: {
+				const part = PARTS[mode] ?? 4;
+				tampered = flipBit(jwe, part);
+				mutation = `Flipped a bit of the ID token's ${part === 4 ? "authentication tag" : mode}`;
+				break;
+			}
+		}
+
+		ctx.response.body = { ...body, id_token: tampered };
+		return { applied: true, mutation, evidence };
+	},
+};
+
+/**
+ * Flip the low bit of the first byte of a compact JWE's part
+ */
+function flipBit(jwe: string, part: number): string {
+	const parts = jwe.split(".");
+	const bytes = Buffer.from(parts[part] ?? "", "base64url");
+	if (bytes.length > 0) {
+		bytes[0] = (bytes[0] ?? 0) ^ 0x01;
+	}
+	parts[part] = bytes.toString("base64url");
+	return parts.join(".");
+}
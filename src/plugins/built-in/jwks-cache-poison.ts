@@ -0,0 +1,117 @@
+/**
+ * JWKS Cache Poison
+ *
+ * Serves the session's JWKS with an absurdly long `max-age` and then
+ * rotates keys under it: every token is signed with a brand-new key,
+ * published in the session's JWKS from then on. A client that caches the
+ * JWKS for as long as it was told to, and doesn't refetch when it meets an
+ * unknown kid, fails to validate every token after its first fetch. One
+ * that treats an unknown kid as a reason to refetch (rate-limited) keeps
+ * working. JWKS fetches made before the session's first token are served
+ * with the provider's own caching headers.
+ *
+ * Config:
+ * - maxAge: the max-age advertised, in seconds (default one year); sessions
+ *   may set it with `jwksMaxAge`
+ *
+ * Spec: OIDC Core 1.0 Section 10.1.1 - Rotation of Asymmetric Signing Keys;
+ * RFC 9111 Section 5.2.2.1 - max-age
+ * CWE-672: Operation on a Resource after Expiration or Release
+ */
+
+import * as jose from "jose";
+import {
+	SUPPORTED_SIGNING_ALGORITHMS,
+	type SigningAlgorithm,
+	generateSigningKey,
+} from "../../core/key-manager.js";
+import type { TransientKeyWindow } from "../../core/transient-keys.js";
+import type { MischiefPlugin, TokenContext } from "../types.js";
+
+/** max-age advertised by default: one year */
+const DEFAULT_MAX_AGE = 31_536_000;
+
+export const jwksCachePoison: MischiefPlugin = {
+	id: "jwks-cache-poison",
+	name: "JWKS Cache Poison",
+	severity: "high",
+	phase: "token-signing",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 10.1.1",
+		rfc: "RFC 9111 Section 5.2.2.1",
+		cwe: "CWE-672",
+		description: "Clients should refetch the JWKS for an unknown kid, however long it was cached",
+	},
+
+	description: "Serves the JWKS with a year-long max-age, then signs every token with a new key",
+
+	options: [
+		{
+			name: "maxAge",
+			type: "integer",
+			default: DEFAULT_MAX_AGE,
+			description: "The JWKS max-age advertised, in seconds (session shorthand: jwksMaxAge)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const maxAge = ctx.config.maxAge ?? DEFAULT_MAX_AGE;
+		if (typeof maxAge !== "number" || !Number.isInteger(maxAge) || maxAge <= 0) {
+			return {
+				applied: false,
+				mutation: "maxAge must be a positive integer",
+				evidence: { maxAge },
+			};
+		}
+
+		const cacheControl = `public, max-age=${maxAge}, immutable`;
+		const rotated = await signWithRotatedKey(ctx.token, { seconds: maxAge }, cacheControl);
+		if (typeof rotated === "string") {
+			return { applied: false, mutation: rotated, evidence: {} };
+		}
+
+		return {
+			applied: true,
+			mutation: `Signed with rotated key ${rotated.kid}; JWKS cached for ${maxAge}s`,
+			evidence: {
+				rotatedKid: rotated.kid,
+				originalKid: rotated.originalKid,
+				cacheControl,
+				vulnerability: "Client may trust its cached JWKS over an unknown kid",
+			},
+		};
+	},
+};
+
+/**
+ * Sign the token with a new key of its algorithm, published in the
+ * session's JWKS for a window, and serve that JWKS with a Cache-Control.
+ * Returns why not when the token can't be re-signed that way
+ */
+export async function signWithRotatedKey(
+	token: TokenContext,
+	window: TransientKeyWindow,
+	cacheControl: string,
+): Promise<{ kid: string; originalKid: string | undefined } | string> {
+	const alg = token.header.alg;
+	if (!SUPPORTED_SIGNING_ALGORITHMS.includes(alg as SigningAlgorithm)) {
+		return `Not an asymmetric signature: ${alg}`;
+	}
+	const transientKeys = token.transientKeys;
+	if (!transientKeys) {
+		return "No JWKS to publish a rotated key in";
+	}
+
+	const key = await generateSigningKey(alg as SigningAlgorithm);
+	const originalKid = token.header.kid;
+	token.header.kid = key.kid;
+	await token.sign(alg, await jose.exportPKCS8(key.privateKey));
+	transientKeys.publish(key.publicJwk, window);
+	transientKeys.cacheControl(cacheControl);
+	return { kid: key.kid, originalKid };
+}
@@ -0,0 +1,106 @@
+/**
+ * JWKS Decoy Keys
+ *
+ * Serves different keys to authenticated and unauthenticated JWKS fetches,
+ * modeling an IdP that gates its JWKS (`provider.jwksBearerToken`) but
+ * answers unauthenticated fetches with a decoy key set instead of 401.
+ * Decoys have the same key types as the real keys but different key
+ * material, so tokens never verify against them. A client that gates its
+ * own JWKS fetch must keep authenticating: one that falls back to an
+ * unauthenticated fetch (or caches keys from one) holds the wrong keys.
+ * Config:
+ * - serveTo: which fetches get the decoys, "unauthenticated" (default) or
+ *   "authenticated"
+ * - keepKids: decoys carry the real keys' kids (default true); false gives
+ *   each decoy its thumbprint as kid
+ *
+ * Fetches that get decoys (and every fetch of a gated JWKS) are recorded
+ * as `jwks-served` session events with the key set served.
+ *
+ * Spec: RFC 7517 Section 5 - JWK Set
+ * CWE-345: Insufficient Verification of Data Authenticity
+ */
+
+import * as jose from "jose";
+import type { MischiefPlugin } from "../types.js";
+import type { JWK, JWKS } from "./jwks-injection.js";
+import { alternateFor } from "./kid-key-swap.js";
+
+export const jwksDecoyKeys: MischiefPlugin = {
+	id: "jwks-decoy-keys",
+	name: "JWKS Decoy Keys",
+	severity: "high",
+	phase: "discovery",
+
+	spec: {
+		rfc: "RFC 7517 Section 5",
+		cwe: "CWE-345",
+		description: "Every JWKS fetch must get the issuer's real keys, or be refused",
+	},
+
+	description: "Serves decoy keys to unauthenticated (or authenticated) JWKS fetches",
+
+	options: [
+		{
+			name: "serveTo",
+			type: "string",
+			values: ["unauthenticated", "authenticated"],
+			default: "unauthenticated",
+			description: "Which JWKS fetches are served the decoy keys",
+		},
+		{
+			name: "keepKids",
+			type: "boolean",
+			default: true,
+			description: "Give decoys the real keys' kids; false uses each decoy's thumbprint",
+		},
+	],
+
+	async apply(ctx) {
+		const fetch = ctx.response?.jwksFetch;
+		const jwks = ctx.response?.body as JWKS | undefined;
+		if (!ctx.response || !fetch || !Array.isArray(jwks?.keys)) {
+			return { applied: false, mutation: "Not a JWKS fetch", evidence: {} };
+		}
+
+		const serveTo = (ctx.config.serveTo as string | undefined) ?? "unauthenticated";
+		const keepKids = (ctx.config.keepKids as boolean | undefined) ?? true;
+		if (serveTo !== "unauthenticated" && serveTo !== "authenticated") {
+			return { applied: false, mutation: `Unknown serveTo: ${serveTo}`, evidence: { serveTo } };
+		}
+		if (fetch.authenticated !== (serveTo === "authenticated")) {
+			const fetcher = fetch.authenticated ? "authenticated" : "unauthenticated";
+			return {
+				applied: false,
+				mutation: `Real keys for an ${fetcher} fetch`,
+				evidence: { authenticated: fetch.authenticated },
+			};
+		}
+
+		const decoys: JWK[] = [];
+		const keys: Record<string, unknown>[] = [];
+		for (const key of jwks.keys) {
+			const decoy = { ...(await alternateFor(key)) };
+			const thumbprint = await jose.calculateJwkThumbprint(decoy as jose.JWK);
+			if (!keepKids) {
+				decoy.kid = thumbprint;
+			}
+			decoys.push(decoy);
+			keys.push({ realKid: key.kid ?? null, decoyKid: decoy.kid ?? null, thumbprint });
+		}
+
+		ctx.response.body = { ...jwks, keys: decoys };
+		fetch.keySet = "decoy";
+
+		return {
+			applied: true,
+			mutation: `Served ${decoys.length} decoy key(s) to an ${serveTo} JWKS fetch`,
+			evidence: {
+				authenticated: fetch.authenticated,
+				authRequired: fetch.authRequired,
+				keySet: "decoy",
+				keys,
+			},
+		};
+	},
+};
@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const jwksDomainMismatch: MischiefPlugin = {
@@ -24,8 +25,7 @@ export const jwksDomainMismatch: MischiefPlugin = {
 			"https://idp.legitimate.com.attacker.com/jwks",
 		];
 
-		const selectedDomain =
-			attackerDomains[Math.floor(Math.random() * attackerDomains.length)] ?? attackerDomains[0];
+		const selectedDomain = attackerDomains[randomInt(attackerDomains.length)] ?? attackerDomains[0];
 
 		ctx.token.header.jku = selectedDomain;
 
@@ -63,6 +63,28 @@ export const jwksInjectionPlugin: MischiefPlugin = {
 
 	description: "Manipulates JWKS response to test key validation",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["inject-key", "empty", "malformed", "wrong-use", "weak-key"],
+			default: "inject-key",
+			description: "How the JWKS is manipulated",
+		},
+		{
+			name: "attackerKey",
+			type: "object",
+			description: "The public JWK injected in inject-key mode (default: a fixed attacker key)",
+		},
+		{
+			name: "malformedType",
+			type: "string",
+			values: ["missing-kty", "invalid-kty", "missing-n"],
+			default: "missing-kty",
+			description: "How the first key is broken in malformed mode",
+		},
+	],
+
 	async apply(ctx) {
 		// JWKS plugins receive the JWKS in response.body
 		if (!ctx.response?.body) {
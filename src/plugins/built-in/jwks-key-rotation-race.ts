@@ -0,0 +1,130 @@
+/**
+ * JWKS Key Rotation Race
+ *
+ * Signs the token with a brand-new key that Loki publishes in the
+ * session's JWKS for a short window only: by default a single JWKS fetch,
+ * then the key is gone. This is the tail of a key rotation raced against
+ * the client's key cache. A client that refetches the JWKS as soon as it
+ * meets the unknown kid finds the key and validates the token; one that
+ * refetches late, or after an earlier fetch already used up the window,
+ * finds no key with that kid and must reject the token rather than fall
+ * back to another key.
+ *
+ * The session's attack report lists when each transient key was added to
+ * and removed from the JWKS.
+ *
+ * Config:
+ * - fetches: JWKS responses the key appears in (default 1)
+ * - seconds: seconds the key stays published; with fetches, whichever
+ *   comes first removes it (sessions may set both with `jwksRaceWindow`)
+ *
+ * Spec: OIDC Core 1.0 Section 10.1.1 - Rotation of Asymmetric Signing Keys
+ * CWE-324: Use of a Key Past its Expiration Date
+ */
+
+import * as jose from "jose";
+import {
+	SUPPORTED_SIGNING_ALGORITHMS,
+	type SigningAlgorithm,
+	generateSigningKey,
+} from "../../core/key-manager.js";
+import type { TransientKeyWindow } from "../../core/transient-keys.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const jwksKeyRotationRace: MischiefPlugin = {
+	id: "jwks-key-rotation-race",
+	name: "JWKS Key Rotation Race",
+	severity: "high",
+	phase: "token-signing",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 10.1.1",
+		cwe: "CWE-324",
+		description: "Clients should refetch the JWKS for an unknown kid, and reject once it's gone",
+	},
+
+	description: "Signs with a new key served in the JWKS for a single fetch, then removed",
+
+	options: [
+		{
+			name: "fetches",
+			type: "integer",
+			description: "JWKS responses the key appears in (1 unless seconds is set)",
+		},
+		{
+			name: "seconds",
+			type: "number",
+			description: "Seconds the key stays published; with fetches, whichever ends first",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const alg = ctx.token.header.alg;
+		if (!SUPPORTED_SIGNING_ALGORITHMS.includes(alg as SigningAlgorithm)) {
+			return { applied: false, mutation: `Not an asymmetric signature: ${alg}`, evidence: {} };
+		}
+
+		const transientKeys = ctx.token.transientKeys;
+		if (!transientKeys) {
+			return { applied: false, mutation: "No JWKS to publish a transient key in", evidence: {} };
+		}
+
+		const window: TransientKeyWindow = {};
+		const fetches = ctx.config.fetches as number | undefined;
+		const seconds = ctx.config.seconds as number | undefined;
+		if (
+			(fetches !== undefined && !(Number.isInteger(fetches) && fetches > 0)) ||
+			(seconds !== undefined && !(seconds > 0))
+		) {
+			return {
+				applied: false,
+				mutation: "fetches must be a positive integer and seconds positive",
+				evidence: { fetches, seconds },
+			};
+		}
+		if (fetches !== undefined) {
+			window.fetches = fetches;
+		}
+		if (seconds !== undefined) {
+			window.seconds = seconds;
+		}
+		if (fetches === undefined && seconds === undefined) {
+			window.fetches = 1;
+		}
+
+		const key = await generateSigningKey(alg as SigningAlgorithm);
+		const originalKid = ctx.token.header.kid;
+		ctx.token.header.kid = key.kid;
+		await ctx.token.sign(alg, await jose.exportPKCS8(key.privateKey));
+		transientKeys.publish(key.publicJwk, window);
+
+		return {
+			applied: true,
+			mutation: `Signed with transient key ${key.kid}, published for ${describeWindow(window)}`,
+			evidence: {
+				transientKid: key.kid,
+				originalKid,
+				window,
+				vulnerability: "Client may cache the JWKS past the key's window or trust a stale key",
+			},
+		};
+	},
+};
+
+/**
+ * "2 JWKS fetches or 30s"
+ */
+function describeWindow(window: TransientKeyWindow): string {
+	const limits: string[] = [];
+	if (window.fetches !== undefined) {
+		limits.push(`${window.fetches} JWKS fetch${window.fetches === 1 ? "" : "es"}`);
+	}
+	if (window.seconds !== undefined) {
+		limits.push(`${window.seconds}s`);
+	}
+	return limits.join(" or ");
+}
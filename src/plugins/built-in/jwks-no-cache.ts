@@ -0,0 +1,80 @@
+/**
+ * JWKS No Cache
+ *
+ * The counterpart of jwks-cache-poison: serves the session's JWKS with
+ * `Cache-Control: no-store` and signs every token with a brand-new key,
+ * published in the JWKS for a short window. The server has said not to
+ * keep its keys, so a client that validates against a JWKS it fetched
+ * earlier anyway, instead of refetching, meets an unknown kid on every
+ * token and must fail rather than fall back to a cached key. JWKS fetches
+ * made before the session's first token are served with the provider's
+ * own caching headers.
+ *
+ * Config:
+ * - seconds: seconds each key stays published (default 300)
+ *
+ * Spec: RFC 9111 Section 5.2.2.5 - no-store; OIDC Core 1.0 Section 10.1.1
+ * CWE-672: Operation on a Resource after Expiration or Release
+ */
+
+import type { MischiefPlugin } from "../types.js";
+import { signWithRotatedKey } from "./jwks-cache-poison.js";
+
+const CACHE_CONTROL = "no-store";
+
+export const jwksNoCache: MischiefPlugin = {
+	id: "jwks-no-cache",
+	name: "JWKS No Cache",
+	severity: "medium",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 9111 Section 5.2.2.5",
+		oidc: "OIDC Core 1.0 Section 10.1.1",
+		cwe: "CWE-672",
+		description: "Clients must refetch a JWKS served with no-store, not reuse an old copy",
+	},
+
+	description: "Serves the JWKS with no-store and signs every token with a new key",
+
+	options: [
+		{
+			name: "seconds",
+			type: "number",
+			default: 300,
+			description: "Seconds each key stays published",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const seconds = ctx.config.seconds ?? 300;
+		if (typeof seconds !== "number" || !(seconds > 0)) {
+			return {
+				applied: false,
+				mutation: "seconds must be positive",
+				evidence: { seconds },
+			};
+		}
+
+		const rotated = await signWithRotatedKey(ctx.token, { seconds }, CACHE_CONTROL);
+		if (typeof rotated === "string") {
+			return { applied: false, mutation: rotated, evidence: {} };
+		}
+
+		return {
+			applied: true,
+			mutation: `Signed with rotated key ${rotated.kid}; JWKS served with ${CACHE_CONTROL}`,
+			evidence: {
+				rotatedKid: rotated.kid,
+				originalKid: rotated.originalKid,
+				cacheControl: CACHE_CONTROL,
+				window: { seconds },
+				vulnerability: "Client may validate against a JWKS it was told not to store",
+			},
+		};
+	},
+};
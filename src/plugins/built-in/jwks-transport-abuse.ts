@@ -0,0 +1,131 @@
+/**
+ * JWKS Transport Abuse
+ *
+ * Serves the JWKS with unusual but valid transport characteristics: gzip
+ * content-encoding, chunked transfer encoding (no Content-Length), or
+ * both, and optionally padded with filler keys up to a large key count.
+ * Every variation is legal HTTP and a legal JWK Set, so a client must
+ * decode it, and should bound how many keys it parses rather than
+ * buffering whatever it is sent. Clients with hand-rolled HTTP handling
+ * tend to read a gzip body as JSON, or wait on a Content-Length that
+ * never comes.
+ *
+ * Config:
+ * - encoding: "gzip" (default), "chunked", "gzip-chunked" or "identity"
+ * - keyCount: pad the JWKS with filler keys until it holds this many (at
+ *   most 10000; default: no padding)
+ *
+ * Filler keys are RSA-shaped with random moduli and their own kids, and
+ * come before the real keys, so a client that stops parsing early never
+ * reaches the key tokens are signed with. A fetch whose Accept-Encoding
+ * refuses gzip still gets the JWKS unencoded.
+ *
+ * Spec: RFC 9110 Section 8.4 - Content-Encoding; RFC 9112 Section 7.1 -
+ * chunked transfer coding; RFC 7517 Section 5 - JWK Set
+ * CWE-400: Uncontrolled Resource Consumption
+ */
+
+import type { JwksEncoding } from "../../core/jwks-auth.js";
+import { randomBytes } from "../../core/random.js";
+import type { MischiefPlugin } from "../types.js";
+import type { JWK, JWKS } from "./jwks-injection.js";
+
+const ENCODINGS: JwksEncoding[] = ["gzip", "chunked", "gzip-chunked", "identity"];
+
+/** Most keys a JWKS is padded to, bounding the response Loki builds */
+const MAX_KEY_COUNT = 10_000;
+
+export const jwksTransportAbuse: MischiefPlugin = {
+	id: "jwks-transport-abuse",
+	name: "JWKS Transport Abuse",
+	severity: "medium",
+	phase: "discovery",
+
+	spec: {
+		rfc: "RFC 9110 Section 8.4, RFC 9112 Section 7.1",
+		cwe: "CWE-400",
+		description: "JWKS clients must handle any valid HTTP framing and bound the keys they parse",
+	},
+
+	description: "Serves the JWKS gzip-encoded, chunked, or padded with many filler keys",
+
+	options: [
+		{
+			name: "encoding",
+			type: "string",
+			values: ENCODINGS,
+			default: "gzip",
+			description: "How the JWKS response is framed",
+		},
+		{
+			name: "keyCount",
+			type: "integer",
+			description: `Pad the JWKS with filler keys up to this many (at most ${MAX_KEY_COUNT})`,
+		},
+	],
+
+	async apply(ctx) {
+		const fetch = ctx.response?.jwksFetch;
+		const jwks = ctx.response?.body as JWKS | undefined;
+		if (!ctx.response || !fetch || !Array.isArray(jwks?.keys)) {
+			return { applied: false, mutation: "Not a JWKS fetch", evidence: {} };
+		}
+
+		const encoding = (ctx.config.encoding as JwksEncoding | undefined) ?? "gzip";
+		if (!ENCODINGS.includes(encoding)) {
+			return {
+				applied: false,
+				mutation: `encoding must be one of ${ENCODINGS.join(", ")}`,
+				evidence: { encoding },
+			};
+		}
+		const keyCount = ctx.config.keyCount as number | undefined;
+		if (
+			keyCount !== undefined &&
+			!(Number.isInteger(keyCount) && keyCount >= 1 && keyCount <= MAX_KEY_COUNT)
+		) {
+			return {
+				applied: false,
+				mutation: `keyCount must be an integer from 1 to ${MAX_KEY_COUNT}`,
+				evidence: { keyCount },
+			};
+		}
+
+		const realKeys = jwks.keys.length;
+		const fillerKeys = Math.max(0, (keyCount ?? 0) - realKeys);
+		if (encoding === "identity" && fillerKeys === 0) {
+			return {
+				applied: false,
+				mutation: "JWKS served as is",
+				evidence: { encoding, realKeys },
+			};
+		}
+
+		if (fillerKeys > 0) {
+			const filler = Array.from({ length: fillerKeys }, (_, i) => fillerKey(i));
+			ctx.response.body = { ...jwks, keys: [...filler, ...jwks.keys] };
+		}
+		fetch.encoding = encoding;
+
+		const padded = fillerKeys > 0 ? ` with ${realKeys + fillerKeys} keys` : "";
+		return {
+			applied: true,
+			mutation: `Served the JWKS ${encoding}${padded}`,
+			evidence: { encoding, realKeys, fillerKeys, keyCount: realKeys + fillerKeys },
+		};
+	},
+};
+
+/**
+ * A well-formed RSA public key nobody holds the private half of
+ */
+function fillerKey(index: number): JWK {
+	return {
+		kty: "RSA",
+		use: "sig",
+		alg: "RS256",
+		kid: `filler-${index + 1}`,
+		n: randomBytes(256).toString("base64url"),
+		e: "AQAB",
+	};
+}
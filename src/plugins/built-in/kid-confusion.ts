@@ -0,0 +1,64 @@
+/**
+ * Kid Confusion
+ *
+ * Keeps the `kid` header naming Loki's real signing key, which the JWKS
+ * still advertises, but signs the token with a throwaway attacker key the
+ * JWKS never publishes. The claims are untouched. A client that looks the
+ * key up by kid finds a genuine key and must reject the signature; one that
+ * trusts the kid alone, or falls back to another key when verification
+ * fails, accepts the forgery.
+ *
+ * Claims plugins run first, so the throwaway signature covers whatever
+ * they changed (e.g. temporal-tampering's timestamps).
+ *
+ * Spec: RFC 7515 Section 4.1.4 - kid is a hint; the signature must verify with the key it names
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import { attackerKey } from "../../core/attacker-keys.js";
+import { SUPPORTED_SIGNING_ALGORITHMS, type SigningAlgorithm } from "../../core/key-manager.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const kidConfusion: MischiefPlugin = {
+	id: "kid-confusion",
+	name: "Kid Confusion",
+	severity: "critical",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 7515 Section 4.1.4",
+		cwe: "CWE-347",
+		description: "The signature must verify with the key the kid header names",
+	},
+
+	description: "Keeps a published key's kid but signs with an unpublished throwaway key",
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const alg = ctx.token.header.alg;
+		if (!SUPPORTED_SIGNING_ALGORITHMS.includes(alg as SigningAlgorithm)) {
+			return { applied: false, mutation: `Not an asymmetric signature: ${alg}`, evidence: {} };
+		}
+
+		const kid = ctx.token.header.kid;
+		if (kid === undefined) {
+			return { applied: false, mutation: "No kid header to keep", evidence: {} };
+		}
+
+		const attacker = await attackerKey(alg as SigningAlgorithm);
+		await ctx.token.sign(alg, attacker.pem);
+
+		return {
+			applied: true,
+			mutation: `Signed with throwaway key ${attacker.kid} under published kid ${kid}`,
+			evidence: {
+				kid,
+				attackerKid: attacker.kid,
+				signedWith: "throwaway-key",
+			},
+		};
+	},
+};
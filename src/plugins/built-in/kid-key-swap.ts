@@ -0,0 +1,146 @@
+/**
+ * Kid Key Swap
+ *
+ * Changes the key material published under a stable `kid` over time. Every
+ * `intervalSeconds` the JWKS flips between the real key and an alternate
+ * one (same kid, same key type, different modulus or point), while tokens
+ * stay signed with the real key. Unlike rotation, which introduces a new
+ * kid, this breaks the invariant that a kid always names the same key: a
+ * client that caches keys by kid forever keeps a stale key after fetching
+ * during a swapped interval. Clients should notice signature failures and
+ * refetch the JWKS rather than trust their kid cache.
+ *
+ * Every JWKS response is recorded with the thumbprint published under each
+ * kid, so the ledger holds the key sequence per kid.
+ *
+ * Spec: RFC 7517 Section 4.5 - kid
+ * CWE-324: Use of a Key Past its Expiration Date
+ */
+
+import * as jose from "jose";
+import type { MischiefPlugin } from "../types.js";
+import type { JWK, JWKS } from "./jwks-injection.js";
+
+/** Alternate key material per original key, generated once */
+const alternates = new Map<string, Promise<JWK>>();
+
+export const kidKeySwap: MischiefPlugin = {
+	id: "kid-key-swap",
+	name: "Kid Key Swap",
+	severity: "high",
+	phase: "discovery",
+
+	spec: {
+		rfc: "RFC 7517 Section 4.5",
+		cwe: "CWE-324",
+		description: "A kid must always name the same key material; clients should refetch on mismatch",
+	},
+
+	description: "Swaps the key material published under a stable kid over time",
+
+	options: [
+		{
+			name: "intervalSeconds",
+			type: "number",
+			default: 30,
+			description: "Seconds between swaps of the key published under a kid",
+		},
+		{
+			name: "kid",
+			type: "string",
+			description: "Only swap the key published under this kid",
+		},
+	],
+
+	async apply(ctx) {
+		const jwks = ctx.response?.body as JWKS | undefined;
+		if (!ctx.response || !Array.isArray(jwks?.keys)) {
+			return { applied: false, mutation: "Not a JWKS response", evidence: {} };
+		}
+
+		const intervalSeconds = (ctx.config.intervalSeconds as number | undefined) ?? 30;
+		const onlyKid = ctx.config.kid as string | undefined;
+		if (!(intervalSeconds > 0)) {
+			return {
+				applied: false,
+				mutation: "intervalSeconds must be positive",
+				evidence: { intervalSeconds },
+			};
+		}
+
+		const generation = Math.floor(Date.now() / (intervalSeconds * 1000));
+		const swapped = generation % 2 === 1;
+
+		const keys: Record<string, unknown>[] = [];
+		const published: JWK[] = [];
+		for (const key of jwks.keys) {
+			const target = key.kid !== undefined && (onlyKid === undefined || key.kid === onlyKid);
+			const publish = target && swapped ? await alternateFor(key) : key;
+			published.push(publish);
+			if (target) {
+				keys.push({
+					kid: key.kid,
+					swapped,
+					thumbprint: await jose.calculateJwkThumbprint(publish as jose.JWK),
+				});
+			}
+		}
+
+		if (keys.length === 0) {
+			return { applied: false, mutation: "No key with a matching kid", evidence: { kid: onlyKid } };
+		}
+
+		ctx.response.body = { ...jwks, keys: published };
+
+		const kids = keys.map((k) => k.kid).join(", ");
+		return {
+			applied: true,
+			mutation: swapped
+				? `Published alternate key material under kid ${kids}`
+				: `Published original key material under kid ${kids} (swaps every ${intervalSeconds}s)`,
+			evidence: { generation, intervalSeconds, keys },
+		};
+	},
+};
+
+/**
+ * A freshly generated public key of the same type as `key`, carrying its kid, alg and use
+ */
+export function alternateFor(key: JWK): Promise<JWK> {
+	const cacheKey = `${key.kid}:${key.n ?? key.x ?? ""}`;
+	let alternate = alternates.get(cacheKey);
+	if (!alternate) {
+		alternate = generateAlternate(key);
+		alternates.set(cacheKey, alternate);
+	}
+	return alternate;
+}
+
+async function generateAlternate(key: JWK): Promise<JWK> {
+	const { publicKey } = await jose.generateKeyPair(generationAlg(key), {
+		extractable: true,
+		...(key.kty === "RSA" && key.n
+			? { modulusLength: Buffer.from(key.n, "base64url").length * 8 }
+			: {}),
+		...(key.kty === "OKP" && key.crv ? { crv: key.crv } : {}),
+	});
+	const jwk = (await jose.exportJWK(publicKey)) as JWK;
+	for (const member of ["kid", "alg", "use"] as const) {
+		const value = key[member];
+		if (value !== undefined) {
+			jwk[member] = value;
+		}
+	}
+	return jwk;
+}
+
+function generationAlg(key: JWK): string {
+	switch (key.kty) {
+		case "EC":
+			return key.crv === "P-384" ? "ES384" : key.crv === "P-521" ? "ES512" : "ES256";
+		case "OKP":
+			return "EdDSA";
+		default:
+			return key.alg?.startsWith("PS") ? key.alg : "RS256";
+	}
+}
@@ -34,6 +34,34 @@ export const kidManipulationPlugin: MischiefPlugin = {
 
 	description: "Manipulates kid header to test key selection validation",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["remove", "invalid", "injection", "sql"],
+			default: "invalid",
+			description: "How the kid header is manipulated",
+		},
+		{
+			name: "invalidKid",
+			type: "string",
+			default: "non-existent-key-id-12345",
+			description: "The kid set in invalid mode",
+		},
+		{
+			name: "injectionPayload",
+			type: "string",
+			default: "../../../../../../etc/passwd",
+			description: "The kid set in injection mode",
+		},
+		{
+			name: "sqlPayload",
+			type: "string",
+			default: "' OR '1'='1",
+			description: "The kid set in sql mode",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
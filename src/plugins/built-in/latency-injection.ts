@@ -24,6 +24,15 @@ export const latencyInjectionPlugin: MischiefPlugin = {
 
 	description: "Injects artificial delay to test client timeout handling",
 
+	options: [
+		{
+			name: "delayMs",
+			type: "integer",
+			default: 5000,
+			description: "How long the response is delayed, in milliseconds",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.response) {
 			return { applied: false, mutation: "No response context", evidence: {} };
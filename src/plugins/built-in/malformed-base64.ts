@@ -0,0 +1,145 @@
+/**
+ * Malformed Base64 Segments
+ *
+ * Emits the chosen segments of the token in standard base64 (`+`, `/` and
+ * `=` padding) instead of the unpadded base64url a JWS requires. Header
+ * and payload are re-signed as emitted, so the signature verifies for a
+ * decoder that accepts either alphabet. A client should reject the token
+ * outright; one that decodes it anyway runs a lenient base64 decoder, and
+ * such decoders tend to disagree with each other on what a segment says.
+ *
+ * Config:
+ * - segments: the segment, or list of segments, to mis-encode ("header",
+ *   "payload", "signature"; default: all three)
+ *
+ * A header or payload whose encoding happens to contain no `-`, `_` or
+ * padding reads the same in both alphabets; a trailing space is added to
+ * its JSON so its standard encoding is padded. The evidence records, per
+ * segment, how many `+`, `/` and `=` characters it was emitted with.
+ *
+ * Spec: RFC 7515 Section 2 - Base64url Encoding, with all trailing '='
+ * characters omitted; RFC 7519 Section 7.2 - validating a JWT
+ * CWE-20: Improper Input Validation
+ */
+
+import { type TokenSegment, standardBase64 } from "../../core/token-forge.js";
+import type { MischiefPlugin } from "../types.js";
+
+const SEGMENTS: TokenSegment[] = ["header", "payload", "signature"];
+
+export const malformedBase64: MischiefPlugin = {
+	id: "malformed-base64",
+	name: "Malformed Base64 Segments",
+	severity: "medium",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 7515 Section 2",
+		cwe: "CWE-20",
+		description: "JWS segments MUST be base64url-encoded with trailing '=' characters omitted",
+	},
+
+	description: "Encodes token segments in standard base64 with '+', '/' and '=' padding",
+
+	options: [
+		{
+			name: "segments",
+			type: ["string", "array"],
+			default: SEGMENTS,
+			description: "The segments mis-encoded: header, payload and/or signature",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (ctx.token.standardBase64 === undefined) {
+			return { applied: false, mutation: "Host can't re-encode token segments", evidence: {} };
+		}
+
+		const configured = ctx.config.segments ?? SEGMENTS;
+		const segments = typeof configured === "string" ? [configured] : configured;
+		if (
+			!Array.isArray(segments) ||
+			segments.length === 0 ||
+			!segments.every((segment) => SEGMENTS.includes(segment))
+		) {
+			return {
+				applied: false,
+				mutation: `segments must be one or more of ${SEGMENTS.join(", ")}`,
+				evidence: { segments: configured },
+			};
+		}
+		const chosen = SEGMENTS.filter((segment) => segments.includes(segment));
+
+		const signsInput = chosen.some((segment) => segment !== "signature");
+		if (signsInput && !ctx.token.resign) {
+			return { applied: false, mutation: "Signing key not available", evidence: {} };
+		}
+		if (chosen.includes("payload") && ctx.token.header.b64 === false) {
+			return {
+				applied: false,
+				mutation: "The payload is emitted unencoded (b64: false)",
+				evidence: { segments: chosen },
+			};
+		}
+		if (chosen.includes("signature") && !signsInput && ctx.token.signature === "") {
+			return { applied: false, mutation: "The token carries no signature", evidence: {} };
+		}
+
+		const whitespaceAdded: TokenSegment[] = [];
+		if (chosen.includes("header")) {
+			const header = ctx.token.rawHeader ?? JSON.stringify(ctx.token.header);
+			if (standardBase64(encode(header)) === encode(header)) {
+				ctx.token.rawHeader = `${header} `;
+				whitespaceAdded.push("header");
+			}
+		}
+		if (chosen.includes("payload")) {
+			const payload = ctx.token.rawPayload ?? JSON.stringify(ctx.token.claims);
+			if (standardBase64(encode(payload)) === encode(payload)) {
+				ctx.token.rawPayload = `${payload} `;
+				whitespaceAdded.push("payload");
+			}
+		}
+
+		ctx.token.standardBase64 = chosen;
+		if (signsInput) {
+			await ctx.token.resign?.();
+		}
+
+		const emitted: Record<TokenSegment, string> = {
+			header: encode(ctx.token.rawHeader ?? JSON.stringify(ctx.token.header)),
+			payload: encode(ctx.token.rawPayload ?? JSON.stringify(ctx.token.claims)),
+			signature: ctx.token.signature,
+		};
+		const report = chosen.map((segment) => {
+			const encoded = standardBase64(emitted[segment]);
+			return {
+				segment,
+				plus: count(encoded, "+"),
+				slash: count(encoded, "/"),
+				padding: count(encoded, "="),
+				whitespaceAdded: whitespaceAdded.includes(segment),
+			};
+		});
+
+		const how = report
+			.map((r) => `${r.segment} (${r.plus} '+', ${r.slash} '/', ${r.padding} '=')`)
+			.join(", ");
+		return {
+			applied: true,
+			mutation: `Encoded in standard base64: ${how}`,
+			evidence: { segments: report, resigned: signsInput },
+		};
+	},
+};
+
+function encode(json: string): string {
+	return Buffer.from(json).toString("base64url");
+}
+
+function count(encoded: string, char: string): number {
+	return encoded.split(char).length - 1;
+}
@@ -0,0 +1,137 @@
+/**
+ * Malformed Timestamps
+ *
+ * `exp`, `iat` and `nbf` are NumericDates: JSON numbers of seconds since
+ * the epoch. This plugin emits one in a shape a strict parser refuses but
+ * a lenient one coerces into a usable time: a string of digits
+ * (`"exp":"1700003600"`), a number with a fractional part
+ * (`1700003600.5`), or a negative number (`-1700003600`, before 1970). The
+ * payload is rendered by hand and re-signed over the exact bytes, so the
+ * malformed timestamp is the only reason left to reject the token; the
+ * member as emitted is recorded in the evidence.
+ *
+ * The rest of the payload is the claims as they stood when this plugin
+ * ran; claims mischief applied after it doesn't reach the emitted token.
+ *
+ * Config:
+ * - claim: exp (default), iat or nbf; the token must carry it
+ * - malformation: "string" (default), "float" or "negative"
+ *
+ * Spec: RFC 7519 Section 2 - NumericDate is a JSON numeric value of seconds
+ * since the epoch; OIDC Core 1.0 Section 2 - exp and iat are JSON numbers
+ * CWE-1287: Improper Validation of Specified Type of Input
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type Malformation = "string" | "float" | "negative";
+
+const TIMESTAMP_CLAIMS = ["exp", "iat", "nbf"];
+const MALFORMATIONS: Malformation[] = ["string", "float", "negative"];
+
+export const malformedTimestamps: MischiefPlugin = {
+	id: "malformed-timestamps",
+	name: "Malformed Timestamps",
+	severity: "medium",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 2",
+		oidc: "OIDC Core 1.0 Section 2",
+		cwe: "CWE-1287",
+		description: "Timestamp claims MUST be NumericDate JSON numbers",
+	},
+
+	description: "Emits exp, iat or nbf as a string, a fraction or a negative number, validly signed",
+
+	options: [
+		{
+			name: "claim",
+			type: "string",
+			values: TIMESTAMP_CLAIMS,
+			default: "exp",
+			description: "The NumericDate malformed; the token must carry it",
+		},
+		{
+			name: "malformation",
+			type: "string",
+			values: ["string", "float", "negative"],
+			default: "string",
+			description: "How the timestamp is malformed",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (!ctx.token.resign) {
+			return { applied: false, mutation: "Signing key not available", evidence: {} };
+		}
+
+		const claim = ctx.config.claim ?? "exp";
+		if (typeof claim !== "string" || !TIMESTAMP_CLAIMS.includes(claim)) {
+			return {
+				applied: false,
+				mutation: `claim must be one of ${TIMESTAMP_CLAIMS.join(", ")}`,
+				evidence: { claim },
+			};
+		}
+		const malformation = (ctx.config.malformation as Malformation | undefined) ?? "string";
+		if (!MALFORMATIONS.includes(malformation)) {
+			return {
+				applied: false,
+				mutation: `Unknown malformation: ${malformation}`,
+				evidence: { malformation },
+			};
+		}
+
+		const { claims } = ctx.token;
+		const value = claims[claim];
+		if (typeof value !== "number" || !Number.isInteger(value)) {
+			return {
+				applied: false,
+				mutation: `Token has no NumericDate '${claim}' to malform`,
+				evidence: { claim },
+			};
+		}
+
+		const serialized = malform(value, malformation);
+		const members = Object.entries(claims).map(([name, member]) =>
+			name === claim
+				? `${JSON.stringify(name)}:${serialized}`
+				: `${JSON.stringify(name)}:${JSON.stringify(member)}`,
+		);
+		const emittedPayload = `{${members.join(",")}}`;
+		ctx.token.rawPayload = emittedPayload;
+		await ctx.token.resign();
+
+		return {
+			applied: true,
+			mutation: `Emitted '${claim}' as ${serialized} (${malformation})`,
+			evidence: {
+				claim,
+				malformation,
+				originalValue: value,
+				serialized,
+				emittedPayload,
+				vulnerability: "Client may coerce a malformed timestamp instead of rejecting it",
+			},
+		};
+	},
+};
+
+/**
+ * A NumericDate serialized the way the malformation asks: `"1700003600"`,
+ * `1700003600.5` or `-1700003600`
+ */
+function malform(value: number, malformation: Malformation): string {
+	switch (malformation) {
+		case "string":
+			return JSON.stringify(String(value));
+		case "float":
+			return `${value}.5`;
+		case "negative":
+			return `-${Math.abs(value)}`;
+	}
+}
@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const massiveJwks: MischiefPlugin = {
@@ -18,7 +19,7 @@ export const massiveJwks: MischiefPlugin = {
 		}
 
 		const keyCounts = [100, 1000, 10000];
-		const selectedCount = keyCounts[Math.floor(Math.random() * keyCounts.length)] ?? 100;
+		const selectedCount = keyCounts[randomInt(keyCounts.length)] ?? 100;
 
 		// Add a header indicating massive JWKS
 		ctx.token.header.kid = `key-among-${selectedCount}`;
@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const massiveMetadata: MischiefPlugin = {
@@ -22,7 +23,7 @@ export const massiveMetadata: MischiefPlugin = {
 			{ name: "10000 scopes", count: 10000 },
 		];
 
-		const selected = sizes[Math.floor(Math.random() * sizes.length)] as (typeof sizes)[0];
+		const selected = sizes[randomInt(sizes.length)] as (typeof sizes)[0];
 
 		ctx.token.claims.metadata_scope_count = selected.count;
 
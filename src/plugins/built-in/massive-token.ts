@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const massiveToken: MischiefPlugin = {
@@ -23,7 +24,7 @@ export const massiveToken: MischiefPlugin = {
 			{ name: "10MB", chars: 10 * 1024 * 1024 },
 		];
 
-		const selected = sizes[Math.floor(Math.random() * sizes.length)] as (typeof sizes)[0];
+		const selected = sizes[randomInt(sizes.length)] as (typeof sizes)[0];
 		const padding = "X".repeat(selected.chars);
 
 		ctx.token.claims.massive_claim = padding;
@@ -0,0 +1,68 @@
+/**
+ * Max Age Ignored
+ *
+ * Step-up flows send `max_age=0` to demand that the user authenticates
+ * again right now, and must then check that the ID token's `auth_time` is
+ * no older than the request. This plugin ignores `max_age=0`: the provider
+ * reuses the existing login instead of prompting, and if the user had to
+ * log in anyway, the ID token's `auth_time` is backdated by `staleSeconds`
+ * (default 3600). Clients that don't compare `auth_time` with the time of
+ * their request treat a stale login as a fresh step-up.
+ *
+ * Spec: OIDC Core 1.0 Section 3.1.2.1 - max_age; Section 2 - auth_time
+ * CWE-613: Insufficient Session Expiration
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const maxAgeIgnored: MischiefPlugin = {
+	id: "max-age-ignored",
+	name: "Max Age Ignored",
+	severity: "high",
+	phase: "endpoint",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 3.1.2.1",
+		cwe: "CWE-613",
+		description: "With max_age=0 the user MUST be actively re-authenticated",
+	},
+
+	description: "Ignores max_age=0 and issues an ID token with a stale auth_time",
+
+	options: [
+		{
+			name: "staleSeconds",
+			type: "integer",
+			default: 3600,
+			description: "How far auth_time is backdated when the user logged in anyway",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (ctx.endpoint.path !== "/auth") {
+			return { applied: false, mutation: "Not an authorization request", evidence: {} };
+		}
+
+		const maxAge = ctx.endpoint.params.max_age;
+		if (maxAge !== "0") {
+			return {
+				applied: false,
+				mutation: maxAge === undefined ? "No max_age requested" : `Client sent max_age=${maxAge}`,
+				evidence: {},
+			};
+		}
+
+		const staleSeconds = (ctx.config.staleSeconds as number | undefined) ?? 3600;
+		ctx.endpoint.actions.ignoreMaxAge = true;
+		ctx.endpoint.actions.staleAuthTimeSeconds = staleSeconds;
+
+		return {
+			applied: true,
+			mutation: "Ignored max_age=0 instead of forcing re-authentication",
+			evidence: { maxAge: 0, staleSeconds, prompt: ctx.endpoint.params.prompt ?? null },
+		};
+	},
+};
@@ -0,0 +1,85 @@
+/**
+ * Metadata Mismatch
+ *
+ * Makes the OpenID discovery document and the RFC 8414 authorization server
+ * metadata disagree on `jwks_uri`. Both describe the same issuer, so a
+ * client that sees a conflict should refuse to pick one; otherwise, which
+ * jwks_uri it fetches keys from shows which document it trusted.
+ * Config:
+ * - document: which document advertises the conflicting jwks_uri,
+ *   "oauth-authorization-server" (default) or "openid-configuration"
+ * - jwksUri: the conflicting jwks_uri (default an attacker-controlled URL)
+ *
+ * Spec: RFC 8414 Section 5 - both documents must describe the same authorization server
+ * CWE-436: Interpretation Conflict
+ */
+
+import type { MetadataDocument } from "../../core/provider-metadata.js";
+import type { MischiefPlugin } from "../types.js";
+
+const DOCUMENTS: MetadataDocument[] = ["oauth-authorization-server", "openid-configuration"];
+
+export const metadataMismatch: MischiefPlugin = {
+	id: "metadata-mismatch",
+	name: "Metadata Mismatch",
+	severity: "high",
+	phase: "discovery",
+
+	spec: {
+		rfc: "RFC 8414 Section 5",
+		oidc: "OpenID Connect Discovery 1.0 Section 4",
+		cwe: "CWE-436",
+		description:
+			"The OpenID and OAuth metadata documents of an issuer must advertise the same values",
+	},
+
+	description: "Advertises conflicting jwks_uri values in the OpenID and RFC 8414 metadata",
+
+	options: [
+		{
+			name: "document",
+			type: "string",
+			values: ["oauth-authorization-server", "openid-configuration"],
+			default: "oauth-authorization-server",
+			description: "Which document advertises the conflicting jwks_uri",
+		},
+		{
+			name: "jwksUri",
+			type: "string",
+			description: "The conflicting jwks_uri (default: an attacker-controlled URL)",
+		},
+	],
+
+	async apply(ctx) {
+		const served = ctx.response?.metadataDocument;
+		const metadata = ctx.response?.body as Record<string, unknown> | undefined;
+		if (!ctx.response || served === undefined || typeof metadata !== "object" || !metadata) {
+			return { applied: false, mutation: "Not a metadata document", evidence: {} };
+		}
+
+		const document =
+			(ctx.config.document as MetadataDocument | undefined) ?? "oauth-authorization-server";
+		if (!DOCUMENTS.includes(document)) {
+			return { applied: false, mutation: `Unknown document: ${document}`, evidence: { document } };
+		}
+		if (served !== document) {
+			return { applied: false, mutation: `${served} left consistent`, evidence: {} };
+		}
+
+		const jwksUri =
+			(ctx.config.jwksUri as string | undefined) ??
+			"https://attacker.example.com/.well-known/jwks.json";
+		const originalJwksUri = metadata.jwks_uri;
+		ctx.response.body = { ...metadata, jwks_uri: jwksUri };
+
+		return {
+			applied: true,
+			mutation: `${document} advertises jwks_uri ${jwksUri}`,
+			evidence: {
+				document,
+				originalJwksUri: originalJwksUri ?? null,
+				conflictingJwksUri: jwksUri,
+			},
+		};
+	},
+};
@@ -0,0 +1,166 @@
+/**
+ * Mixed Key Type JWKS
+ *
+ * Publishes, under the kid tokens are signed with, a key whose `kty`
+ * doesn't fit the token's `alg`: an EC key for RS256 tokens, an RSA key
+ * for ES256 or EdDSA ones. The mismatched key keeps the real key's `alg`
+ * and `use`, so only its type gives it away. A client that looks keys up
+ * by kid alone then either fails on key material it can't use with the
+ * token's alg or, worse, verifies with whatever the library makes of it;
+ * it should match on kid and algorithm family, and refetch or reject when
+ * none fits.
+ *
+ * Config:
+ * - kty: the key type to advertise ("RSA", "EC" or "OKP"; default: EC for
+ *   RSA keys, RSA for the others)
+ * - kid: only mismatch the key with this kid (default: every key)
+ * - keepRealKey: also publish the real key, after the mismatched one
+ *   (default: false)
+ *
+ * The evidence records each mismatched key's advertised metadata against
+ * the header of the tokens it signs.
+ *
+ * Spec: RFC 8725 Section 3.1 - use each key with exactly one algorithm;
+ * RFC 7517 Section 4.4 - alg
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import * as jose from "jose";
+import type { MischiefPlugin } from "../types.js";
+import type { JWK, JWKS } from "./jwks-injection.js";
+
+const KEY_TYPES = ["RSA", "EC", "OKP"];
+
+/** Mismatched keys per original key and key type, generated once */
+const mismatched = new Map<string, Promise<JWK>>();
+
+export const mixedKeyTypeJwks: MischiefPlugin = {
+	id: "mixed-key-type-jwks",
+	name: "Mixed Key Type JWKS",
+	severity: "high",
+	phase: "discovery",
+
+	spec: {
+		rfc: "RFC 8725 Section 3.1",
+		cwe: "CWE-347",
+		description: "A key must be selected by kid and by a key type that fits the token's alg",
+	},
+
+	description: "Publishes a key whose kty doesn't match the token's alg under the token's kid",
+
+	options: [
+		{
+			name: "kty",
+			type: "string",
+			values: KEY_TYPES,
+			description: "The key type advertised (default: EC for RSA keys, RSA for the others)",
+		},
+		{
+			name: "kid",
+			type: "string",
+			description: "Only mismatch the key with this kid",
+		},
+		{
+			name: "keepRealKey",
+			type: "boolean",
+			default: false,
+			description: "Also publish the real key, after the mismatched one",
+		},
+	],
+
+	async apply(ctx) {
+		const jwks = ctx.response?.body as JWKS | undefined;
+		if (!ctx.response || !Array.isArray(jwks?.keys)) {
+			return { applied: false, mutation: "Not a JWKS response", evidence: {} };
+		}
+
+		const kty = ctx.config.kty as string | undefined;
+		const onlyKid = ctx.config.kid as string | undefined;
+		const keepRealKey = ctx.config.keepRealKey ?? false;
+		if (kty !== undefined && !KEY_TYPES.includes(kty)) {
+			return {
+				applied: false,
+				mutation: `kty must be one of ${KEY_TYPES.join(", ")}`,
+				evidence: { kty },
+			};
+		}
+		if (typeof keepRealKey !== "boolean") {
+			return { applied: false, mutation: "keepRealKey must be a boolean", evidence: {} };
+		}
+
+		const keys: Record<string, unknown>[] = [];
+		const published: JWK[] = [];
+		for (const key of jwks.keys) {
+			const advertisedKty = kty ?? (key.kty === "RSA" ? "EC" : "RSA");
+			const target =
+				key.kid !== undefined &&
+				(onlyKid === undefined || key.kid === onlyKid) &&
+				key.kty !== advertisedKty;
+			if (!target) {
+				published.push(key);
+				continue;
+			}
+			const advertised = await mismatchedFor(key, advertisedKty);
+			published.push(advertised, ...(keepRealKey ? [key] : []));
+			keys.push({
+				advertised: {
+					kid: advertised.kid,
+					kty: advertised.kty,
+					crv: advertised.crv ?? null,
+					alg: advertised.alg ?? null,
+					use: advertised.use ?? null,
+				},
+				tokenHeader: { kid: key.kid, alg: key.alg ?? null },
+				realKty: key.kty,
+			});
+		}
+
+		if (keys.length === 0) {
+			return {
+				applied: false,
+				mutation: "No key with a matching kid to mismatch",
+				evidence: { kid: onlyKid ?? null, kty: kty ?? null },
+			};
+		}
+
+		ctx.response.body = { ...jwks, keys: published };
+
+		const kids = keys.map((k) => (k.tokenHeader as { kid: string }).kid).join(", ");
+		return {
+			applied: true,
+			mutation: keepRealKey
+				? `Published a mismatched key type ahead of the real key under kid ${kids}`
+				: `Published a mismatched key type in place of the real key under kid ${kids}`,
+			evidence: { keepRealKey, keys },
+		};
+	},
+};
+
+/**
+ * A freshly generated public key of type `kty`, carrying `key`'s kid, alg and use
+ */
+function mismatchedFor(key: JWK, kty: string): Promise<JWK> {
+	const cacheKey = `${key.kid}:${key.n ?? key.x ?? ""}:${kty}`;
+	let generated = mismatched.get(cacheKey);
+	if (!generated) {
+		generated = generateMismatched(key, kty);
+		mismatched.set(cacheKey, generated);
+	}
+	return generated;
+}
+
+async function generateMismatched(key: JWK, kty: string): Promise<JWK> {
+	const generationAlg = { RSA: "RS256", EC: "ES256", OKP: "EdDSA" }[kty] ?? "ES256";
+	const { publicKey } = await jose.generateKeyPair(generationAlg, {
+		extractable: true,
+		...(kty === "OKP" ? { crv: "Ed25519" } : {}),
+	});
+	const jwk = (await jose.exportJWK(publicKey)) as JWK;
+	for (const member of ["kid", "alg", "use"] as const) {
+		const value = key[member];
+		if (value !== undefined) {
+			jwk[member] = value;
+		}
+	}
+	return jwk;
+}
@@ -0,0 +1,95 @@
+/**
+ * Future nbf
+ *
+ * Issues a token that isn't valid yet: `nbf` is set `offset` after now
+ * (a Go duration, default "1h") while `exp` stays in the future and `iat`
+ * keeps the real issue time, so the token looks otherwise plausible.
+ * Clients that only check `exp` accept it. If the offset reaches past
+ * `exp`, `exp` is moved to keep the token's original lifetime after `nbf`,
+ * so the token becomes valid later rather than never.
+ *
+ * Tokens are re-signed with Loki's key, so only `nbf` (and at most `exp`)
+ * is wrong.
+ *
+ * Spec: RFC 7519 Section 4.1.5 - the token MUST NOT be accepted before nbf
+ * CWE-613: Insufficient Session Expiration
+ */
+
+import { parseDuration } from "../../core/duration.js";
+import type { MischiefPlugin } from "../types.js";
+
+const DEFAULT_OFFSET = "1h";
+
+/** Lifetime given a token without usable iat/exp when exp has to move */
+const FALLBACK_LIFETIME_SECONDS = 3600;
+
+export const nbfFuture: MischiefPlugin = {
+	id: "nbf-future",
+	name: "Future nbf",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 4.1.5",
+		cwe: "CWE-613",
+		description: "Clients MUST NOT accept a token before its nbf",
+	},
+
+	description: "Sets nbf in the future while exp stays valid and iat stays real",
+
+	options: [
+		{
+			name: "offset",
+			type: "string",
+			default: DEFAULT_OFFSET,
+			description: "How far after now nbf is set, as a Go duration",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const offset = ctx.config.offset ?? DEFAULT_OFFSET;
+		const ms = typeof offset === "string" ? parseDuration(offset) : undefined;
+		if (ms === undefined || ms < 1000) {
+			return {
+				applied: false,
+				mutation: "offset must be a Go duration of at least 1s",
+				evidence: { offset },
+			};
+		}
+
+		const { claims } = ctx.token;
+		const originalNbf = claims.nbf ?? null;
+		const originalExp = claims.exp ?? null;
+		const now = Math.floor(Date.now() / 1000);
+		const nbf = now + Math.floor(ms / 1000);
+		claims.nbf = nbf;
+		if (typeof claims.exp !== "number" || claims.exp <= nbf) {
+			const lifetime =
+				typeof claims.exp === "number" && typeof claims.iat === "number"
+					? claims.exp - claims.iat
+					: FALLBACK_LIFETIME_SECONDS;
+			claims.exp = nbf + Math.max(lifetime, 1);
+		}
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Set nbf ${offset} in the future; iat unchanged`,
+			evidence: {
+				offset,
+				originalNbf,
+				nbf,
+				iat: claims.iat ?? null,
+				originalExp,
+				exp: claims.exp,
+				expMoved: claims.exp !== originalExp,
+			},
+		};
+	},
+};
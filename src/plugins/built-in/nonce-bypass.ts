@@ -16,6 +16,7 @@
  * CWE-384: Session Fixation
  */
 
+import { random } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 type NonceMode = "remove" | "replay" | "empty" | "mismatch";
@@ -34,6 +35,22 @@ export const nonceBypassPlugin: MischiefPlugin = {
 
 	description: "Manipulates nonce claim to test replay protection",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["remove", "replay", "empty", "mismatch"],
+			default: "remove",
+			description: "How the nonce claim is manipulated",
+		},
+		{
+			name: "replayNonce",
+			type: "string",
+			default: "static-predictable-nonce-12345",
+			description: "The static nonce set in replay mode",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
@@ -65,7 +82,7 @@ export const nonceBypassPlugin: MischiefPlugin = {
 
 			case "mismatch":
 				// Generate a different random nonce
-				newNonce = `mismatched-nonce-${Date.now()}-${Math.random().toString(36).slice(2)}`;
+				newNonce = `mismatched-nonce-${Date.now()}-${random().toString(36).slice(2)}`;
 				mutation = "Changed nonce to mismatched value";
 				break;
 
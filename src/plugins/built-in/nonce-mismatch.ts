@@ -0,0 +1,54 @@
+/**
+ * Nonce Mismatch
+ *
+ * Replaces the `nonce` claim of ID tokens issued for an authentication
+ * request that carried one with a fresh random value. A client that checks
+ * the claim is present but never compares it with the nonce it sent
+ * accepts ID tokens minted for someone else's login.
+ *
+ * Tokens are re-signed with Loki's key, so only the nonce is wrong.
+ *
+ * Spec: OIDC Core 1.0 Section 3.1.3.7 - the nonce claim MUST match the value sent in the request
+ * CWE-294: Authentication Bypass by Capture-replay
+ */
+
+import { randomBytes } from "../../core/random.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const nonceMismatch: MischiefPlugin = {
+	id: "nonce-mismatch",
+	name: "Nonce Mismatch",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 3.1.3.7",
+		cwe: "CWE-294",
+		description: "The ID token's nonce MUST match the one sent in the Authentication Request",
+	},
+
+	description: "Replaces the nonce claim of ID tokens with a different random value",
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const expectedNonce = ctx.token.claims.nonce;
+		if (expectedNonce === undefined) {
+			return { applied: false, mutation: "Token carries no nonce", evidence: {} };
+		}
+
+		const nonce = randomBytes(16).toString("base64url");
+		ctx.token.claims.nonce = nonce;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: "Replaced the nonce claim with a random value",
+			evidence: { expectedNonce, nonce },
+		};
+	},
+};
@@ -0,0 +1,52 @@
+/**
+ * Nonce Omission
+ *
+ * Drops the `nonce` claim from ID tokens issued for an authentication
+ * request that carried one. A client that only compares the nonce when the
+ * claim is present accepts the token, and with it an ID token an attacker
+ * could have obtained for another login.
+ *
+ * Tokens are re-signed with Loki's key, so only the nonce is missing.
+ *
+ * Spec: OIDC Core 1.0 Section 3.1.3.7 - a nonce sent in the request MUST be present and match
+ * CWE-294: Authentication Bypass by Capture-replay
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const nonceOmission: MischiefPlugin = {
+	id: "nonce-omission",
+	name: "Nonce Omission",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 3.1.3.7",
+		cwe: "CWE-294",
+		description: "If a nonce was sent in the Authentication Request, the ID token MUST carry it",
+	},
+
+	description: "Drops the nonce claim from ID tokens whose request sent one",
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const expectedNonce = ctx.token.claims.nonce;
+		if (expectedNonce === undefined) {
+			return { applied: false, mutation: "Token carries no nonce", evidence: {} };
+		}
+
+		ctx.token.claims.nonce = undefined;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: "Removed the nonce claim",
+			evidence: { expectedNonce, nonce: null },
+		};
+	},
+};
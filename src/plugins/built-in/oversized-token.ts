@@ -0,0 +1,96 @@
+/**
+ * Oversized Token
+ *
+ * Pads the token's payload with a junk claim of an exact size (default
+ * 1 MiB) and re-signs it with Loki's key, so the token is a well-formed,
+ * validly signed JWS that is simply far too big. Unlike `massive-token`,
+ * the size is fixed and nothing else changes, so a gateway or client that
+ * bounds token size before decoding rejects it on size alone, and one that
+ * buffers whatever it's given has to decode, parse and verify megabytes of
+ * padding. The padding is one repeated character, so it compresses to
+ * almost nothing on the wire.
+ *
+ * Config:
+ * - tokenPadBytes: the padding claim's size in bytes, up to 64 MiB
+ *   (default: 1048576); sessions may set it with `tokenPadBytes`
+ *
+ * Spec: RFC 7519 - JWTs have no size limit, so clients must set their own
+ * CWE-770: Allocation of Resources Without Limits or Throttling
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+const DEFAULT_TOKEN_PAD_BYTES = 1024 * 1024;
+
+/** Keeps the padding (and its base64url encoding) well within what Loki can build */
+export const MAX_TOKEN_PAD_BYTES = 64 * 1024 * 1024;
+
+/** The junk claim the padding goes in */
+const PAD_CLAIM = "loki_pad";
+
+export const oversizedToken: MischiefPlugin = {
+	id: "oversized-token",
+	name: "Oversized Token",
+	severity: "medium",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519",
+		cwe: "CWE-770",
+		description: "Clients must bound token size before decoding and parsing a JWT",
+	},
+
+	description: "Pads the payload with a junk claim of a configurable size, validly signed",
+
+	options: [
+		{
+			name: "tokenPadBytes",
+			type: "integer",
+			default: DEFAULT_TOKEN_PAD_BYTES,
+			description: "The padding claim's size in bytes, up to 64 MiB",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const padBytes = ctx.config.tokenPadBytes ?? DEFAULT_TOKEN_PAD_BYTES;
+		if (!isTokenPadBytes(padBytes)) {
+			return {
+				applied: false,
+				mutation: `tokenPadBytes must be an integer from 1 to ${MAX_TOKEN_PAD_BYTES}`,
+				evidence: { tokenPadBytes: padBytes },
+			};
+		}
+
+		const { claims } = ctx.token;
+		claims[PAD_CLAIM] = "A".repeat(padBytes);
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+		const payloadBytes = Buffer.byteLength(JSON.stringify(claims));
+
+		return {
+			applied: true,
+			mutation: `Padded the payload with ${padBytes} bytes in '${PAD_CLAIM}'`,
+			evidence: {
+				claim: PAD_CLAIM,
+				tokenPadBytes: padBytes,
+				payloadBytes,
+				encodedPayloadBytes: Math.ceil((payloadBytes * 4) / 3),
+				signatureValid: ctx.token.resign !== undefined,
+			},
+		};
+	},
+};
+
+/**
+ * Whether a value is a padding size the plugin accepts
+ */
+export function isTokenPadBytes(value: unknown): value is number {
+	return (
+		Number.isInteger(value) && (value as number) > 0 && (value as number) <= MAX_TOKEN_PAD_BYTES
+	);
+}
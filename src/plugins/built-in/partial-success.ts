@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const partialSuccess: MischiefPlugin = {
@@ -45,9 +46,7 @@ export const partialSuccess: MischiefPlugin = {
 			},
 		];
 
-		const selectedScenario = scenarios[
-			Math.floor(Math.random() * scenarios.length)
-		] as (typeof scenarios)[0];
+		const selectedScenario = scenarios[randomInt(scenarios.length)] as (typeof scenarios)[0];
 		selectedScenario.apply();
 
 		return {
@@ -1,98 +1,65 @@
 /**
  * PKCE Downgrade Attack
  *
- * Tests client handling of PKCE (Proof Key for Code Exchange) bypass attempts.
- * This plugin manipulates token claims to simulate scenarios where PKCE
- * validation might be circumvented.
+ * Ignores the code_verifier of a session's authorization code exchange:
+ * a missing or wrong verifier is accepted and tokens are issued anyway,
+ * as if the authorization request had never carried a code_challenge.
+ * An attacker who intercepts the code can then redeem it without the
+ * verifier. Use it to check that whatever sits in front of Loki (a
+ * gateway, a BFF, the client's own server) enforces PKCE end to end.
  *
  * Real-world impact: Mobile/SPA authorization code interception
  *
- * Modes:
- * - inject-code-challenge: Adds code_challenge claim to token (non-standard)
- * - weaken-method: Indicates plain method was used instead of S256
- * - add-auth-time: Manipulates auth_time to suggest different auth context
+ * Config schema v2; v1's claim-editing modes are gone and their config
+ * migrates to none.
  *
- * Note: True PKCE attacks happen at the authorization/token exchange level,
- * not in the token itself. This plugin tests if clients incorrectly trust
- * PKCE-related claims in tokens.
- *
- * Spec: RFC 7636 - Proof Key for Code Exchange
- * CWE-345: Insufficient Verification of Data Authenticity
+ * Spec: RFC 7636 Section 4.6 - the server MUST verify code_verifier
+ * CWE-287: Improper Authentication
  */
 
 import type { MischiefPlugin } from "../types.js";
 
-type PkceMode = "inject-code-challenge" | "weaken-method" | "add-auth-time";
-
 export const pkceDowngradePlugin: MischiefPlugin = {
 	id: "pkce-downgrade",
 	name: "PKCE Downgrade",
 	severity: "high",
-	phase: "token-claims",
+	phase: "endpoint",
+	configVersion: 2,
 
 	spec: {
-		rfc: "RFC 7636",
-		cwe: "CWE-345",
-		description: "PKCE code_challenge_method SHOULD be S256, clients MUST verify code_verifier",
+		rfc: "RFC 7636 Section 4.6",
+		cwe: "CWE-287",
+		description: "The authorization server MUST verify the code_verifier before issuing tokens",
 	},
 
-	description: "Tests PKCE-related claim handling and auth context validation",
+	description: "Issues tokens for a PKCE code whatever the code_verifier",
+
+	migrateConfig(config) {
+		const { mode: _mode, ...rest } = config;
+		return rest;
+	},
 
 	async apply(ctx) {
-		if (!ctx.token) {
-			return { applied: false, mutation: "No token context", evidence: {} };
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
 		}
-
-		const mode = (ctx.config.mode as PkceMode | undefined) ?? "weaken-method";
-		const evidence: Record<string, unknown> = { mode };
-
-		let mutation: string;
-
-		switch (mode) {
-			case "inject-code-challenge": {
-				// Inject PKCE-related claims (non-standard but might confuse some implementations)
-				ctx.token.claims.code_challenge = "attacker-controlled-challenge";
-				ctx.token.claims.code_challenge_method = "plain";
-				mutation = "Injected code_challenge claims into token";
-				evidence.injectedClaims = ["code_challenge", "code_challenge_method"];
-				break;
-			}
-
-			case "weaken-method": {
-				// Add claims suggesting weaker PKCE was used
-				ctx.token.claims.acr = "0"; // Authentication Context Class = no assurance
-				ctx.token.claims.amr = ["pwd"]; // Only password, no MFA
-				mutation = "Set weak authentication context (acr=0, amr=[pwd])";
-				evidence.acr = "0";
-				evidence.amr = ["pwd"];
-				break;
-			}
-
-			case "add-auth-time": {
-				// Manipulate auth_time to suggest stale authentication
-				const staleAuthTime = Math.floor(Date.now() / 1000) - 86400 * 30; // 30 days ago
-				const originalAuthTime = ctx.token.claims.auth_time;
-				ctx.token.claims.auth_time = staleAuthTime;
-				mutation = "Set auth_time to 30 days ago (stale session)";
-				evidence.originalAuthTime = originalAuthTime ?? null;
-				evidence.newAuthTime = staleAuthTime;
-				break;
-			}
-
-			default:
-				return {
-					applied: false,
-					mutation: `Unknown mode: ${mode}`,
-					evidence: { mode },
-				};
+		const pkce = ctx.endpoint.pkce;
+		if (ctx.endpoint.path !== "/token" || !pkce) {
+			return { applied: false, mutation: "No failed PKCE verification", evidence: {} };
 		}
 
-		evidence.attackType = "pkce-downgrade";
+		ctx.endpoint.actions.ignoreCodeVerifier = true;
 
 		return {
 			applied: true,
-			mutation,
-			evidence,
+			mutation: pkce.verifierPresented
+				? "Accepted a code_verifier that doesn't match the code_challenge"
+				: "Issued tokens without a code_verifier",
+			evidence: {
+				method: pkce.method,
+				verifierPresented: pkce.verifierPresented,
+				clientId: ctx.endpoint.params.client_id ?? null,
+			},
 		};
 	},
 };
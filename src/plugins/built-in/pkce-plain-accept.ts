@@ -0,0 +1,60 @@
+/**
+ * PKCE Plain Accept
+ *
+ * Accepts `code_challenge_method=plain` at the authorization endpoint even
+ * though the baseline requires S256. With plain, the challenge is the
+ * verifier itself, so anyone who observes the authorization request (logs,
+ * browser history, a malicious app on the device) can redeem the code.
+ * Clients that fall back to plain, or never check that S256 is enforced,
+ * lose PKCE's protection against code interception.
+ *
+ * Spec: RFC 7636 Section 4.2 - clients SHOULD use S256; RFC 9700 Section 2.1.1
+ * CWE-757: Selection of Less-Secure Algorithm During Negotiation
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const pkcePlainAccept: MischiefPlugin = {
+	id: "pkce-plain-accept",
+	name: "PKCE Plain Accept",
+	severity: "high",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 7636 Section 4.2",
+		cwe: "CWE-757",
+		description: "Authorization servers SHOULD refuse the plain code challenge method",
+	},
+
+	description: "Accepts the plain PKCE method instead of requiring S256",
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (ctx.endpoint.path !== "/auth") {
+			return { applied: false, mutation: "Not an authorization request", evidence: {} };
+		}
+
+		const { code_challenge: challenge, code_challenge_method: method = "plain" } =
+			ctx.endpoint.params;
+		if (challenge === undefined) {
+			return { applied: false, mutation: "No PKCE challenge", evidence: {} };
+		}
+		if (method !== "plain") {
+			return { applied: false, mutation: `Client used ${method}`, evidence: { method } };
+		}
+
+		ctx.endpoint.actions.acceptPlainPkce = true;
+
+		return {
+			applied: true,
+			mutation: "Accepted plain PKCE code challenge",
+			evidence: {
+				method,
+				methodParamSent: ctx.endpoint.params.code_challenge_method !== undefined,
+				challengeLength: challenge.length,
+			},
+		};
+	},
+};
@@ -0,0 +1,91 @@
+/**
+ * Public Client Secret Accept
+ *
+ * Lets a public client (`token_endpoint_auth_method: none`) through the
+ * token endpoint on terms only a confidential client should get. Modes
+ * (config `mode`):
+ * - secret: accepts whatever client secret the public client presents
+ *   (Basic or form), instead of `401 invalid_client`
+ * - client-credentials: issues client_credentials tokens to the public
+ *   client, instead of `400 unauthorized_client`
+ * - both (default): either of the above
+ *
+ * A public client can't keep a secret, so a "secret" it presents proves
+ * nothing, and a client_credentials token issued to it is a token anyone
+ * holding its client_id can mint. Gateways and policies that grant more to
+ * authenticated or service clients must not trust these tokens.
+ *
+ * Spec: RFC 6749 Section 4.4 - client_credentials MUST only be used by confidential clients
+ * CWE-287: Improper Authentication
+ */
+
+import type { ClientAuthViolation } from "../../core/client-auth.js";
+import type { MischiefPlugin } from "../types.js";
+
+const MODES: Record<string, ClientAuthViolation[]> = {
+	secret: ["public-client-secret"],
+	"client-credentials": ["public-client-credentials"],
+	both: ["public-client-secret", "public-client-credentials"],
+};
+
+export const publicClientSecretAccept: MischiefPlugin = {
+	id: "public-client-secret-accept",
+	name: "Public Client Secret Accept",
+	severity: "high",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 6749 Section 4.4",
+		cwe: "CWE-287",
+		description:
+			"Public clients MUST NOT be issued client_credentials tokens or authenticated by a secret",
+	},
+
+	description: "Accepts a public client's secret or issues it client_credentials tokens",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["secret", "client-credentials", "both"],
+			default: "both",
+			description: "Which confidential-client terms the public client gets",
+		},
+	],
+
+	async apply(ctx) {
+		const check = ctx.endpoint?.clientAuth;
+		if (!ctx.endpoint || check?.violation === undefined) {
+			return { applied: false, mutation: "No public client violation", evidence: {} };
+		}
+
+		const mode = (ctx.config.mode as string | undefined) ?? "both";
+		const accepted = MODES[mode];
+		if (!accepted) {
+			return { applied: false, mutation: `Unknown mode: ${mode}`, evidence: { mode } };
+		}
+		if (!accepted.includes(check.violation)) {
+			return {
+				applied: false,
+				mutation: `Mode ${mode} does not accept ${check.violation}`,
+				evidence: {},
+			};
+		}
+		ctx.endpoint.actions.acceptClientAuth = true;
+
+		return {
+			applied: true,
+			mutation:
+				check.violation === "public-client-secret"
+					? `Accepted a ${check.authMethod} secret from public client ${check.clientId}`
+					: `Issued client_credentials tokens to public client ${check.clientId}`,
+			evidence: {
+				clientId: check.clientId,
+				clientType: check.clientType,
+				authMethod: check.authMethod,
+				grantType: check.grantType,
+				violation: check.violation,
+			},
+		};
+	},
+};
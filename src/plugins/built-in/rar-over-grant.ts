@@ -0,0 +1,144 @@
+/**
+ * RAR Over-Grant
+ *
+ * Rich Authorization Requests (RFC 9396) let a client ask for fine-grained
+ * permissions such as "pay 123.50 EUR to this creditor". Loki normally
+ * grants exactly what was requested; this plugin puts broader details in
+ * the access token's `authorization_details` claim: amounts are multiplied
+ * by `amountFactor` (default 100) and `extraActions` (default "write" and
+ * "delete") are added to every detail that lists actions. Set `grant` to
+ * replace the granted details outright. The token response keeps reporting
+ * the requested details, so only a resource server that checks the token's
+ * claim against the operation catches the over-grant.
+ *
+ * Tokens are re-signed with Loki's key.
+ *
+ * Spec: RFC 9396 Section 7 - the granted authorization details
+ * CWE-863: Incorrect Authorization
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type Detail = Record<string, unknown>;
+
+export const rarOverGrant: MischiefPlugin = {
+	id: "rar-over-grant",
+	name: "RAR Over-Grant",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 9396 Section 7",
+		cwe: "CWE-863",
+		description: "Resource servers MUST enforce the granted authorization_details, not trust them",
+	},
+
+	description: "Grants broader authorization_details than the client requested",
+
+	options: [
+		{
+			name: "amountFactor",
+			type: "number",
+			default: 100,
+			description: "What granted amounts are multiplied by",
+		},
+		{
+			name: "extraActions",
+			type: "array",
+			default: ["write", "delete"],
+			description: "Actions added to every detail that lists actions",
+		},
+		{
+			name: "grant",
+			type: "array",
+			description: "authorization_details granted instead, replacing the requested ones",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const { claims } = ctx.token;
+		const requested = claims.authorization_details;
+		const replacement = ctx.config.grant;
+		let granted: unknown;
+
+		if (Array.isArray(replacement)) {
+			granted = replacement;
+		} else if (Array.isArray(requested)) {
+			const factor = (ctx.config.amountFactor as number | undefined) ?? 100;
+			const extraActions = (ctx.config.extraActions as string[] | undefined) ?? ["write", "delete"];
+			granted = requested.map((detail: Detail) => broaden(detail, factor, extraActions));
+		} else {
+			return {
+				applied: false,
+				mutation: "No authorization_details granted and no grant configured",
+				evidence: {},
+			};
+		}
+
+		if (JSON.stringify(granted) === JSON.stringify(requested)) {
+			return {
+				applied: false,
+				mutation: "Nothing in the requested details to broaden",
+				evidence: { requested },
+			};
+		}
+
+		claims.authorization_details = granted;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: Array.isArray(replacement)
+				? "Replaced the granted authorization_details"
+				: "Granted larger amounts and extra actions than requested",
+			evidence: { requested: requested ?? null, granted },
+		};
+	},
+};
+
+/**
+ * A copy of the detail with a multiplied `instructedAmount.amount` and extra actions
+ */
+function broaden(detail: Detail, factor: number, extraActions: string[]): Detail {
+	const broadened: Detail = { ...detail };
+
+	const instructed = detail.instructedAmount as Detail | undefined;
+	if (instructed && typeof instructed === "object") {
+		const amount = multiply(instructed.amount, factor);
+		if (amount !== undefined) {
+			broadened.instructedAmount = { ...instructed, amount };
+		}
+	}
+
+	if (Array.isArray(detail.actions)) {
+		const actions = [...detail.actions];
+		for (const action of extraActions) {
+			if (!actions.includes(action)) {
+				actions.push(action);
+			}
+		}
+		broadened.actions = actions;
+	}
+
+	return broadened;
+}
+
+/**
+ * Multiply an amount given as a number or decimal string, keeping its form
+ */
+function multiply(amount: unknown, factor: number): unknown {
+	if (typeof amount === "number") {
+		return amount * factor;
+	}
+	if (typeof amount === "string" && /^\d+(\.\d+)?$/.test(amount)) {
+		const decimals = amount.split(".")[1]?.length ?? 0;
+		return (Number(amount) * factor).toFixed(decimals);
+	}
+	return undefined;
+}
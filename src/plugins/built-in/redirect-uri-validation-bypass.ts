@@ -0,0 +1,101 @@
+/**
+ * Redirect URI Validation Bypass
+ *
+ * Accepts a `redirect_uri` the client never registered. Loki normally
+ * compares it to the registered URIs as plain strings and refuses a
+ * mismatch with `400 invalid_redirect_uri`; with this plugin the login,
+ * consent and authorization code all go to the unregistered URI instead,
+ * the open redirect an attacker uses to steal codes. Clients, and proxies
+ * in front of them, that only ever expect responses at their own callback
+ * should not have to rely on the IdP's matching alone.
+ *
+ * Config:
+ * - match: which unregistered URIs to accept: any (default), prefix (those
+ *   starting with a registered URI, e.g. `/callback/../evil` or
+ *   `/callback.evil.example`), or origin (those on a registered URI's
+ *   scheme, host and port, any path)
+ *
+ * The requested and registered URIs are recorded in the evidence.
+ *
+ * Spec: RFC 9700 Section 4.1.3 - redirect URIs MUST be compared by exact string matching
+ * CWE-601: URL Redirection to Untrusted Site ('Open Redirect')
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type RedirectMatch = "any" | "prefix" | "origin";
+
+const MATCHES: RedirectMatch[] = ["any", "prefix", "origin"];
+
+export const redirectUriValidationBypass: MischiefPlugin = {
+	id: "redirect-uri-validation-bypass",
+	name: "Redirect URI Validation Bypass",
+	severity: "critical",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 9700 Section 4.1.3",
+		cwe: "CWE-601",
+		description: "Authorization servers MUST compare redirect URIs by exact string matching",
+	},
+
+	description: "Accepts and redirects to a redirect_uri the client never registered",
+
+	options: [
+		{
+			name: "match",
+			type: "string",
+			values: MATCHES,
+			default: "any",
+			description: "Which unregistered redirect URIs are accepted",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		const check = ctx.endpoint.path === "/auth" ? ctx.endpoint.redirectUri : undefined;
+		if (!check) {
+			return { applied: false, mutation: "Redirect URI is registered", evidence: {} };
+		}
+
+		const match = ctx.config.match ?? "any";
+		if (!MATCHES.includes(match as RedirectMatch)) {
+			return {
+				applied: false,
+				mutation: `match must be one of ${MATCHES.join(", ")}`,
+				evidence: { match },
+			};
+		}
+		const evidence = { requested: check.requested, registered: check.registered, match };
+		if (!laxMatch(match as RedirectMatch, check.registered, check.requested)) {
+			return { applied: false, mutation: `Redirect URI doesn't ${match}-match`, evidence };
+		}
+
+		ctx.endpoint.actions.acceptUnregisteredRedirectUri = true;
+
+		return {
+			applied: true,
+			mutation: `Accepted unregistered redirect_uri ${check.requested}`,
+			evidence,
+		};
+	},
+};
+
+function laxMatch(match: RedirectMatch, registered: string[], requested: string): boolean {
+	switch (match) {
+		case "any":
+			return true;
+		case "prefix":
+			return registered.some((uri) => requested.startsWith(uri));
+		case "origin": {
+			const origin = URL.canParse(requested) ? new URL(requested).origin : "null";
+			// Opaque origins ("null") never match
+			return (
+				origin !== "null" &&
+				registered.some((uri) => URL.canParse(uri) && new URL(uri).origin === origin)
+			);
+		}
+	}
+}
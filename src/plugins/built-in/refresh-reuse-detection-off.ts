@@ -0,0 +1,53 @@
+/**
+ * Refresh Reuse Detection Off
+ *
+ * Silently accepts a refresh token the session has already rotated. By
+ * default Loki rotates opaque refresh tokens on every use and a rotated
+ * token presented again makes the provider revoke the whole grant; with
+ * this plugin Loki instead redeems the chain's current token, so a stolen
+ * refresh token keeps working alongside the legitimate one. Clients and
+ * gateways that implement their own reuse detection can check they notice.
+ *
+ * Spec: RFC 9700 Section 4.14.2 - refresh token rotation and reuse detection
+ * CWE-294: Authentication Bypass by Capture-replay
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const refreshReuseDetectionOff: MischiefPlugin = {
+	id: "refresh-reuse-detection-off",
+	name: "Refresh Reuse Detection Off",
+	severity: "high",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 9700 Section 4.14.2",
+		cwe: "CWE-294",
+		description:
+			"Reuse of a rotated refresh token should revoke the grant rather than issue new tokens",
+	},
+
+	description: "Silently accepts reuse of a rotated refresh token",
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (ctx.endpoint.path !== "/token" || ctx.endpoint.params.grant_type !== "refresh_token") {
+			return { applied: false, mutation: "Not a refresh grant", evidence: {} };
+		}
+		if (!ctx.endpoint.refreshTokenReused) {
+			return { applied: false, mutation: "Refresh token not reused", evidence: {} };
+		}
+
+		ctx.endpoint.actions.acceptRefreshReuse = true;
+
+		return {
+			applied: true,
+			mutation: "Accepted reuse of a rotated refresh token",
+			evidence: {
+				clientId: ctx.endpoint.params.client_id,
+			},
+		};
+	},
+};
@@ -0,0 +1,63 @@
+/**
+ * Request ID Mismatch
+ *
+ * Echoes a different `X-Request-ID` on the token response than the one the
+ * request carried (or Loki generated for it). The response is otherwise
+ * untouched and valid. Clients that match responses to requests, retry
+ * idempotently or deduplicate by correlation ID should notice the mismatch
+ * instead of filing the tokens under another request.
+ *
+ * Config:
+ * - value: The request ID to echo (default: a freshly generated one)
+ *
+ * Both IDs are recorded in the evidence; the trace of the real request is
+ * at `GET /admin/requests/:requestId`.
+ *
+ * Spec: RFC 6749 Section 5.1 - Successful Response
+ * CWE-345: Insufficient Verification of Data Authenticity
+ */
+
+import { REQUEST_ID_HEADER, newRequestId } from "../../core/request-id.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const requestIdMismatch: MischiefPlugin = {
+	id: "request-id-mismatch",
+	name: "Request ID Mismatch",
+	severity: "medium",
+	phase: "response",
+
+	spec: {
+		rfc: "RFC 6749 Section 5.1",
+		cwe: "CWE-345",
+		description: "Clients must not trust a correlation ID echoed back to identify the request",
+	},
+
+	description: "Echoes a different X-Request-ID than the request carried",
+
+	options: [
+		{
+			name: "value",
+			type: "string",
+			description: "The request ID echoed (default: a freshly generated one)",
+		},
+	],
+
+	async apply(ctx) {
+		const received = ctx.response?.requestId;
+		if (!ctx.response || received === undefined) {
+			return { applied: false, mutation: "No request ID to echo", evidence: {} };
+		}
+
+		let echoed = (ctx.config.value as string | undefined) ?? newRequestId();
+		if (echoed === received) {
+			echoed = newRequestId();
+		}
+		ctx.response.headers[REQUEST_ID_HEADER] = echoed;
+
+		return {
+			applied: true,
+			mutation: `Echoed ${REQUEST_ID_HEADER} ${echoed} for request ${received}`,
+			evidence: { receivedRequestId: received, echoedRequestId: echoed },
+		};
+	},
+};
@@ -0,0 +1,54 @@
+/**
+ * Request Object Replay
+ *
+ * Accepts a signed request object (JAR) whose `jti` the session has already
+ * used. By default Loki treats request objects as single-use and refuses a
+ * replay with `invalid_request_object`; with this plugin a captured
+ * `request` parameter can restart the same authorization. Clients that rely
+ * on request-object single-use to prevent authorization request replay can
+ * check the IdP actually enforces it.
+ *
+ * Spec: RFC 9101 Section 10.8 - request object replay
+ * CWE-294: Authentication Bypass by Capture-replay
+ */
+
+import { requestObjectJti } from "../../core/request-object.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const requestObjectReplay: MischiefPlugin = {
+	id: "request-object-replay",
+	name: "Request Object Replay",
+	severity: "high",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 9101 Section 10.8",
+		cwe: "CWE-294",
+		description: "Authorization servers should reject replayed request objects",
+	},
+
+	description: "Accepts a replayed signed request object",
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (ctx.endpoint.path !== "/auth" || ctx.endpoint.params.request === undefined) {
+			return { applied: false, mutation: "No request object", evidence: {} };
+		}
+		if (!ctx.endpoint.requestObjectReplayed) {
+			return { applied: false, mutation: "Request object not replayed", evidence: {} };
+		}
+
+		ctx.endpoint.actions.acceptRequestObjectReplay = true;
+
+		return {
+			applied: true,
+			mutation: "Accepted replayed request object",
+			evidence: {
+				jti: requestObjectJti(ctx.endpoint.params.request),
+				clientId: ctx.endpoint.params.client_id,
+			},
+		};
+	},
+};
@@ -0,0 +1,111 @@
+/**
+ * Response Field Injection
+ *
+ * Adds unexpected top-level fields to the /token JSON response: an
+ * `id_token` that wasn't requested, a rogue `access_token2`, a `redirect`
+ * URL. The legitimate fields are left untouched and valid. Clients that
+ * loop over response fields, or act on extension fields they don't
+ * understand, pick up attacker-controlled values.
+ *
+ * Config:
+ * - extraFields: Object of fields to inject, replacing the defaults
+ *
+ * Fields already present in the response are never overwritten.
+ *
+ * Spec: RFC 6749 Section 5.1 - clients MUST ignore unrecognized response parameters
+ * CWE-20: Improper Input Validation
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const responseFieldInjection: MischiefPlugin = {
+	id: "response-field-injection",
+	name: "Response Field Injection",
+	severity: "high",
+	phase: "response",
+
+	spec: {
+		rfc: "RFC 6749 Section 5.1",
+		cwe: "CWE-20",
+		description: "Clients MUST ignore unrecognized value names in token responses",
+	},
+
+	description: "Injects unexpected top-level fields into the token response",
+
+	options: [
+		{
+			name: "extraFields",
+			type: "object",
+			description: "Fields injected into the response, replacing the defaults",
+		},
+	],
+
+	async apply(ctx) {
+		const body = ctx.response?.body;
+		if (!ctx.response || typeof body !== "object" || body === null || Array.isArray(body)) {
+			return { applied: false, mutation: "No token response body", evidence: {} };
+		}
+		const response = body as Record<string, unknown>;
+
+		const extraFields =
+			(ctx.config.extraFields as Record<string, unknown> | undefined) ?? defaultFields(response);
+		const injected: Record<string, unknown> = {};
+		const skipped: string[] = [];
+
+		for (const [name, value] of Object.entries(extraFields)) {
+			if (name in response) {
+				skipped.push(name);
+				continue;
+			}
+			injected[name] = value;
+		}
+
+		if (Object.keys(injected).length === 0) {
+			return { applied: false, mutation: "All injected fields already present", evidence: {} };
+		}
+
+		ctx.response.body = { ...response, ...injected };
+
+		return {
+			applied: true,
+			mutation: `Injected response fields: ${Object.keys(injected).join(", ")}`,
+			evidence: {
+				injected,
+				skipped,
+			},
+		};
+	},
+};
+
+/**
+ * Default rogue fields: an unrequested unsigned id_token, a second access token, a redirect
+ */
+function defaultFields(response: Record<string, unknown>): Record<string, unknown> {
+	const now = Math.floor(Date.now() / 1000);
+	const claims = {
+		iss: claimFrom(response.access_token, "iss") ?? "https://loki.test",
+		sub: "loki-injected-subject",
+		aud: claimFrom(response.access_token, "client_id") ?? "loki-client",
+		iat: now,
+		exp: now + 3600,
+	};
+	const encode = (value: unknown) => Buffer.from(JSON.stringify(value)).toString("base64url");
+
+	return {
+		id_token: `${encode({ alg: "none", typ: "JWT" })}.${encode(claims)}.`,
+		access_token2: `loki-rogue-${now.toString(36)}`,
+		redirect: "https://attacker.example/callback",
+	};
+}
+
+function claimFrom(token: unknown, claim: string): unknown {
+	if (typeof token !== "string" || token.split(".").length !== 3) {
+		return undefined;
+	}
+	try {
+		const payload = JSON.parse(Buffer.from(token.split(".")[1] ?? "", "base64url").toString());
+		return payload[claim];
+	} catch {
+		return undefined;
+	}
+}
@@ -0,0 +1,94 @@
+/**
+ * Response Mode Downgrade
+ *
+ * Ignores the `response_mode` the client asked for at the authorization
+ * endpoint and delivers the response in another one: by default the query
+ * string, where the authorization code ends up in browser history, server
+ * logs and Referer headers. A client that asked for `fragment` or
+ * `form_post` should only accept the response the way it asked for it;
+ * one whose callback happily reads the code from wherever it finds it
+ * can't rely on the mode's protection.
+ *
+ * Config:
+ * - mode: the mode to deliver in instead (query, fragment or form_post;
+ *   default: query)
+ *
+ * The query mode can't carry tokens, so response types returning them are
+ * left alone when downgrading to it.
+ *
+ * Spec: OAuth 2.0 Form Post Response Mode, Section 2; OAuth 2.0 Multiple
+ * Response Type Encoding Practices, Section 2.1
+ * CWE-598: Use of GET Request Method With Sensitive Query Strings
+ */
+
+import { RESPONSE_MODES, isResponseMode, modeCarries } from "../../core/response-mode.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const responseModeDowngrade: MischiefPlugin = {
+	id: "response-mode-downgrade",
+	name: "Response Mode Downgrade",
+	severity: "medium",
+	phase: "endpoint",
+
+	spec: {
+		oidc: "OAuth 2.0 Form Post Response Mode, Section 2",
+		cwe: "CWE-598",
+		description: "The authorization response is returned in the response_mode requested",
+	},
+
+	description: "Ignores the requested response_mode and returns the code in the query string",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["query", "fragment", "form_post"],
+			default: "query",
+			description: "The response mode delivered in instead of the requested one",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (ctx.endpoint.path !== "/auth") {
+			return { applied: false, mutation: "Not an authorization request", evidence: {} };
+		}
+
+		const mode = ctx.config.mode ?? "query";
+		if (!isResponseMode(mode)) {
+			return {
+				applied: false,
+				mutation: `mode must be one of ${RESPONSE_MODES.join(", ")}`,
+				evidence: { mode },
+			};
+		}
+		const { response_mode: requested, response_type: responseType } = ctx.endpoint.params;
+		if (requested === undefined) {
+			return { applied: false, mutation: "No response_mode requested", evidence: {} };
+		}
+		if (requested === mode) {
+			return {
+				applied: false,
+				mutation: `Client already asked for response_mode=${mode}`,
+				evidence: { requested },
+			};
+		}
+		if (!modeCarries(mode, responseType)) {
+			return {
+				applied: false,
+				mutation: `response_type '${responseType}' returns tokens, which ${mode} can't carry`,
+				evidence: { requested, responseType: responseType ?? null },
+			};
+		}
+
+		ctx.endpoint.actions.responseMode = mode;
+
+		return {
+			applied: true,
+			mutation: `Ignored response_mode=${requested} and responded in ${mode} mode`,
+			evidence: { requested, served: mode, responseType: responseType ?? null },
+		};
+	},
+};
@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const responseModeMismatch: MischiefPlugin = {
@@ -18,7 +19,7 @@ export const responseModeMismatch: MischiefPlugin = {
 		}
 
 		const modes = ["query", "fragment", "form_post"];
-		const selectedMode = modes[Math.floor(Math.random() * modes.length)] ?? "query";
+		const selectedMode = modes[randomInt(modes.length)] ?? "query";
 
 		ctx.token.claims.delivered_via = selectedMode;
 		ctx.token.claims.expected_mode = "code";
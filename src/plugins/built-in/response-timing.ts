@@ -0,0 +1,158 @@
+/**
+ * Response Timing - timing side-channel modelling
+ *
+ * Pads or skews how long /token and /token/introspection take to answer,
+ * depending on whether the presented credential or token was valid. Lets
+ * clients and resource servers be tested against an upstream that leaks
+ * validity through timing, and gives them a constant-time baseline to
+ * compare their own behaviour against.
+ *
+ * Modes:
+ * - constant: Every response padded to `targetMs` total (default 250)
+ * - variable: Invalid answers return after `invalidDelayMs` (default 0), valid
+ *   ones after `validDelayMs` (default 150) - models an early-exit comparison
+ * - random: Uniform random delay between `minMs` (default 0) and `maxMs` (default 300)
+ *
+ * Spec: RFC 7662 Section 4 - introspection responses must not leak token state
+ * CWE-208: Observable Timing Discrepancy
+ */
+
+import { random } from "../../core/random.js";
+import type { EndpointContext, MischiefPlugin } from "../types.js";
+
+type TimingMode = "constant" | "variable" | "random";
+
+/** Endpoints whose timing can reveal credential or token validity */
+const TIMED_PATHS = ["/token", "/token/introspection"];
+
+export const responseTiming: MischiefPlugin = {
+	id: "response-timing",
+	name: "Response Timing Side-Channel",
+	severity: "medium",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 7662 Section 4",
+		cwe: "CWE-208",
+		description: "Response timing MUST NOT reveal whether a credential or token was valid",
+	},
+
+	description: "Normalizes or skews /token and /introspect timing based on validity",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["constant", "variable", "random"],
+			default: "constant",
+			description: "How response times are shaped",
+		},
+		{
+			name: "targetMs",
+			type: "number",
+			default: 250,
+			description: "Total time every response is padded to in constant mode",
+		},
+		{
+			name: "validDelayMs",
+			type: "number",
+			default: 150,
+			description: "Delay before valid answers in variable mode",
+		},
+		{
+			name: "invalidDelayMs",
+			type: "number",
+			default: 0,
+			description: "Delay before invalid answers in variable mode",
+		},
+		{
+			name: "minMs",
+			type: "number",
+			default: 0,
+			description: "Shortest random delay",
+		},
+		{
+			name: "maxMs",
+			type: "number",
+			default: 300,
+			description: "Longest random delay",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (!TIMED_PATHS.includes(ctx.endpoint.path)) {
+			return { applied: false, mutation: "Not a token or introspection request", evidence: {} };
+		}
+		if (ctx.endpoint.status === 0) {
+			// Loki consulted endpoint mischief before the provider answered
+			return { applied: false, mutation: "No response yet", evidence: {} };
+		}
+
+		const mode = (ctx.config.mode as TimingMode | undefined) ?? "constant";
+		const valid = isValid(ctx.endpoint);
+		let mutation: string;
+
+		switch (mode) {
+			case "constant": {
+				const targetMs = (ctx.config.targetMs as number | undefined) ?? 250;
+				ctx.endpoint.actions.responsePadToMs = targetMs;
+				mutation = `Padded response to ${targetMs}ms regardless of validity`;
+				break;
+			}
+
+			case "variable": {
+				const delayMs = valid
+					? ((ctx.config.validDelayMs as number | undefined) ?? 150)
+					: ((ctx.config.invalidDelayMs as number | undefined) ?? 0);
+				ctx.endpoint.actions.responseDelayMs = delayMs;
+				mutation = `Delayed ${valid ? "valid" : "invalid"} response by ${delayMs}ms`;
+				break;
+			}
+
+			case "random": {
+				const minMs = (ctx.config.minMs as number | undefined) ?? 0;
+				const maxMs = (ctx.config.maxMs as number | undefined) ?? 300;
+				const delayMs = Math.round(minMs + random() * Math.max(0, maxMs - minMs));
+				ctx.endpoint.actions.responseDelayMs = delayMs;
+				mutation = `Delayed response by a random ${delayMs}ms`;
+				break;
+			}
+
+			default:
+				return {
+					applied: false,
+					mutation: `Unknown mode: ${mode}`,
+					evidence: { mode },
+				};
+		}
+
+		return {
+			applied: true,
+			mutation,
+			evidence: {
+				mode,
+				path: ctx.endpoint.path,
+				valid,
+				status: ctx.endpoint.status,
+				responseDelayMs: ctx.endpoint.actions.responseDelayMs,
+				responsePadToMs: ctx.endpoint.actions.responsePadToMs,
+			},
+		};
+	},
+};
+
+/**
+ * Whether the provider accepted the credential (token) or the token (introspection)
+ */
+function isValid(endpoint: EndpointContext): boolean {
+	if (endpoint.status !== 200) {
+		return false;
+	}
+	if (endpoint.path === "/token/introspection") {
+		return endpoint.response?.active === true;
+	}
+	return true;
+}
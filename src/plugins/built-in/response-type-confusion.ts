@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const responseTypeConfusion: MischiefPlugin = {
@@ -41,9 +42,7 @@ export const responseTypeConfusion: MischiefPlugin = {
 			},
 		];
 
-		const selectedAttack = attacks[
-			Math.floor(Math.random() * attacks.length)
-		] as (typeof attacks)[0];
+		const selectedAttack = attacks[randomInt(attacks.length)] as (typeof attacks)[0];
 		selectedAttack.apply();
 
 		return {
@@ -0,0 +1,54 @@
+/**
+ * Revocation Ignored
+ *
+ * Loki's revocation endpoint (/revoke) answers 200 as usual, but the token
+ * is never revoked: introspection keeps reporting it active and it stays
+ * off the revocation list. A client that treats a successful revocation
+ * as proof the token is dead - on logout, say - leaves a live token
+ * behind; one that checks introspection afterwards notices.
+ *
+ * Spec: RFC 7009 Section 2.2 - the token MUST be invalidated once the server responds 200
+ * CWE-613: Insufficient Session Expiration
+ */
+
+import { REVOCATION_PATH, tokenIdentifier } from "../../core/revocation-list.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const revocationIgnored: MischiefPlugin = {
+	id: "revocation-ignored",
+	name: "Revocation Ignored",
+	severity: "high",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 7009 Section 2.2",
+		cwe: "CWE-613",
+		description: "A token MUST be invalidated once revocation reports success",
+	},
+
+	description: "Answers /revoke with 200 but leaves the token active",
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (ctx.endpoint.path !== REVOCATION_PATH || ctx.endpoint.status !== 200) {
+			return { applied: false, mutation: "Not a successful revocation", evidence: {} };
+		}
+		const token = ctx.endpoint.params.token;
+		if (!token) {
+			return { applied: false, mutation: "No token to revoke", evidence: {} };
+		}
+
+		ctx.endpoint.actions.revocationIgnored = true;
+
+		return {
+			applied: true,
+			mutation: "Revocation reported success but the token was left active",
+			evidence: {
+				jti: tokenIdentifier(token),
+				tokenTypeHint: ctx.endpoint.params.token_type_hint ?? null,
+			},
+		};
+	},
+};
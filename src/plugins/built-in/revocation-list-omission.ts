@@ -0,0 +1,98 @@
+/**
+ * Revocation List Omission Attack
+ *
+ * The revocation endpoint reports success, but the revoked token never
+ * appears in the published revocation list (/revocations) - or only appears
+ * after a long delay. Resource servers that poll the list instead of
+ * introspecting keep accepting the revoked token.
+ *
+ * Modes:
+ * - omit: The token is never listed (default)
+ * - delay: The token is listed only after `delaySeconds` (default 300)
+ *
+ * Spec: RFC 7009 Section 2.2 - a revoked token MUST be invalidated promptly
+ * CWE-613: Insufficient Session Expiration
+ */
+
+import { REVOCATION_PATH, tokenIdentifier } from "../../core/revocation-list.js";
+import type { MischiefPlugin } from "../types.js";
+
+type OmissionMode = "omit" | "delay";
+
+export const revocationListOmission: MischiefPlugin = {
+	id: "revocation-list-omission",
+	name: "Revocation List Omission",
+	severity: "high",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 7009 Section 2.2",
+		cwe: "CWE-613",
+		description: "A successfully revoked token MUST no longer be accepted by resource servers",
+	},
+
+	description: "Leaves revoked tokens off the published revocation list",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["omit", "delay"],
+			default: "omit",
+			description: "Whether the revoked token is never listed or listed late",
+		},
+		{
+			name: "delaySeconds",
+			type: "number",
+			default: 300,
+			description: "Seconds before the token is listed in delay mode",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		const { path } = ctx.endpoint;
+		const revocation = path.endsWith("/revocation") || path === REVOCATION_PATH;
+		if (!revocation || ctx.endpoint.status !== 200) {
+			return { applied: false, mutation: "Not a successful revocation", evidence: {} };
+		}
+
+		const mode = (ctx.config.mode as OmissionMode | undefined) ?? "omit";
+		let listAfterSeconds: number | null;
+		let mutation: string;
+
+		switch (mode) {
+			case "omit":
+				listAfterSeconds = null;
+				mutation = "Revocation reported success but token omitted from revocation list";
+				break;
+
+			case "delay":
+				listAfterSeconds = (ctx.config.delaySeconds as number | undefined) ?? 300;
+				mutation = `Revoked token withheld from revocation list for ${listAfterSeconds}s`;
+				break;
+
+			default:
+				return {
+					applied: false,
+					mutation: `Unknown mode: ${mode}`,
+					evidence: { mode },
+				};
+		}
+
+		ctx.endpoint.actions.revocationListAfterSeconds = listAfterSeconds;
+
+		return {
+			applied: true,
+			mutation,
+			evidence: {
+				mode,
+				jti: tokenIdentifier(ctx.endpoint.params.token ?? ""),
+				tokenTypeHint: ctx.endpoint.params.token_type_hint,
+				listAfterSeconds,
+			},
+		};
+	},
+};
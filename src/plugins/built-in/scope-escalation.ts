@@ -0,0 +1,112 @@
+/**
+ * Scope Escalation
+ *
+ * Grants an access token scopes beyond the ones it was granted: the
+ * configured `scopes` (default `admin`) are added to its `scope` claim and
+ * the token is re-signed with Loki's key. The token response's `scope` and
+ * introspection keep reporting what was actually granted, so a resource
+ * server that authorizes by the grant refuses the extra scopes, and one
+ * that trusts the token's claim alone lets them through.
+ *
+ * Config:
+ * - scopes: the scopes to add, space-delimited or an array (default: admin)
+ *
+ * Spec: RFC 6749 Section 3.3 - the authorization server may grant fewer
+ * scopes than requested, never more; RFC 9068 Section 4 - resource servers
+ * enforce the token's scope
+ * CWE-269: Improper Privilege Management
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+const DEFAULT_SCOPES = ["admin"];
+
+/** RFC 6749 Section 3.3: scope-token = 1*( %x21 / %x23-5B / %x5D-7E ) */
+const SCOPE_TOKEN = /^[\x21\x23-\x5b\x5d-\x7e]+$/;
+
+export const scopeEscalation: MischiefPlugin = {
+	id: "scope-escalation",
+	name: "Scope Escalation",
+	severity: "critical",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 6749 Section 3.3",
+		cwe: "CWE-269",
+		description: "Access must be authorized by the scope granted, not extra scopes a token claims",
+	},
+
+	description: "Adds scopes the access token was never granted, validly signed",
+
+	options: [
+		{
+			name: "scopes",
+			type: ["string", "array"],
+			default: DEFAULT_SCOPES,
+			description: "The scopes added, space-delimited or an array",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		if (ctx.token.tokenType === "id_token") {
+			return { applied: false, mutation: "ID tokens carry no scope", evidence: {} };
+		}
+
+		const scopes = escalatedScopes(ctx.config.scopes);
+		if (!scopes) {
+			return {
+				applied: false,
+				mutation: "scopes must be a non-empty space-delimited string or array of strings",
+				evidence: { scopes: ctx.config.scopes },
+			};
+		}
+
+		const { claims } = ctx.token;
+		const grantedScope = typeof claims.scope === "string" ? claims.scope : "";
+		const granted = grantedScope.split(" ").filter(Boolean);
+		const added = scopes.filter((scope) => !granted.includes(scope));
+		if (added.length === 0) {
+			return {
+				applied: false,
+				mutation: "Every escalated scope is already granted",
+				evidence: { grantedScope, scopes },
+			};
+		}
+		const scope = [...granted, ...added].join(" ");
+		claims.scope = scope;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Added ungranted scopes: ${added.join(" ")}`,
+			evidence: {
+				grantedScope,
+				scope,
+				added,
+				signatureValid: ctx.token.resign !== undefined,
+			},
+		};
+	},
+};
+
+/**
+ * The configured scopes, or undefined if they aren't valid scope tokens
+ */
+function escalatedScopes(config: unknown): string[] | undefined {
+	if (config === undefined) {
+		return DEFAULT_SCOPES;
+	}
+	const scopes = typeof config === "string" ? config.split(" ").filter(Boolean) : config;
+	if (!Array.isArray(scopes) || scopes.length === 0) {
+		return undefined;
+	}
+	if (!scopes.every((scope) => typeof scope === "string" && SCOPE_TOKEN.test(scope))) {
+		return undefined;
+	}
+	return [...new Set(scopes as string[])];
+}
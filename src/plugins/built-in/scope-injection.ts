@@ -35,6 +35,28 @@ export const scopeInjectionPlugin: MischiefPlugin = {
 
 	description: "Manipulates scope claim to test privilege validation",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["inject", "replace", "admin", "remove"],
+			default: "inject",
+			description: "How the scope claim is manipulated",
+		},
+		{
+			name: "injectScopes",
+			type: "string",
+			default: "admin write:all delete:all",
+			description: "The scopes added in inject mode",
+		},
+		{
+			name: "replaceScope",
+			type: "string",
+			default: "openid profile email admin:* system:*",
+			description: "The scope set in replace mode",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
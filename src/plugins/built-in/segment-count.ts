@@ -0,0 +1,132 @@
+/**
+ * Segment Count
+ *
+ * Sends tokens with the wrong number of dot-separated segments: a JWS cut
+ * to `header.payload`, or one with a trailing `header.payload.signature.extra`.
+ * Every segment left is base64url as issued, and extra ones are random
+ * base64url, so only the count is wrong. A client must reject anything
+ * but the three segments of a compact JWS, or the five of a compact JWE;
+ * validators that split on `.` and index into the result can read past
+ * the end or ignore what follows the signature.
+ *
+ * Config:
+ * - segments: how many segments to emit (default 2); fewer drops trailing
+ *   segments, more appends random ones
+ * - tokens: which tokens to alter: access_token, id_token or both (default)
+ *
+ * Runs on the token response, after signing and ID token encryption, so an
+ * encrypted ID token is cut from (or added to) its five JWE segments. A
+ * token that already has the configured count is left alone. The evidence
+ * records each altered token's original and emitted segment count.
+ *
+ * Spec: RFC 7515 Section 7.1 - a compact JWS has three parts; RFC 7516
+ * Section 7.1 - a compact JWE has five
+ * CWE-20: Improper Input Validation
+ */
+
+import { randomBytes } from "../../core/random.js";
+import type { MischiefPlugin } from "../types.js";
+
+type SegmentTokens = "access_token" | "id_token" | "both";
+
+const TOKENS: SegmentTokens[] = ["access_token", "id_token", "both"];
+
+const DEFAULT_SEGMENTS = 2;
+
+export const segmentCount: MischiefPlugin = {
+	id: "segment-count",
+	name: "Segment Count",
+	severity: "medium",
+	phase: "response",
+
+	spec: {
+		rfc: "RFC 7515 Section 7.1",
+		cwe: "CWE-20",
+		description: "A compact JWS has exactly three base64url parts, and a compact JWE five",
+	},
+
+	description: "Emits tokens with too few or too many dot-separated segments",
+
+	options: [
+		{
+			name: "segments",
+			type: "integer",
+			default: DEFAULT_SEGMENTS,
+			description: "How many dot-separated segments each token is emitted with",
+		},
+		{
+			name: "tokens",
+			type: "string",
+			values: TOKENS,
+			default: "both",
+			description: "Which tokens are altered",
+		},
+	],
+
+	async apply(ctx) {
+		const body = ctx.response?.body;
+		if (!ctx.response || typeof body !== "object" || body === null || Array.isArray(body)) {
+			return { applied: false, mutation: "No token response body", evidence: {} };
+		}
+
+		const segments = ctx.config.segments ?? DEFAULT_SEGMENTS;
+		if (!(Number.isInteger(segments) && (segments as number) >= 1)) {
+			return {
+				applied: false,
+				mutation: "segments must be a positive integer",
+				evidence: { segments },
+			};
+		}
+		const tokens = ctx.config.tokens ?? "both";
+		if (!TOKENS.includes(tokens as SegmentTokens)) {
+			return {
+				applied: false,
+				mutation: `tokens must be one of ${TOKENS.join(", ")}`,
+				evidence: { tokens },
+			};
+		}
+
+		const response = { ...(body as Record<string, unknown>) };
+		const altered: { token: string; originalSegments: number; segments: number }[] = [];
+		for (const field of ["access_token", "id_token"]) {
+			const token = response[field];
+			if ((tokens !== "both" && tokens !== field) || typeof token !== "string") {
+				continue;
+			}
+			const parts = token.split(".");
+			// Opaque tokens have no segments to miscount
+			if (parts.length < 3 || parts.length === segments) {
+				continue;
+			}
+			response[field] = resize(parts, segments as number).join(".");
+			altered.push({ token: field, originalSegments: parts.length, segments: segments as number });
+		}
+
+		if (altered.length === 0) {
+			return {
+				applied: false,
+				mutation: `No JWT to emit with ${segments} segments`,
+				evidence: { segments },
+			};
+		}
+
+		ctx.response.body = response;
+		const how = altered.map((a) => `${a.token} ${a.originalSegments} → ${a.segments}`).join(", ");
+		return {
+			applied: true,
+			mutation: `Changed segment count: ${how}`,
+			evidence: { tokens: altered },
+		};
+	},
+};
+
+/**
+ * Cut segments to `count`, or pad them with random base64url segments
+ */
+function resize(parts: string[], count: number): string[] {
+	const resized = parts.slice(0, count);
+	while (resized.length < count) {
+		resized.push(randomBytes(32).toString("base64url"));
+	}
+	return resized;
+}
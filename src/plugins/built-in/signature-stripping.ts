@@ -0,0 +1,54 @@
+/**
+ * Signature Stripping
+ *
+ * Keeps the token's real `alg` (RS256, ES256, ...) and everything else in
+ * the header and claims, but empties the signature segment, so the token
+ * is exactly `<header>.<payload>.` - still three segments, the trailing dot
+ * intact. Unlike alg-none, nothing in the header admits the token is
+ * unsigned: a validator that only rejects `alg: none`, or that treats an
+ * empty signature as "nothing to check", accepts it.
+ *
+ * Spec: RFC 7515 Section 5.2 - the JWS Signature must be validated for the alg
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+export const signatureStripping: MischiefPlugin = {
+	id: "signature-stripping",
+	name: "Signature Stripping",
+	severity: "critical",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 7515 Section 5.2",
+		cwe: "CWE-347",
+		description: "An empty signature is invalid whatever the alg header claims",
+	},
+
+	description: "Empties the signature segment while keeping a real alg in the header",
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const alg = ctx.token.header.alg;
+		if (alg === "none") {
+			return { applied: false, mutation: "Token is already unsigned", evidence: { alg } };
+		}
+
+		const strippedLength = ctx.token.signature.length;
+		ctx.token.signature = "";
+
+		return {
+			applied: true,
+			mutation: `Stripped the ${alg} signature, leaving header.payload.`,
+			evidence: {
+				alg,
+				strippedLength,
+				vulnerability: "Client may skip verification when the signature segment is empty",
+			},
+		};
+	},
+};
@@ -0,0 +1,57 @@
+/**
+ * Slow Down Storm
+ *
+ * Answers every poll of a device code with `authorization_pending`, however
+ * fast or slow the client polls and whether or not the user approved the
+ * device. The code never redeems; it expires after its lifetime and then
+ * gets `expired_token`. Clients should keep to the advertised `interval`
+ * (the evidence records the time since the previous poll) and give up
+ * when the code expires, not hammer the token endpoint or poll forever.
+ *
+ * Spec: RFC 8628 Section 3.5 - Device Access Token Response
+ * CWE-835: Loop with Unreachable Exit Condition
+ */
+
+import { DEVICE_CODE_GRANT } from "../../core/device-authorization.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const slowDownStorm: MischiefPlugin = {
+	id: "slow-down-storm",
+	name: "Slow Down Storm",
+	severity: "medium",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 8628 Section 3.5",
+		cwe: "CWE-835",
+		description:
+			"Clients MUST wait the polling interval between polls and stop once the device code expires",
+	},
+
+	description: "Keeps every device code poll pending, whatever the polling interval",
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		const poll = ctx.endpoint.devicePoll;
+		if (ctx.endpoint.params.grant_type !== DEVICE_CODE_GRANT || !poll) {
+			return { applied: false, mutation: "Not a device code poll", evidence: {} };
+		}
+
+		ctx.endpoint.actions.holdAuthorizationPending = true;
+
+		const respectedInterval =
+			poll.sinceLastPollMs === null ? null : poll.sinceLastPollMs >= poll.interval * 1000;
+		return {
+			applied: true,
+			mutation: `Answered poll ${poll.polls} with authorization_pending`,
+			evidence: {
+				polls: poll.polls,
+				interval: poll.interval,
+				sinceLastPollMs: poll.sinceLastPollMs,
+				respectedInterval,
+			},
+		};
+	},
+};
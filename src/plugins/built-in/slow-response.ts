@@ -0,0 +1,96 @@
+/**
+ * Slow Response
+ *
+ * Holds the /token response back for a configured time before sending it,
+ * or, as the hang variant, never sends it: the request stays open until the
+ * client gives up and disconnects. A client should put a timeout on token
+ * requests and fail (or retry) the flow when it expires, rather than let
+ * one stalled request hang everything waiting on it.
+ *
+ * Config:
+ * - delay: how long to hold the response, as a Go duration (default "5s");
+ *   sessions created over the admin API can set it as `tokenDelay`
+ * - hang: never respond (default false)
+ *
+ * Held responses don't hold up shutdown: when Loki stops, a delayed
+ * response is sent at once and a hanging request's connection is closed.
+ *
+ * Spec: OIDC Core 1.0 Section 3.1.3 - Token Endpoint
+ * CWE-400: Uncontrolled Resource Consumption
+ */
+
+import { parseDuration } from "../../core/duration.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const slowResponse: MischiefPlugin = {
+	id: "slow-response",
+	name: "Slow Token Response",
+	severity: "medium",
+	phase: "endpoint",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 3.1.3",
+		cwe: "CWE-400",
+		description: "Clients should time out token requests rather than wait indefinitely",
+	},
+
+	description: "Delays the /token response by a configured duration, or never sends it",
+
+	options: [
+		{
+			name: "delay",
+			type: "string",
+			default: "5s",
+			description: "How long the response is held, as a Go duration",
+		},
+		{
+			name: "hang",
+			type: "boolean",
+			default: false,
+			description: "Never respond",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		if (ctx.endpoint.path !== "/token") {
+			return { applied: false, mutation: "Not a token request", evidence: {} };
+		}
+		if (ctx.endpoint.status === 0) {
+			// Loki consulted endpoint mischief before the provider answered
+			return { applied: false, mutation: "No response yet", evidence: {} };
+		}
+
+		const hang = ctx.config.hang ?? false;
+		if (typeof hang !== "boolean") {
+			return { applied: false, mutation: "hang must be a boolean", evidence: {} };
+		}
+		if (hang) {
+			ctx.endpoint.actions.hangResponse = true;
+			return {
+				applied: true,
+				mutation: "Held the token response until the client disconnected",
+				evidence: { hang, status: ctx.endpoint.status },
+			};
+		}
+
+		const delay = ctx.config.delay ?? "5s";
+		const delayMs = typeof delay === "string" ? parseDuration(delay) : undefined;
+		if (delayMs === undefined || delayMs <= 0) {
+			return {
+				applied: false,
+				mutation: 'delay must be a positive Go duration, e.g. "30s"',
+				evidence: { delay },
+			};
+		}
+		ctx.endpoint.actions.responseDelayMs = delayMs;
+
+		return {
+			applied: true,
+			mutation: `Delayed the token response by ${delay}`,
+			evidence: { hang, delay, delayMs, status: ctx.endpoint.status },
+		};
+	},
+};
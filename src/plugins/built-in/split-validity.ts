@@ -0,0 +1,133 @@
+/**
+ * Split Validity
+ *
+ * In a flow that returns both tokens, leaves the access token untouched and
+ * perfectly valid while the ID token carries an attack. A client that
+ * validates one token and trusts the other because it came in the same
+ * response accepts a bad ID token. The ID token's `at_hash` still matches
+ * the valid access token, so binding the two proves nothing about either
+ * signature.
+ *
+ * Config:
+ * - attack: what the ID token gets
+ *   - "alg-none" (default): alg set to none, signature removed
+ *   - "bad-signature": signature replaced with random bytes
+ *   - "expired": `exp` an hour in the past, re-signed with Loki's key
+ *   - "wrong-issuer": `iss` set to an attacker's, re-signed
+ *   - "wrong-audience": `aud` set to an attacker's API, re-signed
+ *
+ * Spec: OIDC Core 1.0 Section 3.1.3.7 - the ID token is validated on its
+ * own, whatever else the token response holds
+ * CWE-347: Improper Verification of Cryptographic Signature
+ */
+
+import { SUPPORTED_SIGNING_ALGORITHMS, type SigningAlgorithm } from "../../core/key-manager.js";
+import { randomBytes } from "../../core/random.js";
+import { tokenHash } from "../../core/token-forge.js";
+import type { MischiefPlugin, TokenContext } from "../types.js";
+
+const ATTACKS = ["alg-none", "bad-signature", "expired", "wrong-issuer", "wrong-audience"] as const;
+type Attack = (typeof ATTACKS)[number];
+
+const ROGUE_ISSUER = "https://attacker.example";
+const ROGUE_AUDIENCE = "https://attacker.example/api";
+
+export const splitValidity: MischiefPlugin = {
+	id: "split-validity",
+	name: "Split Validity",
+	severity: "high",
+	phase: "token-signing",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 3.1.3.7",
+		cwe: "CWE-347",
+		description: "Clients MUST validate the ID token even when the access token beside it is valid",
+	},
+
+	description: "Leaves the access token valid and attacks only the ID token issued with it",
+
+	options: [
+		{
+			name: "attack",
+			type: "string",
+			values: ATTACKS,
+			default: "alg-none",
+			description: "The attack the ID token carries",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+		const accessToken = ctx.token.accessToken;
+		if (ctx.token.tokenType !== "id_token" || accessToken === undefined) {
+			return {
+				applied: false,
+				mutation: "Access token left valid",
+				evidence: { treatment: "valid" },
+			};
+		}
+
+		const attack = (ctx.config.attack as string | undefined) ?? "alg-none";
+		if (!ATTACKS.includes(attack as Attack)) {
+			return {
+				applied: false,
+				mutation: `attack must be one of: ${ATTACKS.join(", ")}`,
+				evidence: { attack },
+			};
+		}
+
+		// A signing plugin before this one may have left an alg (none, HS*) no at_hash is made with
+		const { alg } = ctx.token.header;
+		const atHashBound =
+			SUPPORTED_SIGNING_ALGORITHMS.includes(alg as SigningAlgorithm) &&
+			ctx.token.claims.at_hash === tokenHash(accessToken, alg);
+		const change = tamper(ctx.token, attack as Attack);
+		if (attack !== "alg-none" && attack !== "bad-signature" && ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Left the access token valid; ID token ${change}`,
+			evidence: {
+				attack,
+				treatments: { access_token: "valid", id_token: attack },
+				atHashBound,
+				vulnerability: "Client may trust the ID token because the access token beside it is valid",
+			},
+		};
+	},
+};
+
+/**
+ * Give the ID token an attack, returning what changed
+ */
+function tamper(token: TokenContext, attack: Attack): string {
+	switch (attack) {
+		case "alg-none": {
+			const originalAlg = token.header.alg;
+			token.header.alg = "none";
+			token.signature = "";
+			return `alg '${originalAlg}' changed to 'none', signature removed`;
+		}
+		case "bad-signature": {
+			const length = Buffer.from(token.signature, "base64url").length || 256;
+			token.signature = randomBytes(length).toString("base64url");
+			return "signature replaced with random bytes";
+		}
+		case "expired": {
+			const now = Math.floor(Date.now() / 1000);
+			token.claims.iat = now - 7200;
+			token.claims.exp = now - 3600;
+			return "exp set an hour in the past";
+		}
+		case "wrong-issuer":
+			token.claims.iss = ROGUE_ISSUER;
+			return `iss changed to ${ROGUE_ISSUER}`;
+		case "wrong-audience":
+			token.claims.aud = ROGUE_AUDIENCE;
+			return `aud changed to ${ROGUE_AUDIENCE}`;
+	}
+}
@@ -36,6 +36,28 @@ export const stateBypassPlugin: MischiefPlugin = {
 
 	description: "Manipulates state-related claims to test CSRF protection",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["inject-state", "tamper-azp", "add-claims"],
+			default: "tamper-azp",
+			description: "How the token is manipulated",
+		},
+		{
+			name: "injectedState",
+			type: "string",
+			default: "attacker-controlled-state",
+			description: "The state claim injected in inject-state mode",
+		},
+		{
+			name: "maliciousAzp",
+			type: "string",
+			default: "malicious-client-id",
+			description: "The azp set in tamper-azp mode",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
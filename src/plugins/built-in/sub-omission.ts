@@ -0,0 +1,83 @@
+/**
+ * Subject Omission
+ *
+ * Drops the `sub` claim. Every ID token MUST carry `sub` - it is the one
+ * stable identifier for the user - and so must JWT access tokens. A client
+ * that keys accounts on a missing `sub` may fall back to `email`, or to
+ * `undefined`, and match the wrong account or all of them.
+ *
+ * Tokens are re-signed with Loki's key, so the missing claim is the only
+ * thing wrong. Loki's userinfo endpoint answers for the subject the access
+ * token carries, so an access token without `sub` is rejected there too.
+ *
+ * Config:
+ * - target: both (default), id_token, or access_token
+ *
+ * Spec: OIDC Core 1.0 Section 2 - sub is REQUIRED in the ID token;
+ * RFC 9068 Section 2.2 - sub is REQUIRED in JWT access tokens
+ * CWE-287: Improper Authentication
+ */
+
+import type { MischiefPlugin } from "../types.js";
+import { type SubjectTarget, SUBJECT_TARGETS, targetsToken } from "./sub-tampering.js";
+
+export const subOmission: MischiefPlugin = {
+	id: "sub-omission",
+	name: "Subject Omission",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 2",
+		rfc: "RFC 9068 Section 2.2",
+		cwe: "CWE-287",
+		description: "ID tokens and JWT access tokens MUST contain sub; tokens without it are invalid",
+	},
+
+	description: "Removes the sub claim, validly signed",
+
+	options: [
+		{
+			name: "target",
+			type: "string",
+			values: ["both", "id_token", "access_token"],
+			default: "both",
+			description: "Which tokens lose their sub",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const target = (ctx.config.target as SubjectTarget | undefined) ?? "both";
+		if (!SUBJECT_TARGETS.includes(target)) {
+			return { applied: false, mutation: `Unknown target: ${target}`, evidence: { target } };
+		}
+		const { tokenType } = ctx.token;
+		if (!targetsToken(target, tokenType)) {
+			return { applied: false, mutation: `Target is ${target}, not ${tokenType}`, evidence: {} };
+		}
+
+		const { claims } = ctx.token;
+		const originalSub = claims.sub;
+		if (originalSub === undefined) {
+			return { applied: false, mutation: "Token has no sub claim", evidence: {} };
+		}
+		delete claims.sub;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Removed sub from the ${tokenType ?? "token"}`,
+			evidence: {
+				tokenType: tokenType ?? null,
+				originalSub,
+				signatureValid: ctx.token.resign !== undefined,
+			},
+		};
+	},
+};
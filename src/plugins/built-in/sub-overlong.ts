@@ -0,0 +1,93 @@
+/**
+ * Overlong Subject
+ *
+ * OIDC caps `sub` at 255 ASCII characters, and relying parties commonly
+ * store it in a column of exactly that width. This plugin emits a `sub` far
+ * beyond the limit (`length`, default 1024 characters) built so that every
+ * user's value starts with the same `collideAt` characters (default 255)
+ * and only differs after them. A client or database that silently truncates
+ * instead of rejecting the token maps every user to one stored subject -
+ * account takeover through a storage-layer bug.
+ *
+ * Tokens are re-signed with Loki's key, so only the length is wrong.
+ *
+ * Spec: OIDC Core 1.0 Section 2 - sub MUST NOT exceed 255 ASCII characters
+ * CWE-197: Numeric Truncation Error
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+/** Repeated to build the shared prefix and the padding */
+const FILLER = "loki-overlong-subject-";
+
+export const subOverlong: MischiefPlugin = {
+	id: "sub-overlong",
+	name: "Overlong Subject",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 2",
+		cwe: "CWE-197",
+		description: "sub MUST NOT exceed 255 ASCII characters; longer values must be rejected",
+	},
+
+	description: "Emits a sub far beyond 255 characters that collides when truncated",
+
+	options: [
+		{
+			name: "length",
+			type: "integer",
+			default: 1024,
+			description: "Length of the emitted sub",
+		},
+		{
+			name: "collideAt",
+			type: "integer",
+			default: 255,
+			description: "Characters every user's sub shares before it differs",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const length = (ctx.config.length as number | undefined) ?? 1024;
+		const collideAt = (ctx.config.collideAt as number | undefined) ?? 255;
+		if (!Number.isInteger(collideAt) || collideAt < 1 || !(length > collideAt)) {
+			return {
+				applied: false,
+				mutation: "length must be greater than collideAt, a positive integer",
+				evidence: { length, collideAt },
+			};
+		}
+
+		const { claims } = ctx.token;
+		const originalSub = claims.sub;
+		// Same first collideAt characters for everyone, the real subject after them
+		let sub = `${fill(collideAt)}${String(originalSub ?? "")}`;
+		if (sub.length < length) {
+			sub += fill(length - sub.length);
+		}
+		claims.sub = sub;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Emitted a ${sub.length}-character sub that collides at ${collideAt} characters`,
+			evidence: {
+				originalSub,
+				emittedLength: sub.length,
+				collideAt,
+			},
+		};
+	},
+};
+
+function fill(count: number): string {
+	return FILLER.repeat(Math.ceil(count / FILLER.length)).slice(0, count);
+}
@@ -0,0 +1,106 @@
+/**
+ * Subject Tampering
+ *
+ * Swaps `sub` for another user's identifier (`subject`, default
+ * `loki-impersonated-user`, obviously not the user who signed in). Unlike
+ * `subject-manipulation`, the token is re-signed with Loki's key, so
+ * nothing but the subject gives the swap away: a client that trusts `sub`
+ * without tying it to the login it started hands over someone else's
+ * account.
+ *
+ * Loki's userinfo endpoint answers for the subject the access token
+ * carries, so with JWT access tokens it returns the impersonated user's
+ * claims too, consistent with the ID token.
+ *
+ * Config:
+ * - subject: the impersonated subject (default: loki-impersonated-user)
+ * - target: both (default), id_token, or access_token
+ *
+ * Spec: OIDC Core 1.0 Section 2 - sub is the locally unique identifier of
+ * the end-user; Section 5.3.2 - userinfo sub MUST match the ID token's
+ * CWE-639: Authorization Bypass Through User-Controlled Key
+ */
+
+import type { MischiefPlugin, TokenType } from "../types.js";
+
+export type SubjectTarget = TokenType | "both";
+
+export const SUBJECT_TARGETS: readonly SubjectTarget[] = ["both", "id_token", "access_token"];
+
+const DEFAULT_SUBJECT = "loki-impersonated-user";
+
+export const subTampering: MischiefPlugin = {
+	id: "sub-tampering",
+	name: "Subject Tampering",
+	severity: "critical",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 2",
+		cwe: "CWE-639",
+		description: "sub identifies the end-user who authenticated; a swapped sub must not be trusted",
+	},
+
+	description: "Replaces sub with another user's identifier, validly signed",
+
+	options: [
+		{
+			name: "subject",
+			type: "string",
+			default: DEFAULT_SUBJECT,
+			description: "The impersonated subject",
+		},
+		{
+			name: "target",
+			type: "string",
+			values: ["both", "id_token", "access_token"],
+			default: "both",
+			description: "Which tokens carry the swapped sub",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const target = (ctx.config.target as SubjectTarget | undefined) ?? "both";
+		if (!SUBJECT_TARGETS.includes(target)) {
+			return { applied: false, mutation: `Unknown target: ${target}`, evidence: { target } };
+		}
+		const subject = ctx.config.subject ?? DEFAULT_SUBJECT;
+		if (typeof subject !== "string" || subject === "") {
+			return { applied: false, mutation: "subject must be a non-empty string", evidence: {} };
+		}
+		const { tokenType } = ctx.token;
+		if (!targetsToken(target, tokenType)) {
+			return { applied: false, mutation: `Target is ${target}, not ${tokenType}`, evidence: {} };
+		}
+
+		const { claims } = ctx.token;
+		const originalSub = claims.sub;
+		claims.sub = subject;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Replaced sub '${originalSub ?? "(none)"}' with '${subject}'`,
+			evidence: {
+				tokenType: tokenType ?? null,
+				originalSub: originalSub ?? null,
+				sub: subject,
+				signatureValid: ctx.token.resign !== undefined,
+			},
+		};
+	},
+};
+
+/**
+ * Whether a sub plugin's target covers a token; tokens the host doesn't
+ * type are always covered
+ */
+export function targetsToken(target: SubjectTarget, tokenType: TokenType | undefined): boolean {
+	return target === "both" || tokenType === undefined || target === tokenType;
+}
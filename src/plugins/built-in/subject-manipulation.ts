@@ -36,6 +36,34 @@ export const subjectManipulationPlugin: MischiefPlugin = {
 
 	description: "Manipulates subject claim to test identity validation",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["impersonate", "admin", "empty", "numeric"],
+			default: "admin",
+			description: "How the sub claim is manipulated",
+		},
+		{
+			name: "targetUser",
+			type: "string",
+			default: "victim-user-id",
+			description: "The sub set in impersonate mode",
+		},
+		{
+			name: "adminId",
+			type: "string",
+			default: "admin",
+			description: "The sub set in admin mode",
+		},
+		{
+			name: "numericId",
+			type: "number",
+			default: 1,
+			description: "The sub set in numeric mode",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
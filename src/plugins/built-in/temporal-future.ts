@@ -0,0 +1,102 @@
+/**
+ * Temporal Future
+ *
+ * The opposite of an expired token: `exp` is set decades ahead and `iat`
+ * and `nbf` far in the past, so every timestamp check a client might do
+ * against "now" passes, but the token claims an implausible lifetime.
+ * Clients that enforce a maximum token lifetime (exp - iat) or reject
+ * timestamps outside a clock-skew window should refuse it.
+ *
+ * Config (Go durations, e.g. "262800h" or "1h30m"):
+ * - expOffset: how far after now `exp` lies (default 30 years, "262800h")
+ * - nbfOffset: how far before now `iat` and `nbf` lie (default 1 year, "8760h")
+ *
+ * Tokens are re-signed with Loki's key, so only the timestamps are wrong.
+ *
+ * Spec: RFC 7519 Section 4.1.4 - exp bounds the token's lifetime
+ * CWE-613: Insufficient Session Expiration
+ */
+
+import { parseDuration } from "../../core/duration.js";
+import type { MischiefPlugin } from "../types.js";
+
+const DEFAULT_EXP_OFFSET = "262800h";
+const DEFAULT_NBF_OFFSET = "8760h";
+
+export const temporalFuture: MischiefPlugin = {
+	id: "temporal-future",
+	name: "Temporal Future",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		rfc: "RFC 7519 Section 4.1.4",
+		cwe: "CWE-613",
+		description: "Clients enforcing a maximum token lifetime must reject implausibly long ones",
+	},
+
+	description: "Sets exp decades ahead and iat/nbf far in the past",
+
+	options: [
+		{
+			name: "expOffset",
+			type: "string",
+			default: DEFAULT_EXP_OFFSET,
+			description: "How far after now exp lies, as a Go duration",
+		},
+		{
+			name: "nbfOffset",
+			type: "string",
+			default: DEFAULT_NBF_OFFSET,
+			description: "How far before now iat and nbf lie, as a Go duration",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const offsets = {
+			expOffset: ctx.config.expOffset ?? DEFAULT_EXP_OFFSET,
+			nbfOffset: ctx.config.nbfOffset ?? DEFAULT_NBF_OFFSET,
+		};
+		const seconds: Record<string, number> = {};
+		for (const [name, offset] of Object.entries(offsets)) {
+			const ms = typeof offset === "string" ? parseDuration(offset) : undefined;
+			if (ms === undefined || ms < 1000) {
+				return {
+					applied: false,
+					mutation: `${name} must be a Go duration of at least 1s`,
+					evidence: { [name]: offset },
+				};
+			}
+			seconds[name] = Math.floor(ms / 1000);
+		}
+
+		const { claims } = ctx.token;
+		const original = { exp: claims.exp ?? null, nbf: claims.nbf ?? null, iat: claims.iat ?? null };
+		const now = Math.floor(Date.now() / 1000);
+		const exp = now + (seconds.expOffset as number);
+		const past = now - (seconds.nbfOffset as number);
+		claims.exp = exp;
+		claims.nbf = past;
+		claims.iat = past;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Set exp ${offsets.expOffset} ahead and iat/nbf ${offsets.nbfOffset} back`,
+			evidence: {
+				...offsets,
+				original,
+				exp,
+				nbf: past,
+				iat: past,
+				lifetimeSeconds: exp - past,
+			},
+		};
+	},
+};
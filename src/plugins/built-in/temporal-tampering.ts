@@ -31,6 +31,16 @@ export const temporalTamperingPlugin: MischiefPlugin = {
 
 	description: "Sets token exp/nbf/iat to invalid times",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["expired", "future", "issued-future"],
+			default: "expired",
+			description: "Which timestamp is pushed out of range",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
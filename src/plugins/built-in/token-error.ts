@@ -0,0 +1,119 @@
+/**
+ * Token Error
+ *
+ * Answers a session's token requests with an OAuth error response instead
+ * of a token: `error` and `error_description` as RFC 6749 Section 5.2 lays
+ * them out, under an HTTP status chosen independently of the error code.
+ * Clients should surface the error (and treat `invalid_grant` as "start
+ * over", `server_error` as retryable), not crash on a body without
+ * `access_token`. A mismatched pair - `invalid_grant` with 500, or an error
+ * body with 200 - tests whether the client reads the status, the body, or
+ * both.
+ *
+ * Config:
+ * - error: the OAuth error code (default: invalid_grant)
+ * - status: the HTTP status, 200-599 (default: 401 for invalid_client,
+ *   500 for server_error, 503 for temporarily_unavailable, otherwise 400)
+ * - description: the error_description (default: a description of the error code)
+ *
+ * Spec: RFC 6749 Section 5.2 - Error Response
+ * CWE-755: Improper Handling of Exceptional Conditions
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+/** The status each error code is given by default */
+const DEFAULT_STATUS: Record<string, number> = {
+	invalid_client: 401,
+	server_error: 500,
+	temporarily_unavailable: 503,
+};
+
+const DEFAULT_DESCRIPTIONS: Record<string, string> = {
+	invalid_request: "The request is missing a required parameter or is otherwise malformed",
+	invalid_client: "Client authentication failed",
+	invalid_grant: "The authorization grant or refresh token is invalid, expired or revoked",
+	unauthorized_client: "The client is not authorized to use this grant type",
+	unsupported_grant_type: "The grant type is not supported",
+	invalid_scope: "The requested scope is invalid, unknown or exceeds the grant",
+	server_error: "The authorization server encountered an unexpected condition",
+	temporarily_unavailable: "The authorization server is temporarily unable to handle the request",
+};
+
+/** RFC 6749 Appendix A.7: error codes are printable ASCII without `"` or `\` */
+const ERROR_CODE = /^[\x20\x21\x23-\x5b\x5d-\x7e]+$/;
+
+export const tokenError: MischiefPlugin = {
+	id: "token-error",
+	name: "Token Error Injection",
+	severity: "medium",
+	phase: "endpoint",
+
+	spec: {
+		rfc: "RFC 6749 Section 5.2",
+		cwe: "CWE-755",
+		description: "Clients must handle token error responses rather than assume a token",
+	},
+
+	description: "Answers token requests with a configurable OAuth error and HTTP status",
+
+	options: [
+		{
+			name: "error",
+			type: "string",
+			default: "invalid_grant",
+			description: "The OAuth error code",
+		},
+		{
+			name: "status",
+			type: "integer",
+			description: "The HTTP status, 200-599 (default: derived from the error code)",
+		},
+		{
+			name: "description",
+			type: "string",
+			description: "The error_description (default: a description of the error code)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint?.tokenRequest) {
+			return { applied: false, mutation: "Not a token request", evidence: {} };
+		}
+
+		const error = ctx.config.error ?? "invalid_grant";
+		if (typeof error !== "string" || !ERROR_CODE.test(error)) {
+			return {
+				applied: false,
+				mutation: "error must be a non-empty OAuth error code",
+				evidence: { error },
+			};
+		}
+		const status = ctx.config.status ?? DEFAULT_STATUS[error] ?? 400;
+		if (typeof status !== "number" || !Number.isInteger(status) || status < 200 || status > 599) {
+			return {
+				applied: false,
+				mutation: "status must be an HTTP status from 200 to 599",
+				evidence: { status },
+			};
+		}
+		const description =
+			ctx.config.description ?? DEFAULT_DESCRIPTIONS[error] ?? `Token request failed: ${error}`;
+		if (typeof description !== "string") {
+			return { applied: false, mutation: "description must be a string", evidence: {} };
+		}
+
+		ctx.endpoint.actions.tokenError = { error, description, status };
+
+		return {
+			applied: true,
+			mutation: `Answered the token request with ${status} ${error}`,
+			evidence: {
+				grantType: ctx.endpoint.params.grant_type ?? null,
+				error,
+				errorDescription: description,
+				status,
+			},
+		};
+	},
+};
@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const tokenLifetimeAbuse: MischiefPlugin = {
@@ -27,9 +28,7 @@ export const tokenLifetimeAbuse: MischiefPlugin = {
 			{ name: "100 years", seconds: 100 * 365 * 24 * 60 * 60 },
 		];
 
-		const selected = lifetimes[
-			Math.floor(Math.random() * lifetimes.length)
-		] as (typeof lifetimes)[0];
+		const selected = lifetimes[randomInt(lifetimes.length)] as (typeof lifetimes)[0];
 		ctx.token.claims.exp = now + selected.seconds;
 		ctx.token.claims.iat = now;
 
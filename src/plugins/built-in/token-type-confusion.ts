@@ -35,6 +35,22 @@ export const tokenTypeConfusionPlugin: MischiefPlugin = {
 
 	description: "Manipulates typ header to test token type validation",
 
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["remove", "invalid", "swap", "lowercase"],
+			default: "swap",
+			description: "How the typ header is manipulated",
+		},
+		{
+			name: "invalidTyp",
+			type: "string",
+			default: "INVALID",
+			description: "The typ set in invalid mode",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
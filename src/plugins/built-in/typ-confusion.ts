@@ -0,0 +1,108 @@
+/**
+ * Typ Confusion Attack
+ *
+ * Gives a token the `typ` of the other kind of token, validly signed: an
+ * access token that should be `at+jwt` is marked plain `JWT`, and an ID
+ * token is marked `at+jwt`. Resource servers MUST check for `at+jwt` so an
+ * ID token (or any other JWT the issuer signs) can't be replayed as an
+ * access token; clients increasingly check ID tokens aren't `at+jwt`.
+ *
+ * Config:
+ * - target: access_token (default), id_token, or both
+ * - typValue: the `typ` to set instead (default: JWT on access tokens, at+jwt on ID tokens)
+ *
+ * Spec: RFC 9068 Section 4 - resource servers MUST verify `typ` is `at+jwt`
+ * (or `application/at+jwt`); RFC 8725 Section 3.11 - explicit typing
+ * CWE-843: Access of Resource Using Incompatible Type ('Type Confusion')
+ */
+
+import type { MischiefPlugin, TokenType } from "../types.js";
+
+type TypTarget = TokenType | "both";
+
+const TARGETS: readonly TypTarget[] = ["access_token", "id_token", "both"];
+
+/** The `typ` each kind of token is given by default */
+const CONFUSED_TYP: Record<TokenType, string> = {
+	access_token: "JWT",
+	id_token: "at+jwt",
+};
+
+export const typConfusion: MischiefPlugin = {
+	id: "typ-confusion",
+	name: "Typ Header Confusion",
+	severity: "high",
+	phase: "token-signing",
+
+	spec: {
+		rfc: "RFC 9068 Section 4",
+		cwe: "CWE-843",
+		description: "Resource servers MUST reject access tokens whose typ is not at+jwt",
+	},
+
+	description: "Marks access tokens typ JWT and ID tokens typ at+jwt, validly signed",
+
+	options: [
+		{
+			name: "target",
+			type: "string",
+			values: ["access_token", "id_token", "both"],
+			default: "access_token",
+			description: "Which tokens get the other kind's typ",
+		},
+		{
+			name: "typValue",
+			type: "string",
+			description: "The typ set instead (default: JWT on access tokens, at+jwt on ID tokens)",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const target = (ctx.config.target as TypTarget | undefined) ?? "access_token";
+		if (!TARGETS.includes(target)) {
+			return {
+				applied: false,
+				mutation: `Unknown target: ${target}`,
+				evidence: { target },
+			};
+		}
+		const typValue = ctx.config.typValue;
+		if (typValue !== undefined && (typeof typValue !== "string" || typValue === "")) {
+			return { applied: false, mutation: "typValue must be a non-empty string", evidence: {} };
+		}
+
+		const originalTyp = ctx.token.header.typ;
+		// Hosts that don't say which token this is: go by the typ it was issued with
+		const tokenType: TokenType =
+			ctx.token.tokenType ?? (isAccessTokenTyp(originalTyp) ? "access_token" : "id_token");
+		if (target !== "both" && target !== tokenType) {
+			return { applied: false, mutation: `Target is ${target}, not ${tokenType}`, evidence: {} };
+		}
+
+		const typ = typValue ?? CONFUSED_TYP[tokenType];
+		ctx.token.header.typ = typ;
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Set typ on the ${tokenType} from '${originalTyp ?? "(none)"}' to '${typ}'`,
+			evidence: {
+				tokenType,
+				originalTyp: originalTyp ?? null,
+				typ,
+				renderedHeader: ctx.token.rawHeader ?? JSON.stringify(ctx.token.header),
+				signatureValid: ctx.token.resign !== undefined,
+			},
+		};
+	},
+};
+
+function isAccessTokenTyp(typ: string | undefined): boolean {
+	return typ?.toLowerCase() === "at+jwt" || typ?.toLowerCase() === "application/at+jwt";
+}
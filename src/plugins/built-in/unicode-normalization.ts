@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const unicodeNormalization: MischiefPlugin = {
@@ -48,7 +49,7 @@ export const unicodeNormalization: MischiefPlugin = {
 		];
 
 		const selectedTrick = unicodeTricks[
-			Math.floor(Math.random() * unicodeTricks.length)
+			randomInt(unicodeTricks.length)
 		] as (typeof unicodeTricks)[0];
 		const originalSub = token.claims.sub;
 		selectedTrick.apply();
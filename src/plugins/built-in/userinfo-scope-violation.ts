@@ -0,0 +1,115 @@
+/**
+ * Userinfo Scope Violation
+ *
+ * /me ignores the scope-to-claim map: it returns claims the granted scopes
+ * don't authorize (over-disclosure), or drops claims they should release.
+ * Clients and resource servers that assume userinfo respects scope end up
+ * storing data they never asked for, or break on missing claims.
+ *
+ * Modes:
+ * - over-disclose: Add claims no granted scope authorizes (default)
+ * - withhold: Drop authorized claims, keeping only `sub`
+ *
+ * `claims` limits which claims are added or dropped.
+ *
+ * Spec: OIDC Core 1.0 Section 5.4 - scopes request specific sets of claims
+ * CWE-359: Exposure of Private Personal Information to an Unauthorized Actor
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type ViolationMode = "over-disclose" | "withhold";
+
+export const userinfoScopeViolation: MischiefPlugin = {
+	id: "userinfo-scope-violation",
+	name: "Userinfo Scope Violation",
+	severity: "high",
+	phase: "endpoint",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 5.4",
+		cwe: "CWE-359",
+		description: "Userinfo MUST only return claims authorized by the granted scopes",
+	},
+
+	description: "Returns userinfo claims the scopes don't authorize, or withholds ones they do",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["over-disclose", "withhold"],
+			default: "over-disclose",
+			description: "Whether unauthorized claims are added or authorized ones dropped",
+		},
+		{
+			name: "claims",
+			type: "array",
+			description: "Limit which claims are added or dropped",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		const { path, response, subjectClaims } = ctx.endpoint;
+		if (path !== "/me" || !response || !subjectClaims) {
+			return { applied: false, mutation: "Not a userinfo response", evidence: {} };
+		}
+
+		const mode = (ctx.config.mode as ViolationMode | undefined) ?? "over-disclose";
+		const only = ctx.config.claims as string[] | undefined;
+		const selected = (name: string) => name !== "sub" && (!only || only.includes(name));
+		const body: Record<string, unknown> = { ...response };
+		let changed: string[];
+
+		switch (mode) {
+			case "over-disclose":
+				changed = Object.keys(subjectClaims).filter((name) => !(name in response) && selected(name));
+				for (const name of changed) {
+					body[name] = subjectClaims[name];
+				}
+				break;
+
+			case "withhold":
+				changed = Object.keys(response).filter(selected);
+				for (const name of changed) {
+					delete body[name];
+				}
+				break;
+
+			default:
+				return {
+					applied: false,
+					mutation: `Unknown mode: ${mode}`,
+					evidence: { mode },
+				};
+		}
+
+		if (changed.length === 0) {
+			return {
+				applied: false,
+				mutation: `No claims to ${mode === "withhold" ? "withhold" : "disclose"}`,
+				evidence: { mode },
+			};
+		}
+
+		ctx.endpoint.actions.responseBody = body;
+
+		return {
+			applied: true,
+			mutation:
+				mode === "withhold"
+					? `Withheld scope-authorized claims: ${changed.join(", ")}`
+					: `Disclosed claims outside granted scopes: ${changed.join(", ")}`,
+			evidence: {
+				mode,
+				requestedScopes: (ctx.endpoint.params.scope ?? "").split(" ").filter(Boolean),
+				authorizedClaims: Object.keys(response),
+				returnedClaims: Object.keys(body),
+				[mode === "withhold" ? "withheld" : "disclosed"]: changed,
+			},
+		};
+	},
+};
@@ -0,0 +1,135 @@
+/**
+ * Userinfo Tampering
+ *
+ * Userinfo answers for someone other than the token's subject: its `sub`
+ * differs from the one in the ID token, or claims the subject doesn't hold
+ * (an attacker's verified email, say) are mixed in. A client that merges
+ * userinfo into the session without checking `sub` against the ID token
+ * logs the user in with another account's attributes.
+ *
+ * Modes:
+ * - swap-sub: Return a different `sub` (default)
+ * - inject-claims: Merge `claims` over the response
+ *
+ * Config:
+ * - sub: the `sub` swap-sub returns (default: the real one suffixed `-impostor`)
+ * - claims: the object inject-claims merges (default: an attacker's verified email)
+ *
+ * Spec: OIDC Core 1.0 Section 5.3.2 - userinfo `sub` MUST match the ID token's, or
+ * the response MUST NOT be used
+ * CWE-287: Improper Authentication
+ */
+
+import { isPlainObject } from "../../core/session-spec.js";
+import type { MischiefPlugin } from "../types.js";
+
+type TamperingMode = "swap-sub" | "inject-claims";
+
+const DEFAULT_CLAIMS = { email: "impostor@loki.test", email_verified: true };
+
+export const userinfoTampering: MischiefPlugin = {
+	id: "userinfo-tampering",
+	name: "Userinfo Tampering",
+	severity: "critical",
+	phase: "endpoint",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 5.3.2",
+		cwe: "CWE-287",
+		description: "The userinfo sub MUST exactly match the sub in the ID token",
+	},
+
+	description: "Returns userinfo with a different sub than the token's, or injected claims",
+
+	options: [
+		{
+			name: "mode",
+			type: "string",
+			values: ["swap-sub", "inject-claims"],
+			default: "swap-sub",
+			description: "How the userinfo response is tampered with",
+		},
+		{
+			name: "sub",
+			type: "string",
+			description: "The sub swap-sub returns (default: the real one suffixed -impostor)",
+		},
+		{
+			name: "claims",
+			type: "object",
+			default: DEFAULT_CLAIMS,
+			description: "The object inject-claims merges over the response",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.endpoint) {
+			return { applied: false, mutation: "No endpoint context", evidence: {} };
+		}
+		const { path, response, actions } = ctx.endpoint;
+		if (path !== "/me" || !response) {
+			return { applied: false, mutation: "Not a userinfo response", evidence: {} };
+		}
+
+		// Build on what earlier userinfo mischief already returns
+		const current = isPlainObject(actions.responseBody) ? actions.responseBody : response;
+		const body: Record<string, unknown> = { ...current };
+		const tokenSub = response.sub;
+		const mode = (ctx.config.mode as TamperingMode | undefined) ?? "swap-sub";
+
+		switch (mode) {
+			case "swap-sub": {
+				const sub = ctx.config.sub;
+				body.sub = typeof sub === "string" ? sub : `${String(tokenSub)}-impostor`;
+				if (body.sub === tokenSub) {
+					return {
+						applied: false,
+						mutation: "Configured sub is the token's own",
+						evidence: { mode, tokenSub },
+					};
+				}
+				break;
+			}
+
+			case "inject-claims": {
+				const claims = ctx.config.claims ?? DEFAULT_CLAIMS;
+				if (!isPlainObject(claims) || Object.keys(claims).length === 0) {
+					return { applied: false, mutation: "No claims configured", evidence: { mode } };
+				}
+				for (const [name, value] of Object.entries(claims)) {
+					if (name !== "__proto__") {
+						body[name] = structuredClone(value);
+					}
+				}
+				break;
+			}
+
+			default:
+				return {
+					applied: false,
+					mutation: `Unknown mode: ${mode}`,
+					evidence: { mode },
+				};
+		}
+
+		actions.responseBody = body;
+		const changed = Object.keys(body).filter(
+			(name) => JSON.stringify(body[name]) !== JSON.stringify(current[name]),
+		);
+		const served = JSON.stringify(body.sub);
+
+		return {
+			applied: true,
+			mutation:
+				body.sub === tokenSub
+					? `Injected userinfo claims: ${changed.join(", ")}`
+					: `Userinfo sub ${served} differs from the token's ${JSON.stringify(tokenSub)}`,
+			evidence: {
+				mode,
+				tokenSub,
+				servedSub: body.sub,
+				changed,
+			},
+		};
+	},
+};
@@ -0,0 +1,88 @@
+/**
+ * Verified Flags
+ *
+ * Sets `email_verified` and/or `phone_number_verified` in the token,
+ * independently of each other, while every other claim and the signature
+ * stay valid (the token is re-signed with Loki's key). Apps
+ * that auto-link accounts or grant access because the IdP says an email is
+ * verified are making a trust decision on a single boolean; this checks
+ * they don't take it blindly from an IdP that may be compromised.
+ *
+ * Config:
+ * - flags: Object of flag name to emitted value
+ *   (default { email_verified: true, phone_number_verified: true })
+ *
+ * Spec: OIDC Core 1.0 Section 5.1 - email_verified, phone_number_verified
+ * CWE-345: Insufficient Verification of Data Authenticity
+ */
+
+import type { MischiefPlugin } from "../types.js";
+
+type VerifiedFlag = "email_verified" | "phone_number_verified";
+
+const VERIFIED_FLAGS: VerifiedFlag[] = ["email_verified", "phone_number_verified"];
+
+export const verifiedFlags: MischiefPlugin = {
+	id: "verified-flags",
+	name: "Verified Flags",
+	severity: "high",
+	phase: "token-claims",
+
+	spec: {
+		oidc: "OIDC Core 1.0 Section 5.1",
+		cwe: "CWE-345",
+		description: "Relying parties should not auto-link accounts on an IdP's verified flag alone",
+	},
+
+	description: "Flips email_verified / phone_number_verified independently",
+
+	options: [
+		{
+			name: "flags",
+			type: "object",
+			default: { email_verified: true, phone_number_verified: true },
+			description: "Flag name to emitted value",
+		},
+	],
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const flags = (ctx.config.flags as Partial<Record<VerifiedFlag, boolean>> | undefined) ?? {
+			email_verified: true,
+			phone_number_verified: true,
+		};
+		const emitted: Partial<Record<VerifiedFlag, boolean>> = {};
+		const previous: Partial<Record<VerifiedFlag, unknown>> = {};
+
+		for (const flag of VERIFIED_FLAGS) {
+			const value = flags[flag];
+			if (typeof value !== "boolean") {
+				continue;
+			}
+			previous[flag] = ctx.token.claims[flag];
+			ctx.token.claims[flag] = value;
+			emitted[flag] = value;
+		}
+
+		if (Object.keys(emitted).length === 0) {
+			return { applied: false, mutation: "No verified flags configured", evidence: {} };
+		}
+		if (ctx.token.resign) {
+			await ctx.token.resign();
+		}
+
+		return {
+			applied: true,
+			mutation: `Set ${Object.entries(emitted)
+				.map(([flag, value]) => `${flag}=${value}`)
+				.join(", ")}`,
+			evidence: {
+				emitted,
+				previous,
+			},
+		};
+	},
+};
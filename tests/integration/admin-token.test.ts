@@ -0,0 +1,117 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Admin Token", () => {
+	let loki: Loki;
+	const PORT = 9884;
+	const ISSUER = `http://localhost:${PORT}`;
+	const ADMIN_URL = `${ISSUER}/admin`;
+	const TOKEN = "test-admin-token";
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost", adminToken: TOKEN },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	function admin(path: string, init: RequestInit = {}) {
+		return fetch(`${ADMIN_URL}${path}`, {
+			...init,
+			headers: { Authorization: `Bearer ${TOKEN}`, "Content-Type": "application/json" },
+		});
+	}
+
+	it("should require the token on admin routes", async () => {
+		const missing = await fetch(`${ADMIN_URL}/sessions`);
+		expect(missing.status).toBe(401);
+		expect(missing.headers.get("WWW-Authenticate")).toContain("Bearer");
+
+		const wrong = await fetch(`${ADMIN_URL}/sessions`, {
+			headers: { Authorization: "Bearer wrong" },
+		});
+		expect(wrong.status).toBe(401);
+
+		expect((await admin("/sessions")).ok).toBe(true);
+	});
+
+	it("should accept the token as the password of Basic credentials", async () => {
+		const missing = await fetch(`${ADMIN_URL}/sessions`);
+		expect(missing.headers.get("WWW-Authenticate")).toContain("Basic");
+
+		const basic = await fetch(`${ADMIN_URL}/sessions`, {
+			headers: { Authorization: `Basic ${btoa(`admin:${TOKEN}`)}` },
+		});
+		expect(basic.ok).toBe(true);
+
+		const wrong = await fetch(`${ADMIN_URL}/sessions`, {
+			headers: { Authorization: `Basic ${btoa(`${TOKEN}:wrong`)}` },
+		});
+		expect(wrong.status).toBe(401);
+	});
+
+	it("should leave the OIDC endpoints open", async () => {
+		expect((await fetch(`${ISSUER}/jwks`)).ok).toBe(true);
+	});
+
+	it("should leave the rogue JWKS and chains open to clients following jku and x5u", async () => {
+		const response = await fetch(`${ADMIN_URL}/rogue-jwks/sess_unknown`);
+		expect(response.status).toBe(404);
+		expect((await response.json()).code).toBe("rogue_jwks_not_found");
+
+		const chain = await fetch(`${ADMIN_URL}/rogue-x5u/sess_unknown`);
+		expect(chain.status).toBe(404);
+		expect((await chain.json()).code).toBe("rogue_x5u_not_found");
+	});
+
+	it("should export the keys that sign a session's tokens", async () => {
+		const createRes = await admin("/sessions", {
+			method: "POST",
+			body: JSON.stringify({ mischief: ["key-confusion"] }),
+		});
+		const { sessionId } = await createRes.json();
+
+		const response = await admin(`/sessions/${sessionId}/keys`);
+		expect(response.ok).toBe(true);
+		const data = await response.json();
+		expect(data.warning).toMatch(/Test-only/);
+
+		const { keys: published } = await (await fetch(`${ISSUER}/jwks`)).json();
+		const [key] = data.keys;
+		expect(published.map((k: { kid: string }) => k.kid)).toContain(key.kid);
+		expect(key.active).toBe(true);
+
+		// The exported private key signs tokens that verify against the JWKS
+		const privateKey = await jose.importPKCS8(key.privatePem, key.alg);
+		const token = await new jose.SignJWT({ sub: "forged" })
+			.setProtectedHeader({ alg: key.alg, kid: key.kid })
+			.sign(privateKey);
+		const { payload } = await jose.jwtVerify(token, jose.createLocalJWKSet({ keys: published }));
+		expect(payload.sub).toBe("forged");
+
+		const { events } = await (await admin(`/sessions/${sessionId}/events`)).json();
+		expect(events).toContainEqual(
+			expect.objectContaining({ type: "signing-keys-exported", data: { kids: [key.kid] } }),
+		);
+	});
+
+	it("should return 404 for unknown sessions", async () => {
+		expect((await admin("/sessions/sess_missing/keys")).status).toBe(404);
+	});
+});
@@ -0,0 +1,76 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { ATTACK_OF_THE_DAY_SESSION, Loki } from "../../src/index.js";
+
+describe("Attack of the Day", () => {
+	let loki: Loki;
+	const PORT = 9883;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+			attackOfTheDay: { order: ["alg-none", "kid-manipulation"], everyRequests: 1 },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	async function requestToken(): Promise<jose.ProtectedHeaderParameters> {
+		const response = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				"X-Loki-Session": ATTACK_OF_THE_DAY_SESSION,
+			},
+			body: "grant_type=client_credentials",
+		});
+		const data = (await response.json()) as { access_token: string };
+		return jose.decodeProtectedHeader(data.access_token);
+	}
+
+	it("should rotate the session's attack and record the history", async () => {
+		expect((await requestToken()).alg).toBe("none");
+		expect((await requestToken()).alg).not.toBe("none");
+
+		const response = await fetch(`${ISSUER}/admin/attack-of-the-day`);
+		expect(response.status).toBe(200);
+		const status = await response.json();
+		expect(status.cadence).toBe("requests");
+		expect(status.current).toMatchObject({ plugin: "kid-manipulation", index: 1 });
+		expect(status.history.map((entry: { plugin: string }) => entry.plugin)).toEqual([
+			"alg-none",
+			"kid-manipulation",
+		]);
+
+		const { events } = await (
+			await fetch(`${ISSUER}/admin/sessions/${ATTACK_OF_THE_DAY_SESSION}/events`)
+		).json();
+		expect(events.at(-1)).toMatchObject({
+			type: "attack-rotated",
+			data: { from: "alg-none", to: "kid-manipulation" },
+		});
+	});
+
+	it("should bring the session back after it is deleted", async () => {
+		expect(loki.deleteSession(ATTACK_OF_THE_DAY_SESSION)).toBe(true);
+
+		expect((await requestToken()).alg).toBe("none");
+		expect(loki.getSession(ATTACK_OF_THE_DAY_SESSION)).toBeDefined();
+	});
+});
@@ -0,0 +1,81 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { CHAOS_SESSION, Loki } from "../../src/index.js";
+
+describe("Chaos Mode", () => {
+	let loki: Loki;
+	const PORT = 9909;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+			chaos: { rate: 1, allowlist: ["alg-none"] },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	async function requestToken(sessionId?: string): Promise<jose.ProtectedHeaderParameters> {
+		const headers: Record<string, string> = {
+			"Content-Type": "application/x-www-form-urlencoded",
+			Authorization: `Basic ${btoa("test-client:test-secret")}`,
+		};
+		if (sessionId) {
+			headers["X-Loki-Session"] = sessionId;
+		}
+		const response = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers,
+			body: "grant_type=client_credentials",
+		});
+		const data = (await response.json()) as { access_token: string };
+		return jose.decodeProtectedHeader(data.access_token);
+	}
+
+	it("should serve drawn mischief to token requests without a session", async () => {
+		expect((await requestToken()).alg).toBe("none");
+
+		const { events } = await (
+			await fetch(`${ISSUER}/admin/sessions/${CHAOS_SESSION}/events`)
+		).json();
+		expect(events.at(-1)).toMatchObject({ type: "chaos-drawn", data: { plugin: "alg-none" } });
+
+		const metrics = await (await fetch(`${ISSUER}/metrics`)).text();
+		expect(metrics).toMatch(/^loki_chaos_requests_total\{mischief="alg-none"\} [1-9]\d*$/m);
+	});
+
+	it("should leave requests with an explicit session to that session", async () => {
+		const created = await fetch(`${ISSUER}/admin/sessions`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify({ mode: "explicit", mischief: ["kid-manipulation"] }),
+		});
+		const { sessionId } = await created.json();
+
+		expect((await requestToken(sessionId)).alg).not.toBe("none");
+	});
+
+	it("should report its rate, pool and draws", async () => {
+		const response = await fetch(`${ISSUER}/admin/chaos`);
+		expect(response.status).toBe(200);
+		const status = await response.json();
+		expect(status).toMatchObject({ sessionId: CHAOS_SESSION, rate: 1, pool: ["alg-none"] });
+		expect(status.tokenRequests).toBe(status.applied["alg-none"]);
+		expect(loki.getChaos()?.tokenRequests).toBeGreaterThan(0);
+	});
+});
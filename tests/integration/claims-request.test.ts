@@ -0,0 +1,120 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+import { REDIRECT_URI, signInWithCode } from "./helpers/auth-code.js";
+
+describe("Claims Request Parameter", () => {
+	let loki: Loki;
+	const PORT = 9908;
+	const ISSUER = `http://localhost:${PORT}`;
+	const CLAIMS = {
+		id_token: { email: { essential: true }, name: null },
+		userinfo: { picture: { essential: true } },
+	};
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "spa-client",
+						token_endpoint_auth_method: "none",
+						redirect_uris: [REDIRECT_URI],
+						grant_types: ["authorization_code"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	/**
+	 * Sign in with a claims request, returning the token response
+	 */
+	function signIn(sessionId: string): Promise<{ id_token: string; access_token: string }> {
+		return signInWithCode({
+			issuer: ISSUER,
+			sessionId,
+			params: { claims: JSON.stringify(CLAIMS) },
+		});
+	}
+
+	it("should deliver the requested claims in the ID token and userinfo", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const tokens = await signIn(session.id);
+
+		const claims = jose.decodeJwt(tokens.id_token);
+		expect(claims.email).toBe("alice@loki.test");
+		expect(claims.name).toBe("Test User");
+		const report = loki.getSessionReport(session.id);
+		const issuance = report?.issuances.find((i) => i.tokenType === "id_token");
+		expect(issuance?.requestedClaims).toEqual({
+			requested: ["email", "name"],
+			essential: ["email"],
+			delivered: ["email", "name"],
+		});
+		expect(issuance?.grant).toEqual({
+			grantType: "authorization_code",
+			profile: "user",
+			unexpected: [],
+		});
+
+		const userinfo = await fetch(`${ISSUER}/me`, {
+			headers: { Authorization: `Bearer ${tokens.access_token}` },
+		});
+		expect((await userinfo.json()).picture).toBe("https://loki.test/avatars/alice.png");
+		const withIdToken = await fetch(`${ISSUER}/me`, {
+			headers: { Authorization: `Bearer ${tokens.id_token}` },
+		});
+		expect(withIdToken.status).toBe(401);
+		const event = session.getEvents().find((e) => e.type === "claims-requested");
+		expect(event?.data).toEqual({
+			clientId: "spa-client",
+			idToken: ["email", "name"],
+			userinfo: ["picture"],
+		});
+	});
+
+	it("should drop an essential claim under essential-claim-omission", async () => {
+		const session = loki.createSession({
+			mode: "explicit",
+			mischief: ["essential-claim-omission"],
+		});
+		const claims = jose.decodeJwt((await signIn(session.id)).id_token);
+
+		expect(claims).not.toHaveProperty("email");
+		expect(claims.name).toBe("Test User");
+		const report = loki.getSessionReport(session.id);
+		const issuance = report?.issuances.find((i) => i.tokenType === "id_token");
+		expect(issuance?.mischief).toEqual(["essential-claim-omission"]);
+		expect(issuance?.requestedClaims?.delivered).toEqual(["name"]);
+	});
+
+	it("should refuse a malformed claims request", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const query = new URLSearchParams({
+			client_id: "spa-client",
+			response_type: "code",
+			scope: "openid",
+			redirect_uri: REDIRECT_URI,
+			claims: '{"id_token": []}',
+		});
+		const response = await fetch(`${ISSUER}/authorize?${query}`, {
+			headers: { "X-Loki-Session": session.id },
+			redirect: "manual",
+		});
+
+		expect(response.status).toBe(400);
+		expect(await response.json()).toMatchObject({
+			error: "invalid_request",
+			code: "invalid_claims_request",
+		});
+	});
+});
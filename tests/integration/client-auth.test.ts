@@ -0,0 +1,372 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Client Auth", () => {
+	let loki: Loki;
+	const PORT = 9885;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+					{
+						client_id: "public-client",
+						token_endpoint_auth_method: "none",
+						redirect_uris: ["http://localhost:8080/callback"],
+						grant_types: ["authorization_code"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	async function requestToken(
+		body: Record<string, string>,
+		headers: Record<string, string> = {},
+	): Promise<Response> {
+		return fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: { "Content-Type": "application/x-www-form-urlencoded", ...headers },
+			body: new URLSearchParams(body).toString(),
+		});
+	}
+
+	const publicBasic = { Authorization: `Basic ${btoa("public-client:guessed")}` };
+
+	function clientAuthEvent(sessionId: string) {
+		return loki.getSessionEvents(sessionId).find((event) => event.type === "client-auth-checked");
+	}
+
+	it("should refuse client_credentials for a public client", async () => {
+		const response = await requestToken({
+			grant_type: "client_credentials",
+			client_id: "public-client",
+		});
+
+		expect(response.status).toBe(400);
+		const body = await response.json();
+		expect(body.error).toBe("unauthorized_client");
+		expect(body.code).toBe("public_client_credentials");
+	});
+
+	it("should refuse a client secret from a public client", async () => {
+		const post = { client_id: "public-client", client_secret: "guessed" };
+		const cases = [
+			[{ grant_type: "authorization_code", code: "x" }, publicBasic],
+			[{ grant_type: "authorization_code", code: "x", ...post }, {}],
+		] as const;
+		for (const [body, headers] of cases) {
+			const response = await requestToken(body, headers);
+
+			expect(response.status).toBe(401);
+			const data = await response.json();
+			expect(data.error).toBe("invalid_client");
+			expect(data.code).toBe("public_client_secret");
+		}
+	});
+
+	it("should issue client_credentials tokens to an authenticated confidential client", async () => {
+		const response = await requestToken(
+			{ grant_type: "client_credentials" },
+			{ Authorization: `Basic ${btoa("test-client:test-secret")}` },
+		);
+
+		expect(response.ok).toBe(true);
+	});
+
+	it("should record each session check and whether it was wrongly allowed", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		await requestToken(
+			{ grant_type: "client_credentials", client_id: "public-client" },
+			{ "X-Loki-Session": session.id },
+		);
+
+		expect(clientAuthEvent(session.id)).toMatchObject({
+			type: "client-auth-checked",
+			data: {
+				clientId: "public-client",
+				clientType: "public",
+				authMethod: "none",
+				grantType: "client_credentials",
+				violation: "public-client-credentials",
+				wronglyAllowed: false,
+			},
+		});
+	});
+
+	describe("public-client-secret-accept", () => {
+		it("should issue client_credentials tokens to a public client", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["public-client-secret-accept"],
+			});
+			const response = await requestToken(
+				{ grant_type: "client_credentials", client_id: "public-client" },
+				{ "X-Loki-Session": session.id },
+			);
+
+			expect(response.ok).toBe(true);
+			expect(clientAuthEvent(session.id)?.data.wronglyAllowed).toBe(true);
+			expect(session.getLedger().entries[0]?.evidence).toMatchObject({
+				violation: "public-client-credentials",
+			});
+		});
+
+		it("should accept a secret from a public client", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["public-client-secret-accept"],
+				pluginConfig: { "public-client-secret-accept": { mode: "secret" } },
+			});
+			const response = await requestToken(
+				{ grant_type: "authorization_code", code: "not-a-code" },
+				{ ...publicBasic, "X-Loki-Session": session.id },
+			);
+
+			// Past client authentication, the provider only objects to the code
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toBe("invalid_grant");
+			expect(clientAuthEvent(session.id)?.data).toMatchObject({
+				authMethod: "client_secret_basic",
+				violation: "public-client-secret",
+				wronglyAllowed: true,
+			});
+		});
+	});
+
+	describe("private_key_jwt", () => {
+		const assertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer";
+		let clientKey: jose.KeyLike;
+		let otherKey: jose.KeyLike;
+
+		beforeAll(async () => {
+			const pair = await jose.generateKeyPair("ES256");
+			clientKey = pair.privateKey;
+			otherKey = (await jose.generateKeyPair("ES256")).privateKey;
+			const jwk = { ...(await jose.exportJWK(pair.publicKey)), kid: "ci-1", alg: "ES256" };
+			const response = await registerKeys({ clientId: "test-client", jwks: { keys: [jwk] } });
+			expect(response.status).toBe(201);
+		});
+
+		async function registerKeys(body: unknown): Promise<Response> {
+			return fetch(`${ISSUER}/admin/clients`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+		}
+
+		async function assertion(key: jose.KeyLike, lifetime = 60): Promise<string> {
+			return new jose.SignJWT({})
+				.setProtectedHeader({ alg: "ES256", kid: "ci-1" })
+				.setIssuer("test-client")
+				.setSubject("test-client")
+				.setAudience(`${ISSUER}/token`)
+				.setJti(crypto.randomUUID())
+				.setExpirationTime(Math.floor(Date.now() / 1000) + lifetime)
+				.sign(key);
+		}
+
+		function assertionEvent(sessionId: string) {
+			return loki
+				.getSessionEvents(sessionId)
+				.find((event) => event.type === "client-assertion-checked");
+		}
+
+		it("should list the registered keys and refuse invalid keys or public clients", async () => {
+			const clients = await (await fetch(`${ISSUER}/admin/clients`)).json();
+			expect(clients.clients).toContainEqual(
+				expect.objectContaining({
+					clientId: "test-client",
+					clientType: "confidential",
+					keys: [{ kid: "ci-1", kty: "EC", alg: "ES256" }],
+				}),
+			);
+
+			const unknown = await registerKeys({ clientId: "nobody", jwks: { keys: [] } });
+			expect(unknown.status).toBe(400);
+			expect((await unknown.json()).code).toBe("invalid_client_registration");
+			const pub = await registerKeys({ clientId: "public-client", jwks: { keys: [] } });
+			expect(pub.status).toBe(400);
+			expect((await pub.json()).code).toBe("invalid_client_keys");
+		});
+
+		it("should issue tokens for a valid assertion", async () => {
+			const response = await requestToken({
+				grant_type: "client_credentials",
+				client_assertion_type: assertionType,
+				client_assertion: await assertion(clientKey),
+			});
+
+			expect(response.ok).toBe(true);
+			expect((await response.json()).access_token).toBeDefined();
+		});
+
+		it("should refuse expired and wrongly signed assertions", async () => {
+			const cases = [
+				[await assertion(clientKey, -60), "expired"],
+				[await assertion(otherKey), "wrong-key"],
+			] as const;
+			for (const [client_assertion, failure] of cases) {
+				const response = await requestToken({
+					grant_type: "client_credentials",
+					client_id: "test-client",
+					client_assertion_type: assertionType,
+					client_assertion,
+				});
+
+				expect(response.status).toBe(401);
+				const body = await response.json();
+				expect(body.error).toBe("invalid_client");
+				expect(body.code).toBe("client_assertion_invalid");
+				expect(body.details.failure).toBe(failure);
+			}
+		});
+
+		it("should issue tokens for a failing assertion under client-assertion-bypass", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["client-assertion-bypass"],
+			});
+			const response = await requestToken(
+				{
+					grant_type: "client_credentials",
+					client_assertion_type: assertionType,
+					client_assertion: await assertion(clientKey, -60),
+				},
+				{ "X-Loki-Session": session.id },
+			);
+
+			expect(response.ok).toBe(true);
+			expect(assertionEvent(session.id)?.data).toMatchObject({
+				clientId: "test-client",
+				kid: "ci-1",
+				failure: "expired",
+				wronglyAllowed: true,
+			});
+		});
+	});
+
+	describe("client registry", () => {
+		async function admin(method: string, path: string, body?: unknown): Promise<Response> {
+			return fetch(`${ISSUER}/admin${path}`, {
+				method,
+				headers: { "Content-Type": "application/json" },
+				...(body === undefined ? {} : { body: JSON.stringify(body) }),
+			});
+		}
+
+		const serviceBasic = { Authorization: `Basic ${btoa("service:service-secret")}` };
+
+		it("should refuse token requests from unknown clients", async () => {
+			const response = await requestToken(
+				{ grant_type: "client_credentials" },
+				{ Authorization: `Basic ${btoa("nobody:secret")}` },
+			);
+
+			expect(response.status).toBe(401);
+			const body = await response.json();
+			expect(body.error).toBe("invalid_client");
+			expect(body.code).toBe("client_authentication_failed");
+		});
+
+		it("should issue tokens to a registered client until it is deleted", async () => {
+			const created = await admin("POST", "/clients", {
+				clientId: "service",
+				clientSecret: "service-secret",
+				grantTypes: ["client_credentials"],
+			});
+			expect(created.status).toBe(201);
+			expect(await created.json()).toMatchObject({
+				clientId: "service",
+				clientType: "confidential",
+				source: "admin",
+				grantTypes: ["client_credentials"],
+			});
+
+			const issued = await requestToken({ grant_type: "client_credentials" }, serviceBasic);
+			expect(issued.ok).toBe(true);
+
+			const deleted = await admin("DELETE", "/clients/service");
+			expect(await deleted.json()).toEqual({ deleted: true });
+			const refused = await requestToken({ grant_type: "client_credentials" }, serviceBasic);
+			expect(refused.status).toBe(401);
+			expect((await admin("GET", "/clients/service")).status).toBe(404);
+		});
+
+		it("should run a client's session-less token requests under its default mischief", async () => {
+			await admin("POST", "/clients", {
+				clientId: "service",
+				clientSecret: "service-secret",
+				grantTypes: ["client_credentials"],
+				mischief: ["alg-none"],
+			});
+
+			const response = await requestToken({ grant_type: "client_credentials" }, serviceBasic);
+			const { access_token } = await response.json();
+			expect(jose.decodeProtectedHeader(access_token).alg).toBe("none");
+
+			const status = await (await admin("GET", "/clients/service")).json();
+			expect(status.mischief).toEqual(["alg-none"]);
+			expect(loki.getSession(status.sessionId)).toBeDefined();
+
+			await admin("DELETE", "/clients/service");
+			expect(loki.getSession(status.sessionId)).toBeUndefined();
+		});
+
+		it("should refuse invalid registrations and deleting configured clients", async () => {
+			const cases = [
+				[{ clientId: "" }, "invalid_client_registration"],
+				[{ clientId: "svc", grantTypes: ["password"] }, "invalid_client_registration"],
+				[{ clientId: "svc", grantTypes: ["client_credentials"] }, "invalid_client_registration"],
+				[{ clientId: "test-client", clientSecret: "x" }, "invalid_client_registration"],
+				[{ clientId: "svc", clientSecret: "x", mischief: ["nope"] }, "unknown_mischief"],
+			] as const;
+			for (const [body, code] of cases) {
+				const response = await admin("POST", "/clients", body);
+
+				expect(response.status).toBe(400);
+				expect((await response.json()).code).toBe(code);
+			}
+
+			const configured = await admin("DELETE", "/clients/test-client");
+			expect(configured.status).toBe(400);
+			expect((await configured.json()).code).toBe("client_not_deletable");
+			expect((await admin("DELETE", "/clients/nobody")).status).toBe(404);
+		});
+	});
+
+	it("should refuse to start with a public client registered for client_credentials", async () => {
+		const misconfigured = new Loki({
+			server: { port: PORT + 1, host: "localhost" },
+			provider: {
+				issuer: `http://localhost:${PORT + 1}`,
+				clients: [
+					{
+						client_id: "public-service",
+						token_endpoint_auth_method: "none",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+
+		await expect(misconfigured.start()).rejects.toThrow(/cannot use client_credentials/);
+	});
+});
@@ -0,0 +1,76 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Concurrency Limit", () => {
+	let loki: Loki;
+	const PORT = 9882;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost", maxInFlightRequests: 1 },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	function requestToken(sessionId?: string): Promise<Response> {
+		return fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				...(sessionId ? { "X-Loki-Session": sessionId } : {}),
+			},
+			body: "grant_type=client_credentials",
+		});
+	}
+
+	it("should answer 503 with Retry-After beyond the limit instead of timing out", async () => {
+		const session = loki.createSession({
+			mode: "explicit",
+			mischief: ["latency-injection"],
+			pluginConfig: { "latency-injection": { delayMs: 500 } },
+		});
+
+		const slow = requestToken(session.id);
+		await new Promise((resolve) => setTimeout(resolve, 100));
+
+		const startedAt = Date.now();
+		const rejected = await requestToken();
+		expect(rejected.status).toBe(503);
+		expect(rejected.headers.get("retry-after")).toBe("1");
+		expect(Date.now() - startedAt).toBeLessThan(250);
+
+		const metrics = await (await fetch(`${ISSUER}/metrics`)).text();
+		expect(metrics).toContain("loki_in_flight_requests 1");
+		expect(metrics).toContain("loki_max_in_flight_requests 1");
+		expect(metrics).toContain("loki_rejected_requests_total 1");
+
+		expect((await slow).status).toBe(200);
+	});
+
+	it("should serve requests again once the slot is free", async () => {
+		const response = await requestToken();
+		expect(response.status).toBe(200);
+	});
+
+	it("should keep health checks exempt", async () => {
+		const response = await fetch(`${ISSUER}/health`);
+		expect(response.status).toBe(200);
+	});
+});
@@ -0,0 +1,119 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { DEVICE_CODE_GRANT } from "../../src/core/device-authorization.js";
+import { Loki } from "../../src/index.js";
+
+describe("Device Authorization Grant", () => {
+	let loki: Loki;
+	const PORT = 9890;
+	const ISSUER = `http://localhost:${PORT}`;
+	const AUTHORIZATION = `Basic ${btoa("device-client:device-secret")}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "device-client",
+						client_secret: "device-secret",
+						grant_types: [DEVICE_CODE_GRANT],
+					},
+				],
+				deviceCodeTtl: 2,
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	async function authorizeDevice(): Promise<Record<string, unknown>> {
+		const response = await fetch(`${ISSUER}/device_authorization`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: AUTHORIZATION,
+			},
+			body: "scope=openid",
+		});
+		expect(response.status).toBe(200);
+		return response.json();
+	}
+
+	async function poll(deviceCode: unknown, sessionId?: string): Promise<Response> {
+		const headers: Record<string, string> = {
+			"Content-Type": "application/x-www-form-urlencoded",
+			Authorization: AUTHORIZATION,
+		};
+		if (sessionId) {
+			headers["X-Loki-Session"] = sessionId;
+		}
+		return fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers,
+			body: new URLSearchParams({
+				grant_type: DEVICE_CODE_GRANT,
+				device_code: String(deviceCode),
+			}).toString(),
+		});
+	}
+
+	it("should issue device and user codes with a polling interval", async () => {
+		const authorization = await authorizeDevice();
+
+		expect(typeof authorization.device_code).toBe("string");
+		expect(typeof authorization.user_code).toBe("string");
+		expect(String(authorization.verification_uri)).toMatch(/^http:\/\/localhost:9890\//);
+		expect(typeof authorization.interval).toBe("number");
+		expect(authorization.expires_in).toBe(2);
+	});
+
+	it("should advertise the device authorization endpoint", async () => {
+		const discovery = await (await fetch(`${ISSUER}/.well-known/openid-configuration`)).json();
+		expect(discovery.device_authorization_endpoint).toBe(`${ISSUER}/device_authorization`);
+	});
+
+	it("should keep an unapproved device pending", async () => {
+		const { device_code: deviceCode } = await authorizeDevice();
+		const response = await poll(deviceCode);
+
+		expect(response.status).toBe(400);
+		expect((await response.json()).error).toBe("authorization_pending");
+	});
+
+	it("should answer expired device codes with expired_token", async () => {
+		const { device_code: deviceCode } = await authorizeDevice();
+		await new Promise((resolve) => setTimeout(resolve, 2100));
+		const response = await poll(deviceCode);
+
+		expect(response.status).toBe(400);
+		const body = await response.json();
+		expect(body.error).toBe("expired_token");
+		expect(body.code).toBe("device_code_expired");
+	});
+
+	it("should keep every poll pending under slow-down-storm", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["slow-down-storm"] });
+		const { device_code: deviceCode, interval } = await authorizeDevice();
+
+		for (let i = 0; i < 2; i++) {
+			const response = await poll(deviceCode, session.id);
+			expect(response.status).toBe(400);
+			const body = await response.json();
+			expect(body.error).toBe("authorization_pending");
+			expect(body.code).toBe("device_authorization_pending");
+		}
+
+		const entries = session.getLedger().entries;
+		expect(entries.map((entry) => entry.plugin.id)).toEqual(["slow-down-storm", "slow-down-storm"]);
+		expect(entries[1]?.evidence).toMatchObject({ polls: 2, interval, respectedInterval: false });
+
+		const polled = session.getEvents().filter((event) => event.type === "device-code-polled");
+		expect(polled.map((event) => event.data.outcome)).toEqual(["pending", "pending"]);
+		expect(polled[0]?.data.sinceLastPollMs).toBeNull();
+	});
+});
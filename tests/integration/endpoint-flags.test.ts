@@ -0,0 +1,76 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Endpoint Flags", () => {
+	let loki: Loki;
+	const PORT = 9887;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+				endpoints: { "/userinfo": false, introspection: false },
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	it("should answer 404 at a disabled endpoint", async () => {
+		const cases = [
+			{ path: "/me", method: "GET" },
+			{ path: "/token/introspection", method: "POST" },
+		];
+		for (const { path, method } of cases) {
+			const response = await fetch(`${ISSUER}${path}`, { method });
+			expect(response.status).toBe(404);
+			const body = await response.json();
+			expect(body.error).toBe("invalid_request");
+			expect(body.code).toBe("endpoint_disabled");
+		}
+	});
+
+	it("should leave disabled endpoints out of discovery", async () => {
+		const response = await fetch(`${ISSUER}/.well-known/openid-configuration`);
+		const discovery = await response.json();
+
+		expect(discovery.userinfo_endpoint).toBeUndefined();
+		expect(discovery.introspection_endpoint).toBeUndefined();
+		expect(discovery.token_endpoint).toBe(`${ISSUER}/token`);
+		expect(discovery.revocation_endpoint).toBe(`${ISSUER}/token/revocation`);
+	});
+
+	it("should advertise the trimmed document's length to HEAD", async () => {
+		const get = await fetch(`${ISSUER}/.well-known/openid-configuration`);
+		const body = await get.text();
+		const head = await fetch(`${ISSUER}/.well-known/openid-configuration`, { method: "HEAD" });
+
+		expect(head.headers.get("content-length")).toBe(String(Buffer.byteLength(body)));
+	});
+
+	it("should keep serving enabled endpoints", async () => {
+		const response = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+			},
+			body: "grant_type=client_credentials",
+		});
+
+		expect(response.status).toBe(200);
+	});
+});
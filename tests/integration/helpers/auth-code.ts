@@ -0,0 +1,114 @@
+/**
+ * Authorization code flow driver for integration tests
+ *
+ * Follows an authorization request through the development login and
+ * consent pages the way a browser would, carrying cookies and the
+ * `X-Loki-Session` header, then redeems the code with PKCE.
+ */
+
+import { s256Challenge } from "../../../src/core/pkce.js";
+
+/** Redirect URI the test clients register */
+export const REDIRECT_URI = "http://localhost:8080/callback";
+
+/** PKCE verifier sent with every flow (RFC 7636 Appendix B) */
+export const VERIFIER = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk";
+
+export interface AuthCodeFlow {
+	issuer: string;
+	sessionId: string;
+	/** Default: spa-client */
+	clientId?: string;
+	/** Default: REDIRECT_URI */
+	redirectUri?: string;
+	/** Default: openid */
+	scope?: string;
+	/** Further authorization request parameters, e.g. nonce, claims or response_mode */
+	params?: Record<string, string>;
+}
+
+/**
+ * Run the authorization request through the login and consent pages,
+ * returning the response that leaves the issuer: a redirect to the
+ * client, a form post, or an error
+ */
+export async function followAuthorization(flow: AuthCodeFlow): Promise<Response> {
+	const { issuer, sessionId } = flow;
+	const cookies = new Map<string, string>();
+	const send = async (url: string, init: RequestInit = {}): Promise<Response> => {
+		const headers = new Headers(init.headers);
+		headers.set("X-Loki-Session", sessionId);
+		headers.set("Cookie", [...cookies].map(([name, value]) => `${name}=${value}`).join("; "));
+		const response = await fetch(url, { ...init, headers, redirect: "manual" });
+		for (const cookie of response.headers.getSetCookie()) {
+			const [pair = ""] = cookie.split(";");
+			const separator = pair.indexOf("=");
+			cookies.set(pair.slice(0, separator), pair.slice(separator + 1));
+		}
+		return response;
+	};
+
+	const query = new URLSearchParams({
+		client_id: flow.clientId ?? "spa-client",
+		response_type: "code",
+		scope: flow.scope ?? "openid",
+		redirect_uri: flow.redirectUri ?? REDIRECT_URI,
+		code_challenge: s256Challenge(VERIFIER),
+		code_challenge_method: "S256",
+		...flow.params,
+	});
+	let response = await send(`${issuer}/authorize?${query}`);
+	for (let step = 0; step < 10; step++) {
+		const location = response.headers.get("location");
+		if (!location || new URL(location, issuer).origin !== new URL(issuer).origin) {
+			return response;
+		}
+		const next = new URL(location, issuer);
+		if (next.pathname.startsWith("/interaction/")) {
+			const page = await (await send(next.href)).text();
+			const prompt = page.includes('name="password"') ? "login" : "consent";
+			response = await send(next.href, {
+				method: "POST",
+				headers: { "Content-Type": "application/x-www-form-urlencoded" },
+				body: new URLSearchParams({ prompt, login: "alice", password: "x" }).toString(),
+			});
+		} else {
+			response = await send(next.href);
+		}
+	}
+	throw new Error("authorization did not leave the issuer");
+}
+
+/**
+ * Run the authorization request, returning the code the client is redirected with
+ */
+export async function authorizationCode(flow: AuthCodeFlow): Promise<string> {
+	const location = (await followAuthorization(flow)).headers.get("location") ?? "";
+	const code = new URL(location, flow.issuer).searchParams.get("code");
+	if (!code) {
+		throw new Error("authorization did not redirect with a code");
+	}
+	return code;
+}
+
+/**
+ * Run the whole flow, returning the token response
+ */
+export async function signInWithCode<T>(flow: AuthCodeFlow): Promise<T> {
+	const code = await authorizationCode(flow);
+	const response = await fetch(`${flow.issuer}/token`, {
+		method: "POST",
+		headers: {
+			"Content-Type": "application/x-www-form-urlencoded",
+			"X-Loki-Session": flow.sessionId,
+		},
+		body: new URLSearchParams({
+			grant_type: "authorization_code",
+			code,
+			redirect_uri: flow.redirectUri ?? REDIRECT_URI,
+			client_id: flow.clientId ?? "spa-client",
+			code_verifier: VERIFIER,
+		}).toString(),
+	});
+	return (await response.json()) as T;
+}
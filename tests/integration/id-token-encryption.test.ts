@@ -0,0 +1,106 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+import { REDIRECT_URI, signInWithCode } from "./helpers/auth-code.js";
+
+describe("ID Token Encryption", () => {
+	let loki: Loki;
+	let privateKey: jose.KeyLike;
+	const PORT = 9900;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: { issuer: ISSUER },
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+
+		const pair = await jose.generateKeyPair("RSA-OAEP", { extractable: true });
+		privateKey = pair.privateKey;
+		const jwk = { ...(await jose.exportJWK(pair.publicKey)), kid: "enc-1" };
+		const registered = await fetch(`${ISSUER}/admin/clients`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify({
+				clientId: "sealed-spa",
+				redirectUris: [REDIRECT_URI],
+				idTokenEncryption: { jwk },
+			}),
+		});
+		expect(registered.status).toBe(201);
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	/**
+	 * Sign in, returning the ID token as sent
+	 */
+	async function signIn(sessionId: string): Promise<string> {
+		const tokens = await signInWithCode<{ id_token: string }>({
+			issuer: ISSUER,
+			sessionId,
+			clientId: "sealed-spa",
+		});
+		return tokens.id_token;
+	}
+
+	/** Decrypt as a client accepting only the alg and enc it registered */
+	function decrypt(jwe: string) {
+		return jose.compactDecrypt(jwe, privateKey, {
+			keyManagementAlgorithms: ["RSA-OAEP"],
+			contentEncryptionAlgorithms: ["A256GCM"],
+		});
+	}
+
+	it("should encrypt the signed ID token to the client's key", async () => {
+		const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const jwe = await signIn(session.id);
+
+		expect(jwe.split(".")).toHaveLength(5);
+		const { plaintext, protectedHeader } = await decrypt(jwe);
+		expect(protectedHeader).toEqual({ alg: "RSA-OAEP", enc: "A256GCM", cty: "JWT", kid: "enc-1" });
+		const { payload } = await jose.jwtVerify(new TextDecoder().decode(plaintext), jwks);
+		expect(payload.aud).toBe("sealed-spa");
+
+		const status = await (await fetch(`${ISSUER}/admin/clients/sealed-spa`)).json();
+		expect(status.idTokenEncryption).toEqual({ alg: "RSA-OAEP", enc: "A256GCM", kid: "enc-1" });
+	});
+
+	it("should corrupt the auth tag or re-encrypt with an unregistered enc", async () => {
+		const tagged = loki.createSession({ mode: "explicit", mischief: ["jwe-tampering"] });
+		await expect(decrypt(await signIn(tagged.id))).rejects.toThrow();
+
+		const swapped = loki.createSession({
+			mode: "explicit",
+			mischief: ["jwe-tampering"],
+			pluginConfig: { "jwe-tampering": { mode: "enc" } },
+		});
+		const jwe = await signIn(swapped.id);
+		expect(jose.decodeProtectedHeader(jwe).enc).toBe("A128CBC-HS256");
+		await expect(decrypt(jwe)).rejects.toThrow();
+		await expect(jose.compactDecrypt(jwe, privateKey)).resolves.toBeDefined();
+
+		const [entry] = swapped.getLedger().entries;
+		expect(entry?.plugin.id).toBe("jwe-tampering");
+	});
+
+	it("should reject an encryption key that doesn't fit its alg", async () => {
+		const response = await fetch(`${ISSUER}/admin/clients`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify({
+				clientId: "bad-enc",
+				idTokenEncryption: { jwk: { kty: "EC", crv: "P-256", x: "x", y: "y" }, alg: "RSA-OAEP" },
+			}),
+		});
+
+		expect(response.status).toBe(400);
+		const { error } = await response.json();
+		expect(error).toBe("idTokenEncryption.jwk must be an RSA key for RSA-OAEP");
+	});
+});
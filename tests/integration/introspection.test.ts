@@ -0,0 +1,160 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Token Introspection", () => {
+	let loki: Loki;
+	const PORT = 9892;
+	const ISSUER = `http://localhost:${PORT}`;
+	const AUTHORIZATION = `Basic ${btoa("test-client:test-secret")}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	async function issueToken(sessionId?: string, scope?: string): Promise<string> {
+		const headers: Record<string, string> = {
+			"Content-Type": "application/x-www-form-urlencoded",
+			Authorization: AUTHORIZATION,
+		};
+		if (sessionId) {
+			headers["X-Loki-Session"] = sessionId;
+		}
+		const response = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers,
+			body: new URLSearchParams({
+				grant_type: "client_credentials",
+				...(scope ? { scope } : {}),
+			}).toString(),
+		});
+		return ((await response.json()) as { access_token: string }).access_token;
+	}
+
+	async function introspect(
+		token: string,
+		options: { sessionId?: string; authorization?: string } = {},
+	): Promise<Response> {
+		const headers: Record<string, string> = {
+			"Content-Type": "application/x-www-form-urlencoded",
+			Authorization: options.authorization ?? AUTHORIZATION,
+		};
+		if (options.sessionId) {
+			headers["X-Loki-Session"] = options.sessionId;
+		}
+		return fetch(`${ISSUER}/introspect`, {
+			method: "POST",
+			headers,
+			body: new URLSearchParams({ token }).toString(),
+		});
+	}
+
+	it("should report an issued token as active, with its claims", async () => {
+		const token = await issueToken();
+		const response = await introspect(token);
+
+		expect(response.status).toBe(200);
+		expect(response.headers.get("cache-control")).toBe("no-store");
+		const body = await response.json();
+		expect(body).toMatchObject({ active: true, client_id: "test-client", iss: ISSUER });
+		expect(typeof body.exp).toBe("number");
+	});
+
+	it("should report tampered, revoked and unknown tokens as inactive", async () => {
+		const token = await issueToken();
+		const [header, payload] = token.split(".");
+		const tampered = `${header}.${payload}.${"A".repeat(86)}`;
+		expect(await (await introspect(tampered)).json()).toEqual({ active: false });
+		expect(await (await introspect("never-issued")).json()).toEqual({ active: false });
+
+		const revoked = await fetch(`${ISSUER}/token/revocation`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: AUTHORIZATION,
+			},
+			body: new URLSearchParams({ token }).toString(),
+		});
+		expect(revoked.status).toBe(200);
+		expect(await (await introspect(token)).json()).toEqual({ active: false });
+	});
+
+	it("should answer a session's expired token truthfully without mischief", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["temporal-tampering"] });
+		const token = await issueToken(session.id);
+
+		const body = await (await introspect(token, { sessionId: session.id })).json();
+		expect(body).toEqual({ active: false });
+		const event = session.getEvents().find((e) => e.type === "token-introspected");
+		expect(event?.data).toMatchObject({ reason: "expired", reportedActive: false });
+	});
+
+	it("should report expired and unknown tokens as active under introspection-lies", async () => {
+		const session = loki.createSession({
+			mode: "explicit",
+			mischief: ["temporal-tampering", "introspection-lies"],
+		});
+		const token = await issueToken(session.id);
+
+		const expired = await (await introspect(token, { sessionId: session.id })).json();
+		expect(expired.active).toBe(true);
+		expect(expired.exp).toBeLessThan(Math.floor(Date.now() / 1000));
+		const unknown = await (await introspect("never-issued", { sessionId: session.id })).json();
+		expect(unknown).toEqual({ active: true });
+
+		const entries = session.getLedger().entries;
+		const lies = entries.filter((entry) => entry.plugin.id === "introspection-lies");
+		expect(lies.map((entry) => entry.evidence.reason)).toEqual(["expired", "unknown"]);
+		const events = session.getEvents().filter((e) => e.type === "token-introspected");
+		expect(events.map((e) => e.data.reportedActive)).toEqual([true, true]);
+	});
+
+	it("should report the granted scope, not the scope an escalated token claims", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["scope-escalation"] });
+		const token = await issueToken(session.id, "read write");
+
+		const [, payload] = token.split(".");
+		const claims = JSON.parse(Buffer.from(payload ?? "", "base64url").toString());
+		expect(claims.scope).toBe("read write admin");
+
+		const body = await (await introspect(token, { sessionId: session.id })).json();
+		expect(body).toMatchObject({ active: true, scope: "read write" });
+	});
+
+	it("should require client authentication and a token", async () => {
+		const token = await issueToken();
+		const wrongSecret = `Basic ${btoa("test-client:wrong")}`;
+
+		const unauthenticated = await introspect(token, { authorization: wrongSecret });
+		expect(unauthenticated.status).toBe(401);
+		expect((await unauthenticated.json()).code).toBe("client_authentication_failed");
+
+		const missing = await fetch(`${ISSUER}/introspect`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: AUTHORIZATION,
+			},
+			body: "",
+		});
+		expect(missing.status).toBe(400);
+		expect((await missing.json()).code).toBe("token_missing");
+	});
+});
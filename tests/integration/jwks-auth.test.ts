@@ -0,0 +1,80 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("JWKS Auth", () => {
+	let loki: Loki;
+	const PORT = 9888;
+	const ISSUER = `http://localhost:${PORT}`;
+	const bearer = { Authorization: "Bearer jwks-secret" };
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [{ client_id: "test-client", client_secret: "test-secret" }],
+				jwksBearerToken: "jwks-secret",
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	function jwksEvents(sessionId: string) {
+		return loki.getSessionEvents(sessionId).filter((event) => event.type === "jwks-served");
+	}
+
+	it("should refuse unauthenticated JWKS fetches", async () => {
+		for (const path of ["/jwks", "/.well-known/jwks.json"]) {
+			const response = await fetch(`${ISSUER}${path}`);
+
+			expect(response.status).toBe(401);
+			expect(response.headers.get("www-authenticate")).toBe('Bearer realm="jwks"');
+			const body = await response.json();
+			expect(body.keys).toBeUndefined();
+			expect(body.code).toBe("jwks_auth_required");
+		}
+	});
+
+	it("should serve the JWKS to fetches with the bearer token", async () => {
+		const response = await fetch(`${ISSUER}/jwks`, { headers: bearer });
+
+		expect(response.status).toBe(200);
+		const body = await response.json();
+		expect(body.keys.length).toBeGreaterThan(0);
+	});
+
+	it("should record which key set each session fetch got", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const headers = { "X-Loki-Session": session.id };
+
+		await fetch(`${ISSUER}/jwks`, { headers });
+		await fetch(`${ISSUER}/jwks`, { headers: { ...headers, ...bearer } });
+
+		expect(jwksEvents(session.id).map((event) => event.data)).toEqual([
+			expect.objectContaining({ authenticated: false, keySet: null, status: 401, kids: [] }),
+			expect.objectContaining({ authenticated: true, keySet: "real", status: 200 }),
+		]);
+	});
+
+	it("should serve decoys to unauthenticated fetches with jwks-decoy-keys", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["jwks-decoy-keys"] });
+		const headers = { "X-Loki-Session": session.id };
+
+		const decoy = await fetch(`${ISSUER}/jwks`, { headers });
+		const real = await fetch(`${ISSUER}/jwks`, { headers: { ...headers, ...bearer } });
+
+		expect(decoy.status).toBe(200);
+		const decoyKeys = (await decoy.json()).keys;
+		const realKeys = (await real.json()).keys;
+		expect(decoyKeys.map((key: { kid: string }) => key.kid)).toEqual(
+			realKeys.map((key: { kid: string }) => key.kid),
+		);
+		expect(decoyKeys[0].n).not.toBe(realKeys[0].n);
+		expect(jwksEvents(session.id).map((event) => event.data.keySet)).toEqual(["decoy", "real"]);
+	});
+});
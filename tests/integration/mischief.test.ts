@@ -1,4 +1,7 @@
+import { X509Certificate } from "node:crypto";
+import * as jose from "jose";
 import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { attackerKey } from "../../src/core/attacker-keys.js";
 import { Loki } from "../../src/index.js";
 
 describe("Mischief Integration", () => {
@@ -17,6 +20,12 @@ describe("Mischief Integration", () => {
 						client_secret: "test-secret",
 						grant_types: ["client_credentials"],
 					},
+					{
+						client_id: "web-client",
+						client_secret: "web-secret-with-enough-entropy-for-hs256",
+						redirect_uris: ["http://localhost:8080/callback"],
+						grant_types: ["authorization_code"],
+					},
 				],
 			},
 			// Disable persistence for clean test runs
@@ -71,6 +80,26 @@ describe("Mischief Integration", () => {
 			expect(ledger.entries.length).toBeGreaterThan(0);
 			expect(ledger.entries[0]?.plugin.id).toBe("alg-none");
 		});
+
+		it("should send an alg:none token with exactly the recorded garbage signature", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["none-with-signature"] });
+
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": session.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const { access_token: token } = (await response.json()) as { access_token: string };
+
+			expect(jose.decodeProtectedHeader(token).alg).toBe("none");
+			const [entry] = session.getLedger().entries;
+			expect(entry?.evidence).toMatchObject({ segments: token.split(".") });
+			expect(token.split(".")[2]).not.toBe("");
+		});
 	});
 
 	describe("key-confusion attack", () => {
@@ -117,104 +146,212 @@ describe("Mischief Integration", () => {
 		});
 	});
 
-	describe("temporal-tampering attack", () => {
-		it("should produce expired token when temporal-tampering is enabled", async () => {
-			// Create session with temporal-tampering enabled
-			const session = loki.createSession({
-				name: "temporal-test",
-				mode: "explicit",
-				mischief: ["temporal-tampering"],
+	describe("ec-key-confusion attack", () => {
+		it("should HS256-sign with the EC key's JWK exactly as the JWKS serves it", async () => {
+			const registered = await fetch(`${ISSUER}/admin/keys`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ id: "ec-confusion", alg: "ES256" }),
 			});
+			const { kid } = (await registered.json()) as { kid: string };
+			try {
+				const created = await fetch(`${ISSUER}/admin/sessions`, {
+					method: "POST",
+					headers: { "Content-Type": "application/json" },
+					body: JSON.stringify({ mischief: ["ec-key-confusion"], keyId: "ec-confusion" }),
+				});
+				const { sessionId } = (await created.json()) as { sessionId: string };
+				const response = await fetch(`${ISSUER}/token`, {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/x-www-form-urlencoded",
+						Authorization: `Basic ${btoa("test-client:test-secret")}`,
+						"X-Loki-Session": sessionId,
+					},
+					body: "grant_type=client_credentials",
+				});
+				const { access_token: token } = (await response.json()) as { access_token: string };
 
-			// Request a token with the session header
+				const served = await (await fetch(`${ISSUER}/jwks`)).text();
+				const entry = served.match(new RegExp(`\\{[^{}]*"kid":"${kid}"[^{}]*\\}`))?.[0] ?? "";
+				expect(JSON.parse(entry)).toMatchObject({ kty: "EC", crv: "P-256", kid });
+				const secret = new TextEncoder().encode(entry);
+				const { protectedHeader } = await jose.compactVerify(token, secret);
+				expect(protectedHeader).toMatchObject({ alg: "HS256", kid });
+			} finally {
+				await fetch(`${ISSUER}/admin/keys/ec-confusion`, { method: "DELETE" });
+			}
+		});
+	});
+
+	describe("jku injection", () => {
+		async function issueToken(sessionId: string): Promise<string> {
 			const response = await fetch(`${ISSUER}/token`, {
 				method: "POST",
 				headers: {
 					"Content-Type": "application/x-www-form-urlencoded",
 					Authorization: `Basic ${btoa("test-client:test-secret")}`,
-					"X-Loki-Session": session.id,
+					"X-Loki-Session": sessionId,
 				},
 				body: "grant_type=client_credentials",
 			});
-
 			expect(response.ok).toBe(true);
+			return ((await response.json()) as { access_token: string }).access_token;
+		}
 
-			const _data = (await response.json()) as { access_token?: string };
+		it("should serve the attacker key the jku header points at", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["jku-injection"] });
+			const token = await issueToken(session.id);
+			const header = jose.decodeProtectedHeader(token);
+			expect(header.jku).toBe(`${ISSUER}/admin/rogue-jwks/${session.id}`);
 
-			// Check ledger recorded the tampering
-			const ledger = session.getLedger();
-			expect(ledger.entries.length).toBeGreaterThan(0);
+			const rogue = await fetch(header.jku ?? "");
+			expect(rogue.status).toBe(200);
+			const { keys } = (await rogue.json()) as { keys: jose.JWK[] };
+			const key = keys.find((candidate) => candidate.kid === header.kid);
+			expect(key).toBeDefined();
+			await jose.compactVerify(token, await jose.importJWK(key ?? {}, header.alg));
 
-			const temporalEntry = ledger.entries.find((e) => e.plugin.id === "temporal-tampering");
-			expect(temporalEntry).toBeDefined();
-			expect(temporalEntry?.evidence.mode).toBe("expired");
+			const published = (await (await fetch(`${ISSUER}/jwks`)).json()) as { keys: jose.JWK[] };
+			expect(published.keys.map((candidate) => candidate.kid)).not.toContain(header.kid);
+
+			const fetched = session.getEvents().filter((event) => event.type === "rogue-jwks-fetched");
+			expect(fetched).toHaveLength(1);
+			expect(fetched[0]?.data.kids).toEqual([header.kid]);
+		});
+
+		it("should point jku at a session's jkuTarget", async () => {
+			const jkuTarget = "http://169.254.169.254/latest/meta-data/jwks";
+			const created = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: ["jku-injection"], jkuTarget }),
+			});
+			const { sessionId } = (await created.json()) as { sessionId: string };
+
+			const header = jose.decodeProtectedHeader(await issueToken(sessionId));
+			expect(header.jku).toBe(jkuTarget);
+		});
+
+		it("should reject a jkuTarget that isn't an absolute URL", async () => {
+			const response = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: ["jku-injection"], jkuTarget: "/jwks" }),
+			});
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toBe("jkuTarget must be an absolute URL");
+		});
+
+		it("should 404 the rogue JWKS of a session that served no keys", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+			const response = await fetch(`${ISSUER}/admin/rogue-jwks/${session.id}`);
+			expect(response.status).toBe(404);
+			expect((await response.json()).code).toBe("rogue_jwks_not_found");
 		});
 	});
 
-	describe("session modes", () => {
-		it("should not apply mischief without session header", async () => {
-			// Request token WITHOUT session header
+	describe("x5u and x5c injection", () => {
+		async function issueToken(sessionId: string): Promise<string> {
 			const response = await fetch(`${ISSUER}/token`, {
 				method: "POST",
 				headers: {
 					"Content-Type": "application/x-www-form-urlencoded",
 					Authorization: `Basic ${btoa("test-client:test-secret")}`,
-					// No X-Loki-Session header
+					"X-Loki-Session": sessionId,
 				},
 				body: "grant_type=client_credentials",
 			});
-
 			expect(response.ok).toBe(true);
+			return ((await response.json()) as { access_token: string }).access_token;
+		}
 
-			const data = (await response.json()) as { access_token?: string };
+		it("should serve the certificate chain the x5u header points at", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["x5u-injection"] });
+			const token = await issueToken(session.id);
+			const header = jose.decodeProtectedHeader(token);
+			expect(header.x5u).toBe(`${ISSUER}/admin/rogue-x5u/${session.id}`);
 
-			// Token should be normal (not alg:none)
-			if (data.access_token?.includes(".")) {
-				const parts = data.access_token.split(".");
-				const header = JSON.parse(atob(parts[0]?.replace(/-/g, "+").replace(/_/g, "/")));
-				// Should NOT be alg:none
-				expect(header.alg).not.toBe("none");
-			}
+			const rogue = await fetch(header.x5u ?? "");
+			expect(rogue.status).toBe(200);
+			expect(rogue.headers.get("content-type")).toContain("application/pem-certificate-chain");
+			const cert = new X509Certificate(await rogue.text());
+			await jose.compactVerify(token, cert.publicKey);
+
+			const fetched = session.getEvents().filter((event) => event.type === "rogue-x5u-fetched");
+			expect(fetched).toHaveLength(1);
+			expect(fetched[0]?.data.x5tS256).toEqual([header["x5t#S256"]]);
 		});
 
-		it("should apply mischief only to session with enabled plugins", async () => {
-			// Create session WITHOUT any mischief
-			const cleanSession = loki.createSession({
-				name: "clean-session",
+		it("should embed a certificate whose key verifies the token in x5c", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["x5c-injection"] });
+			const token = await issueToken(session.id);
+			const header = jose.decodeProtectedHeader(token);
+
+			const cert = new X509Certificate(Buffer.from(header.x5c?.[0] ?? "", "base64"));
+			await jose.compactVerify(token, cert.publicKey);
+
+			const published = (await (await fetch(`${ISSUER}/jwks`)).json()) as { keys: jose.JWK[] };
+			expect(published.keys.map((candidate) => candidate.kid)).not.toContain(header.kid);
+			expect(session.getLedger().entries.at(-1)?.plugin.id).toBe("x5c-injection");
+		});
+
+		it("should 404 the rogue chain of a session that served none", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+			const response = await fetch(`${ISSUER}/admin/rogue-x5u/${session.id}`);
+			expect(response.status).toBe(404);
+			expect((await response.json()).code).toBe("rogue_x5u_not_found");
+		});
+	});
+
+	describe("kid confusion", () => {
+		it("should sign under a published kid with a key the JWKS never advertises", async () => {
+			// Listed signing-first: claims plugins still run before the throwaway signature
+			const session = loki.createSession({
 				mode: "explicit",
-				mischief: [], // No mischief enabled
+				mischief: ["kid-confusion", "temporal-tampering"],
 			});
-
-			// Request token with clean session
 			const response = await fetch(`${ISSUER}/token`, {
 				method: "POST",
 				headers: {
 					"Content-Type": "application/x-www-form-urlencoded",
 					Authorization: `Basic ${btoa("test-client:test-secret")}`,
-					"X-Loki-Session": cleanSession.id,
+					"X-Loki-Session": session.id,
 				},
 				body: "grant_type=client_credentials",
 			});
+			const { access_token: token } = (await response.json()) as { access_token: string };
+			const header = jose.decodeProtectedHeader(token);
 
-			expect(response.ok).toBe(true);
+			const published = (await (await fetch(`${ISSUER}/jwks`)).json()) as { keys: jose.JWK[] };
+			const key = published.keys.find((candidate) => candidate.kid === header.kid);
+			expect(key).toBeDefined();
+			await expect(
+				jose.compactVerify(token, await jose.importJWK(key ?? {}, header.alg)),
+			).rejects.toThrow();
 
-			// Ledger should be empty
-			const ledger = cleanSession.getLedger();
-			expect(ledger.entries).toHaveLength(0);
+			const attacker = await attackerKey("RS256");
+			expect(published.keys.map((candidate) => candidate.kid)).not.toContain(attacker.kid);
+			const { payload } = await jose.compactVerify(
+				token,
+				await jose.importJWK(attacker.publicJwk, "RS256"),
+			);
+			const claims = JSON.parse(new TextDecoder().decode(payload)) as { exp: number };
+			expect(claims.exp).toBeLessThan(Math.floor(Date.now() / 1000));
+
+			const pluginIds = session.getLedger().entries.map((entry) => entry.plugin.id);
+			expect(pluginIds).toEqual(["temporal-tampering", "kid-confusion"]);
 		});
 	});
 
-	describe("ledger tracking", () => {
-		it("should track multiple mischief applications", async () => {
-			// Create session with multiple mischief plugins
+	describe("typ confusion", () => {
+		it("should type an access token JWT instead of at+jwt, validly signed", async () => {
 			const session = loki.createSession({
-				name: "multi-mischief",
 				mode: "explicit",
-				mischief: ["alg-none", "temporal-tampering"],
+				mischief: ["typ-confusion"],
+				warmupRequests: 1,
 			});
-
-			// Make multiple requests
-			for (let i = 0; i < 3; i++) {
+			for (let i = 0; i < 2; i++) {
 				await fetch(`${ISSUER}/token`, {
 					method: "POST",
 					headers: {
@@ -226,17 +363,2045 @@ describe("Mischief Integration", () => {
 				});
 			}
 
-			const ledger = session.getLedger();
+			const response = await fetch(`${ISSUER}/admin/sessions/${session.id}/report`);
+			const [baseline, confused] = (await response.json()).issuances;
+			expect(baseline.header.typ).toBe("at+jwt");
+			expect(confused.header.typ).toBe("JWT");
+			expect(confused.changes.header).toEqual([{ name: "typ", before: "at+jwt", after: "JWT" }]);
+			expect(confused.signingKey.source).toBe("loki");
+			expect(confused.mutations[0].evidence.renderedHeader).toContain('"typ":"JWT"');
+		});
+	});
 
-			// Should have entries for both plugins across 3 requests
-			// (alg-none for signing, temporal-tampering for claims)
+	describe("iss mismatch", () => {
+		it("should issue a validly signed token from an impersonated issuer", async () => {
+			const cases = [
+				{ body: { mischief: ["iss-mismatch"] }, issuer: "https://accounts.google.com" },
+				{
+					body: { mischief: ["iss-mismatch"], issTarget: "https://login.example/v2.0" },
+					issuer: "https://login.example/v2.0",
+				},
+			];
+			const discovery = await (await fetch(`${ISSUER}/.well-known/openid-configuration`)).json();
+			const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+			expect(discovery.issuer).toBe(ISSUER);
+
+			for (const { body, issuer } of cases) {
+				const created = await fetch(`${ISSUER}/admin/sessions`, {
+					method: "POST",
+					headers: { "Content-Type": "application/json" },
+					body: JSON.stringify(body),
+				});
+				const { sessionId } = (await created.json()) as { sessionId: string };
+				const response = await fetch(`${ISSUER}/token`, {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/x-www-form-urlencoded",
+						Authorization: `Basic ${btoa("test-client:test-secret")}`,
+						"X-Loki-Session": sessionId,
+					},
+					body: "grant_type=client_credentials",
+				});
+				const { access_token: token } = (await response.json()) as { access_token: string };
+
+				const { payload } = await jose.jwtVerify(token, jwks);
+				expect(payload.iss).toBe(issuer);
+				await expect(jose.jwtVerify(token, jwks, { issuer: ISSUER })).rejects.toThrow();
+
+				const report = loki.getSessionReport(sessionId);
+				const mutation = report?.issuances[0]?.mutations[0];
+				expect(mutation?.evidence).toEqual({ expectedIssuer: ISSUER, issuer });
+			}
+		});
+	});
+
+	describe("embedded jwk", () => {
+		async function issueToken(body: unknown): Promise<string> {
+			const created = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+			const { sessionId } = (await created.json()) as { sessionId: string };
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const { access_token: token } = (await response.json()) as { access_token: string };
+			return token;
+		}
+
+		it("should embed a key the JWKS doesn't advertise, optionally under its kid", async () => {
+			const jwks = (await (await fetch(`${ISSUER}/jwks`)).json()) as { keys: jose.JWK[] };
+			const cases = [
+				{ body: { mischief: ["embedded-jwk"] }, collides: false },
+				{ body: { mischief: ["embedded-jwk"], embeddedJwkKidCollision: true }, collides: true },
+			];
+
+			for (const { body, collides } of cases) {
+				const token = await issueToken(body);
+				const header = jose.decodeProtectedHeader(token);
+				const embedded = header.jwk ?? {};
+
+				await jose.compactVerify(token, await jose.importJWK(embedded, header.alg));
+				await expect(jose.jwtVerify(token, jose.createLocalJWKSet(jwks))).rejects.toThrow();
+				expect(jwks.keys.map((key) => key.n)).not.toContain(embedded.n);
+				expect(jwks.keys.map((key) => key.kid).includes(header.kid)).toBe(collides);
+			}
+		});
+
+		it("should reject a non-boolean embeddedJwkKidCollision", async () => {
+			const response = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: ["embedded-jwk"], embeddedJwkKidCollision: "yes" }),
+			});
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toBe("embeddedJwkKidCollision must be a boolean");
+		});
+	});
+
+	describe("jwks key rotation race", () => {
+		async function createSession(body: unknown): Promise<string> {
+			const created = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+			return ((await created.json()) as { sessionId: string }).sessionId;
+		}
+
+		async function fetchJwks(sessionId: string): Promise<{ keys: jose.JWK[] }> {
+			const response = await fetch(`${ISSUER}/jwks`, { headers: { "X-Loki-Session": sessionId } });
+			return (await response.json()) as { keys: jose.JWK[] };
+		}
+
+		it("should serve the signing key for the window's fetches, then drop it", async () => {
+			const sessionId = await createSession({
+				mischief: ["jwks-key-rotation-race"],
+				jwksRaceWindow: { fetches: 2 },
+			});
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const { access_token: token } = (await response.json()) as { access_token: string };
+			const { kid } = jose.decodeProtectedHeader(token);
+
+			for (let fetches = 0; fetches < 2; fetches++) {
+				const jwks = await fetchJwks(sessionId);
+				expect(jwks.keys.map((key) => key.kid)).toContain(kid);
+				await jose.jwtVerify(token, jose.createLocalJWKSet(jwks));
+			}
+			const dropped = await fetchJwks(sessionId);
+			expect(dropped.keys.map((key) => key.kid)).not.toContain(kid);
+			await expect(jose.jwtVerify(token, jose.createLocalJWKSet(dropped))).rejects.toThrow();
+
+			const report = loki.getSessionReport(sessionId);
+			expect(report?.issuances[0]?.signingKey?.source).toBe("transient");
+			const [record] = report?.transientKeys ?? [];
+			expect(record?.kid).toBe(kid);
+			expect(record?.fetches).toBe(2);
+			expect(Date.parse(record?.removedAt ?? "")).toBeGreaterThanOrEqual(
+				Date.parse(record?.addedAt ?? ""),
+			);
+		});
+
+		it("should reject a jwksRaceWindow without a positive limit", async () => {
+			for (const jwksRaceWindow of [{}, { fetches: 0 }, { seconds: "30" }, 2]) {
+				const response = await fetch(`${ISSUER}/admin/sessions`, {
+					method: "POST",
+					headers: { "Content-Type": "application/json" },
+					body: JSON.stringify({ mischief: ["jwks-key-rotation-race"], jwksRaceWindow }),
+				});
+				expect(response.status).toBe(400);
+			}
+		});
+	});
+
+	describe("jwks caching headers", () => {
+		async function createSession(body: unknown): Promise<Response> {
+			return fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+		}
+
+		async function issueKid(sessionId: string): Promise<string | undefined> {
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const { access_token: token } = (await response.json()) as { access_token: string };
+			return jose.decodeProtectedHeader(token).kid;
+		}
+
+		it("should advertise the session's jwksMaxAge, then rotate keys under it", async () => {
+			const created = await createSession({ mischief: ["jwks-cache-poison"], jwksMaxAge: 86400 });
+			const { sessionId } = (await created.json()) as { sessionId: string };
+			const first = await issueKid(sessionId);
+
+			const response = await fetch(`${ISSUER}/jwks`, { headers: { "X-Loki-Session": sessionId } });
+			expect(response.headers.get("cache-control")).toBe("public, max-age=86400, immutable");
+			const cached = (await response.json()) as { keys: jose.JWK[] };
+			expect(cached.keys.map((key) => key.kid)).toContain(first);
+
+			const second = await issueKid(sessionId);
+			expect(second).not.toBe(first);
+			expect(cached.keys.map((key) => key.kid)).not.toContain(second);
+			const refetched = await fetch(`${ISSUER}/jwks`, {
+				headers: { "X-Loki-Session": sessionId },
+			});
+			const { keys } = (await refetched.json()) as { keys: jose.JWK[] };
+			expect(keys.map((key) => key.kid)).toEqual(expect.arrayContaining([first, second]));
+		});
+
+		it("should serve the session's JWKS with no-store under jwks-no-cache", async () => {
+			const created = await createSession({ mischief: ["jwks-no-cache"] });
+			const { sessionId } = (await created.json()) as { sessionId: string };
+			const kid = await issueKid(sessionId);
+
+			const response = await fetch(`${ISSUER}/jwks`, { headers: { "X-Loki-Session": sessionId } });
+			expect(response.headers.get("cache-control")).toBe("no-store");
+			const { keys } = (await response.json()) as { keys: jose.JWK[] };
+			expect(keys.map((key) => key.kid)).toContain(kid);
+			expect(loki.getSessionReport(sessionId)?.transientKeys?.[0]?.kid).toBe(kid);
+		});
+
+		it("should reject a jwksMaxAge that isn't a positive integer", async () => {
+			for (const jwksMaxAge of [0, -60, 1.5, "3600"]) {
+				const response = await createSession({ mischief: ["jwks-cache-poison"], jwksMaxAge });
+				expect(response.status).toBe(400);
+			}
+		});
+	});
+
+	describe("aud confusion", () => {
+		async function issueToken(body: unknown): Promise<{ sessionId: string; token: string }> {
+			const created = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+			const { sessionId } = (await created.json()) as { sessionId: string };
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const { access_token: token } = (await response.json()) as { access_token: string };
+			return { sessionId, token };
+		}
+
+		it("should issue a validly signed token whose aud adds a rogue resource", async () => {
+			const { sessionId, token } = await issueToken({ mischief: ["aud-confusion"] });
+			const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+
+			const { payload } = await jose.jwtVerify(token, jwks);
+			expect(payload.aud).toEqual(["test-client", "https://attacker.example/api"]);
+
+			const report = await (await fetch(`${ISSUER}/admin/sessions/${sessionId}/report`)).json();
+			const change = report.issuances[0].changes.claims.find(
+				(c: { name: string }) => c.name === "aud",
+			);
+			expect(change.after).toEqual(["test-client", "https://attacker.example/api"]);
+		});
+
+		it("should set a session's audTarget as the only audience", async () => {
+			const audTarget = "https://payments.internal/api";
+			const { token } = await issueToken({ mischief: ["aud-confusion"], audTarget });
+
+			expect(jose.decodeJwt(token).aud).toBe(audTarget);
+		});
+
+		it("should reject an empty audTarget", async () => {
+			const response = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: ["aud-confusion"], audTarget: "" }),
+			});
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toBe("audTarget must be a non-empty string");
+		});
+	});
+
+	describe("temporal-tampering attack", () => {
+		it("should produce expired token when temporal-tampering is enabled", async () => {
+			// Create session with temporal-tampering enabled
+			const session = loki.createSession({
+				name: "temporal-test",
+				mode: "explicit",
+				mischief: ["temporal-tampering"],
+			});
+
+			// Request a token with the session header
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": session.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+
+			expect(response.ok).toBe(true);
+
+			const _data = (await response.json()) as { access_token?: string };
+
+			// Check ledger recorded the tampering
+			const ledger = session.getLedger();
 			expect(ledger.entries.length).toBeGreaterThan(0);
-			expect(ledger.summary.requestsWithMischief).toBeGreaterThan(0);
 
-			// Check plugin breakdown
-			const pluginIds = ledger.entries.map((e) => e.plugin.id);
-			expect(pluginIds).toContain("alg-none");
-			expect(pluginIds).toContain("temporal-tampering");
+			const temporalEntry = ledger.entries.find((e) => e.plugin.id === "temporal-tampering");
+			expect(temporalEntry).toBeDefined();
+			expect(temporalEntry?.evidence.mode).toBe("expired");
+		});
+	});
+
+	describe("iat-stale attack", () => {
+		it("should issue an unexpired token with a stale iat", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["iat-stale"],
+				pluginConfig: { "iat-stale": { staleSeconds: 86400 } },
+			});
+
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": session.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const data = (await response.json()) as { access_token: string };
+
+			const { iat, exp } = jose.decodeJwt(data.access_token);
+			const now = Math.floor(Date.now() / 1000);
+			expect(iat).toBeLessThanOrEqual(now - 86400);
+			expect(exp).toBeGreaterThan(now);
+
+			const entry = session.getLedger().entries.find((e) => e.plugin.id === "iat-stale");
+			expect(entry?.evidence.iat).toBe(iat);
+		});
+	});
+
+	describe("claim-injection attack", () => {
+		it("should merge a session's claims into the token and flag protected ones", async () => {
+			const claims = { roles: ["admin"], iss: "https://evil.example" };
+			const created = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ mischief: ["claim-injection"], claims }),
+			});
+			const { sessionId } = (await created.json()) as { sessionId: string };
+
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const data = (await response.json()) as { access_token: string };
+			expect(jose.decodeJwt(data.access_token)).toMatchObject(claims);
+
+			const report = await (await fetch(`${ISSUER}/admin/sessions/${sessionId}/report`)).json();
+			const mutation = report.issuances[0].mutations.find(
+				(m: { plugin: string }) => m.plugin === "claim-injection",
+			);
+			expect(mutation.evidence.protectedOverwrites).toEqual(["iss"]);
+		});
+	});
+
+	describe("jti reuse", () => {
+		it("should issue successive tokens with the same jti and flag the repeats", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["jti-reuse"] });
+			const jtis: unknown[] = [];
+			for (let i = 0; i < 3; i++) {
+				const response = await fetch(`${ISSUER}/token`, {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/x-www-form-urlencoded",
+						Authorization: `Basic ${btoa("test-client:test-secret")}`,
+						"X-Loki-Session": session.id,
+					},
+					body: "grant_type=client_credentials",
+				});
+				const { access_token } = (await response.json()) as { access_token: string };
+				jtis.push(jose.decodeJwt(access_token).jti);
+			}
+
+			expect(new Set(jtis).size).toBe(1);
+			const report = loki.getSessionReport(session.id);
+			expect(report?.issuances.map((i) => i.jtiReused ?? false)).toEqual([false, true, true]);
+			expect(report?.issuances.map((i) => i.jti)).toEqual(jtis);
+		});
+	});
+
+	describe("token content type", () => {
+		async function requestToken(accept: string, sessionId?: string): Promise<Response> {
+			const headers: Record<string, string> = {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				Accept: accept,
+			};
+			if (sessionId) {
+				headers["X-Loki-Session"] = sessionId;
+			}
+			return fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers,
+				body: "grant_type=client_credentials",
+			});
+		}
+
+		it("should form-encode token responses and errors for a client that prefers it", async () => {
+			const accept = "application/x-www-form-urlencoded, application/json;q=0.5";
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+			const response = await requestToken(accept, session.id);
+
+			expect(response.headers.get("content-type")).toBe("application/x-www-form-urlencoded");
+			expect(response.headers.get("cache-control")).toContain("no-store");
+			const form = new URLSearchParams(await response.text());
+			expect(form.get("token_type")).toBe("Bearer");
+			expect(form.get("access_token")).toBeTruthy();
+			const event = session.getEvents().find((e) => e.type === "token-content-type");
+			expect(event?.data).toMatchObject({
+				status: 200,
+				accept,
+				served: "application/x-www-form-urlencoded",
+			});
+
+			const error = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: { "Content-Type": "application/x-www-form-urlencoded", Accept: accept },
+				body: "grant_type=client_credentials&client_id=unknown-client",
+			});
+			expect(error.headers.get("content-type")).toBe("application/x-www-form-urlencoded");
+			expect(new URLSearchParams(await error.text()).get("error")).toBe("invalid_client");
+		});
+
+		it("should serve JSON by default and text/html under content-type-confusion", async () => {
+			const plain = await requestToken("application/json");
+			expect(plain.headers.get("content-type")).toContain("application/json");
+
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["content-type-confusion"],
+			});
+			const response = await requestToken("application/json", session.id);
+
+			expect(response.headers.get("content-type")).toBe("text/html; charset=utf-8");
+			expect(JSON.parse(await response.text()).access_token).toBeTruthy();
+			const event = session.getEvents().find((e) => e.type === "token-content-type");
+			expect(event?.data).toEqual({
+				status: 200,
+				accept: "application/json",
+				negotiated: "application/json",
+				served: "text/html; charset=utf-8",
+			});
+		});
+	});
+
+	describe("header injection", () => {
+		it("should merge a session's headers into the JWS header, validly signed", async () => {
+			const created = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({
+					mischief: ["header-injection"],
+					headers: { cty: "application/json", "x-tenant": "globex" },
+				}),
+			});
+			const { sessionId } = (await created.json()) as { sessionId: string };
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const { access_token: token } = (await response.json()) as { access_token: string };
+
+			const header = jose.decodeProtectedHeader(token);
+			expect(header).toMatchObject({ cty: "application/json", "x-tenant": "globex" });
+			const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+			await jose.compactVerify(token, jwks);
+			const entry = loki.getSessionReport(sessionId)?.issuances[0]?.mutations[0];
+			expect(entry?.evidence.header).toEqual(header);
+		});
+	});
+
+	describe("aud format", () => {
+		async function audOf(spec: Record<string, unknown>) {
+			const created = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(spec),
+			});
+			const { sessionId } = (await created.json()) as { sessionId: string };
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const { access_token: token } = (await response.json()) as { access_token: string };
+			const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+			await jose.compactVerify(token, jwks);
+			const issuance = loki.getSessionReport(sessionId)?.issuances[0];
+			return { aud: jose.decodeJwt(token).aud, reported: issuance?.aud };
+		}
+
+		it("should serialize a single audience in the session's audFormat", async () => {
+			const asArray = await audOf({ mischief: [], audFormat: "array" });
+			expect(Array.isArray(asArray.aud)).toBe(true);
+			expect(asArray.aud).toHaveLength(1);
+			expect(asArray.reported).toEqual({
+				format: "array",
+				serialized: JSON.stringify(asArray.aud),
+			});
+
+			const asString = await audOf({ mischief: [], audFormat: "string" });
+			expect(asString.aud).toBe((asArray.aud as string[])[0]);
+			expect(asString.reported?.format).toBe("string");
+		});
+
+		it("should flip the form with aud-type-flip", async () => {
+			const flipped = await audOf({ mischief: ["aud-type-flip"], audFormat: "array" });
+			expect(typeof flipped.aud).toBe("string");
+			expect(flipped.reported).toEqual({
+				format: "string",
+				serialized: JSON.stringify(flipped.aud),
+			});
+		});
+	});
+
+	describe("token lifetime", () => {
+		async function lifetimeOf(spec: Record<string, unknown>) {
+			const created = await fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(spec),
+			});
+			const { sessionId } = (await created.json()) as { sessionId: string };
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const body = (await response.json()) as { access_token: string; expires_in: number };
+			const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+			await jose.compactVerify(body.access_token, jwks);
+			const { exp = 0, iat = 0 } = jose.decodeJwt(body.access_token);
+			const issuance = loki.getSessionReport(sessionId)?.issuances[0];
+			return { expiresIn: body.expires_in, lifetime: exp - iat, expiry: issuance?.expiry };
+		}
+
+		it("should issue access tokens for the session's tokenLifetime", async () => {
+			const issued = await lifetimeOf({ mischief: [], tokenLifetime: "30s" });
+			expect(issued.expiresIn).toBe(30);
+			expect(issued.lifetime).toBe(30);
+			expect(issued.expiry).toMatchObject({ expiresIn: 30, difference: 0 });
+		});
+
+		it("should leave expires_in disagreeing with exp under expires-in-mismatch", async () => {
+			const issued = await lifetimeOf({ mischief: ["expires-in-mismatch"], tokenLifetime: "1h" });
+			expect(issued.expiresIn).toBe(3600);
+			expect(issued.lifetime).toBe(10);
+			expect(issued.expiry).toMatchObject({ expiresIn: 3600, difference: -3590 });
+		});
+	});
+
+	describe("grant claims", () => {
+		async function clientCredentials(sessionId: string) {
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials&nonce=n-0S6_WzA2Mj",
+			});
+			const body = (await response.json()) as { access_token: string; id_token?: string };
+			const issuance = loki.getSessionReport(sessionId)?.issuances[0];
+			return { body, claims: jose.decodeJwt(body.access_token), issuance };
+		}
+
+		it("should issue client_credentials tokens for the client, without user claims", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+
+			const { body, claims, issuance } = await clientCredentials(session.id);
+
+			expect(body.id_token).toBeUndefined();
+			expect(claims.sub).toBe("test-client");
+			expect(claims.client_id).toBe("test-client");
+			for (const name of ["nonce", "at_hash", "auth_time", "acr", "amr", "sid", "email"]) {
+				expect(claims).not.toHaveProperty(name);
+			}
+			expect(issuance?.grant).toEqual({
+				grantType: "client_credentials",
+				profile: "machine",
+				unexpected: [],
+			});
+		});
+
+		it("should report user claims mischief put in a machine token", async () => {
+			loki.register({
+				id: "acme-user-claims",
+				name: "ACME User Claims",
+				severity: "low",
+				phase: "token-claims",
+				spec: { description: "Machine tokens carry no user claims" },
+				description: "Adds a nonce and an email to every token, validly signed",
+				async apply(ctx) {
+					if (!ctx.token) {
+						return { applied: false, mutation: "No token", evidence: {} };
+					}
+					ctx.token.claims.nonce = "n-0S6_WzA2Mj";
+					ctx.token.claims.email = "alice@loki.test";
+					if (ctx.token.resign) {
+						await ctx.token.resign();
+					}
+					return { applied: true, mutation: "Added nonce and email", evidence: {} };
+				},
+			});
+
+			try {
+				const session = loki.createSession({ mode: "explicit", mischief: ["acme-user-claims"] });
+				const { claims, issuance } = await clientCredentials(session.id);
+
+				expect(claims.email).toBe("alice@loki.test");
+				expect(issuance?.grant?.unexpected).toEqual(["nonce", "email"]);
+			} finally {
+				loki.plugins.unregister("acme-user-claims");
+			}
+		});
+	});
+
+	describe("custom mischief", () => {
+		it("should apply a plugin registered at runtime like a built-in one", async () => {
+			loki.register({
+				id: "acme-tenant-claim",
+				name: "ACME Tenant Claim",
+				severity: "low",
+				phase: "token-claims",
+				spec: { description: "Tokens carry only the claims the issuer vouches for" },
+				description: "Adds a bespoke acme_tenant claim, validly signed",
+				async apply(ctx) {
+					if (!ctx.token) {
+						return { applied: false, mutation: "No token context", evidence: {} };
+					}
+					ctx.token.claims.acme_tenant = "globex";
+					if (ctx.token.resign) {
+						await ctx.token.resign();
+					}
+					return {
+						applied: true,
+						mutation: "Added acme_tenant",
+						evidence: { acme_tenant: "globex" },
+					};
+				},
+			});
+
+			try {
+				const session = loki.createSession({ mode: "explicit", mischief: ["acme-tenant-claim"] });
+				const response = await fetch(`${ISSUER}/token`, {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/x-www-form-urlencoded",
+						Authorization: `Basic ${btoa("test-client:test-secret")}`,
+						"X-Loki-Session": session.id,
+					},
+					body: "grant_type=client_credentials",
+				});
+				const { access_token } = (await response.json()) as { access_token: string };
+				const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+				const { payload } = await jose.jwtVerify(access_token, jwks);
+
+				expect(payload.acme_tenant).toBe("globex");
+				expect(session.getLedger().entries[0]?.plugin.id).toBe("acme-tenant-claim");
+			} finally {
+				loki.plugins.unregister("acme-tenant-claim");
+			}
+		});
+	});
+
+	describe("nbf-future attack", () => {
+		it("should issue a token that isn't valid yet", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["nbf-future"],
+				pluginConfig: { "nbf-future": { offset: "10m" } },
+			});
+
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": session.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const data = (await response.json()) as { access_token: string };
+
+			const { iat, nbf, exp } = jose.decodeJwt(data.access_token);
+			expect(nbf).toBeGreaterThanOrEqual((iat as number) + 600);
+			expect(nbf).toBeLessThanOrEqual((iat as number) + 601);
+			expect(exp).toBeGreaterThan(nbf as number);
+		});
+	});
+
+	describe("temporal-future attack", () => {
+		async function createSession(body: unknown): Promise<Response> {
+			return fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+		}
+
+		it("should issue a token with the session's expOffset and nbfOffset", async () => {
+			const created = await createSession({
+				mischief: ["temporal-future"],
+				expOffset: "262800h",
+				nbfOffset: "720h",
+			});
+			const { sessionId } = (await created.json()) as { sessionId: string };
+
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const data = (await response.json()) as { access_token: string };
+
+			const { iat, nbf, exp } = jose.decodeJwt(data.access_token);
+			const lifetimeSeconds = (262800 + 720) * 3600;
+			expect(nbf).toBe(iat);
+			expect((exp as number) - (iat as number)).toBe(lifetimeSeconds);
+
+			const report = await (await fetch(`${ISSUER}/admin/sessions/${sessionId}/report`)).json();
+			const mutation = report.issuances[0].mutations.find(
+				(m: { plugin: string }) => m.plugin === "temporal-future",
+			);
+			expect(mutation.evidence).toMatchObject({ exp, nbf, iat, lifetimeSeconds });
+		});
+
+		it("should reject offsets that aren't Go durations", async () => {
+			const response = await createSession({ mischief: ["temporal-future"], expOffset: "30y" });
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toContain("expOffset must be a Go duration");
+		});
+	});
+
+	describe("oversized-token attack", () => {
+		async function createSession(body: unknown): Promise<Response> {
+			return fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+		}
+
+		it("should issue a validly signed token padded to the session's tokenPadBytes", async () => {
+			const tokenPadBytes = 256 * 1024;
+			const created = await createSession({ mischief: ["oversized-token"], tokenPadBytes });
+			const { sessionId } = (await created.json()) as { sessionId: string };
+
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const data = (await response.json()) as { access_token: string };
+
+			expect(data.access_token.length).toBeGreaterThan((tokenPadBytes * 4) / 3);
+			const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+			const { payload } = await jose.jwtVerify(data.access_token, jwks);
+			expect(payload.loki_pad).toHaveLength(tokenPadBytes);
+		});
+
+		it("should reject a tokenPadBytes that isn't a positive integer", async () => {
+			const response = await createSession({ mischief: ["oversized-token"], tokenPadBytes: 0 });
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toContain("tokenPadBytes must be an integer");
+		});
+	});
+
+	describe("auth-context-spoof attack", () => {
+		async function createSession(body: unknown): Promise<Response> {
+			return fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+		}
+
+		it("should claim the session's amr and acr in a token that fails verification", async () => {
+			const amr = ["hwk", "mfa"];
+			const acr = "urn:example:loa:3";
+			const created = await createSession({ mischief: ["auth-context-spoof"], amr, acr });
+			const { sessionId } = (await created.json()) as { sessionId: string };
+
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const data = (await response.json()) as { access_token: string };
+
+			expect(jose.decodeJwt(data.access_token)).toMatchObject({ amr, acr });
+			const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+			await expect(jose.jwtVerify(data.access_token, jwks)).rejects.toThrow();
+
+			const report = await (await fetch(`${ISSUER}/admin/sessions/${sessionId}/report`)).json();
+			const [mutation] = report.issuances[0].mutations;
+			expect(mutation).toMatchObject({
+				plugin: "auth-context-spoof",
+				evidence: { amr, acr, signatureValid: false },
+			});
+		});
+
+		it("should reject an amr that isn't an array of strings", async () => {
+			const response = await createSession({ mischief: ["auth-context-spoof"], amr: "mfa" });
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toBe(
+				"amr must be a non-empty array of non-empty strings",
+			);
+		});
+	});
+
+	describe("metrics", () => {
+		it("should count issued tokens, mischief applied and requests by endpoint", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["alg-none"] });
+
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": session.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+			expect(response.ok).toBe(true);
+
+			const metrics = await (await fetch(`${ISSUER}/metrics`)).text();
+			expect(metrics).toMatch(/^loki_tokens_issued_total [1-9]\d*$/m);
+			expect(metrics).toMatch(/^loki_mischief_applied_total\{mischief="alg-none"\} [1-9]\d*$/m);
+			expect(metrics).toMatch(/^loki_active_sessions [1-9]\d*$/m);
+			expect(metrics).toMatch(/^loki_http_requests_total\{endpoint="token",status="200"\} \d+$/m);
+			expect(metrics).toContain('loki_http_request_duration_seconds_count{endpoint="token"}');
+			expect(metrics).not.toContain(session.id);
+		});
+	});
+
+	describe("session modes", () => {
+		it("should not apply mischief without session header", async () => {
+			// Request token WITHOUT session header
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					// No X-Loki-Session header
+				},
+				body: "grant_type=client_credentials",
+			});
+
+			expect(response.ok).toBe(true);
+
+			const data = (await response.json()) as { access_token?: string };
+
+			// Token should be normal (not alg:none)
+			if (data.access_token?.includes(".")) {
+				const parts = data.access_token.split(".");
+				const header = JSON.parse(atob(parts[0]?.replace(/-/g, "+").replace(/_/g, "/")));
+				// Should NOT be alg:none
+				expect(header.alg).not.toBe("none");
+			}
+		});
+
+		it("should apply mischief only to session with enabled plugins", async () => {
+			// Create session WITHOUT any mischief
+			const cleanSession = loki.createSession({
+				name: "clean-session",
+				mode: "explicit",
+				mischief: [], // No mischief enabled
+			});
+
+			// Request token with clean session
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": cleanSession.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+
+			expect(response.ok).toBe(true);
+
+			// Ledger should be empty
+			const ledger = cleanSession.getLedger();
+			expect(ledger.entries).toHaveLength(0);
+		});
+	});
+
+	describe("ledger tracking", () => {
+		it("should track multiple mischief applications", async () => {
+			// Create session with multiple mischief plugins
+			const session = loki.createSession({
+				name: "multi-mischief",
+				mode: "explicit",
+				mischief: ["alg-none", "temporal-tampering"],
+			});
+
+			// Make multiple requests
+			for (let i = 0; i < 3; i++) {
+				await fetch(`${ISSUER}/token`, {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/x-www-form-urlencoded",
+						Authorization: `Basic ${btoa("test-client:test-secret")}`,
+						"X-Loki-Session": session.id,
+					},
+					body: "grant_type=client_credentials",
+				});
+			}
+
+			const ledger = session.getLedger();
+
+			// Should have entries for both plugins across 3 requests
+			// (alg-none for signing, temporal-tampering for claims)
+			expect(ledger.entries.length).toBeGreaterThan(0);
+			expect(ledger.summary.requestsWithMischief).toBeGreaterThan(0);
+
+			// Check plugin breakdown
+			const pluginIds = ledger.entries.map((e) => e.plugin.id);
+			expect(pluginIds).toContain("alg-none");
+			expect(pluginIds).toContain("temporal-tampering");
+		});
+	});
+
+	describe("warm-up period", () => {
+		it("should serve clean tokens until the warm-up is over", async () => {
+			const session = loki.createSession({
+				name: "warmup-test",
+				mode: "explicit",
+				mischief: ["alg-none"],
+				warmupRequests: 2,
+			});
+
+			const remaining: (string | null)[] = [];
+			for (let i = 0; i < 3; i++) {
+				const response = await fetch(`${ISSUER}/token`, {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/x-www-form-urlencoded",
+						Authorization: `Basic ${btoa("test-client:test-secret")}`,
+						"X-Loki-Session": session.id,
+					},
+					body: "grant_type=client_credentials",
+				});
+				expect(response.ok).toBe(true);
+				remaining.push(response.headers.get("x-loki-warmup-remaining"));
+			}
+
+			expect(remaining).toEqual(["1", "0", "0"]);
+			expect(session.warmupRemaining).toBe(0);
+
+			// Only the request after the warm-up was tampered with
+			const ledger = session.getLedger();
+			expect(ledger.entries).toHaveLength(1);
+
+			const events = session.getEvents();
+			expect(events).toHaveLength(1);
+			expect(events[0]?.type).toBe("warmup-complete");
+			expect(events[0]?.data).toEqual({ warmupRequests: 2, firstMischiefRequest: 3 });
+		});
+	});
+
+	describe("probabilistic mode", () => {
+		async function createSession(body: unknown): Promise<Response> {
+			return fetch(`${ISSUER}/admin/sessions`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+		}
+
+		async function soak(sessionId: string, requests: number): Promise<void> {
+			for (let i = 0; i < requests; i++) {
+				const response = await fetch(`${ISSUER}/token`, {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/x-www-form-urlencoded",
+						Authorization: `Basic ${btoa("test-client:test-secret")}`,
+						"X-Loki-Session": sessionId,
+					},
+					body: "grant_type=client_credentials",
+				});
+				expect(response.ok).toBe(true);
+			}
+		}
+
+		it("should draw each plugin per token request and replay a run from its seed", async () => {
+			const spec = {
+				mode: "probabilistic",
+				probabilities: { "temporal-tampering": 0.5, "scope-injection": 0.5 },
+				seed: 20260115,
+			};
+			const runs: string[][][] = [];
+			for (let run = 0; run < 2; run++) {
+				const { sessionId } = (await (await createSession(spec)).json()) as { sessionId: string };
+				await soak(sessionId, 20);
+
+				const report = loki.getSessionReport(sessionId);
+				const issuances = report?.issuances ?? [];
+				expect(issuances).toHaveLength(20);
+				for (const issuance of issuances) {
+					for (const id of issuance.mischief) {
+						expect(issuance.drawn).toContain(id);
+					}
+				}
+				runs.push(issuances.map((issuance) => issuance.drawn ?? []));
+
+				const details = await (await fetch(`${ISSUER}/admin/sessions/${sessionId}`)).json();
+				expect(details.seed).toBe(spec.seed);
+			}
+
+			expect(runs[1]).toEqual(runs[0]);
+			const drawn = new Set(runs[0]?.flat());
+			expect(drawn).toEqual(new Set(["temporal-tampering", "scope-injection"]));
+		});
+
+		it("should pick a seed when none is given", async () => {
+			const session = loki.createSession({
+				mode: "probabilistic",
+				mischief: [],
+				probabilities: { "alg-none": 0.1 },
+			});
+
+			expect(session.seed).toBeTypeOf("number");
+		});
+
+		it("should reject invalid probabilities and seeds", async () => {
+			const cases = [
+				{
+					body: { mode: "probabilistic", probabilities: { "alg-none": 1.5 } },
+					error: "probabilities must map plugin IDs to numbers from 0 to 1",
+				},
+				{
+					body: { mode: "probabilistic", probabilities: { "alg-none": 0.1 }, seed: -1 },
+					error: "seed must be an integer from 0 to 4294967295",
+				},
+				{
+					body: { mode: "explicit", mischief: ["alg-none"], seed: 1 },
+					error: "probabilities and seed only apply to probabilistic mode",
+				},
+			];
+			for (const { body, error } of cases) {
+				const response = await createSession(body);
+				expect(response.status).toBe(400);
+				expect((await response.json()).error).toBe(error);
+			}
+		});
+	});
+
+	describe("revocation list", () => {
+		async function issueToken(): Promise<string> {
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const data = (await response.json()) as { access_token: string };
+			return data.access_token;
+		}
+
+		async function revoke(token: string, sessionId?: string): Promise<Response> {
+			const headers: Record<string, string> = {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+			};
+			if (sessionId) {
+				headers["X-Loki-Session"] = sessionId;
+			}
+			return fetch(`${ISSUER}/token/revocation`, {
+				method: "POST",
+				headers,
+				body: new URLSearchParams({ token }).toString(),
+			});
+		}
+
+		it("should omit revoked tokens from the list when the mischief is enabled", async () => {
+			const session = loki.createSession({
+				name: "revocation-omission-test",
+				mode: "explicit",
+				mischief: ["revocation-list-omission"],
+			});
+
+			const cleanToken = await issueToken();
+			const omittedToken = await issueToken();
+
+			const cleanResponse = await revoke(cleanToken);
+			const omittedResponse = await revoke(omittedToken, session.id);
+
+			expect(cleanResponse.status).toBe(200);
+			expect(omittedResponse.status).toBe(200);
+
+			const list = (await (await fetch(`${ISSUER}/revocations`)).json()) as {
+				revoked: { jti: string }[];
+			};
+			const report = (await (
+				await fetch(`${ISSUER}/admin/revocations?session=${session.id}`)
+			).json()) as { listed: unknown[]; omitted: { jti: string }[] };
+
+			expect(list.revoked).toHaveLength(1);
+			expect(report.listed).toHaveLength(0);
+			expect(report.omitted).toHaveLength(1);
+			expect(list.revoked[0]?.jti).not.toBe(report.omitted[0]?.jti);
+
+			const ledger = session.getLedger();
+			expect(ledger.entries[0]?.plugin.id).toBe("revocation-list-omission");
+		});
+	});
+
+	describe("response timing", () => {
+		it("should delay token responses according to credential validity", async () => {
+			const session = loki.createSession({
+				name: "response-timing-test",
+				mode: "explicit",
+				mischief: ["response-timing"],
+				pluginConfig: {
+					"response-timing": { mode: "variable", validDelayMs: 200, invalidDelayMs: 0 },
+				},
+			});
+
+			async function requestToken(secret: string): Promise<number> {
+				const started = Date.now();
+				await fetch(`${ISSUER}/token`, {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/x-www-form-urlencoded",
+						Authorization: `Basic ${btoa(`test-client:${secret}`)}`,
+						"X-Loki-Session": session.id,
+					},
+					body: "grant_type=client_credentials",
+				});
+				return Date.now() - started;
+			}
+
+			const validMs = await requestToken("test-secret");
+			await requestToken("wrong-secret");
+
+			expect(validMs).toBeGreaterThanOrEqual(200);
+
+			const evidence = session
+				.getLedger()
+				.entries.filter((e) => e.plugin.id === "response-timing")
+				.map((e) => e.evidence as Record<string, unknown>);
+			expect(evidence.map((e) => e.valid)).toEqual([true, false]);
+			expect(evidence.map((e) => e.responseDelayMs)).toEqual([200, 0]);
+		});
+	});
+
+	describe("frozen tokens", () => {
+		async function requestToken(sessionId: string): Promise<Response> {
+			return fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+		}
+
+		it("should replay the captured token until unfrozen", async () => {
+			const session = loki.createSession({
+				name: "freeze-test",
+				mode: "explicit",
+				mischief: ["alg-none"],
+			});
+
+			const freezeRes = await fetch(`${ISSUER}/admin/sessions/${session.id}/freeze`, {
+				method: "POST",
+			});
+			expect(freezeRes.ok).toBe(true);
+
+			const first = (await (await requestToken(session.id)).json()) as { access_token: string };
+			const replayed = await requestToken(session.id);
+			const second = (await replayed.json()) as { access_token: string };
+
+			expect(second.access_token).toBe(first.access_token);
+			expect(replayed.headers.get("x-loki-frozen")).toBe("true");
+			expect(session.freezeState).toBe("frozen");
+			expect(session.getEvents().filter((e) => e.type === "token-frozen")).toHaveLength(1);
+
+			const unfreezeRes = await fetch(`${ISSUER}/admin/sessions/${session.id}/freeze`, {
+				method: "DELETE",
+			});
+			expect(unfreezeRes.ok).toBe(true);
+
+			const third = (await (await requestToken(session.id)).json()) as { access_token: string };
+			expect(third.access_token).not.toBe(first.access_token);
+		});
+	});
+
+	describe("HEAD and OPTIONS", () => {
+		async function lengths(path: string, headers: Record<string, string> = {}) {
+			const get = await fetch(`${ISSUER}${path}`, { headers });
+			const body = Buffer.from(await get.arrayBuffer());
+			const head = await fetch(`${ISSUER}${path}`, { method: "HEAD", headers });
+			expect(head.status).toBe(get.status);
+			expect(await head.text()).toBe("");
+			return {
+				get: Number(get.headers.get("content-length")),
+				body: body.length,
+				head: Number(head.headers.get("content-length")),
+			};
+		}
+
+		it("should answer HEAD with the GET Content-Length", async () => {
+			for (const path of ["/.well-known/openid-configuration", "/jwks"]) {
+				const { get, body, head } = await lengths(path);
+				expect(get).toBe(body);
+				expect(head).toBe(body);
+			}
+		});
+
+		it("should misreport HEAD Content-Length under head-content-length-mismatch", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["head-content-length-mismatch"],
+				pluginConfig: { "head-content-length-mismatch": { delta: 100 } },
+			});
+
+			const { get, body, head } = await lengths("/jwks", { "X-Loki-Session": session.id });
+
+			expect(get).toBe(body);
+			expect(head).toBe(body + 100);
+			expect(session.getLedger().entries).toHaveLength(1);
+		});
+
+		it("should refuse HEAD on the token endpoint", async () => {
+			const response = await fetch(`${ISSUER}/token`, { method: "HEAD" });
+
+			expect(response.status).toBe(405);
+			expect(response.headers.get("allow")).toBe("POST, OPTIONS");
+		});
+
+		it("should answer OPTIONS with allowed methods and CORS preflight headers", async () => {
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "OPTIONS",
+				headers: {
+					Origin: "https://app.example",
+					"Access-Control-Request-Method": "POST",
+					"Access-Control-Request-Headers": "authorization, content-type",
+				},
+			});
+
+			expect(response.status).toBe(204);
+			expect(response.headers.get("allow")).toBe("POST, OPTIONS");
+			expect(response.headers.get("access-control-allow-origin")).toBe("*");
+			expect(response.headers.get("access-control-allow-headers")).toBe(
+				"authorization, content-type",
+			);
+
+			const discovery = await fetch(`${ISSUER}/.well-known/openid-configuration`, {
+				method: "OPTIONS",
+			});
+			expect(discovery.headers.get("allow")).toBe("GET, HEAD, OPTIONS");
+			expect(discovery.headers.get("access-control-allow-origin")).toBeNull();
+		});
+	});
+
+	describe("JWKS transport", () => {
+		function abuse(config: Record<string, unknown>) {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["jwks-transport-abuse"],
+				pluginConfig: { "jwks-transport-abuse": config },
+			});
+			return { session, headers: { "X-Loki-Session": session.id } };
+		}
+
+		it("should serve the JWKS gzip-encoded with the compressed Content-Length", async () => {
+			const { session, headers } = abuse({ encoding: "gzip" });
+
+			const response = await fetch(`${ISSUER}/jwks`, { headers });
+
+			expect(response.headers.get("content-encoding")).toBe("gzip");
+			expect(response.headers.get("vary")).toContain("Accept-Encoding");
+			const body = await response.json();
+			expect(body.keys.length).toBeGreaterThan(0);
+			expect(session.getLedger().entries).toHaveLength(1);
+		});
+
+		it("should send a padded JWKS chunked, without a Content-Length", async () => {
+			const { headers } = abuse({ encoding: "gzip-chunked", keyCount: 500 });
+
+			const response = await fetch(`${ISSUER}/jwks`, { headers });
+
+			expect(response.headers.get("content-length")).toBeNull();
+			expect(response.headers.get("transfer-encoding")).toBe("chunked");
+			expect(response.headers.get("content-encoding")).toBe("gzip");
+			const body = await response.json();
+			expect(body.keys).toHaveLength(500);
+		});
+
+		it("should not gzip a JWKS for a fetch that refuses gzip", async () => {
+			const { headers } = abuse({ encoding: "gzip" });
+
+			const response = await fetch(`${ISSUER}/jwks`, {
+				headers: { ...headers, "Accept-Encoding": "identity" },
+			});
+
+			expect(response.headers.get("content-encoding")).toBeNull();
+			const text = await response.text();
+			expect(Number(response.headers.get("content-length"))).toBe(Buffer.byteLength(text));
+			expect(JSON.parse(text).keys.length).toBeGreaterThan(0);
+		});
+	});
+
+	describe("request object replay", () => {
+		async function signedRequestObject(jti: string): Promise<string> {
+			return new jose.SignJWT({
+				client_id: "web-client",
+				response_type: "code",
+				redirect_uri: "http://localhost:8080/callback",
+				scope: "openid",
+			})
+				.setProtectedHeader({ alg: "HS256" })
+				.setIssuer("web-client")
+				.setAudience(ISSUER)
+				.setJti(jti)
+				.setIssuedAt()
+				.setExpirationTime("5m")
+				.sign(new TextEncoder().encode("web-secret-with-enough-entropy-for-hs256"));
+		}
+
+		function authorize(request: string, sessionId: string): Promise<Response> {
+			const query = new URLSearchParams({ client_id: "web-client", request });
+			return fetch(`${ISSUER}/auth?${query}`, {
+				redirect: "manual",
+				headers: { "X-Loki-Session": sessionId },
+			});
+		}
+
+		it("should refuse a replayed request object", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+			const request = await signedRequestObject("jti-refused");
+
+			const first = await authorize(request, session.id);
+			expect(first.headers.get("location")).toContain("/interaction/");
+
+			const replay = await authorize(request, session.id);
+			expect(replay.status).toBe(400);
+			const body = (await replay.json()) as { error: string };
+			expect(body.error).toBe("invalid_request_object");
+
+			const events = session.getEvents();
+			expect(events.map((e) => e.type)).toEqual(["request-object-replayed"]);
+			expect(events[0]?.data).toEqual({ jti: "jti-refused", accepted: false });
+		});
+
+		it("should accept a replayed request object under request-object-replay", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["request-object-replay"],
+			});
+			const request = await signedRequestObject("jti-accepted");
+
+			await authorize(request, session.id);
+			const replay = await authorize(request, session.id);
+
+			expect(replay.headers.get("location")).toContain("/interaction/");
+			expect(session.getEvents()[0]?.data).toEqual({ jti: "jti-accepted", accepted: true });
+			expect(session.getLedger().entries).toHaveLength(1);
+		});
+	});
+
+	describe("conditional mischief", () => {
+		async function requestToken(
+			sessionId: string,
+			headers: Record<string, string> = {},
+		): Promise<string> {
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+					...headers,
+				},
+				body: "grant_type=client_credentials",
+			});
+			expect(response.ok).toBe(true);
+			const data = (await response.json()) as { access_token: string };
+			return data.access_token;
+		}
+
+		it("should apply mischief to requests from a targeted network", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["alg-none"],
+				when: { sourceCIDR: ["127.0.0.0/8", "::1"] },
+			});
+
+			const token = await requestToken(session.id);
+
+			expect(jose.decodeProtectedHeader(token).alg).toBe("none");
+			expect(session.getEvents()[0]?.type).toBe("condition-evaluated");
+			expect(session.getEvents()[0]?.data.matched).toBe(true);
+		});
+
+		it("should serve other networks clean, ignoring an untrusted X-Forwarded-For", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["alg-none"],
+				when: { sourceCIDR: "10.0.0.0/8" },
+			});
+
+			const token = await requestToken(session.id, { "X-Forwarded-For": "10.1.2.3" });
+
+			expect(jose.decodeProtectedHeader(token).alg).not.toBe("none");
+			expect(session.getLedger().entries).toHaveLength(0);
+			const [event] = session.getEvents();
+			expect(event?.data.matched).toBe(false);
+			expect(event?.data.sourceCIDR).toEqual(["10.0.0.0/8"]);
+			expect(event?.data.sourceAddress).not.toBe("10.1.2.3");
+		});
+
+		it("should refuse an invalid CIDR", () => {
+			expect(() =>
+				loki.createSession({ mischief: ["alg-none"], when: { sourceCIDR: "10.0.0.0/33" } }),
+			).toThrow(/Invalid CIDR/);
+		});
+	});
+
+	describe("authorization details", () => {
+		function authorize(sessionId: string, details: string): Promise<Response> {
+			const query = new URLSearchParams({
+				client_id: "web-client",
+				response_type: "code",
+				redirect_uri: "http://localhost:8080/callback",
+				scope: "openid",
+				authorization_details: details,
+			});
+			return fetch(`${ISSUER}/auth?${query}`, {
+				redirect: "manual",
+				headers: { "X-Loki-Session": sessionId },
+			});
+		}
+
+		it("should remember valid details for the client", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+			const details = [{ type: "payment_initiation", actions: ["initiate"] }];
+
+			const response = await authorize(session.id, JSON.stringify(details));
+
+			expect(response.headers.get("location")).toContain("/interaction/");
+			const [event] = session.getEvents();
+			expect(event?.type).toBe("authorization-details-requested");
+			expect(event?.data).toEqual({ clientId: "web-client", authorizationDetails: details });
+		});
+
+		it("should reject malformed details", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+
+			const response = await authorize(session.id, '[{"actions": ["initiate"]}]');
+
+			expect(response.status).toBe(400);
+			const body = (await response.json()) as { error: string };
+			expect(body.error).toBe("invalid_authorization_details");
+			expect(session.getEvents()).toHaveLength(0);
+		});
+	});
+
+	describe("max age", () => {
+		function authorize(sessionId: string): Promise<Response> {
+			const query = new URLSearchParams({
+				client_id: "web-client",
+				response_type: "code",
+				redirect_uri: "http://localhost:8080/callback",
+				scope: "openid",
+				max_age: "0",
+			});
+			return fetch(`${ISSUER}/auth?${query}`, {
+				redirect: "manual",
+				headers: { "X-Loki-Session": sessionId },
+			});
+		}
+
+		it("should force re-authentication for max_age=0", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+
+			const response = await authorize(session.id);
+
+			expect(response.headers.get("location")).toContain("/interaction/");
+			const [event] = session.getEvents();
+			expect(event?.type).toBe("max-age-requested");
+			expect(event?.data).toEqual({
+				clientId: "web-client",
+				maxAge: 0,
+				reauthForced: true,
+				ignored: false,
+			});
+		});
+
+		it("should record max_age=0 as ignored with max-age-ignored", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["max-age-ignored"] });
+
+			await authorize(session.id);
+
+			const event = session.getEvents().find((e) => e.type === "max-age-requested");
+			expect(event?.data).toMatchObject({ reauthForced: false, ignored: true });
+		});
+	});
+
+	describe("test results", () => {
+		async function issueJti(sessionId: string): Promise<string> {
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			const data = (await response.json()) as { access_token: string };
+			return jose.decodeJwt(data.access_token).jti as string;
+		}
+
+		async function report(sessionId: string, body: unknown): Promise<Response> {
+			return fetch(`${ISSUER}/admin/sessions/${sessionId}/results`, {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify(body),
+			});
+		}
+
+		it("should aggregate client verdicts per mischief by jti", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["alg-none"],
+				warmupRequests: 1,
+			});
+			const clean = await issueJti(session.id);
+			const tampered = await issueJti(session.id);
+
+			expect((await report(session.id, { jti: clean, accepted: true })).ok).toBe(true);
+			expect((await report(session.id, { jti: tampered, accepted: false })).ok).toBe(true);
+
+			const results = await (await fetch(`${ISSUER}/admin/sessions/${session.id}/results`)).json();
+			expect(results.passed).toBe(true);
+			expect(results.baseline).toMatchObject({ issued: 1, passed: 1, passRate: 1 });
+			expect(results.mischief["alg-none"]).toMatchObject({ issued: 1, passed: 1, failed: 0 });
+			expect(session.getEvents().at(-1)?.type).toBe("token-reported");
+
+			// Changing its mind about the tampered token fails the run
+			await report(session.id, { jti: tampered, accepted: true, error: "oops" });
+			const failed = await (await fetch(`${ISSUER}/admin/sessions/${session.id}/results`)).json();
+			expect(failed.passed).toBe(false);
+			expect(failed.mischief["alg-none"].passRate).toBe(0);
+			expect(failed.failures).toHaveLength(1);
+		});
+
+		it("should reject unknown jtis and malformed reports", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["alg-none"] });
+
+			expect((await report(session.id, { jti: "never-issued", accepted: false })).status).toBe(404);
+			expect((await report(session.id, { jti: "x", accepted: "no" })).status).toBe(400);
+			expect((await report("sess_nonexistent", { jti: "x", accepted: true })).status).toBe(404);
+		});
+	});
+
+	describe("attack reports", () => {
+		it("should report each issuance's mutations, header and signing key", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["temporal-tampering", "kid-confusion"],
+				warmupRequests: 1,
+			});
+			for (let i = 0; i < 2; i++) {
+				await fetch(`${ISSUER}/token`, {
+					method: "POST",
+					headers: {
+						"Content-Type": "application/x-www-form-urlencoded",
+						Authorization: `Basic ${btoa("test-client:test-secret")}`,
+						"X-Loki-Session": session.id,
+					},
+					body: "grant_type=client_credentials",
+				});
+			}
+
+			const response = await fetch(`${ISSUER}/admin/sessions/${session.id}/report`);
+			expect(response.status).toBe(200);
+			const report = await response.json();
+			expect(report.mischief).toEqual(["temporal-tampering", "kid-confusion"]);
+			const [baseline, tampered] = report.issuances;
+
+			const published = (await (await fetch(`${ISSUER}/jwks`)).json()) as { keys: jose.JWK[] };
+			const lokiKey = published.keys.find((key) => key.kid === baseline.header.kid) ?? {};
+			expect(baseline.mischief).toEqual([]);
+			expect(baseline.changes).toEqual({ header: [], claims: [] });
+			expect(baseline.signingKey).toEqual({
+				kid: baseline.header.kid,
+				thumbprint: await jose.calculateJwkThumbprint(lokiKey),
+				source: "loki",
+			});
+
+			const attacker = await attackerKey("RS256");
+			expect(tampered.tokenType).toBe("access_token");
+			expect(tampered.header.kid).toBe(baseline.header.kid);
+			expect(tampered.mutations.map((m: { plugin: string }) => m.plugin)).toEqual([
+				"temporal-tampering",
+				"kid-confusion",
+			]);
+			expect(tampered.changes.claims.map((c: { name: string }) => c.name)).toContain("exp");
+			expect(tampered.signingKey).toEqual({
+				kid: attacker.kid,
+				thumbprint: await jose.calculateJwkThumbprint(attacker.publicJwk),
+				source: "attacker",
+			});
+		});
+
+		it("should report an unsigned token without a signing key", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["alg-none"] });
+			await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": session.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+
+			const report = await (await fetch(`${ISSUER}/admin/sessions/${session.id}/report`)).json();
+			expect(report.issuances[0].header.alg).toBe("none");
+			expect(report.issuances[0].changes.header).toContainEqual({
+				name: "alg",
+				before: "RS256",
+				after: "none",
+			});
+			expect(report.issuances[0].signingKey).toBeNull();
+		});
+
+		it("should 404 for an unknown session", async () => {
+			const response = await fetch(`${ISSUER}/admin/sessions/sess_nonexistent/report`);
+			expect(response.status).toBe(404);
+		});
+	});
+
+	describe("userinfo", () => {
+		it("should reject requests without a valid access token", async () => {
+			const response = await fetch(`${ISSUER}/me`, {
+				headers: { Authorization: "Bearer not-a-token" },
+			});
+
+			expect(response.status).toBe(401);
+			expect(response.headers.get("www-authenticate")).toContain("invalid_token");
+		});
+
+		async function issueToken(sessionId: string): Promise<string> {
+			const response = await fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+				},
+				body: "grant_type=client_credentials",
+			});
+			return ((await response.json()) as { access_token: string }).access_token;
+		}
+
+		it("should tamper with /userinfo for the session the access token was issued to", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["userinfo-tampering"] });
+			const token = await issueToken(session.id);
+			const tokenSub = jose.decodeJwt(token).sub;
+
+			const response = await fetch(`${ISSUER}/userinfo`, {
+				headers: { Authorization: `Bearer ${token}` },
+			});
+
+			expect(response.ok).toBe(true);
+			expect((await response.json()).sub).toBe(`${tokenSub}-impostor`);
+			const [divergence] = loki.getSessionReport(session.id)?.userinfo ?? [];
+			expect(divergence).toMatchObject({
+				tokenSub,
+				mischief: ["userinfo-tampering"],
+				changes: [{ name: "sub", before: tokenSub, after: `${tokenSub}-impostor` }],
+			});
+		});
+
+		it("should answer for the subject sub-tampering put in the access token", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["sub-tampering"] });
+			const token = await issueToken(session.id);
+
+			const response = await fetch(`${ISSUER}/userinfo`, {
+				headers: { Authorization: `Bearer ${token}` },
+			});
+
+			expect((await response.json()).sub).toBe("loki-impersonated-user");
+			const [issuance] = loki.getSessionReport(session.id)?.issuances ?? [];
+			expect(issuance?.changes.claims).toContainEqual(
+				expect.objectContaining({ name: "sub", after: "loki-impersonated-user" }),
+			);
+		});
+
+		it("should reject an access token sub-omission left without sub", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["sub-omission"] });
+			const token = await issueToken(session.id);
+			expect(jose.decodeJwt(token)).not.toHaveProperty("sub");
+
+			const response = await fetch(`${ISSUER}/userinfo`, {
+				headers: { Authorization: `Bearer ${token}` },
+			});
+			expect(response.status).toBe(401);
+		});
+
+		it("should serve /me and /userinfo alike and leave clean sessions unrecorded", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+			const token = await issueToken(session.id);
+
+			const bodies = [];
+			for (const path of ["/me", "/userinfo"]) {
+				const response = await fetch(`${ISSUER}${path}`, {
+					headers: { Authorization: `Bearer ${token}` },
+				});
+				bodies.push(await response.json());
+			}
+
+			expect(bodies[0].sub).toBe(jose.decodeJwt(token).sub);
+			expect(bodies[1]).toEqual(bodies[0]);
+			expect(loki.getSessionReport(session.id)).not.toHaveProperty("userinfo");
+		});
+	});
+
+	describe("token error", () => {
+		async function requestToken(config: Record<string, unknown>): Promise<Response> {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["token-error"],
+				pluginConfig: { "token-error": config },
+			});
+			return fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": session.id,
+				},
+				body: "grant_type=client_credentials",
+			});
+		}
+
+		it("should answer with an RFC 6749 error body instead of a token", async () => {
+			const response = await requestToken({});
+
+			expect(response.status).toBe(400);
+			expect(response.headers.get("cache-control")).toBe("no-store");
+			const body = await response.json();
+			expect(body).toMatchObject({ error: "invalid_grant", code: "injected_token_error" });
+			expect(body.error_description).toBeTruthy();
+			expect(body).not.toHaveProperty("access_token");
+		});
+
+		it("should send the configured status whatever the error code", async () => {
+			const response = await requestToken({ error: "invalid_scope", status: 500 });
+
+			expect(response.status).toBe(500);
+			expect((await response.json()).error).toBe("invalid_scope");
+		});
+	});
+
+	describe("DPoP nonce challenge", () => {
+		async function dpopTokenRequest(sessionId: string, nonce?: string) {
+			const { publicKey, privateKey } = await jose.generateKeyPair("ES256");
+			const proof = await new jose.SignJWT({
+				htm: "POST",
+				htu: `${ISSUER}/token`,
+				jti: crypto.randomUUID(),
+				...(nonce ? { nonce } : {}),
+			})
+				.setProtectedHeader({ typ: "dpop+jwt", alg: "ES256", jwk: await jose.exportJWK(publicKey) })
+				.setIssuedAt()
+				.sign(privateKey);
+
+			return fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+					DPoP: proof,
+				},
+				body: "grant_type=client_credentials",
+			});
+		}
+
+		function outcomes(sessionId: string) {
+			return loki
+				.getSessionEvents(sessionId)
+				.filter((e) => e.type === "dpop-nonce-exchanged")
+				.map((e) => e.data.outcome);
+		}
+
+		it("should run the nonce challenge-response in require mode", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["dpop-nonce-challenge"],
+				pluginConfig: { "dpop-nonce-challenge": { mode: "require" } },
+			});
+
+			const challenge = await dpopTokenRequest(session.id);
+			expect(challenge.status).toBe(400);
+			expect((await challenge.json()).error).toBe("use_dpop_nonce");
+			const nonce = challenge.headers.get("dpop-nonce");
+			expect(nonce).toBeTruthy();
+
+			const retry = await dpopTokenRequest(session.id, nonce ?? "");
+			expect(retry.ok).toBe(true);
+			expect((await retry.json()).token_type).toBe("DPoP");
+			expect(outcomes(session.id)).toEqual(["challenged", "accepted"]);
+		});
+
+		it("should reject the correct nonce in reject-valid mode", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["dpop-nonce-challenge"],
+			});
+
+			const challenge = await dpopTokenRequest(session.id);
+			const nonce = challenge.headers.get("dpop-nonce") ?? "";
+			expect(nonce).not.toBe("");
+
+			const retry = await dpopTokenRequest(session.id, nonce);
+			expect(retry.status).toBe(400);
+			expect((await retry.json()).error).toBe("use_dpop_nonce");
+			expect(retry.headers.get("dpop-nonce")).not.toBe(nonce);
+			expect(outcomes(session.id)).toEqual(["challenged", "challenged"]);
+		});
+
+		it("should never issue a nonce in never-issue mode", async () => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["dpop-nonce-challenge"],
+				pluginConfig: { "dpop-nonce-challenge": { mode: "never-issue" } },
+			});
+
+			const response = await dpopTokenRequest(session.id);
+			expect(response.status).toBe(400);
+			const body = await response.json();
+			expect(body.error).toBe("use_dpop_nonce");
+			expect(body.code).toBe("dpop_nonce_required");
+			expect(response.headers.get("dpop-nonce")).toBeNull();
+		});
+
+		it("should not challenge DPoP proofs in a session without the plugin", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+
+			const response = await dpopTokenRequest(session.id);
+			expect(response.ok).toBe(true);
+			expect((await response.json()).token_type).toBe("DPoP");
+		});
+	});
+
+	describe("DPoP binding", () => {
+		async function dpopProof(claims: Record<string, unknown> = {}) {
+			const { publicKey, privateKey } = await jose.generateKeyPair("ES256");
+			const jwk = await jose.exportJWK(publicKey);
+			const proof = await new jose.SignJWT({
+				htm: "POST",
+				htu: `${ISSUER}/token`,
+				jti: crypto.randomUUID(),
+				...claims,
+			})
+				.setProtectedHeader({ typ: "dpop+jwt", alg: "ES256", jwk })
+				.setIssuedAt()
+				.sign(privateKey);
+			return { proof, thumbprint: await jose.calculateJwkThumbprint(jwk) };
+		}
+
+		function tokenRequest(sessionId: string, proof: string) {
+			return fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/x-www-form-urlencoded",
+					Authorization: `Basic ${btoa("test-client:test-secret")}`,
+					"X-Loki-Session": sessionId,
+					DPoP: proof,
+				},
+				body: "grant_type=client_credentials",
+			});
+		}
+
+		it("should bind the access token to the proof's key and report it", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+			const { proof, thumbprint } = await dpopProof();
+
+			const response = await tokenRequest(session.id, proof);
+			expect(response.ok).toBe(true);
+			const { access_token: accessToken } = await response.json();
+			expect(jose.decodeJwt(accessToken).cnf).toEqual({ jkt: thumbprint });
+			const [issuance] = loki.getSessionReport(session.id)?.issuances ?? [];
+			expect(issuance?.dpop).toEqual({ expected: thumbprint, issued: thumbprint });
+		});
+
+		it("should bind the token to another key with dpop-binding-mismatch", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["dpop-binding-mismatch"] });
+			const { proof, thumbprint } = await dpopProof();
+
+			const { access_token: accessToken } = await (await tokenRequest(session.id, proof)).json();
+			const { cnf } = jose.decodeJwt(accessToken) as { cnf: { jkt: string } };
+			expect(cnf.jkt).not.toBe(thumbprint);
+			const [issuance] = loki.getSessionReport(session.id)?.issuances ?? [];
+			expect(issuance?.dpop).toEqual({ expected: thumbprint, issued: cnf.jkt });
+		});
+
+		it("should refuse proofs for another request, and replayed ones", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+			const wrongMethod = await dpopProof({ htm: "GET" });
+			const wrongUrl = await dpopProof({ htu: `${ISSUER}/userinfo` });
+			for (const { proof } of [wrongMethod, wrongUrl]) {
+				const response = await tokenRequest(session.id, proof);
+				expect(response.status).toBe(400);
+				expect(await response.json()).toMatchObject({
+					error: "invalid_dpop_proof",
+					code: "dpop_proof_invalid",
+				});
+			}
+
+			const { proof } = await dpopProof();
+			expect((await tokenRequest(session.id, proof)).ok).toBe(true);
+			const replayed = await tokenRequest(session.id, proof);
+			expect(replayed.status).toBe(400);
+			expect((await replayed.json()).error_description).toContain("jti was already used");
+		});
+	});
+
+	describe("request IDs", () => {
+		async function requestToken(sessionId: string, requestId?: string): Promise<Response> {
+			const headers: Record<string, string> = {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				"X-Loki-Session": sessionId,
+			};
+			if (requestId) {
+				headers["X-Request-ID"] = requestId;
+			}
+			return fetch(`${ISSUER}/token`, {
+				method: "POST",
+				headers,
+				body: "grant_type=client_credentials",
+			});
+		}
+
+		it("should echo the request's X-Request-ID or generate one", async () => {
+			const honored = await fetch(`${ISSUER}/.well-known/openid-configuration`, {
+				headers: { "X-Request-ID": "client-trace-1" },
+			});
+			const generated = await fetch(`${ISSUER}/.well-known/openid-configuration`);
+
+			expect(honored.headers.get("x-request-id")).toBe("client-trace-1");
+			expect(honored.headers.get("x-loki-request-id")).toBe("client-trace-1");
+			expect(generated.headers.get("x-request-id")).toMatch(/^req_/);
+			expect(generated.headers.get("x-loki-request-id")).toBe(
+				generated.headers.get("x-request-id"),
+			);
+		});
+
+		it("should trace a request to the mischief and token it produced", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["alg-none"] });
+			const response = await requestToken(session.id, "client-trace-2");
+			const data = (await response.json()) as { access_token: string };
+
+			const trace = await (await fetch(`${ISSUER}/admin/requests/client-trace-2`)).json();
+			expect(trace.ledger).toEqual([
+				expect.objectContaining({ sessionId: session.id, requestId: "client-trace-2" }),
+			]);
+			expect(trace.tokens).toEqual([
+				expect.objectContaining({
+					jti: jose.decodeJwt(data.access_token).jti,
+					mischief: ["alg-none"],
+				}),
+			]);
+
+			expect((await fetch(`${ISSUER}/admin/requests/never-seen`)).status).toBe(404);
+		});
+
+		it("should echo a different ID with request-id-mismatch and record both", async () => {
+			const session = loki.createSession({ mode: "explicit", mischief: ["request-id-mismatch"] });
+			const response = await requestToken(session.id, "client-trace-3");
+			const echoed = response.headers.get("x-request-id");
+
+			expect(response.ok).toBe(true);
+			expect(echoed).not.toBe("client-trace-3");
+			expect(response.headers.get("x-loki-request-id")).toBe("client-trace-3");
+			expect(session.getLedger().entries.at(-1)?.evidence).toEqual({
+				receivedRequestId: "client-trace-3",
+				echoedRequestId: echoed,
+			});
 		});
 	});
 });
@@ -0,0 +1,127 @@
+import { generateKeyPairSync } from "node:crypto";
+import { request } from "node:https";
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { selfSignedCertificate } from "../../src/core/x509.js";
+import { Loki } from "../../src/index.js";
+
+/** A key pair and self-signed certificate, as PEM */
+function identity(commonName: string) {
+	const { privateKey } = generateKeyPairSync("ec", { namedCurve: "P-256" });
+	const cert = selfSignedCertificate({ privateKey, commonName });
+	return { cert, key: privateKey.export({ type: "pkcs8", format: "pem" }) as string };
+}
+
+describe("mTLS", () => {
+	let loki: Loki;
+	const PORT = 9898;
+	const ISSUER = `https://localhost:${PORT}`;
+	const server = identity("localhost");
+	const client = identity("test-client");
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost", tls: { cert: server.cert.pem, key: server.key } },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	/** Send a request over TLS, presenting the client certificate unless told otherwise */
+	function send(
+		path: string,
+		options: { body?: string; headers?: Record<string, string>; anonymous?: boolean } = {},
+	): Promise<{ status: number; body: string }> {
+		const credentials = options.anonymous ? {} : { cert: client.cert.pem, key: client.key };
+		return new Promise((resolve, reject) => {
+			const req = request(
+				`${ISSUER}${path}`,
+				{
+					method: options.body === undefined ? "GET" : "POST",
+					headers: options.headers,
+					rejectUnauthorized: false,
+					...credentials,
+				},
+				(res) => {
+					let body = "";
+					res.on("data", (chunk) => {
+						body += chunk;
+					});
+					res.on("end", () => resolve({ status: res.statusCode ?? 0, body }));
+				},
+			);
+			req.on("error", reject);
+			req.end(options.body);
+		});
+	}
+
+	async function requestToken(
+		headers: Record<string, string> = {},
+		anonymous = false,
+	): Promise<string> {
+		const response = await send("/token", {
+			body: "grant_type=client_credentials",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				...headers,
+			},
+			anonymous,
+		});
+		expect(response.status).toBe(200);
+		return JSON.parse(response.body).access_token;
+	}
+
+	async function verify(token: string) {
+		const jwks = jose.createLocalJWKSet(JSON.parse((await send("/jwks")).body));
+		return (await jose.jwtVerify(token, jwks)).payload;
+	}
+
+	it("should serve HTTPS", () => {
+		expect(loki.address).toBe(`https://localhost:${PORT}`);
+	});
+
+	it("should bind access tokens to the client certificate presented", async () => {
+		const claims = await verify(await requestToken());
+
+		expect(claims.cnf).toEqual({ "x5t#S256": client.cert.x5tS256 });
+	});
+
+	it("should leave tokens unbound when no certificate is presented", async () => {
+		const claims = await verify(await requestToken({}, true));
+
+		expect(claims.cnf).toBeUndefined();
+	});
+
+	it("should bind session tokens to the wrong certificate under mischief", async () => {
+		const mischief = ["cert-bound-token-mismatch"];
+		const session = loki.createSession({ mode: "explicit", mischief });
+
+		const claims = await verify(await requestToken({ "X-Loki-Session": session.id }));
+
+		const cnf = claims.cnf as Record<string, string>;
+		expect(cnf["x5t#S256"]).toMatch(/^[A-Za-z0-9_-]{43}$/);
+		expect(cnf["x5t#S256"]).not.toBe(client.cert.x5tS256);
+		const report = JSON.parse((await send(`/admin/sessions/${session.id}/report`)).body);
+		const [mutation] = report.issuances[0].mutations;
+		expect(mutation.evidence).toMatchObject({
+			expected: client.cert.x5tS256,
+			emitted: cnf["x5t#S256"],
+			signatureValid: true,
+		});
+	});
+});
@@ -0,0 +1,73 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+import { REDIRECT_URI, signInWithCode } from "./helpers/auth-code.js";
+
+describe("Nonce Round-Trip", () => {
+	let loki: Loki;
+	const PORT = 9893;
+	const ISSUER = `http://localhost:${PORT}`;
+	const NONCE = "n-0S6_WzA2Mj";
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "spa-client",
+						token_endpoint_auth_method: "none",
+						redirect_uris: [REDIRECT_URI],
+						grant_types: ["authorization_code"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	/**
+	 * Sign in with a nonce, returning the ID token's claims
+	 */
+	async function signIn(sessionId: string): Promise<jose.JWTPayload> {
+		const tokens = await signInWithCode<{ id_token: string }>({
+			issuer: ISSUER,
+			sessionId,
+			params: { nonce: NONCE },
+		});
+		return jose.decodeJwt(tokens.id_token);
+	}
+
+	it("should echo the request nonce into the ID token", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+
+		expect((await signIn(session.id)).nonce).toBe(NONCE);
+		const report = loki.getSessionReport(session.id);
+		const issuance = report?.issuances.find((i) => i.tokenType === "id_token");
+		expect(issuance?.nonce).toEqual({ expected: NONCE, actual: NONCE });
+	});
+
+	it("should drop or replace the nonce under nonce mischief", async () => {
+		const cases = [
+			{ mischief: "nonce-omission", present: false },
+			{ mischief: "nonce-mismatch", present: true },
+		];
+		for (const { mischief, present } of cases) {
+			const session = loki.createSession({ mode: "explicit", mischief: [mischief] });
+
+			const claims = await signIn(session.id);
+			expect(claims.nonce).not.toBe(NONCE);
+			expect(claims.nonce !== undefined).toBe(present);
+			const report = loki.getSessionReport(session.id);
+			const issuance = report?.issuances.find((i) => i.tokenType === "id_token");
+			expect(issuance?.mischief).toEqual([mischief]);
+			expect(issuance?.nonce).toEqual({ expected: NONCE, actual: claims.nonce ?? null });
+		}
+	});
+});
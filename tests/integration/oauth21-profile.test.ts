@@ -0,0 +1,194 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("OAuth 2.1 Profile", () => {
+	let loki: Loki;
+	const PORT = 9880;
+	const ISSUER = `http://localhost:${PORT}`;
+	const REDIRECT_URI = "http://localhost:8080/callback";
+	// RFC 7636 Appendix B verifier/challenge pair
+	const CODE_CHALLENGE = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM";
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				profile: "oauth21",
+				clients: [
+					{
+						client_id: "web-client",
+						client_secret: "web-secret",
+						redirect_uris: [REDIRECT_URI],
+						grant_types: ["authorization_code", "refresh_token"],
+					},
+					{
+						client_id: "service-client",
+						client_secret: "service-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	function authorize(
+		params: Record<string, string>,
+		headers: Record<string, string> = {},
+	): Promise<Response> {
+		const query = new URLSearchParams({
+			client_id: "web-client",
+			redirect_uri: REDIRECT_URI,
+			response_type: "code",
+			scope: "openid",
+			...params,
+		});
+		return fetch(`${ISSUER}/auth?${query}`, { redirect: "manual", headers });
+	}
+
+	function redirectParams(response: Response): URLSearchParams {
+		const location = new URL(response.headers.get("location") ?? "", ISSUER);
+		const fragment = location.hash.startsWith("#") ? location.hash.slice(1) : "";
+		return new URLSearchParams(location.search || fragment);
+	}
+
+	it("should reject authorization requests without PKCE", async () => {
+		const response = await authorize({});
+
+		expect(response.status).toBe(303);
+		const params = redirectParams(response);
+		expect(params.get("error")).toBe("invalid_request");
+		expect(params.get("error_description")).toMatch(/PKCE/);
+	});
+
+	it("should reject the plain PKCE method", async () => {
+		const response = await authorize({
+			code_challenge: CODE_CHALLENGE,
+			code_challenge_method: "plain",
+		});
+
+		expect(redirectParams(response).get("error")).toBe("invalid_request");
+	});
+
+	it("should accept plain PKCE under pkce-plain-accept and record it", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["pkce-plain-accept"] });
+		const response = await authorize(
+			{ code_challenge: CODE_CHALLENGE, code_challenge_method: "plain" },
+			{ "X-Loki-Session": session.id },
+		);
+
+		expect(response.status).toBe(303);
+		expect(response.headers.get("location")).toContain("/interaction/");
+
+		const events = session.getEvents();
+		expect(events[0]?.type).toBe("pkce-challenge");
+		expect(events[0]?.data).toEqual({ method: "plain", accepted: true, downgraded: true });
+		expect(session.getLedger().entries[0]?.plugin.id).toBe("pkce-plain-accept");
+	});
+
+	it("should record rejected plain PKCE for sessions without the mischief", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const response = await authorize(
+			{ code_challenge: CODE_CHALLENGE, code_challenge_method: "plain" },
+			{ "X-Loki-Session": session.id },
+		);
+
+		expect(redirectParams(response).get("error")).toBe("invalid_request");
+		expect(session.getEvents()[0]?.data).toEqual({
+			method: "plain",
+			accepted: false,
+			downgraded: false,
+		});
+	});
+
+	it("should accept S256 PKCE", async () => {
+		const response = await authorize({
+			code_challenge: CODE_CHALLENGE,
+			code_challenge_method: "S256",
+		});
+
+		// Proceeds to the login interaction instead of redirecting back with an error
+		expect(response.status).toBe(303);
+		expect(response.headers.get("location")).toContain("/interaction/");
+	});
+
+	it("should reject implicit response types", async () => {
+		const response = await authorize({
+			response_type: "id_token token",
+			nonce: "n-0S6_WzA2Mj",
+			code_challenge: CODE_CHALLENGE,
+			code_challenge_method: "S256",
+		});
+
+		expect(redirectParams(response).get("error")).toBe("unsupported_response_type");
+	});
+
+	it("should require an exact redirect URI match", async () => {
+		const response = await authorize({
+			redirect_uri: `${REDIRECT_URI}/extra`,
+			code_challenge: CODE_CHALLENGE,
+			code_challenge_method: "S256",
+		});
+
+		// Never redirects to an unregistered URI
+		expect(response.status).toBe(400);
+		const body = (await response.json()) as { error: string };
+		expect(body.error).toBe("invalid_redirect_uri");
+	});
+
+	it("should reject the password grant", async () => {
+		const response = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("service-client:service-secret")}`,
+			},
+			body: "grant_type=password&username=alice&password=secret",
+		});
+
+		expect(response.status).toBe(400);
+		const body = (await response.json()) as { error: string };
+		expect(body.error).toBe("unsupported_grant_type");
+	});
+
+	it("should refuse to start with a client registered for a removed grant", async () => {
+		const legacy = new Loki({
+			server: { port: PORT + 1, host: "localhost" },
+			provider: {
+				issuer: `http://localhost:${PORT + 1}`,
+				profile: "oauth21",
+				clients: [
+					{
+						client_id: "legacy-client",
+						client_secret: "legacy-secret",
+						grant_types: ["password"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+
+		await expect(legacy.start()).rejects.toThrow(/removed in OAuth 2\.1: password/);
+	});
+
+	it("should refuse to start with plain as the minimum PKCE method", async () => {
+		const lenient = new Loki({
+			server: { port: PORT + 1, host: "localhost" },
+			provider: {
+				issuer: `http://localhost:${PORT + 1}`,
+				profile: "oauth21",
+				pkceMinimumMethod: "plain",
+				clients: [],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+
+		await expect(lenient.start()).rejects.toThrow(/requires the S256 PKCE method/);
+	});
+});
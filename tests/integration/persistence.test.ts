@@ -135,11 +135,49 @@ describe("Persistence Integration", () => {
 
 		const loadedSession = loki2.getSession(session.id);
 		expect(loadedSession).toBeDefined();
-
-		// Note: Ledger entries are loaded from database by MischiefEngine
-		// For now, verify session was persisted correctly
 		expect(loadedSession?.mode).toBe("explicit");
+		expect(loadedSession?.getLedger().entries).toEqual(ledger.entries);
+
+		await loki2.stop();
+	});
+
+	it("should restore sessions, ledgers and plugin config from a JSON store", async () => {
+		const TEST_JSON_PATH = "./test-data/persistence-test.json";
+		const config = {
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{ client_id: "test", client_secret: "secret", grant_types: ["client_credentials"] },
+				],
+			},
+			persistence: { enabled: true, path: TEST_JSON_PATH, store: "json" as const },
+		};
+
+		const loki1 = new Loki(config);
+		await loki1.start();
+		const session = loki1.createSession({
+			mode: "explicit",
+			mischief: ["alg-none"],
+			pluginConfig: { "latency-injection": { delayMs: 5 } },
+		});
+		await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test:secret")}`,
+				"X-Loki-Session": session.id,
+			},
+			body: "grant_type=client_credentials",
+		});
+		await loki1.stop();
+		expect(existsSync(TEST_JSON_PATH)).toBe(true);
 
+		const loki2 = new Loki(config);
+		await loki2.start();
+		const restored = loki2.getSession(session.id);
+		expect(restored?.getLedger().entries[0]?.plugin.id).toBe("alg-none");
+		expect(loki2.listSessions()[0]?.pluginConfig).toEqual({ "latency-injection": { delayMs: 5 } });
 		await loki2.stop();
 	});
 
@@ -0,0 +1,115 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+import { REDIRECT_URI, VERIFIER, authorizationCode } from "./helpers/auth-code.js";
+
+describe("PKCE Authorization Code Flow", () => {
+	let loki: Loki;
+	const PORT = 9891;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "spa-client",
+						token_endpoint_auth_method: "none",
+						redirect_uris: [REDIRECT_URI],
+						grant_types: ["authorization_code"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	function authorize(sessionId: string): Promise<string> {
+		return authorizationCode({ issuer: ISSUER, sessionId });
+	}
+
+	async function redeem(code: string, sessionId: string, verifier?: string): Promise<Response> {
+		const form = new URLSearchParams({
+			grant_type: "authorization_code",
+			code,
+			redirect_uri: REDIRECT_URI,
+			client_id: "spa-client",
+		});
+		if (verifier !== undefined) {
+			form.set("code_verifier", verifier);
+		}
+		return fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				"X-Loki-Session": sessionId,
+			},
+			body: form.toString(),
+		});
+	}
+
+	it("should redeem a code once, with the verifier for its challenge", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const code = await authorize(session.id);
+
+		const redeemed = await redeem(code, session.id, VERIFIER);
+		expect(redeemed.status).toBe(200);
+		expect((await redeemed.json()).access_token).toBeDefined();
+
+		const replayed = await redeem(code, session.id, VERIFIER);
+		expect(replayed.status).toBe(400);
+		expect((await replayed.json()).error).toBe("invalid_grant");
+
+		const verified = session.getEvents().filter((event) => event.type === "pkce-verified");
+		expect(verified[0]?.data).toEqual({
+			method: "S256",
+			verifierPresented: true,
+			valid: true,
+			ignored: false,
+		});
+	});
+
+	it("should refuse a wrong or missing verifier", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const code = await authorize(session.id);
+
+		for (const verifier of ["wrong-verifier-wrong-verifier-wrong-verifier", undefined]) {
+			const response = await redeem(code, session.id, verifier);
+			expect(response.status).toBe(400);
+			const body = await response.json();
+			expect(body.error).toBe("invalid_grant");
+			expect(body.code).toBe("pkce_verification_failed");
+		}
+	});
+
+	it("should refuse a code redeemed in another session", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const other = loki.createSession({ mode: "explicit", mischief: [] });
+		const code = await authorize(session.id);
+
+		const response = await redeem(code, other.id, VERIFIER);
+		expect(response.status).toBe(400);
+		expect((await response.json()).code).toBe("authorization_code_session_mismatch");
+	});
+
+	it("should issue tokens without the verifier under pkce-downgrade", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["pkce-downgrade"] });
+		const code = await authorize(session.id);
+
+		const response = await redeem(code, session.id);
+		expect(response.status).toBe(200);
+		expect((await response.json()).access_token).toBeDefined();
+
+		const entries = session.getLedger().entries;
+		expect(entries.map((entry) => entry.plugin.id)).toEqual(["pkce-downgrade"]);
+		expect(entries[0]?.evidence).toMatchObject({ method: "S256", verifierPresented: false });
+		const verified = session.getEvents().filter((event) => event.type === "pkce-verified");
+		expect(verified[0]?.data).toMatchObject({ valid: false, ignored: true });
+	});
+});
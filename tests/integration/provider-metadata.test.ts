@@ -0,0 +1,129 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Provider Metadata", () => {
+	let loki: Loki;
+	const PORT = 9889;
+	const ISSUER = `http://localhost:${PORT}`;
+	const OPENID = `${ISSUER}/.well-known/openid-configuration`;
+	const OAUTH = `${ISSUER}/.well-known/oauth-authorization-server`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	async function metadata(url: string, sessionId?: string): Promise<Record<string, unknown>> {
+		const headers: Record<string, string> = sessionId ? { "X-Loki-Session": sessionId } : {};
+		const response = await fetch(url, { headers });
+		expect(response.status).toBe(200);
+		return response.json();
+	}
+
+	it("should serve RFC 8414 metadata derived from the OpenID document", async () => {
+		const openid = await metadata(OPENID);
+		const oauth = await metadata(OAUTH);
+
+		expect(oauth.issuer).toBe(ISSUER);
+		expect(oauth.jwks_uri).toBe(openid.jwks_uri);
+		expect(oauth.token_endpoint).toBe(openid.token_endpoint);
+		expect(oauth.revocation_endpoint).toBe(`${ISSUER}/token/revocation`);
+		expect(oauth.introspection_endpoint).toBe(`${ISSUER}/token/introspection`);
+		expect(oauth.userinfo_endpoint).toBeUndefined();
+		expect(oauth.id_token_signing_alg_values_supported).toBeUndefined();
+		expect(openid.userinfo_endpoint).toBeDefined();
+	});
+
+	it("should answer HEAD with the length GET would send", async () => {
+		const get = await fetch(OAUTH);
+		const body = await get.text();
+		const head = await fetch(OAUTH, { method: "HEAD" });
+
+		expect(head.status).toBe(200);
+		expect(Number(head.headers.get("content-length"))).toBe(Buffer.byteLength(body));
+	});
+
+	it("should advertise conflicting jwks_uri values with metadata-mismatch", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["metadata-mismatch"] });
+
+		const openid = await metadata(OPENID, session.id);
+		const oauth = await metadata(OAUTH, session.id);
+
+		expect(openid.jwks_uri).toBe(`${ISSUER}/jwks`);
+		expect(oauth.jwks_uri).toBe("https://attacker.example.com/.well-known/jwks.json");
+
+		const entries = session.getLedger().entries;
+		expect(entries).toHaveLength(1);
+		expect(entries[0]?.evidence).toMatchObject({ document: "oauth-authorization-server" });
+	});
+
+	it("should apply discovery-tampering to a session named by loki_session", async () => {
+		const session = loki.createSession({
+			mode: "explicit",
+			mischief: ["discovery-tampering"],
+			pluginConfig: { "discovery-tampering": { omit: ["jwks_uri"], algs: ["none"] } },
+		});
+
+		const tampered = await metadata(`${OPENID}?loki_session=${session.id}`);
+		expect(tampered.jwks_uri).toBeUndefined();
+		expect(tampered.id_token_signing_alg_values_supported).toEqual(["none"]);
+		expect(tampered.issuer).toBe(ISSUER);
+
+		const plain = await metadata(OPENID);
+		expect(plain.jwks_uri).toBe(`${ISSUER}/jwks`);
+
+		const entries = session.getLedger().entries;
+		expect(entries).toHaveLength(1);
+		expect(entries[0]?.evidence).toMatchObject({ omitted: ["jwks_uri"], algs: ["none"] });
+	});
+
+	it("should apply JWKS mischief to a fetch naming its session by loki_session", async () => {
+		const session = loki.createSession({
+			mode: "explicit",
+			mischief: ["jwks-transport-abuse"],
+			pluginConfig: { "jwks-transport-abuse": { encoding: "identity", keyCount: 5 } },
+		});
+		const keys = async (url: string, headers: Record<string, string> = {}) => {
+			const response = await fetch(url, { headers });
+			return ((await response.json()) as { keys: unknown[] }).keys.length;
+		};
+
+		expect(await keys(`${ISSUER}/jwks?loki_session=${session.id}`)).toBe(5);
+		expect(await keys(`${ISSUER}/.well-known/jwks.json?loki_session=${session.id}`)).toBe(5);
+		expect(await keys(`${ISSUER}/jwks`)).toBeLessThan(5);
+		expect(session.getLedger().entries).toHaveLength(2);
+
+		// A client following session-named discovery to the JWKS stays in the session
+		const discovered = await metadata(`${OPENID}?loki_session=${session.id}`);
+		expect(discovered.jwks_uri).toBe(`${ISSUER}/jwks?loki_session=${session.id}`);
+		expect(await keys(discovered.jwks_uri as string)).toBe(5);
+		expect((await metadata(OPENID)).jwks_uri).toBe(`${ISSUER}/jwks`);
+	});
+
+	it("should bind a request sending both to the session its header names", async () => {
+		const header = loki.createSession({ mode: "explicit", mischief: [] });
+		const query = loki.createSession({ mode: "explicit", mischief: ["discovery-tampering"] });
+
+		const served = await metadata(`${OPENID}?loki_session=${query.id}`, header.id);
+
+		expect(served.jwks_uri).toBe(`${ISSUER}/jwks`);
+		expect(query.getLedger().entries).toHaveLength(0);
+	});
+});
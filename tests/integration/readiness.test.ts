@@ -0,0 +1,182 @@
+import { type Server, type Socket, createServer } from "node:net";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+import { RespParser } from "../../src/persistence/redis-client.js";
+
+/**
+ * Just enough Redis for Loki to open its store, answering nothing until released
+ */
+class HeldRedis {
+	readonly server: Server;
+	private readonly sockets = new Set<Socket>();
+	private readonly values = new Map<string, string>();
+	private release: () => void = () => {};
+	private readonly released = new Promise<void>((resolve) => {
+		this.release = resolve;
+	});
+
+	constructor() {
+		this.server = createServer((socket) => {
+			this.sockets.add(socket);
+			const parser = new RespParser();
+			socket.on("data", async (chunk) => {
+				const commands = parser.push(chunk) as string[][];
+				await this.released;
+				for (const command of commands) {
+					socket.write(this.reply(command));
+				}
+			});
+			socket.on("error", () => {});
+		});
+	}
+
+	get port(): number {
+		const address = this.server.address();
+		return typeof address === "object" && address ? address.port : 0;
+	}
+
+	listen(port = 0): Promise<void> {
+		return new Promise((resolve) => this.server.listen(port, "127.0.0.1", () => resolve()));
+	}
+
+	answer(): void {
+		this.release();
+	}
+
+	/** Stop listening and drop every connection */
+	stop(): Promise<void> {
+		for (const socket of this.sockets) {
+			socket.destroy();
+		}
+		this.sockets.clear();
+		return new Promise((resolve) => this.server.close(() => resolve()));
+	}
+
+	private reply([name = "", key = "", value = "", flag]: string[]): string {
+		if (name === "HKEYS" || name === "LRANGE") {
+			return "*0\r\n";
+		}
+		if (name === "SET") {
+			if (flag !== "NX" || !this.values.has(key)) {
+				this.values.set(key, value);
+			}
+			return "+OK\r\n";
+		}
+		if (name === "GET") {
+			const stored = this.values.get(key);
+			return stored === undefined ? "$-1\r\n" : `$${Buffer.byteLength(stored)}\r\n${stored}\r\n`;
+		}
+		return ":1\r\n";
+	}
+}
+
+describe("Health and Readiness Probes", () => {
+	const PORT = 9905;
+	const ISSUER = `http://localhost:${PORT}`;
+	const redis = new HeldRedis();
+	let loki: Loki;
+	let started: Promise<void>;
+
+	beforeAll(async () => {
+		await redis.listen();
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: { issuer: ISSUER, clients: [] },
+			persistence: {
+				enabled: true,
+				path: "",
+				store: "redis",
+				redisAddr: `127.0.0.1:${redis.port}`,
+			},
+		});
+		started = loki.start();
+		for (let attempt = 0; attempt < 50; attempt++) {
+			try {
+				await fetch(`${ISSUER}/healthz`);
+				return;
+			} catch {
+				await new Promise((resolve) => setTimeout(resolve, 20));
+			}
+		}
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+		redis.server.close();
+	});
+
+	it("should be live but not ready while the session store connects", async () => {
+		const live = await fetch(`${ISSUER}/healthz`);
+		expect(live.status).toBe(200);
+		expect(await live.json()).toEqual({ status: "ok" });
+
+		const ready = await fetch(`${ISSUER}/readyz`);
+		expect(ready.status).toBe(503);
+		expect(await ready.json()).toEqual({
+			status: "not_ready",
+			components: {
+				signingKeys: { status: "pending" },
+				sessionStore: { status: "pending", store: "redis" },
+				provider: { status: "pending" },
+			},
+		});
+	});
+
+	it("should turn other requests away until ready", async () => {
+		const response = await fetch(`${ISSUER}/.well-known/openid-configuration`);
+		expect(response.status).toBe(503);
+		expect(response.headers.get("retry-after")).toBe("1");
+		const body = await response.json();
+		expect(body.error).toBe("temporarily_unavailable");
+		expect(body.code).toBe("not_ready");
+	});
+
+	it("should be ready once keys are generated and the store is connected", async () => {
+		redis.answer();
+		await started;
+
+		const ready = await fetch(`${ISSUER}/readyz`);
+		expect(ready.status).toBe(200);
+		expect(await ready.json()).toEqual({
+			status: "ready",
+			components: {
+				signingKeys: { status: "ready" },
+				sessionStore: { status: "ready", store: "redis" },
+				provider: { status: "ready" },
+			},
+		});
+		const discovery = await fetch(`${ISSUER}/.well-known/openid-configuration`);
+		expect(discovery.status).toBe(200);
+	});
+
+	it("should leave probes out of the request metrics", async () => {
+		await fetch(`${ISSUER}/healthz`);
+		await fetch(`${ISSUER}/readyz`);
+
+		const metrics = await (await fetch(`${ISSUER}/metrics`)).text();
+		expect(metrics).not.toContain("healthz");
+		expect(metrics).not.toContain("readyz");
+		expect(metrics).not.toMatch(/endpoint="other"/);
+	});
+
+	it("should not be ready while the store connection is down", async () => {
+		const port = redis.port;
+		await redis.stop();
+		await new Promise((resolve) => setTimeout(resolve, 100));
+
+		const ready = await fetch(`${ISSUER}/readyz`);
+		expect(ready.status).toBe(503);
+		const report = await ready.json();
+		expect(report.status).toBe("not_ready");
+		expect(report.components.sessionStore).toEqual({ status: "down", store: "redis" });
+		expect((await fetch(`${ISSUER}/healthz`)).status).toBe(200);
+
+		await redis.listen(port);
+		let status = 503;
+		for (let attempt = 0; attempt < 50 && status !== 200; attempt++) {
+			await new Promise((resolve) => setTimeout(resolve, 50));
+			status = (await fetch(`${ISSUER}/readyz`)).status;
+		}
+		expect(status).toBe(200);
+	});
+});
@@ -0,0 +1,91 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+import { REDIRECT_URI, VERIFIER, followAuthorization } from "./helpers/auth-code.js";
+
+describe("Redirect URI Validation", () => {
+	let loki: Loki;
+	const PORT = 9911;
+	const ISSUER = `http://localhost:${PORT}`;
+	const ROGUE_URI = "https://attacker.example/collect";
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "spa-client",
+						token_endpoint_auth_method: "none",
+						redirect_uris: [REDIRECT_URI],
+						grant_types: ["authorization_code"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	/**
+	 * Authorize, returning the response that leaves Loki
+	 */
+	function authorize(sessionId: string, redirectUri: string): Promise<Response> {
+		return followAuthorization({ issuer: ISSUER, sessionId, redirectUri });
+	}
+
+	it("should refuse a redirect URI the client didn't register", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+
+		const response = await authorize(session.id, `${REDIRECT_URI}/extra`);
+
+		expect(response.status).toBe(400);
+		expect(((await response.json()) as { error: string }).error).toBe("invalid_redirect_uri");
+		const events = loki.getSessionEvents(session.id);
+		expect(events.find((e) => e.type === "redirect-uri-mismatch")?.data).toEqual({
+			clientId: "spa-client",
+			requested: `${REDIRECT_URI}/extra`,
+			registered: [REDIRECT_URI],
+			accepted: false,
+		});
+	});
+
+	it("should deliver the code to an unregistered URI under the bypass mischief", async () => {
+		const session = loki.createSession({
+			mode: "explicit",
+			mischief: ["redirect-uri-validation-bypass"],
+		});
+
+		const response = await authorize(session.id, ROGUE_URI);
+
+		const location = new URL(response.headers.get("location") ?? "");
+		expect(`${location.origin}${location.pathname}`).toBe(ROGUE_URI);
+		const code = location.searchParams.get("code");
+		expect(code).toBeTruthy();
+
+		// The code is bound to the URI it was delivered to
+		const token = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: { "Content-Type": "application/x-www-form-urlencoded" },
+			body: new URLSearchParams({
+				grant_type: "authorization_code",
+				code: code ?? "",
+				redirect_uri: ROGUE_URI,
+				client_id: "spa-client",
+				code_verifier: VERIFIER,
+			}).toString(),
+		});
+		expect(token.ok).toBe(true);
+
+		const events = loki.getSessionEvents(session.id);
+		expect(events.find((e) => e.type === "redirect-uri-mismatch")?.data).toMatchObject({
+			requested: ROGUE_URI,
+			registered: [REDIRECT_URI],
+			accepted: true,
+		});
+	});
+});
@@ -0,0 +1,100 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+import { REDIRECT_URI, signInWithCode } from "./helpers/auth-code.js";
+
+describe("Refresh Token Rotation", () => {
+	let loki: Loki;
+	const PORT = 9894;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	interface TokenResponse {
+		access_token: string;
+		id_token: string;
+		refresh_token: string;
+	}
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "spa-client",
+						token_endpoint_auth_method: "none",
+						redirect_uris: [REDIRECT_URI],
+						grant_types: ["authorization_code", "refresh_token"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	/**
+	 * Sign in for offline access
+	 */
+	function signIn(sessionId: string): Promise<TokenResponse> {
+		return signInWithCode({
+			issuer: ISSUER,
+			sessionId,
+			scope: "openid offline_access",
+			params: { prompt: "consent" },
+		});
+	}
+
+	/**
+	 * Redeem a refresh token without naming a session
+	 */
+	function refresh(refreshToken: string): Promise<Response> {
+		return fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: { "Content-Type": "application/x-www-form-urlencoded" },
+			body: new URLSearchParams({
+				grant_type: "refresh_token",
+				refresh_token: refreshToken,
+				client_id: "spa-client",
+			}).toString(),
+		});
+	}
+
+	it("should rotate refresh tokens and keep session mischief without the header", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["temporal-tampering"] });
+		const issued = await signIn(session.id);
+
+		const response = await refresh(issued.refresh_token);
+		expect(response.status).toBe(200);
+		const rotated = (await response.json()) as TokenResponse;
+		expect(rotated.refresh_token).not.toBe(issued.refresh_token);
+		const exp = jose.decodeJwt(rotated.id_token).exp ?? 0;
+		expect(exp).toBeLessThan(Math.floor(Date.now() / 1000));
+
+		const ledger = loki.getRefreshLedger(session.id);
+		expect(ledger.rotations.map(({ from, to }) => [from, to])).toEqual([
+			[issued.refresh_token, rotated.refresh_token],
+		]);
+	});
+
+	it("should revoke on reuse unless refresh-reuse-detection-off accepts it", async () => {
+		const cases = [
+			{ mischief: [], status: 400, accepted: false },
+			{ mischief: ["refresh-reuse-detection-off"], status: 200, accepted: true },
+		];
+		for (const { mischief, status, accepted } of cases) {
+			const session = loki.createSession({ mode: "explicit", mischief });
+			const issued = await signIn(session.id);
+			expect((await refresh(issued.refresh_token)).status).toBe(200);
+
+			const reused = await refresh(issued.refresh_token);
+			expect(reused.status).toBe(status);
+			const ledger = loki.getRefreshLedger(session.id);
+			expect(ledger.reuses.map((reuse) => reuse.accepted)).toEqual([accepted]);
+		}
+	});
+});
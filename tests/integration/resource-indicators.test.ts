@@ -0,0 +1,96 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Resource Indicators", () => {
+	let loki: Loki;
+	const PORT = 9904;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	function requestToken(sessionId: string, resources: string[]): Promise<Response> {
+		const body = new URLSearchParams({ grant_type: "client_credentials" });
+		for (const resource of resources) {
+			body.append("resource", resource);
+		}
+		return fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				"X-Loki-Session": sessionId,
+			},
+			body: body.toString(),
+		});
+	}
+
+	async function accessTokenAud(response: Response): Promise<unknown> {
+		expect(response.status).toBe(200);
+		const { access_token: accessToken } = await response.json();
+		return jose.decodeJwt(accessToken).aud;
+	}
+
+	it("should issue the access token for the one resource requested", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const response = await requestToken(session.id, ["https://orders.example/api"]);
+
+		expect(await accessTokenAud(response)).toBe("https://orders.example/api");
+	});
+
+	it("should issue an array aud for several resources", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const resources = ["https://orders.example/api", "https://billing.example/api"];
+		const response = await requestToken(session.id, resources);
+
+		expect(await accessTokenAud(response)).toEqual(resources);
+	});
+
+	it("should reject a resource that isn't an absolute URI without a fragment", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		for (const resource of ["/orders", "https://orders.example/api#v2"]) {
+			const response = await requestToken(session.id, [resource]);
+			expect(response.status).toBe(400);
+			const body = await response.json();
+			expect(body.error).toBe("invalid_target");
+			expect(body.code).toBe("invalid_resource");
+			expect(body.details.resource).toBe(resource);
+		}
+	});
+
+	it("should report the requested audience next to the one audience-ignoring issued", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["audience-ignoring"] });
+		const response = await requestToken(session.id, ["https://orders.example/api"]);
+		expect(await accessTokenAud(response)).toBe("https://loki.test/api");
+
+		const report = await (await fetch(`${ISSUER}/admin/sessions/${session.id}/report`)).json();
+		const accessToken = report.issuances.find(
+			(issuance: { tokenType: string }) => issuance.tokenType === "access_token",
+		);
+		expect(accessToken.audience).toEqual({
+			requested: "https://orders.example/api",
+			issued: "https://loki.test/api",
+		});
+		expect(accessToken.mischief).toEqual(["audience-ignoring"]);
+	});
+});
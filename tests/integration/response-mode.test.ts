@@ -0,0 +1,94 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+import { REDIRECT_URI, followAuthorization } from "./helpers/auth-code.js";
+
+describe("Authorization Response Modes", () => {
+	let loki: Loki;
+	const PORT = 9902;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "spa-client",
+						token_endpoint_auth_method: "none",
+						redirect_uris: [REDIRECT_URI],
+						grant_types: ["authorization_code"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	/**
+	 * Authorize, returning the response that delivers the code to the client
+	 */
+	function authorize(sessionId: string, responseMode?: string): Promise<Response> {
+		return followAuthorization({
+			issuer: ISSUER,
+			sessionId,
+			params: responseMode === undefined ? {} : { response_mode: responseMode },
+		});
+	}
+
+	function responseModeEvents(session: ReturnType<Loki["createSession"]>): unknown[] {
+		return session
+			.getEvents()
+			.filter((event) => event.type === "response-mode-requested")
+			.map((event) => event.data);
+	}
+
+	it("should redirect with the code in the query string by default", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const response = await authorize(session.id);
+
+		const location = new URL(response.headers.get("location") ?? "");
+		expect(location.searchParams.get("code")).toBeTruthy();
+		expect(responseModeEvents(session)).toEqual([]);
+	});
+
+	it("should redirect with the code in the fragment for response_mode=fragment", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const response = await authorize(session.id, "fragment");
+
+		const location = new URL(response.headers.get("location") ?? "");
+		expect(location.searchParams.get("code")).toBeNull();
+		expect(new URLSearchParams(location.hash.slice(1)).get("code")).toBeTruthy();
+	});
+
+	it("should answer response_mode=form_post with an auto-submitting form", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const response = await authorize(session.id, "form_post");
+
+		expect(response.status).toBe(200);
+		expect(response.headers.get("content-type")).toContain("text/html");
+		const page = await response.text();
+		expect(page).toMatch(/<form[^>]*method="post"[^>]*action="http:\/\/localhost:8080\/callback"/);
+		expect(page).toMatch(/<input type="hidden" name="code" value="[^"]+"/);
+		expect(page).toMatch(/document\.forms\[0\]\.submit\(\)/);
+		expect(responseModeEvents(session)).toEqual([
+			{ clientId: "spa-client", requested: "form_post", served: "form_post", downgraded: false },
+		]);
+	});
+
+	it("should leak the code in the query string under response-mode-downgrade", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["response-mode-downgrade"] });
+		const response = await authorize(session.id, "form_post");
+
+		const location = new URL(response.headers.get("location") ?? "");
+		expect(location.searchParams.get("code")).toBeTruthy();
+		expect(responseModeEvents(session)).toEqual([
+			{ clientId: "spa-client", requested: "form_post", served: "query", downgraded: true },
+		]);
+	});
+});
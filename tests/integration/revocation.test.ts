@@ -0,0 +1,117 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Token Revocation", () => {
+	let loki: Loki;
+	const PORT = 9910;
+	const ISSUER = `http://localhost:${PORT}`;
+	const AUTHORIZATION = `Basic ${btoa("test-client:test-secret")}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	function post(path: string, params: Record<string, string>, authorization = AUTHORIZATION) {
+		return fetch(`${ISSUER}${path}`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: authorization,
+			},
+			body: new URLSearchParams(params).toString(),
+		});
+	}
+
+	async function issueToken(sessionId: string): Promise<string> {
+		const response = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: AUTHORIZATION,
+				"X-Loki-Session": sessionId,
+			},
+			body: "grant_type=client_credentials",
+		});
+		return ((await response.json()) as { access_token: string }).access_token;
+	}
+
+	async function isActive(token: string): Promise<boolean> {
+		const body = (await (await post("/introspect", { token })).json()) as { active: boolean };
+		return body.active;
+	}
+
+	it("should revoke a session's token, reporting it inactive afterwards", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+		const token = await issueToken(session.id);
+		expect(await isActive(token)).toBe(true);
+
+		const response = await post("/revoke", { token, token_type_hint: "access_token" });
+		expect(response.status).toBe(200);
+		expect(response.headers.get("cache-control")).toBe("no-store");
+		expect(await response.text()).toBe("");
+		expect(await isActive(token)).toBe(false);
+
+		const [revocation] = loki.getSessionReport(session.id)?.revocations ?? [];
+		expect(revocation).toMatchObject({
+			tokenType: "access_token",
+			clientId: "test-client",
+			ignored: false,
+			mischief: [],
+		});
+		const event = session.getEvents().find((e) => e.type === "token-revoked");
+		expect(event?.data).toMatchObject({ known: true, ignored: false });
+	});
+
+	it("should answer 200 but leave the token active under revocation-ignored", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["revocation-ignored"] });
+		const token = await issueToken(session.id);
+
+		const response = await post("/revoke", { token });
+		expect(response.status).toBe(200);
+		expect(await isActive(token)).toBe(true);
+
+		const list = (await (await fetch(`${ISSUER}/revocations`)).json()) as {
+			revoked: { jti: string }[];
+		};
+		const jti = loki.getSessionReport(session.id)?.revocations?.[0]?.jti;
+		expect(list.revoked.map((entry) => entry.jti)).not.toContain(jti);
+		expect(loki.getSessionReport(session.id)?.revocations?.[0]).toMatchObject({
+			ignored: true,
+			mischief: ["revocation-ignored"],
+		});
+	});
+
+	it("should answer 200 for a token Loki never issued", async () => {
+		const response = await post("/revoke", { token: "never-issued" });
+		expect(response.status).toBe(200);
+	});
+
+	it("should require client authentication and a token", async () => {
+		const wrongSecret = `Basic ${btoa("test-client:wrong")}`;
+		const unauthenticated = await post("/revoke", { token: "never-issued" }, wrongSecret);
+		expect(unauthenticated.status).toBe(401);
+		expect((await unauthenticated.json()).code).toBe("client_authentication_failed");
+
+		const missing = await post("/revoke", {});
+		expect(missing.status).toBe(400);
+		expect((await missing.json()).code).toBe("token_missing");
+	});
+});
@@ -0,0 +1,106 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { decodeDisclosure, disclosureDigest } from "../../src/core/sd-jwt.js";
+import { Loki } from "../../src/index.js";
+
+describe("SD-JWT Issuance", () => {
+	let loki: Loki;
+	const PORT = 9906;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	async function createSession(spec: Record<string, unknown>): Promise<Response> {
+		return fetch(`${ISSUER}/admin/sessions`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify(spec),
+		});
+	}
+
+	/**
+	 * Request an access token and split it as SD-JWT tooling does; the JWS
+	 * must verify against the JWKS
+	 */
+	async function issue(sessionId: string) {
+		const response = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				"X-Loki-Session": sessionId,
+			},
+			body: "grant_type=client_credentials",
+		});
+		expect(response.status).toBe(200);
+		const { access_token: sdJwt } = (await response.json()) as { access_token: string };
+		expect(sdJwt.endsWith("~")).toBe(true);
+
+		const [jws = "", ...rest] = sdJwt.split("~");
+		const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+		const { payload } = await jose.compactVerify(jws, jwks);
+		const claims = JSON.parse(new TextDecoder().decode(payload)) as Record<string, unknown>;
+		return { claims, disclosures: rest.filter((disclosure) => disclosure !== "") };
+	}
+
+	it("should send the configured claims as disclosures the payload digests", async () => {
+		const created = await createSession({ mischief: [], sdJwt: { claims: ["client_id"] } });
+		const { sessionId } = await created.json();
+
+		const { claims, disclosures } = await issue(sessionId);
+		expect(disclosures).toHaveLength(1);
+		expect(decodeDisclosure(disclosures[0] ?? "")).toMatchObject({
+			name: "client_id",
+			value: "test-client",
+		});
+		expect(claims).not.toHaveProperty("client_id");
+		expect(claims._sd).toEqual([disclosureDigest(disclosures[0] ?? "")]);
+		expect(claims._sd_alg).toBe("sha-256");
+		expect(claims.iss).toBe(ISSUER);
+	});
+
+	it("should send a disclosure _sd doesn't list with disclosure-tampering", async () => {
+		const created = await createSession({
+			mischief: ["disclosure-tampering"],
+			sdJwt: { claims: ["client_id"], tokens: "access_token" },
+		});
+		const { sessionId } = await created.json();
+
+		const { claims, disclosures } = await issue(sessionId);
+		expect(decodeDisclosure(disclosures[0] ?? "")?.value).toBe("test-client.tampered");
+		expect(claims._sd).not.toContain(disclosureDigest(disclosures[0] ?? ""));
+	});
+
+	it("should reject an sdJwt that isn't a list of disclosable claims", async () => {
+		const cases = [
+			{ sdJwt: { claims: [] }, error: "sdJwt.claims must be a non-empty array of claim names" },
+			{ sdJwt: { claims: ["exp"] }, error: "sdJwt.claims can't include 'exp'" },
+			{ sdJwt: { claims: ["sub"], tokens: "refresh_token" }, error: "sdJwt.tokens must be one" },
+		];
+		for (const { sdJwt, error } of cases) {
+			const response = await createSession({ mischief: [], sdJwt });
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toContain(error);
+		}
+	});
+});
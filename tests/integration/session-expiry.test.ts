@@ -0,0 +1,98 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Session Expiry and Shutdown", () => {
+	let loki: Loki;
+	const PORT = 9899;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+			sessions: { ttl: "1h" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	function requestToken(sessionId: string): Promise<Response> {
+		return fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				"X-Loki-Session": sessionId,
+			},
+			body: "grant_type=client_credentials",
+		});
+	}
+
+	it("should answer 410 for a session past its ttl, at /token and the admin API", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [], ttl: "1s" });
+		expect((await requestToken(session.id)).status).toBe(200);
+
+		await new Promise((resolve) => setTimeout(resolve, 1100));
+
+		const token = await requestToken(session.id);
+		expect(token.status).toBe(410);
+		const body = await token.json();
+		expect(body.code).toBe("session_expired");
+		expect(body.details.evictedAt).toEqual(expect.any(String));
+		const admin = await fetch(`${ISSUER}/admin/sessions/${session.id}/events`);
+		expect(admin.status).toBe(410);
+		expect((await admin.json()).code).toBe("session_expired");
+		expect(loki.getSession(session.id)).toBeUndefined();
+
+		const metrics = await (await fetch(`${ISSUER}/metrics`)).text();
+		expect(metrics).toContain("loki_sessions_evicted_total 1");
+	});
+
+	it("should keep sessions younger than the default ttl", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: [] });
+
+		expect((await requestToken(session.id)).status).toBe(200);
+		expect(loki.getSession(session.id)).toBeDefined();
+	});
+
+	it("should reject a ttl that isn't a Go duration of at least 1s", async () => {
+		const response = await fetch(`${ISSUER}/admin/sessions`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify({ mischief: [], ttl: "500ms" }),
+		});
+
+		expect(response.status).toBe(400);
+		const { error } = await response.json();
+		expect(error).toBe('ttl must be a Go duration of at least 1s, e.g. "1h"');
+	});
+
+	it("should let a token request in flight finish when stopped", async () => {
+		const session = loki.createSession({
+			mode: "explicit",
+			mischief: ["latency-injection"],
+			pluginConfig: { "latency-injection": { delayMs: 300 } },
+		});
+
+		const slow = requestToken(session.id);
+		await new Promise((resolve) => setTimeout(resolve, 100));
+		const stopped = loki.stop();
+
+		expect((await slow).status).toBe(200);
+		await stopped;
+		expect(loki.isRunning).toBe(false);
+	});
+});
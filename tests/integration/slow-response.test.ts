@@ -0,0 +1,103 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Slow Token Responses", () => {
+	let loki: Loki;
+	const PORT = 9903;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost", shutdownTimeoutMs: 5000 },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	async function createSession(spec: Record<string, unknown>): Promise<Response> {
+		return fetch(`${ISSUER}/admin/sessions`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify(spec),
+		});
+	}
+
+	function requestToken(sessionId: string, signal?: AbortSignal): Promise<Response> {
+		return fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				"X-Loki-Session": sessionId,
+			},
+			body: "grant_type=client_credentials",
+			...(signal ? { signal } : {}),
+		});
+	}
+
+	it("should hold the token response for the session's tokenDelay", async () => {
+		const created = await createSession({ mischief: ["slow-response"], tokenDelay: "400ms" });
+		const { sessionId } = await created.json();
+
+		const startedAt = Date.now();
+		const response = await requestToken(sessionId);
+		expect(response.status).toBe(200);
+		expect((await response.json()).access_token).toBeDefined();
+		expect(Date.now() - startedAt).toBeGreaterThanOrEqual(400);
+	});
+
+	it("should reject a tokenDelay that isn't a positive Go duration", async () => {
+		for (const tokenDelay of ["400", "-1s", 30]) {
+			const response = await createSession({ mischief: ["slow-response"], tokenDelay });
+			expect(response.status).toBe(400);
+			expect((await response.json()).error).toContain("tokenDelay must be a positive Go duration");
+		}
+	});
+
+	it("should never answer a hanging token request", async () => {
+		const session = loki.createSession({
+			mode: "explicit",
+			mischief: ["slow-response"],
+			pluginConfig: { "slow-response": { hang: true } },
+		});
+
+		await expect(requestToken(session.id, AbortSignal.timeout(500))).rejects.toThrow();
+	});
+
+	it("should stop promptly with delayed and hanging requests in flight", async () => {
+		const delayed = loki.createSession({
+			mode: "explicit",
+			mischief: ["slow-response"],
+			pluginConfig: { "slow-response": { delay: "1h" } },
+		});
+		const hanging = loki.createSession({
+			mode: "explicit",
+			mischief: ["slow-response"],
+			pluginConfig: { "slow-response": { hang: true } },
+		});
+
+		const slow = requestToken(delayed.id);
+		const hung = requestToken(hanging.id);
+		await new Promise((resolve) => setTimeout(resolve, 300));
+
+		const startedAt = Date.now();
+		await loki.stop();
+		expect(Date.now() - startedAt).toBeLessThan(2000);
+		expect((await slow).status).toBe(200);
+		await expect(hung).rejects.toThrow();
+	});
+});
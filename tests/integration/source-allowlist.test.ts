@@ -0,0 +1,79 @@
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Source Allowlist", () => {
+	const PORT = 9912;
+	const UNPROXIED_PORT = 9913;
+	const ISSUER = `http://127.0.0.1:${PORT}`;
+	const UNPROXIED_ISSUER = `http://127.0.0.1:${UNPROXIED_PORT}`;
+	let loki: Loki;
+	let unproxied: Loki;
+
+	function create(port: number, issuer: string, trustedProxies: string[]): Loki {
+		return new Loki({
+			server: {
+				port,
+				host: "127.0.0.1",
+				trustedProxies,
+				allowedSources: ["10.0.0.0/8", "2001:db8::/32"],
+			},
+			provider: {
+				issuer,
+				clients: [{ client_id: "test-client", client_secret: "test-secret" }],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+	}
+
+	beforeAll(async () => {
+		loki = create(PORT, ISSUER, ["127.0.0.1"]);
+		unproxied = create(UNPROXIED_PORT, UNPROXIED_ISSUER, []);
+		await Promise.all([loki.start(), unproxied.start()]);
+	});
+
+	afterAll(async () => {
+		await Promise.all([loki.stop(), unproxied.stop()]);
+	});
+
+	it("should serve sources in an allowed network", async () => {
+		for (const forwardedFor of ["10.1.2.3", "2001:db8::7", "203.0.113.9, 10.20.30.40"]) {
+			const response = await fetch(`${ISSUER}/.well-known/openid-configuration`, {
+				headers: { "X-Forwarded-For": forwardedFor },
+			});
+
+			expect(response.status).toBe(200);
+			expect((await response.json()).issuer).toBe(ISSUER);
+		}
+	});
+
+	it("should answer 403 to every other source, probes and the admin API included", async () => {
+		const cases = [
+			{ path: "/jwks", forwardedFor: "192.0.2.1", sourceAddress: "192.0.2.1" },
+			{ path: "/healthz", forwardedFor: "10.1.2.3, 192.0.2.1", sourceAddress: "192.0.2.1" },
+			{ path: "/admin/sessions", forwardedFor: undefined, sourceAddress: "127.0.0.1" },
+		];
+		for (const { path, forwardedFor, sourceAddress } of cases) {
+			const headers: Record<string, string> = {};
+			if (forwardedFor) {
+				headers["X-Forwarded-For"] = forwardedFor;
+			}
+			const response = await fetch(`${ISSUER}${path}`, { headers });
+
+			expect(response.status).toBe(403);
+			expect(await response.json()).toMatchObject({
+				error: "access_denied",
+				code: "source_not_allowed",
+				details: { sourceAddress },
+			});
+		}
+	});
+
+	it("should ignore X-Forwarded-For unless the peer is a trusted proxy", async () => {
+		const response = await fetch(`${UNPROXIED_ISSUER}/jwks`, {
+			headers: { "X-Forwarded-For": "10.1.2.3" },
+		});
+
+		expect(response.status).toBe(403);
+		expect((await response.json()).details).toEqual({ sourceAddress: "127.0.0.1" });
+	});
+});
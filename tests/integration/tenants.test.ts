@@ -0,0 +1,131 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Tenants", () => {
+	let loki: Loki;
+	const PORT = 9901;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+				tenants: ["acme"],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+
+		const registered = await fetch(`${ISSUER}/admin/tenants`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify({ id: "globex" }),
+		});
+		expect(registered.status).toBe(201);
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	async function tenantJwks(tenant: string) {
+		return jose.createLocalJWKSet(await (await fetch(`${ISSUER}/${tenant}/jwks`)).json());
+	}
+
+	async function requestToken(path: string, sessionId?: string): Promise<string> {
+		const headers: Record<string, string> = {
+			"Content-Type": "application/x-www-form-urlencoded",
+			Authorization: `Basic ${btoa("test-client:test-secret")}`,
+		};
+		if (sessionId) {
+			headers["X-Loki-Session"] = sessionId;
+		}
+		const response = await fetch(`${ISSUER}${path}`, {
+			method: "POST",
+			headers,
+			body: "grant_type=client_credentials",
+		});
+		expect(response.status).toBe(200);
+		return ((await response.json()) as { access_token: string }).access_token;
+	}
+
+	it("should name the tenant's issuer in its discovery document", async () => {
+		const response = await fetch(`${ISSUER}/acme/.well-known/openid-configuration`);
+		const discovery = await response.json();
+
+		expect(discovery.issuer).toBe(`${ISSUER}/acme`);
+		expect(discovery.token_endpoint).toBe(`${ISSUER}/acme/token`);
+		expect(discovery.jwks_uri).toBe(`${ISSUER}/acme/jwks`);
+
+		const plain = await (await fetch(`${ISSUER}/.well-known/openid-configuration`)).json();
+		expect(plain.issuer).toBe(ISSUER);
+	});
+
+	it("should sign a tenant's tokens with a key only its JWKS publishes", async () => {
+		const token = await requestToken("/globex/token");
+
+		const { payload } = await jose.jwtVerify(token, await tenantJwks("globex"), {
+			issuer: `${ISSUER}/globex`,
+		});
+		expect(payload.iss).toBe(`${ISSUER}/globex`);
+		await expect(jose.jwtVerify(token, await tenantJwks("acme"))).rejects.toThrow();
+		const plain = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+		await expect(jose.jwtVerify(token, plain)).rejects.toThrow();
+		expect(jose.decodeJwt(await requestToken("/token")).iss).toBe(ISSUER);
+	});
+
+	it("should answer a tenant's token request with another tenant's token", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["cross-tenant-token"] });
+		const token = await requestToken("/acme/token", session.id);
+
+		await expect(
+			jose.jwtVerify(token, await tenantJwks("globex"), { issuer: `${ISSUER}/globex` }),
+		).resolves.toBeDefined();
+		const [entry] = session.getLedger().entries;
+		expect(entry?.evidence).toMatchObject({ requestedTenant: "acme", tenant: "globex" });
+	});
+
+	it("should claim another tenant's issuer with the requesting tenant's key", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["cross-tenant-iss"] });
+		const token = await requestToken("/acme/token", session.id);
+
+		expect(jose.decodeJwt(token).iss).toBe(`${ISSUER}/globex`);
+		await expect(jose.jwtVerify(token, await tenantJwks("acme"))).resolves.toBeDefined();
+		await expect(jose.jwtVerify(token, await tenantJwks("globex"))).rejects.toThrow();
+		const [entry] = session.getLedger().entries;
+		expect(entry?.evidence).toMatchObject({
+			requestedTenant: "acme",
+			claimedIssuer: `${ISSUER}/globex`,
+			signingKeyTenant: "acme",
+		});
+	});
+
+	it("should list, refuse and remove tenants over the admin API", async () => {
+		const { tenants } = await (await fetch(`${ISSUER}/admin/tenants`)).json();
+		expect(tenants.map((tenant: { id: string }) => tenant.id)).toEqual(["acme", "globex"]);
+		const [acme] = (await (await fetch(`${ISSUER}/acme/jwks`)).json()).keys;
+		expect(tenants[0].kid).toBe(acme.kid);
+
+		const reserved = await fetch(`${ISSUER}/admin/tenants`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify({ id: "token" }),
+		});
+		expect(reserved.status).toBe(400);
+		expect((await reserved.json()).code).toBe("invalid_tenant");
+
+		const removed = await fetch(`${ISSUER}/admin/tenants/globex`, { method: "DELETE" });
+		expect(await removed.json()).toEqual({ deleted: true });
+		expect((await fetch(`${ISSUER}/globex/jwks`)).status).toBe(404);
+		expect((await fetch(`${ISSUER}/admin/tenants/globex`)).status).toBe(404);
+	});
+});
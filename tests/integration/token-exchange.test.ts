@@ -0,0 +1,144 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { ACCESS_TOKEN_TYPE, TOKEN_EXCHANGE_GRANT } from "../../src/core/token-exchange.js";
+import { Loki } from "../../src/index.js";
+
+describe("Token Exchange", () => {
+	let loki: Loki;
+	const PORT = 9907;
+	const ISSUER = `http://localhost:${PORT}`;
+	const delegating = ["client_credentials", TOKEN_EXCHANGE_GRANT];
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{ client_id: "user-app", client_secret: "secret", grant_types: ["client_credentials"] },
+					{ client_id: "orders-service", client_secret: "secret", grant_types: delegating },
+					{ client_id: "billing-service", client_secret: "secret", grant_types: delegating },
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	async function subjectToken(): Promise<string> {
+		const response = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("user-app:secret")}`,
+			},
+			body: "grant_type=client_credentials",
+		});
+		return ((await response.json()) as { access_token: string }).access_token;
+	}
+
+	function exchange(
+		clientId: string,
+		params: Record<string, string>,
+		sessionId?: string,
+	): Promise<Response> {
+		const headers: Record<string, string> = {
+			"Content-Type": "application/x-www-form-urlencoded",
+			Authorization: `Basic ${btoa(`${clientId}:secret`)}`,
+		};
+		if (sessionId !== undefined) {
+			headers["X-Loki-Session"] = sessionId;
+		}
+		const body = new URLSearchParams({ grant_type: TOKEN_EXCHANGE_GRANT, ...params });
+		return fetch(`${ISSUER}/token`, { method: "POST", headers, body: body.toString() });
+	}
+
+	async function exchanged(response: Response): Promise<Record<string, unknown>> {
+		expect(response.status).toBe(200);
+		const body = await response.json();
+		expect(body.issued_token_type).toBe(ACCESS_TOKEN_TYPE);
+		expect(body.token_type).toBe("Bearer");
+		const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+		const { payload } = await jose.jwtVerify(body.access_token, jwks);
+		return payload;
+	}
+
+	it("should issue a token for the subject, acted for by the client", async () => {
+		const subject = await subjectToken();
+		const claims = await exchanged(
+			await exchange("orders-service", {
+				subject_token: subject,
+				subject_token_type: ACCESS_TOKEN_TYPE,
+				audience: "https://billing.example/api",
+			}),
+		);
+
+		expect(claims.sub).toBe(jose.decodeJwt(subject).sub);
+		expect(claims.aud).toBe("https://billing.example/api");
+		expect(claims.iss).toBe(ISSUER);
+		expect(claims.act).toEqual({ sub: "orders-service" });
+	});
+
+	it("should nest the actor chain when an exchanged token is exchanged again", async () => {
+		const first = await exchange("orders-service", {
+			subject_token: await subjectToken(),
+			subject_token_type: ACCESS_TOKEN_TYPE,
+		});
+		const { access_token: delegated } = await first.json();
+		const claims = await exchanged(
+			await exchange("billing-service", {
+				subject_token: delegated,
+				subject_token_type: ACCESS_TOKEN_TYPE,
+			}),
+		);
+
+		expect(claims.act).toEqual({ sub: "billing-service", act: { sub: "orders-service" } });
+	});
+
+	it("should report the actor chain delegation-escalation dropped", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["delegation-escalation"] });
+		const params = { subject_token: await subjectToken(), subject_token_type: ACCESS_TOKEN_TYPE };
+		const claims = await exchanged(await exchange("orders-service", params, session.id));
+		expect(claims).not.toHaveProperty("act");
+
+		const report = await (await fetch(`${ISSUER}/admin/sessions/${session.id}/report`)).json();
+		expect(report.issuances[0]).toMatchObject({
+			mischief: ["delegation-escalation"],
+			actors: { expected: ["orders-service"], actual: [] },
+		});
+	});
+
+	it("should refuse forged subject tokens and clients not registered for it", async () => {
+		const subject = await subjectToken();
+		const [header, payload] = subject.split(".");
+		const forged = `${header}.${payload}.${"A".repeat(43)}`;
+
+		const refused = await exchange("orders-service", {
+			subject_token: forged,
+			subject_token_type: ACCESS_TOKEN_TYPE,
+		});
+		expect(refused.status).toBe(400);
+		expect(await refused.json()).toMatchObject({
+			error: "invalid_grant",
+			code: "subject_token_invalid",
+		});
+
+		const unregistered = await exchange("user-app", {
+			subject_token: subject,
+			subject_token_type: ACCESS_TOKEN_TYPE,
+		});
+		expect(unregistered.status).toBe(400);
+		expect(await unregistered.json()).toMatchObject({
+			error: "unauthorized_client",
+			code: "grant_not_registered",
+		});
+
+		const missing = await exchange("orders-service", { subject_token_type: ACCESS_TOKEN_TYPE });
+		expect(missing.status).toBe(400);
+		expect((await missing.json()).code).toBe("invalid_token_exchange");
+	});
+});
@@ -0,0 +1,135 @@
+import * as jose from "jose";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { tokenHash } from "../../src/core/token-forge.js";
+import { Loki } from "../../src/index.js";
+import { REDIRECT_URI, VERIFIER, authorizationCode, signInWithCode } from "./helpers/auth-code.js";
+
+describe("ID Token Hashes", () => {
+	let loki: Loki;
+	const PORT = 9895;
+	const ISSUER = `http://localhost:${PORT}`;
+
+	interface TokenResponse {
+		access_token: string;
+		id_token: string;
+	}
+
+	beforeAll(async () => {
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "spa-client",
+						token_endpoint_auth_method: "none",
+						redirect_uris: [REDIRECT_URI],
+						grant_types: ["authorization_code"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+	});
+
+	function signIn(sessionId: string): Promise<TokenResponse> {
+		return signInWithCode({ issuer: ISSUER, sessionId });
+	}
+
+	it("should give the ID token an at_hash matching the access token sent", async () => {
+		await loki.keys.startKeySet({ count: 2, alg: "ES384" });
+		try {
+			const session = loki.createSession({ mode: "explicit", mischief: [] });
+			const issued = await signIn(session.id);
+			const { alg } = jose.decodeProtectedHeader(issued.id_token);
+
+			expect(alg).toBe("ES384");
+			expect(jose.decodeJwt(issued.id_token).at_hash).toBe(tokenHash(issued.access_token, "ES384"));
+			// Binding at_hash re-signs the ID token with its own key, not the set's next one
+			const accessKid = jose.decodeProtectedHeader(issued.access_token).kid;
+			expect(jose.decodeProtectedHeader(issued.id_token).kid).not.toBe(accessKid);
+			const signings = loki.keys.getKeySetStatus()?.signings ?? [];
+			expect(signings.map((s) => s.tokenType).sort()).toEqual(["access_token", "id_token"]);
+		} finally {
+			loki.keys.clearKeySet();
+		}
+	});
+
+	it("should send a validly signed ID token with a tampered at_hash", async () => {
+		const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+		const session = loki.createSession({ mode: "explicit", mischief: ["hash-tampering"] });
+		const issued = await signIn(session.id);
+
+		const { payload, protectedHeader } = await jose.jwtVerify(issued.id_token, jwks);
+		expect(payload.at_hash).toEqual(expect.any(String));
+		expect(payload.at_hash).not.toBe(tokenHash(issued.access_token, protectedHeader.alg));
+	});
+
+	it("should send a valid access token beside an unsigned ID token bound to it", async () => {
+		const jwks = jose.createLocalJWKSet(await (await fetch(`${ISSUER}/jwks`)).json());
+		const session = loki.createSession({ mode: "explicit", mischief: ["split-validity"] });
+		const issued = await signIn(session.id);
+
+		const { protectedHeader } = await jose.jwtVerify(issued.access_token, jwks);
+		expect(jose.decodeProtectedHeader(issued.id_token).alg).toBe("none");
+		expect(issued.id_token.endsWith(".")).toBe(true);
+		expect(jose.decodeJwt(issued.id_token).at_hash).toBe(
+			tokenHash(issued.access_token, protectedHeader.alg),
+		);
+	});
+
+	it("should issue tokens when alg-none ran before split-validity", async () => {
+		const session = loki.createSession({
+			mode: "explicit",
+			mischief: ["alg-none", "split-validity"],
+		});
+		const response = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				"X-Loki-Session": session.id,
+			},
+			body: new URLSearchParams({
+				grant_type: "authorization_code",
+				code: await authorizationCode({ issuer: ISSUER, sessionId: session.id }),
+				redirect_uri: REDIRECT_URI,
+				client_id: "spa-client",
+				code_verifier: VERIFIER,
+			}).toString(),
+		});
+
+		expect(response.status).toBe(200);
+		const issued = (await response.json()) as TokenResponse;
+		expect(jose.decodeProtectedHeader(issued.id_token).alg).toBe("none");
+		const ledger = session.getLedger();
+		expect(ledger.entries.map((e) => e.plugin.id)).toContain("split-validity");
+	});
+
+	it("should apply mischief only to the token a session targets", async () => {
+		const issuers = async (target: "access_token" | "id_token") => {
+			const session = loki.createSession({
+				mode: "explicit",
+				mischief: ["iss-mismatch"],
+				targets: { "iss-mismatch": target },
+			});
+			const issued = await signIn(session.id);
+			return {
+				accessToken: jose.decodeJwt(issued.access_token).iss,
+				idToken: jose.decodeJwt(issued.id_token).iss,
+			};
+		};
+
+		const idTokenOnly = await issuers("id_token");
+		expect(idTokenOnly.accessToken).toBe(ISSUER);
+		expect(idTokenOnly.idToken).not.toBe(ISSUER);
+
+		const accessTokenOnly = await issuers("access_token");
+		expect(accessTokenOnly.accessToken).not.toBe(ISSUER);
+		expect(accessTokenOnly.idToken).toBe(ISSUER);
+	});
+});
@@ -0,0 +1,114 @@
+import { type Server, createServer } from "node:http";
+import { afterAll, beforeAll, describe, expect, it } from "vitest";
+import { Loki } from "../../src/index.js";
+
+describe("Webhooks", () => {
+	let loki: Loki;
+	let receiver: Server;
+	const PORT = 9896;
+	const RECEIVER_PORT = 9897;
+	const ISSUER = `http://localhost:${PORT}`;
+	const HOOK = `http://localhost:${RECEIVER_PORT}/hook`;
+	const received: { path: string; body: Record<string, unknown> }[] = [];
+
+	beforeAll(async () => {
+		receiver = createServer((req, res) => {
+			const chunks: Buffer[] = [];
+			req.on("data", (chunk: Buffer) => chunks.push(chunk));
+			req.on("end", () => {
+				const body = JSON.parse(Buffer.concat(chunks).toString()) as Record<string, unknown>;
+				received.push({ path: req.url ?? "", body });
+				res.writeHead(req.url === "/down" ? 503 : 204).end();
+			});
+		});
+		await new Promise<void>((resolve) => receiver.listen(RECEIVER_PORT, "localhost", resolve));
+
+		loki = new Loki({
+			server: { port: PORT, host: "localhost" },
+			provider: {
+				issuer: ISSUER,
+				clients: [
+					{
+						client_id: "test-client",
+						client_secret: "test-secret",
+						grant_types: ["client_credentials"],
+					},
+				],
+			},
+			persistence: { enabled: false, path: "" },
+			webhook: { url: HOOK, maxAttempts: 2 },
+		});
+		await loki.start();
+	});
+
+	afterAll(async () => {
+		await loki.stop();
+		await new Promise((resolve) => receiver.close(resolve));
+	});
+
+	async function requestToken(sessionId: string): Promise<void> {
+		const response = await fetch(`${ISSUER}/token`, {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded",
+				Authorization: `Basic ${btoa("test-client:test-secret")}`,
+				"X-Loki-Session": sessionId,
+			},
+			body: "grant_type=client_credentials",
+		});
+		expect(response.ok).toBe(true);
+	}
+
+	async function deliveries(sessionId: string, count: number) {
+		await expect
+			.poll(() => loki.getSessionEvents(sessionId).filter((e) => e.type === "webhook-delivered"))
+			.toHaveLength(count);
+		return loki.getSessionEvents(sessionId).filter((e) => e.type === "webhook-delivered");
+	}
+
+	it("should POST each issuance to the global webhook", async () => {
+		const session = loki.createSession({ mode: "explicit", mischief: ["alg-none"] });
+		await requestToken(session.id);
+
+		const [delivery] = await deliveries(session.id, 1);
+		expect(delivery?.data).toMatchObject({ url: HOOK, delivered: true, attempts: 1 });
+
+		const event = received.find((r) => r.body.sessionId === session.id);
+		expect(event?.path).toBe("/hook");
+		expect(event?.body).toMatchObject({
+			event: "token.issued",
+			tokenType: "access_token",
+			mischief: ["alg-none"],
+			fingerprint: { sha256: expect.any(String), signingKey: null },
+		});
+	});
+
+	it("should prefer a session's own webhook and give up on one that stays down", async () => {
+		const created = await fetch(`${ISSUER}/admin/sessions`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify({
+				mischief: [],
+				webhook: `http://localhost:${RECEIVER_PORT}/down`,
+			}),
+		});
+		const { sessionId } = (await created.json()) as { sessionId: string };
+		await requestToken(sessionId);
+
+		const [delivery] = await deliveries(sessionId, 1);
+		expect(delivery?.data).toMatchObject({ delivered: false, attempts: 2, status: 503 });
+		const sent = received.filter((r) => r.body.sessionId === sessionId);
+		expect(sent.map((r) => r.path)).toEqual(["/down", "/down"]);
+	});
+
+	it("should reject a session webhook that isn't an http(s) URL", async () => {
+		const response = await fetch(`${ISSUER}/admin/sessions`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify({ mischief: [], webhook: "file:///tmp/hook" }),
+		});
+
+		expect(response.status).toBe(400);
+		expect((await response.json()).error).toBe("webhook must be an absolute http(s) URL");
+	});
+});
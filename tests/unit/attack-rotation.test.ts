@@ -0,0 +1,57 @@
+import { describe, expect, it } from "vitest";
+import { AttackRotation, validateAttackRotation } from "../../src/core/attack-rotation.js";
+
+const CATALOG = ["alg-none", "kid-manipulation", "iss-confusion"];
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+describe("Attack Rotation", () => {
+	it("should pick the daily attack by UTC day number", () => {
+		let now = 10 * DAY_MS + 5000;
+		const rotation = new AttackRotation({}, CATALOG, () => now);
+
+		expect(rotation.advance()).toMatchObject({ plugin: "kid-manipulation", rotated: { index: 1 } });
+		expect(rotation.advance()).toEqual({ plugin: "kid-manipulation" });
+		expect(rotation.getStatus().nextRotationAt).toBe(new Date(11 * DAY_MS).toISOString());
+
+		now = 11 * DAY_MS;
+		expect(rotation.advance().plugin).toBe("iss-confusion");
+		now = 12 * DAY_MS;
+		expect(rotation.advance().plugin).toBe("alg-none");
+		expect(rotation.getStatus().history.map((entry) => entry.index)).toEqual([1, 2, 0]);
+	});
+
+	it("should rotate after every N token requests in the configured order", () => {
+		const rotation = new AttackRotation(
+			{ order: ["iss-confusion", "alg-none"], everyRequests: 2 },
+			CATALOG,
+		);
+		const served: string[] = [];
+		for (let i = 0; i < 5; i++) {
+			served.push(rotation.advance().plugin);
+			rotation.countTokenRequest();
+		}
+
+		expect(served).toEqual([
+			"iss-confusion",
+			"iss-confusion",
+			"alg-none",
+			"alg-none",
+			"iss-confusion",
+		]);
+		const status = rotation.getStatus();
+		expect(status).toMatchObject({ cadence: "requests", everyRequests: 2, requestsUntilNext: 1 });
+		expect(status.history).toHaveLength(3);
+	});
+
+	it("should reject configs it can't rotate through", () => {
+		const cases: [Parameters<typeof validateAttackRotation>[0], string][] = [
+			[{ order: [] }, "order must list at least one plugin"],
+			[{ order: ["alg-none", "nope"] }, "order names unknown plugin 'nope'"],
+			[{ everyRequests: 0 }, "everyRequests must be a positive integer, got 0"],
+		];
+		for (const [config, error] of cases) {
+			expect(() => validateAttackRotation(config, CATALOG)).toThrow(error);
+		}
+		expect(() => validateAttackRotation({}, [])).toThrow("no plugins are loaded");
+	});
+});
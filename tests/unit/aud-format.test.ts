@@ -0,0 +1,23 @@
+import { describe, expect, it } from "vitest";
+import { audFormatOf, formatAudience } from "../../src/core/aud-format.js";
+
+describe("Audience Format", () => {
+	it("should tell a string aud from an array of strings", () => {
+		expect(audFormatOf("client-app")).toBe("string");
+		expect(audFormatOf(["client-app", "api"])).toBe("array");
+		expect(audFormatOf([1])).toBeUndefined();
+		expect(audFormatOf(undefined)).toBeUndefined();
+	});
+
+	it("should convert a single audience between forms", () => {
+		expect(formatAudience("client-app", "array")).toEqual(["client-app"]);
+		expect(formatAudience(["client-app"], "string")).toBe("client-app");
+	});
+
+	it("should leave an aud already in the form, or with several audiences, alone", () => {
+		expect(formatAudience("client-app", "string")).toBeUndefined();
+		expect(formatAudience(["client-app"], "array")).toBeUndefined();
+		expect(formatAudience(["client-app", "api"], "string")).toBeUndefined();
+		expect(formatAudience(undefined, "array")).toBeUndefined();
+	});
+});
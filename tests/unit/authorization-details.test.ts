@@ -0,0 +1,58 @@
+import { describe, expect, it } from "vitest";
+import {
+	AuthorizationDetailsStore,
+	parseAuthorizationDetails,
+} from "../../src/core/authorization-details.js";
+import { requestClientId } from "../../src/core/http-utils.js";
+
+describe("Authorization Details", () => {
+	describe("parseAuthorizationDetails", () => {
+		it("should accept details of any type with well-formed common fields", () => {
+			const details = [
+				{ type: "payment_initiation", instructedAmount: { currency: "EUR", amount: "123.50" } },
+				{ type: "account_information", actions: ["list_accounts"], identifier: "acc-1" },
+			];
+
+			expect(parseAuthorizationDetails(JSON.stringify(details))).toEqual({ ok: true, details });
+		});
+
+		it("should reject malformed details", () => {
+			const cases: [string, string][] = [
+				["not json", "authorization_details must be valid JSON"],
+				["[]", "authorization_details must be a non-empty JSON array"],
+				['{"type":"x"}', "authorization_details must be a non-empty JSON array"],
+				['["x"]', "authorization_details[0] must be an object"],
+				['[{"actions":[]}]', "authorization_details[0].type must be a string"],
+				[
+					'[{"type":"x","actions":"read"}]',
+					"authorization_details[0].actions must be an array of strings",
+				],
+				['[{"type":"x","identifier":7}]', "authorization_details[0].identifier must be a string"],
+			];
+			for (const [value, error] of cases) {
+				expect(parseAuthorizationDetails(value)).toEqual({ ok: false, error });
+			}
+		});
+	});
+
+	it("should grant each client its latest request within a session", () => {
+		const store = new AuthorizationDetailsStore();
+		store.request("sess_a", "web", [{ type: "first" }]);
+		store.request("sess_a", "web", [{ type: "second" }]);
+
+		expect(store.granted("sess_a", "web")).toEqual([{ type: "second" }]);
+		expect(store.granted("sess_a", "other")).toBeUndefined();
+		expect(store.granted("sess_b", "web")).toBeUndefined();
+
+		store.clear("sess_a");
+		expect(store.granted("sess_a", "web")).toBeUndefined();
+	});
+
+	it("should identify the client from Basic credentials or client_id", () => {
+		const basic = `Basic ${Buffer.from("web%3Aclient:secret").toString("base64")}`;
+
+		expect(requestClientId(basic, { client_id: "ignored" })).toBe("web:client");
+		expect(requestClientId(undefined, { client_id: "public" })).toBe("public");
+		expect(requestClientId(undefined, {})).toBeUndefined();
+	});
+});
@@ -0,0 +1,57 @@
+import { describe, expect, it } from "vitest";
+import { ChaosMode, validateChaosConfig } from "../../src/core/chaos-mode.js";
+import { seedRandom } from "../../src/core/random.js";
+
+const CATALOG = ["alg-none", "kid-manipulation", "iss-confusion"];
+
+describe("Chaos Mode", () => {
+	it("should draw a mischief for every request at rate 1 and none at rate 0", () => {
+		const always = new ChaosMode({ rate: 1, allowlist: ["alg-none"] }, CATALOG);
+		const never = new ChaosMode({ rate: 0 }, CATALOG);
+		for (let i = 0; i < 5; i++) {
+			expect(always.draw()).toBe("alg-none");
+			expect(never.draw()).toBeUndefined();
+		}
+
+		expect(always.getStatus()).toEqual({
+			sessionId: "chaos",
+			rate: 1,
+			pool: ["alg-none"],
+			tokenRequests: 5,
+			applied: { "alg-none": 5 },
+		});
+		expect(never.getStatus()).toMatchObject({ pool: CATALOG, tokenRequests: 5, applied: {} });
+	});
+
+	it("should hit roughly the configured share of requests, reproducibly under a seed", () => {
+		const run = () => {
+			const unseed = seedRandom("chaos");
+			try {
+				const chaos = new ChaosMode({ rate: 0.25 }, CATALOG);
+				return Array.from({ length: 400 }, () => chaos.draw());
+			} finally {
+				unseed();
+			}
+		};
+		const first = run();
+		const hits = first.filter((plugin) => plugin !== undefined);
+
+		expect(hits.length).toBeGreaterThan(60);
+		expect(hits.length).toBeLessThan(140);
+		expect(new Set(hits)).toEqual(new Set(CATALOG));
+		expect(run()).toEqual(first);
+	});
+
+	it("should reject configs it can't draw from", () => {
+		const cases: [Parameters<typeof validateChaosConfig>[0], string][] = [
+			[{ rate: 1.5 }, "rate must be a number from 0 to 1, got 1.5"],
+			[{ rate: Number.NaN }, "rate must be a number from 0 to 1, got NaN"],
+			[{ rate: 0.1, allowlist: [] }, "allowlist must name at least one plugin"],
+			[{ rate: 0.1, allowlist: ["nope"] }, "allowlist names 'nope', which isn't a loaded"],
+		];
+		for (const [config, error] of cases) {
+			expect(() => validateChaosConfig(config, CATALOG)).toThrow(error);
+		}
+		expect(() => validateChaosConfig({ rate: 0.1 }, [])).toThrow("no token plugins are loaded");
+	});
+});
@@ -0,0 +1,139 @@
+import * as jose from "jose";
+import { beforeAll, describe, expect, it } from "vitest";
+import { ClaimSourceStore } from "../../src/core/claim-sources.js";
+import { type ManagedKey, generateSigningKey } from "../../src/core/key-manager.js";
+import { claimSourceTamperingPlugin } from "../../src/plugins/built-in/claim-source-tampering.js";
+import type { MischiefContext } from "../../src/plugins/types.js";
+
+const ISSUER = "http://localhost:3000";
+
+describe("ClaimSourceStore", () => {
+	let key: ManagedKey;
+	let store: ClaimSourceStore;
+
+	beforeAll(async () => {
+		key = await generateSigningKey("RS256");
+		store = new ClaimSourceStore({ issuer: ISSUER, getSigningKey: () => key });
+	});
+
+	it("should sign valid aggregated claims", async () => {
+		const source = await store.createAggregated({ groups: ["users"] });
+
+		const { payload } = await jose.jwtVerify(source.JWT, key.publicKey);
+		expect(payload.groups).toEqual(["users"]);
+		expect(payload.iss).toBe(ISSUER);
+	});
+
+	it("should break the signature when claims are tampered", async () => {
+		const source = await store.createAggregated(
+			{ groups: ["users"] },
+			{ tamperedClaims: { groups: ["admin"] } },
+		);
+
+		expect(jose.decodeJwt(source.JWT).groups).toEqual(["admin"]);
+		await expect(jose.jwtVerify(source.JWT, key.publicKey)).rejects.toThrow();
+	});
+
+	it("should serve distributed claims to the right bearer token only", async () => {
+		const source = await store.registerDistributed("sess_1", { roles: ["viewer"] });
+		const id = source.endpoint.slice(`${ISSUER}/claims/`.length);
+
+		const missing = store.resolve(id, undefined);
+		expect(missing.status).toBe(401);
+		expect(JSON.parse(missing.body).code).toBe("invalid_access_token");
+		expect(store.resolve(id, "Bearer wrong").status).toBe(401);
+
+		const ok = store.resolve(id, `Bearer ${source.access_token}`);
+		expect(ok.status).toBe(200);
+		expect(ok.headers["Content-Type"]).toBe("application/jwt");
+		expect(jose.decodeJwt(ok.body).roles).toEqual(["viewer"]);
+	});
+
+	it("should drop a session's distributed sources on clear", async () => {
+		const source = await store.registerDistributed("sess_2", { roles: ["viewer"] });
+		const id = source.endpoint.slice(`${ISSUER}/claims/`.length);
+
+		store.clear("sess_2");
+		const gone = store.resolve(id, `Bearer ${source.access_token}`);
+		expect(gone.status).toBe(404);
+		expect(JSON.parse(gone.body).code).toBe("claim_source_not_found");
+	});
+});
+
+describe("claim-source-tampering", () => {
+	let store: ClaimSourceStore;
+
+	beforeAll(async () => {
+		const key = await generateSigningKey("RS256");
+		store = new ClaimSourceStore({ issuer: ISSUER, getSigningKey: () => key });
+	});
+
+	function createContext(config: Record<string, unknown> = {}): MischiefContext {
+		return {
+			token: {
+				header: { alg: "RS256", typ: "JWT" },
+				claims: { iss: ISSUER, sub: "user123", groups: ["users"] },
+				signature: "",
+				getPublicKey: async () => "",
+				sign: () => {},
+				claimSources: store.forSession("sess_test"),
+			},
+			config,
+			session: { id: "sess_test", mode: "explicit" },
+		};
+	}
+
+	it("should have correct metadata", () => {
+		expect(claimSourceTamperingPlugin.id).toBe("claim-source-tampering");
+		expect(claimSourceTamperingPlugin.severity).toBe("high");
+		expect(claimSourceTamperingPlugin.phase).toBe("token-claims");
+	});
+
+	it("should add tampered aggregated and distributed sources by default", async () => {
+		const ctx = createContext();
+		const result = await claimSourceTamperingPlugin.apply(ctx);
+
+		expect(result.applied).toBe(true);
+		expect(result.evidence.tamperedSources).toEqual(["src_aggregated", "src_distributed"]);
+		expect(ctx.token?.claims._claim_names).toEqual({
+			groups: "src_aggregated",
+			roles: "src_distributed",
+		});
+		expect(ctx.token?.claims.groups).toBeUndefined();
+
+		const sources = ctx.token?.claims._claim_sources as Record<string, Record<string, string>>;
+		expect(jose.decodeJwt(sources.src_aggregated?.JWT ?? "").groups).toEqual(["users", "admin"]);
+		expect(sources.src_distributed?.endpoint).toMatch(/\/claims\/cs_/);
+	});
+
+	it("should re-sign the token so only its sources are bad", async () => {
+		const ctx = createContext();
+		let resigned = 0;
+		if (ctx.token) {
+			ctx.token.resign = async () => {
+				resigned++;
+				expect(ctx.token?.claims._claim_sources).toBeDefined();
+			};
+		}
+		await claimSourceTamperingPlugin.apply(ctx);
+
+		expect(resigned).toBe(1);
+	});
+
+	it("should serve valid sources when tamper is false", async () => {
+		const ctx = createContext({ mode: "aggregated", tamper: false });
+		const result = await claimSourceTamperingPlugin.apply(ctx);
+
+		expect(result.applied).toBe(true);
+		expect(result.evidence.tamperedSources).toEqual([]);
+		expect(ctx.token?.claims._claim_names).toEqual({ groups: "src_aggregated" });
+	});
+
+	it("should skip when the host has no claim source support", async () => {
+		const ctx = createContext();
+		delete ctx.token?.claimSources;
+		const result = await claimSourceTamperingPlugin.apply(ctx);
+
+		expect(result.applied).toBe(false);
+	});
+});
@@ -0,0 +1,111 @@
+import * as jose from "jose";
+import { describe, expect, it } from "vitest";
+import {
+	ClientKeyStore,
+	JWT_BEARER_ASSERTION,
+	assertionClientId,
+	verifyClientAssertion,
+} from "../../src/core/client-assertion.js";
+
+const ISSUER = "https://loki.test";
+
+async function keyPair(kid: string) {
+	const { publicKey, privateKey } = await jose.generateKeyPair("ES256");
+	const jwk = { ...(await jose.exportJWK(publicKey)), kid, alg: "ES256" };
+	return { jwk, privateKey };
+}
+
+async function assertion(
+	privateKey: jose.KeyLike,
+	kid: string,
+	claims: { iss?: string; sub?: string; aud?: string; exp?: number } = {},
+): Promise<string> {
+	return new jose.SignJWT({ jti: "a-1" })
+		.setProtectedHeader({ alg: "ES256", kid })
+		.setIssuer(claims.iss ?? "service")
+		.setSubject(claims.sub ?? "service")
+		.setAudience(claims.aud ?? `${ISSUER}/token`)
+		.setExpirationTime(claims.exp ?? Math.floor(Date.now() / 1000) + 60)
+		.sign(privateKey);
+}
+
+describe("Client Assertion", () => {
+	it("should accept an assertion signed with a registered key", async () => {
+		const { jwk, privateKey } = await keyPair("ci-1");
+		const params = {
+			client_assertion_type: JWT_BEARER_ASSERTION,
+			client_assertion: await assertion(privateKey, "ci-1"),
+		};
+
+		const audiences = [ISSUER, `${ISSUER}/token`];
+		const check = await verifyClientAssertion(params, "service", [jwk], audiences);
+
+		expect(check).toEqual({ clientId: "service", kid: "ci-1", alg: "ES256" });
+		expect(assertionClientId(params.client_assertion)).toBe("service");
+	});
+
+	it("should tell why an assertion fails", async () => {
+		const { jwk, privateKey } = await keyPair("ci-1");
+		const other = await keyPair("ci-1");
+		const expired = Math.floor(Date.now() / 1000) - 60;
+		const elsewhere = "https://other.test";
+		const bearer = JWT_BEARER_ASSERTION;
+		const cases = [
+			[await assertion(privateKey, "ci-1", { exp: expired }), bearer, "expired"],
+			[await assertion(other.privateKey, "ci-1"), bearer, "wrong-key"],
+			[await assertion(privateKey, "ci-1", { sub: "admin" }), bearer, "invalid-claims"],
+			[await assertion(privateKey, "ci-1", { aud: elsewhere }), bearer, "invalid-claims"],
+			[await assertion(privateKey, "ci-1"), "urn:example:saml", "unsupported-type"],
+			["not-a-jwt", bearer, "malformed"],
+		] as const;
+		for (const [client_assertion, client_assertion_type, failure] of cases) {
+			const params = { client_assertion, client_assertion_type };
+			const check = await verifyClientAssertion(params, "service", [jwk], [ISSUER]);
+
+			expect(check.failure).toBe(failure);
+		}
+	});
+
+	it("should refuse assertions from a client without registered keys", async () => {
+		const { privateKey } = await keyPair("ci-1");
+		const params = {
+			client_assertion_type: JWT_BEARER_ASSERTION,
+			client_assertion: await assertion(privateKey, "ci-1"),
+		};
+
+		expect((await verifyClientAssertion(params, "service", [], [ISSUER])).failure).toBe("no-keys");
+	});
+
+	describe("ClientKeyStore", () => {
+		it("should register public keys, replacing earlier ones", async () => {
+			const store = new ClientKeyStore();
+			const first = await keyPair("ci-1");
+			const second = await keyPair("ci-2");
+
+			await store.register("service", { keys: [first.jwk] });
+			const status = await store.register("service", { keys: [second.jwk] });
+
+			expect(status.keys).toEqual([{ kid: "ci-2", kty: "EC", alg: "ES256" }]);
+			expect(store.keys("service")).toEqual([second.jwk]);
+			expect(store.remove("service")).toBe(true);
+			expect(store.keys("service")).toEqual([]);
+			expect(store.remove("service")).toBe(false);
+		});
+
+		it("should reject key sets that aren't usable public keys", async () => {
+			const store = new ClientKeyStore();
+			const { privateKey } = await jose.generateKeyPair("ES256", { extractable: true });
+			const cases = [
+				[{}, "non-empty keys array"],
+				[{ keys: [] }, "non-empty keys array"],
+				[{ keys: [await jose.exportJWK(privateKey)] }, "must be a public key"],
+				[{ keys: [{ kty: "oct", k: "c2VjcmV0" }] }, "must be a public key"],
+				[{ keys: [{ kty: "EC", crv: "P-256", x: "bad" }] }, "not a usable public key"],
+			] as const;
+			for (const [jwks, message] of cases) {
+				await expect(store.register("service", jwks)).rejects.toThrow(message);
+			}
+			expect(store.status("service")).toBeUndefined();
+		});
+	});
+});
@@ -0,0 +1,66 @@
+import { describe, expect, it } from "vitest";
+import {
+	checkClientAuth,
+	clientType,
+	presentedAuthMethod,
+	stripClientCredentials,
+	withClientSecret,
+} from "../../src/core/client-auth.js";
+
+const confidential = { client_id: "service", client_secret: "secret" };
+const publicClient = { client_id: "spa", token_endpoint_auth_method: "none" as const };
+
+describe("Client Auth", () => {
+	it("should derive the client type from the registration", () => {
+		expect(clientType(confidential)).toBe("confidential");
+		expect(clientType(publicClient)).toBe("public");
+		expect(clientType({ client_id: "bare" })).toBe("public");
+	});
+
+	it("should tell how a token request authenticates", () => {
+		const basic = { authorization: `Basic ${btoa("spa:guess")}` };
+
+		expect(presentedAuthMethod(basic, {})).toBe("client_secret_basic");
+		expect(presentedAuthMethod({}, { client_secret: "guess" })).toBe("client_secret_post");
+		expect(presentedAuthMethod({}, { client_assertion: "eyJ..." })).toBe("client_assertion");
+		expect(presentedAuthMethod({}, { client_id: "spa" })).toBe("none");
+	});
+
+	it("should flag combinations the token endpoint must refuse", () => {
+		const cases: [Parameters<typeof checkClientAuth>, string | undefined][] = [
+			[[confidential, "client_secret_basic", "client_credentials"], undefined],
+			[[confidential, "none", "authorization_code"], "confidential-unauthenticated"],
+			[[publicClient, "none", "authorization_code"], undefined],
+			[[publicClient, "client_secret_post", "authorization_code"], "public-client-secret"],
+			[[publicClient, "client_secret_basic", "client_credentials"], "public-client-secret"],
+			[[publicClient, "none", "client_credentials"], "public-client-credentials"],
+		];
+		for (const [args, violation] of cases) {
+			expect(checkClientAuth(...args).violation).toBe(violation);
+		}
+	});
+
+	it("should strip a public client's credentials from the request", () => {
+		const { headers, body } = stripClientCredentials(
+			{ authorization: "Basic abc", "content-type": "application/x-www-form-urlencoded" },
+			Buffer.from("grant_type=authorization_code&client_secret=guess"),
+			"spa",
+		);
+
+		expect(headers.authorization).toBeUndefined();
+		expect(body.toString()).toBe("grant_type=authorization_code&client_id=spa");
+		expect(headers["content-length"]).toBe(String(body.length));
+	});
+
+	it("should swap a client assertion for the client's secret", () => {
+		const { headers, body } = withClientSecret(
+			{ "content-type": "application/x-www-form-urlencoded" },
+			Buffer.from("grant_type=client_credentials&client_id=service&client_assertion=eyJ.a.b"),
+			{ client_id: "service", client_secret: "s3cret value" },
+		);
+
+		expect(headers.authorization).toBe(`Basic ${btoa("service:s3cret+value")}`);
+		expect(body.toString()).toBe("grant_type=client_credentials");
+		expect(headers["content-length"]).toBe(String(body.length));
+	});
+});
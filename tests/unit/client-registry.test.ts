@@ -0,0 +1,98 @@
+import * as jose from "jose";
+import { describe, expect, it } from "vitest";
+import { ClientRegistry, parseClientRegistration } from "../../src/core/client-registry.js";
+
+const configured = [{ client_id: "test-client", client_secret: "test-secret" }];
+
+async function publicJwk() {
+	const { publicKey } = await jose.generateKeyPair("ES256");
+	return { ...(await jose.exportJWK(publicKey)), kid: "ci-1", alg: "ES256" };
+}
+
+describe("Client Registry", () => {
+	it("should validate registration bodies", () => {
+		const cases = [
+			[null, "must be an object"],
+			[{ clientId: " " }, "clientId must be a non-empty string"],
+			[{ clientId: "svc", clientSecret: "" }, "clientSecret must be a non-empty string"],
+			[{ clientId: "svc", grantTypes: ["password"] }, "grantTypes must be among"],
+			[{ clientId: "svc", redirectUris: ["/callback"] }, "redirectUris must be an array"],
+			[{ clientId: "svc", mischief: "alg-none" }, "mischief must be an array"],
+			[{ clientId: "svc", grantTypes: ["client_credentials"] }, "cannot use client_credentials"],
+		] as const;
+		for (const [body, message] of cases) {
+			expect(parseClientRegistration(body)).toContain(message);
+		}
+
+		expect(parseClientRegistration({ clientId: "svc", mischief: ["alg-none"] })).toEqual({
+			clientId: "svc",
+			mischief: ["alg-none"],
+		});
+	});
+
+	it("should register, replace and delete clients", async () => {
+		const registry = new ClientRegistry(configured);
+
+		await registry.register({ clientId: "svc", clientSecret: "s", mischief: ["alg-none"] });
+		registry.setSession("svc", "sess_1");
+		expect(registry.registered("svc")).toEqual({ client_id: "svc", client_secret: "s" });
+		expect(registry.defaults("svc")).toEqual({ mischief: ["alg-none"], sessionId: "sess_1" });
+
+		const replaced = await registry.register({ clientId: "svc" });
+		expect(replaced).toEqual({ replacedSession: "sess_1" });
+		expect(registry.status("svc")).toMatchObject({
+			clientType: "public",
+			authMethod: "none",
+			source: "admin",
+			sessionId: null,
+		});
+		expect(registry.defaults("svc")).toBeUndefined();
+
+		expect(await registry.remove("svc")).toEqual({ removed: true });
+		expect(await registry.remove("svc")).toEqual({ removed: false });
+		expect(registry.get("svc")).toBeUndefined();
+	});
+
+	it("should give a key-only client private_key_jwt and a secret nobody is told", async () => {
+		const registry = new ClientRegistry(configured);
+
+		await registry.register({ clientId: "svc", jwks: { keys: [await publicJwk()] } });
+
+		expect(registry.get("svc")?.client_secret).toBeDefined();
+		expect(registry.status("svc")).toMatchObject({
+			clientType: "confidential",
+			authMethod: "private_key_jwt",
+			keys: [{ kid: "ci-1", kty: "EC", alg: "ES256" }],
+		});
+		await expect(registry.register({ clientId: "bad", jwks: {} })).rejects.toThrow("keys");
+		expect(registry.get("bad")).toBeUndefined();
+	});
+
+	it("should only let configured clients be given keys", async () => {
+		const registry = new ClientRegistry(configured);
+
+		await expect(registry.register({ clientId: "test-client" })).rejects.toThrow("configured");
+		await expect(registry.remove("test-client")).rejects.toThrow("configured");
+		await registry.registerKeys("test-client", { keys: [await publicJwk()] });
+
+		expect(registry.registered("test-client")).toBeUndefined();
+		expect(registry.status("test-client")?.source).toBe("config");
+		expect(registry.keys("test-client")).toHaveLength(1);
+	});
+
+	it("should apply concurrent changes one at a time", async () => {
+		const registry = new ClientRegistry([]);
+		const jwks = { keys: [await publicJwk()] };
+
+		const changes = Array.from({ length: 20 }, (_, i) =>
+			i % 2 === 0
+				? registry.register({ clientId: "svc", jwks })
+				: registry.register({ clientId: "svc", clientSecret: `s-${i}` }),
+		);
+		await Promise.all(changes);
+
+		expect(registry.list()).toHaveLength(1);
+		expect(registry.get("svc")?.client_secret).toBe("s-19");
+		expect(registry.status("svc")?.keys).toEqual([]);
+	});
+});
@@ -0,0 +1,41 @@
+import { describe, expect, it } from "vitest";
+import { ConcurrencyLimiter } from "../../src/core/concurrency-limiter.js";
+
+describe("ConcurrencyLimiter", () => {
+	it("should turn requests away at the limit", () => {
+		const limiter = new ConcurrencyLimiter(2);
+
+		const first = limiter.tryAcquire();
+		const second = limiter.tryAcquire();
+
+		expect(first).toBeDefined();
+		expect(second).toBeDefined();
+		expect(limiter.tryAcquire()).toBeUndefined();
+		expect(limiter.getStatus()).toEqual({ inFlight: 2, maxInFlight: 2, rejected: 1 });
+	});
+
+	it("should free a slot on release, once", () => {
+		const limiter = new ConcurrencyLimiter(1);
+
+		const release = limiter.tryAcquire();
+		release?.();
+		release?.();
+
+		expect(limiter.getStatus().inFlight).toBe(0);
+		expect(limiter.tryAcquire()).toBeDefined();
+		expect(limiter.tryAcquire()).toBeUndefined();
+	});
+
+	it("should not limit when the maximum is 0", () => {
+		const limiter = new ConcurrencyLimiter(0);
+
+		for (let i = 0; i < 1000; i++) {
+			expect(limiter.tryAcquire()).toBeDefined();
+		}
+		expect(limiter.getStatus().rejected).toBe(0);
+	});
+
+	it("should reject an invalid maximum", () => {
+		expect(() => new ConcurrencyLimiter(-1)).toThrow(/non-negative integer/);
+	});
+});
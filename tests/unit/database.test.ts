@@ -1,5 +1,6 @@
 import { existsSync, unlinkSync } from "node:fs";
 import { afterEach, beforeEach, describe, expect, it } from "vitest";
+import type { TokenIssuance } from "../../src/core/issuance-log.js";
 import type { Session } from "../../src/core/types.js";
 import type { LedgerEntry } from "../../src/ledger/types.js";
 import { LokiDatabase } from "../../src/persistence/database.js";
@@ -91,6 +92,43 @@ describe("LokiDatabase", () => {
 			expect(loaded?.shuffleQueue).toEqual(session.shuffleQueue);
 		});
 
+		it("should save session with warm-up progress", () => {
+			const session: Session = {
+				id: "sess_warmup123",
+				mode: "explicit",
+				mischief: ["alg-none"],
+				startedAt: new Date(),
+				warmupRequests: 5,
+				tokenRequests: 2,
+			};
+
+			db.saveSession(session);
+			const loaded = db.loadSession(session.id);
+
+			expect(loaded?.warmupRequests).toBe(5);
+			expect(loaded?.tokenRequests).toBe(2);
+		});
+
+		it("should save session with a captured freeze", () => {
+			const session: Session = {
+				id: "sess_freeze123",
+				mode: "explicit",
+				mischief: ["alg-none"],
+				startedAt: new Date(),
+				freeze: {
+					keepFresh: true,
+					requestedAt: "2026-01-20T10:00:00.000Z",
+					capturedAt: "2026-01-20T10:00:05.000Z",
+					response: { access_token: "a.b.", token_type: "Bearer" },
+				},
+			};
+
+			db.saveSession(session);
+			const loaded = db.loadSession(session.id);
+
+			expect(loaded?.freeze).toEqual(session.freeze);
+		});
+
 		it("should return undefined for non-existent session", () => {
 			const loaded = db.loadSession("non-existent");
 			expect(loaded).toBeUndefined();
@@ -211,6 +249,107 @@ describe("LokiDatabase", () => {
 			const loaded = db.loadLedgerEntries(testSession.id);
 			expect(loaded).toEqual([]);
 		});
+
+		it("should keep ledger entries when the session is saved again", () => {
+			db.saveLedgerEntry(testSession.id, {
+				id: "entry_kept",
+				requestId: "req_1",
+				timestamp: "2026-01-20T10:00:00Z",
+				plugin: { id: "alg-none", name: "Algorithm None", severity: "critical" },
+				spec: { requirement: "Must sign", violation: "Unsigned" },
+				evidence: {},
+			});
+
+			db.saveSession({ ...testSession, endedAt: new Date() });
+
+			expect(db.loadLedgerEntries(testSession.id)).toHaveLength(1);
+			expect(db.loadSession(testSession.id)?.endedAt).toBeDefined();
+		});
+	});
+
+	describe("session events", () => {
+		it("should save and load events in order", () => {
+			db.saveSession({
+				id: "sess_events",
+				mode: "explicit",
+				mischief: [],
+				startedAt: new Date(),
+			});
+			db.saveEvent({
+				id: "evt_1",
+				sessionId: "sess_events",
+				type: "warmup-complete",
+				timestamp: "2026-01-01T00:00:00.000Z",
+				seq: 1,
+				data: { warmupRequests: 3, firstMischiefRequest: 4 },
+			});
+
+			const events = db.loadEvents("sess_events");
+			expect(events).toHaveLength(1);
+			expect(events[0]?.type).toBe("warmup-complete");
+			expect(events[0]?.data).toEqual({ warmupRequests: 3, firstMischiefRequest: 4 });
+			expect(db.loadEvents("sess_other")).toEqual([]);
+		});
+
+		it("should delete rotated events by sequence number", () => {
+			db.saveSession({ id: "sess_rotate", mode: "explicit", mischief: [], startedAt: new Date() });
+			for (const seq of [1, 2, 3]) {
+				db.saveEvent({
+					id: `evt_${seq}`,
+					sessionId: "sess_rotate",
+					type: "token-reported",
+					timestamp: "2026-01-01T00:00:00.000Z",
+					seq,
+					data: {},
+				});
+			}
+
+			db.deleteEventsThrough("sess_rotate", 2);
+
+			expect(db.loadEvents("sess_rotate").map((event) => event.seq)).toEqual([3]);
+		});
+	});
+
+	describe("token issuances", () => {
+		const issuance: TokenIssuance = {
+			tokenType: "access_token",
+			jti: "jti_1",
+			issuedAt: "2026-01-01T00:00:00.000Z",
+			mischief: ["alg-none"],
+			mutations: [{ plugin: "alg-none", mutation: "Stripped signature", evidence: {} }],
+			changes: { header: [{ name: "alg", before: "RS256", after: "none" }], claims: [] },
+			header: { alg: "none" },
+			signingKey: null,
+		};
+
+		it("should save and load issuances and the last token response", () => {
+			db.saveIssuance("sess_issued", issuance);
+			db.saveIssuance("sess_issued", { ...issuance, jti: "jti_2" });
+			db.saveLastTokenResponse("sess_issued", '{"access_token":"a"}');
+			db.saveLastTokenResponse("sess_issued", '{"access_token":"b"}');
+
+			expect(db.loadIssuances("sess_issued").map((i) => i.jti)).toEqual(["jti_1", "jti_2"]);
+			expect(db.loadIssuances("sess_issued")[0]).toEqual(issuance);
+			expect(db.loadLastTokenResponse("sess_issued")).toBe('{"access_token":"b"}');
+			expect(db.loadLastTokenResponse("sess_other")).toBeUndefined();
+		});
+
+		it("should delete them with their session", () => {
+			const session: Session = {
+				id: "sess_issued",
+				mode: "explicit",
+				mischief: [],
+				startedAt: new Date(),
+			};
+			db.saveSession(session);
+			db.saveIssuance(session.id, issuance);
+			db.saveLastTokenResponse(session.id, "{}");
+
+			db.deleteSession(session.id);
+
+			expect(db.loadIssuances(session.id)).toEqual([]);
+			expect(db.loadLastTokenResponse(session.id)).toBeUndefined();
+		});
 	});
 
 	describe("purge", () => {
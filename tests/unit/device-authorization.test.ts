@@ -0,0 +1,48 @@
+import { describe, expect, it } from "vitest";
+import { DEFAULT_POLLING_INTERVAL, DeviceCodeLedger } from "../../src/core/device-authorization.js";
+
+describe("Device Code Ledger", () => {
+	function ledgerAt(start: number) {
+		let now = start;
+		const ledger = new DeviceCodeLedger({ now: () => now });
+		return {
+			ledger,
+			advance: (ms: number) => {
+				now += ms;
+			},
+		};
+	}
+
+	it("should time each poll against the previous one", () => {
+		const { ledger, advance } = ledgerAt(1000);
+		ledger.issue({ device_code: "dc1", expires_in: 600, interval: 5 }, "device-client");
+
+		expect(ledger.poll("dc1")).toEqual({
+			interval: 5,
+			polls: 1,
+			sinceLastPollMs: null,
+			expired: false,
+		});
+		advance(2000);
+		expect(ledger.poll("dc1")).toMatchObject({ polls: 2, sinceLastPollMs: 2000 });
+	});
+
+	it("should report codes past their lifetime as expired", () => {
+		const { ledger, advance } = ledgerAt(1000);
+		ledger.issue({ device_code: "dc1", expires_in: 10 }, undefined);
+
+		advance(9999);
+		expect(ledger.poll("dc1")?.expired).toBe(false);
+		advance(1);
+		expect(ledger.poll("dc1")?.expired).toBe(true);
+	});
+
+	it("should default the interval and ignore responses without a code", () => {
+		const { ledger } = ledgerAt(1000);
+		ledger.issue({ device_code: "dc1", expires_in: 600 }, undefined);
+		ledger.issue({ error: "invalid_client" }, undefined);
+
+		expect(ledger.poll("dc1")?.interval).toBe(DEFAULT_POLLING_INTERVAL);
+		expect(ledger.poll("unknown")).toBeUndefined();
+	});
+});
@@ -0,0 +1,179 @@
+import * as jose from "jose";
+import { beforeAll, describe, expect, it } from "vitest";
+import { probeDiscoveryConsistency } from "../../src/core/discovery-consistency.js";
+import { type ManagedKey, generateSigningKey } from "../../src/core/key-manager.js";
+
+const ISSUER = "https://idp.example.com";
+
+/**
+ * A fetch that serves JSON documents by URL and 404s everything else
+ */
+function stubFetch(documents: Record<string, unknown>): typeof fetch {
+	return (async (input: string | URL | Request) => {
+		const url = String(input);
+		if (!(url in documents)) {
+			return new Response("not found", { status: 404 });
+		}
+		return Response.json(documents[url]);
+	}) as typeof fetch;
+}
+
+describe("Discovery Consistency", () => {
+	let key: ManagedKey;
+
+	beforeAll(async () => {
+		key = await generateSigningKey("RS256");
+	});
+
+	function documents(metadata: Record<string, unknown> = {}, keys?: unknown[]) {
+		return {
+			[`${ISSUER}/.well-known/openid-configuration`]: {
+				issuer: ISSUER,
+				jwks_uri: `${ISSUER}/jwks`,
+				id_token_signing_alg_values_supported: ["RS256"],
+				...metadata,
+			},
+			[`${ISSUER}/jwks`]: { keys: keys ?? [key.publicJwk] },
+		};
+	}
+
+	function sign(claims: Record<string, unknown> = {}, header?: jose.JWTHeaderParameters) {
+		return new jose.SignJWT({ iss: ISSUER, sub: "user", ...claims })
+			.setProtectedHeader(header ?? { alg: "RS256", kid: key.kid })
+			.sign(key.privateKey);
+	}
+
+	it("should report a consistent issuer with a valid token", async () => {
+		const report = await probeDiscoveryConsistency({
+			issuer: ISSUER,
+			token: await sign(),
+			fetch: stubFetch(documents()),
+		});
+
+		expect(report).toMatchObject({
+			discoveryUrl: `${ISSUER}/.well-known/openid-configuration`,
+			jwksUri: `${ISSUER}/jwks`,
+			keys: 1,
+			tokenChecked: true,
+			consistent: true,
+			findings: [],
+		});
+	});
+
+	it("should report an unreachable discovery document", async () => {
+		const report = await probeDiscoveryConsistency({ issuer: ISSUER, fetch: stubFetch({}) });
+
+		expect(report.consistent).toBe(false);
+		expect(report.findings).toEqual([
+			expect.objectContaining({ check: "discovery-unavailable", severity: "critical" }),
+		]);
+	});
+
+	it("should flag metadata that disagrees with the issuer", async () => {
+		const report = await probeDiscoveryConsistency({
+			issuer: ISSUER,
+			fetch: stubFetch(
+				documents({
+					issuer: "https://evil.example.com",
+					jwks_uri: "https://evil.example.com/jwks",
+					id_token_signing_alg_values_supported: ["RS256", "none"],
+				}),
+			),
+		});
+
+		expect(report.findings.map((f) => f.check)).toEqual([
+			"iss-mismatch",
+			"jwks-uri-foreign",
+			"alg-none-advertised",
+			"jwks-unavailable",
+		]);
+		expect(report.findings[0]?.evidence).toEqual({
+			expected: ISSUER,
+			advertised: "https://evil.example.com",
+		});
+	});
+
+	it("should flag private and duplicate keys in the JWKS", async () => {
+		const report = await probeDiscoveryConsistency({
+			issuer: ISSUER,
+			fetch: stubFetch(documents({}, [key.privateJwk, key.publicJwk])),
+		});
+
+		expect(report.findings.map((f) => [f.check, f.severity])).toEqual([
+			["jwks-private-key", "critical"],
+			["jwks-duplicate-kid", "medium"],
+		]);
+	});
+
+	it("should treat an unadvertised key alg as low severity", async () => {
+		const report = await probeDiscoveryConsistency({
+			issuer: ISSUER,
+			fetch: stubFetch(documents({ id_token_signing_alg_values_supported: ["ES256"] })),
+		});
+
+		expect(report.findings.map((f) => f.check)).toEqual(["jwks-alg-not-advertised"]);
+		expect(report.consistent).toBe(true);
+	});
+
+	it("should flag tokens that disagree with the metadata", async () => {
+		const secret = new TextEncoder().encode("a-shared-secret-of-at-least-32-bytes");
+		const hs256 = await new jose.SignJWT({ iss: ISSUER })
+			.setProtectedHeader({ alg: "HS256", kid: key.kid })
+			.sign(secret);
+		const unsigned = new jose.UnsecuredJWT({ iss: ISSUER }).encode();
+
+		const cases: [string, string[]][] = [
+			["not-a-jwt", ["token-undecodable"]],
+			[await sign({ iss: "https://other.example.com" }), ["token-iss-mismatch"]],
+			[unsigned, ["token-alg-none"]],
+			[hs256, ["token-alg-not-advertised", "token-alg-mismatch"]],
+			[await sign({}, { alg: "RS256", kid: "unknown" }), ["token-kid-unknown"]],
+			[
+				await sign({}, { alg: "RS256", kid: key.kid, jku: "https://evil.example.com/jwks" }),
+				["token-key-header"],
+			],
+		];
+		for (const [token, checks] of cases) {
+			const report = await probeDiscoveryConsistency({
+				issuer: ISSUER,
+				token,
+				fetch: stubFetch(documents()),
+			});
+			expect(report.findings.map((f) => f.check)).toEqual(checks);
+		}
+	});
+
+	it("should flag a token signed by a key outside the JWKS", async () => {
+		const other = await generateSigningKey("RS256");
+		const token = await new jose.SignJWT({ iss: ISSUER })
+			.setProtectedHeader({ alg: "RS256", kid: key.kid })
+			.sign(other.privateKey);
+
+		const report = await probeDiscoveryConsistency({
+			issuer: ISSUER,
+			token,
+			fetch: stubFetch(documents()),
+		});
+
+		expect(report.findings).toEqual([
+			expect.objectContaining({ check: "token-signature-invalid", severity: "critical" }),
+		]);
+	});
+
+	it("should send extra headers with every request", async () => {
+		const seen: (string | null)[] = [];
+		const inner = stubFetch(documents());
+		const fetcher = (async (input: string | URL | Request, init?: RequestInit) => {
+			seen.push(new Headers(init?.headers).get("X-Loki-Session"));
+			return inner(input, init);
+		}) as typeof fetch;
+
+		await probeDiscoveryConsistency({
+			issuer: ISSUER,
+			headers: { "X-Loki-Session": "sess_1" },
+			fetch: fetcher,
+		});
+
+		expect(seen).toEqual(["sess_1", "sess_1"]);
+	});
+});
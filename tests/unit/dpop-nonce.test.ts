@@ -0,0 +1,25 @@
+import * as jose from "jose";
+import { describe, expect, it } from "vitest";
+import { dpopProofNonce, generateDpopNonce } from "../../src/core/dpop-nonce.js";
+
+describe("DPoP Nonce", () => {
+	it("should read the nonce claim of a DPoP proof", async () => {
+		const { privateKey } = await jose.generateKeyPair("ES256");
+		const proof = (claims: Record<string, unknown>) =>
+			new jose.SignJWT({ htm: "POST", htu: "http://localhost/token", ...claims })
+				.setProtectedHeader({ typ: "dpop+jwt", alg: "ES256", jwk: { kty: "EC" } })
+				.sign(privateKey);
+
+		expect(dpopProofNonce(await proof({ nonce: "abc" }))).toBe("abc");
+		expect(dpopProofNonce(await proof({}))).toBeNull();
+		expect(dpopProofNonce(await proof({ nonce: 7 }))).toBeNull();
+		expect(dpopProofNonce("not-a-jwt")).toBeUndefined();
+	});
+
+	it("should generate distinct base64url nonces", () => {
+		const nonce = generateDpopNonce();
+
+		expect(nonce).toMatch(/^[A-Za-z0-9_-]{43}$/);
+		expect(generateDpopNonce()).not.toBe(nonce);
+	});
+});
@@ -0,0 +1,85 @@
+import * as jose from "jose";
+import { describe, expect, it } from "vitest";
+import {
+	DPOP_PROOF_LIFETIME,
+	DpopJtiCache,
+	bindDpopKey,
+	verifyDpopProof,
+} from "../../src/core/dpop-proof.js";
+
+const ENDPOINT = "https://loki.test/token";
+
+async function proof(
+	claims: Record<string, unknown> = {},
+	header: Record<string, unknown> = {},
+): Promise<{ proof: string; thumbprint: string }> {
+	const { publicKey, privateKey } = await jose.generateKeyPair("ES256");
+	const jwk = await jose.exportJWK(publicKey);
+	const signed = await new jose.SignJWT({ htm: "POST", htu: ENDPOINT, jti: "jti-1", ...claims })
+		.setProtectedHeader({ typ: "dpop+jwt", alg: "ES256", jwk, ...header })
+		.setIssuedAt()
+		.sign(privateKey);
+	return { proof: signed, thumbprint: await jose.calculateJwkThumbprint(jwk) };
+}
+
+describe("DPoP proof", () => {
+	it("should accept a proof for the request, with its key's thumbprint", async () => {
+		const { proof: sent, thumbprint } = await proof({ htu: `${ENDPOINT}?ignored=1` });
+		expect(await verifyDpopProof(sent, "POST", ENDPOINT)).toEqual({ thumbprint, jti: "jti-1" });
+	});
+
+	it("should refuse a proof for another method or URL", async () => {
+		const wrongMethod = await proof({ htm: "GET" });
+		expect(await verifyDpopProof(wrongMethod.proof, "POST", ENDPOINT)).toBe(
+			"the DPoP proof's htm must be POST",
+		);
+		const wrongUrl = await proof({ htu: "https://loki.test/userinfo" });
+		expect(await verifyDpopProof(wrongUrl.proof, "POST", ENDPOINT)).toBe(
+			`the DPoP proof's htu must be ${ENDPOINT}`,
+		);
+	});
+
+	it("should refuse a proof without a jti, of another typ, or too old", async () => {
+		const anonymous = await proof({ jti: undefined });
+		expect(await verifyDpopProof(anonymous.proof, "POST", ENDPOINT)).toBe(
+			"the DPoP proof must carry a jti",
+		);
+		const untyped = await proof({}, { typ: "JWT" });
+		expect(await verifyDpopProof(untyped.proof, "POST", ENDPOINT)).toContain(
+			"failed verification",
+		);
+		const { proof: stale } = await proof();
+		const later = Date.now() + (DPOP_PROOF_LIFETIME + 60) * 1000;
+		expect(await verifyDpopProof(stale, "POST", ENDPOINT, later)).toContain("failed verification");
+	});
+
+	it("should refuse a proof that isn't a JWS or carries no public key", async () => {
+		expect(await verifyDpopProof("not-a-proof", "POST", ENDPOINT)).toBe(
+			"the DPoP proof is not a JWS",
+		);
+		const { privateKey } = await jose.generateKeyPair("ES256", { extractable: true });
+		const privateJwk = await jose.exportJWK(privateKey);
+		const leaked = await proof({}, { jwk: privateJwk });
+		expect(await verifyDpopProof(leaked.proof, "POST", ENDPOINT)).toBe(
+			"the DPoP proof must carry a public key in its jwk header",
+		);
+	});
+
+	it("should bind claims to a key, keeping a certificate binding", () => {
+		const claims: Record<string, unknown> = { cnf: { "x5t#S256": "cert" } };
+		expect(bindDpopKey(claims, "key")).toBe(true);
+		expect(claims.cnf).toEqual({ "x5t#S256": "cert", jkt: "key" });
+		expect(bindDpopKey(claims, "key")).toBe(false);
+	});
+
+	it("should refuse a jti until its proof's lifetime is over", () => {
+		let now = 0;
+		const jtis = new DpopJtiCache(() => now);
+		expect(jtis.use("a")).toBe(false);
+		expect(jtis.use("a")).toBe(true);
+		expect(jtis.use("b")).toBe(false);
+
+		now = (DPOP_PROOF_LIFETIME + 60) * 1000;
+		expect(jtis.use("a")).toBe(false);
+	});
+});
@@ -0,0 +1,25 @@
+import { describe, expect, it } from "vitest";
+import { parseDuration } from "../../src/core/duration.js";
+
+describe("Duration", () => {
+	it("should parse Go durations into milliseconds", () => {
+		const cases = [
+			["262800h", 262800 * 3600 * 1000],
+			["1h30m", 90 * 60 * 1000],
+			["1.5h", 90 * 60 * 1000],
+			["-2m3s", -123 * 1000],
+			["300ms", 300],
+			["1500us", 1.5],
+			["0", 0],
+		] as const;
+		for (const [value, ms] of cases) {
+			expect(parseDuration(value)).toBeCloseTo(ms);
+		}
+	});
+
+	it("should refuse values that aren't Go durations", () => {
+		for (const value of ["", "30", "30y", "1d", "h", "1h 30m", "--1h"]) {
+			expect(parseDuration(value)).toBeUndefined();
+		}
+	});
+});
@@ -0,0 +1,44 @@
+import { describe, expect, it } from "vitest";
+import {
+	disabledEndpointAt,
+	disabledEndpoints,
+	withoutDisabledEndpoints,
+} from "../../src/core/endpoint-flags.js";
+
+describe("Endpoint Flags", () => {
+	it("should accept names, slashed names and served paths", () => {
+		const disabled = disabledEndpoints({ userinfo: false, "/revocation": false, "/jwks": true });
+		expect([...disabled]).toEqual(["userinfo", "revocation"]);
+
+		expect([...disabledEndpoints({ "/me": false })]).toEqual(["userinfo"]);
+		expect([...disabledEndpoints({ "/.well-known/jwks.json": false })]).toEqual(["jwks"]);
+	});
+
+	it("should reject unknown endpoints", () => {
+		expect(() => disabledEndpoints({ registration: false })).toThrow(/Unknown endpoint/);
+	});
+
+	it("should find the disabled endpoint serving a path", () => {
+		const disabled = disabledEndpoints({ token: false, end_session: false });
+
+		expect(disabledEndpointAt("/token", disabled)).toBe("token");
+		expect(disabledEndpointAt("/session/end/confirm", disabled)).toBe("end_session");
+		expect(disabledEndpointAt("/token/revocation", disabled)).toBeUndefined();
+	});
+
+	it("should drop the metadata advertising disabled endpoints", () => {
+		const metadata = {
+			issuer: "http://localhost:3000",
+			userinfo_endpoint: "http://localhost:3000/me",
+			pushed_authorization_request_endpoint: "http://localhost:3000/request",
+			require_pushed_authorization_requests: false,
+		};
+
+		const disabled = disabledEndpoints({ userinfo: false, par: false });
+
+		expect(withoutDisabledEndpoints(metadata, disabled)).toEqual({
+			issuer: "http://localhost:3000",
+		});
+		expect(metadata.userinfo_endpoint).toBe("http://localhost:3000/me");
+	});
+});
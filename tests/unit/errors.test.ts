@@ -0,0 +1,32 @@
+import { describe, expect, it } from "vitest";
+import { ERROR_CODES, lokiError, oauthError } from "../../src/core/errors.js";
+
+describe("Errors", () => {
+	it("should repeat the message as error on admin rejections", () => {
+		expect(lokiError("session_not_found", "Session not found", { sessionId: "s1" })).toEqual({
+			error: "Session not found",
+			code: "session_not_found",
+			message: "Session not found",
+			details: { sessionId: "s1" },
+		});
+	});
+
+	it("should keep the OAuth members on endpoint rejections", () => {
+		const body = oauthError("invalid_client", "public_client_secret", "no secrets");
+
+		expect(body).toEqual({
+			error: "invalid_client",
+			error_description: "no secrets",
+			code: "public_client_secret",
+			message: "no secrets",
+			details: {},
+		});
+	});
+
+	it("should describe every code in snake_case", () => {
+		for (const [code, description] of Object.entries(ERROR_CODES)) {
+			expect(code).toMatch(/^[a-z]+(_[a-z]+)*$/);
+			expect(description.length).toBeGreaterThan(0);
+		}
+	});
+});
@@ -0,0 +1,69 @@
+import { describe, expect, it } from "vitest";
+import { EventLog } from "../../src/core/event-log.js";
+
+describe("Event Log", () => {
+	it("should number each session's events from 1", () => {
+		const log = new EventLog();
+		log.record("sess_a", "token-reported");
+		log.record("sess_b", "token-reported");
+		log.record("sess_a", "token-reported");
+
+		expect(log.list("sess_a").map((event) => event.seq)).toEqual([1, 2]);
+		expect(log.list("sess_b").map((event) => event.seq)).toEqual([1]);
+	});
+
+	it("should list only events after a since cursor", () => {
+		const log = new EventLog();
+		for (let i = 0; i < 4; i++) {
+			log.record("sess_a", "token-reported");
+		}
+
+		expect(log.list("sess_a", 2).map((event) => event.seq)).toEqual([3, 4]);
+		expect(log.list("sess_a", 4)).toEqual([]);
+	});
+
+	it("should drop the oldest events beyond the retention limit", () => {
+		const rotations: [string, number][] = [];
+		const log = new EventLog({
+			maxEventsPerSession: 2,
+			onRotate: (sessionId, throughSeq) => rotations.push([sessionId, throughSeq]),
+		});
+		for (let i = 0; i < 5; i++) {
+			log.record("sess_a", "token-reported");
+		}
+
+		expect(log.list("sess_a").map((event) => event.seq)).toEqual([4, 5]);
+		expect(rotations).toEqual([
+			["sess_a", 1],
+			["sess_a", 2],
+			["sess_a", 3],
+		]);
+	});
+
+	it("should list a snapshot unaffected by later recording and rotation", () => {
+		const log = new EventLog({ maxEventsPerSession: 2 });
+		log.record("sess_a", "token-reported");
+		log.record("sess_a", "token-reported");
+		const listed = log.list("sess_a");
+
+		log.record("sess_a", "token-reported");
+
+		expect(listed.map((event) => event.seq)).toEqual([1, 2]);
+		expect(log.list("sess_a").map((event) => event.seq)).toEqual([2, 3]);
+	});
+
+	it("should continue numbering after restored events", () => {
+		const log = new EventLog({ maxEventsPerSession: 1 });
+		log.restore([
+			{ id: "evt_1", sessionId: "sess_a", type: "token-reported", timestamp: "", seq: 7, data: {} },
+			{ id: "evt_2", sessionId: "sess_a", type: "token-reported", timestamp: "", seq: 8, data: {} },
+		]);
+
+		expect(log.list("sess_a").map((event) => event.seq)).toEqual([8]);
+		expect(log.record("sess_a", "token-reported").seq).toBe(9);
+	});
+
+	it("should refuse a negative retention limit", () => {
+		expect(() => new EventLog({ maxEventsPerSession: -1 })).toThrow(/non-negative integer/);
+	});
+});
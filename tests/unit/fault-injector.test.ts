@@ -0,0 +1,56 @@
+import { describe, expect, it } from "vitest";
+import { FaultInjector } from "../../src/core/fault-injector.js";
+
+describe("FaultInjector", () => {
+	it("should not inject faults on unconfigured endpoints", () => {
+		const faults = new FaultInjector({ errorRates: { "/token": 1 } }, { random: () => 0 });
+
+		expect(faults.check("/userinfo")).toBeUndefined();
+		expect(faults.check("/token?foo=bar")).toBe(503);
+	});
+
+	it("should respect the configured rate", () => {
+		let roll = 0.3;
+		const faults = new FaultInjector({ errorRates: { "/token": 0.25 } }, { random: () => roll });
+
+		expect(faults.check("/token")).toBeUndefined();
+		roll = 0.2;
+		expect(faults.check("/token")).toBe(503);
+	});
+
+	it("should let JWKS succeed once before failing", () => {
+		const faults = new FaultInjector({ errorRates: { "/jwks": 1 } }, { random: () => 0 });
+
+		expect(faults.check("/jwks")).toBeUndefined();
+		expect(faults.check("/jwks")).toBe(503);
+	});
+
+	it("should pick from configured statuses and count injected faults", () => {
+		const injected: string[] = [];
+		const faults = new FaultInjector(
+			{ errorRates: { "/token": 1 }, statuses: [500, 502] },
+			{ random: () => 0.9, onFault: (f) => injected.push(`${f.endpoint}:${f.status}`) },
+		);
+
+		faults.check("/token");
+		faults.check("/token");
+
+		expect(injected).toEqual(["/token:502", "/token:502"]);
+		expect(faults.getStatus().injected).toEqual({ "/token": 2 });
+		expect(faults.getStatus().recent).toHaveLength(2);
+	});
+
+	it("should reject invalid configuration", () => {
+		expect(() => new FaultInjector({ errorRates: { "/token": 1.5 } })).toThrow(/between 0 and 1/);
+		expect(() => new FaultInjector({ errorRates: { token: 0.1 } })).toThrow(/starting with/);
+		expect(() => new FaultInjector({ errorRates: {}, statuses: [404] })).toThrow(/5xx/);
+	});
+
+	it("should reconfigure at runtime", () => {
+		const faults = new FaultInjector({ errorRates: {} }, { random: () => 0 });
+		expect(faults.check("/token")).toBeUndefined();
+
+		faults.configure({ errorRates: { "/token": 1 } });
+		expect(faults.check("/token")).toBe(503);
+	});
+});
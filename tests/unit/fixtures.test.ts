@@ -0,0 +1,82 @@
+import { existsSync, readFileSync, rmSync, writeFileSync } from "node:fs";
+import * as jose from "jose";
+import { afterEach, beforeEach, describe, expect, it } from "vitest";
+import { type FixtureManifest, writeFixtures } from "../../src/core/fixtures.js";
+import { PluginRegistry } from "../../src/plugins/registry.js";
+
+describe("Fixtures", () => {
+	const TEST_FIXTURES_DIR = "./test-fixtures";
+	let registry: PluginRegistry;
+
+	beforeEach(async () => {
+		if (existsSync(TEST_FIXTURES_DIR)) {
+			rmSync(TEST_FIXTURES_DIR, { recursive: true, force: true });
+		}
+		registry = new PluginRegistry();
+		await registry.loadBuiltIn();
+	});
+
+	afterEach(() => {
+		if (existsSync(TEST_FIXTURES_DIR)) {
+			rmSync(TEST_FIXTURES_DIR, { recursive: true, force: true });
+		}
+	});
+
+	function read(file: string): string {
+		return readFileSync(`${TEST_FIXTURES_DIR}/${file}`, "utf8");
+	}
+
+	it("should write a verifiable baseline and one forged token per plugin", async () => {
+		const manifest = await writeFixtures(
+			TEST_FIXTURES_DIR,
+			{ subject: "alice", mischief: ["alg-none", "azp-confusion"] },
+			registry,
+		);
+
+		expect(manifest.fixtures.map((f) => [f.file, f.expect])).toEqual([
+			["baseline.jwt", "accept"],
+			["alg-none.jwt", "reject"],
+			["azp-confusion.jwt", "reject"],
+		]);
+		expect(JSON.parse(read("manifest.json"))).toEqual(manifest);
+
+		const jwks = jose.createLocalJWKSet(JSON.parse(read("jwks.json")));
+		const { payload } = await jose.jwtVerify(read("baseline.jwt").trim(), jwks, {
+			currentDate: new Date(manifest.issuedAt * 1000),
+		});
+		expect(payload.sub).toBe("alice");
+
+		const algNone = manifest.fixtures[1];
+		expect(algNone?.header.alg).toBe("none");
+		expect(algNone?.claims.sub).toBe("alice");
+		expect(algNone?.reason).toBe(registry.get("alg-none")?.spec.description);
+	});
+
+	it("should regenerate identical files from the same seed and key", async () => {
+		const config = { subject: "alice", mischief: ["azp-confusion"], seed: "stable" };
+		await writeFixtures(TEST_FIXTURES_DIR, config, registry);
+		const first = [read("manifest.json"), read("azp-confusion.jwt")];
+
+		writeFileSync(`${TEST_FIXTURES_DIR}/stale.jwt`, "old\n");
+		await writeFixtures(TEST_FIXTURES_DIR, config, registry);
+
+		expect([read("manifest.json"), read("azp-confusion.jwt")]).toEqual(first);
+		expect(existsSync(`${TEST_FIXTURES_DIR}/stale.jwt`)).toBe(false);
+	});
+
+	it("should skip plugins that forge no tokens and reject unknown ones", async () => {
+		const manifest: FixtureManifest = await writeFixtures(
+			TEST_FIXTURES_DIR,
+			{ subject: "alice", mischief: ["latency-injection"] },
+			registry,
+		);
+		expect(manifest.fixtures).toHaveLength(1);
+		expect(manifest.skipped).toEqual([
+			{ mischief: "latency-injection", reason: "A response plugin forges no tokens" },
+		]);
+
+		await expect(
+			writeFixtures(TEST_FIXTURES_DIR, { subject: "alice", mischief: ["nope"] }, registry),
+		).rejects.toThrow("Unknown plugin 'nope'");
+	});
+});
@@ -0,0 +1,59 @@
+import { describe, expect, it } from "vitest";
+import { fuzzCombinations, parseFuzzRequest, summarizeFuzz } from "../../src/core/fuzz.js";
+
+const CATALOG = ["alg-none", "kid-manipulation", "iss-mismatch", "aud-confusion", "exp-past"];
+
+describe("Fuzz", () => {
+	it("should narrow the catalog to include, less exclude", () => {
+		const result = parseFuzzRequest(
+			{ count: 3, include: ["exp-past", "alg-none", "iss-mismatch"], exclude: ["iss-mismatch"] },
+			CATALOG,
+			100,
+		);
+
+		expect(result.ok && result.request.pool).toEqual(["alg-none", "exp-past"]);
+		expect(result.ok && result.request.maxMischief).toBe(3);
+	});
+
+	it("should refuse bad counts, unknown plugins and empty pools", () => {
+		expect(parseFuzzRequest({ count: 0 }, CATALOG, 100)).toMatchObject({ parameter: "count" });
+		expect(parseFuzzRequest({ count: 101 }, CATALOG, 100)).toMatchObject({ parameter: "count" });
+		expect(parseFuzzRequest({ count: 1, exclude: ["nope"] }, CATALOG, 100)).toMatchObject({
+			parameter: "exclude",
+			pluginIds: ["nope"],
+		});
+		expect(parseFuzzRequest({ count: 1, include: "alg-none" }, CATALOG, 100)).toMatchObject({
+			parameter: "include",
+		});
+		expect(parseFuzzRequest({ count: 1, exclude: CATALOG }, CATALOG, 100)).toMatchObject({
+			error: "include and exclude leave no plugins to combine",
+		});
+		expect(parseFuzzRequest({ count: 1, seed: -1 }, CATALOG, 100)).toMatchObject({
+			parameter: "seed",
+		});
+	});
+
+	it("should draw the same distinct combinations from the same seed", () => {
+		const request = { count: 20, pool: CATALOG, maxMischief: 2, seed: 42 };
+		const combinations = fuzzCombinations(request);
+
+		expect(combinations).toHaveLength(20);
+		for (const combination of combinations) {
+			expect(combination.length).toBeGreaterThanOrEqual(1);
+			expect(combination.length).toBeLessThanOrEqual(2);
+			expect(new Set(combination).size).toBe(combination.length);
+		}
+		expect(fuzzCombinations(request)).toEqual(combinations);
+		expect(fuzzCombinations({ ...request, seed: 43 })).not.toEqual(combinations);
+	});
+
+	it("should count sessions, distinct combinations and plugin draws", () => {
+		const summary = summarizeFuzz([["alg-none"], ["alg-none", "exp-past"], ["alg-none"]]);
+
+		expect(summary).toEqual({
+			sessions: 3,
+			combinations: 2,
+			plugins: { "alg-none": 3, "exp-past": 1 },
+		});
+	});
+});
@@ -0,0 +1,51 @@
+import { describe, expect, it } from "vitest";
+import { grantClaims, grantProfile, toMachineClaims } from "../../src/core/grant-claims.js";
+
+describe("Grant Claims", () => {
+	it("should issue machine tokens for client_credentials only", () => {
+		expect(grantProfile("client_credentials")).toBe("machine");
+		for (const grant of [
+			"authorization_code",
+			"refresh_token",
+			"urn:ietf:params:oauth:grant-type:device_code",
+			"urn:ietf:params:oauth:grant-type:token-exchange",
+			undefined,
+		]) {
+			expect(grantProfile(grant)).toBe("user");
+		}
+	});
+
+	it("should make a machine token the client's own", () => {
+		const claims: Record<string, unknown> = {
+			sub: "alice",
+			client_id: "svc",
+			scope: "api:read",
+			nonce: "n-0S6_WzA2Mj",
+			at_hash: "77QmUPtjPfzWtF2AnpK9RQ",
+			auth_time: 1700000000,
+			email: "alice@loki.test",
+		};
+
+		expect(toMachineClaims(claims)).toEqual(["nonce", "at_hash", "auth_time", "email", "sub"]);
+		expect(claims).toEqual({ sub: "svc", client_id: "svc", scope: "api:read" });
+		expect(toMachineClaims(claims)).toEqual([]);
+	});
+
+	it("should report the claims a token's profile doesn't expect", () => {
+		const machine = { sub: "svc", client_id: "svc", acr: "1" };
+		const user = { sub: "alice", client_id: "web", nonce: "n", at_hash: "h" };
+
+		expect(grantClaims("client_credentials", machine)).toEqual({
+			grantType: "client_credentials",
+			profile: "machine",
+			unexpected: ["acr"],
+		});
+		const impersonating = { sub: "bob", client_id: "svc" };
+		expect(grantClaims("client_credentials", impersonating).unexpected).toEqual(["sub"]);
+		expect(grantClaims("authorization_code", user)).toEqual({
+			grantType: "authorization_code",
+			profile: "user",
+			unexpected: [],
+		});
+	});
+});
@@ -0,0 +1,46 @@
+import { describe, expect, it } from "vitest";
+import {
+	decorateInteractionPage,
+	resolveDisplay,
+	resolveLocale,
+} from "../../src/core/interaction-page.js";
+
+describe("interaction page", () => {
+	describe("resolveDisplay", () => {
+		it("should honour defined display values", () => {
+			expect(resolveDisplay("popup")).toBe("popup");
+			expect(resolveDisplay("touch")).toBe("touch");
+		});
+
+		it("should fall back to page", () => {
+			expect(resolveDisplay(undefined)).toBe("page");
+			expect(resolveDisplay("fullscreen")).toBe("page");
+		});
+	});
+
+	describe("resolveLocale", () => {
+		it("should pick the first supported locale by language", () => {
+			expect(resolveLocale("pt-BR fr-CA de")).toBe("fr");
+		});
+
+		it("should default to English", () => {
+			expect(resolveLocale(undefined)).toBe("en");
+			expect(resolveLocale("pt-BR")).toBe("en");
+		});
+	});
+
+	describe("decorateInteractionPage", () => {
+		const html =
+			"<!DOCTYPE html><html><head><title>Sign-in</title></head><body><form></form></body></html>";
+
+		it("should reflect display and locale", () => {
+			const decorated = decorateInteractionPage(html, { display: "popup", locale: "fr" });
+
+			expect(decorated).toContain('<html lang="fr" data-display="popup">');
+			expect(decorated).toContain('class="loki-display-popup"');
+			expect(decorated).toContain("Se connecter");
+			expect(decorated).toContain("max-width:450px");
+			expect(decorated).toContain("<form></form>");
+		});
+	});
+});
@@ -0,0 +1,60 @@
+import { describe, expect, it } from "vitest";
+import { introspectionResponse, tokenState } from "../../src/core/introspection.js";
+
+describe("Introspection", () => {
+	const NOW = 1_760_000_000_000;
+	const seconds = NOW / 1000;
+	const notRevoked = () => false;
+
+	it("should find the reason a token is inactive", () => {
+		const cases: { claims: Record<string, unknown>; revoked: boolean; reason: string | null }[] = [
+			{ claims: { exp: seconds + 60 }, revoked: false, reason: null },
+			{ claims: { exp: seconds }, revoked: false, reason: "expired" },
+			{ claims: { nbf: seconds + 60 }, revoked: false, reason: "not-yet-valid" },
+			{ claims: { jti: "j1", exp: seconds + 60 }, revoked: true, reason: "revoked" },
+		];
+		for (const { claims, revoked, reason } of cases) {
+			const state = tokenState({ claims, tokenType: "access_token" }, claims, () => revoked, NOW);
+			expect(state.reason).toBe(reason);
+		}
+	});
+
+	it("should report tokens Loki never issued as unknown, keeping their claims", () => {
+		const presented = { sub: "mallory" };
+		expect(tokenState(undefined, presented, notRevoked, NOW)).toEqual({
+			reason: "unknown",
+			claims: presented,
+			tokenType: null,
+		});
+	});
+
+	it("should repeat the token's claims only when active", () => {
+		const state = tokenState(
+			{
+				claims: { sub: "alice", client_id: "c1", scope: "api", exp: seconds + 60, nonce: "n" },
+				tokenType: "access_token",
+			},
+			null,
+			notRevoked,
+			NOW,
+		);
+
+		expect(introspectionResponse(state, true)).toEqual({
+			active: true,
+			sub: "alice",
+			client_id: "c1",
+			scope: "api",
+			exp: seconds + 60,
+			token_type: "Bearer",
+		});
+		expect(introspectionResponse(state, false)).toEqual({ active: false });
+	});
+
+	it("should report the scope granted rather than the token's claim", () => {
+		const claims = { sub: "alice", scope: "api admin", exp: seconds + 60 };
+		const issued = { claims, tokenType: "access_token", grantedScope: "api" };
+		const state = tokenState(issued, claims, notRevoked, NOW);
+
+		expect(introspectionResponse(state, true)).toMatchObject({ active: true, scope: "api" });
+	});
+});
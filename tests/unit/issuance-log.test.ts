@@ -0,0 +1,168 @@
+import * as jose from "jose";
+import { describe, expect, it } from "vitest";
+import { IssuanceLog, diffFields, signingKeyOf } from "../../src/core/issuance-log.js";
+import { generateSigningKey } from "../../src/core/key-manager.js";
+
+describe("Issuance Log", () => {
+	async function sign(kid: string, claims: jose.JWTPayload, key: jose.KeyLike): Promise<string> {
+		return new jose.SignJWT(claims).setProtectedHeader({ alg: "ES256", kid }).sign(key);
+	}
+
+	it("should list added, removed and changed fields", () => {
+		expect(
+			diffFields({ sub: "alice", exp: 10, aud: ["api"] }, { sub: "alice", exp: 5, iss: "evil" }),
+		).toEqual([
+			{ name: "exp", before: 10, after: 5 },
+			{ name: "aud", before: ["api"] },
+			{ name: "iss", after: "evil" },
+		]);
+	});
+
+	it("should fingerprint the key that verifies, whatever kid the header claims", async () => {
+		const loki = await generateSigningKey("ES256");
+		const attacker = await generateSigningKey("ES256");
+		const candidates = [
+			{ jwk: loki.publicJwk, source: "loki" as const },
+			{ jwk: attacker.publicJwk, source: "attacker" as const },
+		];
+		const token = await sign(loki.kid, { sub: "alice" }, attacker.privateKey);
+
+		expect(await signingKeyOf(token, jose.decodeProtectedHeader(token), candidates)).toEqual({
+			kid: attacker.kid,
+			thumbprint: await jose.calculateJwkThumbprint(attacker.publicJwk),
+			source: "attacker",
+		});
+		expect(await signingKeyOf(token, { alg: "none" }, candidates)).toBeNull();
+		expect(await signingKeyOf(token, jose.decodeProtectedHeader(token), [])).toBeNull();
+	});
+
+	it("should record each JWT with its changes, oldest first, per session", async () => {
+		const key = await generateSigningKey("ES256");
+		const candidates = [{ jwk: key.publicJwk, source: "loki" as const }];
+		const original = await sign(key.kid, { jti: "j1", exp: 2000 }, key.privateKey);
+		const tampered = await sign(key.kid, { jti: "j1", exp: 1000 }, key.privateKey);
+		const mutation = { plugin: "temporal-tampering", mutation: "Expired", evidence: {} };
+
+		const log = new IssuanceLog();
+		await log.record("sess_a", "access_token", original, original, [], candidates);
+		await log.record("sess_a", "access_token", original, tampered, [mutation], candidates);
+		await log.record("sess_a", "access_token", "opaque", "opaque", [], candidates);
+
+		const report = log.getReport("sess_a", "explicit");
+		expect(report.mischief).toEqual(["temporal-tampering"]);
+		expect(report.issuances).toHaveLength(2);
+		expect(report.issuances[0]).toMatchObject({
+			jti: "j1",
+			mischief: [],
+			signingKey: { source: "loki" },
+		});
+		expect(report.issuances[0]).not.toHaveProperty("jtiReused");
+		expect(report.issuances[1]?.jtiReused).toBe(true);
+		expect(report.issuances[1]?.changes).toEqual({
+			header: [],
+			claims: [{ name: "exp", before: 2000, after: 1000 }],
+		});
+		expect(report.issuances[1]?.header).toEqual({ alg: "ES256", kid: key.kid });
+		expect(log.getReport("sess_b", "explicit").issuances).toEqual([]);
+
+		log.clear("sess_a");
+		expect(log.getReport("sess_a", "explicit").issuances).toEqual([]);
+	});
+
+	it("should show an ID token's expected nonce next to the one sent", async () => {
+		const key = await generateSigningKey("ES256");
+		const original = await sign(key.kid, { nonce: "n-1" }, key.privateKey);
+		const dropped = await sign(key.kid, {}, key.privateKey);
+
+		const log = new IssuanceLog();
+		await log.record("sess_a", "id_token", original, original, [], [], { expectedNonce: "n-1" });
+		await log.record("sess_a", "id_token", original, dropped, [], [], { expectedNonce: "n-1" });
+		await log.record("sess_a", "id_token", original, original, [], []);
+
+		const [echoed, omitted, unexpected] = log.getReport("sess_a", "explicit").issuances;
+		expect(echoed?.nonce).toEqual({ expected: "n-1", actual: "n-1" });
+		expect(omitted?.nonce).toEqual({ expected: "n-1", actual: null });
+		expect(unexpected).not.toHaveProperty("nonce");
+	});
+
+	it("should record the form a token's aud was serialized in", async () => {
+		const key = await generateSigningKey("ES256");
+		const single = await sign(key.kid, { aud: ["client-app"] }, key.privateKey);
+		const plain = await sign(key.kid, { aud: "client-app" }, key.privateKey);
+		const none = await sign(key.kid, {}, key.privateKey);
+
+		const log = new IssuanceLog();
+		for (const token of [single, plain, none]) {
+			await log.record("sess_a", "access_token", token, token, [], []);
+		}
+
+		const [asArray, asString, absent] = log.getReport("sess_a", "explicit").issuances;
+		expect(asArray?.aud).toEqual({ format: "array", serialized: '["client-app"]' });
+		expect(asString?.aud).toEqual({ format: "string", serialized: '"client-app"' });
+		expect(absent).not.toHaveProperty("aud");
+	});
+
+	it("should record an access token's expires_in next to its exp", async () => {
+		const key = await generateSigningKey("ES256");
+		const token = await sign(key.kid, { iat: 1000, exp: 1010 }, key.privateKey);
+
+		const log = new IssuanceLog();
+		await log.record("sess_a", "access_token", token, token, [], [], { expiresIn: 3600 });
+		await log.record("sess_a", "id_token", token, token, [], []);
+
+		const [access, id] = log.getReport("sess_a", "explicit").issuances;
+		expect(access?.expiry).toEqual({ expiresIn: 3600, exp: 1010, difference: -3590 });
+		expect(id).not.toHaveProperty("expiry");
+	});
+
+	it("should report userinfo responses only when mischief changed them", () => {
+		const log = new IssuanceLog();
+		const baseline = { sub: "alice", email: "alice@loki.test" };
+		const mutation = { plugin: "userinfo-tampering", mutation: "swapped", evidence: {} };
+
+		expect(log.recordUserinfo("sess_a", "alice", baseline, { ...baseline }, [])).toBeUndefined();
+		log.recordUserinfo("sess_a", "alice", baseline, { ...baseline, sub: "mallory" }, [mutation]);
+
+		const { userinfo } = log.getReport("sess_a", "explicit");
+		expect(userinfo).toEqual([
+			{
+				servedAt: expect.any(String),
+				tokenSub: "alice",
+				mischief: ["userinfo-tampering"],
+				mutations: [mutation],
+				changes: [{ name: "sub", before: "alice", after: "mallory" }],
+			},
+		]);
+		log.clear("sess_a");
+		expect(log.getReport("sess_a", "explicit")).not.toHaveProperty("userinfo");
+	});
+
+	it("should record revocations, with the mischief that ignored one", () => {
+		const log = new IssuanceLog();
+		const mutation = { plugin: "revocation-ignored", mutation: "left active", evidence: {} };
+
+		expect(log.getReport("sess_a", "explicit")).not.toHaveProperty("revocations");
+		log.recordRevocation("sess_a", {
+			jti: "jti-1",
+			tokenType: "access_token",
+			clientId: "test-client",
+			ignored: true,
+			mutations: [mutation],
+		});
+
+		const { revocations } = log.getReport("sess_a", "explicit");
+		expect(revocations).toEqual([
+			{
+				revokedAt: expect.any(String),
+				jti: "jti-1",
+				tokenType: "access_token",
+				clientId: "test-client",
+				ignored: true,
+				mischief: ["revocation-ignored"],
+				mutations: [mutation],
+			},
+		]);
+		log.clearAll();
+		expect(log.getReport("sess_a", "explicit")).not.toHaveProperty("revocations");
+	});
+});
@@ -0,0 +1,141 @@
+import { existsSync, readFileSync, unlinkSync, writeFileSync } from "node:fs";
+import { afterEach, beforeEach, describe, expect, it } from "vitest";
+import type { SessionEvent } from "../../src/core/event-log.js";
+import type { TokenIssuance } from "../../src/core/issuance-log.js";
+import type { Session } from "../../src/core/types.js";
+import type { LedgerEntry } from "../../src/ledger/types.js";
+import { JsonFileStore } from "../../src/persistence/json-store.js";
+
+describe("JsonFileStore", () => {
+	const TEST_STORE_PATH = "./test-loki.json";
+	let store: JsonFileStore;
+
+	function cleanup() {
+		for (const path of [TEST_STORE_PATH, `${TEST_STORE_PATH}.tmp`]) {
+			if (existsSync(path)) {
+				unlinkSync(path);
+			}
+		}
+	}
+
+	beforeEach(() => {
+		cleanup();
+		store = new JsonFileStore({ path: TEST_STORE_PATH });
+	});
+
+	afterEach(() => {
+		store.close();
+		cleanup();
+	});
+
+	const session: Session = {
+		id: "sess_json",
+		name: "json-test",
+		mode: "shuffled",
+		mischief: ["alg-none", "key-confusion"],
+		shuffleQueue: ["key-confusion"],
+		startedAt: new Date("2026-01-01T00:00:00.000Z"),
+		pluginConfig: { "alg-none": { target: "id_token" } },
+		warmupRequests: 2,
+	};
+
+	const entry: LedgerEntry = {
+		id: "entry_1",
+		requestId: "req_1",
+		timestamp: "2026-01-01T00:00:01.000Z",
+		plugin: { id: "alg-none", name: "Algorithm None", severity: "critical" },
+		spec: { requirement: "Signatures must be verified", violation: "Stripped", rfc: "RFC 8725" },
+		evidence: { mutation: "Stripped" },
+	};
+
+	function event(seq: number): SessionEvent {
+		return {
+			id: `evt_${seq}`,
+			sessionId: session.id,
+			type: "userinfo-served",
+			timestamp: "2026-01-01T00:00:01.000Z",
+			seq,
+			data: { seq },
+		};
+	}
+
+	it("should keep sessions, ledgers and events across reopening the file", () => {
+		store.saveSession(session);
+		store.saveLedgerEntry(session.id, entry);
+		store.saveEvent(event(1));
+		store.saveEvent(event(2));
+
+		const reopened = new JsonFileStore({ path: TEST_STORE_PATH });
+
+		expect(reopened.loadSession(session.id)).toEqual(session);
+		expect(reopened.loadLedgerEntries(session.id)).toEqual([entry]);
+		expect(reopened.loadEvents(session.id).map((e) => e.seq)).toEqual([1, 2]);
+		expect(existsSync(`${TEST_STORE_PATH}.tmp`)).toBe(false);
+	});
+
+	it("should keep issuances and the last token response, and delete them with the session", () => {
+		const issuance: TokenIssuance = {
+			tokenType: "id_token",
+			jti: null,
+			issuedAt: "2026-01-01T00:00:01.000Z",
+			mischief: [],
+			mutations: [],
+			changes: { header: [], claims: [] },
+			header: { alg: "RS256" },
+			signingKey: null,
+		};
+		store.saveSession(session);
+		store.saveIssuance(session.id, issuance);
+		store.saveLastTokenResponse(session.id, '{"id_token":"x"}');
+
+		const reopened = new JsonFileStore({ path: TEST_STORE_PATH });
+		expect(reopened.loadIssuances(session.id)).toEqual([issuance]);
+		expect(reopened.loadLastTokenResponse(session.id)).toBe('{"id_token":"x"}');
+
+		store.deleteSession(session.id);
+		expect(store.loadIssuances(session.id)).toEqual([]);
+		expect(store.loadLastTokenResponse(session.id)).toBeUndefined();
+	});
+
+	it("should list sessions most recently started first", () => {
+		store.saveSession(session);
+		store.saveSession({ ...session, id: "sess_later", startedAt: new Date("2026-02-01") });
+
+		expect(store.loadAllSessions().map((s) => s.id)).toEqual(["sess_later", "sess_json"]);
+	});
+
+	it("should delete rotated events by sequence number", () => {
+		for (const seq of [1, 2, 3]) {
+			store.saveEvent(event(seq));
+		}
+
+		store.deleteEventsThrough(session.id, 2);
+
+		expect(store.loadEvents(session.id).map((e) => e.seq)).toEqual([3]);
+	});
+
+	it("should delete a session with its ledger and events, and purge everything", () => {
+		store.saveSession(session);
+		store.saveLedgerEntry(session.id, entry);
+		store.saveEvent(event(1));
+
+		expect(store.deleteSession(session.id)).toBe(true);
+		expect(store.deleteSession(session.id)).toBe(false);
+		expect(store.loadLedgerEntries(session.id)).toEqual([]);
+		expect(store.loadEvents(session.id)).toEqual([]);
+
+		store.saveSession(session);
+		store.purgeAll();
+		expect(new JsonFileStore({ path: TEST_STORE_PATH }).loadAllSessions()).toEqual([]);
+	});
+
+	it("should refuse a file written in another layout", () => {
+		store.saveSession(session);
+		const data = JSON.parse(readFileSync(TEST_STORE_PATH, "utf8"));
+		writeFileSync(TEST_STORE_PATH, JSON.stringify({ ...data, version: 2 }));
+
+		expect(() => new JsonFileStore({ path: TEST_STORE_PATH })).toThrow(
+			"unsupported store file version 2",
+		);
+	});
+});
@@ -0,0 +1,49 @@
+import { describe, expect, it } from "vitest";
+import { acceptsGzip, jwksFetch, refusesJwksFetch } from "../../src/core/jwks-auth.js";
+
+describe("JWKS Auth", () => {
+	it("should authenticate fetches presenting the configured bearer token", () => {
+		const cases = [
+			{ authorization: "Bearer jwks-secret", authenticated: true },
+			{ authorization: "Bearer wrong", authenticated: false },
+			{ authorization: "Basic jwks-secret", authenticated: false },
+			{ authorization: undefined, authenticated: false },
+		];
+		for (const { authorization, authenticated } of cases) {
+			const headers = authorization === undefined ? {} : { authorization };
+			expect(jwksFetch(headers, "jwks-secret")).toEqual({
+				authenticated,
+				authRequired: true,
+				keySet: "real",
+			});
+		}
+	});
+
+	it("should not require auth without a token", () => {
+		const fetch = jwksFetch({ authorization: "Bearer anything" }, undefined);
+
+		expect(fetch).toEqual({ authenticated: false, authRequired: false, keySet: "real" });
+		expect(refusesJwksFetch(fetch)).toBe(false);
+	});
+
+	it("should refuse unauthenticated fetches only while they'd get the real keys", () => {
+		const fetch = jwksFetch({}, "jwks-secret");
+		expect(refusesJwksFetch(fetch)).toBe(true);
+
+		fetch.keySet = "decoy";
+		expect(refusesJwksFetch(fetch)).toBe(false);
+
+		const authenticated = jwksFetch({ authorization: "Bearer jwks-secret" }, "jwks-secret");
+		expect(refusesJwksFetch(authenticated)).toBe(false);
+	});
+
+	it("should accept gzip unless Accept-Encoding leaves it out or weighs it zero", () => {
+		expect(acceptsGzip(undefined)).toBe(true);
+		expect(acceptsGzip("gzip, deflate, br")).toBe(true);
+		expect(acceptsGzip("br;q=1.0, *;q=0.5")).toBe(true);
+		expect(acceptsGzip(["deflate", "x-gzip"])).toBe(true);
+		expect(acceptsGzip("identity")).toBe(false);
+		expect(acceptsGzip("")).toBe(false);
+		expect(acceptsGzip("gzip;q=0, *")).toBe(false);
+	});
+});
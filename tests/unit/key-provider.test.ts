@@ -0,0 +1,107 @@
+import { generateKeyPairSync } from "node:crypto";
+import { mkdtempSync, rmSync, writeFileSync } from "node:fs";
+import { tmpdir } from "node:os";
+import { join } from "node:path";
+import { afterAll, describe, expect, it } from "vitest";
+import {
+	EnvKeyProvider,
+	FileKeyProvider,
+	importPemSigningKey,
+	loadSigningKey,
+} from "../../src/core/key-provider.js";
+
+describe("Key Provider", () => {
+	const dir = mkdtempSync(join(tmpdir(), "loki-keys-"));
+	const rsa = generateKeyPairSync("rsa", { modulusLength: 2048 });
+	const ec = generateKeyPairSync("ec", { namedCurve: "P-256" });
+
+	afterAll(() => {
+		rmSync(dir, { recursive: true, force: true });
+	});
+
+	function writePem(name: string, pem: string): string {
+		const path = join(dir, name);
+		writeFileSync(path, pem);
+		return path;
+	}
+
+	it("should load an RSA PEM from a file as RS256, with the same kid each time", async () => {
+		const pem = rsa.privateKey.export({ format: "pem", type: "pkcs1" }) as string;
+		const provider = new FileKeyProvider(writePem("rsa.pem", pem));
+
+		const key = await loadSigningKey({ provider });
+		const again = await loadSigningKey({ provider });
+
+		expect(key.alg).toBe("RS256");
+		expect(key.publicJwk).toMatchObject({ kty: "RSA", kid: key.kid, alg: "RS256", use: "sig" });
+		expect(key.publicJwk.d).toBeUndefined();
+		expect(key.privateJwk.d).toBeDefined();
+		expect(again.kid).toBe(key.kid);
+	});
+
+	it("should load an EC PEM as ES256", async () => {
+		const pem = ec.privateKey.export({ format: "pem", type: "sec1" }) as string;
+
+		const key = await loadSigningKey({ provider: new FileKeyProvider(writePem("ec.pem", pem)) });
+
+		expect(key.alg).toBe("ES256");
+		expect(key.publicJwk).toMatchObject({ kty: "EC", crv: "P-256", kid: key.kid });
+	});
+
+	it("should pick the algorithm by EC curve and accept Ed25519", async () => {
+		const p384 = generateKeyPairSync("ec", { namedCurve: "P-384" }).privateKey;
+		const ed25519 = generateKeyPairSync("ed25519").privateKey;
+
+		const pem = (key: typeof p384) => key.export({ format: "pem", type: "pkcs8" }) as string;
+		expect((await importPemSigningKey(pem(p384))).alg).toBe("ES384");
+		expect((await importPemSigningKey(pem(ed25519))).alg).toBe("EdDSA");
+	});
+
+	it("should decrypt an encrypted PEM with its passphrase", async () => {
+		const pem = ec.privateKey.export({
+			format: "pem",
+			type: "pkcs8",
+			cipher: "aes-256-cbc",
+			passphrase: "correct horse",
+		}) as string;
+		const provider = new FileKeyProvider(writePem("ec-encrypted.pem", pem));
+		const plain = await importPemSigningKey(
+			ec.privateKey.export({ format: "pem", type: "pkcs8" }) as string,
+		);
+
+		const key = await loadSigningKey({ provider, passphrase: "correct horse" });
+
+		expect(key.kid).toBe(plain.kid);
+		await expect(loadSigningKey({ provider, passphrase: "wrong" })).rejects.toThrow(
+			/^Cannot load signing key from file .*ec-encrypted\.pem/,
+		);
+	});
+
+	it("should load the PEM from an environment variable", async () => {
+		const pem = rsa.privateKey.export({ format: "pem", type: "pkcs8" }) as string;
+		const provider = new EnvKeyProvider("SIGNING_PEM", { SIGNING_PEM: pem });
+
+		const key = await loadSigningKey({ provider });
+
+		expect(key.alg).toBe("RS256");
+		const unset = new EnvKeyProvider("SIGNING_PEM", {});
+		await expect(loadSigningKey({ provider: unset })).rejects.toThrow(
+			"Cannot load signing key from environment variable SIGNING_PEM: SIGNING_PEM is not set",
+		);
+	});
+
+	it("should refuse keys that can't sign tokens", async () => {
+		const small = generateKeyPairSync("rsa", { modulusLength: 1024 }).privateKey;
+		const secp256k1 = generateKeyPairSync("ec", { namedCurve: "secp256k1" }).privateKey;
+		const pem = (key: typeof small) => key.export({ format: "pem", type: "pkcs8" }) as string;
+
+		await expect(importPemSigningKey(pem(small))).rejects.toThrow("at least 2048 bits");
+		await expect(importPemSigningKey(pem(secp256k1))).rejects.toThrow("is not P-256");
+		await expect(
+			importPemSigningKey(rsa.publicKey.export({ format: "pem", type: "spki" }) as string),
+		).rejects.toThrow("not a PEM private key");
+		await expect(
+			loadSigningKey({ provider: new FileKeyProvider(join(dir, "missing.pem")) }),
+		).rejects.toThrow(/^Cannot load signing key from file .*missing\.pem: ENOENT/);
+	});
+});
@@ -0,0 +1,90 @@
+import { describe, expect, it } from "vitest";
+import { type LiveEventInput, LiveEventHub, tokenFingerprint } from "../../src/core/live-events.js";
+
+function issued(sessionId: string, jti: string): LiveEventInput {
+	return {
+		type: "token.issued",
+		sessionId,
+		requestId: null,
+		tokenType: "access_token",
+		jti,
+		mischief: [],
+		fingerprint: tokenFingerprint(jti),
+		details: {},
+	};
+}
+
+describe("LiveEventHub", () => {
+	it("should deliver a session's events to its watchers in order", async () => {
+		const hub = new LiveEventHub();
+		const first = hub.subscribe("sess_a");
+		const second = hub.subscribe("sess_a");
+		const other = hub.subscribe("sess_b");
+
+		hub.publish(issued("sess_a", "jti-1"));
+		hub.publish(issued("sess_a", "jti-2"));
+
+		for (const watcher of [first, second]) {
+			expect((await watcher.next(10))?.jti).toBe("jti-1");
+			const next = await watcher.next(10);
+			expect(next).toMatchObject({ jti: "jti-2", seq: 2 });
+			expect(typeof next?.timestamp).toBe("string");
+		}
+		expect(await other.next(10)).toBeNull();
+	});
+
+	it("should hand an event to a watcher already waiting", async () => {
+		const hub = new LiveEventHub();
+		const watcher = hub.subscribe("sess_a");
+
+		const next = watcher.next(1000);
+		hub.publish(issued("sess_a", "jti-1"));
+
+		expect((await next)?.jti).toBe("jti-1");
+	});
+
+	it("should keep nothing for sessions nobody watches", () => {
+		const hub = new LiveEventHub();
+
+		expect(hub.publish(issued("sess_a", "jti-1"))).toBeUndefined();
+		const watcher = hub.subscribe("sess_a");
+		expect(hub.publish(issued("sess_a", "jti-2"))?.seq).toBe(1);
+		watcher.close();
+		expect(hub.watcherCount()).toBe(0);
+	});
+
+	it("should drop the oldest events for a watcher that falls behind, and count them", async () => {
+		const hub = new LiveEventHub();
+		const watcher = hub.subscribe("sess_a", 2);
+
+		for (let i = 1; i <= 5; i++) {
+			hub.publish(issued("sess_a", `jti-${i}`));
+		}
+
+		expect((await watcher.next(10))?.jti).toBe("jti-4");
+		expect(watcher.takeDropped()).toBe(3);
+		expect(watcher.takeDropped()).toBe(0);
+		expect((await watcher.next(10))?.jti).toBe("jti-5");
+	});
+
+	it("should end a session's streams when it is cleared", async () => {
+		const hub = new LiveEventHub();
+		const watcher = hub.subscribe("sess_a");
+		const other = hub.subscribe("sess_b");
+
+		const next = watcher.next(1000);
+		hub.clear("sess_a");
+
+		expect(await next).toBeUndefined();
+		expect(await watcher.next(10)).toBeUndefined();
+		expect(hub.watcherCount("sess_a")).toBe(0);
+		expect(hub.watcherCount()).toBe(1);
+		hub.closeAll();
+		expect(await other.next(10)).toBeUndefined();
+		expect(hub.watcherCount()).toBe(0);
+	});
+
+	it("should refuse a buffer that can't hold an event", () => {
+		expect(() => new LiveEventHub().subscribe("sess_a", 0)).toThrow("positive integer");
+	});
+});
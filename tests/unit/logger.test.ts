@@ -0,0 +1,74 @@
+import { describe, expect, it } from "vitest";
+import { Logger, responseOutcome } from "../../src/core/logger.js";
+import { withRequestId } from "../../src/core/request-id.js";
+
+function capture(level?: "debug" | "info" | "warn" | "error" | "silent") {
+	const lines: Record<string, unknown>[] = [];
+	const options = {
+		write: (line: string) => lines.push(JSON.parse(line) as Record<string, unknown>),
+		now: () => new Date("2026-01-01T00:00:00.000Z"),
+	};
+	const logger = new Logger(level ? { ...options, level } : options);
+	return { logger, lines };
+}
+
+describe("Logger", () => {
+	it("should write one JSON object per line with time, level, message and fields", () => {
+		const { logger, lines } = capture();
+
+		logger.info("request", { endpoint: "/token", status: 200 });
+
+		expect(lines).toEqual([
+			{
+				time: "2026-01-01T00:00:00.000Z",
+				level: "info",
+				msg: "request",
+				endpoint: "/token",
+				status: 200,
+			},
+		]);
+	});
+
+	it("should drop lines below the configured level", () => {
+		const cases = [
+			{ level: "debug" as const, written: ["debug", "info", "warn", "error"] },
+			{ level: "warn" as const, written: ["warn", "error"] },
+			{ level: "silent" as const, written: [] },
+		];
+
+		for (const { level, written } of cases) {
+			const { logger, lines } = capture(level);
+			logger.debug("d");
+			logger.info("i");
+			logger.warn("w");
+			logger.error("e");
+
+			expect(lines.map((line) => line.level)).toEqual(written);
+			expect(logger.enabled("info")).toBe(written.includes("info"));
+		}
+	});
+
+	it("should stamp lines with the active request ID", () => {
+		const { logger, lines } = capture();
+
+		withRequestId("req_one", () => logger.info("inside"));
+		logger.info("outside");
+
+		expect(lines[0]?.requestId).toBe("req_one");
+		expect(lines[1]).not.toHaveProperty("requestId");
+	});
+
+	it("should classify how a request ended", () => {
+		const cases = [
+			{ statusCode: 200, writableFinished: true, outcome: "ok" },
+			{ statusCode: 302, writableFinished: true, outcome: "ok" },
+			{ statusCode: 401, writableFinished: true, outcome: "client-error" },
+			{ statusCode: 503, writableFinished: true, outcome: "server-error" },
+			{ statusCode: 200, writableFinished: false, outcome: "aborted" },
+		];
+
+		for (const { outcome, ...res } of cases) {
+			expect(responseOutcome(res)).toBe(outcome);
+		}
+	});
+});
@@ -34,7 +34,7 @@ describe("Loki", () => {
 
 			await loki.start();
 
-			expect(loki.plugins.count).toBe(36);
+			expect(loki.plugins.count).toBe(118);
 			expect(loki.plugins.has("alg-none")).toBe(true);
 			expect(loki.plugins.has("key-confusion")).toBe(true);
 			expect(loki.plugins.has("issuer-confusion")).toBe(true);
@@ -153,7 +153,7 @@ describe("Loki", () => {
 				}),
 			});
 
-			expect(loki.plugins.count).toBe(37);
+			expect(loki.plugins.count).toBe(119);
 			expect(loki.plugins.has("custom-mischief")).toBe(true);
 
 			await loki.stop();
@@ -168,7 +168,7 @@ describe("Loki", () => {
 			await loki.start();
 
 			const tokenSigningPlugins = loki.plugins.getByPhase("token-signing");
-			expect(tokenSigningPlugins).toHaveLength(11); // alg-none, key-confusion, kid-manipulation, token-type-confusion, weak-algorithms, jku-injection, x5u-injection, embedded-jwk-attack, crit-header-bypass, curve-confusion, jwks-domain-mismatch
+			expect(tokenSigningPlugins).toHaveLength(26); // alg-none, alg-none-partial, none-with-signature, signature-stripping, key-confusion, ec-key-confusion, kid-manipulation, token-type-confusion, typ-confusion, weak-algorithms, jku-injection, x5u-injection, x5c-injection, embedded-jwk-attack, crit-header-bypass, critical-header, curve-confusion, jwks-domain-mismatch, header-case, b64-false, kid-confusion, embedded-jwk, jwks-key-rotation-race, malformed-base64, disclosure-tampering, split-validity
 			expect(tokenSigningPlugins.map((p) => p.id)).toContain("alg-none");
 			expect(tokenSigningPlugins.map((p) => p.id)).toContain("key-confusion");
 			expect(tokenSigningPlugins.map((p) => p.id)).toContain("kid-manipulation");
@@ -186,7 +186,7 @@ describe("Loki", () => {
 			await loki.start();
 
 			const criticalPlugins = loki.plugins.getBySeverity("critical");
-			expect(criticalPlugins).toHaveLength(15); // includes new critical plugins: weak-algorithms, jku-injection, x5u-injection, embedded-jwk-attack, curve-confusion, jwks-domain-mismatch, iss-in-response-attack
+			expect(criticalPlugins).toHaveLength(32); // includes new critical plugins: cross-tenant-token, cross-tenant-iss, alg-none-partial, none-with-signature, signature-stripping, ec-key-confusion, weak-algorithms, jku-injection, x5u-injection, x5c-injection, embedded-jwk-attack, embedded-jwk, curve-confusion, jwks-domain-mismatch, iss-in-response-attack, userinfo-tampering, sub-tampering, scope-escalation, auth-context-spoof, disclosure-tampering
 
 			await loki.stop();
 		});
@@ -0,0 +1,48 @@
+import { describe, expect, it } from "vitest";
+import {
+	MaxAgeRequests,
+	authTimeHonors,
+	parseMaxAge,
+	requireLogin,
+	withoutMaxAge,
+} from "../../src/core/max-age.js";
+
+describe("Max Age", () => {
+	it("should parse non-negative integer max_age values only", () => {
+		expect(parseMaxAge("0")).toBe(0);
+		expect(parseMaxAge("300")).toBe(300);
+		expect(parseMaxAge("-1")).toBeUndefined();
+		expect(parseMaxAge("1.5")).toBeUndefined();
+		expect(parseMaxAge(undefined)).toBeUndefined();
+	});
+
+	it("should add login to the prompt once", () => {
+		expect(requireLogin("/auth?client_id=web&max_age=0")).toBe(
+			"/auth?client_id=web&max_age=0&prompt=login",
+		);
+		expect(requireLogin("/auth?prompt=consent")).toBe("/auth?prompt=consent+login");
+		expect(requireLogin("/auth?prompt=login")).toBe("/auth?prompt=login");
+	});
+
+	it("should strip max_age from the request", () => {
+		expect(withoutMaxAge("/auth?client_id=web&max_age=0")).toBe("/auth?client_id=web");
+	});
+
+	it("should honour max_age only with a recent enough auth_time", () => {
+		const request = { maxAge: 0, requestedAt: 1000, reauthForced: true };
+
+		expect(authTimeHonors(request, 1000)).toBe(true);
+		expect(authTimeHonors(request, 999)).toBe(false);
+		expect(authTimeHonors(request, undefined)).toBe(false);
+		expect(authTimeHonors({ ...request, maxAge: 60 }, 940)).toBe(true);
+	});
+
+	it("should hand each client's request to its next ID token only", () => {
+		const requests = new MaxAgeRequests();
+		requests.request("sess_a", "web", { maxAge: 0, requestedAt: 1000, reauthForced: true });
+
+		expect(requests.take("sess_a", "other")).toBeUndefined();
+		expect(requests.take("sess_a", "web")?.maxAge).toBe(0);
+		expect(requests.take("sess_a", "web")).toBeUndefined();
+	});
+});
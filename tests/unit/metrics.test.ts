@@ -0,0 +1,54 @@
+import { describe, expect, it } from "vitest";
+import { Metrics, endpointLabel } from "../../src/core/metrics.js";
+
+describe("Metrics", () => {
+	it("should label requests by endpoint name, never by raw path", () => {
+		expect(endpointLabel("/token")).toBe("token");
+		expect(endpointLabel("/token/introspection")).toBe("introspection");
+		expect(endpointLabel("/me?schema=openid")).toBe("userinfo");
+		expect(endpointLabel("/.well-known/jwks.json")).toBe("jwks");
+		expect(endpointLabel("/.well-known/openid-configuration")).toBe("discovery");
+		expect(endpointLabel("/admin/sessions/sess_abc123")).toBe("admin");
+		expect(endpointLabel("/interaction/xyz")).toBe("other");
+	});
+
+	it("should render issuance, mischief and session counters", () => {
+		const metrics = new Metrics();
+		metrics.countIssuance();
+		metrics.countIssuance();
+		metrics.countMischief("alg-none");
+		metrics.countMischief("alg-none");
+		metrics.countMischief('evil"plugin');
+		metrics.countEviction();
+		metrics.countChaos("alg-none");
+
+		const lines = metrics.render(3);
+
+		expect(lines).toContain("loki_tokens_issued_total 2");
+		expect(lines).toContain('loki_mischief_applied_total{mischief="alg-none"} 2');
+		expect(lines).toContain('loki_mischief_applied_total{mischief="evil\\"plugin"} 1');
+		expect(lines).toContain("loki_active_sessions 3");
+		expect(lines).toContain("loki_sessions_evicted_total 1");
+		expect(lines).toContain('loki_chaos_requests_total{mischief="alg-none"} 1');
+	});
+
+	it("should count requests by status and bucket their latencies", () => {
+		const metrics = new Metrics();
+		metrics.observeRequest("token", 200, 0.02);
+		metrics.observeRequest("token", 200, 0.3);
+		metrics.observeRequest("token", 400, 20);
+
+		const lines = metrics.render(0);
+
+		expect(lines).toContain('loki_http_requests_total{endpoint="token",status="200"} 2');
+		expect(lines).toContain('loki_http_requests_total{endpoint="token",status="400"} 1');
+		const name = "loki_http_request_duration_seconds";
+		expect(lines).toContain(`${name}_bucket{endpoint="token",le="0.01"} 0`);
+		expect(lines).toContain(`${name}_bucket{endpoint="token",le="0.025"} 1`);
+		expect(lines).toContain(`${name}_bucket{endpoint="token",le="0.5"} 2`);
+		expect(lines).toContain(`${name}_bucket{endpoint="token",le="10"} 2`);
+		expect(lines).toContain(`${name}_bucket{endpoint="token",le="+Inf"} 3`);
+		expect(lines).toContain(`${name}_count{endpoint="token"} 3`);
+		expect(lines).toContain(`${name}_sum{endpoint="token"} 20.32`);
+	});
+});
@@ -0,0 +1,65 @@
+import { describe, expect, it } from "vitest";
+import { mischiefCatalog } from "../../src/core/mischief-catalog.js";
+import { builtInPlugins } from "../../src/plugins/built-in/index.js";
+import type { MischiefPlugin } from "../../src/plugins/types.js";
+
+const plugin: MischiefPlugin = {
+	id: "test-claims",
+	name: "Test Claims",
+	severity: "medium",
+	phase: "token-claims",
+	description: "Adds a test claim",
+	spec: { rfc: "RFC 7519 Section 4", cwe: "CWE-345", description: "Claims must be validated" },
+	options: [
+		{ name: "claim", type: "string", default: "test", description: "The claim added" },
+		{ name: "value", type: ["string", "number"], description: "Its value" },
+	],
+	async apply() {
+		return { applied: false, mutation: "", evidence: {} };
+	},
+};
+
+describe("mischiefCatalog", () => {
+	it("should describe what a plugin affects, its options and its reference", () => {
+		const [entry] = mischiefCatalog([plugin]);
+
+		expect(entry).toEqual({
+			id: "test-claims",
+			name: "Test Claims",
+			description: "Adds a test claim",
+			severity: "medium",
+			phase: "token-claims",
+			affects: { surface: "token", segments: ["payload"], tokens: ["access_token", "id_token"] },
+			options: plugin.options,
+			reference: {
+				rfc: "RFC 7519 Section 4",
+				cwe: "CWE-345",
+				requirement: "Claims must be validated",
+			},
+			example: {
+				mode: "explicit",
+				mischief: ["test-claims"],
+				pluginConfig: { "test-claims": { claim: "test" } },
+			},
+		});
+	});
+
+	it("should leave pluginConfig out of the example when no option has a default", () => {
+		const { options: _, ...bare } = plugin;
+		const [entry] = mischiefCatalog([{ ...bare, phase: "discovery" }]);
+
+		expect(entry?.options).toEqual([]);
+		expect(entry?.affects).toEqual({ surface: "discovery" });
+		expect(entry?.example).toEqual({ mode: "explicit", mischief: ["test-claims"] });
+	});
+
+	it("should only give built-in options defaults among the values they accept", () => {
+		for (const entry of mischiefCatalog(builtInPlugins)) {
+			for (const option of entry.options) {
+				if (option.values && option.default !== undefined) {
+					expect(option.values, `${entry.id} ${option.name}`).toContain(option.default);
+				}
+			}
+		}
+	});
+});
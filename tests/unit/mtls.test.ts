@@ -0,0 +1,71 @@
+import { generateKeyPairSync } from "node:crypto";
+import { type Server, createServer, request } from "node:https";
+import type { AddressInfo } from "node:net";
+import { afterEach, describe, expect, it } from "vitest";
+import { bindCertificate, clientCertificateThumbprint } from "../../src/core/mtls.js";
+import { selfSignedCertificate } from "../../src/core/x509.js";
+
+/** A key pair and self-signed certificate, as PEM */
+function identity(commonName: string) {
+	const { privateKey } = generateKeyPairSync("ec", { namedCurve: "P-256" });
+	const cert = selfSignedCertificate({ privateKey, commonName });
+	return { cert, key: privateKey.export({ type: "pkcs8", format: "pem" }) as string };
+}
+
+let server: Server | undefined;
+
+afterEach(async () => {
+	await new Promise((resolve) => server?.close(resolve));
+	server = undefined;
+});
+
+describe("mTLS", () => {
+	it("should take the thumbprint of the certificate a client presents", async () => {
+		const serverIdentity = identity("localhost");
+		server = createServer(
+			{
+				cert: serverIdentity.cert.pem,
+				key: serverIdentity.key,
+				requestCert: true,
+				rejectUnauthorized: false,
+			},
+			(req, res) => res.end(clientCertificateThumbprint(req) ?? "none"),
+		);
+		await new Promise<void>((resolve) => server?.listen(0, "127.0.0.1", () => resolve()));
+		const { port } = server.address() as AddressInfo;
+
+		const fetchThumbprint = (client?: { cert: string; key: string }) =>
+			new Promise<string>((resolve, reject) => {
+				const req = request(
+					{ host: "127.0.0.1", port, rejectUnauthorized: false, ...client },
+					(res) => {
+						let body = "";
+						res.on("data", (chunk) => {
+							body += chunk;
+						});
+						res.on("end", () => resolve(body));
+					},
+				);
+				req.on("error", reject);
+				req.end();
+			});
+
+		const client = identity("client");
+		expect(await fetchThumbprint({ cert: client.cert.pem, key: client.key })).toBe(
+			client.cert.x5tS256,
+		);
+		expect(await fetchThumbprint()).toBe("none");
+	});
+
+	it("should bind claims to a certificate alongside other confirmation methods", () => {
+		const claims: Record<string, unknown> = { sub: "alice", cnf: { jkt: "dpop-key" } };
+
+		expect(bindCertificate(claims, "thumb")).toBe(true);
+		expect(claims.cnf).toEqual({ jkt: "dpop-key", "x5t#S256": "thumb" });
+		expect(bindCertificate(claims, "thumb")).toBe(false);
+
+		const unbound: Record<string, unknown> = {};
+		bindCertificate(unbound, "thumb");
+		expect(unbound.cnf).toEqual({ "x5t#S256": "thumb" });
+	});
+});
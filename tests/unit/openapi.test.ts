@@ -0,0 +1,85 @@
+import { describe, expect, it } from "vitest";
+import { ADMIN_OPERATIONS, openApiDocument } from "../../src/admin/openapi.js";
+import { type AdminDependencies, createAdminApi } from "../../src/admin/routes.js";
+
+type Document = {
+	paths: Record<string, Record<string, Record<string, unknown>>>;
+	components: { parameters: Record<string, { name: string; in: string }> };
+};
+
+const adminRoutes = createAdminApi({} as AdminDependencies).routes.filter(
+	(route) => route.method !== "ALL",
+);
+
+function document(): Document {
+	return openApiDocument({ issuer: "http://localhost:3000", adminRoutes }) as Document;
+}
+
+describe("OpenAPI document", () => {
+	it("should describe every route the admin API registers", () => {
+		const undescribed = adminRoutes
+			.map((route) => `${route.method} ${route.path}`)
+			.filter((key) => ADMIN_OPERATIONS[key] === undefined);
+
+		expect(undescribed).toEqual([]);
+	});
+
+	it("should not describe routes the admin API doesn't serve", () => {
+		const served = new Set(adminRoutes.map((route) => `${route.method} ${route.path}`));
+
+		expect(Object.keys(ADMIN_OPERATIONS).filter((key) => !served.has(key))).toEqual([]);
+	});
+
+	it("should use OpenAPI path templates and parameters for admin routes", () => {
+		const { paths } = document();
+		const cases = [
+			{ path: "/admin/sessions/{id}/report", method: "get", params: ["id"] },
+			{ path: "/admin/jwks/key-set/keys/{kid}", method: "delete", params: ["kid", "replace"] },
+			{ path: "/admin/sessions", method: "post", params: [] },
+		];
+
+		for (const { path, method, params } of cases) {
+			const operation = paths[path]?.[method];
+			expect(operation, `${method} ${path}`).toBeDefined();
+			const parameters = (operation?.parameters ?? []) as { name: string }[];
+			expect(parameters.map((p) => p.name)).toEqual(params);
+		}
+		expect(paths["/admin/sessions"]?.post?.requestBody).toBeDefined();
+		expect(Object.keys(paths["/admin/sessions"] ?? {}).sort()).toEqual(["delete", "get", "post"]);
+	});
+
+	it("should leave the rogue JWKS and chains open and require the admin token elsewhere", () => {
+		const { paths } = document();
+
+		expect(paths["/admin/rogue-jwks/{sessionId}"]?.get?.security).toEqual([]);
+		expect(paths["/admin/rogue-x5u/{sessionId}"]?.get?.security).toEqual([]);
+		expect(paths["/admin/sessions"]?.get?.security).toEqual([
+			{ adminToken: [] },
+			{ adminBasic: [] },
+		]);
+	});
+
+	it("should describe the OIDC endpoints with the session header", () => {
+		const { paths, components } = document();
+
+		expect(components.parameters.XLokiSession).toMatchObject({
+			name: "X-Loki-Session",
+			in: "header",
+		});
+		for (const path of ["/token", "/introspect", "/revoke"]) {
+			expect(paths[path]?.post?.parameters).toEqual([
+				{ $ref: "#/components/parameters/XLokiSession" },
+			]);
+		}
+		for (const path of ["/.well-known/openid-configuration", "/jwks"]) {
+			expect(paths[path]?.get?.parameters).toEqual([
+				{ $ref: "#/components/parameters/XLokiSession" },
+				{ $ref: "#/components/parameters/LokiSessionQuery" },
+			]);
+		}
+		expect(components.parameters.LokiSessionQuery).toMatchObject({
+			name: "loki_session",
+			in: "query",
+		});
+	});
+});
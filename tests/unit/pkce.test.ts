@@ -0,0 +1,77 @@
+import { describe, expect, it } from "vitest";
+import {
+	PkceBindings,
+	s256Challenge,
+	upgradePlainChallenge,
+	verifierMatches,
+} from "../../src/core/pkce.js";
+
+// RFC 7636 Appendix B verifier/challenge pair
+const VERIFIER = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk";
+const CHALLENGE = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM";
+
+describe("PKCE", () => {
+	it("should compute the S256 challenge", () => {
+		expect(s256Challenge(VERIFIER)).toBe(CHALLENGE);
+	});
+
+	it("should rewrite a plain challenge to S256", () => {
+		const url = upgradePlainChallenge(
+			`/auth?client_id=c&code_challenge=${VERIFIER}&code_challenge_method=plain`,
+		);
+		const params = new URLSearchParams(url?.split("?")[1]);
+
+		expect(url?.startsWith("/auth?")).toBe(true);
+		expect(params.get("client_id")).toBe("c");
+		expect(params.get("code_challenge")).toBe(CHALLENGE);
+		expect(params.get("code_challenge_method")).toBe("S256");
+	});
+
+	it("should treat an absent method as plain", () => {
+		const url = upgradePlainChallenge(`/auth?code_challenge=${VERIFIER}`);
+		expect(new URLSearchParams(url?.split("?")[1]).get("code_challenge")).toBe(CHALLENGE);
+	});
+
+	it("should leave S256 and challenge-less requests alone", () => {
+		expect(
+			upgradePlainChallenge(`/auth?code_challenge=${CHALLENGE}&code_challenge_method=S256`),
+		).toBeUndefined();
+		expect(upgradePlainChallenge("/auth?client_id=c")).toBeUndefined();
+	});
+
+	it("should stand in for a session's challenge with one Loki can answer", () => {
+		const bindings = new PkceBindings();
+		const substitute = bindings.bind("sess_1", CHALLENGE, "S256");
+		const binding = bindings.get(substitute);
+
+		expect(substitute).not.toBe(CHALLENGE);
+		expect(binding?.sessionId).toBe("sess_1");
+		expect(s256Challenge(binding?.verifier ?? "")).toBe(substitute);
+		expect(bindings.get(CHALLENGE)).toBeUndefined();
+	});
+
+	it("should check verifiers against the client's challenge and method", () => {
+		const bindings = new PkceBindings();
+		const s256 = bindings.get(bindings.bind("sess_1", CHALLENGE, "S256"));
+		const plain = bindings.get(bindings.bind("sess_1", VERIFIER, "plain"));
+		const cases: [typeof s256, string, boolean][] = [
+			[s256, VERIFIER, true],
+			[s256, CHALLENGE, false],
+			[plain, VERIFIER, true],
+			[plain, "wrong", false],
+		];
+		for (const [binding, verifier, expected] of cases) {
+			expect(binding && verifierMatches(binding, verifier)).toBe(expected);
+		}
+	});
+
+	it("should drop a session's bindings on clear", () => {
+		const bindings = new PkceBindings();
+		const kept = bindings.bind("sess_1", CHALLENGE, "S256");
+		const dropped = bindings.bind("sess_2", CHALLENGE, "S256");
+		bindings.clear("sess_2");
+
+		expect(bindings.get(kept)).toBeDefined();
+		expect(bindings.get(dropped)).toBeUndefined();
+	});
+});
@@ -43,7 +43,7 @@ export const testPlugin = {
 		await registry.discoverCustom();
 
 		expect(registry.has("test-custom-plugin")).toBe(true);
-		expect(registry.count).toBe(37); // 36 built-in + 1 custom
+		expect(registry.count).toBe(119); // 118 built-in + 1 custom
 	});
 
 	it("should load plugin with default export", async () => {
@@ -0,0 +1,68 @@
+import { describe, expect, it } from "vitest";
+import { MAX_SEED, drawMischief, randomSeed } from "../../src/core/probabilistic-draw.js";
+import type { Session } from "../../src/core/types.js";
+
+function probabilisticSession(probabilities: Record<string, number>, seed: number): Session {
+	return {
+		id: "sess_a",
+		mode: "probabilistic",
+		mischief: Object.keys(probabilities),
+		probabilities,
+		seed,
+		startedAt: new Date(),
+	};
+}
+
+function drawMany(session: Session, requests: number): string[][] {
+	return Array.from({ length: requests }, () => drawMischief(session));
+}
+
+describe("Probabilistic Draw", () => {
+	it("should draw the same mischief from the same seed", () => {
+		const probabilities = { "alg-none": 0.1, "aud-confusion": 0.25, "kid-confusion": 0.5 };
+		const first = drawMany(probabilisticSession(probabilities, 42), 50);
+		const second = drawMany(probabilisticSession(probabilities, 42), 50);
+		const other = drawMany(probabilisticSession(probabilities, 43), 50);
+
+		expect(second).toEqual(first);
+		expect(other).not.toEqual(first);
+	});
+
+	it("should never draw at 0 and always draw at 1", () => {
+		const session = probabilisticSession({ never: 0, always: 1 }, 7);
+
+		for (const drawn of drawMany(session, 20)) {
+			expect(drawn).toEqual(["always"]);
+		}
+	});
+
+	it("should draw each plugin at roughly its probability", () => {
+		const session = probabilisticSession({ "alg-none": 0.1, "aud-confusion": 0.25 }, 1);
+		const draws = drawMany(session, 10000).flat();
+
+		const rate = (id: string) => draws.filter((drawn) => drawn === id).length / 10000;
+		expect(rate("alg-none")).toBeCloseTo(0.1, 1);
+		expect(rate("aud-confusion")).toBeCloseTo(0.25, 1);
+	});
+
+	it("should continue from the session's generator state", () => {
+		const probabilities = { "alg-none": 0.5, "aud-confusion": 0.5 };
+		const all = drawMany(probabilisticSession(probabilities, 99), 10);
+		const interrupted = probabilisticSession(probabilities, 99);
+		drawMany(interrupted, 5);
+
+		// A session restored from storage keeps only its fields
+		const restored: Session = JSON.parse(JSON.stringify(interrupted));
+		expect(restored.randomState).toBeTypeOf("number");
+		expect(drawMany(restored, 5)).toEqual(all.slice(5));
+	});
+
+	it("should pick seeds in range", () => {
+		for (let i = 0; i < 20; i++) {
+			const seed = randomSeed();
+			expect(Number.isInteger(seed)).toBe(true);
+			expect(seed).toBeGreaterThanOrEqual(0);
+			expect(seed).toBeLessThanOrEqual(MAX_SEED);
+		}
+	});
+});
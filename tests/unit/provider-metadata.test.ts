@@ -0,0 +1,50 @@
+import { describe, expect, it } from "vitest";
+import { metadataDocumentAt, renderMetadata } from "../../src/core/provider-metadata.js";
+
+describe("Provider Metadata", () => {
+	const metadata = {
+		issuer: "https://loki.example",
+		authorization_endpoint: "https://loki.example/auth",
+		token_endpoint: "https://loki.example/token",
+		jwks_uri: "https://loki.example/jwks",
+		userinfo_endpoint: "https://loki.example/me",
+		revocation_endpoint: "https://loki.example/token/revocation",
+		introspection_endpoint: "https://loki.example/token/introspection",
+		id_token_signing_alg_values_supported: ["RS256"],
+		subject_types_supported: ["public"],
+		claims_supported: ["sub"],
+		end_session_endpoint: "https://loki.example/session/end",
+		code_challenge_methods_supported: ["S256"],
+		dpop_signing_alg_values_supported: ["ES256"],
+	};
+
+	it("should serve the OpenID document as is", () => {
+		expect(renderMetadata(metadata, "openid-configuration")).toEqual(metadata);
+	});
+
+	it("should leave OpenID-only members out of the RFC 8414 document", () => {
+		const rendered = renderMetadata(metadata, "oauth-authorization-server");
+
+		expect(Object.keys(rendered).sort()).toEqual([
+			"authorization_endpoint",
+			"code_challenge_methods_supported",
+			"dpop_signing_alg_values_supported",
+			"introspection_endpoint",
+			"issuer",
+			"jwks_uri",
+			"revocation_endpoint",
+			"token_endpoint",
+		]);
+	});
+
+	it("should find the document served at a path", () => {
+		const cases = [
+			["/.well-known/openid-configuration", "openid-configuration"],
+			["/.well-known/oauth-authorization-server", "oauth-authorization-server"],
+			["/jwks", undefined],
+		] as const;
+		for (const [path, document] of cases) {
+			expect(metadataDocumentAt(path)).toBe(document);
+		}
+	});
+});
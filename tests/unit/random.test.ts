@@ -0,0 +1,79 @@
+import { createPrivateKey, createPublicKey, sign, verify } from "node:crypto";
+import { afterEach, describe, expect, it } from "vitest";
+import {
+	isSeeded,
+	random,
+	randomBytes,
+	randomId,
+	randomUUID,
+	seedRandom,
+} from "../../src/core/random.js";
+import { seededPrivateJwk } from "../../src/core/seeded-keys.js";
+
+/** Draw one of everything, under `seed` */
+function draws(seed: string) {
+	const restore = seedRandom(seed);
+	try {
+		return [random(), randomBytes(8).toString("hex"), randomId(12), randomUUID()];
+	} finally {
+		restore();
+	}
+}
+
+describe("random", () => {
+	afterEach(() => {
+		seedRandom(undefined);
+	});
+
+	it("should repeat its choices for the same seed", () => {
+		expect(draws("ci-run-1")).toEqual(draws("ci-run-1"));
+		expect(draws("ci-run-1")).not.toEqual(draws("ci-run-2"));
+	});
+
+	it("should go back to the previous generator when restored", () => {
+		expect(isSeeded()).toBe(false);
+		const restore = seedRandom("ci-run-1");
+		expect(isSeeded()).toBe(true);
+		restore();
+		expect(isSeeded()).toBe(false);
+	});
+
+	it("should draw values shaped like unseeded ones", () => {
+		seedRandom("ci-run-1");
+
+		for (let i = 0; i < 100; i++) {
+			const value = random();
+			expect(value).toBeGreaterThanOrEqual(0);
+			expect(value).toBeLessThan(1);
+		}
+		expect(randomId(21)).toMatch(/^[A-Za-z0-9_-]{21}$/);
+		expect(randomUUID()).toMatch(/^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-/);
+	});
+
+	it("should derive the same working keys from the same seed", () => {
+		const keyTypes: [string, string | undefined][] = [
+			["EC", "P-256"],
+			["EC", "P-521"],
+			["OKP", "Ed25519"],
+			["RSA", undefined],
+		];
+		for (const [kty, crv] of keyTypes) {
+			const derive = () => {
+				const restore = seedRandom("ci-run-1");
+				try {
+					return seededPrivateJwk(kty, crv);
+				} finally {
+					restore();
+				}
+			};
+			const jwk = derive();
+
+			expect(derive()).toEqual(jwk);
+			const privateKey = createPrivateKey({ key: jwk, format: "jwk" });
+			const algorithm = kty === "OKP" ? null : "sha256";
+			const signature = sign(algorithm, Buffer.from("loki"), privateKey);
+			const publicKey = createPublicKey(privateKey);
+			expect(verify(algorithm, Buffer.from("loki"), publicKey, signature)).toBe(true);
+		}
+	});
+});
@@ -0,0 +1,23 @@
+import { describe, expect, it } from "vitest";
+import { readinessReport } from "../../src/core/readiness.js";
+
+describe("Readiness", () => {
+	it("should be ready when every component is ready or disabled", () => {
+		const components = {
+			signingKeys: { status: "ready" as const },
+			sessionStore: { status: "disabled" as const },
+		};
+		expect(readinessReport(components)).toEqual({ status: "ready", components });
+	});
+
+	it("should not be ready while any component is pending or down", () => {
+		for (const status of ["pending", "down"] as const) {
+			const report = readinessReport({
+				signingKeys: { status: "ready" },
+				sessionStore: { status, store: "redis" },
+			});
+			expect(report.status).toBe("not_ready");
+			expect(report.components.sessionStore).toEqual({ status, store: "redis" });
+		}
+	});
+});
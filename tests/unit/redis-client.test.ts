@@ -0,0 +1,228 @@
+import { type Server, type Socket, createServer } from "node:net";
+import { afterEach, describe, expect, it } from "vitest";
+import {
+	RedisClient,
+	RedisError,
+	RespParser,
+	encodeCommand,
+	parseRedisAddr,
+} from "../../src/persistence/redis-client.js";
+
+/**
+ * A Redis that answers PING, checks AUTH, and can go away and come back on its port
+ */
+class FakeRedis {
+	port = 0;
+	connections = 0;
+	private server: Server | undefined;
+	private readonly sockets = new Set<Socket>();
+
+	constructor(private readonly password?: string) {}
+
+	async start(): Promise<void> {
+		const server = createServer((socket) => {
+			this.connections++;
+			this.sockets.add(socket);
+			const parser = new RespParser();
+			let authenticated = this.password === undefined;
+			socket.on("data", (chunk) => {
+				for (const [name, ...args] of parser.push(chunk) as string[][]) {
+					if (name === "AUTH") {
+						authenticated = args.at(-1) === this.password;
+						socket.write(authenticated ? "+OK\r\n" : "-WRONGPASS invalid password\r\n");
+					} else {
+						socket.write(authenticated ? "+PONG\r\n" : "-NOAUTH Authentication required\r\n");
+					}
+				}
+			});
+			socket.on("close", () => this.sockets.delete(socket));
+			socket.on("error", () => {});
+		});
+		await new Promise<void>((resolve) => server.listen(this.port, "127.0.0.1", () => resolve()));
+		const address = server.address();
+		this.port = typeof address === "object" && address ? address.port : 0;
+		this.server = server;
+	}
+
+	/** Stop listening and drop every connection */
+	stop(): Promise<void> {
+		for (const socket of this.sockets) {
+			socket.destroy();
+		}
+		return new Promise((resolve) => {
+			if (this.server) {
+				this.server.close(() => resolve());
+			} else {
+				resolve();
+			}
+		});
+	}
+}
+
+async function until(condition: () => boolean): Promise<void> {
+	while (!condition()) {
+		await new Promise((resolve) => setTimeout(resolve, 5));
+	}
+}
+
+describe("Redis Client", () => {
+	describe("encodeCommand", () => {
+		it("should encode a command as an array of bulk strings, counting bytes", () => {
+			expect(encodeCommand(["SET", "k", "héllo"]).toString()).toBe(
+				"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$6\r\nhéllo\r\n",
+			);
+		});
+	});
+
+	describe("RespParser", () => {
+		const cases = [
+			{ name: "simple string", wire: "+OK\r\n", reply: "OK" },
+			{ name: "integer", wire: ":42\r\n", reply: 42 },
+			{ name: "bulk string", wire: "$5\r\nhello\r\n", reply: "hello" },
+			{ name: "bulk string with CRLF inside", wire: "$4\r\na\r\nb\r\n", reply: "a\r\nb" },
+			{ name: "nil bulk string", wire: "$-1\r\n", reply: null },
+			{ name: "nil array", wire: "*-1\r\n", reply: null },
+			{ name: "empty array", wire: "*0\r\n", reply: [] },
+			{ name: "nested array", wire: "*2\r\n$1\r\na\r\n*1\r\n:1\r\n", reply: ["a", [1]] },
+		];
+
+		for (const { name, wire, reply } of cases) {
+			it(`should parse a ${name}`, () => {
+				expect(new RespParser().push(Buffer.from(wire))).toEqual([reply]);
+			});
+		}
+
+		it("should parse error replies as RedisError", () => {
+			const [reply] = new RespParser().push(Buffer.from("-WRONGTYPE bad key\r\n"));
+
+			expect(reply).toBeInstanceOf(RedisError);
+			expect((reply as RedisError).message).toBe("WRONGTYPE bad key");
+		});
+
+		it("should wait for a reply split across chunks", () => {
+			const parser = new RespParser();
+
+			expect(parser.push(Buffer.from("*2\r\n$5\r\nhel"))).toEqual([]);
+			expect(parser.push(Buffer.from("lo\r\n:7"))).toEqual([]);
+			expect(parser.push(Buffer.from("\r\n+OK\r\n"))).toEqual([["hello", 7], "OK"]);
+		});
+
+		it("should reject an unknown reply type", () => {
+			expect(() => new RespParser().push(Buffer.from("?what\r\n"))).toThrow(
+				"Unexpected RESP reply type '?'",
+			);
+		});
+	});
+
+	describe("parseRedisAddr", () => {
+		const cases = [
+			{ addr: "redis.internal:6380", host: "redis.internal", port: 6380 },
+			{ addr: "redis://10.0.0.5:6379", host: "10.0.0.5", port: 6379 },
+			{ addr: "localhost", host: "localhost", port: 6379 },
+			{ addr: "[::1]:7000", host: "::1", port: 7000 },
+		];
+
+		for (const { addr, host, port } of cases) {
+			it(`should parse ${addr}`, () => {
+				expect(parseRedisAddr(addr)).toEqual({ host, port });
+			});
+		}
+
+		it("should parse credentials and TLS", () => {
+			expect(parseRedisAddr("redis://:s%40cret@redis.internal")).toEqual({
+				host: "redis.internal",
+				port: 6379,
+				password: "s@cret",
+			});
+			expect(parseRedisAddr("rediss://loki:pw@redis.internal:6380")).toEqual({
+				host: "redis.internal",
+				port: 6380,
+				tls: true,
+				username: "loki",
+				password: "pw",
+			});
+		});
+
+		it("should reject an address without a usable port", () => {
+			expect(() => parseRedisAddr("redis:0")).toThrow("invalid port");
+			expect(() => parseRedisAddr("a:b:c")).toThrow("must be host:port");
+		});
+
+		it("should reject credentials without a password, and never echo them", () => {
+			expect(() => parseRedisAddr("redis://loki@redis.internal")).toThrow("[user]:password");
+			expect(() => parseRedisAddr("redis://:hunter2@a:b:c")).toThrow(
+				"must be host:port, got 'redis://a:b:c'",
+			);
+		});
+	});
+
+	describe("RedisClient", () => {
+		let client: RedisClient | undefined;
+		let redis: FakeRedis | undefined;
+
+		afterEach(async () => {
+			client?.close();
+			await redis?.stop();
+			client = undefined;
+			redis = undefined;
+		});
+
+		it("should reconnect after the connection is killed, then send queued commands", async () => {
+			redis = new FakeRedis();
+			await redis.start();
+			client = await RedisClient.connect(`127.0.0.1:${redis.port}`, { reconnectDelayMs: 10 });
+			expect(await client.command("PING")).toBe("PONG");
+
+			await redis.stop();
+			await until(() => !client?.connected);
+			const ping = client.command("PING");
+
+			await redis.start();
+			expect(await ping).toBe("PONG");
+			expect(client.connected).toBe(true);
+			expect(redis.connections).toBe(2);
+		});
+
+		it("should authenticate every connection it opens", async () => {
+			redis = new FakeRedis("hunter2");
+			await redis.start();
+			client = await RedisClient.connect(`redis://:hunter2@127.0.0.1:${redis.port}`, {
+				reconnectDelayMs: 10,
+			});
+			expect(await client.command("PING")).toBe("PONG");
+
+			await redis.stop();
+			await until(() => !client?.connected);
+			await redis.start();
+			await until(() => client?.connected === true);
+			expect(await client.command("PING")).toBe("PONG");
+		});
+
+		it("should fail to connect with the wrong password, without echoing it", async () => {
+			redis = new FakeRedis("hunter2");
+			await redis.start();
+			const err = await RedisClient.connect(`redis://:wrong@127.0.0.1:${redis.port}`).catch(
+				(e: Error) => e,
+			);
+
+			expect(err).toBeInstanceOf(Error);
+			expect((err as Error).message).toBe(
+				`Cannot authenticate to Redis at 127.0.0.1:${redis.port}: WRONGPASS invalid password`,
+			);
+		});
+
+		it("should stop reconnecting once closed", async () => {
+			redis = new FakeRedis();
+			await redis.start();
+			client = await RedisClient.connect(`127.0.0.1:${redis.port}`, { reconnectDelayMs: 10 });
+			client.close();
+			await redis.stop();
+			await redis.start();
+			await new Promise((resolve) => setTimeout(resolve, 50));
+
+			expect(client.connected).toBe(false);
+			expect(redis.connections).toBe(1);
+			await expect(client.command("PING")).rejects.toThrow("closed");
+		});
+	});
+});
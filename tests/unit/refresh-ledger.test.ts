@@ -0,0 +1,66 @@
+import { describe, expect, it } from "vitest";
+import { RefreshLedger, isOpaqueRefreshToken } from "../../src/core/refresh-ledger.js";
+
+describe("Refresh Ledger", () => {
+	it("should tell opaque refresh tokens from JWTs", () => {
+		expect(isOpaqueRefreshToken("m3bFcFJ-t5UZ4qjVHJ0bRd8hjLq")).toBe(true);
+		expect(isOpaqueRefreshToken("eyJhbGciOiJSUzI1NiJ9.e30.sig")).toBe(false);
+		expect(isOpaqueRefreshToken("")).toBe(false);
+	});
+
+	it("should follow a rotation chain to the current token", () => {
+		const ledger = new RefreshLedger();
+		ledger.rotate("sess_a", "rt-1", "rt-2");
+		ledger.rotate("sess_a", "rt-2", "rt-3");
+
+		expect(ledger.currentFor("sess_a", "rt-1")).toBe("rt-3");
+		expect(ledger.currentFor("sess_a", "rt-2")).toBe("rt-3");
+		expect(ledger.currentFor("sess_a", "rt-3")).toBeUndefined();
+		expect(ledger.currentFor("sess_b", "rt-1")).toBeUndefined();
+	});
+
+	it("should report rotations and reuses", () => {
+		const ledger = new RefreshLedger();
+		ledger.rotate("sess_a", "rt-1", "rt-2");
+		ledger.recordReuse("sess_a", "rt-1", "rt-2", false);
+
+		const report = ledger.getReport("sess_a");
+		expect(report.sessionId).toBe("sess_a");
+		expect(report.rotations).toEqual([{ from: "rt-1", to: "rt-2", rotatedAt: expect.any(String) }]);
+		expect(report.reuses).toEqual([
+			{ token: "rt-1", current: "rt-2", accepted: false, detectedAt: expect.any(String) },
+		]);
+	});
+
+	it("should ignore a refresh that returned the same token", () => {
+		const ledger = new RefreshLedger();
+		ledger.rotate("sess_a", "rt-1", "rt-1");
+
+		expect(ledger.getReport("sess_a").rotations).toEqual([]);
+		expect(ledger.currentFor("sess_a", "rt-1")).toBeUndefined();
+	});
+
+	it("should bind issued tokens to the session that issued them", () => {
+		const ledger = new RefreshLedger();
+		ledger.issue("sess_a", "rt-1");
+		ledger.issue("sess_b", "rt-1");
+		ledger.issue("sess_b", "rt-2");
+
+		expect(ledger.sessionFor("rt-1")).toBe("sess_a");
+		expect(ledger.sessionFor("rt-2")).toBe("sess_b");
+		expect(ledger.sessionFor("rt-3")).toBeUndefined();
+	});
+
+	it("should forget a cleared session", () => {
+		const ledger = new RefreshLedger();
+		ledger.issue("sess_a", "rt-1");
+		ledger.issue("sess_b", "rt-9");
+		ledger.rotate("sess_a", "rt-1", "rt-2");
+		ledger.clear("sess_a");
+
+		expect(ledger.currentFor("sess_a", "rt-1")).toBeUndefined();
+		expect(ledger.getReport("sess_a").rotations).toEqual([]);
+		expect(ledger.sessionFor("rt-1")).toBeUndefined();
+		expect(ledger.sessionFor("rt-9")).toBe("sess_b");
+	});
+});
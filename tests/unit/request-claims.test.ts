@@ -0,0 +1,69 @@
+import { describe, expect, it } from "vitest";
+import {
+	ClaimsRequests,
+	claimsDelivery,
+	essentialClaims,
+	parseClaimsRequest,
+	withRequestedClaims,
+} from "../../src/core/request-claims.js";
+
+describe("Request Claims", () => {
+	it("should read the id_token and userinfo members", () => {
+		const request = parseClaimsRequest(
+			JSON.stringify({
+				id_token: { email: { essential: true }, auth_time: null },
+				userinfo: { name: null, picture: { values: ["a", "b"] } },
+				unknown_member: { ignored: true },
+			}),
+		);
+		expect(request).toEqual({
+			idToken: { email: { essential: true }, auth_time: {} },
+			userinfo: { name: {}, picture: { values: ["a", "b"] } },
+		});
+		expect(parseClaimsRequest("{}")).toEqual({ idToken: {}, userinfo: {} });
+	});
+
+	it("should say why a claims request is invalid", () => {
+		expect(parseClaimsRequest("not json")).toBe("claims must be a JSON object");
+		expect(parseClaimsRequest("[]")).toBe("claims must be a JSON object");
+		expect(parseClaimsRequest('{"id_token": []}')).toBe("claims.id_token must be an object");
+		expect(parseClaimsRequest('{"userinfo": {"email": true}}')).toBe(
+			"claims.userinfo.email must be null or an object",
+		);
+		expect(parseClaimsRequest('{"id_token": {"email": {"essential": "yes"}}}')).toBe(
+			"claims.id_token.email.essential must be a boolean",
+		);
+		expect(parseClaimsRequest('{"id_token": {"acr": {"values": "urn:acr:1"}}}')).toBe(
+			"claims.id_token.acr.values must be an array",
+		);
+	});
+
+	it("should add the requested claims the account holds, and report which arrived", () => {
+		const requested = { email: { essential: true }, name: {}, phone_number: { essential: true } };
+		expect(essentialClaims(requested)).toEqual(["email", "phone_number"]);
+
+		const account = { sub: "alice", email: "alice@loki.test", name: "Alice" };
+		const claims = withRequestedClaims({ sub: "alice", name: "Kept" }, account, requested);
+		expect(claims).toEqual({ sub: "alice", name: "Kept", email: "alice@loki.test" });
+
+		expect(claimsDelivery(requested, claims)).toEqual({
+			requested: ["email", "name", "phone_number"],
+			essential: ["email", "phone_number"],
+			delivered: ["email", "name"],
+		});
+	});
+
+	it("should keep each client's latest claims request until it sends another", () => {
+		const requests = new ClaimsRequests();
+		const request = { idToken: { email: {} }, userinfo: {} };
+		requests.request("sess_a", "web", request);
+
+		expect(requests.get("sess_a", "web")).toBe(request);
+		expect(requests.get("sess_a", "web")).toBe(request);
+		expect(requests.get("sess_a", "other")).toBeUndefined();
+		expect(requests.get("sess_b", "web")).toBeUndefined();
+
+		requests.request("sess_a", "web", undefined);
+		expect(requests.get("sess_a", "web")).toBeUndefined();
+	});
+});
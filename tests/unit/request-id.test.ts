@@ -0,0 +1,56 @@
+import type { IncomingMessage } from "node:http";
+import { describe, expect, it } from "vitest";
+import { EventLog } from "../../src/core/event-log.js";
+import {
+	activeRequestId,
+	currentRequestId,
+	resolveRequestId,
+	withRequestId,
+} from "../../src/core/request-id.js";
+import { TokenResults } from "../../src/core/token-results.js";
+
+function request(headers: Record<string, string | string[]>): IncomingMessage {
+	return { headers } as unknown as IncomingMessage;
+}
+
+describe("Request ID", () => {
+	it("should honor a usable X-Request-ID and replace anything else", () => {
+		expect(resolveRequestId(request({ "x-request-id": "client-42" }))).toBe("client-42");
+		expect(resolveRequestId(request({ "x-loki-request-id": "client-43" }))).toBe("client-43");
+
+		const unusable = [{}, { "x-request-id": "" }, { "x-request-id": "has space" }];
+		for (const headers of [...unusable, { "x-request-id": "x".repeat(129) }]) {
+			expect(resolveRequestId(request(headers))).toMatch(/^req_[\w-]{12}$/);
+		}
+	});
+
+	it("should carry the ID through async work", async () => {
+		expect(activeRequestId()).toBeUndefined();
+
+		const seen = await withRequestId("req_one", async () => {
+			await new Promise((resolve) => setTimeout(resolve, 1));
+			return currentRequestId();
+		});
+
+		expect(seen).toBe("req_one");
+		expect(currentRequestId()).not.toBe("req_one");
+	});
+
+	it("should stamp events and issued tokens with the active ID", () => {
+		const events = new EventLog();
+		const tokens = new TokenResults();
+
+		withRequestId("req_one", () => {
+			events.record("sess_a", "token-reported", {});
+			tokens.issue("sess_a", "jti-1", "access_token", ["alg-none"]);
+		});
+		events.record("sess_a", "token-reported", {});
+
+		expect(events.findByRequest("req_one")).toHaveLength(1);
+		expect(events.list("sess_a")[1]?.requestId).toBeUndefined();
+		expect(tokens.findByRequest("req_one")).toEqual([
+			expect.objectContaining({ sessionId: "sess_a", jti: "jti-1", requestId: "req_one" }),
+		]);
+		expect(tokens.findByRequest("req_two")).toEqual([]);
+	});
+});
@@ -0,0 +1,25 @@
+import { describe, expect, it } from "vitest";
+import { NonceRequests } from "../../src/core/request-nonce.js";
+
+describe("Request Nonce", () => {
+	it("should hand out each client's nonce once", () => {
+		const requests = new NonceRequests();
+		requests.request("sess_a", "web", "n-0S6_WzA2Mj");
+
+		expect(requests.take("sess_a", "other")).toBeUndefined();
+		expect(requests.take("sess_b", "web")).toBeUndefined();
+		expect(requests.take("sess_a", "web")).toBe("n-0S6_WzA2Mj");
+		expect(requests.take("sess_a", "web")).toBeUndefined();
+	});
+
+	it("should keep only the latest request's nonce", () => {
+		const requests = new NonceRequests();
+		requests.request("sess_a", "web", "first");
+		requests.request("sess_a", "web", "second");
+		expect(requests.take("sess_a", "web")).toBe("second");
+
+		requests.request("sess_a", "web", "first");
+		requests.request("sess_a", "web", undefined);
+		expect(requests.take("sess_a", "web")).toBeUndefined();
+	});
+});
@@ -0,0 +1,43 @@
+import * as jose from "jose";
+import { describe, expect, it } from "vitest";
+import { RequestObjectReplayCache, requestObjectJti } from "../../src/core/request-object.js";
+
+describe("Request Objects", () => {
+	const secret = new TextEncoder().encode("a-client-secret-long-enough-for-hs256");
+
+	describe("requestObjectJti", () => {
+		it("should read the jti of a signed request object", async () => {
+			const jwt = await new jose.SignJWT({ client_id: "c" })
+				.setProtectedHeader({ alg: "HS256" })
+				.setJti("jti-1")
+				.sign(secret);
+
+			expect(requestObjectJti(jwt)).toBe("jti-1");
+		});
+
+		it("should ignore unsigned and malformed request objects", () => {
+			const unsigned = new jose.UnsecuredJWT({ client_id: "c" }).setJti("jti-1").encode();
+
+			expect(requestObjectJti(unsigned)).toBeUndefined();
+			expect(requestObjectJti("not-a-jwt")).toBeUndefined();
+		});
+	});
+
+	describe("RequestObjectReplayCache", () => {
+		it("should report a jti reused within a session", () => {
+			const cache = new RequestObjectReplayCache();
+
+			expect(cache.use("sess_a", "jti-1")).toBe(false);
+			expect(cache.use("sess_a", "jti-1")).toBe(true);
+			expect(cache.use("sess_b", "jti-1")).toBe(false);
+		});
+
+		it("should forget a cleared session", () => {
+			const cache = new RequestObjectReplayCache();
+			cache.use("sess_a", "jti-1");
+			cache.clear("sess_a");
+
+			expect(cache.use("sess_a", "jti-1")).toBe(false);
+		});
+	});
+});
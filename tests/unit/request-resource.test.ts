@@ -0,0 +1,52 @@
+import { describe, expect, it } from "vitest";
+import {
+	ResourceRequests,
+	invalidResource,
+	parseResources,
+	resourceAudience,
+	withoutResources,
+} from "../../src/core/request-resource.js";
+
+describe("Request Resource", () => {
+	it("should collect every resource parameter, each once, in order", () => {
+		const form = new URLSearchParams({ grant_type: "client_credentials" });
+		for (const resource of ["https://a.example", "https://b.example", "https://a.example"]) {
+			form.append("resource", resource);
+		}
+		const body = Buffer.from(form.toString());
+		expect(parseResources(body)).toEqual(["https://a.example", "https://b.example"]);
+		expect(parseResources(Buffer.from("grant_type=client_credentials"))).toEqual([]);
+	});
+
+	it("should drop resource parameters and keep the rest", () => {
+		const body = Buffer.from("grant_type=refresh_token&resource=urn%3Aa&scope=x");
+		expect(withoutResources(body).toString()).toBe("grant_type=refresh_token&scope=x");
+	});
+
+	it("should find resources that aren't absolute URIs without a fragment", () => {
+		expect(invalidResource(["https://a.example/api", "urn:example:api"])).toBeUndefined();
+		expect(invalidResource(["https://a.example", "/relative"])).toBe("/relative");
+		expect(invalidResource(["https://a.example/api#frag"])).toBe("https://a.example/api#frag");
+	});
+
+	it("should issue one resource as a string and several as an array", () => {
+		expect(resourceAudience(["https://a.example"])).toBe("https://a.example");
+		expect(resourceAudience(["https://a.example", "https://b.example"])).toEqual([
+			"https://a.example",
+			"https://b.example",
+		]);
+	});
+
+	it("should hand out each client's resources once", () => {
+		const requests = new ResourceRequests();
+		requests.request("sess_a", "web", ["https://a.example"]);
+
+		expect(requests.take("sess_a", "other")).toBeUndefined();
+		expect(requests.take("sess_a", "web")).toEqual(["https://a.example"]);
+		expect(requests.take("sess_a", "web")).toBeUndefined();
+
+		requests.request("sess_a", "web", ["https://a.example"]);
+		requests.request("sess_a", "web", []);
+		expect(requests.take("sess_a", "web")).toBeUndefined();
+	});
+});
@@ -0,0 +1,30 @@
+import { describe, expect, it } from "vitest";
+import { ScopeRequests, parseScope } from "../../src/core/request-scope.js";
+
+describe("Request Scope", () => {
+	it("should split a scope parameter into distinct scopes, in order", () => {
+		expect(parseScope("openid  orders:read openid Orders:read")).toEqual([
+			"openid",
+			"orders:read",
+			"Orders:read",
+		]);
+		expect(parseScope("")).toEqual([]);
+	});
+
+	it("should hand out each client's scopes once", () => {
+		const requests = new ScopeRequests();
+		requests.request("sess_a", "web", ["openid", "admin"]);
+
+		expect(requests.take("sess_a", "other")).toBeUndefined();
+		expect(requests.take("sess_b", "web")).toBeUndefined();
+		expect(requests.take("sess_a", "web")).toEqual(["openid", "admin"]);
+		expect(requests.take("sess_a", "web")).toBeUndefined();
+	});
+
+	it("should forget earlier scopes when a request asks for none", () => {
+		const requests = new ScopeRequests();
+		requests.request("sess_a", "web", ["admin"]);
+		requests.request("sess_a", "web", []);
+		expect(requests.take("sess_a", "web")).toBeUndefined();
+	});
+});
@@ -0,0 +1,83 @@
+import * as jose from "jose";
+import { beforeAll, describe, expect, it } from "vitest";
+import { type ManagedKey, generateSigningKey } from "../../src/core/key-manager.js";
+import { RevocationList, tokenIdentifier } from "../../src/core/revocation-list.js";
+
+const ISSUER = "http://localhost:3000";
+
+describe("RevocationList", () => {
+	let key: ManagedKey;
+	let now: number;
+
+	beforeAll(async () => {
+		key = await generateSigningKey("RS256");
+	});
+
+	function createList(): RevocationList {
+		now = Date.parse("2026-01-01T00:00:00Z");
+		return new RevocationList({ issuer: ISSUER, getSigningKey: () => key, now: () => now });
+	}
+
+	it("should publish revoked jtis immediately by default", async () => {
+		const list = createList();
+		list.revoke("jti-1", "sess_a");
+
+		const { contentType, body } = await list.render("json");
+		expect(contentType).toBe("application/json");
+		expect(JSON.parse(body).revoked).toEqual([{ jti: "jti-1", revoked_at: now / 1000 }]);
+		expect(list.getReport().listed).toHaveLength(1);
+	});
+
+	it("should keep omitted jtis off the list and report them", async () => {
+		const list = createList();
+		list.revoke("jti-listed", "sess_a");
+		list.revoke("jti-omitted", "sess_b", null);
+
+		expect(list.published().map((r) => r.jti)).toEqual(["jti-listed"]);
+
+		const report = list.getReport();
+		expect(report.listed.map((r) => r.jti)).toEqual(["jti-listed"]);
+		expect(report.omitted).toEqual([
+			{
+				jti: "jti-omitted",
+				revokedAt: new Date(now).toISOString(),
+				sessionId: "sess_b",
+				listedFrom: null,
+			},
+		]);
+		expect(list.getReport("sess_a").omitted).toEqual([]);
+	});
+
+	it("should list delayed jtis once the delay has passed", () => {
+		const list = createList();
+		list.revoke("jti-delayed", undefined, 60);
+
+		expect(list.published()).toHaveLength(0);
+		now += 60_000;
+		expect(list.published().map((r) => r.jti)).toEqual(["jti-delayed"]);
+	});
+
+	it("should sign the list in jwt format", async () => {
+		const list = createList();
+		list.revoke("jti-1");
+
+		const { contentType, body } = await list.render("jwt");
+		expect(contentType).toBe("application/jwt");
+
+		const { payload, protectedHeader } = await jose.jwtVerify(body, key.publicKey, {
+			currentDate: new Date(now),
+		});
+		expect(protectedHeader.typ).toBe("revocation-list+jwt");
+		expect(payload.iss).toBe(ISSUER);
+		expect(payload.revoked).toEqual([{ jti: "jti-1", revoked_at: now / 1000 }]);
+	});
+
+	it("should identify JWTs by jti and opaque tokens by value", async () => {
+		const jwt = await new jose.SignJWT({ jti: "abc" })
+			.setProtectedHeader({ alg: "RS256" })
+			.sign(key.privateKey);
+
+		expect(tokenIdentifier(jwt)).toBe("abc");
+		expect(tokenIdentifier("opaque-token")).toBe("opaque-token");
+	});
+});
@@ -0,0 +1,53 @@
+import { describe, expect, it } from "vitest";
+import { RogueJwksStore } from "../../src/core/rogue-jwks.js";
+
+describe("Rogue JWKS", () => {
+	const key = (kid: string) => ({ kty: "OKP", crv: "Ed25519", x: kid, kid });
+
+	it("should serve published keys per session", () => {
+		const store = new RogueJwksStore({ issuer: "https://loki.example" });
+		const publisher = store.forSession("sess_1");
+		publisher.publish(key("a"));
+		publisher.publish(key("a"));
+		publisher.publish(key("b"));
+
+		expect(publisher.url).toBe("https://loki.example/admin/rogue-jwks/sess_1");
+		expect(store.jwks("sess_1")?.keys.map((jwk) => jwk.kid)).toEqual(["a", "b"]);
+		expect(store.jwks("sess_2")).toBeUndefined();
+	});
+
+	it("should serve a session's latest certificate chain", () => {
+		const store = new RogueJwksStore({ issuer: "https://loki.example" });
+		const publisher = store.forSession("sess_1");
+		publisher.publishChain("first");
+		publisher.publishChain("second");
+
+		expect(publisher.x5uUrl).toBe("https://loki.example/admin/rogue-x5u/sess_1");
+		expect(store.chain("sess_1")).toBe("second");
+		expect(store.chain("sess_2")).toBeUndefined();
+	});
+
+	it("should keep only the latest keys of a session", () => {
+		const store = new RogueJwksStore({ issuer: "https://loki.example" });
+		for (let i = 0; i < 12; i++) {
+			store.publish("sess_1", key(`k${i}`));
+		}
+
+		const kids = store.jwks("sess_1")?.keys.map((jwk) => jwk.kid);
+		expect(kids).toHaveLength(10);
+		expect(kids?.[0]).toBe("k2");
+	});
+
+	it("should drop a session's keys on clear", () => {
+		const store = new RogueJwksStore({ issuer: "https://loki.example" });
+		store.publish("sess_1", key("a"));
+		store.publish("sess_2", key("b"));
+		store.publishChain("sess_1", "chain");
+
+		store.clear("sess_1");
+		expect(store.jwks("sess_1")).toBeUndefined();
+		expect(store.chain("sess_1")).toBeUndefined();
+		store.clearAll();
+		expect(store.jwks("sess_2")).toBeUndefined();
+	});
+});
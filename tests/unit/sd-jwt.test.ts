@@ -0,0 +1,68 @@
+import { createHash } from "node:crypto";
+import { describe, expect, it } from "vitest";
+import {
+	SD_ALG,
+	decodeDisclosure,
+	discloseClaims,
+	disclosureDigest,
+	encodeDisclosure,
+} from "../../src/core/sd-jwt.js";
+
+describe("SD-JWT", () => {
+	it("should match the disclosure and digest examples in the SD-JWT draft", () => {
+		const disclosure = "WyIyR0xDNDJzS1F2ZUNmR2ZyeU5STjl3IiwgImdpdmVuX25hbWUiLCAiSm9obiJd";
+		expect(decodeDisclosure(disclosure)).toEqual({
+			salt: "2GLC42sKQveCfGfryNRN9w",
+			name: "given_name",
+			value: "John",
+		});
+		expect(disclosureDigest(disclosure)).toBe("jsu9yVulwQQlhFlM_3JlzMaSFzglhQG0DpfayQwLUK4");
+	});
+
+	it("should encode disclosures that decode back to salt, name and value", () => {
+		const disclosure = encodeDisclosure("c2FsdA", "address", { country: "DE" });
+		expect(decodeDisclosure(disclosure)).toEqual({
+			salt: "c2FsdA",
+			name: "address",
+			value: { country: "DE" },
+		});
+		const unnamed = Buffer.from('["salt", "value"]').toString("base64url");
+		expect(decodeDisclosure(unnamed)).toBeUndefined();
+		expect(decodeDisclosure("not json")).toBeUndefined();
+	});
+
+	it("should move the named claims a payload carries into disclosures", () => {
+		const claims: Record<string, unknown> = {
+			iss: "https://loki.test",
+			sub: "alice",
+			email: "alice@loki.test",
+		};
+		const disclosures = discloseClaims(claims, ["email", "sub", "phone_number"]);
+
+		expect(disclosures.map((d) => decodeDisclosure(d)?.name)).toEqual(["email", "sub"]);
+		expect(decodeDisclosure(disclosures[0] ?? "")?.value).toBe("alice@loki.test");
+		expect(claims).not.toHaveProperty("sub");
+		expect(claims).not.toHaveProperty("email");
+		expect(claims.iss).toBe("https://loki.test");
+		expect(claims._sd_alg).toBe(SD_ALG);
+		expect(claims._sd).toEqual(disclosures.map(disclosureDigest).sort());
+	});
+
+	it("should salt each disclosure afresh", () => {
+		const first = discloseClaims({ sub: "alice" }, ["sub"]);
+		const second = discloseClaims({ sub: "alice" }, ["sub"]);
+		expect(first[0]).not.toBe(second[0]);
+	});
+
+	it("should leave a payload without the named claims untouched", () => {
+		const claims = { sub: "alice" };
+		expect(discloseClaims(claims, ["email"])).toEqual([]);
+		expect(claims).toEqual({ sub: "alice" });
+	});
+
+	it("should digest disclosures with SHA-256 over their encoded form", () => {
+		const disclosure = encodeDisclosure("salt", "sub", "alice");
+		const expected = createHash("sha256").update(disclosure, "ascii").digest("base64url");
+		expect(disclosureDigest(disclosure)).toBe(expected);
+	});
+});
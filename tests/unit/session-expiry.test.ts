@@ -0,0 +1,45 @@
+import { describe, expect, it } from "vitest";
+import {
+	EvictedSessions,
+	MAX_REMEMBERED,
+	expiresAt,
+	isTtl,
+} from "../../src/core/session-expiry.js";
+import type { Session } from "../../src/core/types.js";
+
+const session: Session = {
+	id: "sess_1",
+	mode: "explicit",
+	mischief: [],
+	startedAt: new Date("2026-01-01T00:00:00Z"),
+};
+
+describe("Session Expiry", () => {
+	it("should accept Go durations of at least 1s as a ttl", () => {
+		expect(isTtl("1s")).toBe(true);
+		expect(isTtl("1h30m")).toBe(true);
+		expect(isTtl("999ms")).toBe(false);
+		expect(isTtl("-1h")).toBe(false);
+		expect(isTtl("1 hour")).toBe(false);
+		expect(isTtl(3600)).toBe(false);
+	});
+
+	it("should expire a session its ttl after it started", () => {
+		expect(expiresAt(session, "2h")).toBe(Date.parse("2026-01-01T02:00:00Z"));
+		expect(expiresAt(session, undefined)).toBeUndefined();
+	});
+
+	it("should remember the most recently evicted sessions", () => {
+		const evicted = new EvictedSessions();
+		const at = new Date("2026-01-01T02:00:00Z");
+		for (let i = 0; i <= MAX_REMEMBERED; i++) {
+			evicted.remember(`sess_${i}`, at);
+		}
+
+		expect(evicted.evictedAt("sess_0")).toBeUndefined();
+		expect(evicted.evictedAt("sess_1")).toEqual(at);
+		expect(evicted.evictedAt(`sess_${MAX_REMEMBERED}`)).toEqual(at);
+		evicted.forget("sess_1");
+		expect(evicted.evictedAt("sess_1")).toBeUndefined();
+	});
+});
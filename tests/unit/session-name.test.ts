@@ -0,0 +1,51 @@
+import { describe, expect, it } from "vitest";
+import { sanitizeSessionName } from "../../src/core/session-name.js";
+import { DEFAULT_CONFIG, type SessionsConfig } from "../../src/core/types.js";
+
+const config = DEFAULT_CONFIG.sessions as Required<SessionsConfig>;
+
+describe("sanitizeSessionName", () => {
+	it("should accept and trim ordinary names", () => {
+		expect(sanitizeSessionName("  ci-run 1 ", config)).toEqual({
+			ok: true,
+			name: "ci-run 1",
+		});
+		expect(sanitizeSessionName("team/app:staging@v2.1", config)).toEqual({
+			ok: true,
+			name: "team/app:staging@v2.1",
+		});
+		expect(sanitizeSessionName("Prüfung", config)).toEqual({ ok: true, name: "Prüfung" });
+	});
+
+	it("should reject control characters", () => {
+		const names = ["line\nbreak", "tab\there", "bell\u0007", "esc\u001b[31mred", "nul\u0000"];
+		for (const name of names) {
+			expect(sanitizeSessionName(name, config).ok).toBe(false);
+		}
+	});
+
+	it("should reject log-injection punctuation", () => {
+		expect(sanitizeSessionName('name" level="error', config).ok).toBe(false);
+		expect(sanitizeSessionName("<script>", config).ok).toBe(false);
+	});
+
+	it("should reject overlong names without echoing them", () => {
+		const result = sanitizeSessionName("a".repeat(129), config);
+
+		expect(result).toEqual({ ok: false, error: "name must be at most 128 characters (got 129)" });
+		expect(sanitizeSessionName("a".repeat(128), config).ok).toBe(true);
+	});
+
+	it("should reject empty and non-string names", () => {
+		expect(sanitizeSessionName("   ", config).ok).toBe(false);
+		expect(sanitizeSessionName(42, config).ok).toBe(false);
+	});
+
+	it("should honour a custom length and allowlist", () => {
+		const strict = { nameMaxLength: 8, nameAllowedChars: "a-z" };
+
+		expect(sanitizeSessionName("abcdefgh", strict).ok).toBe(true);
+		expect(sanitizeSessionName("abcdefghi", strict).ok).toBe(false);
+		expect(sanitizeSessionName("abc-def", strict).ok).toBe(false);
+	});
+});
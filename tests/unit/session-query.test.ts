@@ -0,0 +1,40 @@
+import { describe, expect, it } from "vitest";
+import { querySessionId, withSessionQuery } from "../../src/core/session-query.js";
+
+describe("Session Query", () => {
+	it("should read the session a discovery or JWKS request names", () => {
+		const cases = [
+			["/.well-known/openid-configuration?loki_session=sess_1", "sess_1"],
+			["/.well-known/oauth-authorization-server?x=1&loki_session=sess_2", "sess_2"],
+			["/jwks?loki_session=sess_3", "sess_3"],
+			["/.well-known/jwks.json?loki_session=sess_4", "sess_4"],
+		] as const;
+		for (const [url, sessionId] of cases) {
+			expect(querySessionId(url)).toBe(sessionId);
+		}
+	});
+
+	it("should ignore the parameter when empty, absent or on other endpoints", () => {
+		for (const url of [
+			"/.well-known/openid-configuration?loki_session=",
+			"/.well-known/openid-configuration",
+			"/jwks",
+			"/token?loki_session=sess_1",
+			"/userinfo?loki_session=sess_1",
+		]) {
+			expect(querySessionId(url)).toBeUndefined();
+		}
+	});
+});
+
+describe("withSessionQuery", () => {
+	it("should name the session in a URL's query", () => {
+		expect(withSessionQuery("https://idp.example/jwks", "sess_1")).toBe(
+			"https://idp.example/jwks?loki_session=sess_1",
+		);
+		expect(withSessionQuery("https://idp.example/jwks?a=1&loki_session=old", "sess_1")).toBe(
+			"https://idp.example/jwks?a=1&loki_session=sess_1",
+		);
+		expect(withSessionQuery("not a url", "sess_1")).toBe("not a url");
+	});
+});
@@ -0,0 +1,36 @@
+import { describe, expect, it } from "vitest";
+import { mergeSpecPatch } from "../../src/core/session-spec.js";
+
+describe("mergeSpecPatch", () => {
+	const spec = {
+		mode: "explicit",
+		mischief: ["alg-none", "kid-manipulation"],
+		pluginConfig: { "kid-manipulation": { mode: "traversal", path: "/dev/null" } },
+		ttl: "1h",
+	};
+
+	it("should merge objects member by member and replace anything else", () => {
+		const merged = mergeSpecPatch(spec, {
+			mischief: ["alg-none"],
+			pluginConfig: { "kid-manipulation": { mode: "sql" }, "alg-none": { variant: "NONE" } },
+		});
+
+		expect(merged).toEqual({
+			mode: "explicit",
+			mischief: ["alg-none"],
+			pluginConfig: {
+				"kid-manipulation": { mode: "sql", path: "/dev/null" },
+				"alg-none": { variant: "NONE" },
+			},
+			ttl: "1h",
+		});
+	});
+
+	it("should remove members the patch sets to null, leaving the spec untouched", () => {
+		const merged = mergeSpecPatch(spec, { ttl: null, pluginConfig: { "kid-manipulation": null } });
+
+		expect(merged).toEqual({ mode: "explicit", mischief: spec.mischief, pluginConfig: {} });
+		expect(spec.ttl).toBe("1h");
+		expect(spec.pluginConfig["kid-manipulation"].path).toBe("/dev/null");
+	});
+});
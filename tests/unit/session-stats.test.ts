@@ -0,0 +1,62 @@
+import { describe, expect, it } from "vitest";
+import { SessionStatsStore } from "../../src/core/session-stats.js";
+
+describe("SessionStatsStore", () => {
+	it("should count issuances per mischief and track first and last", () => {
+		let now = Date.parse("2026-01-01T00:00:00Z");
+		const store = new SessionStatsStore(() => now);
+
+		store.recordIssuance("sess_1", []);
+		now += 1000;
+		store.recordIssuance("sess_1", ["alg-none", "kid-confusion"]);
+		now += 1000;
+		store.recordIssuance("sess_1", ["alg-none"]);
+
+		expect(store.stats("sess_1")).toEqual({
+			sessionId: "sess_1",
+			issuances: 3,
+			clean: 1,
+			mischief: { "alg-none": 2, "kid-confusion": 1 },
+			firstIssuedAt: "2026-01-01T00:00:00.000Z",
+			lastIssuedAt: "2026-01-01T00:00:02.000Z",
+			rateLimited: 0,
+		});
+		expect(store.stats("sess_2").issuances).toBe(0);
+	});
+
+	it("should allow a second's burst, then refill at the rate", () => {
+		let now = 0;
+		const store = new SessionStatsStore(() => now);
+
+		const burst = [1, 2, 3, 4].map(() => store.tryTake("sess_1", 3));
+		expect(burst).toEqual([true, true, true, false]);
+		expect(store.retryAfter("sess_1", 3)).toBe(1);
+
+		now += 400;
+		expect(store.tryTake("sess_1", 3)).toBe(true);
+		expect(store.tryTake("sess_1", 3)).toBe(false);
+		expect(store.stats("sess_1").rateLimited).toBe(2);
+	});
+
+	it("should hold one request for rates below one per second", () => {
+		let now = 0;
+		const store = new SessionStatsStore(() => now);
+
+		expect(store.tryTake("sess_1", 0.5)).toBe(true);
+		expect(store.tryTake("sess_1", 0.5)).toBe(false);
+		expect(store.retryAfter("sess_1", 0.5)).toBe(2);
+		now += 2000;
+		expect(store.tryTake("sess_1", 0.5)).toBe(true);
+	});
+
+	it("should drop a session's counters on clear", () => {
+		const store = new SessionStatsStore();
+		store.recordIssuance("sess_1", []);
+		store.recordIssuance("sess_2", []);
+
+		store.clear("sess_1");
+		expect(store.stats("sess_1").issuances).toBe(0);
+		store.clearAll();
+		expect(store.stats("sess_2").issuances).toBe(0);
+	});
+});
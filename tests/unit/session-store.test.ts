@@ -0,0 +1,79 @@
+import { describe, expect, it } from "vitest";
+import type { Session } from "../../src/core/types.js";
+import {
+	type PluginConfigSchemas,
+	restoreOptions,
+	sessionOptions,
+} from "../../src/persistence/session-store.js";
+
+/** latency-injection is on config v2, renaming `ms` to `delayMs`; alg-none never changed */
+const schemas: PluginConfigSchemas = {
+	configVersion: (id) => ({ "latency-injection": 2, "alg-none": 1 })[id],
+	migrateConfig(id, config, fromVersion) {
+		if (id !== "latency-injection" || fromVersion === 2) {
+			return config;
+		}
+		if (typeof config.ms !== "number") {
+			throw new Error("latency-injection: cannot migrate config from v1 to v2: ms is missing");
+		}
+		return { delayMs: config.ms };
+	},
+};
+
+function session(pluginConfig: Record<string, Record<string, unknown>>): Session {
+	return {
+		id: "sess_1",
+		mode: "explicit",
+		mischief: [],
+		startedAt: new Date(0),
+		pluginConfig,
+	};
+}
+
+describe("Session Store serialization", () => {
+	it("should stamp plugin config with the schema version it was written for", () => {
+		const options = sessionOptions(
+			session({ "latency-injection": { delayMs: 50 }, "gone-plugin": {} }),
+			schemas,
+		);
+
+		expect(options.pluginVersions).toEqual({ "latency-injection": 2 });
+		expect(sessionOptions(session({}))).not.toHaveProperty("pluginVersions");
+	});
+
+	it("should migrate stored plugin config to the current schema", () => {
+		const restored = session({});
+		restoreOptions(
+			restored,
+			{ pluginConfig: { "latency-injection": { ms: 50 }, "alg-none": {} }, seed: 7 },
+			schemas,
+		);
+
+		expect(restored.pluginConfig).toEqual({ "latency-injection": { delayMs: 50 }, "alg-none": {} });
+		expect(restored.seed).toBe(7);
+		expect(restored).not.toHaveProperty("pluginVersions");
+	});
+
+	it("should leave current config and config for unloaded plugins as written", () => {
+		const restored = session({});
+		restoreOptions(
+			restored,
+			{
+				pluginConfig: { "latency-injection": { delayMs: 50 }, "gone-plugin": { x: 1 } },
+				pluginVersions: { "latency-injection": 2 },
+			},
+			schemas,
+		);
+
+		expect(restored.pluginConfig).toEqual({
+			"latency-injection": { delayMs: 50 },
+			"gone-plugin": { x: 1 },
+		});
+	});
+
+	it("should refuse stored config that can't be migrated", () => {
+		expect(() =>
+			restoreOptions(session({}), { pluginConfig: { "latency-injection": {} } }, schemas),
+		).toThrow("Stored session 'sess_1' has unusable pluginConfig: latency-injection");
+	});
+});
@@ -0,0 +1,28 @@
+import { describe, expect, it } from "vitest";
+import { presentsToken, secretMatches } from "../../src/core/shared-secret.js";
+
+describe("Shared Secrets", () => {
+	it("should match only the same secret, whatever the lengths", () => {
+		expect(secretMatches("s3cret", "s3cret")).toBe(true);
+		expect(secretMatches("s3cre", "s3cret")).toBe(false);
+		expect(secretMatches("s3cret-and-more", "s3cret")).toBe(false);
+		expect(secretMatches("", "s3cret")).toBe(false);
+	});
+
+	it("should find the token in a bearer header, and in Basic credentials when asked", () => {
+		const basic = (credentials: string) => `Basic ${Buffer.from(credentials).toString("base64")}`;
+		const cases = [
+			{ header: "Bearer s3cret", bearerOnly: true, withBasic: true },
+			{ header: "Bearer wrong", bearerOnly: false, withBasic: false },
+			{ header: basic("admin:s3cret"), bearerOnly: false, withBasic: true },
+			{ header: basic(":s3cret"), bearerOnly: false, withBasic: true },
+			{ header: basic("s3cret"), bearerOnly: false, withBasic: false },
+			{ header: "s3cret", bearerOnly: false, withBasic: false },
+			{ header: undefined, bearerOnly: false, withBasic: false },
+		];
+		for (const { header, bearerOnly, withBasic } of cases) {
+			expect(presentsToken(header, "s3cret")).toBe(bearerOnly);
+			expect(presentsToken(header, "s3cret", { basic: true })).toBe(withBasic);
+		}
+	});
+});
@@ -0,0 +1,69 @@
+import { describe, expect, it } from "vitest";
+import {
+	CidrSet,
+	conditionCidrs,
+	parseCidr,
+	resolveSourceAddress,
+} from "../../src/core/source-address.js";
+
+describe("Source Address", () => {
+	describe("parseCidr", () => {
+		it("should parse IPv4 and IPv6 networks", () => {
+			expect(parseCidr("10.0.0.0/8")).toEqual({ address: "10.0.0.0", prefix: 8, family: "ipv4" });
+			expect(parseCidr("2001:db8::/32")).toEqual({
+				address: "2001:db8::",
+				prefix: 32,
+				family: "ipv6",
+			});
+		});
+
+		it("should treat a bare address as a single host", () => {
+			expect(parseCidr("192.0.2.1").prefix).toBe(32);
+			expect(parseCidr("::1").prefix).toBe(128);
+		});
+
+		it("should reject invalid CIDRs", () => {
+			for (const cidr of ["10.0.0.0/33", "10.0.0/8", "10.0.0.0/", "10.0.0.0/8/8", "example.com"]) {
+				expect(() => parseCidr(cidr)).toThrow(/Invalid CIDR/);
+			}
+		});
+	});
+
+	describe("CidrSet", () => {
+		it("should match addresses inside its networks", () => {
+			const set = new CidrSet(["10.0.0.0/8", "2001:db8::/32"]);
+
+			expect(set.has("10.1.2.3")).toBe(true);
+			expect(set.has("::ffff:10.1.2.3")).toBe(true);
+			expect(set.has("2001:db8::1")).toBe(true);
+			expect(set.has("192.0.2.1")).toBe(false);
+			expect(set.has("not-an-address")).toBe(false);
+		});
+	});
+
+	describe("conditionCidrs", () => {
+		it("should accept one CIDR or several", () => {
+			expect(conditionCidrs({ sourceCIDR: "10.0.0.0/8" })).toEqual(["10.0.0.0/8"]);
+			expect(() => conditionCidrs({ sourceCIDR: ["10.0.0.0/8", "bogus"] })).toThrow();
+		});
+	});
+
+	describe("resolveSourceAddress", () => {
+		const proxies = new CidrSet(["127.0.0.1", "172.16.0.0/12"]);
+
+		it("should use the peer when it isn't a trusted proxy", () => {
+			expect(resolveSourceAddress("198.51.100.7", "10.0.0.1", proxies)).toBe("198.51.100.7");
+		});
+
+		it("should walk X-Forwarded-For past trusted proxies", () => {
+			expect(
+				resolveSourceAddress("::ffff:127.0.0.1", "10.0.0.1, 203.0.113.9, 172.16.0.4", proxies),
+			).toBe("203.0.113.9");
+		});
+
+		it("should stop at the proxy when the next hop is malformed or missing", () => {
+			expect(resolveSourceAddress("127.0.0.1", "unknown", proxies)).toBe("127.0.0.1");
+			expect(resolveSourceAddress("127.0.0.1", undefined, proxies)).toBe("127.0.0.1");
+		});
+	});
+});
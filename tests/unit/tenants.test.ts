@@ -0,0 +1,65 @@
+import { describe, expect, it } from "vitest";
+import { TenantRegistry, tenantMetadata } from "../../src/core/tenants.js";
+
+const ISSUER = "http://localhost:3000";
+
+describe("Tenants", () => {
+	it("should give each tenant an issuer under Loki's", () => {
+		const tenants = new TenantRegistry(ISSUER, ["acme"]);
+
+		expect(tenants.register("globex")).toEqual({
+			id: "globex",
+			issuer: `${ISSUER}/globex`,
+			source: "admin",
+		});
+		expect(tenants.list().map((tenant) => tenant.id)).toEqual(["acme", "globex"]);
+		expect(tenants.issuers()).toEqual({ acme: `${ISSUER}/acme`, globex: `${ISSUER}/globex` });
+		expect(tenants.get("acme")?.source).toBe("config");
+	});
+
+	it("should refuse invalid, reserved and duplicate tenant ids", () => {
+		const tenants = new TenantRegistry(ISSUER, ["acme"]);
+
+		expect(tenants.register("acme")).toBe("tenant 'acme' is already registered");
+		expect(tenants.register("Token")).toBe("'Token' is a path Loki serves itself");
+		expect(tenants.register("a/b")).toMatch(/^tenant id must be/);
+		expect(tenants.register(".well-known")).toMatch(/^tenant id must be/);
+		expect(tenants.register(42)).toMatch(/^tenant id must be/);
+		expect(() => new TenantRegistry(ISSUER, ["admin"])).toThrow(/^provider\.tenants: /);
+	});
+
+	it("should strip a registered tenant's prefix from request URLs", () => {
+		const tenants = new TenantRegistry(ISSUER, ["acme"]);
+
+		expect(tenants.match("/acme/token")?.url).toBe("/token");
+		expect(tenants.match("/acme/.well-known/openid-configuration?x=1")?.url).toBe(
+			"/.well-known/openid-configuration?x=1",
+		);
+		expect(tenants.match("/acme")?.url).toBe("/");
+		expect(tenants.match("/acme?x=1")?.url).toBe("/?x=1");
+		expect(tenants.match("/acme/token")?.tenant.id).toBe("acme");
+		expect(tenants.match("/acmecorp/token")).toBeUndefined();
+		expect(tenants.match("/token")).toBeUndefined();
+
+		tenants.remove("acme");
+		expect(tenants.match("/acme/token")).toBeUndefined();
+	});
+
+	it("should move the issuer and every URL under it to the tenant's issuer", () => {
+		const metadata = {
+			issuer: ISSUER,
+			token_endpoint: `${ISSUER}/token`,
+			mtls_endpoint_aliases: { token_endpoint: `${ISSUER}/token` },
+			service_documentation: "https://docs.example/loki",
+			scopes_supported: ["openid"],
+		};
+
+		expect(tenantMetadata(metadata, ISSUER, `${ISSUER}/acme`)).toEqual({
+			issuer: `${ISSUER}/acme`,
+			token_endpoint: `${ISSUER}/acme/token`,
+			mtls_endpoint_aliases: { token_endpoint: `${ISSUER}/acme/token` },
+			service_documentation: "https://docs.example/loki",
+			scopes_supported: ["openid"],
+		});
+	});
+});
@@ -0,0 +1,48 @@
+import { describe, expect, it } from "vitest";
+import {
+	FORM_MEDIA_TYPE,
+	JSON_MEDIA_TYPE,
+	formEncodeTokenResponse,
+	mediaTypeOf,
+	negotiateTokenMediaType,
+} from "../../src/core/token-content-type.js";
+
+describe("Token Content Type", () => {
+	it("should serve JSON unless Accept prefers form encoding", () => {
+		expect(negotiateTokenMediaType(undefined)).toBe(JSON_MEDIA_TYPE);
+		expect(negotiateTokenMediaType("*/*")).toBe(JSON_MEDIA_TYPE);
+		expect(negotiateTokenMediaType("text/html")).toBe(JSON_MEDIA_TYPE);
+		expect(negotiateTokenMediaType("application/json, application/x-www-form-urlencoded")).toBe(
+			JSON_MEDIA_TYPE,
+		);
+		expect(negotiateTokenMediaType("application/x-www-form-urlencoded")).toBe(FORM_MEDIA_TYPE);
+		expect(
+			negotiateTokenMediaType("application/json;q=0.5, application/x-www-form-urlencoded"),
+		).toBe(FORM_MEDIA_TYPE);
+		expect(negotiateTokenMediaType("Application/X-WWW-Form-Urlencoded; q=0.9, */*;q=0.1")).toBe(
+			FORM_MEDIA_TYPE,
+		);
+	});
+
+	it("should form-encode a JSON object, sending objects as JSON and leaving out nulls", () => {
+		const body = JSON.stringify({
+			access_token: "abc",
+			expires_in: 3600,
+			authorization_details: [{ type: "payment" }],
+			refresh_token: null,
+		});
+		const form = new URLSearchParams(formEncodeTokenResponse(body));
+
+		expect(form.get("access_token")).toBe("abc");
+		expect(form.get("expires_in")).toBe("3600");
+		expect(form.get("authorization_details")).toBe('[{"type":"payment"}]');
+		expect(form.has("refresh_token")).toBe(false);
+		expect(formEncodeTokenResponse("not json")).toBeUndefined();
+		expect(formEncodeTokenResponse("[1, 2]")).toBeUndefined();
+	});
+
+	it("should read the media type of a Content-Type", () => {
+		expect(mediaTypeOf("Application/JSON; charset=utf-8")).toBe(JSON_MEDIA_TYPE);
+		expect(mediaTypeOf("text/html")).toBe("text/html");
+	});
+});
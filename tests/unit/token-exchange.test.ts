@@ -0,0 +1,86 @@
+import { describe, expect, it } from "vitest";
+import {
+	ACCESS_TOKEN_TYPE,
+	JWT_TOKEN_TYPE,
+	TOKEN_EXCHANGE_GRANT,
+	actorChain,
+	delegate,
+	mayAct,
+	parseExchangeRequest,
+} from "../../src/core/token-exchange.js";
+
+function form(params: Record<string, string | string[]>): Buffer {
+	const body = new URLSearchParams({ grant_type: TOKEN_EXCHANGE_GRANT });
+	for (const [name, value] of Object.entries(params)) {
+		for (const item of [value].flat()) {
+			body.append(name, item);
+		}
+	}
+	return Buffer.from(body.toString());
+}
+
+describe("Token exchange", () => {
+	it("should read the subject token, actor token and each audience once", () => {
+		const request = parseExchangeRequest(
+			form({
+				subject_token: "subject.jwt",
+				subject_token_type: ACCESS_TOKEN_TYPE,
+				actor_token: "actor.jwt",
+				actor_token_type: JWT_TOKEN_TYPE,
+				audience: ["https://orders.example", "https://billing.example", "https://orders.example"],
+			}),
+		);
+		expect(request).toEqual({
+			subjectToken: "subject.jwt",
+			subjectTokenType: ACCESS_TOKEN_TYPE,
+			actorToken: "actor.jwt",
+			actorTokenType: JWT_TOKEN_TYPE,
+			audience: ["https://orders.example", "https://billing.example"],
+		});
+	});
+
+	it("should say why a request is invalid", () => {
+		expect(parseExchangeRequest(form({ subject_token_type: ACCESS_TOKEN_TYPE }))).toBe(
+			"subject_token and subject_token_type are required",
+		);
+		const saml = "urn:ietf:params:oauth:token-type:saml2";
+		expect(parseExchangeRequest(form({ subject_token: "x", subject_token_type: saml }))).toContain(
+			"subject_token_type must be one of",
+		);
+
+		const subject = { subject_token: "x", subject_token_type: ACCESS_TOKEN_TYPE };
+		expect(parseExchangeRequest(form({ ...subject, actor_token: "y" }))).toContain(
+			"actor_token_type must be one of",
+		);
+		expect(parseExchangeRequest(form({ ...subject, actor_token_type: JWT_TOKEN_TYPE }))).toBe(
+			"actor_token_type must not be sent without actor_token",
+		);
+		const refresh = "urn:ietf:params:oauth:token-type:refresh_token";
+		expect(parseExchangeRequest(form({ ...subject, requested_token_type: refresh }))).toContain(
+			"requested_token_type must be one of",
+		);
+	});
+
+	it("should nest the subject token's act under the new actor", () => {
+		const first = delegate("orders-service", undefined);
+		expect(first).toEqual({ sub: "orders-service" });
+
+		const second = delegate("billing-service", first);
+		expect(second).toEqual({ sub: "billing-service", act: { sub: "orders-service" } });
+		expect(actorChain(second)).toEqual(["billing-service", "orders-service"]);
+	});
+
+	it("should read no actors from a missing or malformed act", () => {
+		expect(actorChain(undefined)).toEqual([]);
+		expect(actorChain("orders-service")).toEqual([]);
+		expect(actorChain({ client_id: "orders-service" })).toEqual([]);
+		expect(delegate("orders-service", { client_id: "x" })).toEqual({ sub: "orders-service" });
+	});
+
+	it("should let only the actor may_act names act for the subject", () => {
+		expect(mayAct(undefined, "orders-service")).toBe(true);
+		expect(mayAct({ sub: "orders-service" }, "orders-service")).toBe(true);
+		expect(mayAct({ sub: "orders-service" }, "billing-service")).toBe(false);
+		expect(mayAct("orders-service", "orders-service")).toBe(false);
+	});
+});
@@ -1,5 +1,13 @@
+import { createVerify } from "node:crypto";
+import * as jose from "jose";
 import { describe, expect, it } from "vitest";
-import { createToken, parseToken, signWithKeyConfusion } from "../../src/core/token-forge.js";
+import { generateSigningKey } from "../../src/core/key-manager.js";
+import {
+	createToken,
+	parseToken,
+	signWithKeyConfusion,
+	tokenHash,
+} from "../../src/core/token-forge.js";
 
 describe("TokenForge", () => {
 	// Sample JWT (RS256 signed, but we're just testing parsing)
@@ -34,6 +42,17 @@ describe("TokenForge", () => {
 			token.claims.exp = 0;
 			expect(token.claims.exp).toBe(0);
 		});
+
+		it("should keep an SD-JWT's disclosures after its JWS", () => {
+			const sdJwt = `${sampleJwt}~WyJzYWx0IiwibmFtZSIsIkpvaG4iXQ~`;
+			const token = parseToken(sdJwt);
+
+			expect(token.claims.sub).toBe("1234567890");
+			expect(token.disclosures).toEqual(["WyJzYWx0IiwibmFtZSIsIkpvaG4iXQ"]);
+			expect(token.build()).toBe(sdJwt);
+			expect(parseToken(`${sampleJwt}~`).build()).toBe(`${sampleJwt}~`);
+			expect(parseToken(sampleJwt).disclosures).toBeUndefined();
+		});
 	});
 
 	describe("alg:none attack", () => {
@@ -62,6 +81,15 @@ describe("TokenForge", () => {
 			expect(token.header.alg).toBe("none");
 			expect(token.signature).toBe("");
 		});
+
+		it("should keep a signature mischief left on an alg:none token", () => {
+			const token = parseToken(sampleJwt);
+
+			token.header.alg = "none";
+			token.signature = "Z2FyYmFnZQ";
+
+			expect(token.build().split(".")[2]).toBe("Z2FyYmFnZQ");
+		});
 	});
 
 	describe("createToken", () => {
@@ -132,4 +160,49 @@ MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA0Z3VS5JJcds3xfn/ygWyf8PgELY
 			expect(parts).toHaveLength(3);
 		});
 	});
+
+	describe("tokenHash", () => {
+		it("should match the c_hash example in OIDC Core", () => {
+			const code = "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk";
+			expect(tokenHash(code, "RS256")).toBe("LDktKdoQak3Pk0cnXxCltA");
+		});
+
+		it("should take half of the hash the alg names", () => {
+			const cases = [
+				{ alg: "ES256", length: 22 },
+				{ alg: "PS384", length: 32 },
+				{ alg: "RS512", length: 43 },
+				{ alg: "EdDSA", length: 43 },
+			];
+			for (const { alg, length } of cases) {
+				expect(tokenHash("token", alg)).toHaveLength(length);
+			}
+		});
+	});
+
+	describe("raw header", () => {
+		it("should emit and sign the exact raw header bytes", async () => {
+			const key = await generateSigningKey("ES256");
+			const token = parseToken(sampleJwt);
+			const rawHeader = '{"alg":"ES256","typ":"JWT","alg":"none"}';
+
+			token.rawHeader = rawHeader;
+			await token.sign("ES256", key.privateKey);
+			const result = token.build();
+
+			const [headerB64, payloadB64, signatureB64] = result.split(".");
+			expect(Buffer.from(headerB64 ?? "", "base64url").toString()).toBe(rawHeader);
+
+			// The last alg member is "none", so jose won't verify this - check the signature directly
+			const verifier = createVerify("sha256");
+			verifier.update(`${headerB64}.${payloadB64}`);
+			const publicKey = await jose.exportSPKI(key.publicKey);
+			expect(
+				verifier.verify(
+					{ key: publicKey, dsaEncoding: "ieee-p1363" },
+					Buffer.from(signatureB64 ?? "", "base64url"),
+				),
+			).toBe(true);
+		});
+	});
 });
@@ -0,0 +1,39 @@
+import * as jose from "jose";
+import { describe, expect, it } from "vitest";
+import { generateSigningKey } from "../../src/core/key-manager.js";
+import { refreshTokenTimes } from "../../src/core/token-freeze.js";
+
+describe("refreshTokenTimes", () => {
+	it("should move timestamps forward and keep the signature valid", async () => {
+		const key = await generateSigningKey("RS256");
+		const jwt = await new jose.SignJWT({ sub: "alice", jti: "frozen-jti" })
+			.setProtectedHeader({ alg: key.alg, kid: key.kid })
+			.setIssuedAt(1000)
+			.setExpirationTime(1600)
+			.sign(key.privateKey);
+
+		const refreshed = await refreshTokenTimes(jwt, key, 5000);
+		const { payload } = await jose.jwtVerify(refreshed, key.publicKey, {
+			currentDate: new Date(5000 * 1000),
+		});
+
+		expect(payload.iat).toBe(5000);
+		expect(payload.exp).toBe(5600);
+		expect(payload.jti).toBe("frozen-jti");
+	});
+
+	it("should keep unsigned tokens unsigned", async () => {
+		const key = await generateSigningKey("RS256");
+		const header = Buffer.from(JSON.stringify({ alg: "none" })).toString("base64url");
+		const payload = Buffer.from(JSON.stringify({ sub: "alice", iat: 1000, exp: 1600 })).toString(
+			"base64url",
+		);
+
+		const refreshed = await refreshTokenTimes(`${header}.${payload}.`, key, 5000);
+		const [refreshedHeader, refreshedPayload, signature] = refreshed.split(".");
+
+		expect(refreshedHeader).toBe(header);
+		expect(signature).toBe("");
+		expect(JSON.parse(Buffer.from(refreshedPayload ?? "", "base64url").toString()).exp).toBe(5600);
+	});
+});
@@ -0,0 +1,28 @@
+import { describe, expect, it } from "vitest";
+import {
+	isTokenLifetime,
+	tokenExpiry,
+	tokenLifetimeSeconds,
+} from "../../src/core/token-lifetime.js";
+
+describe("Token Lifetime", () => {
+	it("should accept Go durations of whole seconds, at least 1s", () => {
+		expect(isTokenLifetime("30s")).toBe(true);
+		expect(isTokenLifetime("1h30m")).toBe(true);
+		expect(isTokenLifetime("500ms")).toBe(false);
+		expect(isTokenLifetime("1.5s")).toBe(false);
+		expect(isTokenLifetime(60)).toBe(false);
+		expect(tokenLifetimeSeconds("5m")).toBe(300);
+	});
+
+	it("should compare exp with what expires_in implies from iat", () => {
+		expect(tokenExpiry({ iat: 1000, exp: 4600 }, 3600)).toEqual({
+			expiresIn: 3600,
+			exp: 4600,
+			difference: 0,
+		});
+		expect(tokenExpiry({ iat: 1000, exp: 1010 }, 3600).difference).toBe(-3590);
+		expect(tokenExpiry({ exp: 2000 }, 60, 1000).difference).toBe(940);
+		expect(tokenExpiry({}, 60)).toEqual({ expiresIn: 60, exp: null, difference: null });
+	});
+});
@@ -0,0 +1,54 @@
+import * as jose from "jose";
+import { describe, expect, it } from "vitest";
+import { TokenResults, tokenJti } from "../../src/core/token-results.js";
+
+describe("Token Results", () => {
+	it("should count tampered tokens passed when rejected and baseline tokens when accepted", () => {
+		const results = new TokenResults();
+		results.issue("sess_a", "jti-clean", "access_token", []);
+		results.issue("sess_a", "jti-none", "access_token", ["alg-none"]);
+		results.issue("sess_a", "jti-both", "access_token", ["alg-none", "kid-manipulation"]);
+		results.report("sess_a", { jti: "jti-clean", accepted: true });
+		results.report("sess_a", { jti: "jti-none", accepted: false });
+		results.report("sess_a", { jti: "jti-both", accepted: true, error: "should have failed" });
+
+		const report = results.getResults("sess_a");
+		expect(report.passed).toBe(false);
+		expect(report.totals).toEqual({ issued: 3, passed: 2, failed: 1, pending: 0, passRate: 2 / 3 });
+		expect(report.baseline).toMatchObject({ issued: 1, passed: 1, passRate: 1 });
+		expect(report.mischief["alg-none"]).toMatchObject({ issued: 2, passed: 1, failed: 1 });
+		expect(report.mischief["kid-manipulation"]).toMatchObject({ failed: 1, passRate: 0 });
+		expect(report.failures.map((t) => t.jti)).toEqual(["jti-both"]);
+	});
+
+	it("should only pass once something was reported", () => {
+		const results = new TokenResults();
+		results.issue("sess_a", "jti-1", "access_token", ["alg-none"]);
+
+		const pending = results.getResults("sess_a");
+		expect(pending.passed).toBe(false);
+		expect(pending.mischief["alg-none"]).toMatchObject({ pending: 1, passRate: null });
+
+		results.report("sess_a", { jti: "jti-1", accepted: false });
+		expect(results.getResults("sess_a").passed).toBe(true);
+	});
+
+	it("should match reports to the session that issued the jti", () => {
+		const results = new TokenResults();
+		results.issue("sess_a", "jti-1", "access_token", []);
+
+		expect(results.report("sess_b", { jti: "jti-1", accepted: true })).toBeUndefined();
+		expect(results.report("sess_a", { jti: "jti-2", accepted: true })).toBeUndefined();
+		expect(results.report("sess_a", { jti: "jti-1", accepted: true })?.tokenType).toBe(
+			"access_token",
+		);
+	});
+
+	it("should read the jti of JWTs only", () => {
+		const jwt = new jose.UnsecuredJWT({ jti: "abc" }).encode();
+
+		expect(tokenJti(jwt)).toBe("abc");
+		expect(tokenJti(new jose.UnsecuredJWT({}).encode())).toBeUndefined();
+		expect(tokenJti("opaque-token")).toBeUndefined();
+	});
+});
@@ -0,0 +1,256 @@
+import { describe, expect, it } from "vitest";
+import { diffTopology, exportTopology, parseTopology } from "../../src/core/topology.js";
+import { DEFAULT_CONFIG, type Session, type SessionsConfig } from "../../src/core/types.js";
+import { PluginRegistry } from "../../src/plugins/registry.js";
+import type { MischiefPlugin } from "../../src/plugins/types.js";
+
+const sessionsConfig = DEFAULT_CONFIG.sessions as Required<SessionsConfig>;
+
+/**
+ * A plugin whose v1 config `{delay: seconds}` became `{delayMs}` in v2
+ */
+const versionedPlugin: MischiefPlugin = {
+	id: "slow-down",
+	name: "Slow Down",
+	severity: "low",
+	phase: "response",
+	spec: { description: "test" },
+	description: "test",
+	configVersion: 2,
+	migrateConfig(config, fromVersion) {
+		if (fromVersion === 1 && typeof config.delay === "number") {
+			return { delayMs: config.delay * 1000 };
+		}
+		throw new Error("delay must be a number of seconds");
+	},
+	async apply() {
+		return { applied: false, mutation: "test", evidence: {} };
+	},
+};
+
+function registryWith(...plugins: MischiefPlugin[]): PluginRegistry {
+	const registry = new PluginRegistry();
+	for (const plugin of plugins) {
+		registry.register(plugin);
+	}
+	return registry;
+}
+
+function declaredSession(overrides: Partial<Session> = {}): Session {
+	return {
+		id: "checkout",
+		mode: "explicit",
+		mischief: ["alg-none"],
+		startedAt: new Date(),
+		declared: true,
+		...overrides,
+	};
+}
+
+describe("Topology", () => {
+	describe("parseTopology", () => {
+		it("should parse declared sessions with their ids", () => {
+			const result = parseTopology(
+				{ sessions: [{ id: "checkout", mischief: ["alg-none"], name: "Checkout" }] },
+				sessionsConfig,
+			);
+
+			expect(result).toEqual({
+				ok: true,
+				sessions: [
+					{
+						id: "checkout",
+						config: { mode: "explicit", mischief: ["alg-none"], name: "Checkout" },
+					},
+				],
+			});
+		});
+
+		it("should collect every error in the document", () => {
+			const result = parseTopology(
+				{
+					realms: [],
+					widgets: {},
+					sessions: [
+						{ id: "ok" },
+						{ id: "ok" },
+						{ id: "bad id" },
+						{ id: "cidr", when: { sourceCIDR: "10.0.0.0/33" } },
+					],
+				},
+				sessionsConfig,
+			);
+
+			expect(result.ok).toBe(false);
+			if (!result.ok) {
+				expect(result.errors).toHaveLength(5);
+				expect(result.errors[0]).toMatch(/^realms: not supported/);
+				expect(result.errors[1]).toBe("widgets: unknown topology key");
+				expect(result.errors[2]).toMatch(/declared more than once/);
+				expect(result.errors[3]).toMatch(/^sessions\[2\]\.id must be/);
+				expect(result.errors[4]).toMatch(/^sessions\[3\]: when\.sourceCIDR/);
+			}
+		});
+
+		it("should reject a non-array sessions key", () => {
+			expect(parseTopology({ sessions: {} }, sessionsConfig)).toEqual({
+				ok: false,
+				errors: ["sessions must be an array"],
+			});
+		});
+	});
+
+	describe("versioned bundles", () => {
+		const unversioned: MischiefPlugin = { ...versionedPlugin, id: "steady", configVersion: 1 };
+		delete unversioned.migrateConfig;
+
+		it("should migrate config from a bundle that predates versioning", () => {
+			const oldBundle = {
+				sessions: [
+					{ id: "slow", mischief: ["slow-down"], pluginConfig: { "slow-down": { delay: 2 } } },
+				],
+			};
+			const result = parseTopology(oldBundle, sessionsConfig, registryWith(versionedPlugin));
+
+			expect(result.ok && result.sessions[0]?.config.pluginConfig).toEqual({
+				"slow-down": { delayMs: 2000 },
+			});
+		});
+
+		it("should leave config at the current version untouched", () => {
+			const bundle = {
+				pluginVersions: { "slow-down": 2 },
+				sessions: [{ id: "slow", pluginConfig: { "slow-down": { delayMs: 5 } } }],
+			};
+			const result = parseTopology(bundle, sessionsConfig, registryWith(versionedPlugin));
+
+			expect(result.ok && result.sessions[0]?.config.pluginConfig).toEqual({
+				"slow-down": { delayMs: 5 },
+			});
+		});
+
+		it("should fail clearly when config can't be migrated", () => {
+			const registry = registryWith(versionedPlugin, { ...unversioned, configVersion: 3 });
+			const result = parseTopology(
+				{
+					pluginVersions: { "slow-down": 1, steady: 1, future: 1 },
+					sessions: [
+						{ id: "a", pluginConfig: { "slow-down": { delay: "soon" } } },
+						{ id: "b", pluginConfig: { steady: {} } },
+						{ id: "c", pluginConfig: { "slow-down": {} }, mischief: ["missing"] },
+					],
+				},
+				sessionsConfig,
+				registry,
+			);
+
+			expect(result).toEqual({
+				ok: false,
+				errors: [
+					"sessions[0]: pluginConfig: slow-down: cannot migrate config from v1 to v2: delay must be a number of seconds",
+					"sessions[1]: pluginConfig: steady: config schema changed incompatibly (v1 to v3), no migrator",
+					"sessions[2]: unknown plugin 'missing'",
+				],
+			});
+		});
+
+		it("should reject config from a newer schema", () => {
+			const bundle = {
+				pluginVersions: { "slow-down": 3 },
+				sessions: [{ id: "a", pluginConfig: { "slow-down": {} } }],
+			};
+			const result = parseTopology(bundle, sessionsConfig, registryWith(versionedPlugin));
+
+			expect(result.ok).toBe(false);
+			expect(!result.ok && result.errors[0]).toMatch(/version 3 is newer than this Loki supports/);
+		});
+
+		it("should export declared sessions stamped with plugin config versions", () => {
+			const exported = exportTopology(
+				[
+					declaredSession({ mischief: ["slow-down"], pluginConfig: { steady: {} } }),
+					declaredSession({ id: "sess_imperative", declared: false, mischief: ["other"] }),
+				],
+				registryWith(versionedPlugin, unversioned),
+			);
+
+			expect(exported).toEqual({
+				pluginVersions: { "slow-down": 2, steady: 1 },
+				sessions: [
+					{
+						id: "checkout",
+						mode: "explicit",
+						mischief: ["slow-down"],
+						pluginConfig: { steady: {} },
+					},
+				],
+			});
+		});
+	});
+
+	describe("diffTopology", () => {
+		it("should plan creates, updates, deletes and unchanged sessions", () => {
+			const current = [
+				declaredSession({ id: "same" }),
+				declaredSession({ id: "drifted" }),
+				declaredSession({ id: "dropped" }),
+				declaredSession({ id: "sess_imperative", declared: false }),
+			];
+			const result = diffTopology(current, [
+				{ id: "same", config: { mode: "explicit", mischief: ["alg-none"] } },
+				{ id: "drifted", config: { mode: "random", mischief: ["alg-none"], probability: 0.5 } },
+				{ id: "new", config: { mode: "explicit", mischief: [] } },
+			]);
+
+			expect(result).toEqual({
+				ok: true,
+				plan: {
+					created: ["new"],
+					updated: [{ id: "drifted", fields: ["mode", "probability"] }],
+					deleted: ["dropped"],
+					unchanged: ["same"],
+				},
+			});
+		});
+
+		it("should treat a zero warm-up as no warm-up", () => {
+			const config = { mode: "explicit" as const, mischief: ["alg-none"], warmupRequests: 0 };
+			const result = diffTopology([declaredSession()], [{ id: "checkout", config }]);
+
+			expect(result.ok && result.plan.unchanged).toEqual(["checkout"]);
+		});
+
+		it("should only count a seed as drift when one is declared", () => {
+			const current = declaredSession({
+				mode: "probabilistic",
+				mischief: ["alg-none"],
+				probabilities: { "alg-none": 0.1 },
+				seed: 1234,
+			});
+			const config = {
+				mode: "probabilistic" as const,
+				mischief: ["alg-none"],
+				probabilities: { "alg-none": 0.1 },
+			};
+
+			const undeclared = diffTopology([current], [{ id: "checkout", config }]);
+			expect(undeclared.ok && undeclared.plan.unchanged).toEqual(["checkout"]);
+			const reseeded = diffTopology([current], [
+				{ id: "checkout", config: { ...config, seed: 1 } },
+			]);
+			expect(reseeded.ok && reseeded.plan.updated).toEqual([{ id: "checkout", fields: ["seed"] }]);
+		});
+
+		it("should refuse to take over sessions it did not create", () => {
+			const result = diffTopology(
+				[declaredSession({ declared: false })],
+				[{ id: "checkout", config: { mode: "explicit", mischief: [] } }],
+			);
+
+			expect(result).toEqual({
+				ok: false,
+				errors: ["session 'checkout' exists but was not created by a topology"],
+			});
+		});
+	});
+});
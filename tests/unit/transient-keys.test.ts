@@ -0,0 +1,71 @@
+import { describe, expect, it } from "vitest";
+import { TransientKeyStore } from "../../src/core/transient-keys.js";
+
+describe("Transient Keys", () => {
+	const key = (kid: string) => ({ kty: "OKP", crv: "Ed25519", x: kid, kid });
+	const added = Date.parse("2026-01-01T00:00:00Z");
+
+	it("should serve a key for its fetches, then remove it", () => {
+		const store = new TransientKeyStore();
+		store.publish("sess_1", key("a"), { fetches: 2 }, added);
+
+		expect(store.serve("sess_1", added + 1000).map((jwk) => jwk.kid)).toEqual(["a"]);
+		expect(store.serve("sess_2", added + 1000)).toEqual([]);
+		expect(store.report("sess_1", added + 1500)[0]?.removedAt).toBeNull();
+		expect(store.serve("sess_1", added + 2000)).toHaveLength(1);
+		expect(store.serve("sess_1", added + 3000)).toEqual([]);
+
+		expect(store.report("sess_1")).toEqual([
+			{
+				kid: "a",
+				addedAt: "2026-01-01T00:00:00.000Z",
+				removedAt: "2026-01-01T00:00:02.000Z",
+				fetches: 2,
+				window: { fetches: 2 },
+			},
+		]);
+	});
+
+	it("should remove a key when its seconds run out, as of the deadline", () => {
+		const store = new TransientKeyStore();
+		store.publish("sess_1", key("a"), { fetches: 5, seconds: 10 }, added);
+
+		expect(store.serve("sess_1", added + 9000)).toHaveLength(1);
+		expect(store.serve("sess_1", added + 30_000)).toEqual([]);
+		const [record] = store.report("sess_1");
+		expect(record?.removedAt).toBe("2026-01-01T00:00:10.000Z");
+		expect(record?.fetches).toBe(1);
+	});
+
+	it("should default to a single fetch and keep removed keys for the report", () => {
+		const store = new TransientKeyStore();
+		store.forSession("sess_1").publish(key("a"), {});
+
+		expect(store.serve("sess_1")).toHaveLength(1);
+		expect(store.serve("sess_1")).toEqual([]);
+		expect(store.keys("sess_1").map((jwk) => jwk.kid)).toEqual(["a"]);
+		expect(store.report("sess_1")[0]?.window).toEqual({ fetches: 1 });
+	});
+
+	it("should keep the Cache-Control a session's JWKS is served with", () => {
+		const store = new TransientKeyStore();
+		expect(store.cacheControl("sess_1")).toBeUndefined();
+
+		store.forSession("sess_1").cacheControl("no-store");
+		expect(store.cacheControl("sess_1")).toBe("no-store");
+		expect(store.cacheControl("sess_2")).toBeUndefined();
+	});
+
+	it("should drop a session's keys on clear", () => {
+		const store = new TransientKeyStore();
+		store.publish("sess_1", key("a"), { fetches: 1 });
+		store.publish("sess_2", key("b"), { fetches: 1 });
+		store.forSession("sess_1").cacheControl("no-store");
+
+		store.clear("sess_1");
+		expect(store.report("sess_1")).toEqual([]);
+		expect(store.cacheControl("sess_1")).toBeUndefined();
+		store.clearAll();
+		expect(store.keys("sess_2")).toEqual([]);
+	});
+});
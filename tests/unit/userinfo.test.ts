@@ -0,0 +1,69 @@
+import { describe, expect, it } from "vitest";
+import {
+	DEFAULT_SCOPE_CLAIMS,
+	accountClaims,
+	claimsForScopes,
+	isAccessTokenJwt,
+	subjectError,
+} from "../../src/core/userinfo.js";
+
+describe("claimsForScopes", () => {
+	const claims = accountClaims("alice");
+
+	it("should release only sub for openid", () => {
+		expect(claimsForScopes(claims, ["openid"])).toEqual({ sub: "alice" });
+	});
+
+	it("should release the claims each granted scope maps to", () => {
+		const released = claimsForScopes(claims, ["openid", "email"]);
+
+		expect(Object.keys(released).sort()).toEqual(["email", "email_verified", "sub"]);
+		expect(released.email).toBe("alice@loki.test");
+	});
+
+	it("should honour a custom scope map", () => {
+		const released = claimsForScopes(claims, ["openid", "contact"], {
+			...DEFAULT_SCOPE_CLAIMS,
+			contact: ["email", "picture"],
+		});
+
+		expect(Object.keys(released).sort()).toEqual(["email", "picture", "sub"]);
+	});
+
+	it("should ignore unknown scopes", () => {
+		expect(claimsForScopes(claims, ["openid", "admin"])).toEqual({ sub: "alice" });
+	});
+});
+
+describe("subjectError", () => {
+	it("should accept subjects up to 255 characters", () => {
+		expect(subjectError("alice")).toBeUndefined();
+		expect(subjectError("a".repeat(255))).toBeUndefined();
+	});
+
+	it("should reject overlong subjects", () => {
+		expect(subjectError("a".repeat(256))).toBe("sub is 256 characters, longer than 255");
+		expect(subjectError("alice", 4)).toBe("sub is 5 characters, longer than 4");
+	});
+
+	it("should reject empty and non-ASCII subjects", () => {
+		expect(subjectError("")).toBe("sub must not be empty");
+		expect(subjectError("j\u00fcrgen")).toBe("sub must be printable ASCII");
+		expect(subjectError("alice\n")).toBe("sub must be printable ASCII");
+	});
+});
+
+describe("isAccessTokenJwt", () => {
+	it("should accept RFC 9068 access tokens and tokens granted to a client", () => {
+		expect(isAccessTokenJwt({ typ: "at+jwt" }, { sub: "alice" })).toBe(true);
+		expect(isAccessTokenJwt({ typ: "application/at+jwt" }, { sub: "alice" })).toBe(true);
+		expect(isAccessTokenJwt({ typ: "JWT" }, { sub: "alice", client_id: "app" })).toBe(true);
+		expect(isAccessTokenJwt({}, { sub: "alice", scope: "openid" })).toBe(true);
+	});
+
+	it("should reject ID tokens", () => {
+		expect(isAccessTokenJwt({ typ: "JWT" }, { sub: "alice", aud: "app" })).toBe(false);
+		expect(isAccessTokenJwt({}, { sub: "alice", client_id: "app", nonce: "n" })).toBe(false);
+		expect(isAccessTokenJwt({}, { sub: "alice", scope: "openid", at_hash: "h" })).toBe(false);
+	});
+});
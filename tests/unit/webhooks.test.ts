@@ -0,0 +1,109 @@
+import { describe, expect, it } from "vitest";
+import type { TokenIssuance } from "../../src/core/issuance-log.js";
+import {
+	WebhookDispatcher,
+	type WebhookDelivery,
+	isWebhookUrl,
+	tokenIssuedEvent,
+} from "../../src/core/webhooks.js";
+
+/**
+ * A fetch that answers with the given statuses in turn (throwing for null)
+ * and remembers the bodies it was sent
+ */
+function stubFetch(statuses: (number | null)[], bodies: unknown[] = []): typeof fetch {
+	let call = 0;
+	return (async (_url: string, init?: RequestInit) => {
+		bodies.push(JSON.parse(String(init?.body)));
+		const status = statuses[Math.min(call++, statuses.length - 1)] ?? null;
+		if (status === null) {
+			throw new Error("connect ECONNREFUSED");
+		}
+		return new Response(null, { status });
+	}) as typeof fetch;
+}
+
+function deliver(dispatcher: WebhookDispatcher, event: unknown): Promise<WebhookDelivery> {
+	return new Promise((resolve) => {
+		dispatcher.send("http://ci.test/hook", event, resolve);
+	});
+}
+
+describe("Webhooks", () => {
+	it("should describe an issuance by fingerprint, not the token", () => {
+		const issuance: TokenIssuance = {
+			tokenType: "access_token",
+			jti: "jti-1",
+			issuedAt: "2026-01-01T00:00:00.000Z",
+			mischief: ["alg-none"],
+			mutations: [],
+			changes: { header: [], claims: [] },
+			header: { alg: "none" },
+			signingKey: null,
+		};
+
+		const event = tokenIssuedEvent("sess_1", "a.b.", issuance);
+
+		expect(event).toEqual({
+			event: "token.issued",
+			sessionId: "sess_1",
+			tokenType: "access_token",
+			jti: "jti-1",
+			issuedAt: "2026-01-01T00:00:00.000Z",
+			requestId: null,
+			mischief: ["alg-none"],
+			fingerprint: { sha256: expect.any(String), signingKey: null },
+		});
+		expect(JSON.stringify(event)).not.toContain("a.b.");
+	});
+
+	it("should deliver an event as JSON", async () => {
+		const bodies: unknown[] = [];
+		const dispatcher = new WebhookDispatcher({ fetch: stubFetch([204], bodies) });
+
+		const delivery = await deliver(dispatcher, { event: "token.issued" });
+
+		expect(delivery).toEqual({
+			url: "http://ci.test/hook",
+			delivered: true,
+			attempts: 1,
+			status: 204,
+		});
+		expect(bodies).toEqual([{ event: "token.issued" }]);
+	});
+
+	it("should retry a failing webhook a bounded number of times", async () => {
+		const retried = new WebhookDispatcher({ fetch: stubFetch([null, 503, 200]) });
+		expect(await deliver(retried, {})).toMatchObject({ delivered: true, attempts: 3 });
+
+		const down = new WebhookDispatcher({ maxAttempts: 2, fetch: stubFetch([500]) });
+		expect(await deliver(down, {})).toEqual({
+			url: "http://ci.test/hook",
+			delivered: false,
+			attempts: 2,
+			status: 500,
+			error: "HTTP 500",
+		});
+	});
+
+	it("should return before the delivery finishes", async () => {
+		const dispatcher = new WebhookDispatcher({ fetch: stubFetch([null]), maxAttempts: 2 });
+		let done = false;
+
+		const queued = dispatcher.send("http://ci.test/hook", {}, () => {
+			done = true;
+		});
+
+		expect(queued).toBe(true);
+		expect(done).toBe(false);
+		await dispatcher.flush();
+		expect(done).toBe(true);
+	});
+
+	it("should accept only absolute http(s) URLs", () => {
+		expect(isWebhookUrl("https://ci.test/hook")).toBe(true);
+		expect(isWebhookUrl("/hook")).toBe(false);
+		expect(isWebhookUrl("file:///etc/passwd")).toBe(false);
+		expect(() => new WebhookDispatcher({ maxAttempts: 0 })).toThrow("maxAttempts");
+	});
+});
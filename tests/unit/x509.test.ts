@@ -0,0 +1,53 @@
+import { X509Certificate, generateKeyPairSync } from "node:crypto";
+import { describe, expect, it } from "vitest";
+import { certificateThumbprints, selfSignedCertificate } from "../../src/core/x509.js";
+
+describe("X.509", () => {
+	const cases = [
+		{ name: "RSA", keys: () => generateKeyPairSync("rsa", { modulusLength: 2048 }) },
+		{ name: "P-256", keys: () => generateKeyPairSync("ec", { namedCurve: "P-256" }) },
+		{ name: "P-384", keys: () => generateKeyPairSync("ec", { namedCurve: "P-384" }) },
+		{ name: "P-521", keys: () => generateKeyPairSync("ec", { namedCurve: "P-521" }) },
+		{ name: "Ed25519", keys: () => generateKeyPairSync("ed25519") },
+	];
+
+	for (const { name, keys } of cases) {
+		it(`should create a self-signed ${name} certificate that parses and verifies`, () => {
+			const { privateKey, publicKey } = keys();
+			const cert = selfSignedCertificate({ privateKey, commonName: "Loki Attacker" });
+			const parsed = new X509Certificate(Buffer.from(cert.x5c, "base64"));
+
+			expect(parsed.subject).toBe("CN=Loki Attacker");
+			expect(parsed.checkIssued(parsed)).toBe(true);
+			expect(parsed.verify(publicKey)).toBe(true);
+			expect(parsed.publicKey.equals(publicKey)).toBe(true);
+			expect(new X509Certificate(cert.pem).raw.equals(cert.der)).toBe(true);
+		});
+	}
+
+	it("should set the validity window", () => {
+		const { privateKey } = generateKeyPairSync("ec", { namedCurve: "P-256" });
+		const notBefore = new Date("2026-01-01T00:00:00Z");
+		const cert = selfSignedCertificate({
+			privateKey,
+			commonName: "Loki Attacker",
+			notBefore,
+			validityDays: 30,
+		});
+		const parsed = new X509Certificate(cert.der);
+
+		expect(new Date(parsed.validFrom)).toEqual(notBefore);
+		expect(new Date(parsed.validTo)).toEqual(new Date("2026-01-31T00:00:00Z"));
+	});
+
+	it("should thumbprint each certificate in a PEM chain", () => {
+		const { privateKey } = generateKeyPairSync("ed25519");
+		const first = selfSignedCertificate({ privateKey, commonName: "one" });
+		const second = selfSignedCertificate({ privateKey, commonName: "two" });
+
+		expect(certificateThumbprints(`${first.pem}${second.pem}`)).toEqual([
+			first.x5tS256,
+			second.x5tS256,
+		]);
+	});
+});